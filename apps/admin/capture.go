@@ -0,0 +1,120 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingostack/neon/pkg/capture"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/pingostack/neon/pkg/stats"
+)
+
+// stats are sampled to the running captures this often
+const captureStatsInterval = 2 * time.Second
+
+func (s *Server) handleStartCapture(gc *gin.Context) {
+	var req CaptureRequest
+	if err := gc.ShouldBindJSON(&req); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Stream == "" && req.Session == "" {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": "stream or session required"})
+		return
+	}
+
+	c := capture.Start(capture.Target{
+		Namespace: req.Namespace,
+		Stream:    req.Stream,
+		Session:   req.Session,
+	}, capture.Options{
+		Size:            req.Size,
+		DurationSeconds: req.DurationSeconds,
+		Log:             req.Log,
+	})
+	metrics.Go("admin", func() { s.sampleCapture(c) })
+
+	s.logger.WithField("capture", c.ID()).WithField("target", c.Target()).Info("capture started by admin api")
+	gc.JSON(http.StatusCreated, c.Info())
+}
+
+func (s *Server) handleListCaptures(gc *gin.Context) {
+	captures := make([]capture.Bundle, 0)
+	for _, c := range capture.List() {
+		captures = append(captures, c.Info())
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"captures": captures})
+}
+
+// handleGetCapture returns the bundle of a capture, running or stopped.
+func (s *Server) handleGetCapture(gc *gin.Context) {
+	c, found := capture.Get(gc.Param("id"))
+	if !found {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "capture not found"})
+		return
+	}
+
+	gc.JSON(http.StatusOK, c.Bundle())
+}
+
+func (s *Server) handleRemoveCapture(gc *gin.Context) {
+	if !capture.Remove(gc.Param("id")) {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "capture not found"})
+		return
+	}
+
+	gc.Status(http.StatusNoContent)
+}
+
+// sampleCapture adds the stats of the captured streams and sessions until the
+// capture stops.
+func (s *Server) sampleCapture(c *capture.Capture) {
+	ticker := time.NewTicker(captureStatsInterval)
+	defer ticker.Stop()
+
+	target := c.Target()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-c.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if target.Session == "" {
+			for _, ns := range s.core.Namespaces() {
+				for _, r := range ns.Routers() {
+					if !target.Match(capture.Target{Namespace: ns.Name(), Stream: r.ID()}) {
+						continue
+					}
+
+					c.Add(capture.Entry{
+						Time:    time.Now(),
+						Kind:    capture.KindStats,
+						Message: "stream stats",
+						Data:    map[string]interface{}{"stream": stats.NewStream(r)},
+					})
+				}
+			}
+
+			continue
+		}
+
+		session, found := s.core.LookupSession(target.Session)
+		if !found {
+			continue
+		}
+
+		c.Add(capture.Entry{
+			Time:    time.Now(),
+			Kind:    capture.KindStats,
+			Session: session.ID(),
+			Message: "session stats",
+			Data:    map[string]interface{}{"session": stats.NewSession(session)},
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingostack/neon/pkg/record/catalog"
+	"github.com/pkg/errors"
+)
+
+// handleListRecordings lists the recordings of the catalog, ?path= a
+// namespace/stream pattern, ?room=, ?codec=, ?from= and ?to= RFC 3339 times
+// of the recordings overlapping them, ?offset= and ?limit= a page.
+func (s *Server) handleListRecordings(gc *gin.Context) {
+	if s.record == nil {
+		gc.JSON(http.StatusNotImplemented, gin.H{"error": "record not supported"})
+		return
+	}
+
+	f := catalog.Filter{
+		Path:  gc.Query("path"),
+		Room:  gc.Query("room"),
+		Codec: gc.Query("codec"),
+	}
+
+	var err error
+	for _, q := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &f.From}, {"to", &f.To}} {
+		if v := gc.Query(q.name); v != "" {
+			if *q.t, err = time.Parse(time.RFC3339, v); err != nil {
+				gc.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + q.name})
+				return
+			}
+		}
+	}
+
+	for _, q := range []struct {
+		name string
+		n    *int
+	}{{"offset", &f.Offset}, {"limit", &f.Limit}} {
+		if v := gc.Query(q.name); v != "" {
+			if *q.n, err = strconv.Atoi(v); err != nil || *q.n < 0 {
+				gc.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + q.name})
+				return
+			}
+		}
+	}
+
+	entries, err := s.record.Recordings(f)
+	if err != nil {
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordings := make([]RecordingEntry, len(entries))
+	for i, e := range entries {
+		recordings[i] = RecordingEntry{Entry: e, Duration: e.Duration.Seconds()}
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"recordings": recordings})
+}
+
+// handleDeleteRecording removes a recording of the catalog with its file and
+// upload, the id is its path in the record dir.
+func (s *Server) handleDeleteRecording(gc *gin.Context) {
+	if s.record == nil {
+		gc.JSON(http.StatusNotImplemented, gin.H{"error": "record not supported"})
+		return
+	}
+
+	err := s.record.DeleteRecording(strings.TrimPrefix(gc.Param("file"), "/"))
+	if errors.Is(err, catalog.ErrNotFound) {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "recording not found"})
+		return
+	} else if err != nil {
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	gc.Status(http.StatusNoContent)
+}
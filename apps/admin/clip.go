@@ -0,0 +1,62 @@
+package admin
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingostack/neon/pkg/record"
+	"github.com/pkg/errors"
+)
+
+// handleExportClip cuts a clip of the recordings of a stream, the url in the
+// response downloads it unless it was only uploaded.
+func (s *Server) handleExportClip(gc *gin.Context) {
+	if s.record == nil {
+		gc.JSON(http.StatusNotImplemented, gin.H{"error": "record not supported"})
+		return
+	}
+
+	var req ClipRequest
+	if err := gc.ShouldBindJSON(&req); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	clip, err := s.record.ExportClip(req.Namespace, req.Stream, req.Start, req.End, req.Upload)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		gc.JSON(http.StatusNotFound, gin.H{"error": "no recordings in range"})
+		return
+	case errors.Is(err, record.ErrInvalidRange), errors.Is(err, record.ErrUnsupportedFormat), errors.Is(err, record.ErrNoKeyframes):
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	url := ""
+	if clip.File != "" {
+		url = path.Join("/api/v1/clips", clip.File)
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"clip": clip, "url": url})
+}
+
+func (s *Server) handleGetClip(gc *gin.Context) {
+	if s.record == nil {
+		gc.JSON(http.StatusNotImplemented, gin.H{"error": "record not supported"})
+		return
+	}
+
+	file, err := s.record.ClipPath(strings.TrimPrefix(gc.Param("file"), "/"))
+	if err != nil {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "clip not found"})
+		return
+	}
+
+	gc.FileAttachment(file, path.Base(gc.Param("file")))
+}
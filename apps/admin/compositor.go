@@ -0,0 +1,61 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingostack/neon/pkg/compositor"
+)
+
+func (s *Server) handleListCompositions(gc *gin.Context) {
+	compositions := make([]compositor.Info, 0)
+	for _, c := range compositor.List() {
+		compositions = append(compositions, c.Info())
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"compositions": compositions})
+}
+
+// lookupComposition finds the composition of the path, <namespace>/<stream>
+// of its output.
+func (s *Server) lookupComposition(gc *gin.Context) (*compositor.Compositor, bool) {
+	c, found := compositor.Get(strings.TrimPrefix(gc.Param("id"), "/"))
+	if !found {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "composition not found"})
+		return nil, false
+	}
+
+	return c, true
+}
+
+func (s *Server) handleGetComposition(gc *gin.Context) {
+	c, found := s.lookupComposition(gc)
+	if !found {
+		return
+	}
+
+	gc.JSON(http.StatusOK, c.Info())
+}
+
+func (s *Server) handleSetCompositionLayout(gc *gin.Context) {
+	var req CompositionLayoutRequest
+	if err := gc.ShouldBindJSON(&req); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c, found := s.lookupComposition(gc)
+	if !found {
+		return
+	}
+
+	layout := compositor.Layout{Kind: compositor.Kind(req.Kind), Main: req.Main}
+	if err := c.SetLayout(layout); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.logger.WithField("composition", c.ID()).WithField("layout", req.Kind).WithField("main", req.Main).Info("composition layout set by admin api")
+	gc.JSON(http.StatusOK, c.Info())
+}
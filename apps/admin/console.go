@@ -0,0 +1,147 @@
+package admin
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/let-light/gomodule"
+	feature_logging "github.com/pingostack/neon/features/logging"
+)
+
+const (
+	consoleCookie = "neon_admin"
+	redacted      = "********"
+	maxLogLines   = 10000
+)
+
+//go:embed console
+var consoleAssets embed.FS
+
+// secretKeys are the config keys, or parts of them, whose values the
+// config view hides.
+var secretKeys = []string{"token", "secret", "password", "passphrase", "credential"}
+
+// handleConsole serves the embedded console, the login page until the
+// browser has the token.
+func (s *Server) handleConsole(gc *gin.Context) {
+	assets, _ := fs.Sub(consoleAssets, "console")
+
+	file := strings.TrimPrefix(gc.Param("file"), "/")
+	if !s.authorized(gc) {
+		gc.Header("Cache-Control", "no-store")
+		data, _ := fs.ReadFile(assets, "login.html")
+		gc.Data(http.StatusUnauthorized, "text/html; charset=utf-8", data)
+		return
+	}
+
+	if file == "" || file == "index.html" || file == "login.html" {
+		// the file server redirects index.html to the directory
+		data, _ := fs.ReadFile(assets, "index.html")
+		gc.Data(http.StatusOK, "text/html; charset=utf-8", data)
+		return
+	}
+
+	gc.FileFromFS(file, http.FS(assets))
+}
+
+// handleConsoleLogin keeps the token of the login form in a cookie of the
+// console and the api.
+func (s *Server) handleConsoleLogin(gc *gin.Context) {
+	token := gc.PostForm("token")
+	if !s.validToken(token) {
+		gc.Redirect(http.StatusSeeOther, "/console/?failed=1")
+		return
+	}
+
+	http.SetCookie(gc.Writer, &http.Cookie{
+		Name:     consoleCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   gc.Request.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	gc.Redirect(http.StatusSeeOther, "/console/")
+}
+
+func (s *Server) handleConsoleSettings(gc *gin.Context) {
+	gc.JSON(http.StatusOK, s.settings.Console)
+}
+
+// handleLogs returns the last ?lines= log lines, 200 by default.
+func (s *Server) handleLogs(gc *gin.Context) {
+	lines := 200
+	if v := gc.Query("lines"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			gc.JSON(http.StatusBadRequest, gin.H{"error": "invalid lines"})
+			return
+		}
+		lines = n
+	}
+	if lines > maxLogLines {
+		lines = maxLogLines
+	}
+
+	var found bool
+	gomodule.RequireFeatures(func(logging feature_logging.Feature) {
+		found = true
+		gc.JSON(http.StatusOK, gin.H{"lines": logging.Tail(lines)})
+	})
+
+	if !found {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "logs not kept"})
+	}
+}
+
+// handleConfig returns the settings loaded, without secrets.
+func (s *Server) handleConfig(gc *gin.Context) {
+	gc.JSON(http.StatusOK, redact("", gomodule.ConfigModule().Viper().AllSettings()))
+}
+
+func redact(parent string, v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			if isSecretKey(parent, k) {
+				if s, ok := val.(string); ok && s == "" {
+					out[k] = ""
+				} else {
+					out[k] = redacted
+				}
+				continue
+			}
+			out[k] = redact(k, val)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, val := range v {
+			out[i] = redact(parent, val)
+		}
+		return out
+	}
+
+	return v
+}
+
+func isSecretKey(parent, key string) bool {
+	key = strings.ToLower(key)
+	// the static key of hls encryption, not the key file of a certificate
+	if key == "key" {
+		return strings.ToLower(parent) == "keys"
+	}
+
+	for _, s := range secretKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,286 @@
+(function () {
+  'use strict';
+
+  var api = '/api/v1';
+  var settings = {};
+  var levels = ['panic', 'fatal', 'error', 'warning', 'info', 'debug', 'trace'];
+  var preview = { pc: null, hls: false };
+
+  function $(sel, root) { return (root || document).querySelector(sel); }
+
+  function el(tag, text, cls) {
+    var e = document.createElement(tag);
+    if (text !== undefined) e.textContent = text;
+    if (cls) e.className = cls;
+    return e;
+  }
+
+  function get(path) {
+    return fetch(api + path, { credentials: 'same-origin' }).then(function (res) {
+      if (res.status === 401) {
+        location.reload();
+        throw new Error('unauthorized');
+      }
+      return res.json();
+    });
+  }
+
+  function duration(seconds) {
+    var h = Math.floor(seconds / 3600), m = Math.floor(seconds % 3600 / 60), s = seconds % 60;
+    return (h ? h + 'h ' : '') + (h || m ? m + 'm ' : '') + s + 's';
+  }
+
+  function bitrate(bps) {
+    if (bps >= 1e6) return (bps / 1e6).toFixed(1) + ' Mbps';
+    if (bps >= 1e3) return (bps / 1e3).toFixed(0) + ' kbps';
+    return bps + ' bps';
+  }
+
+  function fill(section, rows, columns) {
+    var body = $('#' + section + ' tbody');
+    body.textContent = '';
+    if (!rows.length) {
+      var td = el('td', 'none', 'empty');
+      td.colSpan = columns;
+      body.appendChild(el('tr')).appendChild(td);
+    }
+    rows.forEach(function (r) { body.appendChild(r); });
+  }
+
+  function url(template, ns, stream) {
+    return template.replace('{namespace}', encodeURIComponent(ns)).replace('{stream}', stream);
+  }
+
+  // streams
+
+  function renderStreams(streams) {
+    fill('streams', streams.map(function (s) {
+      var tr = el('tr');
+      tr.appendChild(el('td', s.namespace));
+      tr.appendChild(el('td', s.stream));
+      tr.appendChild(el('td', [s.videoCodec, s.audioCodec].filter(Boolean).join(' / ')));
+      tr.appendChild(el('td', bitrate(s.bitrate)));
+      tr.appendChild(el('td', s.viewers + ' (' + s.peakViewers + ')'));
+      tr.appendChild(el('td', duration(s.uptime)));
+
+      var actions = el('td');
+      if (settings.whepUrl) {
+        var whep = actions.appendChild(el('button', 'WHEP'));
+        whep.onclick = function () { playWhep(s.namespace, s.stream); };
+      }
+      if (settings.hlsUrl) {
+        var hls = actions.appendChild(el('button', 'HLS'));
+        hls.onclick = function () { playHls(s.namespace, s.stream); };
+      }
+      var stop = actions.appendChild(el('button', 'Stop', 'danger'));
+      stop.onclick = function () {
+        if (!confirm('Stop ' + s.namespace + '/' + s.stream + '?')) return;
+        fetch(api + '/streams/' + encodeURIComponent(s.namespace) + '/' + s.stream,
+          { method: 'DELETE', credentials: 'same-origin' }).then(refreshStreams);
+      };
+      tr.appendChild(actions);
+
+      return tr;
+    }), 7);
+  }
+
+  function refreshStreams() {
+    return get('/stats/streams').then(function (res) { renderStreams(res.streams || []); });
+  }
+
+  // previews
+
+  function stopPreview() {
+    var video = $('#preview-video');
+    if (preview.pc) {
+      preview.pc.close();
+      preview.pc = null;
+    }
+    video.srcObject = null;
+    video.removeAttribute('src');
+    video.load();
+    $('#preview').hidden = true;
+  }
+
+  function showPreview(title) {
+    stopPreview();
+    $('#preview-title').textContent = title;
+    $('#preview').hidden = false;
+  }
+
+  function playWhep(ns, stream) {
+    showPreview(ns + '/' + stream + ' over WHEP');
+
+    var video = $('#preview-video');
+    var pc = new RTCPeerConnection();
+    preview.pc = pc;
+    pc.addTransceiver('video', { direction: 'recvonly' });
+    pc.addTransceiver('audio', { direction: 'recvonly' });
+    pc.ontrack = function (e) {
+      if (!video.srcObject) video.srcObject = new MediaStream();
+      video.srcObject.addTrack(e.track);
+    };
+
+    pc.createOffer().then(function (offer) {
+      return pc.setLocalDescription(offer);
+    }).then(function () {
+      // wait for the candidates, the endpoint gets no trickle
+      return new Promise(function (resolve) {
+        if (pc.iceGatheringState === 'complete') return resolve();
+        pc.onicegatheringstatechange = function () {
+          if (pc.iceGatheringState === 'complete') resolve();
+        };
+        setTimeout(resolve, 2000);
+      });
+    }).then(function () {
+      return fetch(url(settings.whepUrl, ns, stream), {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/sdp' },
+        body: pc.localDescription.sdp
+      });
+    }).then(function (res) {
+      if (!res.ok) throw new Error('whep ' + res.status);
+      return res.text();
+    }).then(function (sdp) {
+      return pc.setRemoteDescription({ type: 'answer', sdp: sdp });
+    }).catch(function (err) {
+      $('#preview-title').textContent = ns + '/' + stream + ': ' + err.message;
+    });
+  }
+
+  function playHls(ns, stream) {
+    showPreview(ns + '/' + stream + ' over HLS');
+
+    var video = $('#preview-video');
+    var src = url(settings.hlsUrl, ns, stream);
+    if (video.canPlayType('application/vnd.apple.mpegurl')) {
+      video.src = src;
+      return;
+    }
+
+    // no native hls, e.g. chrome on desktop
+    $('#preview-title').textContent = '';
+    var a = el('a', src);
+    a.href = src;
+    a.target = '_blank';
+    $('#preview-title').appendChild(document.createTextNode('HLS is not played natively by this browser: '));
+    $('#preview-title').appendChild(a);
+  }
+
+  // sessions
+
+  function refreshSessions() {
+    return get('/sessions').then(function (res) {
+      fill('sessions', (res.sessions || []).map(function (s) {
+        var tr = el('tr');
+        tr.appendChild(el('td', s.id));
+        tr.appendChild(el('td', s.namespace + '/' + s.stream));
+        tr.appendChild(el('td', s.producer ? 'publisher' : 'player'));
+        tr.appendChild(el('td', s.remoteAddr));
+        tr.appendChild(el('td', new Date(s.createdAt).toLocaleString()));
+
+        var kick = el('button', 'Kick', 'danger');
+        kick.onclick = function () {
+          fetch(api + '/sessions/' + encodeURIComponent(s.id),
+            { method: 'DELETE', credentials: 'same-origin' }).then(refreshSessions);
+        };
+        tr.appendChild(el('td')).appendChild(kick);
+
+        return tr;
+      }), 6);
+    });
+  }
+
+  // logs
+
+  function refreshLogs() {
+    var max = levels.indexOf($('#log-level').value);
+    var filter = $('#log-filter').value.toLowerCase();
+
+    return get('/logs?lines=500').then(function (res) {
+      var pre = $('#log-lines');
+      pre.textContent = '';
+      (res.lines || []).forEach(function (l) {
+        if (levels.indexOf(l.level) > max) return;
+
+        var fields = Object.keys(l.fields || {}).sort().map(function (k) {
+          return k + '=' + l.fields[k];
+        }).join(' ');
+        var line = new Date(l.time).toLocaleTimeString() + ' ' + l.level.toUpperCase() + ' ' + l.message +
+          (fields ? ' ' + fields : '');
+        if (filter && line.toLowerCase().indexOf(filter) < 0) return;
+
+        pre.appendChild(el('div', line, 'level-' + l.level));
+      });
+
+      if ($('#log-follow').checked) pre.scrollTop = pre.scrollHeight;
+    });
+  }
+
+  // config
+
+  function refreshConfig() {
+    return get('/config').then(function (config) {
+      $('#config-view').textContent = JSON.stringify(config, null, 2);
+    });
+  }
+
+  // the event feed refreshes the tables, stats snapshots carry the streams
+
+  function connect() {
+    var status = $('#status');
+    var proto = location.protocol === 'https:' ? 'wss:' : 'ws:';
+    var ws = new WebSocket(proto + '//' + location.host + api + '/events?topics=core.**,*.publish.*,*.play.*&stats=2');
+
+    ws.onopen = function () {
+      status.textContent = 'live';
+      status.className = 'status live';
+    };
+
+    ws.onmessage = function (e) {
+      var msg = JSON.parse(e.data);
+      if (msg.topic === 'stats.streams') {
+        renderStreams(msg.data || []);
+      } else if (!$('#sessions').hidden) {
+        refreshSessions();
+      }
+    };
+
+    ws.onclose = function () {
+      status.textContent = 'reconnecting';
+      status.className = 'status';
+      setTimeout(connect, 3000);
+    };
+  }
+
+  // tabs
+
+  var refreshers = { streams: refreshStreams, sessions: refreshSessions, logs: refreshLogs, config: refreshConfig };
+  var timer = null;
+
+  function show(tab) {
+    if (!refreshers[tab]) tab = 'streams';
+
+    Object.keys(refreshers).forEach(function (name) {
+      $('#' + name).hidden = name !== tab;
+      $('nav a[href="#' + name + '"]').className = name === tab ? 'active' : '';
+    });
+
+    clearInterval(timer);
+    if (tab !== 'streams') stopPreview();
+    refreshers[tab]();
+    if (tab === 'logs') timer = setInterval(refreshLogs, 2000);
+  }
+
+  window.addEventListener('hashchange', function () { show(location.hash.slice(1)); });
+  $('#preview-close').onclick = stopPreview;
+  $('#log-level').onchange = refreshLogs;
+  $('#log-filter').oninput = refreshLogs;
+
+  get('/console').then(function (s) {
+    settings = s;
+  }).finally(function () {
+    show(location.hash.slice(1));
+    connect();
+  });
+})();
@@ -0,0 +1,190 @@
+package admin
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/pingostack/neon/pkg/eventbus"
+	"github.com/pingostack/neon/pkg/eventemitter"
+	"github.com/pingostack/neon/pkg/stats"
+)
+
+const (
+	// TopicStatsStreams is the topic of the stats snapshots of the feed.
+	TopicStatsStreams = "stats.streams"
+
+	defaultStatsInterval = 5 * time.Second
+	minStatsInterval     = time.Second
+	eventQueueSize       = 256
+	eventWriteTimeout    = 10 * time.Second
+	eventPingInterval    = 30 * time.Second
+)
+
+// handleEvents streams the events of the bus over a websocket as
+// EventMessage json, ?topics= are comma separated topic patterns, all by
+// default, ?stats= the seconds between stats snapshots, 0 for none.
+func (s *Server) handleEvents(gc *gin.Context) {
+	patterns := []string{"**"}
+	if topics := gc.Query("topics"); topics != "" {
+		patterns = strings.Split(topics, ",")
+	}
+
+	interval := defaultStatsInterval
+	if v := gc.Query("stats"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds < 0 {
+			gc.JSON(http.StatusBadRequest, gin.H{"error": "invalid stats interval"})
+			return
+		}
+		interval = time.Duration(seconds) * time.Second
+		if interval > 0 && interval < minStatsInterval {
+			interval = minStatsInterval
+		}
+	}
+
+	upgrader := websocket.Upgrader{CheckOrigin: s.checkOrigin}
+	conn, err := upgrader.Upgrade(gc.Writer, gc.Request, nil)
+	if err != nil {
+		// the upgrader answered already
+		return
+	}
+
+	f := &eventFeed{
+		conn:     conn,
+		patterns: patterns,
+		queue:    make(chan EventMessage, eventQueueSize),
+		done:     make(chan struct{}),
+	}
+
+	off := eventbus.On("**", f.onEvent, eventemitter.Sync())
+	defer off()
+
+	s.logger.WithField("remoteAddr", gc.Request.RemoteAddr).Info("event feed opened")
+	go f.readLoop()
+	f.writeLoop(s, interval)
+	s.logger.WithField("remoteAddr", gc.Request.RemoteAddr).Info("event feed closed")
+}
+
+func (s *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	// the console of the server itself
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	for _, o := range s.ss.AllowOrigin() {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type eventFeed struct {
+	conn     *websocket.Conn
+	patterns []string
+	queue    chan EventMessage
+	done     chan struct{}
+	once     sync.Once
+	lock     sync.Mutex
+	dropped  int
+}
+
+// onEvent runs in the goroutine emitting, events are dropped rather than
+// waiting for a slow client.
+func (f *eventFeed) onEvent(topic string, data interface{}) error {
+	matched := false
+	for _, p := range f.patterns {
+		if eventemitter.MatchTopic(strings.TrimSpace(p), topic) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return nil
+	}
+
+	f.push(EventMessage{Topic: topic, Time: time.Now(), Data: data})
+	return nil
+}
+
+func (f *eventFeed) push(msg EventMessage) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	msg.Dropped = f.dropped
+	select {
+	case f.queue <- msg:
+		f.dropped = 0
+	default:
+		f.dropped++
+	}
+}
+
+func (f *eventFeed) close() {
+	f.once.Do(func() {
+		close(f.done)
+	})
+}
+
+// readLoop discards what the client sends, it ends when the client is gone.
+func (f *eventFeed) readLoop() {
+	defer f.close()
+
+	for {
+		if _, _, err := f.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func (f *eventFeed) writeLoop(s *Server, interval time.Duration) {
+	defer f.conn.Close()
+	defer f.close()
+
+	ping := time.NewTicker(eventPingInterval)
+	defer ping.Stop()
+
+	var snapshots <-chan time.Time
+	if interval > 0 && s.core != nil {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		snapshots = t.C
+	}
+
+	for {
+		var msg EventMessage
+		select {
+		case <-s.ctx.Done():
+			f.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server closing"), time.Now().Add(time.Second))
+			return
+		case <-f.done:
+			return
+		case <-ping.C:
+			if err := f.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventWriteTimeout)); err != nil {
+				return
+			}
+			continue
+		case <-snapshots:
+			msg = EventMessage{Topic: TopicStatsStreams, Time: time.Now(), Data: stats.Streams(s.core.Namespaces())}
+		case msg = <-f.queue:
+		}
+
+		f.conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		if err := f.conn.WriteJSON(msg); err != nil {
+			return
+		}
+	}
+}
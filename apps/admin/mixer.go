@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingostack/neon/pkg/mixer"
+)
+
+func (s *Server) handleListMixes(gc *gin.Context) {
+	mixes := make([]mixer.Info, 0)
+	for _, m := range mixer.List() {
+		mixes = append(mixes, m.Info())
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"mixes": mixes})
+}
+
+// lookupMix finds the mix of the path, <namespace>/<stream> of its output.
+func (s *Server) lookupMix(gc *gin.Context) (*mixer.Mixer, bool) {
+	m, found := mixer.Get(strings.TrimPrefix(gc.Param("id"), "/"))
+	if !found {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "mix not found"})
+		return nil, false
+	}
+
+	return m, true
+}
+
+func (s *Server) handleGetMix(gc *gin.Context) {
+	m, found := s.lookupMix(gc)
+	if !found {
+		return
+	}
+
+	gc.JSON(http.StatusOK, m.Info())
+}
+
+func (s *Server) handleSetMixGain(gc *gin.Context) {
+	var req MixGainRequest
+	if err := gc.ShouldBindJSON(&req); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	m, found := s.lookupMix(gc)
+	if !found {
+		return
+	}
+
+	if err := m.SetGain(req.Input, *req.Gain); errors.Is(err, mixer.ErrInputNotFound) {
+		gc.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.logger.WithField("mix", m.ID()).WithField("input", req.Input).WithField("gain", *req.Gain).Info("mix gain set by admin api")
+	gc.JSON(http.StatusOK, m.Info())
+}
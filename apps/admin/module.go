@@ -0,0 +1,93 @@
+package admin
+
+import (
+	"context"
+
+	"github.com/let-light/gomodule"
+	feature_admin "github.com/pingostack/neon/features/admin"
+	"github.com/pingostack/neon/internal/httpserv"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var adminModule *admin
+
+type ConsoleSettings struct {
+	Enable bool `json:"enable" mapstructure:"enable"`
+	// WhepURL and HlsURL are where the console previews streams,
+	// {namespace} and {stream} are replaced.
+	WhepURL string `json:"whepUrl" mapstructure:"whepUrl"`
+	HlsURL  string `json:"hlsUrl" mapstructure:"hlsUrl"`
+}
+
+type AdminSettings struct {
+	httpserv.HttpParams `json:"http" mapstructure:"http"`
+	Token               string          `json:"token" mapstructure:"token"`
+	Console             ConsoleSettings `json:"console" mapstructure:"console"`
+	// PcapDir is where pcap dumps are written, a temporary directory when
+	// empty.
+	PcapDir string `json:"pcapDir" mapstructure:"pcapDir"`
+}
+
+type admin struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings AdminSettings
+	settings    *AdminSettings
+	logger      *logrus.Entry
+	serv        *Server
+}
+
+func init() {
+	adminModule = &admin{
+		logger: logrus.WithField("module", "admin"),
+	}
+}
+
+func AdminModule() *admin {
+	return adminModule
+}
+
+func (admin *admin) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	admin.ctx = ctx
+	return &admin.preSettings, nil
+}
+
+func (admin *admin) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+func (admin *admin) ConfigChanged() {
+	if admin.settings == nil {
+		admin.settings = &admin.preSettings
+	}
+}
+
+func (admin *admin) ModuleRun() {
+	defer metrics.Track("admin")()
+
+	// the api kicks, bans and deletes, it is never left open
+	if admin.settings.Token == "" {
+		admin.logger.Error("admin api token is empty, admin server not started")
+		return
+	}
+
+	admin.serv = NewServer(admin.ctx, *admin.settings, admin.logger)
+	if err := admin.serv.Start(); err != nil {
+		admin.logger.Errorf("admin start error: %v", err)
+		return
+	}
+
+	<-admin.ctx.Done()
+	admin.close()
+}
+
+func (admin *admin) Type() interface{} {
+	return feature_admin.Type()
+}
+
+func (admin *admin) close() {
+	admin.logger.Info("admin closing")
+	admin.serv.Close()
+}
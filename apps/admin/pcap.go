@@ -0,0 +1,137 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/pingostack/neon/pkg/pcap"
+)
+
+// the addresses of a dumped connection are refreshed this often, ice may
+// select another pair
+const pcapAddrsInterval = 2 * time.Second
+
+func (s *Server) handleStartPcap(gc *gin.Context) {
+	var req PcapRequest
+	if err := gc.ShouldBindJSON(&req); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, found := s.core.LookupSession(req.Session)
+	if !found {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	var transport interface{} = session.FrameDestination()
+	if session.PeerParams().Producer {
+		transport = session.FrameSource()
+	}
+
+	tap, ok := transport.(deliver.EnablePacketTap)
+	if !ok {
+		gc.JSON(http.StatusNotImplemented, gin.H{"error": "session packets can not be dumped"})
+		return
+	}
+
+	// a transport has a single tap
+	if len(pcap.Lookup(session.ID())) > 0 {
+		gc.JSON(http.StatusConflict, gin.H{"error": "session already dumped"})
+		return
+	}
+
+	d, err := pcap.Start(session.ID(), pcap.Options{
+		Dir:             s.settings.PcapDir,
+		MaxFileSize:     req.MaxFileSize,
+		MaxFiles:        req.MaxFiles,
+		DurationSeconds: req.DurationSeconds,
+	})
+	if err != nil {
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	metrics.Go("admin", func() { s.dumpSession(session, tap, d) })
+
+	s.logger.WithField("pcap", d.ID()).WithField("session", session.ID()).Info("pcap dump started by admin api")
+	gc.JSON(http.StatusCreated, d.Info())
+}
+
+// dumpSession taps the packets of session until the dump stops or the
+// session leaves.
+func (s *Server) dumpSession(session router.Session, tap deliver.EnablePacketTap, d *pcap.Dump) {
+	d.SetAddrs(tap.SelectedAddrs())
+	tap.SetPacketTap(func(inbound, _ bool, packet []byte) {
+		d.WritePacket(inbound, packet)
+	})
+	defer tap.SetPacketTap(nil)
+
+	ticker := time.NewTicker(pcapAddrsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.Done():
+			return
+		case <-session.Context().Done():
+			d.Stop()
+			return
+		case <-s.ctx.Done():
+			d.Stop()
+			return
+		case <-ticker.C:
+			d.SetAddrs(tap.SelectedAddrs())
+		}
+	}
+}
+
+func (s *Server) handleListPcaps(gc *gin.Context) {
+	dumps := make([]pcap.Info, 0)
+	for _, d := range pcap.List() {
+		dumps = append(dumps, d.Info())
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"pcaps": dumps})
+}
+
+func (s *Server) handleGetPcap(gc *gin.Context) {
+	d, found := pcap.Get(gc.Param("id"))
+	if !found {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "pcap not found"})
+		return
+	}
+
+	gc.JSON(http.StatusOK, d.Info())
+}
+
+// handleGetPcapFile downloads a file of a dump, the last one is complete once
+// the dump stopped.
+func (s *Server) handleGetPcapFile(gc *gin.Context) {
+	d, found := pcap.Get(gc.Param("id"))
+	if !found {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "pcap not found"})
+		return
+	}
+
+	path, found := d.Path(gc.Param("name"))
+	if !found {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+
+	gc.FileAttachment(path, gc.Param("name"))
+}
+
+func (s *Server) handleRemovePcap(gc *gin.Context) {
+	if !pcap.Remove(gc.Param("id")) {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "pcap not found"})
+		return
+	}
+
+	gc.Status(http.StatusNoContent)
+}
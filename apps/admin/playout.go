@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingostack/neon/pkg/playout"
+)
+
+func (s *Server) handleListPlayouts(gc *gin.Context) {
+	playouts := make([]playout.Info, 0)
+	for _, p := range playout.List() {
+		playouts = append(playouts, p.Info())
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"playouts": playouts})
+}
+
+// lookupPlayout finds the channel of the path, <namespace>/<stream> it is
+// published as.
+func (s *Server) lookupPlayout(gc *gin.Context) (*playout.Playout, bool) {
+	p, found := playout.Get(strings.TrimPrefix(gc.Param("id"), "/"))
+	if !found {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "playout not found"})
+		return nil, false
+	}
+
+	return p, true
+}
+
+func (s *Server) handleGetPlayout(gc *gin.Context) {
+	p, found := s.lookupPlayout(gc)
+	if !found {
+		return
+	}
+
+	gc.JSON(http.StatusOK, p.Info())
+}
+
+func (s *Server) handleUpdatePlayout(gc *gin.Context) {
+	var req PlayoutRequest
+	if err := gc.ShouldBindJSON(&req); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	p, found := s.lookupPlayout(gc)
+	if !found {
+		return
+	}
+
+	if req.Items != nil {
+		if err := p.SetPlaylist(req.Items); err != nil {
+			gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if req.Skip {
+		p.Skip()
+	}
+
+	s.logger.WithField("playout", p.ID()).WithField("items", len(req.Items)).WithField("skip", req.Skip).Info("playout updated by admin api")
+	gc.JSON(http.StatusOK, p.Info())
+}
@@ -0,0 +1,233 @@
+package admin
+
+import (
+	"time"
+
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/codec"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/playout"
+	"github.com/pingostack/neon/pkg/record/catalog"
+)
+
+type SessionInfo struct {
+	ID         string    `json:"id"`
+	Namespace  string    `json:"namespace"`
+	Stream     string    `json:"stream"`
+	Producer   bool      `json:"producer"`
+	RemoteAddr string    `json:"remoteAddr"`
+	LocalAddr  string    `json:"localAddr"`
+	URI        string    `json:"uri"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type StreamInfo struct {
+	Namespace   string               `json:"namespace"`
+	ID          string               `json:"id"`
+	Producer    *SessionInfo         `json:"producer,omitempty"`
+	Metadata    *deliver.Metadata    `json:"metadata,omitempty"`
+	Stats       *deliver.SourceStats `json:"stats,omitempty"`
+	Viewers     int                  `json:"viewers"`
+	PeakViewers int                  `json:"peakViewers"`
+	Uptime      int64                `json:"uptime"`
+	CreatedAt   time.Time            `json:"createdAt"`
+}
+
+// VideoDetail is what the parameter sets of the video of a stream tell.
+type VideoDetail struct {
+	*codec.SPS
+	ProfileName string `json:"profileName"`
+	LevelName   string `json:"levelName"`
+}
+
+type StreamDetail struct {
+	StreamInfo
+	Video       *VideoDetail  `json:"video,omitempty"`
+	Subscribers []SessionInfo `json:"subscribers"`
+}
+
+type RelayRequest struct {
+	Namespace string `json:"namespace" binding:"required"`
+	Stream    string `json:"stream" binding:"required"`
+	URL       string `json:"url" binding:"required"`
+}
+
+type SignRequest struct {
+	Stream     string `json:"stream" binding:"required"`
+	Action     string `json:"action"`
+	TTLSeconds int    `json:"ttlSeconds"`
+	// IP is the client the link is for, required when links are bound to it.
+	IP string `json:"ip"`
+}
+
+type SignResponse struct {
+	Query   string `json:"query"`
+	Expires int64  `json:"expires"`
+}
+
+type BanRequest struct {
+	Target          string `json:"target" binding:"required"` // ip or cidr
+	DurationSeconds int    `json:"durationSeconds"`           // 0 bans forever
+	Reason          string `json:"reason"`
+}
+
+func newSessionInfo(s router.Session) SessionInfo {
+	params := s.PeerParams()
+	info := SessionInfo{
+		ID:         s.ID(),
+		Stream:     s.RouterID(),
+		Producer:   params.Producer,
+		RemoteAddr: params.RemoteAddr,
+		LocalAddr:  params.LocalAddr,
+		URI:        params.URI,
+		CreatedAt:  s.CreatedAt(),
+	}
+
+	if ns := s.GetNamespace(); ns != nil {
+		info.Namespace = ns.Name()
+	}
+
+	return info
+}
+
+func newStreamInfo(r router.Router) StreamInfo {
+	info := StreamInfo{
+		ID:          r.ID(),
+		Viewers:     r.SubscriberCount(),
+		PeakViewers: r.PeakSubscriberCount(),
+		Uptime:      int64(time.Since(r.CreatedAt()).Seconds()),
+		CreatedAt:   r.CreatedAt(),
+	}
+
+	if ns := r.Namespace(); ns != nil {
+		info.Namespace = ns.Name()
+	}
+
+	if producer := r.Producer(); producer != nil {
+		pi := newSessionInfo(producer)
+		info.Producer = &pi
+		if src := producer.FrameSource(); src != nil {
+			info.Metadata = src.Metadata()
+			stats := src.Stats()
+			info.Stats = &stats
+		}
+	}
+
+	return info
+}
+
+func newStreamDetail(r router.Router) StreamDetail {
+	detail := StreamDetail{
+		StreamInfo:  newStreamInfo(r),
+		Subscribers: make([]SessionInfo, 0),
+	}
+
+	if sps := r.VideoInfo(); sps != nil {
+		detail.Video = &VideoDetail{
+			SPS:         sps,
+			ProfileName: sps.ProfileName(),
+			LevelName:   sps.LevelName(),
+		}
+	}
+
+	for _, s := range r.Subscribers() {
+		detail.Subscribers = append(detail.Subscribers, newSessionInfo(s))
+	}
+
+	return detail
+}
+
+// RecordingSeek is where the start and end of a recording were resolved,
+// times in seconds.
+type RecordingSeek struct {
+	Start       float64 `json:"start"`
+	End         float64 `json:"end"`
+	StartOffset int64   `json:"startOffset"`
+	EndOffset   int64   `json:"endOffset"`
+	Duration    float64 `json:"duration"`
+}
+
+// RecordingEntry is a recording of the catalog, its duration in seconds.
+type RecordingEntry struct {
+	catalog.Entry
+	Duration float64 `json:"duration"`
+}
+
+// ClipRequest cuts the recordings of a stream from Start to End into an mp4,
+// uploaded to the storage of the recordings when Upload.
+type ClipRequest struct {
+	Namespace string    `json:"namespace" binding:"required"`
+	Stream    string    `json:"stream" binding:"required"`
+	Start     time.Time `json:"start" binding:"required"`
+	End       time.Time `json:"end" binding:"required"`
+	Upload    bool      `json:"upload"`
+}
+
+// SEIRequest injects user data sei into the next Frames frames of the video
+// of a stream, 1 when 0. UUID is 32 hex digits, dashes allowed, the
+// payload is Payload, base64 in json, or Text.
+type SEIRequest struct {
+	Namespace string `json:"namespace" binding:"required"`
+	Stream    string `json:"stream" binding:"required"`
+	UUID      string `json:"uuid"`
+	Payload   []byte `json:"payload"`
+	Text      string `json:"text"`
+	Frames    int    `json:"frames"`
+}
+
+// EventMessage is a message of the event feed, an event of the bus or a
+// stats snapshot. Dropped counts the events dropped before it as the client
+// did not keep up.
+type EventMessage struct {
+	Topic   string      `json:"topic"`
+	Time    time.Time   `json:"time"`
+	Data    interface{} `json:"data,omitempty"`
+	Dropped int         `json:"dropped,omitempty"`
+}
+
+// CaptureRequest starts a capture of a stream or a session, empty fields
+// match any.
+type CaptureRequest struct {
+	Namespace       string `json:"namespace"`
+	Stream          string `json:"stream"`
+	Session         string `json:"session"`
+	Size            int    `json:"size"`            // entries kept, 500 when zero
+	DurationSeconds int    `json:"durationSeconds"` // 10 minutes when zero
+	Log             bool   `json:"log"`             // log the entries at info level too
+}
+
+// PcapRequest starts a pcap dump of the rtp and rtcp packets of a session.
+type PcapRequest struct {
+	Session         string `json:"session" binding:"required"`
+	MaxFileSize     int64  `json:"maxFileSize"`     // bytes, 10MiB when zero
+	MaxFiles        int    `json:"maxFiles"`        // files kept, 5 when zero
+	DurationSeconds int    `json:"durationSeconds"` // 5 minutes when zero
+}
+
+// RecordOverrideRequest records a stream, or stops recording it, for
+// DurationMinutes or until the override is removed when zero.
+type RecordOverrideRequest struct {
+	Record          *bool `json:"record" binding:"required"`
+	DurationMinutes int   `json:"durationMinutes"`
+}
+
+// MixGainRequest sets the gain of an input of a mix, 0 mutes it and 1
+// leaves it as is.
+type MixGainRequest struct {
+	Input string   `json:"input" binding:"required"`
+	Gain  *float64 `json:"gain" binding:"required"`
+}
+
+// CompositionLayoutRequest switches the layout of a composition, grid or pip
+// with Main shown in full.
+type CompositionLayoutRequest struct {
+	Kind string `json:"kind" binding:"required"`
+	Main string `json:"main"`
+}
+
+// PlayoutRequest replaces the playlist of a channel, from after the item
+// playing unless Skip ends it right away.
+type PlayoutRequest struct {
+	Items []playout.Item `json:"items"`
+	Skip  bool           `json:"skip"`
+}
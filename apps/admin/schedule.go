@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	feature_record "github.com/pingostack/neon/features/record"
+)
+
+func (s *Server) handleListSchedules(gc *gin.Context) {
+	if s.record == nil {
+		gc.JSON(http.StatusNotImplemented, gin.H{"error": "record not supported"})
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{
+		"schedules": s.record.Schedules(),
+		"overrides": s.record.Overrides(),
+	})
+}
+
+// handleSetOverride records the <namespace>/<stream> of the path ad hoc, or
+// keeps it from being recorded, whatever the schedules say.
+func (s *Server) handleSetOverride(gc *gin.Context) {
+	if s.record == nil {
+		gc.JSON(http.StatusNotImplemented, gin.H{"error": "record not supported"})
+		return
+	}
+
+	var req RecordOverrideRequest
+	if err := gc.ShouldBindJSON(&req); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	o := feature_record.Override{
+		Path:   strings.TrimPrefix(gc.Param("path"), "/"),
+		Record: *req.Record,
+	}
+	if req.DurationMinutes > 0 {
+		o.Until = time.Now().Add(time.Duration(req.DurationMinutes) * time.Minute)
+	}
+
+	if err := s.record.SetOverride(o); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"overrides": s.record.Overrides()})
+}
+
+func (s *Server) handleRemoveOverride(gc *gin.Context) {
+	if s.record == nil {
+		gc.JSON(http.StatusNotImplemented, gin.H{"error": "record not supported"})
+		return
+	}
+
+	if !s.record.RemoveOverride(strings.TrimPrefix(gc.Param("path"), "/")) {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "override not found"})
+		return
+	}
+
+	gc.Status(http.StatusNoContent)
+}
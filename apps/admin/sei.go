@@ -0,0 +1,67 @@
+package admin
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/codec"
+	"github.com/pkg/errors"
+)
+
+// the uuid of user data injected without one
+var defaultSEIUUID = [16]byte{'n', 'e', 'o', 'n', '-', 's', 'e', 'i', '-', 'u', 's', 'e', 'r', 'd', 'a', 't'}
+
+// handleInjectSEI puts user data sei into the video played to the
+// subscribers of a stream, e.g. telemetry of a drone.
+func (s *Server) handleInjectSEI(gc *gin.Context) {
+	var req SEIRequest
+	if err := gc.ShouldBindJSON(&req); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ud := codec.UserData{UUID: defaultSEIUUID, Payload: req.Payload}
+	if req.Text != "" {
+		ud.Payload = append(ud.Payload, req.Text...)
+	}
+	if len(ud.Payload) == 0 {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": "payload or text required"})
+		return
+	}
+
+	if req.UUID != "" {
+		b, err := hex.DecodeString(strings.ReplaceAll(req.UUID, "-", ""))
+		if err != nil || len(b) != len(ud.UUID) {
+			gc.JSON(http.StatusBadRequest, gin.H{"error": "invalid uuid"})
+			return
+		}
+		copy(ud.UUID[:], b)
+	}
+
+	r, found := s.core.LookupRouter(req.Namespace, req.Stream)
+	if !found {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "stream not found"})
+		return
+	}
+
+	err := r.InjectSEI(ud, req.Frames)
+	switch {
+	case errors.Is(err, router.ErrSEIUnsupported), errors.Is(err, router.ErrSEITooLarge):
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, router.ErrSEIQueueFull):
+		gc.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, router.ErrProducerEmpty):
+		gc.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	gc.Status(http.StatusNoContent)
+}
@@ -0,0 +1,476 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/let-light/gomodule"
+	feature_auth "github.com/pingostack/neon/features/auth"
+	feature_cluster "github.com/pingostack/neon/features/cluster"
+	feature_core "github.com/pingostack/neon/features/core"
+	feature_record "github.com/pingostack/neon/features/record"
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/internal/httpserv"
+	"github.com/pingostack/neon/pkg/acl"
+	"github.com/pingostack/neon/pkg/auth"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/pingostack/neon/pkg/record"
+	"github.com/pingostack/neon/pkg/stats"
+	"github.com/sirupsen/logrus"
+)
+
+type Server struct {
+	ss       *httpserv.SignalServer
+	ctx      context.Context
+	logger   *logrus.Entry
+	settings AdminSettings
+	core     feature_core.Feature
+	auth     feature_auth.Feature
+	cluster  feature_cluster.Feature
+	record   feature_record.Feature
+}
+
+func NewServer(ctx context.Context, settings AdminSettings, logger *logrus.Entry) *Server {
+	s := &Server{
+		ss:       httpserv.NewSignalServer(ctx, settings.HttpParams, logger),
+		ctx:      ctx,
+		logger:   logger,
+		settings: settings,
+	}
+	s.ss.SameOriginOnly()
+
+	gomodule.RequireFeatures(func(core feature_core.Feature) {
+		s.core = core
+		if err := stats.RegisterMetrics(metrics.DefaultRegistry(), core.Namespaces); err != nil {
+			s.logger.WithError(err).Warn("failed to export stream stats")
+		}
+	})
+
+	gomodule.RequireFeatures(func(auth feature_auth.Feature) {
+		s.auth = auth
+	})
+
+	gomodule.RequireFeatures(func(cluster feature_cluster.Feature) {
+		s.cluster = cluster
+	})
+
+	gomodule.RequireFeatures(func(record feature_record.Feature) {
+		s.record = record
+	})
+
+	return s
+}
+
+func (s *Server) Start() error {
+	s.ss.DefaultRouter().Use(httpserv.ACLHandler("admin"))
+	s.ss.DefaultRouter().GET("/metrics", s.authenticate, s.handleMetrics)
+
+	api := s.ss.DefaultRouter().Group("/api/v1", s.authenticate)
+
+	api.GET("/streams", s.handleListStreams)
+	api.GET("/streams/:namespace/*stream", s.handleGetStream)
+	api.GET("/cluster/streams", s.handleListClusterStreams)
+	api.GET("/drain", s.handleGetDrain)
+	api.POST("/drain", s.handleDrain)
+	api.DELETE("/streams/:namespace/*stream", s.handleStopStream)
+	api.POST("/sei", s.handleInjectSEI)
+	api.GET("/sessions", s.handleListSessions)
+	api.GET("/sessions/:id", s.handleGetSession)
+	api.DELETE("/sessions/:id", s.handleKickSession)
+	api.GET("/stats/streams", s.handleStreamStats)
+	api.GET("/stats/sessions", s.handleSessionStats)
+	api.GET("/stats/sessions/:id", s.handleGetSessionStats)
+	api.POST("/relays", s.handleStartRelay)
+	api.DELETE("/relays/:namespace/*stream", s.handleStopRelay)
+	api.POST("/signed-urls", s.handleSignURL)
+	api.GET("/bans", s.handleListBans)
+	api.POST("/bans", s.handleAddBan)
+	api.DELETE("/bans", s.handleRemoveBan)
+	api.GET("/recordings", s.handleListRecordings)
+	api.GET("/recordings/*file", s.handleGetRecording)
+	api.DELETE("/recordings/*file", s.handleDeleteRecording)
+	api.POST("/clips", s.handleExportClip)
+	api.GET("/clips/*file", s.handleGetClip)
+	api.GET("/record/schedules", s.handleListSchedules)
+	api.PUT("/record/overrides/*path", s.handleSetOverride)
+	api.DELETE("/record/overrides/*path", s.handleRemoveOverride)
+	api.GET("/captures", s.handleListCaptures)
+	api.POST("/captures", s.handleStartCapture)
+	api.GET("/captures/:id", s.handleGetCapture)
+	api.DELETE("/captures/:id", s.handleRemoveCapture)
+	api.GET("/pcaps", s.handleListPcaps)
+	api.POST("/pcaps", s.handleStartPcap)
+	api.GET("/pcaps/:id", s.handleGetPcap)
+	api.GET("/pcaps/:id/files/:name", s.handleGetPcapFile)
+	api.DELETE("/pcaps/:id", s.handleRemovePcap)
+	api.GET("/mixes", s.handleListMixes)
+	api.GET("/mixes/*id", s.handleGetMix)
+	api.PUT("/mixes/*id", s.handleSetMixGain)
+	api.GET("/compositions", s.handleListCompositions)
+	api.GET("/compositions/*id", s.handleGetComposition)
+	api.PUT("/compositions/*id", s.handleSetCompositionLayout)
+	api.GET("/playouts", s.handleListPlayouts)
+	api.GET("/playouts/*id", s.handleGetPlayout)
+	api.PUT("/playouts/*id", s.handleUpdatePlayout)
+	api.GET("/events", s.handleEvents)
+	api.GET("/logs", s.handleLogs)
+	api.GET("/config", s.handleConfig)
+	api.GET("/console", s.handleConsoleSettings)
+
+	if s.settings.Console.Enable {
+		s.ss.DefaultRouter().GET("/console/*file", s.handleConsole)
+		s.ss.DefaultRouter().POST("/console/login", s.handleConsoleLogin)
+	}
+
+	return s.ss.Start(func(gc *gin.Context) {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	})
+}
+
+func (s *Server) Close() error {
+	return s.ss.Close()
+}
+
+func (s *Server) authenticate(gc *gin.Context) {
+	if !s.authorized(gc) {
+		gc.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+}
+
+// authorized checks the token of the Authorization header or the cookie of
+// the console. Tokens of the query would end up in access logs.
+func (s *Server) authorized(gc *gin.Context) bool {
+	token := strings.TrimPrefix(gc.GetHeader("Authorization"), "Bearer ")
+	if token == "" {
+		token, _ = gc.Cookie(consoleCookie)
+	}
+
+	return s.validToken(token)
+}
+
+func (s *Server) validToken(token string) bool {
+	return s.settings.Token != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(s.settings.Token)) == 1
+}
+
+func (s *Server) lookupRouter(gc *gin.Context) (router.Router, bool) {
+	ns := gc.Param("namespace")
+	id := strings.TrimPrefix(gc.Param("stream"), "/")
+
+	r, found := s.core.LookupRouter(ns, id)
+	if !found {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "stream not found"})
+		return nil, false
+	}
+
+	return r, true
+}
+
+func (s *Server) handleMetrics(gc *gin.Context) {
+	gc.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	gc.Status(http.StatusOK)
+	if err := metrics.DefaultRegistry().WritePrometheus(gc.Writer); err != nil {
+		s.logger.WithError(err).Error("write metrics failed")
+	}
+}
+
+func (s *Server) handleListStreams(gc *gin.Context) {
+	streams := make([]StreamInfo, 0)
+	for _, ns := range s.core.Namespaces() {
+		for _, r := range ns.Routers() {
+			streams = append(streams, newStreamInfo(r))
+		}
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"streams": streams})
+}
+
+func (s *Server) handleListClusterStreams(gc *gin.Context) {
+	if s.cluster == nil {
+		gc.JSON(http.StatusNotImplemented, gin.H{"error": "cluster not supported"})
+		return
+	}
+
+	streams, err := s.cluster.Streams(gc.Request.Context())
+	if err != nil {
+		gc.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"streams": streams})
+}
+
+func (s *Server) handleGetDrain(gc *gin.Context) {
+	if s.cluster == nil {
+		gc.JSON(http.StatusNotImplemented, gin.H{"error": "cluster not supported"})
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"draining": s.cluster.Draining()})
+}
+
+// handleDrain starts draining the node, the viewers move in the background,
+// see GET /drain and GET /sessions for the progress.
+func (s *Server) handleDrain(gc *gin.Context) {
+	if s.cluster == nil {
+		gc.JSON(http.StatusNotImplemented, gin.H{"error": "cluster not supported"})
+		return
+	}
+
+	s.logger.Info("drain by admin api")
+	go func() {
+		if err := s.cluster.Drain(s.ctx); err != nil {
+			s.logger.WithError(err).Warn("drain incomplete")
+		}
+	}()
+
+	gc.JSON(http.StatusAccepted, gin.H{"draining": true})
+}
+
+func (s *Server) handleGetStream(gc *gin.Context) {
+	r, ok := s.lookupRouter(gc)
+	if !ok {
+		return
+	}
+
+	gc.JSON(http.StatusOK, newStreamDetail(r))
+}
+
+func (s *Server) handleStopStream(gc *gin.Context) {
+	r, ok := s.lookupRouter(gc)
+	if !ok {
+		return
+	}
+
+	s.logger.WithField("stream", r.ID()).Info("stop stream by admin api")
+	r.Close(router.ErrStreamStopped)
+
+	gc.Status(http.StatusNoContent)
+}
+
+func (s *Server) handleListSessions(gc *gin.Context) {
+	sessions := make([]SessionInfo, 0)
+	for _, session := range s.core.Sessions() {
+		sessions = append(sessions, newSessionInfo(session))
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func (s *Server) handleGetSession(gc *gin.Context) {
+	session, found := s.core.LookupSession(gc.Param("id"))
+	if !found {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	gc.JSON(http.StatusOK, newSessionInfo(session))
+}
+
+func (s *Server) handleStreamStats(gc *gin.Context) {
+	gc.JSON(http.StatusOK, gin.H{"streams": stats.Streams(s.core.Namespaces())})
+}
+
+func (s *Server) handleSessionStats(gc *gin.Context) {
+	gc.JSON(http.StatusOK, gin.H{"sessions": stats.Sessions(s.core.Sessions())})
+}
+
+func (s *Server) handleGetSessionStats(gc *gin.Context) {
+	session, found := s.core.LookupSession(gc.Param("id"))
+	if !found {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	gc.JSON(http.StatusOK, stats.NewSession(session))
+}
+
+func (s *Server) handleKickSession(gc *gin.Context) {
+	session, found := s.core.LookupSession(gc.Param("id"))
+	if !found {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	s.logger.WithField("session", session.ID()).Info("kick session by admin api")
+	session.Finalize(router.ErrSessionKicked)
+
+	gc.Status(http.StatusNoContent)
+}
+
+func (s *Server) handleStartRelay(gc *gin.Context) {
+	var req RelayRequest
+	if err := gc.ShouldBindJSON(&req); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	stream := strings.Trim(req.Stream, "/")
+	if err := s.core.Pull(req.Namespace, stream, req.URL); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, core.ErrStreamPulled), errors.Is(err, core.ErrStreamPublished):
+			status = http.StatusConflict
+		case errors.Is(err, core.ErrPullUnavailable):
+			status = http.StatusServiceUnavailable
+		case errors.Is(err, core.ErrNoPuller):
+			status = http.StatusBadRequest
+		default:
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				status = http.StatusBadRequest
+			}
+		}
+		gc.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.logger.WithField("stream", req.Namespace+"/"+stream).Info("relay started by admin api")
+	gc.JSON(http.StatusAccepted, gin.H{"namespace": req.Namespace, "stream": stream})
+}
+
+func (s *Server) handleStopRelay(gc *gin.Context) {
+	ns := gc.Param("namespace")
+	stream := strings.TrimPrefix(gc.Param("stream"), "/")
+	if !s.core.StopPull(ns, stream) {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "relay not found"})
+		return
+	}
+
+	s.logger.WithField("stream", ns+"/"+stream).Info("relay stopped by admin api")
+	gc.Status(http.StatusNoContent)
+}
+
+func (s *Server) handleSignURL(gc *gin.Context) {
+	var req SignRequest
+	if err := gc.ShouldBindJSON(&req); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if s.auth == nil {
+		gc.JSON(http.StatusNotImplemented, gin.H{"error": "auth module not loaded"})
+		return
+	}
+
+	action := auth.ActionPlay
+	if req.Action == auth.ActionPublish.String() {
+		action = auth.ActionPublish
+	}
+
+	if req.TTLSeconds <= 0 {
+		req.TTLSeconds = 3600
+	}
+
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+	query, err := s.auth.SignURL(action, req.Stream, ttl, req.IP)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	expires, _ := strconv.ParseInt(query.Get(auth.SignedArgExpires), 10, 64)
+	gc.JSON(http.StatusOK, SignResponse{
+		Query:   query.Encode(),
+		Expires: expires,
+	})
+}
+
+func (s *Server) handleListBans(gc *gin.Context) {
+	gc.JSON(http.StatusOK, gin.H{"bans": acl.Bans().List()})
+}
+
+func (s *Server) handleAddBan(gc *gin.Context) {
+	var req BanRequest
+	if err := gc.ShouldBindJSON(&req); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ban, err := acl.Bans().Add(req.Target, time.Duration(req.DurationSeconds)*time.Second, req.Reason)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.logger.WithField("target", ban.CIDR).Info("address banned by admin api")
+	gc.JSON(http.StatusCreated, ban)
+}
+
+func (s *Server) handleRemoveBan(gc *gin.Context) {
+	target := gc.Query("target")
+	if !acl.Bans().Remove(target) {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "ban not found"})
+		return
+	}
+
+	gc.Status(http.StatusNoContent)
+}
+
+// handleGetRecording serves the part of a recording from ?start= to ?end=,
+// seconds or durations, cut at keyframes. ?resolve=1 only tells where.
+func (s *Server) handleGetRecording(gc *gin.Context) {
+	if s.record == nil {
+		gc.JSON(http.StatusNotImplemented, gin.H{"error": "record not supported"})
+		return
+	}
+
+	span, err := record.ParseStartEnd(gc.Query("start"), gc.Query("end"))
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := strings.TrimPrefix(gc.Param("file"), "/")
+	ix, err := s.record.Recording(name)
+	if errors.Is(err, os.ErrNotExist) {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "recording not found"})
+		return
+	} else if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pos, err := ix.Resolve(span)
+	if err != nil {
+		gc.JSON(http.StatusRequestedRangeNotSatisfiable, gin.H{"error": err.Error()})
+		return
+	}
+
+	if gc.Query("resolve") == "1" {
+		gc.JSON(http.StatusOK, RecordingSeek{
+			Start:       pos.Start.Seconds(),
+			End:         pos.End.Seconds(),
+			StartOffset: pos.StartOffset,
+			EndOffset:   pos.EndOffset,
+			Duration:    ix.Duration.Seconds(),
+		})
+		return
+	}
+
+	clip, size, err := ix.Clip(pos)
+	if err != nil {
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer clip.Close()
+
+	contentType := "video/x-matroska"
+	if strings.HasSuffix(name, ".webm") {
+		contentType = "video/webm"
+	}
+
+	gc.DataFromReader(http.StatusOK, size, contentType, clip, map[string]string{
+		"X-Range": pos.NPTRange(),
+	})
+}
@@ -0,0 +1,138 @@
+package cluster
+
+import (
+	"context"
+	"time"
+
+	feature_core "github.com/pingostack/neon/features/core"
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/internal/core/router"
+)
+
+const (
+	defaultDrainTimeout = 30 * time.Second
+	defaultDrainGrace   = 20 * time.Second
+	drainCheckInterval  = 500 * time.Millisecond
+)
+
+type DrainSettings struct {
+	// OnSignal drains before the node exits on SIGTERM.
+	OnSignal       bool `json:"onSignal" mapstructure:"onSignal"`
+	TimeoutSeconds int  `json:"timeoutSeconds" mapstructure:"timeoutSeconds"`
+	// GraceSeconds is how long viewers are given to move on their own
+	// before those left are ended, within the timeout.
+	GraceSeconds int `json:"graceSeconds" mapstructure:"graceSeconds"`
+}
+
+func (c *cluster) drainTimeout() time.Duration {
+	if c.settings.Drain.TimeoutSeconds > 0 {
+		return time.Duration(c.settings.Drain.TimeoutSeconds) * time.Second
+	}
+
+	return defaultDrainTimeout
+}
+
+func (c *cluster) drainGrace() time.Duration {
+	grace := defaultDrainGrace
+	if c.settings.Drain.GraceSeconds > 0 {
+		grace = time.Duration(c.settings.Drain.GraceSeconds) * time.Second
+	}
+
+	if timeout := c.drainTimeout(); grace > timeout {
+		return timeout
+	}
+
+	return grace
+}
+
+// DrainOnSignal tells whether SIGTERM drains the node before it exits.
+func (c *cluster) DrainOnSignal() bool {
+	return c.settings != nil && c.settings.Drain.OnSignal
+}
+
+func (c *cluster) Draining() bool {
+	return core.Draining()
+}
+
+// Drain refuses new sessions and gives the viewers of this node the grace
+// period to move to peers, e.g. players reconnecting through a balancer no
+// longer sending them here. The viewers left are then ended so that they
+// reconnect to the peer RedirectTarget names, Drain waits for them to leave
+// at most for the drain timeout.
+func (c *cluster) Drain(ctx context.Context) error {
+	if !core.SetDraining(true) {
+		c.logger.Info("already draining")
+	}
+
+	c.lock.RLock()
+	coreFeature, balancer := c.core, c.balancer
+	c.lock.RUnlock()
+
+	if coreFeature == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.drainTimeout())
+	defer cancel()
+
+	// peers have to see this node overloaded before viewers come back
+	if balancer != nil {
+		balancer.report(ctx)
+	}
+
+	c.logger.WithField("viewers", len(subscribers(coreFeature))).Info("draining")
+
+	graceCtx, graceCancel := context.WithTimeout(ctx, c.drainGrace())
+	left := waitViewers(graceCtx, coreFeature)
+	graceCancel()
+
+	if left > 0 {
+		viewers := subscribers(coreFeature)
+		c.logger.WithField("viewers", len(viewers)).Info("grace period over, ending viewers")
+
+		for _, session := range viewers {
+			session.Finalize(router.ErrDraining)
+		}
+
+		left = waitViewers(ctx, coreFeature)
+	}
+
+	if left > 0 {
+		c.logger.WithField("viewers", left).Warn("drain timed out")
+		return ErrDrainTimeout
+	}
+
+	c.logger.Info("drained")
+	return nil
+}
+
+// waitViewers waits for the viewers to leave until ctx is done, it returns
+// how many are left.
+func waitViewers(ctx context.Context, core feature_core.Feature) int {
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		left := len(subscribers(core))
+		if left == 0 {
+			return 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return left
+		case <-ticker.C:
+		}
+	}
+}
+
+func subscribers(core feature_core.Feature) []router.Session {
+	sessions := make([]router.Session, 0)
+	for _, session := range core.Sessions() {
+		if !session.PeerParams().Producer {
+			sessions = append(sessions, session)
+		}
+	}
+
+	return sessions
+}
@@ -0,0 +1,9 @@
+package cluster
+
+import "errors"
+
+var (
+	ErrStreamNotFound = errors.New("stream not found on any origin")
+	ErrNoRegistry     = errors.New("no stream registry configured")
+	ErrDrainTimeout   = errors.New("viewers left on drain timeout")
+)
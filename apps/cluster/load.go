@@ -0,0 +1,207 @@
+package cluster
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	feature_cluster "github.com/pingostack/neon/features/cluster"
+	feature_core "github.com/pingostack/neon/features/core"
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/pingostack/neon/pkg/registry"
+	"github.com/sirupsen/logrus"
+)
+
+type RedirectSettings struct {
+	Enable bool `json:"enable" mapstructure:"enable"`
+	// thresholds above which new subscribers are sent to peers, 0 ignores one
+	MaxCPU        float64 `json:"maxCpu" mapstructure:"maxCpu"` // percent
+	MaxEgressMbps float64 `json:"maxEgressMbps" mapstructure:"maxEgressMbps"`
+	// base urls of this node that peers redirect to, e.g. rtsp://10.0.0.2:554
+	// and http://10.0.0.2:8080
+	RTSP string `json:"rtsp" mapstructure:"rtsp"`
+	WHEP string `json:"whep" mapstructure:"whep"`
+}
+
+// loadMeter samples the cpu usage of the host from /proc/stat, where it
+// doesn't exist cpu is reported as 0, and the egress of all protocols.
+type loadMeter struct {
+	lastAt    time.Time
+	lastBusy  uint64
+	lastTotal uint64
+	lastBytes float64
+}
+
+func (lm *loadMeter) sample() (cpu float64, egressBps uint64) {
+	now := time.Now()
+	busy, total := readCPUTimes()
+	bytes := metrics.BytesOut.Total()
+
+	if !lm.lastAt.IsZero() {
+		if total > lm.lastTotal {
+			cpu = float64(busy-lm.lastBusy) / float64(total-lm.lastTotal) * 100
+		}
+
+		if elapsed := now.Sub(lm.lastAt).Seconds(); elapsed > 0 {
+			egressBps = uint64((bytes - lm.lastBytes) * 8 / elapsed)
+		}
+	}
+
+	lm.lastAt, lm.lastBusy, lm.lastTotal, lm.lastBytes = now, busy, total, bytes
+
+	return cpu, egressBps
+}
+
+func readCPUTimes() (busy, total uint64) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		return 0, 0
+	}
+
+	// cpu user nice system idle iowait irq softirq steal ...
+	fields := strings.Fields(scanner.Text())
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0
+	}
+
+	for i, field := range fields[1:] {
+		v, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		total += v
+		if i != 3 && i != 4 {
+			busy += v
+		}
+	}
+
+	return busy, total
+}
+
+// Balancer reports the load of this node and picks peers to redirect new
+// subscribers to while it is overloaded.
+type Balancer struct {
+	registry *registry.Registry
+	core     feature_core.Feature
+	node     string
+	settings RedirectSettings
+	logger   *logrus.Entry
+	meter    loadMeter
+	lock     sync.RWMutex
+	self     registry.Load
+	peers    []registry.Load
+}
+
+func NewBalancer(reg *registry.Registry, core feature_core.Feature, node string, settings RedirectSettings, logger *logrus.Entry) *Balancer {
+	return &Balancer{
+		registry: reg,
+		core:     core,
+		node:     node,
+		settings: settings,
+		logger:   logger,
+	}
+}
+
+func (b *Balancer) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.registry.TTL() / 3)
+	defer ticker.Stop()
+
+	for {
+		b.report(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *Balancer) report(ctx context.Context) {
+	cpu, egress := b.meter.sample()
+	load := registry.Load{
+		Node:      b.node,
+		CPU:       cpu,
+		EgressBps: egress,
+		Sessions:  len(b.core.Sessions()),
+		RTSP:      b.settings.RTSP,
+		WHEP:      b.settings.WHEP,
+	}
+	// a draining node takes no subscribers from peers either
+	load.Overload = b.overloaded(load) || core.Draining()
+
+	if err := b.registry.ReportLoad(ctx, load); err != nil {
+		b.logger.WithError(err).Warn("load report failed")
+	}
+
+	peers, err := b.registry.Loads(ctx)
+	if err != nil {
+		b.logger.WithError(err).Warn("failed to get peer loads")
+	}
+
+	b.lock.Lock()
+	b.self = load
+	if err == nil {
+		b.peers = peers
+	}
+	b.lock.Unlock()
+}
+
+func (b *Balancer) overloaded(load registry.Load) bool {
+	if b.settings.MaxCPU > 0 && load.CPU >= b.settings.MaxCPU {
+		return true
+	}
+
+	return b.settings.MaxEgressMbps > 0 && float64(load.EgressBps) >= b.settings.MaxEgressMbps*1e6
+}
+
+// Target returns the base url of the least loaded peer serving protocol,
+// false while this node is not overloaded or no peer can take over.
+func (b *Balancer) Target(protocol string) (string, bool) {
+	b.lock.RLock()
+	overload := b.self.Overload
+	b.lock.RUnlock()
+
+	if !overload {
+		return "", false
+	}
+
+	return b.Peer(protocol)
+}
+
+// Peer returns the base url of the least loaded peer serving protocol which
+// is not overloaded itself.
+func (b *Balancer) Peer(protocol string) (string, bool) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	stale := 2 * b.registry.TTL()
+	for _, peer := range b.peers {
+		if peer.Node == b.node || peer.Overload || time.Since(peer.UpdatedAt) > stale {
+			continue
+		}
+
+		base := peer.WHEP
+		if protocol == feature_cluster.ProtocolRTSP {
+			base = peer.RTSP
+		}
+
+		if base != "" {
+			return base, true
+		}
+	}
+
+	return "", false
+}
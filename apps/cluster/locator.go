@@ -0,0 +1,104 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultLookupTimeoutSeconds = 2
+
+type OriginSettings struct {
+	Name  string `json:"name" mapstructure:"name"`
+	API   string `json:"api" mapstructure:"api"`     // admin api base url, e.g. http://origin:8090
+	Token string `json:"token" mapstructure:"token"` // admin api token of the origin
+	// URL is pulled once the stream is found, {namespace} and {stream} are
+	// replaced, e.g. relay://origin:9000/{namespace}/{stream}.
+	URL string `json:"url" mapstructure:"url"`
+}
+
+type streamDetail struct {
+	Producer *struct {
+		ID string `json:"id"`
+	} `json:"producer"`
+}
+
+// OriginLocator asks the admin api of each origin, in order, whether it has a
+// producer for a stream.
+type OriginLocator struct {
+	origins []OriginSettings
+	client  *http.Client
+	logger  *logrus.Entry
+}
+
+func NewOriginLocator(origins []OriginSettings, timeoutSeconds int, logger *logrus.Entry) *OriginLocator {
+	if timeoutSeconds <= 0 {
+		timeoutSeconds = defaultLookupTimeoutSeconds
+	}
+
+	return &OriginLocator{
+		origins: origins,
+		client:  &http.Client{Timeout: time.Duration(timeoutSeconds) * time.Second},
+		logger:  logger,
+	}
+}
+
+// Locate implements core.Locator.
+func (l *OriginLocator) Locate(ctx context.Context, namespace, stream string) (string, error) {
+	for _, origin := range l.origins {
+		found, err := l.lookup(ctx, origin, namespace, stream)
+		if err != nil {
+			l.logger.WithError(err).WithField("origin", origin.Name).Warn("origin lookup failed")
+			continue
+		}
+
+		if found {
+			return expandURL(origin.URL, namespace, stream), nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s/%s", ErrStreamNotFound, namespace, stream)
+}
+
+func (l *OriginLocator) lookup(ctx context.Context, origin OriginSettings, namespace, stream string) (bool, error) {
+	endpoint := strings.TrimSuffix(origin.API, "/") + "/api/v1/streams/" +
+		url.PathEscape(namespace) + "/" + stream
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "new request")
+	}
+
+	if origin.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+origin.Token)
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return false, errors.Wrap(err, "request origin")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var detail streamDetail
+	if err := json.NewDecoder(resp.Body).Decode(&detail); err != nil {
+		return false, errors.Wrap(err, "decode stream")
+	}
+
+	// a stream the origin pulls itself has a producer too, edges chain that way
+	return detail.Producer != nil, nil
+}
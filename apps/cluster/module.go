@@ -0,0 +1,193 @@
+package cluster
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/let-light/gomodule"
+	feature_cluster "github.com/pingostack/neon/features/cluster"
+	feature_core "github.com/pingostack/neon/features/core"
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/pingostack/neon/pkg/registry"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	RoleOrigin = "origin"
+	RoleEdge   = "edge"
+)
+
+var clusterModule *cluster
+
+type ClusterSettings struct {
+	Enable bool   `json:"enable" mapstructure:"enable"`
+	Role   string `json:"role" mapstructure:"role"`
+	// Node names this node in the registry, the hostname by default.
+	Node string `json:"node" mapstructure:"node"`
+	// Advertise is the url other nodes pull the streams of this node from,
+	// {namespace} and {stream} are replaced.
+	Advertise string `json:"advertise" mapstructure:"advertise"`
+	// HoldSeconds keeps a repulled stream after its last subscriber left.
+	HoldSeconds          int               `json:"holdSeconds" mapstructure:"holdSeconds"`
+	LookupTimeoutSeconds int               `json:"lookupTimeoutSeconds" mapstructure:"lookupTimeoutSeconds"`
+	Origins              []OriginSettings  `json:"origins" mapstructure:"origins"`
+	Registry             registry.Settings `json:"registry" mapstructure:"registry"`
+	Redirect             RedirectSettings  `json:"redirect" mapstructure:"redirect"`
+	Drain                DrainSettings     `json:"drain" mapstructure:"drain"`
+}
+
+type cluster struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings ClusterSettings
+	settings    *ClusterSettings
+	logger      *logrus.Entry
+	registry    *registry.Registry
+	core        feature_core.Feature
+	origins     *OriginLocator
+	balancer    *Balancer
+	lock        sync.RWMutex
+}
+
+func init() {
+	clusterModule = &cluster{
+		logger: logrus.WithField("module", "cluster"),
+	}
+}
+
+func ClusterModule() *cluster {
+	return clusterModule
+}
+
+func (c *cluster) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	c.ctx = ctx
+	return &c.preSettings, nil
+}
+
+func (c *cluster) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+func (c *cluster) ConfigChanged() {
+	if c.settings == nil {
+		c.settings = &c.preSettings
+	}
+
+	if c.settings.Node == "" {
+		c.settings.Node, _ = os.Hostname()
+	}
+
+	if !c.settings.Enable {
+		core.SetLocator(nil, core.LocatorSettings{})
+		return
+	}
+
+	// announcements go on while the node runs, the registry is only set up once
+	if c.registry == nil && c.settings.Registry.Backend != "" {
+		reg, err := registry.New(c.settings.Registry)
+		if err != nil {
+			c.logger.WithError(err).Error("failed to create stream registry")
+		} else {
+			c.registry = reg
+		}
+	}
+
+	if c.settings.Role != RoleEdge {
+		core.SetLocator(nil, core.LocatorSettings{})
+		return
+	}
+
+	if len(c.settings.Origins) == 0 && c.registry == nil {
+		c.logger.Warn("edge without origins or registry, streams are not repulled")
+		return
+	}
+
+	c.origins = NewOriginLocator(c.settings.Origins, c.settings.LookupTimeoutSeconds, c.logger)
+	core.SetLocator(c.locate, core.LocatorSettings{HoldSeconds: c.settings.HoldSeconds})
+	c.logger.WithField("origins", len(c.settings.Origins)).Info("edge mode, repulling streams")
+}
+
+// locate asks the registry first, then the configured origins.
+func (c *cluster) locate(ctx context.Context, namespace, stream string) (string, error) {
+	if c.registry != nil {
+		url, err := NewRegistryLocator(c.registry, c.settings.Node).Locate(ctx, namespace, stream)
+		if err == nil || len(c.settings.Origins) == 0 {
+			return url, err
+		}
+	}
+
+	return c.origins.Locate(ctx, namespace, stream)
+}
+
+func (c *cluster) ModuleRun() {
+	defer metrics.Track("cluster")()
+
+	gomodule.RequireFeatures(func(core feature_core.Feature) {
+		c.lock.Lock()
+		c.core = core
+		c.lock.Unlock()
+	})
+
+	if c.registry == nil {
+		<-c.ctx.Done()
+		return
+	}
+
+	defer c.registry.Close()
+
+	if c.settings.Advertise == "" {
+		c.logger.Warn("no advertise url, streams of this node are not announced")
+	}
+
+	gomodule.RequireFeatures(func(core feature_core.Feature) {
+		if c.settings.Advertise != "" {
+			announcer := NewAnnouncer(c.registry, core, c.settings.Node, c.settings.Advertise, c.logger)
+			metrics.Go("cluster", func() { announcer.Run(c.ctx) })
+		}
+
+		balancer := NewBalancer(c.registry, core, c.settings.Node, c.settings.Redirect, c.logger)
+		c.lock.Lock()
+		c.balancer = balancer
+		c.lock.Unlock()
+		metrics.Go("cluster", func() { balancer.Run(c.ctx) })
+	})
+
+	<-c.ctx.Done()
+}
+
+func (c *cluster) RedirectTarget(protocol string) (string, bool) {
+	draining := core.Draining()
+	if !c.settings.Redirect.Enable && !draining {
+		return "", false
+	}
+
+	c.lock.RLock()
+	balancer := c.balancer
+	c.lock.RUnlock()
+
+	if balancer == nil {
+		return "", false
+	}
+
+	if draining {
+		return balancer.Peer(protocol)
+	}
+
+	return balancer.Target(protocol)
+}
+
+// Streams lists the streams announced by all nodes.
+func (c *cluster) Streams(ctx context.Context) ([]registry.Entry, error) {
+	if c.registry == nil {
+		return nil, ErrNoRegistry
+	}
+
+	return c.registry.List(ctx)
+}
+
+func (c *cluster) Type() interface{} {
+	return feature_cluster.Type()
+}
@@ -0,0 +1,142 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	feature_core "github.com/pingostack/neon/features/core"
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/pkg/registry"
+	"github.com/sirupsen/logrus"
+)
+
+// puller sessions are created by the core pull manager with this peer id
+const pullPeerID = "pull"
+
+// Announcer publishes the streams of this node to the registry.
+type Announcer struct {
+	registry  *registry.Registry
+	core      feature_core.Feature
+	node      string
+	advertise string
+	logger    *logrus.Entry
+	announced map[string]registry.Entry
+}
+
+func NewAnnouncer(reg *registry.Registry, core feature_core.Feature, node, advertise string, logger *logrus.Entry) *Announcer {
+	return &Announcer{
+		registry:  reg,
+		core:      core,
+		node:      node,
+		advertise: advertise,
+		logger:    logger,
+		announced: make(map[string]registry.Entry),
+	}
+}
+
+// Run announces every third of the registry ttl until ctx is done, the
+// streams of this node are withdrawn then.
+func (a *Announcer) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.registry.TTL() / 3)
+	defer ticker.Stop()
+
+	for {
+		a.announce(ctx)
+
+		select {
+		case <-ctx.Done():
+			a.withdrawAll()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Announcer) announce(ctx context.Context) {
+	current := make(map[string]registry.Entry)
+
+	// streams of a draining node are withdrawn so that edges pull elsewhere
+	namespaces := a.core.Namespaces()
+	if core.Draining() {
+		namespaces = nil
+	}
+
+	for _, ns := range namespaces {
+		for _, r := range ns.Routers() {
+			producer := r.Producer()
+			if producer == nil {
+				continue
+			}
+
+			entry := registry.Entry{
+				Node:      a.node,
+				Namespace: ns.Name(),
+				Stream:    r.ID(),
+				URL:       expandURL(a.advertise, ns.Name(), r.ID()),
+				Origin:    producer.PeerParams().PeerID != pullPeerID,
+				Viewers:   r.SubscriberCount(),
+			}
+
+			if err := a.registry.Announce(ctx, entry); err != nil {
+				a.logger.WithError(err).WithField("stream", entry.Stream).Warn("announce failed")
+				continue
+			}
+
+			current[entry.Namespace+"/"+entry.Stream] = entry
+		}
+	}
+
+	for key, entry := range a.announced {
+		if _, ok := current[key]; ok {
+			continue
+		}
+
+		if err := a.registry.Withdraw(ctx, a.node, entry.Namespace, entry.Stream); err != nil {
+			a.logger.WithError(err).WithField("stream", entry.Stream).Warn("withdraw failed")
+			current[key] = entry
+		}
+	}
+
+	a.announced = current
+}
+
+func (a *Announcer) withdrawAll() {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	for _, entry := range a.announced {
+		a.registry.Withdraw(ctx, a.node, entry.Namespace, entry.Stream)
+	}
+}
+
+// RegistryLocator finds streams on the other nodes of the registry, nodes
+// publishing a stream are preferred over nodes pulling it themselves.
+type RegistryLocator struct {
+	registry *registry.Registry
+	node     string
+}
+
+func NewRegistryLocator(reg *registry.Registry, node string) *RegistryLocator {
+	return &RegistryLocator{registry: reg, node: node}
+}
+
+func (l *RegistryLocator) Locate(ctx context.Context, namespace, stream string) (string, error) {
+	entries, err := l.registry.Lookup(ctx, namespace, stream)
+	if err != nil {
+		return "", err
+	}
+
+	for _, entry := range entries {
+		if entry.Node != l.node && entry.URL != "" {
+			return entry.URL, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s/%s", ErrStreamNotFound, namespace, stream)
+}
+
+func expandURL(template, namespace, stream string) string {
+	return strings.NewReplacer("{namespace}", namespace, "{stream}", stream).Replace(template)
+}
@@ -0,0 +1,122 @@
+package compositor
+
+import (
+	"context"
+	"time"
+
+	"github.com/let-light/gomodule"
+	feature_compositor "github.com/pingostack/neon/features/compositor"
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Protocol names the sessions of compositions and their inputs.
+const Protocol = "compositor"
+
+// retried after the composition could not be published or ended
+const retryInterval = 5 * time.Second
+
+var compositorModule *compositors
+
+// CompositionSettings publish the video of Inputs and of the publishers of
+// Room composed as Stream of Namespace, the layout is switched with the admin
+// api.
+type CompositionSettings struct {
+	Namespace string   `json:"namespace" mapstructure:"namespace"`
+	Stream    string   `json:"stream" mapstructure:"stream"`
+	Room      string   `json:"room" mapstructure:"room"`
+	Inputs    []string `json:"inputs" mapstructure:"inputs"`
+	// Layout is grid or pip, Main the stream shown in full of pip.
+	Layout      string `json:"layout" mapstructure:"layout"`
+	Main        string `json:"main" mapstructure:"main"`
+	Width       int    `json:"width" mapstructure:"width"`
+	Height      int    `json:"height" mapstructure:"height"`
+	FPS         int    `json:"fps" mapstructure:"fps"`
+	BitrateKbps int    `json:"bitrateKbps" mapstructure:"bitrateKbps"`
+	// Command is the ffmpeg binary, EncoderArgs replace its libx264
+	// arguments, e.g. for a hardware encoder.
+	Command     string   `json:"command" mapstructure:"command"`
+	EncoderArgs []string `json:"encoderArgs" mapstructure:"encoderArgs"`
+}
+
+type CompositorSettings struct {
+	Compositions []CompositionSettings `json:"compositions" mapstructure:"compositions"`
+}
+
+type compositors struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings CompositorSettings
+	settings    *CompositorSettings
+	logger      *logrus.Entry
+}
+
+func init() {
+	compositorModule = &compositors{
+		logger: logrus.WithField("module", "compositor"),
+	}
+}
+
+func CompositorModule() *compositors {
+	return compositorModule
+}
+
+func (c *compositors) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	c.ctx = ctx
+	return &c.preSettings, nil
+}
+
+func (c *compositors) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+func (c *compositors) ConfigChanged() {
+	if c.settings == nil {
+		c.settings = &c.preSettings
+	}
+}
+
+func (c *compositors) ModuleRun() {
+	defer metrics.Track("compositor")()
+
+	if len(c.settings.Compositions) == 0 {
+		return
+	}
+
+	select {
+	case <-core.CoreModule().Ready():
+	case <-c.ctx.Done():
+		return
+	}
+
+	for _, comp := range c.settings.Compositions {
+		comp := comp
+		metrics.Go("compositor", func() { c.serve(comp) })
+	}
+
+	<-c.ctx.Done()
+}
+
+func (c *compositors) Type() interface{} {
+	return feature_compositor.Type()
+}
+
+// serve publishes comp until the module stops.
+func (c *compositors) serve(comp CompositionSettings) {
+	logger := c.logger.WithField("stream", comp.Namespace+"/"+comp.Stream)
+	for {
+		err := c.publish(comp, logger)
+		if c.ctx.Err() != nil {
+			return
+		}
+
+		logger.WithError(err).Warn("composition ended, republishing")
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package compositor
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/compositor"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// inputs are joined again and the publishers of rooms looked up this often
+const reconcileInterval = time.Second
+
+// ID is the id of the composition published as stream of namespace, see
+// compositor.Get.
+func ID(namespace, stream string) string {
+	return namespace + "/" + stream
+}
+
+func (c *compositors) publish(comp CompositionSettings, logger *logrus.Entry) error {
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+
+	cp, err := compositor.New(ctx, ID(comp.Namespace, comp.Stream), compositor.Options{
+		Command:     comp.Command,
+		Width:       comp.Width,
+		Height:      comp.Height,
+		FPS:         comp.FPS,
+		Bitrate:     comp.BitrateKbps,
+		EncoderArgs: comp.EncoderArgs,
+		Layout: compositor.Layout{
+			Kind: compositor.Kind(comp.Layout),
+			Main: comp.Main,
+		},
+	}, logger)
+	if err != nil {
+		return errors.Wrap(err, "compositor")
+	}
+
+	params := c.peerParams(comp.Namespace, comp.Stream)
+	params.Producer = true
+	params.HasVideo = true
+
+	session := core.NewSession(ctx, params, logger)
+	if err := session.BindFrameSource(cp); err != nil {
+		cp.Close()
+		return errors.Wrap(err, "bind frame source")
+	}
+
+	if err := session.Join(); err != nil {
+		session.Finalize(err)
+		return errors.Wrap(err, "join")
+	}
+
+	logger.Info("composition published")
+
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		c.reconcile(comp, cp, logger)
+
+		select {
+		case <-cp.Context().Done():
+			return errors.New("compositor closed")
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcile joins the inputs that left or are new, and removes the
+// publishers that left the room.
+func (c *compositors) reconcile(comp CompositionSettings, cp *compositor.Compositor, logger *logrus.Entry) {
+	wanted := make(map[string]bool)
+	for _, stream := range comp.Inputs {
+		wanted[stream] = true
+	}
+
+	if comp.Room != "" {
+		for _, stream := range c.roomStreams(comp) {
+			wanted[stream] = true
+		}
+
+		for _, stream := range cp.Inputs() {
+			if !wanted[stream] {
+				cp.RemoveInput(stream)
+			}
+		}
+	}
+
+	for stream := range wanted {
+		if cp.HasInput(stream) {
+			continue
+		}
+
+		dest, err := cp.AddInput(stream)
+		if err != nil {
+			logger.WithError(err).WithField("input", stream).Warn("composition input not added")
+			continue
+		}
+
+		if err := c.subscribe(comp.Namespace, stream, dest); err != nil {
+			logger.WithError(err).WithField("input", stream).Warn("composition input not joined")
+			dest.Close()
+		}
+	}
+}
+
+// roomStreams are the published streams with video of the participants of
+// the room of comp, named <room>.<participant>.
+func (c *compositors) roomStreams(comp CompositionSettings) []string {
+	prefix := comp.Room + "."
+
+	var streams []string
+	for _, ns := range core.CoreModule().Namespaces() {
+		if comp.Namespace != "" && ns.Name() != comp.Namespace {
+			continue
+		}
+
+		for _, r := range ns.Routers() {
+			id := r.ID()
+			if id == comp.Stream || !strings.HasPrefix(id, prefix) {
+				continue
+			}
+
+			if p := r.Producer(); p != nil && p.PeerParams().HasVideo {
+				streams = append(streams, id)
+			}
+		}
+	}
+
+	return streams
+}
+
+// subscribe joins dest to stream as a subscriber, until dest is closed.
+func (c *compositors) subscribe(namespace, stream string, dest deliver.FrameDestination) error {
+	params := c.peerParams(namespace, stream)
+	params.HasVideo = true
+
+	session := core.NewSession(dest.Context(), params, c.logger.WithField("stream", stream))
+	if err := session.BindFrameDestination(dest); err != nil {
+		return errors.Wrap(err, "bind frame destination")
+	}
+
+	// an input may not be published yet
+	if err := session.Join(); err != nil && !errors.Is(err, router.ErrPaddingDestination) {
+		return errors.Wrap(err, "join")
+	}
+
+	return nil
+}
+
+func (c *compositors) peerParams(namespace, stream string) router.PeerParams {
+	return router.PeerParams{
+		RouterID:  stream,
+		Namespace: namespace,
+		URI:       "/" + namespace + "/" + stream,
+		PeerID:    Protocol,
+		Protocol:  Protocol,
+	}
+}
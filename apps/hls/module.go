@@ -0,0 +1,178 @@
+package hls
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/let-light/gomodule"
+	feature_hls "github.com/pingostack/neon/features/hls"
+	"github.com/pingostack/neon/internal/httpserv"
+	"github.com/pingostack/neon/pkg/hls"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// KeyPath is where players fetch keys, <KeyPath>/<stream>/<id>.key.
+const KeyPath = "/hls/keys"
+
+var hlsModule *hlsKeys
+
+type HlsSettings struct {
+	httpserv.HttpParams `json:"http" mapstructure:"http"`
+	// Method is AES-128, SAMPLE-AES or NONE.
+	Method string `json:"method" mapstructure:"method"`
+	// KeyURL is the base of the key uris written to playlists, e.g. behind a
+	// cdn, KeyPath on the http server when empty.
+	KeyURL string          `json:"keyUrl" mapstructure:"keyUrl"`
+	Keys   hls.KeySettings `json:"keys" mapstructure:"keys"`
+}
+
+type hlsKeys struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings HlsSettings
+	settings    *HlsSettings
+	logger      *logrus.Entry
+	method      hls.Method
+	provider    hls.KeyProvider
+	serv        *Server
+}
+
+func init() {
+	hlsModule = &hlsKeys{
+		logger: logrus.WithField("module", "hls"),
+		method: hls.MethodNone,
+	}
+}
+
+func HlsModule() *hlsKeys {
+	return hlsModule
+}
+
+func (h *hlsKeys) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	h.ctx = ctx
+	return &h.preSettings, nil
+}
+
+func (h *hlsKeys) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+func (h *hlsKeys) ConfigChanged() {
+	if h.settings == nil {
+		h.settings = &h.preSettings
+	}
+
+	method := hls.Method(strings.ToUpper(h.settings.Method))
+	switch method {
+	case "", hls.MethodNone:
+		h.method, h.provider = hls.MethodNone, nil
+		return
+	case hls.MethodAES128, hls.MethodSampleAES:
+	default:
+		h.logger.WithField("method", h.settings.Method).Error(hls.ErrUnsupportedCrypt.Error())
+		h.method, h.provider = hls.MethodNone, nil
+		return
+	}
+
+	provider, err := hls.NewKeyProvider(h.settings.Keys)
+	if err != nil {
+		h.logger.WithError(err).Error("failed to create hls key provider, segments are not encrypted")
+		h.method, h.provider = hls.MethodNone, nil
+		return
+	}
+
+	if h.settings.Keys.Provider == hls.ProviderRotating && h.settings.Keys.Secret == "" {
+		h.logger.Warn("no secret for rotating hls keys, keys change on restart")
+	}
+
+	h.method, h.provider = method, provider
+}
+
+func (h *hlsKeys) ModuleRun() {
+	defer metrics.Track("hls")()
+
+	if h.provider == nil {
+		return
+	}
+
+	h.serv = NewServer(h.ctx, h.settings.HttpParams, h.provider, h.logger)
+	if err := h.serv.Start(); err != nil {
+		h.logger.Errorf("hls start error: %v", err)
+		return
+	}
+
+	h.logger.WithField("method", h.method).Info("hls keys served")
+
+	<-h.ctx.Done()
+	h.logger.Info("hls closing")
+	h.serv.Close()
+}
+
+func (h *hlsKeys) Type() interface{} {
+	return feature_hls.Type()
+}
+
+func (h *hlsKeys) Method() hls.Method {
+	return h.method
+}
+
+func (h *hlsKeys) SegmentKey(ctx context.Context, stream string, sequence uint64) (*hls.Key, string, error) {
+	if h.provider == nil {
+		return nil, hls.KeyTag(hls.MethodNone, "", nil), nil
+	}
+
+	key, err := h.provider.Key(ctx, stream, sequence)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return key, hls.KeyTag(h.method, h.keyURI(stream, key.ID), key), nil
+}
+
+func (h *hlsKeys) EncryptSegment(ctx context.Context, stream string, sequence uint64, segment []byte) ([]byte, string, error) {
+	key, tag, err := h.SegmentKey(ctx, stream, sequence)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if key == nil || h.method != hls.MethodAES128 {
+		return segment, tag, nil
+	}
+
+	out, err := hls.EncryptSegment(key, sequence, segment)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return out, tag, nil
+}
+
+func (h *hlsKeys) SampleEncrypter(ctx context.Context, stream string, sequence uint64) (*hls.SampleEncrypter, string, error) {
+	key, tag, err := h.SegmentKey(ctx, stream, sequence)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if key == nil || h.method != hls.MethodSampleAES {
+		return nil, tag, nil
+	}
+
+	e, err := hls.NewSampleEncrypter(key, sequence)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return e, tag, nil
+}
+
+func (h *hlsKeys) keyURI(stream, id string) string {
+	base := strings.TrimSuffix(h.settings.KeyURL, "/")
+	if base == "" {
+		base = KeyPath
+	}
+
+	return base + "/" + (&url.URL{Path: stream}).EscapedPath() + "/" + url.PathEscape(id) + ".key"
+}
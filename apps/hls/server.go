@@ -0,0 +1,103 @@
+package hls
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/let-light/gomodule"
+	feature_auth "github.com/pingostack/neon/features/auth"
+	"github.com/pingostack/neon/internal/httpserv"
+	"github.com/pingostack/neon/pkg/auth"
+	"github.com/pingostack/neon/pkg/hls"
+	"github.com/sirupsen/logrus"
+)
+
+type Server struct {
+	ss       *httpserv.SignalServer
+	logger   *logrus.Entry
+	provider hls.KeyProvider
+	auth     feature_auth.Feature
+}
+
+func NewServer(ctx context.Context, params httpserv.HttpParams, provider hls.KeyProvider, logger *logrus.Entry) *Server {
+	s := &Server{
+		ss:       httpserv.NewSignalServer(ctx, params, logger),
+		logger:   logger,
+		provider: provider,
+	}
+
+	gomodule.RequireFeatures(func(auth feature_auth.Feature) {
+		s.auth = auth
+	})
+
+	return s
+}
+
+func (s *Server) Start() error {
+	s.ss.DefaultRouter().GET(KeyPath+"/*key", s.handleGetKey)
+
+	return s.ss.Start(func(gc *gin.Context) {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	})
+}
+
+func (s *Server) Close() error {
+	return s.ss.Close()
+}
+
+// handleGetKey serves <stream>/<id>.key to players allowed to play stream.
+func (s *Server) handleGetKey(gc *gin.Context) {
+	key := strings.Trim(gc.Param("key"), "/")
+	stream, file := path.Split(key)
+	stream = strings.Trim(stream, "/")
+	id := strings.TrimSuffix(file, ".key")
+	if stream == "" || id == "" || id == file {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+
+	if err := s.authenticate(gc, stream); err != nil {
+		gc.Writer.Header().Set("WWW-Authenticate", "Bearer")
+		gc.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	k, err := s.provider.Lookup(gc.Request.Context(), stream, id)
+	if err == hls.ErrKeyNotFound {
+		gc.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		s.logger.WithError(err).WithField("stream", stream).Warn("failed to look up hls key")
+		gc.JSON(http.StatusBadGateway, gin.H{"error": "key unavailable"})
+		return
+	}
+
+	gc.Header("Cache-Control", "no-store")
+	gc.Data(http.StatusOK, "application/octet-stream", k.Key)
+}
+
+func (s *Server) authenticate(gc *gin.Context, stream string) error {
+	if s.auth == nil || !s.auth.Enabled() {
+		return nil
+	}
+
+	token := auth.BearerToken(gc.Request.Header)
+	if token == "" {
+		token = auth.TokenFromURL(gc.Request.URL)
+	}
+
+	_, err := s.auth.Authenticate(gc.Request.Context(), &auth.Request{
+		Protocol:   auth.ProtocolHLS,
+		Action:     auth.ActionPlay,
+		Path:       stream,
+		Host:       gc.Request.Host,
+		RemoteAddr: gc.Request.RemoteAddr,
+		Token:      token,
+		Args:       auth.ArgsFromURL(gc.Request.URL),
+	})
+
+	return err
+}
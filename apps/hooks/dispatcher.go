@@ -0,0 +1,212 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	feature_core "github.com/pingostack/neon/features/core"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	HeaderEvent     = "X-Neon-Event"
+	HeaderTimestamp = "X-Neon-Timestamp"
+	HeaderSignature = "X-Neon-Signature"
+
+	defaultTimeoutSeconds       = 5
+	defaultRetryIntervalSeconds = 1
+	defaultQueueSize            = 1024
+)
+
+type delivery struct {
+	endpoint EndpointSettings
+	event    feature_core.Event
+	body     []byte
+}
+
+// Dispatcher posts core events to the configured endpoints. Events are queued
+// so the core event loop is never blocked by slow endpoints, each endpoint
+// has its own queue so one being down or retrying holds up no other.
+type Dispatcher struct {
+	ctx      context.Context
+	settings HooksSettings
+	logger   *logrus.Entry
+	client   *http.Client
+	// by the index of the endpoint
+	queues []chan delivery
+}
+
+func NewDispatcher(ctx context.Context, settings HooksSettings, logger *logrus.Entry) *Dispatcher {
+	if settings.TimeoutSeconds <= 0 {
+		settings.TimeoutSeconds = defaultTimeoutSeconds
+	}
+
+	if settings.RetryIntervalSeconds <= 0 {
+		settings.RetryIntervalSeconds = defaultRetryIntervalSeconds
+	}
+
+	if settings.QueueSize <= 0 {
+		settings.QueueSize = defaultQueueSize
+	}
+
+	d := &Dispatcher{
+		ctx:      ctx,
+		settings: settings,
+		logger:   logger,
+		client:   &http.Client{Timeout: time.Duration(settings.TimeoutSeconds) * time.Second},
+		queues:   make([]chan delivery, len(settings.Endpoints)),
+	}
+
+	for i := range d.queues {
+		d.queues[i] = make(chan delivery, settings.QueueSize)
+	}
+
+	return d
+}
+
+func (d *Dispatcher) OnEvent(data interface{}) error {
+	event, ok := data.(feature_core.Event)
+	if !ok {
+		return fmt.Errorf("unexpected event type %T", data)
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "marshal event")
+	}
+
+	for i, ep := range d.settings.Endpoints {
+		if !subscribed(ep, event.Name) {
+			continue
+		}
+
+		select {
+		case d.queues[i] <- delivery{endpoint: ep, event: event, body: body}:
+		default:
+			d.logger.WithField("url", ep.URL).Warnf("hook queue full, event %s dropped", event.Name)
+		}
+	}
+
+	return nil
+}
+
+// Run delivers the events of every endpoint in order, until ctx is done.
+func (d *Dispatcher) Run() {
+	var wg sync.WaitGroup
+	for _, queue := range d.queues {
+		wg.Add(1)
+		queue := queue
+		metrics.Go("hooks", func() {
+			defer wg.Done()
+			d.work(queue)
+		})
+	}
+
+	wg.Wait()
+}
+
+func (d *Dispatcher) work(queue chan delivery) {
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case dl := <-queue:
+			d.deliver(dl)
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(dl delivery) {
+	logger := d.logger.WithFields(logrus.Fields{
+		"url":   dl.endpoint.URL,
+		"event": dl.event.Name,
+	})
+
+	for attempt := 0; attempt <= d.settings.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-time.After(time.Duration(d.settings.RetryIntervalSeconds*attempt) * time.Second):
+			}
+		}
+
+		err := d.post(dl)
+		if err == nil {
+			logger.Debug("hook delivered")
+			return
+		}
+
+		logger.WithError(err).Warnf("hook delivery failed, attempt %d", attempt+1)
+	}
+
+	logger.Error("hook delivery given up")
+}
+
+func (d *Dispatcher) post(dl delivery) error {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, dl.endpoint.URL, bytes.NewReader(dl.body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, dl.event.Name)
+	req.Header.Set(HeaderTimestamp, timestamp)
+
+	secret := dl.endpoint.Secret
+	if secret == "" {
+		secret = d.settings.Secret
+	}
+
+	if secret != "" {
+		req.Header.Set(HeaderSignature, "sha256="+Sign(secret, timestamp, dl.body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>", receivers should
+// recompute it and reject stale timestamps.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func subscribed(ep EndpointSettings, name string) bool {
+	if len(ep.Events) == 0 {
+		return true
+	}
+
+	for _, e := range ep.Events {
+		if e == name {
+			return true
+		}
+	}
+
+	return false
+}
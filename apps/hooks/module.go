@@ -0,0 +1,99 @@
+package hooks
+
+import (
+	"context"
+
+	"github.com/let-light/gomodule"
+	feature_core "github.com/pingostack/neon/features/core"
+	feature_hooks "github.com/pingostack/neon/features/hooks"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var hooksModule *hooks
+
+type EndpointSettings struct {
+	URL    string   `json:"url" mapstructure:"url"`
+	Events []string `json:"events" mapstructure:"events"` // empty means all events
+	Secret string   `json:"secret" mapstructure:"secret"` // overrides the global secret
+}
+
+type HooksSettings struct {
+	Secret               string `json:"secret" mapstructure:"secret"`
+	TimeoutSeconds       int    `json:"timeoutSeconds" mapstructure:"timeoutSeconds"`
+	Retries              int    `json:"retries" mapstructure:"retries"`
+	RetryIntervalSeconds int    `json:"retryIntervalSeconds" mapstructure:"retryIntervalSeconds"`
+	// QueueSize is the number of events waiting per endpoint.
+	QueueSize int                `json:"queueSize" mapstructure:"queueSize"`
+	Endpoints []EndpointSettings `json:"endpoints" mapstructure:"endpoints"`
+}
+
+type hooks struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings HooksSettings
+	settings    *HooksSettings
+	logger      *logrus.Entry
+	dispatcher  *Dispatcher
+}
+
+func init() {
+	hooksModule = &hooks{
+		logger: logrus.WithField("module", "hooks"),
+	}
+}
+
+func HooksModule() *hooks {
+	return hooksModule
+}
+
+func (h *hooks) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	h.ctx = ctx
+	return &h.preSettings, nil
+}
+
+func (h *hooks) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+func (h *hooks) ConfigChanged() {
+	if h.settings == nil {
+		h.settings = &h.preSettings
+	}
+}
+
+func (h *hooks) ModuleRun() {
+	defer metrics.Track("hooks")()
+
+	if len(h.settings.Endpoints) == 0 {
+		h.logger.Info("no hook endpoints configured")
+		return
+	}
+
+	h.dispatcher = NewDispatcher(h.ctx, *h.settings, h.logger)
+
+	gomodule.RequireFeatures(func(core feature_core.Feature) {
+		ee := core.EventEmitter()
+		ee.AddEvent(feature_core.EventStreamPublished, h.dispatcher.OnEvent)
+		ee.AddEvent(feature_core.EventStreamEnded, h.dispatcher.OnEvent)
+		ee.AddEvent(feature_core.EventClientConnected, h.dispatcher.OnEvent)
+		ee.AddEvent(feature_core.EventClientDisconnected, h.dispatcher.OnEvent)
+		ee.AddEvent(feature_core.EventRecordingFinished, h.dispatcher.OnEvent)
+		ee.AddEvent(feature_core.EventRecordingUploaded, h.dispatcher.OnEvent)
+		ee.AddEvent(feature_core.EventAuthFailed, h.dispatcher.OnEvent)
+		ee.AddEvent(feature_core.EventStreamFailover, h.dispatcher.OnEvent)
+		ee.AddEvent(feature_core.EventStreamFailback, h.dispatcher.OnEvent)
+		ee.AddEvent(feature_core.EventViewersThreshold, h.dispatcher.OnEvent)
+		ee.AddEvent(feature_core.EventGOPExceeded, h.dispatcher.OnEvent)
+		ee.AddEvent(feature_core.EventStreamUnhealthy, h.dispatcher.OnEvent)
+		ee.AddEvent(feature_core.EventStreamRecovered, h.dispatcher.OnEvent)
+		ee.AddEvent(feature_core.EventStreamQuarantined, h.dispatcher.OnEvent)
+	})
+
+	h.dispatcher.Run()
+}
+
+func (h *hooks) Type() interface{} {
+	return feature_hooks.Type()
+}
@@ -0,0 +1,120 @@
+package mixer
+
+import (
+	"context"
+	"time"
+
+	"github.com/let-light/gomodule"
+	feature_mixer "github.com/pingostack/neon/features/mixer"
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Protocol names the sessions of mixes and their inputs.
+const Protocol = "mixer"
+
+// retried after the mix could not be published or ended
+const retryInterval = 5 * time.Second
+
+var mixerModule *mixers
+
+type InputSettings struct {
+	Stream string `json:"stream" mapstructure:"stream"`
+	// Gain is linear, 0 mutes, 1 when omitted.
+	Gain *float64 `json:"gain" mapstructure:"gain"`
+}
+
+// MixSettings publish the audio of Inputs and of the publishers of Room as
+// Stream of Namespace, the gains are changed with the admin api.
+type MixSettings struct {
+	Namespace string          `json:"namespace" mapstructure:"namespace"`
+	Stream    string          `json:"stream" mapstructure:"stream"`
+	Room      string          `json:"room" mapstructure:"room"`
+	Inputs    []InputSettings `json:"inputs" mapstructure:"inputs"`
+	// Codec is pcmu, pcma or opus, the latter when built with libopus.
+	Codec      string `json:"codec" mapstructure:"codec"`
+	JitterMs   int    `json:"jitterMs" mapstructure:"jitterMs"`
+	MaxDelayMs int    `json:"maxDelayMs" mapstructure:"maxDelayMs"`
+}
+
+type MixerSettings struct {
+	Mixes []MixSettings `json:"mixes" mapstructure:"mixes"`
+}
+
+type mixers struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings MixerSettings
+	settings    *MixerSettings
+	logger      *logrus.Entry
+}
+
+func init() {
+	mixerModule = &mixers{
+		logger: logrus.WithField("module", "mixer"),
+	}
+}
+
+func MixerModule() *mixers {
+	return mixerModule
+}
+
+func (m *mixers) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	m.ctx = ctx
+	return &m.preSettings, nil
+}
+
+func (m *mixers) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+func (m *mixers) ConfigChanged() {
+	if m.settings == nil {
+		m.settings = &m.preSettings
+	}
+}
+
+func (m *mixers) ModuleRun() {
+	defer metrics.Track("mixer")()
+
+	if len(m.settings.Mixes) == 0 {
+		return
+	}
+
+	select {
+	case <-core.CoreModule().Ready():
+	case <-m.ctx.Done():
+		return
+	}
+
+	for _, mix := range m.settings.Mixes {
+		mix := mix
+		metrics.Go("mixer", func() { m.serve(mix) })
+	}
+
+	<-m.ctx.Done()
+}
+
+func (m *mixers) Type() interface{} {
+	return feature_mixer.Type()
+}
+
+// serve publishes mix until the module stops.
+func (m *mixers) serve(mix MixSettings) {
+	logger := m.logger.WithField("stream", mix.Namespace+"/"+mix.Stream)
+	for {
+		err := m.publish(mix, logger)
+		if m.ctx.Err() != nil {
+			return
+		}
+
+		logger.WithError(err).Warn("mix ended, republishing")
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package mixer
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/mixer"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// inputs are joined again and the publishers of rooms looked up this often
+const reconcileInterval = time.Second
+
+// ID is the id of the mix published as stream of namespace, see mixer.Get.
+func ID(namespace, stream string) string {
+	return namespace + "/" + stream
+}
+
+func (m *mixers) publish(mix MixSettings, logger *logrus.Entry) error {
+	ctx, cancel := context.WithCancel(m.ctx)
+	defer cancel()
+
+	codec := deliver.CodecTypeOpus
+	if mix.Codec != "" {
+		if codec = deliver.ConvCodecType(mix.Codec); codec == deliver.CodecTypeNone {
+			return errors.Errorf("unknown audio codec %s", mix.Codec)
+		}
+	}
+
+	mx, err := mixer.New(ctx, ID(mix.Namespace, mix.Stream), mixer.Options{
+		Codec:    codec,
+		Jitter:   time.Duration(mix.JitterMs) * time.Millisecond,
+		MaxDelay: time.Duration(mix.MaxDelayMs) * time.Millisecond,
+	}, logger)
+	if err != nil {
+		return errors.Wrap(err, "mixer")
+	}
+
+	params := m.peerParams(mix.Namespace, mix.Stream)
+	params.Producer = true
+	params.HasAudio = true
+
+	session := core.NewSession(ctx, params, logger)
+	if err := session.BindFrameSource(mx); err != nil {
+		mx.Close()
+		return errors.Wrap(err, "bind frame source")
+	}
+
+	if err := session.Join(); err != nil {
+		session.Finalize(err)
+		return errors.Wrap(err, "join")
+	}
+
+	logger.Info("mix published")
+
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		m.reconcile(mix, mx, logger)
+
+		select {
+		case <-mx.Context().Done():
+			return errors.New("mixer closed")
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcile joins the inputs that left or are new, and removes the
+// publishers that left the room.
+func (m *mixers) reconcile(mix MixSettings, mx *mixer.Mixer, logger *logrus.Entry) {
+	wanted := make(map[string]float64)
+	for _, in := range mix.Inputs {
+		gain := 1.0
+		if in.Gain != nil {
+			gain = *in.Gain
+		}
+		wanted[in.Stream] = gain
+	}
+
+	room := make(map[string]bool)
+	if mix.Room != "" {
+		for _, stream := range m.roomStreams(mix) {
+			room[stream] = true
+			if _, ok := wanted[stream]; !ok {
+				wanted[stream] = 1
+			}
+		}
+
+		for _, stream := range mx.Inputs() {
+			if _, ok := wanted[stream]; !ok {
+				mx.RemoveInput(stream)
+			}
+		}
+	}
+
+	for stream, gain := range wanted {
+		if mx.HasInput(stream) {
+			continue
+		}
+
+		dest, err := mx.AddInput(stream, gain)
+		if err != nil {
+			logger.WithError(err).WithField("input", stream).Warn("mix input not added")
+			continue
+		}
+
+		if err := m.subscribe(mix.Namespace, stream, dest); err != nil {
+			logger.WithError(err).WithField("input", stream).Warn("mix input not joined")
+			dest.Close()
+		}
+	}
+}
+
+// roomStreams are the published streams of the participants of the room of
+// mix, named <room>.<participant>.
+func (m *mixers) roomStreams(mix MixSettings) []string {
+	prefix := mix.Room + "."
+
+	var streams []string
+	for _, ns := range core.CoreModule().Namespaces() {
+		if mix.Namespace != "" && ns.Name() != mix.Namespace {
+			continue
+		}
+
+		for _, r := range ns.Routers() {
+			id := r.ID()
+			if id == mix.Stream || !strings.HasPrefix(id, prefix) {
+				continue
+			}
+
+			if p := r.Producer(); p != nil && p.PeerParams().HasAudio {
+				streams = append(streams, id)
+			}
+		}
+	}
+
+	return streams
+}
+
+// subscribe joins dest to stream as a subscriber, until dest is closed.
+func (m *mixers) subscribe(namespace, stream string, dest deliver.FrameDestination) error {
+	params := m.peerParams(namespace, stream)
+	params.HasAudio = true
+
+	session := core.NewSession(dest.Context(), params, m.logger.WithField("stream", stream))
+	if err := session.BindFrameDestination(dest); err != nil {
+		return errors.Wrap(err, "bind frame destination")
+	}
+
+	// an input may not be published yet
+	if err := session.Join(); err != nil && !errors.Is(err, router.ErrPaddingDestination) {
+		return errors.Wrap(err, "join")
+	}
+
+	return nil
+}
+
+func (m *mixers) peerParams(namespace, stream string) router.PeerParams {
+	return router.PeerParams{
+		RouterID:  stream,
+		Namespace: namespace,
+		URI:       "/" + namespace + "/" + stream,
+		PeerID:    Protocol,
+		Protocol:  Protocol,
+	}
+}
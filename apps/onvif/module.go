@@ -0,0 +1,351 @@
+package onvif
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/let-light/gomodule"
+	feature_onvif "github.com/pingostack/neon/features/onvif"
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/pkg/deliver/rtsp"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/pingostack/neon/pkg/onvif"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Owner names the sources of discovered cameras, see core.SetSources.
+const Owner = "onvif"
+
+const (
+	defaultNaming   = "onvif/{ip}/{index}"
+	defaultInterval = 60 * time.Second
+	defaultTimeout  = 5 * time.Second
+)
+
+var onvifModule *onvifDiscoverer
+
+type DeviceSettings struct {
+	// XAddr is the device service url, e.g. http://10.0.0.5/onvif/device_service,
+	// empty to only set the credentials of a discovered camera at IP.
+	XAddr    string `json:"xaddr" mapstructure:"xaddr"`
+	IP       string `json:"ip" mapstructure:"ip"`
+	Name     string `json:"name" mapstructure:"name"`
+	Username string `json:"username" mapstructure:"username"`
+	Password string `json:"password" mapstructure:"password"`
+}
+
+type OnvifSettings struct {
+	Enable bool `json:"enable" mapstructure:"enable"`
+	// Discover probes the network for cameras with WS-Discovery, on Interface
+	// if set.
+	Discover        bool   `json:"discover" mapstructure:"discover"`
+	Interface       string `json:"interface" mapstructure:"interface"`
+	IntervalSeconds int    `json:"intervalSeconds" mapstructure:"intervalSeconds"`
+	TimeoutSeconds  int    `json:"timeoutSeconds" mapstructure:"timeoutSeconds"`
+	// credentials of cameras without their own
+	Username string `json:"username" mapstructure:"username"`
+	Password string `json:"password" mapstructure:"password"`
+	// Naming is the stream path of a profile, {name}, {ip}, {profile},
+	// {token} and {index} are replaced.
+	Naming      string           `json:"naming" mapstructure:"naming"`
+	HoldSeconds int              `json:"holdSeconds" mapstructure:"holdSeconds"`
+	Devices     []DeviceSettings `json:"devices" mapstructure:"devices"`
+}
+
+type onvifDiscoverer struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings OnvifSettings
+	settings    *OnvifSettings
+	logger      *logrus.Entry
+	lock        sync.Mutex
+	cameras     map[string]*camera
+}
+
+// camera is a device found or configured, its sources are kept while it
+// doesn't answer until it's gone from discovery.
+type camera struct {
+	DeviceSettings
+	client  *onvif.Client
+	sources []core.SourceSettings
+}
+
+func init() {
+	onvifModule = &onvifDiscoverer{
+		logger:  logrus.WithField("module", "onvif"),
+		cameras: make(map[string]*camera),
+	}
+}
+
+func OnvifModule() *onvifDiscoverer {
+	return onvifModule
+}
+
+func (o *onvifDiscoverer) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	o.ctx = ctx
+	return &o.preSettings, nil
+}
+
+func (o *onvifDiscoverer) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+func (o *onvifDiscoverer) ConfigChanged() {
+	if o.settings == nil {
+		o.settings = &o.preSettings
+	}
+
+	if o.settings.Naming == "" {
+		o.settings.Naming = defaultNaming
+	}
+
+	// the sources of the cameras are rtsp, configured rtsp sources are
+	// pulled with it too
+	core.RegisterPuller(rtsp.Protocol, o.pull)
+}
+
+func (o *onvifDiscoverer) ModuleRun() {
+	defer metrics.Track("onvif")()
+
+	if !o.settings.Enable {
+		return
+	}
+
+	interval := defaultInterval
+	if o.settings.IntervalSeconds > 0 {
+		interval = time.Duration(o.settings.IntervalSeconds) * time.Second
+	}
+
+	o.logger.WithField("devices", len(o.settings.Devices)).Info("onvif started")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer core.SetSources(Owner, nil)
+
+	for {
+		o.scan(o.ctx)
+
+		select {
+		case <-o.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (o *onvifDiscoverer) Type() interface{} {
+	return feature_onvif.Type()
+}
+
+func (o *onvifDiscoverer) timeout() time.Duration {
+	if o.settings.TimeoutSeconds > 0 {
+		return time.Duration(o.settings.TimeoutSeconds) * time.Second
+	}
+
+	return defaultTimeout
+}
+
+// targets are the configured devices and the discovered ones, by ip.
+func (o *onvifDiscoverer) targets(ctx context.Context) map[string]DeviceSettings {
+	targets := make(map[string]DeviceSettings)
+	credentials := make(map[string]DeviceSettings)
+
+	for _, d := range o.settings.Devices {
+		ip := d.IP
+		if ip == "" {
+			ip = onvif.Host(d.XAddr)
+		}
+		d.IP = ip
+
+		if d.XAddr != "" {
+			targets[ip] = d
+		} else if ip != "" {
+			credentials[ip] = d
+		}
+	}
+
+	if !o.settings.Discover {
+		return targets
+	}
+
+	devices, err := onvif.Discover(ctx, o.settings.Interface, o.timeout())
+	if err != nil {
+		o.logger.WithError(err).Warn("onvif discovery failed")
+	}
+
+	for _, device := range devices {
+		xaddr := device.XAddr()
+		ip := onvif.Host(xaddr)
+		if ip == "" {
+			continue
+		}
+
+		if _, ok := targets[ip]; ok {
+			continue
+		}
+
+		d := credentials[ip]
+		d.XAddr, d.IP = xaddr, ip
+		if d.Name == "" {
+			d.Name = device.Name
+		}
+		targets[ip] = d
+	}
+
+	return targets
+}
+
+func (o *onvifDiscoverer) scan(ctx context.Context) {
+	targets := o.targets(ctx)
+
+	o.lock.Lock()
+	for ip := range o.cameras {
+		if _, ok := targets[ip]; !ok {
+			o.logger.WithField("ip", ip).Info("camera gone")
+			delete(o.cameras, ip)
+		}
+	}
+
+	cameras := make([]*camera, 0, len(targets))
+	for ip, d := range targets {
+		if d.Username == "" {
+			d.Username, d.Password = o.settings.Username, o.settings.Password
+		}
+
+		c, ok := o.cameras[ip]
+		if !ok || c.DeviceSettings != d {
+			c = &camera{
+				DeviceSettings: d,
+				client:         onvif.NewClient(d.XAddr, d.Username, d.Password, o.timeout()),
+			}
+			if ok {
+				c.sources = o.cameras[ip].sources
+			}
+			o.cameras[ip] = c
+		}
+		cameras = append(cameras, c)
+	}
+	o.lock.Unlock()
+
+	var wg sync.WaitGroup
+	for _, c := range cameras {
+		wg.Add(1)
+		c := c
+		metrics.Go("onvif", func() {
+			defer wg.Done()
+			o.query(ctx, c)
+		})
+	}
+	wg.Wait()
+
+	o.publish()
+}
+
+// query refreshes the sources of a camera from its media profiles.
+func (o *onvifDiscoverer) query(ctx context.Context, c *camera) {
+	logger := o.logger.WithField("ip", c.IP)
+
+	if err := c.client.SyncTime(ctx); err != nil {
+		logger.WithError(err).Debug("failed to read camera clock")
+	}
+
+	profiles, err := c.client.Profiles(ctx)
+	if err != nil {
+		logger.WithError(err).Warn("failed to get camera profiles")
+		return
+	}
+
+	sources := make([]core.SourceSettings, 0, len(profiles))
+	for i, p := range profiles {
+		uri, err := c.client.StreamURI(ctx, p.Token)
+		if err != nil {
+			logger.WithError(err).WithField("profile", p.Token).Warn("failed to get stream uri")
+			continue
+		}
+
+		sources = append(sources, core.SourceSettings{
+			Pattern:     o.streamPath(c, p, i),
+			URL:         uri,
+			HoldSeconds: o.settings.HoldSeconds,
+		})
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if len(c.sources) == 0 {
+		names := make([]string, 0, len(sources))
+		for _, s := range sources {
+			names = append(names, s.Pattern)
+		}
+		logger.WithField("streams", names).Info("camera found")
+	}
+	c.sources = sources
+}
+
+// streamPath names the stream of profile p, values are reduced to
+// characters that aren't special to stream patterns.
+func (o *onvifDiscoverer) streamPath(c *camera, p onvif.Profile, index int) string {
+	name := c.Name
+	if name == "" {
+		name = c.IP
+	}
+
+	profile := p.Name
+	if profile == "" {
+		profile = p.Token
+	}
+
+	r := strings.NewReplacer(
+		"{name}", pathSafe(name),
+		"{ip}", pathSafe(c.IP),
+		"{profile}", pathSafe(profile),
+		"{token}", pathSafe(p.Token),
+		"{index}", strconv.Itoa(index),
+	)
+
+	return strings.Trim(r.Replace(o.settings.Naming), "/")
+}
+
+func pathSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, strings.TrimSpace(s))
+}
+
+// publish hands the sources of all cameras to the pull manager.
+func (o *onvifDiscoverer) publish() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	ips := make([]string, 0, len(o.cameras))
+	for ip := range o.cameras {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	seen := make(map[string]string)
+	sources := make([]core.SourceSettings, 0)
+	for _, ip := range ips {
+		for _, s := range o.cameras[ip].sources {
+			if other, ok := seen[s.Pattern]; ok {
+				o.logger.WithField("stream", s.Pattern).WithField("ips", []string{other, ip}).
+					Warn("cameras named alike, check the naming")
+				continue
+			}
+			seen[s.Pattern] = ip
+			sources = append(sources, s)
+		}
+	}
+
+	core.SetSources(Owner, sources)
+}
@@ -0,0 +1,49 @@
+package onvif
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/deliver/rtsp"
+	"github.com/pkg/errors"
+)
+
+// pull republishes the rtsp stream of a camera locally, see core.Puller.
+func (o *onvifDiscoverer) pull(ctx context.Context, rawURL string, params router.PeerParams) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	src, err := rtsp.Dial(ctx, rawURL, o.timeout(), o.logger)
+	if err != nil {
+		u, _ := url.Parse(rawURL)
+		if u != nil {
+			rawURL = u.Redacted()
+		}
+		return errors.Wrapf(err, "rtsp play %s", rawURL)
+	}
+	defer src.Close()
+
+	params.Producer = true
+	params.Protocol = rtsp.Protocol
+	params.HasAudio = src.Metadata().HasAudio()
+	params.HasVideo = src.Metadata().HasVideo()
+
+	session := core.NewSession(ctx, params, o.logger.WithField("stream", params.RouterID))
+	if err := session.BindFrameSource(src); err != nil {
+		return errors.Wrap(err, "bind frame source")
+	}
+
+	if err := session.Join(); err != nil {
+		session.Finalize(err)
+		return errors.Wrap(err, "join")
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-src.Context().Done():
+		return src.Err()
+	}
+}
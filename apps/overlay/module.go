@@ -0,0 +1,137 @@
+package overlay
+
+import (
+	"context"
+
+	"github.com/let-light/gomodule"
+	feature_overlay "github.com/pingostack/neon/features/overlay"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/pingostack/neon/pkg/overlay"
+	"github.com/pingostack/neon/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var overlayModule *overlays
+
+// OverlaySettings draw an image, a text or the time over the video of the
+// streams matching Streams, namespace/stream patterns, see
+// utils.MatchStreamPath. "<namespace>/**" brands all streams of a tenant.
+type OverlaySettings struct {
+	Streams []string `json:"streams" mapstructure:"streams"`
+	// Image is drawn in ImagePosition, top-left, top-right, bottom-left or
+	// bottom-right.
+	Image         string `json:"image" mapstructure:"image"`
+	ImagePosition string `json:"imagePosition" mapstructure:"imagePosition"`
+	// Text is drawn in TextPosition, followed by the wall clock time when
+	// Timestamp.
+	Text         string `json:"text" mapstructure:"text"`
+	Timestamp    bool   `json:"timestamp" mapstructure:"timestamp"`
+	TextPosition string `json:"textPosition" mapstructure:"textPosition"`
+	FontFile     string `json:"fontFile" mapstructure:"fontFile"`
+	FontSize     int    `json:"fontSize" mapstructure:"fontSize"`
+	BitrateKbps  int    `json:"bitrateKbps" mapstructure:"bitrateKbps"`
+	// Command is the ffmpeg binary, EncoderArgs replace its libx264
+	// arguments, e.g. for a hardware encoder.
+	Command     string   `json:"command" mapstructure:"command"`
+	EncoderArgs []string `json:"encoderArgs" mapstructure:"encoderArgs"`
+}
+
+type OverlaysSettings struct {
+	// Overlays are tried in order, a stream gets the first it matches.
+	Overlays []OverlaySettings `json:"overlays" mapstructure:"overlays"`
+}
+
+type overlays struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings OverlaysSettings
+	settings    *OverlaysSettings
+	logger      *logrus.Entry
+}
+
+func init() {
+	overlayModule = &overlays{
+		logger: logrus.WithField("module", "overlay"),
+	}
+}
+
+func OverlayModule() *overlays {
+	return overlayModule
+}
+
+func (o *overlays) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	o.ctx = ctx
+	return &o.preSettings, nil
+}
+
+func (o *overlays) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+func (o *overlays) ConfigChanged() {
+	if o.settings == nil {
+		o.settings = &o.preSettings
+	}
+
+	if len(o.settings.Overlays) > 0 {
+		router.SetProcessorFactory(o.processor)
+	}
+}
+
+func (o *overlays) ModuleRun() {
+	defer metrics.Track("overlay")()
+
+	if len(o.settings.Overlays) == 0 {
+		return
+	}
+
+	<-o.ctx.Done()
+}
+
+func (o *overlays) Type() interface{} {
+	return feature_overlay.Type()
+}
+
+// processor draws the first overlay matching namespace/stream on it.
+func (o *overlays) processor(ctx context.Context, namespace, stream string) (router.Processor, error) {
+	for _, settings := range o.settings.Overlays {
+		if !matchAny(settings.Streams, namespace+"/"+stream) {
+			continue
+		}
+
+		logger := o.logger.WithField("stream", namespace+"/"+stream)
+		ov, err := overlay.New(ctx, overlay.Options{
+			Command:       settings.Command,
+			Image:         settings.Image,
+			ImagePosition: overlay.Position(settings.ImagePosition),
+			Text:          settings.Text,
+			Timestamp:     settings.Timestamp,
+			TextPosition:  overlay.Position(settings.TextPosition),
+			FontFile:      settings.FontFile,
+			FontSize:      settings.FontSize,
+			Bitrate:       settings.BitrateKbps,
+			EncoderArgs:   settings.EncoderArgs,
+		}, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		logger.Info("overlay drawn on stream")
+
+		return ov, nil
+	}
+
+	return nil, nil
+}
+
+func matchAny(patterns []string, streamPath string) bool {
+	for _, pattern := range patterns {
+		if utils.MatchStreamPath(pattern, streamPath) {
+			return true
+		}
+	}
+
+	return false
+}
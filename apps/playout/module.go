@@ -0,0 +1,122 @@
+package playout
+
+import (
+	"context"
+	"time"
+
+	"github.com/let-light/gomodule"
+	feature_playout "github.com/pingostack/neon/features/playout"
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/pingostack/neon/pkg/playout"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Protocol names the sessions of playout channels.
+const Protocol = "playout"
+
+// retried after the channel could not be published or failed
+const retryInterval = 5 * time.Second
+
+var playoutModule *playouts
+
+// ChannelSettings publish the recordings of Items one after the other as
+// Stream of Namespace, the playlist is replaced with the admin api.
+type ChannelSettings struct {
+	Namespace string         `json:"namespace" mapstructure:"namespace"`
+	Stream    string         `json:"stream" mapstructure:"stream"`
+	Loop      bool           `json:"loop" mapstructure:"loop"`
+	Items     []playout.Item `json:"items" mapstructure:"items"`
+}
+
+type PlayoutSettings struct {
+	// Dir has the files of the items, records by default like the recordings.
+	Dir      string            `json:"dir" mapstructure:"dir"`
+	Channels []ChannelSettings `json:"channels" mapstructure:"channels"`
+}
+
+type playouts struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings PlayoutSettings
+	settings    *PlayoutSettings
+	logger      *logrus.Entry
+}
+
+func init() {
+	playoutModule = &playouts{
+		logger: logrus.WithField("module", "playout"),
+	}
+}
+
+func PlayoutModule() *playouts {
+	return playoutModule
+}
+
+func (p *playouts) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	p.ctx = ctx
+	return &p.preSettings, nil
+}
+
+func (p *playouts) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+func (p *playouts) ConfigChanged() {
+	if p.settings == nil {
+		p.settings = &p.preSettings
+	}
+
+	if p.settings.Dir == "" {
+		p.settings.Dir = "records"
+	}
+}
+
+func (p *playouts) ModuleRun() {
+	defer metrics.Track("playout")()
+
+	if len(p.settings.Channels) == 0 {
+		return
+	}
+
+	select {
+	case <-core.CoreModule().Ready():
+	case <-p.ctx.Done():
+		return
+	}
+
+	for _, ch := range p.settings.Channels {
+		ch := ch
+		metrics.Go("playout", func() { p.serve(ch) })
+	}
+
+	<-p.ctx.Done()
+}
+
+func (p *playouts) Type() interface{} {
+	return feature_playout.Type()
+}
+
+// serve publishes ch until its playlist ended or the module stops.
+func (p *playouts) serve(ch ChannelSettings) {
+	logger := p.logger.WithField("stream", ch.Namespace+"/"+ch.Stream)
+	for {
+		err := p.publish(ch, logger)
+		if p.ctx.Err() != nil {
+			return
+		}
+
+		if err == nil {
+			logger.Info("playout channel ended")
+			return
+		}
+
+		logger.WithError(err).Warn("playout channel failed, republishing")
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
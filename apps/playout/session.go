@@ -0,0 +1,57 @@
+package playout
+
+import (
+	"context"
+
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/playout"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ID is the id of the channel published as stream of namespace, see
+// playout.Get.
+func ID(namespace, stream string) string {
+	return namespace + "/" + stream
+}
+
+// publish plays the playlist of ch, nil once it ended.
+func (p *playouts) publish(ch ChannelSettings, logger *logrus.Entry) error {
+	ctx, cancel := context.WithCancel(p.ctx)
+	defer cancel()
+
+	po, err := playout.New(ctx, ID(ch.Namespace, ch.Stream), ch.Items, playout.Options{
+		Dir:  p.settings.Dir,
+		Loop: ch.Loop,
+	}, logger)
+	if err != nil {
+		return errors.Wrap(err, "playout")
+	}
+
+	params := router.PeerParams{
+		RouterID:  ch.Stream,
+		Namespace: ch.Namespace,
+		URI:       "/" + ch.Namespace + "/" + ch.Stream,
+		PeerID:    Protocol,
+		Protocol:  Protocol,
+		Producer:  true,
+		HasAudio:  po.Metadata().HasAudio(),
+		HasVideo:  po.Metadata().HasVideo(),
+	}
+
+	session := core.NewSession(ctx, params, logger)
+	if err := session.BindFrameSource(po); err != nil {
+		po.Close()
+		return errors.Wrap(err, "bind frame source")
+	}
+
+	if err := session.Join(); err != nil {
+		session.Finalize(err)
+		return errors.Wrap(err, "join")
+	}
+
+	logger.Info("playout channel published")
+
+	return po.Run()
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/let-light/gomodule"
 	pms_feature "github.com/pingostack/neon/features/pms"
 	"github.com/pingostack/neon/internal/httpserv"
+	"github.com/pingostack/neon/pkg/metrics"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -24,6 +25,12 @@ type PMSSettings struct {
 	httpserv.HttpParams    `json:"http" mapstructure:"http"`
 	KeyFrameIntervalSecond time.Duration `json:"keyFrameIntervalSeconds" mapstructure:"keyFrameIntervalSeconds"`
 	JoinTimeoutSecond      time.Duration `json:"joinTimeoutSeconds" mapstructure:"joinTimeoutSeconds"`
+	Rooms                  RoomSettings  `json:"rooms" mapstructure:"rooms"`
+}
+
+type RoomSettings struct {
+	// MaxParticipants of a room, 0 is no limit.
+	MaxParticipants int `json:"maxParticipants" mapstructure:"maxParticipants"`
 }
 
 type pms struct {
@@ -75,6 +82,8 @@ func (pms *pms) Settings() PMSSettings {
 }
 
 func (pms *pms) ModuleRun() {
+	defer metrics.Track("pms")()
+
 	pms.serv = NewSignalServer(pms.ctx, pms.logger)
 	if err := pms.serv.Start(); err != nil {
 		pms.logger.Errorf("pms start error: %v", err)
@@ -1,13 +1,24 @@
 package pms
 
+import (
+	"github.com/pingostack/neon/pkg/room"
+	"github.com/pingostack/neon/pkg/rtclib/sdpassistor"
+)
+
 type Request struct {
 	Version string `json:"version"`
 	Method  string `json:"method"`
 	Stream  string `json:"stream"`
 	Session string `json:"session"`
+	Room    string `json:"room"`
 	Data    struct {
 		SDP        string `json:"sdp"`
 		MaxBitrate int    `json:"max_bitrate"`
+		// Participant is the one sending the room request, Target the one it
+		// subscribes to or kicks.
+		Participant string `json:"participant"`
+		Target      string `json:"target"`
+		Role        string `json:"role"`
 	} `json:"data"`
 }
 
@@ -17,7 +28,12 @@ type Response struct {
 	Err     int    `json:"err"`
 	ErrMsg  string `json:"err_msg"`
 	Session string `json:"session"`
-	Data    struct {
-		SDP string `json:"sdp"`
+	// Offer names the problem of an offer refused
+	Offer *sdpassistor.OfferError `json:"offer,omitempty"`
+	Data  struct {
+		SDP          string                 `json:"sdp"`
+		Participant  string                 `json:"participant,omitempty"`
+		Stream       string                 `json:"stream,omitempty"`
+		Participants []room.ParticipantInfo `json:"participants,omitempty"`
 	} `json:"data"`
 }
@@ -0,0 +1,202 @@
+package pms
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogf/gf/util/guid"
+	"github.com/pingostack/neon/pkg/room"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func (ss *SignalServer) roomResponse(req Request) Response {
+	resp := Response{
+		Version: req.Version,
+		Method:  req.Method,
+		Session: req.Session,
+	}
+	resp.Data.Participant = req.Data.Participant
+
+	return resp
+}
+
+// roomError answers errors of the room itself, only failures of the sessions
+// are internal errors.
+func (ss *SignalServer) roomError(gc *gin.Context, resp Response, err error) error {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, room.ErrRoomNotFound), errors.Is(err, room.ErrParticipantNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, room.ErrPermissionDenied):
+		status = http.StatusForbidden
+	case errors.Is(err, room.ErrAlreadyJoined), errors.Is(err, room.ErrRoomFull):
+		status = http.StatusConflict
+	}
+
+	resp.Err = status
+	resp.ErrMsg = err.Error()
+	gc.JSON(status, resp)
+
+	return nil
+}
+
+func (ss *SignalServer) roomJoin(req Request, gc *gin.Context) error {
+	if req.Data.Participant == "" {
+		req.Data.Participant = guid.S()
+	}
+	resp := ss.roomResponse(req)
+
+	role, err := room.ParseRole(req.Data.Role)
+	if err != nil {
+		return ss.roomError(gc, resp, err)
+	}
+
+	r, err := ss.rooms.Join(req.Room, req.Data.Participant, role)
+	if err != nil {
+		return ss.roomError(gc, resp, err)
+	}
+
+	resp.Data.Stream = r.StreamName(req.Data.Participant)
+	resp.Data.Participants = r.Participants()
+	gc.JSON(http.StatusOK, resp)
+
+	return nil
+}
+
+func (ss *SignalServer) roomLeave(req Request, gc *gin.Context) error {
+	resp := ss.roomResponse(req)
+
+	r, err := ss.rooms.Lookup(req.Room)
+	if err != nil {
+		return ss.roomError(gc, resp, err)
+	}
+
+	if err := r.Leave(req.Data.Participant); err != nil {
+		return ss.roomError(gc, resp, err)
+	}
+
+	gc.JSON(http.StatusOK, resp)
+
+	return nil
+}
+
+func (ss *SignalServer) roomKick(req Request, gc *gin.Context) error {
+	resp := ss.roomResponse(req)
+
+	r, err := ss.rooms.Lookup(req.Room)
+	if err != nil {
+		return ss.roomError(gc, resp, err)
+	}
+
+	if err := r.Kick(req.Data.Participant, req.Data.Target); err != nil {
+		return ss.roomError(gc, resp, err)
+	}
+
+	gc.JSON(http.StatusOK, resp)
+
+	return nil
+}
+
+func (ss *SignalServer) roomParticipants(req Request, gc *gin.Context) error {
+	resp := ss.roomResponse(req)
+
+	r, err := ss.rooms.Lookup(req.Room)
+	if err != nil {
+		return ss.roomError(gc, resp, err)
+	}
+
+	resp.Data.Participants = r.Participants()
+	gc.JSON(http.StatusOK, resp)
+
+	return nil
+}
+
+// roomPublish publishes the tracks of a participant as its room stream.
+func (ss *SignalServer) roomPublish(req Request, gc *gin.Context) error {
+	resp := ss.roomResponse(req)
+
+	r, err := ss.rooms.Lookup(req.Room)
+	if err != nil {
+		return ss.roomError(gc, resp, err)
+	}
+
+	if err := r.CanPublish(req.Data.Participant); err != nil {
+		return ss.roomError(gc, resp, err)
+	}
+
+	peerID := guid.S()
+	stream := r.StreamName(req.Data.Participant)
+	logger := ss.logger.WithFields(logrus.Fields{
+		"session":     peerID,
+		"router":      stream,
+		"room":        req.Room,
+		"participant": req.Data.Participant,
+	})
+
+	s := ss.newServSession(gc, peerID, stream, logger)
+	lsdp, err := s.Publish(settings().KeyFrameIntervalSecond*time.Second, req.Data.SDP)
+	if err != nil {
+		logger.WithError(err).Error("failed to publish")
+		return errors.Wrap(err, "failed to publish")
+	}
+
+	if err := r.AddSession(req.Data.Participant, s.Session); err != nil {
+		return ss.roomError(gc, resp, err)
+	}
+
+	resp.Session = peerID
+	resp.Data.SDP = lsdp.SDP
+	resp.Data.Stream = stream
+	gc.JSON(http.StatusOK, resp)
+
+	return nil
+}
+
+// roomSubscribe plays the stream of the target participant.
+func (ss *SignalServer) roomSubscribe(req Request, gc *gin.Context) error {
+	resp := ss.roomResponse(req)
+
+	r, err := ss.rooms.Lookup(req.Room)
+	if err != nil {
+		return ss.roomError(gc, resp, err)
+	}
+
+	if err := r.CanSubscribe(req.Data.Participant, req.Data.Target); err != nil {
+		return ss.roomError(gc, resp, err)
+	}
+
+	peerID := guid.S()
+	stream := r.StreamName(req.Data.Target)
+	logger := ss.logger.WithFields(logrus.Fields{
+		"session":     peerID,
+		"router":      stream,
+		"room":        req.Room,
+		"participant": req.Data.Participant,
+	})
+
+	s := ss.newServSession(gc, peerID, stream, logger)
+	lsdp, err := s.Subscribe(req.Data.SDP, settings().JoinTimeoutSecond*time.Second)
+	if err != nil {
+		logger.WithError(err).Error("failed to subscribe")
+		return errors.Wrap(err, "failed to subscribe")
+	}
+
+	if err := r.AddSession(req.Data.Participant, s.Session); err != nil {
+		return ss.roomError(gc, resp, err)
+	}
+
+	ss.sessions.Store(peerID, s)
+	go func() {
+		<-s.Context().Done()
+		ss.sessions.Delete(peerID)
+	}()
+
+	resp.Session = peerID
+	resp.Data.SDP = lsdp.SDP
+	resp.Data.Stream = stream
+	gc.JSON(http.StatusOK, resp)
+
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -11,15 +12,21 @@ import (
 	"github.com/pingostack/neon/internal/core/router"
 	"github.com/pingostack/neon/internal/httpserv"
 	inter_rtc "github.com/pingostack/neon/internal/rtc"
+	"github.com/pingostack/neon/pkg/acl"
 	"github.com/pingostack/neon/pkg/deliver/rtc"
+	"github.com/pingostack/neon/pkg/eventbus"
+	"github.com/pingostack/neon/pkg/room"
+	"github.com/pingostack/neon/pkg/rtclib/sdpassistor"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
 type SignalServer struct {
 	*httpserv.SignalServer
-	ctx    context.Context
-	logger *logrus.Entry
+	ctx      context.Context
+	logger   *logrus.Entry
+	sessions sync.Map
+	rooms    *room.Manager
 }
 
 func NewSignalServer(ctx context.Context, logger *logrus.Entry) *SignalServer {
@@ -27,10 +34,12 @@ func NewSignalServer(ctx context.Context, logger *logrus.Entry) *SignalServer {
 		SignalServer: httpserv.NewSignalServer(ctx, settings().HttpParams, logger),
 		ctx:          ctx,
 		logger:       logger,
+		rooms:        room.NewManager(settings().Rooms.MaxParticipants),
 	}
 }
 
 func (ss *SignalServer) Start() error {
+	ss.DefaultRouter().Use(httpserv.ACLCheckHandler("pms"))
 	return ss.SignalServer.Start(ss.handleRequest)
 }
 
@@ -57,6 +66,25 @@ func (ss *SignalServer) handleRequest(gc *gin.Context) {
 	}
 
 	if err := ss.handleRequestInternal(req, gc); err != nil {
+		var offerErr *sdpassistor.OfferError
+		if errors.As(err, &offerErr) {
+			resp := Response{
+				Version: req.Version,
+				Method:  req.Method,
+				Err:     http.StatusBadRequest,
+				ErrMsg:  offerErr.Error(),
+				Session: req.Session,
+				Offer:   offerErr,
+			}
+			gc.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if errors.Is(err, acl.ErrTooManyConnections) || errors.Is(err, acl.ErrDenied) || errors.Is(err, acl.ErrBanned) {
+			gc.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+			return
+		}
+
 		gc.JSON(http.StatusInternalServerError, gin.H{
 			"message": "internal server error",
 		})
@@ -77,20 +105,24 @@ func (ss *SignalServer) handleRequestInternal(req Request, gc *gin.Context) erro
 		return ss.mute(req, gc)
 	case "stream.max_bitrate":
 		return ss.maxBitrate(req, gc)
+	case "room.join":
+		return ss.roomJoin(req, gc)
+	case "room.leave":
+		return ss.roomLeave(req, gc)
+	case "room.publish":
+		return ss.roomPublish(req, gc)
+	case "room.subscribe":
+		return ss.roomSubscribe(req, gc)
+	case "room.participants":
+		return ss.roomParticipants(req, gc)
+	case "room.kick":
+		return ss.roomKick(req, gc)
 	}
 
 	return nil
 }
 
-func (ss *SignalServer) publish(req Request, gc *gin.Context) error {
-	peerID := req.Session
-	if peerID == "" {
-		peerID = guid.S()
-	}
-	logger := ss.logger.WithFields(logrus.Fields{
-		"session": peerID,
-		"router":  req.Stream,
-	})
+func (ss *SignalServer) newServSession(gc *gin.Context, peerID, stream string, logger *logrus.Entry) *rtc.ServSession {
 	domain := gc.Request.Host
 	sp := strings.Split(domain, ":")
 	if len(sp) > 0 {
@@ -100,12 +132,28 @@ func (ss *SignalServer) publish(req Request, gc *gin.Context) error {
 	s := rtc.NewServSession(ss.ctx, inter_rtc.StreamFactory(), router.PeerParams{
 		RemoteAddr: gc.Request.RemoteAddr,
 		LocalAddr:  gc.Request.Host,
+		Protocol:   eventbus.ProtocolWebRTC,
 		PeerID:     peerID,
-		RouterID:   req.Stream,
+		RouterID:   stream,
 		Domain:     domain,
 		URI:        gc.Request.URL.Path,
 		Producer:   true,
 	}, logger)
+	s.SetACL(acl.For("pms"))
+
+	return s
+}
+
+func (ss *SignalServer) publish(req Request, gc *gin.Context) error {
+	peerID := req.Session
+	if peerID == "" {
+		peerID = guid.S()
+	}
+	logger := ss.logger.WithFields(logrus.Fields{
+		"session": peerID,
+		"router":  req.Stream,
+	})
+	s := ss.newServSession(gc, peerID, req.Stream, logger)
 
 	lsdp, err := s.Publish(settings().KeyFrameIntervalSecond*time.Second, req.Data.SDP)
 	if err != nil {
@@ -119,12 +167,8 @@ func (ss *SignalServer) publish(req Request, gc *gin.Context) error {
 		Err:     0,
 		ErrMsg:  "",
 		Session: peerID,
-		Data: struct {
-			SDP string `json:"sdp"`
-		}{
-			SDP: lsdp.SDP,
-		},
 	}
+	resp.Data.SDP = lsdp.SDP
 
 	logger.WithField("answer", lsdp.SDP).Debug("resp answer")
 	gc.JSON(http.StatusOK, resp)
@@ -141,21 +185,7 @@ func (ss *SignalServer) play(req Request, gc *gin.Context) error {
 		"session": peerID,
 		"router":  req.Stream,
 	})
-	domain := gc.Request.Host
-	sp := strings.Split(domain, ":")
-	if len(sp) > 0 {
-		domain = sp[0]
-	}
-
-	s := rtc.NewServSession(ss.ctx, inter_rtc.StreamFactory(), router.PeerParams{
-		RemoteAddr: gc.Request.RemoteAddr,
-		LocalAddr:  gc.Request.Host,
-		PeerID:     peerID,
-		RouterID:   req.Stream,
-		Domain:     domain,
-		URI:        gc.Request.URL.Path,
-		Producer:   true,
-	}, logger)
+	s := ss.newServSession(gc, peerID, req.Stream, logger)
 
 	lsdp, err := s.Subscribe(req.Data.SDP, settings().JoinTimeoutSecond*time.Second)
 	if err != nil {
@@ -163,18 +193,22 @@ func (ss *SignalServer) play(req Request, gc *gin.Context) error {
 		return errors.Wrap(err, "failed to subscribe")
 	}
 
+	ss.sessions.Store(peerID, s)
+	go func() {
+		<-s.Context().Done()
+		if v, ok := ss.sessions.Load(peerID); ok && v == s {
+			ss.sessions.Delete(peerID)
+		}
+	}()
+
 	resp := Response{
 		Version: req.Version,
 		Method:  req.Method,
 		Err:     0,
 		ErrMsg:  "",
 		Session: peerID,
-		Data: struct {
-			SDP string `json:"sdp"`
-		}{
-			SDP: lsdp.SDP,
-		},
 	}
+	resp.Data.SDP = lsdp.SDP
 
 	logger.WithField("answer", lsdp.SDP).Debug("resp answer")
 	gc.JSON(http.StatusOK, resp)
@@ -191,5 +225,32 @@ func (ss *SignalServer) mute(req Request, gc *gin.Context) error {
 }
 
 func (ss *SignalServer) maxBitrate(req Request, gc *gin.Context) error {
+	resp := Response{
+		Version: req.Version,
+		Method:  req.Method,
+		Session: req.Session,
+	}
+
+	if req.Data.MaxBitrate < 0 {
+		resp.Err = http.StatusBadRequest
+		resp.ErrMsg = "invalid max bitrate"
+		gc.JSON(http.StatusBadRequest, resp)
+		return nil
+	}
+
+	v, found := ss.sessions.Load(req.Session)
+	if !found {
+		resp.Err = http.StatusNotFound
+		resp.ErrMsg = "session not found"
+		gc.JSON(http.StatusNotFound, resp)
+		return nil
+	}
+
+	if err := v.(*rtc.ServSession).SetMaxBitrate(uint64(req.Data.MaxBitrate)); err != nil {
+		return errors.Wrap(err, "failed to set max bitrate")
+	}
+
+	gc.JSON(http.StatusOK, resp)
+
 	return nil
 }
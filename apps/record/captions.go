@@ -0,0 +1,171 @@
+package record
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/caption"
+	"github.com/pingostack/neon/pkg/clock"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/sirupsen/logrus"
+)
+
+// frames the cc_data of reordered video waits for to be put in
+// presentation order
+const captionReorder = 4
+
+// CaptionSettings extract the cea-608 captions carried in the sei of the
+// video of a stream, they are kept in the recording as well.
+type CaptionSettings struct {
+	// WebVTT writes them next to every part, <part>.vtt on its timeline.
+	WebVTT bool `json:"webvtt" mapstructure:"webvtt"`
+}
+
+type captionFrame struct {
+	at  time.Duration
+	ccs []caption.CC
+}
+
+// captions writes the captions of the video of a part as webvtt, the file
+// is removed when there were none.
+type captions struct {
+	path    string
+	start   time.Time
+	logger  *logrus.Entry
+	lock    sync.Mutex
+	file    *os.File
+	buf     *bufio.Writer
+	vtt     *caption.WebVTTWriter
+	dec     *caption.Decoder
+	started bool
+	offset  time.Duration
+	lastTS  uint32
+	ts      int64
+	pending []captionFrame
+	last    time.Duration
+}
+
+// captionsPath is the webvtt file of the recording at path.
+func captionsPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".vtt"
+}
+
+func newCaptions(path string, start time.Time, logger *logrus.Entry) (*captions, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &captions{
+		path:   path,
+		start:  start,
+		logger: logger,
+		file:   f,
+		buf:    bufio.NewWriter(f),
+		dec:    caption.NewDecoder(),
+	}
+	c.vtt = caption.NewWebVTTWriter(c.buf)
+
+	return c, nil
+}
+
+// write takes the captions of a frame of the video, its rtp timestamps put
+// on the timeline of the part like the recorder does.
+func (c *captions) write(frame deliver.Frame, clockRate uint32) {
+	if frame.Codec != deliver.CodecTypeH264 && frame.Codec != deliver.CodecTypeH265 {
+		return
+	}
+	if clockRate == 0 {
+		clockRate = 90000
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.file == nil {
+		return
+	}
+
+	if !c.started {
+		c.started, c.lastTS = true, frame.TimeStamp
+		c.offset = clock.Default().Since(c.start)
+	} else {
+		c.ts += int64(int32(frame.TimeStamp - c.lastTS))
+		c.lastTS = frame.TimeStamp
+	}
+	at := c.offset + time.Duration(float64(c.ts)/float64(clockRate)*float64(time.Second))
+	if at > c.last {
+		c.last = at
+	}
+
+	ccs := caption.ExtractCC(frame.Codec, frame.Payload)
+	if len(ccs) == 0 {
+		return
+	}
+
+	i := sort.Search(len(c.pending), func(i int) bool { return c.pending[i].at > at })
+	c.pending = append(c.pending, captionFrame{})
+	copy(c.pending[i+1:], c.pending[i:])
+	c.pending[i] = captionFrame{at: at, ccs: ccs}
+
+	if len(c.pending) > captionReorder {
+		c.decode(c.pending[0])
+		c.pending = c.pending[1:]
+	}
+}
+
+func (c *captions) decode(f captionFrame) {
+	for _, cue := range c.dec.Decode(f.at, f.ccs) {
+		c.writeCue(cue)
+	}
+}
+
+func (c *captions) writeCue(cue caption.Cue) {
+	if err := c.vtt.WriteCue(cue); err != nil {
+		c.logger.WithError(err).WithField("file", c.path).Warn("failed to write captions")
+	}
+}
+
+// close ends the last cue with the part, it returns the path of the file,
+// empty without captions.
+func (c *captions) close() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.file == nil {
+		return ""
+	}
+
+	for _, f := range c.pending {
+		c.decode(f)
+	}
+	c.pending = nil
+	for _, cue := range c.dec.Flush(c.last) {
+		c.writeCue(cue)
+	}
+
+	err := c.buf.Flush()
+	if cerr := c.file.Close(); err == nil {
+		err = cerr
+	}
+	c.file = nil
+
+	if err != nil || c.vtt.Cues() == 0 {
+		if err != nil {
+			c.logger.WithError(err).WithField("file", c.path).Warn("failed to write captions")
+		}
+		os.Remove(c.path)
+		return ""
+	}
+
+	return c.path
+}
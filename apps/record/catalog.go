@@ -0,0 +1,152 @@
+package record
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pingostack/neon/pkg/record"
+	"github.com/pingostack/neon/pkg/record/catalog"
+)
+
+// CatalogSettings keep the recordings in a catalog, see
+// catalog.RegisterStore for stores other than the json file.
+type CatalogSettings struct {
+	Type string `json:"type" mapstructure:"type"`
+	// DSN of the store, the path of the file, catalog.json of the record
+	// dir when empty.
+	DSN string `json:"dsn" mapstructure:"dsn"`
+}
+
+func (r *recorder) loadCatalog() {
+	settings := r.settings.Catalog
+	if settings.Type == "" {
+		settings.Type = catalog.StoreFile
+	}
+	if settings.DSN == "" && settings.Type == catalog.StoreFile {
+		settings.DSN = filepath.Join(r.settings.Dir, "catalog.json")
+	}
+
+	store, err := catalog.Open(settings.Type, settings.DSN)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to open recording catalog")
+		return
+	}
+
+	// the recordings of a dir recorded before the catalog
+	if n, err := store.Len(); err == nil && n == 0 {
+		if imported, err := catalog.Import(store, r.settings.Dir); err != nil {
+			r.logger.WithError(err).Warn("failed to import recordings into the catalog")
+		} else if imported > 0 {
+			r.logger.WithField("recordings", imported).Info("recordings imported into the catalog")
+		}
+	}
+
+	r.catalog = store
+}
+
+// catalogID is the id of the recording at path in the record dir.
+func (r *recorder) catalogID(path string) string {
+	rel, err := filepath.Rel(r.settings.Dir, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// addToCatalog adds a finished part of the recording of namespace/stream.
+func (r *recorder) addToCatalog(namespace, stream, room string, part record.Recording) {
+	if r.catalog == nil {
+		return
+	}
+
+	e := catalog.Entry{
+		ID:        r.catalogID(part.Path),
+		Namespace: namespace,
+		Stream:    stream,
+		Room:      room,
+		Start:     part.Start,
+		End:       part.Start.Add(part.Duration),
+		Duration:  part.Duration,
+		Path:      part.Path,
+	}
+	if info, err := os.Stat(part.Path); err == nil {
+		e.Size = info.Size()
+	}
+	for _, t := range part.Tracks {
+		e.Tracks = append(e.Tracks, catalog.Track{
+			Stream:   t.Stream,
+			Codec:    t.Codec.String(),
+			Width:    t.Width,
+			Height:   t.Height,
+			Channels: int(t.Channels),
+		})
+	}
+
+	if err := r.catalog.Put(e); err != nil {
+		r.logger.WithError(err).WithField("file", part.Path).Error("failed to add recording to the catalog")
+	}
+}
+
+// uploadedToCatalog records where the recording at path was uploaded to.
+func (r *recorder) uploadedToCatalog(path, key string, deleted bool) {
+	if r.catalog == nil {
+		return
+	}
+
+	e, err := r.catalog.Get(r.catalogID(path))
+	if err != nil {
+		return
+	}
+
+	e.Key = key
+	if deleted {
+		e.Path = ""
+	}
+
+	if err := r.catalog.Put(e); err != nil {
+		r.logger.WithError(err).WithField("file", path).Error("failed to update recording in the catalog")
+	}
+}
+
+// Recordings lists the recordings of the catalog f selects.
+func (r *recorder) Recordings(f catalog.Filter) ([]catalog.Entry, error) {
+	if r.catalog == nil {
+		return nil, catalog.ErrUnknownStore
+	}
+
+	return r.catalog.List(f)
+}
+
+// DeleteRecording removes a recording of the catalog, its file and its
+// upload.
+func (r *recorder) DeleteRecording(id string) error {
+	if r.catalog == nil {
+		return catalog.ErrUnknownStore
+	}
+
+	e, err := r.catalog.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if e.Path != "" {
+		if err := os.Remove(e.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		os.Remove(captionsPath(e.Path))
+	}
+
+	if e.Key != "" && r.storage != nil {
+		ctx, cancel := context.WithTimeout(r.ctx, time.Minute)
+		defer cancel()
+
+		if err := r.storage.Delete(ctx, e.Key); err != nil {
+			return err
+		}
+	}
+
+	return r.catalog.Delete(id)
+}
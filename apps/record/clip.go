@@ -0,0 +1,148 @@
+package record
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	feature_record "github.com/pingostack/neon/features/record"
+	"github.com/pingostack/neon/pkg/record"
+	"github.com/pingostack/neon/pkg/record/catalog"
+	"github.com/pingostack/neon/pkg/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// ClipSettings keep the clips cut from recordings, the longest clip is
+// MaxMinutes, 60 when zero.
+type ClipSettings struct {
+	Dir        string `json:"dir" mapstructure:"dir"`
+	MaxMinutes int    `json:"maxMinutes" mapstructure:"maxMinutes"`
+}
+
+const defaultMaxClipMinutes = 60
+
+// ExportClip cuts from to to of the recordings of namespace/stream into an
+// mp4 of the clip dir, uploaded to the storage of the uploads when upload.
+func (r *recorder) ExportClip(namespace, stream string, from, to time.Time, upload bool) (feature_record.Clip, error) {
+	if r.catalog == nil {
+		return feature_record.Clip{}, catalog.ErrUnknownStore
+	}
+
+	if upload && r.storage == nil {
+		return feature_record.Clip{}, fmt.Errorf("%w: uploads not enabled", storage.ErrUnknownStorage)
+	}
+
+	longest := time.Duration(r.settings.Clips.MaxMinutes) * time.Minute
+	if longest <= 0 {
+		longest = defaultMaxClipMinutes * time.Minute
+	}
+	if !to.After(from) || to.Sub(from) > longest {
+		return feature_record.Clip{}, record.ErrInvalidRange
+	}
+
+	entries, err := r.catalog.List(catalog.Filter{Path: namespace + "/" + stream, From: from, To: to})
+	if err != nil {
+		return feature_record.Clip{}, err
+	}
+
+	var parts []record.ClipPart
+	for _, e := range entries {
+		if e.Namespace != namespace || e.Stream != stream || e.Path == "" {
+			continue
+		}
+		parts = append(parts, record.ClipPart{Path: e.Path, Start: e.Start})
+	}
+	if len(parts) == 0 {
+		return feature_record.Clip{}, os.ErrNotExist
+	}
+
+	name := path.Join(safeName(namespace), safeName(stream),
+		fmt.Sprintf("%s-%s-%s.mp4", safeName(stream), from.Format("20060102-150405"), to.Format("20060102-150405")))
+	file := filepath.Join(r.settings.Clips.Dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return feature_record.Clip{}, err
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return feature_record.Clip{}, err
+	}
+
+	info, err := record.ExportClip(f, parts, from, to)
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		os.Remove(file)
+		return feature_record.Clip{}, err
+	}
+
+	clip := feature_record.Clip{
+		File:     name,
+		Start:    info.Start,
+		Duration: info.Duration.Seconds(),
+	}
+	if fi, err := os.Stat(file); err == nil {
+		clip.Size = fi.Size()
+	}
+
+	logger := r.logger.WithFields(logrus.Fields{
+		"namespace": namespace,
+		"stream":    stream,
+		"clip":      file,
+	})
+	logger.WithField("duration", info.Duration.String()).Info("clip exported")
+
+	if !upload {
+		return clip, nil
+	}
+
+	clip.Key = path.Join(r.settings.Upload.Prefix, "clips", name)
+	if err := r.uploadClip(file, clip.Key, clip.Size); err != nil {
+		logger.WithError(err).Error("failed to upload clip")
+		return feature_record.Clip{}, err
+	}
+
+	if r.settings.Upload.DeleteLocal {
+		os.Remove(file)
+		clip.File = ""
+	}
+
+	return clip, nil
+}
+
+func (r *recorder) uploadClip(file, key string, size int64) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithTimeout(r.ctx, defaultUploadTimeout)
+	defer cancel()
+
+	return r.storage.Put(ctx, key, f, size, storage.PutOptions{
+		ContentType: contentTypes[record.FormatMP4],
+		Tags:        r.settings.Upload.Tags,
+	})
+}
+
+// ClipPath is the file of a clip exported.
+func (r *recorder) ClipPath(name string) (string, error) {
+	name = filepath.Clean(filepath.FromSlash(name))
+	if name == "." || filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return "", record.ErrInvalidURL
+	}
+
+	file := filepath.Join(r.settings.Clips.Dir, name)
+	if _, err := os.Stat(file); err != nil {
+		return "", err
+	}
+
+	return file, nil
+}
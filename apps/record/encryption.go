@@ -0,0 +1,79 @@
+package record
+
+import (
+	"context"
+	"strings"
+
+	"github.com/let-light/gomodule"
+	feature_hls "github.com/pingostack/neon/features/hls"
+	"github.com/pingostack/neon/pkg/hls"
+	"github.com/pingostack/neon/pkg/record/mp4"
+	"github.com/pkg/errors"
+)
+
+const (
+	SystemCommon    = "common"
+	SystemWidevine  = "widevine"
+	SystemPlayReady = "playready"
+	SystemFairPlay  = "fairplay"
+)
+
+type EncryptionSettings struct {
+	// Scheme is cenc or cbcs, mp4 recordings are encrypted with the key
+	// the hls module serves for the stream. Clear when empty.
+	Scheme string `json:"scheme" mapstructure:"scheme"`
+	// Systems are signalled by pssh boxes, common, widevine, playready and
+	// fairplay.
+	Systems      []string `json:"systems" mapstructure:"systems"`
+	PlayReadyURL string   `json:"playReadyUrl" mapstructure:"playReadyUrl"`
+}
+
+// encryption returns the encryption of a recording of stream, nil when
+// recordings are clear.
+func (r *recorder) encryption(ctx context.Context, stream string) (*mp4.Encryption, error) {
+	settings := r.settings.Encryption
+	if settings.Scheme == "" {
+		return nil, nil
+	}
+
+	scheme := mp4.Scheme(strings.ToLower(settings.Scheme))
+	if scheme != mp4.SchemeCENC && scheme != mp4.SchemeCBCS {
+		return nil, mp4.ErrInvalidEncryption
+	}
+
+	var key *hls.Key
+	var err error
+	gomodule.RequireFeatures(func(h feature_hls.Feature) {
+		key, _, err = h.SegmentKey(ctx, stream, 0)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "get recording key")
+	}
+	if key == nil {
+		return nil, errors.New("no key provider for encrypted recordings, hls encryption is disabled")
+	}
+
+	enc := &mp4.Encryption{
+		Scheme: scheme,
+		KeyID:  hls.KeyID(stream, key),
+		Key:    key.Key,
+		IV:     key.IV,
+	}
+
+	for _, system := range settings.Systems {
+		switch strings.ToLower(system) {
+		case SystemCommon:
+			enc.PSSH = append(enc.PSSH, mp4.CommonPSSH(enc.KeyID))
+		case SystemWidevine:
+			enc.PSSH = append(enc.PSSH, mp4.WidevinePSSH(scheme, enc.KeyID))
+		case SystemPlayReady:
+			enc.PSSH = append(enc.PSSH, mp4.PlayReadyPSSH(scheme, enc.KeyID, settings.PlayReadyURL))
+		case SystemFairPlay:
+			enc.PSSH = append(enc.PSSH, mp4.FairPlayPSSH(enc.KeyID))
+		default:
+			r.logger.WithField("system", system).Warn("unknown drm system, not signalled")
+		}
+	}
+
+	return enc, nil
+}
@@ -0,0 +1,283 @@
+package record
+
+import (
+	"context"
+	"sync"
+
+	"github.com/let-light/gomodule"
+	feature_core "github.com/pingostack/neon/features/core"
+	feature_record "github.com/pingostack/neon/features/record"
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/pkg/eventbus"
+	"github.com/pingostack/neon/pkg/eventemitter"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/pingostack/neon/pkg/record"
+	"github.com/pingostack/neon/pkg/record/catalog"
+	"github.com/pingostack/neon/pkg/storage"
+	"github.com/pingostack/neon/pkg/utils"
+	"github.com/pingostack/neon/pkg/vhost"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Protocol names the sessions of recordings.
+const Protocol = "record"
+
+var recordModule *recorder
+
+type PostProcessSettings struct {
+	// Command runs when a room recording ended, with the files of its parts
+	// as arguments after Args.
+	Command        string   `json:"command" mapstructure:"command"`
+	Args           []string `json:"args" mapstructure:"args"`
+	TimeoutSeconds int      `json:"timeoutSeconds" mapstructure:"timeoutSeconds"`
+}
+
+type RecordSettings struct {
+	Enable bool   `json:"enable" mapstructure:"enable"`
+	Dir    string `json:"dir" mapstructure:"dir"`
+	Format string `json:"format" mapstructure:"format"`
+	// Streams are recorded while published, namespace/stream patterns, see
+	// utils.MatchStreamPath.
+	Streams []string `json:"streams" mapstructure:"streams"`
+	// Rooms records all participants of a room into one file, a new part is
+	// started when a participant publishes.
+	Rooms       bool                `json:"rooms" mapstructure:"rooms"`
+	PostProcess PostProcessSettings `json:"postProcess" mapstructure:"postProcess"`
+	Encryption  EncryptionSettings  `json:"encryption" mapstructure:"encryption"`
+	// Schedules record the streams they match while a window is open.
+	Schedules []ScheduleSettings `json:"schedules" mapstructure:"schedules"`
+	Motion    MotionSettings     `json:"motion" mapstructure:"motion"`
+	Upload    UploadSettings     `json:"upload" mapstructure:"upload"`
+	Catalog   CatalogSettings    `json:"catalog" mapstructure:"catalog"`
+	Clips     ClipSettings       `json:"clips" mapstructure:"clips"`
+	Captions  CaptionSettings    `json:"captions" mapstructure:"captions"`
+}
+
+type recorder struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings RecordSettings
+	settings    *RecordSettings
+	logger      *logrus.Entry
+	ee          eventemitter.EventEmitter
+	lock        sync.Mutex
+	recordings  map[string]*recording
+	players     map[string]*record.Player
+	schedules   []*schedule
+	overrides   map[string]feature_record.Override
+	storage     storage.Storage
+	catalog     catalog.Store
+}
+
+func init() {
+	recordModule = &recorder{
+		logger:     logrus.WithField("module", "record"),
+		recordings: make(map[string]*recording),
+		players:    make(map[string]*record.Player),
+		overrides:  make(map[string]feature_record.Override),
+	}
+}
+
+func RecordModule() *recorder {
+	return recordModule
+}
+
+func (r *recorder) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	r.ctx = ctx
+	return &r.preSettings, nil
+}
+
+func (r *recorder) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+func (r *recorder) ConfigChanged() {
+	if r.settings == nil {
+		r.settings = &r.preSettings
+	}
+
+	if r.settings.Dir == "" {
+		r.settings.Dir = "records"
+	}
+
+	if r.settings.Format == "" {
+		r.settings.Format = string(record.FormatMP4)
+	}
+
+	if r.settings.Clips.Dir == "" {
+		r.settings.Clips.Dir = "clips"
+	}
+
+	r.loadSchedules()
+	r.loadStorage()
+	r.loadCatalog()
+
+	core.RegisterPuller(Scheme, r.pull)
+}
+
+func (r *recorder) ModuleRun() {
+	defer metrics.Track("record")()
+
+	if !r.settings.Enable {
+		return
+	}
+
+	gomodule.RequireFeatures(func(core feature_core.Feature) {
+		r.ee = core.EventEmitter()
+	})
+
+	bus := eventbus.Default()
+	unsubscribe := []func(){
+		eventemitter.Subscribe(bus, eventbus.TopicStreamPublished, r.onStreamPublished),
+		eventemitter.Subscribe(bus, eventbus.TopicStreamEnded, r.onStreamEnded),
+	}
+
+	if r.settings.Rooms {
+		unsubscribe = append(unsubscribe,
+			eventemitter.Subscribe(bus, eventbus.TopicRoomTrackPublished, r.onRoomTrackPublished),
+			eventemitter.Subscribe(bus, eventbus.TopicRoomTrackUnpublished, r.onRoomTrackUnpublished),
+			eventemitter.Subscribe(bus, eventbus.TopicRoomClosed, r.onRoomClosed),
+		)
+	}
+
+	r.logger.WithField("dir", r.settings.Dir).Info("recorder started")
+
+	r.runSchedules()
+
+	for _, f := range unsubscribe {
+		f()
+	}
+
+	r.lock.Lock()
+	recordings := r.recordings
+	r.recordings = make(map[string]*recording)
+	r.lock.Unlock()
+
+	for _, rec := range recordings {
+		rec.finish()
+	}
+}
+
+func (r *recorder) Type() interface{} {
+	return feature_record.Type()
+}
+
+func (r *recorder) onStreamPublished(e feature_core.Event) error {
+	if r.wanted(e.Namespace, e.Stream) {
+		r.recordStream(e.Namespace, e.Stream)
+	}
+
+	return nil
+}
+
+// recorded tells whether stream is one of the streams recorded while
+// published, the tenant of namespace has its own, and whether the tenant
+// disabled recording.
+func (r *recorder) recorded(namespace, stream string) (recorded bool, disabled bool) {
+	patterns, path := r.settings.Streams, namespace+"/"+stream
+	if tenant, ok := vhost.Default().Tenant(namespace); ok {
+		if tenant.Record.Disable {
+			return false, true
+		}
+
+		if len(tenant.Record.Streams) > 0 {
+			patterns, path = tenant.Record.Streams, stream
+		}
+	}
+
+	for _, pattern := range patterns {
+		if utils.MatchStreamPath(pattern, path) {
+			return true, false
+		}
+	}
+
+	return false, false
+}
+
+// recordStream records stream from now on, only around motion when it is
+// one of the motion streams and not recorded ad hoc.
+func (r *recorder) recordStream(namespace, stream string) {
+	path := namespace + "/" + stream
+
+	r.lock.Lock()
+	o, overridden := r.overrides[path]
+	r.lock.Unlock()
+
+	rec := r.recording(streamKey(namespace, stream), func() *recording {
+		rec := newRecording(r, namespace, stream, "")
+		if matchAny(r.settings.Motion.Streams, path) && !(overridden && o.Record) {
+			rec.motion = newMotionGate(r.settings.Motion, rec.logger)
+		}
+		return rec
+	})
+	rec.addStream(stream)
+}
+
+func (r *recorder) onStreamEnded(e feature_core.Event) error {
+	if rec := r.remove(streamKey(e.Namespace, e.Stream)); rec != nil {
+		rec.finish()
+	}
+
+	return nil
+}
+
+func (r *recorder) onRoomTrackPublished(e eventbus.RoomEvent) error {
+	rec := r.recording(roomKey(e.Room), func() *recording {
+		return newRecording(r, e.Namespace, e.Room, e.Room)
+	})
+	rec.addStream(e.Stream)
+
+	return nil
+}
+
+func (r *recorder) onRoomTrackUnpublished(e eventbus.RoomEvent) error {
+	r.lock.Lock()
+	rec := r.recordings[roomKey(e.Room)]
+	r.lock.Unlock()
+
+	if rec != nil {
+		rec.removeStream(e.Stream)
+	}
+
+	return nil
+}
+
+func (r *recorder) onRoomClosed(e eventbus.RoomEvent) error {
+	if rec := r.remove(roomKey(e.Room)); rec != nil {
+		rec.finish()
+	}
+
+	return nil
+}
+
+func (r *recorder) recording(key string, create func() *recording) *recording {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	rec, ok := r.recordings[key]
+	if !ok {
+		rec = create()
+		r.recordings[key] = rec
+	}
+
+	return rec
+}
+
+func (r *recorder) remove(key string) *recording {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	rec := r.recordings[key]
+	delete(r.recordings, key)
+
+	return rec
+}
+
+func streamKey(namespace, stream string) string {
+	return "stream/" + namespace + "/" + stream
+}
+
+func roomKey(room string) string {
+	return "room/" + room
+}
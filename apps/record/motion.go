@@ -0,0 +1,174 @@
+package record
+
+import (
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/record"
+	"github.com/pingostack/neon/pkg/record/motion"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPreRoll  = 5 * time.Second
+	defaultPostRoll = 10 * time.Second
+	// frames kept for the pre-roll at most, bounds the memory of streams
+	// with long keyframe intervals
+	maxPreRollFrames = 4096
+)
+
+// MotionSettings record the streams matching Streams, namespace/stream
+// patterns, only around motion: every part starts PreRollSeconds before
+// motion was detected and ends PostRollSeconds after it was last. Detector
+// is size, from the sizes of the encoded frames, or luma, from decoded
+// pictures when a decoder is built in, see motion.New.
+type MotionSettings struct {
+	Streams         []string `json:"streams" mapstructure:"streams"`
+	Detector        string   `json:"detector" mapstructure:"detector"`
+	Threshold       float64  `json:"threshold" mapstructure:"threshold"`
+	PreRollSeconds  int      `json:"preRollSeconds" mapstructure:"preRollSeconds"`
+	PostRollSeconds int      `json:"postRollSeconds" mapstructure:"postRollSeconds"`
+}
+
+type bufferedFrame struct {
+	frame deliver.Frame
+	at    time.Time
+}
+
+// motionGate keeps the pre-roll of a stream while nothing moves and tells
+// when its parts start and end, it is used with the lock of its recording.
+type motionGate struct {
+	settings MotionSettings
+	preRoll  time.Duration
+	postRoll time.Duration
+	logger   *logrus.Entry
+	detector motion.Detector
+	frames   []bufferedFrame
+	// when motion was last detected
+	last time.Time
+}
+
+func newMotionGate(settings MotionSettings, logger *logrus.Entry) *motionGate {
+	g := &motionGate{
+		settings: settings,
+		preRoll:  time.Duration(settings.PreRollSeconds) * time.Second,
+		postRoll: time.Duration(settings.PostRollSeconds) * time.Second,
+		logger:   logger,
+	}
+	if g.preRoll <= 0 {
+		g.preRoll = defaultPreRoll
+	}
+	if g.postRoll <= 0 {
+		g.postRoll = defaultPostRoll
+	}
+
+	return g
+}
+
+// reset detects on the video of md from now on, nil stops detecting.
+func (g *motionGate) reset(md *deliver.Metadata) {
+	if g.detector != nil {
+		g.detector.Close()
+		g.detector = nil
+	}
+	g.frames, g.last = nil, time.Time{}
+
+	if md == nil {
+		return
+	}
+
+	opts := motion.Options{Threshold: g.settings.Threshold}
+	detector, err := motion.New(g.settings.Detector, md, opts)
+	if errors.Is(err, motion.ErrNoDecoder) {
+		g.logger.WithField("codec", md.Video.CodecType.String()).Warn("no decoder for luma motion detection, detecting from frame sizes")
+		detector, err = motion.New(motion.DetectorSize, md, opts)
+	}
+	if err != nil {
+		g.logger.WithError(err).Warn("motion not detected, nothing recorded")
+		return
+	}
+
+	g.detector = detector
+}
+
+// buffer keeps frame for the pre-roll, which starts at a keyframe.
+func (g *motionGate) buffer(frame deliver.Frame, at time.Time) {
+	frame.Payload = append([]byte(nil), frame.Payload...)
+
+	if frame.Codec.IsVideo() && keyframe(frame) {
+		// the last keyframe old enough for the pre-roll starts it
+		cut := 0
+		for i, b := range g.frames {
+			if b.frame.Codec.IsVideo() && keyframe(b.frame) && at.Sub(b.at) >= g.preRoll {
+				cut = i
+			}
+		}
+		if cut > 0 {
+			g.frames = append([]bufferedFrame(nil), g.frames[cut:]...)
+		}
+	}
+
+	g.frames = append(g.frames, bufferedFrame{frame: frame, at: at})
+	if over := len(g.frames) - maxPreRollFrames; over > 0 {
+		g.frames = append([]bufferedFrame(nil), g.frames[over:]...)
+	}
+}
+
+func keyframe(frame deliver.Frame) bool {
+	info, ok := frame.AdditionalInfo.(*deliver.VideoFrameSpecificInfo)
+	return ok && info.IsKeyFrame
+}
+
+// writeMotion starts a part with the pre-roll when motion is detected and
+// ends it once nothing moved for the post-roll.
+func (rec *recording) writeMotion(stream string, frame deliver.Frame) {
+	now := time.Now()
+
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+
+	g := rec.motion
+	if rec.finished || g.detector == nil {
+		return
+	}
+
+	moving := frame.Codec.IsVideo() && g.detector.Detect(frame)
+	if moving {
+		g.last = now
+	}
+
+	if rec.current != nil && now.Sub(g.last) > g.postRoll {
+		rec.logger.Info("motion ended")
+		rec.finishPart()
+	}
+
+	if rec.current == nil {
+		g.buffer(frame, now)
+		if !moving {
+			return
+		}
+
+		rec.nextPartAt(g.frames[0].at)
+		if rec.current == nil {
+			return
+		}
+
+		rec.logger.WithField("preRoll", now.Sub(g.frames[0].at).String()).Info("motion detected, recording")
+		for _, b := range g.frames {
+			rec.writeCurrent(stream, b.frame, b.at)
+		}
+		g.frames = nil
+
+		return
+	}
+
+	rec.writeCurrent(stream, frame, now)
+}
+
+// writeCurrent must be called with rec.lock held
+func (rec *recording) writeCurrent(stream string, frame deliver.Frame, at time.Time) {
+	if err := rec.current.WriteFrameAt(stream, frame, at); err != nil && !errors.Is(err, record.ErrRecorderClosed) {
+		rec.logger.WithError(err).WithField("file", rec.current.Path()).Error("failed to write recording")
+	}
+}
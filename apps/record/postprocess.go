@@ -0,0 +1,59 @@
+package record
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pingostack/neon/pkg/record"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultPostProcessTimeout = 10 * time.Minute
+
+// postProcess runs the post process command of a room recording that ended,
+// e.g. to mix the tracks of its parts. The recording is described by the
+// environment as well, the parts in NEON_RECORDING_FILES separated by ":".
+func (r *recorder) postProcess(namespace, room string, start time.Time, parts []record.Recording) {
+	settings := r.settings.PostProcess
+	if settings.Command == "" {
+		return
+	}
+
+	timeout := time.Duration(settings.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultPostProcessTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	files := make([]string, len(parts))
+	for i, part := range parts {
+		files[i] = part.Path
+	}
+
+	args := append(append([]string(nil), settings.Args...), files...)
+	cmd := exec.CommandContext(ctx, settings.Command, args...)
+	cmd.Env = append(os.Environ(),
+		"NEON_RECORDING_NAMESPACE="+namespace,
+		"NEON_RECORDING_ROOM="+room,
+		"NEON_RECORDING_START="+start.Format(time.RFC3339Nano),
+		"NEON_RECORDING_FILES="+strings.Join(files, ":"),
+	)
+
+	logger := r.logger.WithFields(logrus.Fields{
+		"room":    room,
+		"command": settings.Command,
+	})
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		logger.WithError(err).WithField("output", string(output)).Error("post process failed")
+		return
+	}
+
+	logger.Info("post process finished")
+}
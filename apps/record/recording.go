@@ -0,0 +1,341 @@
+package record
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	feature_core "github.com/pingostack/neon/features/core"
+	"github.com/pingostack/neon/pkg/clock"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/record"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// participants publishing about the same time share a part
+const partDelay = 2 * time.Second
+
+type feed struct {
+	stream   string
+	dest     *record.FrameDestination
+	metadata *deliver.Metadata
+}
+
+// recording writes one stream, or all streams of a room, into a file. When a
+// stream is added a new part is started, all parts share the timeline of
+// the recording.
+type recording struct {
+	r         *recorder
+	namespace string
+	name      string
+	room      string
+	start     time.Time
+	logger    *logrus.Entry
+	lock      sync.Mutex
+	feeds     map[string]*feed
+	current   *record.Recorder
+	part      int
+	parts     []record.Recording
+	timer     *clock.Timer
+	finished  bool
+	// records parts only around motion, see motion.go
+	motion *motionGate
+	// the captions of the current part, see captions.go
+	captions *captions
+}
+
+func newRecording(r *recorder, namespace, name, room string) *recording {
+	return &recording{
+		r:         r,
+		namespace: namespace,
+		name:      name,
+		room:      room,
+		start:     clock.Default().Now(),
+		logger: r.logger.WithFields(logrus.Fields{
+			"namespace": namespace,
+			"recording": name,
+		}),
+		feeds: make(map[string]*feed),
+	}
+}
+
+func (rec *recording) addStream(stream string) {
+	rec.lock.Lock()
+	if rec.finished || rec.feeds[stream] != nil {
+		rec.lock.Unlock()
+		return
+	}
+
+	f := &feed{
+		stream: stream,
+		dest:   record.NewFrameDestination(rec.r.ctx, rec.logger.WithField("stream", stream)),
+	}
+	f.dest.OnMetadataChange(func(md *deliver.Metadata) {
+		rec.onMetadata(f, md)
+	})
+	f.dest.OnRawFrame(func(frame deliver.Frame) {
+		rec.write(stream, frame)
+	})
+	rec.feeds[stream] = f
+	rec.lock.Unlock()
+
+	if err := rec.r.subscribe(rec.namespace, stream, f.dest); err != nil {
+		rec.logger.WithError(err).WithField("stream", stream).Error("failed to subscribe")
+		rec.removeStream(stream)
+	}
+}
+
+func (rec *recording) removeStream(stream string) {
+	rec.lock.Lock()
+	f := rec.feeds[stream]
+	delete(rec.feeds, stream)
+	if len(rec.feeds) == 0 {
+		// a new part starts when a stream is published again
+		rec.finishPart()
+	}
+	rec.lock.Unlock()
+
+	if f != nil {
+		f.dest.Close()
+	}
+}
+
+func (rec *recording) onMetadata(f *feed, md *deliver.Metadata) {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+
+	if rec.finished || rec.feeds[f.stream] != f {
+		return
+	}
+
+	metadata := *md
+	f.metadata = &metadata
+
+	if rec.motion != nil {
+		rec.finishPart()
+		rec.motion.reset(&metadata)
+		return
+	}
+
+	if rec.room == "" {
+		rec.nextPart()
+		return
+	}
+
+	if rec.timer != nil {
+		rec.timer.Stop()
+	}
+	rec.timer = clock.Default().AfterFunc(partDelay, func() {
+		rec.lock.Lock()
+		defer rec.lock.Unlock()
+
+		rec.nextPart()
+	})
+}
+
+// nextPart must be called with rec.lock held
+func (rec *recording) nextPart() {
+	rec.nextPartAt(rec.start)
+}
+
+// nextPartAt starts a part on the timeline from start, must be called with
+// rec.lock held
+func (rec *recording) nextPartAt(start time.Time) {
+	if rec.finished {
+		return
+	}
+
+	rec.finishPart()
+
+	rec.part++
+	path := filepath.Join(rec.r.settings.Dir, safeName(rec.namespace), safeName(rec.name),
+		fmt.Sprintf("%s-%s-%d.%s", safeName(rec.name), start.Format("20060102-150405"), rec.part, rec.r.settings.Format))
+	current := record.NewRecorder(path, record.Format(rec.r.settings.Format), start, rec.logger)
+
+	enc, err := rec.r.encryption(rec.r.ctx, rec.namespace+"/"+rec.name)
+	if err == nil && enc != nil {
+		err = current.Encrypt(*enc)
+	}
+	if err != nil {
+		// rather nothing than a clear recording
+		rec.logger.WithError(err).Error("failed to encrypt recording, not recorded")
+		return
+	}
+
+	streams := 0
+	for _, f := range rec.feeds {
+		if f.metadata == nil {
+			continue
+		}
+
+		if err := current.AddStream(f.stream, f.metadata); err != nil {
+			rec.logger.WithError(err).WithField("stream", f.stream).Error("failed to add stream")
+			continue
+		}
+		streams++
+	}
+
+	if streams == 0 {
+		return
+	}
+
+	rec.current = current
+	if rec.r.settings.Captions.WebVTT && rec.room == "" {
+		if c, err := newCaptions(captionsPath(path), start, rec.logger); err != nil {
+			rec.logger.WithError(err).Warn("failed to create captions, not extracted")
+		} else {
+			rec.captions = c
+		}
+	}
+
+	for _, f := range rec.feeds {
+		f.dest.RequestKeyframe()
+	}
+}
+
+// finishPart must be called with rec.lock held
+func (rec *recording) finishPart() {
+	if rec.current == nil {
+		return
+	}
+
+	result, err := rec.current.Close()
+	rec.current = nil
+
+	vtt := ""
+	if rec.captions != nil {
+		vtt = rec.captions.close()
+		rec.captions = nil
+	}
+	if errors.Is(err, record.ErrNoTracks) {
+		rec.logger.Debug("nothing recorded")
+		return
+	} else if err != nil {
+		rec.logger.WithError(err).WithField("file", result.Path).Error("failed to finish recording")
+		return
+	}
+
+	rec.parts = append(rec.parts, result)
+	rec.logger.WithFields(logrus.Fields{
+		"file":     result.Path,
+		"duration": result.Duration.String(),
+	}).Info("recording finished")
+
+	rec.r.addToCatalog(rec.namespace, rec.name, rec.room, result)
+
+	// the parts of a room are uploaded after their post process
+	if rec.room == "" {
+		go rec.r.upload(rec.namespace, rec.name, result)
+	}
+
+	if rec.r.ee == nil {
+		return
+	}
+
+	extra := map[string]interface{}{
+		"file":     result.Path,
+		"part":     rec.part,
+		"duration": result.Duration.Seconds(),
+		"tracks":   len(result.Tracks),
+	}
+	if rec.room != "" {
+		extra["room"] = rec.room
+	}
+	if rec.motion != nil {
+		extra["motion"] = true
+	}
+	if vtt != "" {
+		extra["captions"] = vtt
+	}
+
+	rec.r.ee.EmitEvent(feature_core.EventRecordingFinished, feature_core.Event{
+		Name:      feature_core.EventNameRecordingFinished,
+		Time:      time.Now(),
+		Namespace: rec.namespace,
+		Stream:    rec.name,
+		Extra:     extra,
+	})
+}
+
+func (rec *recording) write(stream string, frame deliver.Frame) {
+	if rec.motion != nil {
+		rec.writeMotion(stream, frame)
+		return
+	}
+
+	rec.lock.Lock()
+	current, captions := rec.current, rec.captions
+	var clockRate uint32
+	if f := rec.feeds[stream]; f != nil && f.metadata != nil && f.metadata.Video != nil {
+		clockRate = f.metadata.Video.ClockRate
+	}
+	rec.lock.Unlock()
+
+	if current == nil {
+		return
+	}
+
+	if err := current.WriteFrame(stream, frame); err != nil && !errors.Is(err, record.ErrRecorderClosed) {
+		rec.logger.WithError(err).WithField("file", current.Path()).Error("failed to write recording")
+	}
+
+	if captions != nil {
+		captions.write(frame, clockRate)
+	}
+}
+
+// finish ends the recording, a room recording is post processed.
+func (rec *recording) finish() {
+	rec.lock.Lock()
+	if rec.finished {
+		rec.lock.Unlock()
+		return
+	}
+	rec.finished = true
+
+	if rec.timer != nil {
+		rec.timer.Stop()
+	}
+	rec.finishPart()
+	if rec.motion != nil {
+		rec.motion.reset(nil)
+	}
+
+	feeds := rec.feeds
+	rec.feeds = make(map[string]*feed)
+	parts := rec.parts
+	rec.lock.Unlock()
+
+	for _, f := range feeds {
+		f.dest.Close()
+	}
+
+	if rec.room != "" && len(parts) > 0 {
+		go func() {
+			rec.r.postProcess(rec.namespace, rec.room, rec.start, parts)
+			for _, part := range parts {
+				rec.r.upload(rec.namespace, rec.room, part)
+			}
+		}()
+	}
+}
+
+// safeName keeps names of streams and rooms from leaving the directory.
+func safeName(name string) string {
+	name = strings.Map(func(c rune) rune {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+			return c
+		}
+		return '_'
+	}, name)
+
+	if name == "" || strings.Trim(name, ".") == "" {
+		return "_"
+	}
+
+	return name
+}
@@ -0,0 +1,233 @@
+package record
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	feature_record "github.com/pingostack/neon/features/record"
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/pingostack/neon/pkg/record"
+	"github.com/pingostack/neon/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+// the published streams are recorded or not as the schedules and overrides
+// say this often
+const scheduleInterval = 10 * time.Second
+
+// ScheduleSettings record the streams matching Streams, namespace/stream
+// patterns, for DurationMinutes from every minute of the cron expression
+// Start, except on the dates of Except, 2006-01-02. The times are those of
+// Timezone, local when empty.
+type ScheduleSettings struct {
+	Streams         []string `json:"streams" mapstructure:"streams"`
+	Start           string   `json:"start" mapstructure:"start"`
+	DurationMinutes int      `json:"durationMinutes" mapstructure:"durationMinutes"`
+	Except          []string `json:"except" mapstructure:"except"`
+	Timezone        string   `json:"timezone" mapstructure:"timezone"`
+}
+
+type schedule struct {
+	ScheduleSettings
+	*record.Schedule
+}
+
+func (r *recorder) loadSchedules() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.schedules = nil
+	for _, s := range r.settings.Schedules {
+		sc, err := record.NewSchedule(s.Start, time.Duration(s.DurationMinutes)*time.Minute, s.Except, s.Timezone)
+		if err != nil {
+			r.logger.WithError(err).WithField("start", s.Start).Error("recording schedule ignored")
+			continue
+		}
+
+		r.schedules = append(r.schedules, &schedule{ScheduleSettings: s, Schedule: sc})
+	}
+}
+
+// runSchedules applies the schedules and overrides to the published streams
+// until the module stops.
+func (r *recorder) runSchedules() {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+			r.applySchedules()
+		}
+	}
+}
+
+// wanted tells whether stream of namespace is recorded now: as an override
+// says, when it is one of the streams recorded while published, around
+// motion or when a schedule of it is open.
+func (r *recorder) wanted(namespace, stream string) bool {
+	recorded, disabled := r.recorded(namespace, stream)
+	if disabled {
+		return false
+	}
+
+	path := namespace + "/" + stream
+	now := time.Now()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if o, ok := r.overrides[path]; ok {
+		if o.Until.IsZero() || now.Before(o.Until) {
+			return o.Record
+		}
+		delete(r.overrides, path)
+		r.logger.WithField("path", path).Info("recording override expired")
+	}
+
+	if recorded || matchAny(r.settings.Motion.Streams, path) {
+		return true
+	}
+
+	for _, s := range r.schedules {
+		if !matchAny(s.Streams, path) {
+			continue
+		}
+
+		if active, _ := s.Active(now); active {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchAny(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if utils.MatchStreamPath(pattern, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// applySchedules starts and finishes the recordings of the published
+// streams, the recordings of rooms are left alone.
+func (r *recorder) applySchedules() {
+	for _, ns := range core.CoreModule().Namespaces() {
+		for _, rt := range ns.Routers() {
+			if rt.Producer() == nil {
+				continue
+			}
+
+			namespace, stream := ns.Name(), rt.ID()
+			key := streamKey(namespace, stream)
+
+			r.lock.Lock()
+			_, recording := r.recordings[key]
+			r.lock.Unlock()
+
+			want := r.wanted(namespace, stream)
+			if want && !recording {
+				r.logger.WithField("path", namespace+"/"+stream).Info("scheduled recording started")
+				r.recordStream(namespace, stream)
+			} else if !want && recording {
+				if rec := r.remove(key); rec != nil {
+					r.logger.WithField("path", namespace+"/"+stream).Info("scheduled recording stopped")
+					rec.finish()
+				}
+			}
+		}
+	}
+}
+
+func (r *recorder) Schedules() []feature_record.ScheduleInfo {
+	now := time.Now()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	infos := make([]feature_record.ScheduleInfo, 0, len(r.schedules))
+	for _, s := range r.schedules {
+		info := feature_record.ScheduleInfo{
+			Streams:         s.Streams,
+			Start:           s.ScheduleSettings.Start,
+			DurationMinutes: s.DurationMinutes,
+			Except:          s.ScheduleSettings.Except,
+			Timezone:        s.Location.String(),
+		}
+		if active, until := s.Active(now); active {
+			info.Active, info.Until = true, &until
+		}
+		if next := s.Next(now); !next.IsZero() {
+			info.Next = &next
+		}
+		infos = append(infos, info)
+	}
+
+	return infos
+}
+
+func (r *recorder) Overrides() []feature_record.Override {
+	now := time.Now()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	overrides := make([]feature_record.Override, 0, len(r.overrides))
+	for _, o := range r.overrides {
+		if o.Until.IsZero() || now.Before(o.Until) {
+			overrides = append(overrides, o)
+		}
+	}
+
+	sort.Slice(overrides, func(i, j int) bool {
+		return overrides[i].Path < overrides[j].Path
+	})
+
+	return overrides
+}
+
+// SetOverride records the stream of o.Path, or stops recording it, right
+// away when published.
+func (r *recorder) SetOverride(o feature_record.Override) error {
+	if !r.settings.Enable {
+		return errors.New("record not enabled")
+	}
+
+	namespace, stream, ok := strings.Cut(strings.Trim(o.Path, "/"), "/")
+	if !ok || namespace == "" || stream == "" {
+		return errors.Errorf("%s is not a namespace/stream path", o.Path)
+	}
+	o.Path = namespace + "/" + stream
+
+	r.lock.Lock()
+	r.overrides[o.Path] = o
+	r.lock.Unlock()
+
+	r.logger.WithField("path", o.Path).WithField("record", o.Record).WithField("until", o.Until).Info("recording override set")
+	metrics.Go("record", r.applySchedules)
+
+	return nil
+}
+
+func (r *recorder) RemoveOverride(path string) bool {
+	path = strings.Trim(path, "/")
+
+	r.lock.Lock()
+	_, ok := r.overrides[path]
+	delete(r.overrides, path)
+	r.lock.Unlock()
+
+	if ok {
+		r.logger.WithField("path", path).Info("recording override removed")
+		metrics.Go("record", r.applySchedules)
+	}
+
+	return ok
+}
@@ -0,0 +1,33 @@
+package record
+
+import (
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/record"
+	"github.com/pkg/errors"
+)
+
+// subscribe joins dest to a stream as a subscriber, until dest is closed.
+func (r *recorder) subscribe(namespace, stream string, dest *record.FrameDestination) error {
+	params := router.PeerParams{
+		RouterID:  stream,
+		Namespace: namespace,
+		URI:       "/" + namespace + "/" + stream,
+		PeerID:    "record",
+		Protocol:  Protocol,
+		HasAudio:  true,
+		HasVideo:  true,
+	}
+
+	session := core.NewSession(dest.Context(), params, r.logger.WithField("stream", stream))
+	if err := session.BindFrameDestination(dest); err != nil {
+		return errors.Wrap(err, "bind frame destination")
+	}
+
+	// the producer of a room stream may still be joining
+	if err := session.Join(); err != nil && !errors.Is(err, router.ErrPaddingDestination) {
+		return errors.Wrap(err, "join")
+	}
+
+	return nil
+}
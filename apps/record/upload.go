@@ -0,0 +1,130 @@
+package record
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	feature_core "github.com/pingostack/neon/features/core"
+	"github.com/pingostack/neon/pkg/record"
+	"github.com/pingostack/neon/pkg/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// an upload taking longer is given up, the file stays
+const defaultUploadTimeout = 30 * time.Minute
+
+// UploadSettings store the finished recordings, their paths relative to the
+// dir after Prefix are the keys. Tags are set on the objects, for the
+// lifecycle rules of a bucket to expire or archive them.
+type UploadSettings struct {
+	Enable           bool `json:"enable" mapstructure:"enable"`
+	storage.Settings `mapstructure:",squash"`
+	Prefix           string            `json:"prefix" mapstructure:"prefix"`
+	Tags             map[string]string `json:"tags" mapstructure:"tags"`
+	// DeleteLocal removes the file once uploaded.
+	DeleteLocal    bool `json:"deleteLocal" mapstructure:"deleteLocal"`
+	TimeoutSeconds int  `json:"timeoutSeconds" mapstructure:"timeoutSeconds"`
+}
+
+func (r *recorder) loadStorage() {
+	if !r.settings.Upload.Enable {
+		return
+	}
+
+	s, err := storage.New(r.settings.Upload.Settings)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to create recording storage, recordings are not uploaded")
+		return
+	}
+
+	r.storage = s
+}
+
+var contentTypes = map[record.Format]string{
+	record.FormatMP4:  "video/mp4",
+	record.FormatMKV:  "video/x-matroska",
+	record.FormatWebM: "video/webm",
+}
+
+// upload stores a finished part of stream, the recording of a room after
+// its post process.
+func (r *recorder) upload(namespace, name string, part record.Recording) {
+	if r.storage == nil {
+		return
+	}
+
+	settings := r.settings.Upload
+	rel, err := filepath.Rel(r.settings.Dir, part.Path)
+	if err != nil {
+		rel = filepath.Base(part.Path)
+	}
+	key := path.Join(settings.Prefix, filepath.ToSlash(rel))
+
+	logger := r.logger.WithFields(logrus.Fields{
+		"file": part.Path,
+		"key":  key,
+	})
+
+	timeout := time.Duration(settings.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultUploadTimeout
+	}
+
+	// uploads started go on when the recorder stops
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	f, err := os.Open(part.Path)
+	if err != nil {
+		logger.WithError(err).Error("failed to upload recording")
+		return
+	}
+	defer f.Close()
+
+	size := int64(-1)
+	if info, err := f.Stat(); err == nil {
+		size = info.Size()
+	}
+
+	started := time.Now()
+	err = r.storage.Put(ctx, key, f, size, storage.PutOptions{
+		ContentType: contentTypes[record.Format(r.settings.Format)],
+		Tags:        settings.Tags,
+	})
+	if err != nil {
+		logger.WithError(err).Error("failed to upload recording")
+		return
+	}
+
+	logger.WithField("took", time.Since(started).String()).Info("recording uploaded")
+
+	deleted := false
+	if settings.DeleteLocal {
+		f.Close()
+		if err := os.Remove(part.Path); err != nil {
+			logger.WithError(err).Warn("failed to delete uploaded recording")
+		} else {
+			deleted = true
+		}
+	}
+	r.uploadedToCatalog(part.Path, key, deleted)
+
+	if r.ee == nil {
+		return
+	}
+
+	r.ee.EmitEvent(feature_core.EventRecordingUploaded, feature_core.Event{
+		Name:      feature_core.EventNameRecordingUploaded,
+		Time:      time.Now(),
+		Namespace: namespace,
+		Stream:    name,
+		Extra: map[string]interface{}{
+			"file": part.Path,
+			"key":  key,
+			"size": size,
+		},
+	})
+}
@@ -0,0 +1,158 @@
+package record
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/record"
+	"github.com/pkg/errors"
+)
+
+// Scheme of recordings played as sources, vod://<file in dir>[?loop=1]
+// [&start=90&end=2m][&scale=4][&speed=2], see record.Player.
+const Scheme = "vod"
+
+// pull publishes a recording, see core.Puller.
+func (r *recorder) pull(ctx context.Context, rawURL string, params router.PeerParams) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.Wrap(err, "parse vod url")
+	}
+
+	path, err := r.recordingPath(u.Host + u.Path)
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, rawURL)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	query := u.Query()
+	player, err := record.NewPlayer(ctx, path, query.Get("loop") == "1", r.logger)
+	if err != nil {
+		return errors.Wrap(err, "open recording")
+	}
+
+	if query.Get("start") != "" || query.Get("end") != "" {
+		span, err := record.ParseStartEnd(query.Get("start"), query.Get("end"))
+		if err != nil {
+			return err
+		}
+
+		if _, err := player.Seek(span); err != nil {
+			return errors.Wrap(err, "seek recording")
+		}
+	}
+
+	if query.Get("scale") != "" || query.Get("speed") != "" {
+		scale, _ := strconv.ParseFloat(query.Get("scale"), 64)
+		speed, _ := strconv.ParseFloat(query.Get("speed"), 64)
+		player.SetRate(scale, speed)
+	}
+
+	params.Producer = true
+	params.Protocol = Scheme
+	params.HasAudio = player.Metadata().HasAudio()
+	params.HasVideo = player.Metadata().HasVideo()
+
+	session := core.NewSession(ctx, params, r.logger.WithField("stream", params.RouterID))
+	if err := session.BindFrameSource(player); err != nil {
+		player.Close()
+		return errors.Wrap(err, "bind frame source")
+	}
+
+	if err := session.Join(); err != nil {
+		session.Finalize(err)
+		return errors.Wrap(err, "join")
+	}
+
+	key := streamKey(params.Namespace, params.RouterID)
+	r.lock.Lock()
+	r.players[key] = player
+	r.lock.Unlock()
+
+	defer func() {
+		r.lock.Lock()
+		if r.players[key] == player {
+			delete(r.players, key)
+		}
+		r.lock.Unlock()
+	}()
+
+	if err := player.Run(); err != nil {
+		return err
+	}
+
+	// the stream stays published after the end, until nobody watches
+	<-ctx.Done()
+
+	return ctx.Err()
+}
+
+// recordingPath is the path of a file in the record dir.
+func (r *recorder) recordingPath(name string) (string, error) {
+	name = filepath.Clean(filepath.FromSlash(name))
+	if name == "." || filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return "", record.ErrInvalidURL
+	}
+
+	return filepath.Join(r.settings.Dir, name), nil
+}
+
+// Recording returns the index of a file in the record dir.
+func (r *recorder) Recording(name string) (*record.Index, error) {
+	path, err := r.recordingPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.catalog != nil {
+		e, err := r.catalog.Get(r.catalogID(path))
+		if err == nil && e.Path == "" {
+			// uploaded and deleted
+			return nil, os.ErrNotExist
+		}
+	}
+
+	return record.LoadIndex(path)
+}
+
+// Seek moves a recording pulled as stream to span, e.g. for the Range of an
+// RTSP PLAY, false when the stream isn't played from a recording.
+func (r *recorder) Seek(namespace, stream string, span record.Span) (record.Position, bool, error) {
+	r.lock.Lock()
+	player := r.players[streamKey(namespace, stream)]
+	r.lock.Unlock()
+
+	if player == nil {
+		return record.Position{}, false, nil
+	}
+
+	pos, err := player.Seek(span)
+
+	return pos, true, err
+}
+
+// SetRate changes the rate a recording pulled as stream is played at, e.g.
+// for the Scale and Speed of an RTSP PLAY. It returns the values applied,
+// false when the stream isn't played from a recording.
+func (r *recorder) SetRate(namespace, stream string, scale, speed float64) (float64, float64, bool) {
+	r.lock.Lock()
+	player := r.players[streamKey(namespace, stream)]
+	r.lock.Unlock()
+
+	if player == nil {
+		return 1, 1, false
+	}
+
+	scale, speed = player.SetRate(scale, speed)
+
+	return scale, speed, true
+}
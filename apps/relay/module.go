@@ -0,0 +1,103 @@
+package relay
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/let-light/gomodule"
+	feature_relay "github.com/pingostack/neon/features/relay"
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/pkg/deliver/relay"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const Scheme = "relay"
+
+var relayModule *relayNode
+
+type RelaySettings struct {
+	// Listen serves local streams to other nodes, empty only pulls.
+	Listen string `json:"listen" mapstructure:"listen"`
+	// Token is shared by all nodes of the cluster, Listen requires one.
+	Token              string `json:"token" mapstructure:"token"`
+	DialTimeoutSeconds int    `json:"dialTimeoutSeconds" mapstructure:"dialTimeoutSeconds"`
+}
+
+type relayNode struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings RelaySettings
+	settings    *RelaySettings
+	logger      *logrus.Entry
+	client      *relay.Client
+}
+
+func init() {
+	relayModule = &relayNode{
+		logger: logrus.WithField("module", "relay"),
+	}
+}
+
+func RelayModule() *relayNode {
+	return relayModule
+}
+
+func (r *relayNode) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	r.ctx = ctx
+	return &r.preSettings, nil
+}
+
+func (r *relayNode) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+func (r *relayNode) ConfigChanged() {
+	if r.settings == nil {
+		r.settings = &r.preSettings
+	}
+
+	// connections are shared by live pulls, the client is only set up once
+	if r.client != nil {
+		return
+	}
+
+	r.client = relay.NewClient(r.ctx, r.settings.Token,
+		time.Duration(r.settings.DialTimeoutSeconds)*time.Second, r.logger)
+	core.RegisterPuller(Scheme, r.pull)
+}
+
+func (r *relayNode) ModuleRun() {
+	defer metrics.Track("relay")()
+
+	if r.settings.Listen == "" {
+		<-r.ctx.Done()
+		return
+	}
+
+	// subscribes don't go through auth, the token is all that guards them
+	if r.settings.Token == "" {
+		r.logger.Error("relay token is empty, relay server not started")
+		<-r.ctx.Done()
+		return
+	}
+
+	ln, err := net.Listen("tcp", r.settings.Listen)
+	if err != nil {
+		r.logger.WithError(err).Error("relay listen failed")
+		return
+	}
+
+	r.logger.WithField("listen", r.settings.Listen).Info("relay server started")
+
+	serv := relay.NewServer(r.ctx, r.settings.Token, r.serve, r.logger)
+	if err := serv.Serve(ln); err != nil {
+		r.logger.WithError(err).Error("relay server failed")
+	}
+}
+
+func (r *relayNode) Type() interface{} {
+	return feature_relay.Type()
+}
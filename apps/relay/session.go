@@ -0,0 +1,85 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/deliver/relay"
+	"github.com/pkg/errors"
+)
+
+// pull republishes relay://host:port/namespace/stream locally, see core.Puller.
+func (r *relayNode) pull(ctx context.Context, rawURL string, params router.PeerParams) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.Wrap(err, "parse relay url")
+	}
+
+	namespace, stream, ok := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	if !ok || namespace == "" || stream == "" {
+		return fmt.Errorf("%w: %s", relay.ErrInvalidURL, rawURL)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	src, err := r.client.Subscribe(ctx, u.Host, namespace, stream)
+	if err != nil {
+		return errors.Wrap(err, "relay subscribe")
+	}
+
+	params.Producer = true
+	params.Protocol = relay.Protocol
+	params.HasAudio = src.Metadata().HasAudio()
+	params.HasVideo = src.Metadata().HasVideo()
+
+	session := core.NewSession(ctx, params, r.logger.WithField("stream", params.RouterID))
+	if err := session.BindFrameSource(src); err != nil {
+		src.Close()
+		return errors.Wrap(err, "bind frame source")
+	}
+
+	if err := session.Join(); err != nil {
+		session.Finalize(err)
+		return errors.Wrap(err, "join")
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-src.Context().Done():
+		return src.Err()
+	}
+}
+
+// serve subscribes another node to a local stream.
+func (r *relayNode) serve(ctx context.Context, conn *relay.Conn, sub relay.Subscribe, dest *relay.FrameDestination) error {
+	params := router.PeerParams{
+		RouterID:   sub.Stream,
+		Namespace:  sub.Namespace,
+		RemoteAddr: conn.RemoteAddr().String(),
+		LocalAddr:  conn.LocalAddr().String(),
+		URI:        "/" + sub.Namespace + "/" + sub.Stream,
+		PeerID:     "relay",
+		Protocol:   relay.Protocol,
+		HasAudio:   true,
+		HasVideo:   true,
+	}
+
+	session := core.NewSession(dest.Context(), params, r.logger.WithField("stream", sub.Stream))
+	if err := session.BindFrameDestination(dest); err != nil {
+		return errors.Wrap(err, "bind frame destination")
+	}
+
+	// a stream without producer yet, e.g. pulled by this node itself, gets the
+	// destination once it is published
+	if err := session.Join(); err != nil && !errors.Is(err, router.ErrPaddingDestination) {
+		return errors.Wrap(err, "join")
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package roq
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	"github.com/let-light/gomodule"
+	feature_roq "github.com/pingostack/neon/features/roq"
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/pkg/certmgr"
+	"github.com/pingostack/neon/pkg/deliver/roq"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const Scheme = "roq"
+
+var roqModule *roqNode
+
+// RoqSettings configure the experimental quic transport, streams are
+// published to and played from Listen, roq:// sources pull from other
+// servers.
+type RoqSettings struct {
+	// Listen is an udp address, empty only pulls.
+	Listen string `json:"listen" mapstructure:"listen"`
+	// Cert and Key are the certificate of the server, the one of the certs
+	// module when empty.
+	Cert  string `json:"cert" mapstructure:"cert"`
+	Key   string `json:"key" mapstructure:"key"`
+	Token string `json:"token" mapstructure:"token"`
+	// Datagrams sends frames as unreliable datagrams, see roq.Options.
+	Datagrams          bool `json:"datagrams" mapstructure:"datagrams"`
+	IdleTimeoutSeconds int  `json:"idleTimeoutSeconds" mapstructure:"idleTimeoutSeconds"`
+	DialTimeoutSeconds int  `json:"dialTimeoutSeconds" mapstructure:"dialTimeoutSeconds"`
+	// InsecureSkipVerify accepts any certificate of pulled servers, e.g.
+	// self-signed ones in a lab.
+	InsecureSkipVerify bool `json:"insecureSkipVerify" mapstructure:"insecureSkipVerify"`
+}
+
+type roqNode struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings RoqSettings
+	settings    *RoqSettings
+	logger      *logrus.Entry
+	client      *roq.Client
+}
+
+func init() {
+	roqModule = &roqNode{
+		logger: logrus.WithField("module", "roq"),
+	}
+}
+
+func RoqModule() *roqNode {
+	return roqModule
+}
+
+func (r *roqNode) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	r.ctx = ctx
+	return &r.preSettings, nil
+}
+
+func (r *roqNode) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+func (r *roqNode) ConfigChanged() {
+	if r.settings == nil {
+		r.settings = &r.preSettings
+	}
+
+	// connections are shared by live pulls, the client is only set up once
+	if r.client != nil {
+		return
+	}
+
+	r.client = roq.NewClient(r.ctx, r.settings.Token,
+		&tls.Config{InsecureSkipVerify: r.settings.InsecureSkipVerify},
+		r.options(), time.Duration(r.settings.DialTimeoutSeconds)*time.Second, r.logger)
+	core.RegisterPuller(Scheme, r.pull)
+}
+
+func (r *roqNode) options() roq.Options {
+	return roq.Options{
+		Datagrams:   r.settings.Datagrams,
+		IdleTimeout: time.Duration(r.settings.IdleTimeoutSeconds) * time.Second,
+	}
+}
+
+func (r *roqNode) ModuleRun() {
+	defer metrics.Track("roq")()
+
+	if r.settings.Listen == "" {
+		<-r.ctx.Done()
+		return
+	}
+
+	tlsConfig, err := r.tlsConfig()
+	if err != nil {
+		r.logger.WithError(err).Error("roq certificate")
+		return
+	}
+
+	serv := roq.NewServer(r.ctx, r.settings.Token, r.options(), roq.Handlers{
+		Publish:   r.publish,
+		Subscribe: r.subscribe,
+	}, r.logger)
+
+	ln, err := serv.Listen(r.settings.Listen, tlsConfig)
+	if err != nil {
+		r.logger.WithError(err).Error("roq listen failed")
+		return
+	}
+
+	r.logger.WithField("listen", r.settings.Listen).Info("roq server started")
+
+	if err := serv.Serve(ln); err != nil {
+		r.logger.WithError(err).Error("roq server failed")
+	}
+}
+
+// tlsConfig serves Cert and Key, or the certificates of the certs module,
+// quic has no plaintext mode.
+func (r *roqNode) tlsConfig() (*tls.Config, error) {
+	if r.settings.Cert != "" || r.settings.Key != "" {
+		kp, err := certmgr.LoadKeyPair(r.settings.Cert, r.settings.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		return &tls.Config{MinVersion: tls.VersionTLS13, GetCertificate: kp.GetCertificate}, nil
+	}
+
+	if !certmgr.Default().Enabled() {
+		return nil, certmgr.ErrNoCertificate
+	}
+
+	return certmgr.Default().TLSConfig(), nil
+}
+
+func (r *roqNode) Type() interface{} {
+	return feature_roq.Type()
+}
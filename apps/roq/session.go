@@ -0,0 +1,112 @@
+package roq
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/deliver/relay"
+	"github.com/pingostack/neon/pkg/deliver/roq"
+	"github.com/pkg/errors"
+	"github.com/quic-go/quic-go"
+)
+
+// pull republishes roq://host:port/namespace/stream locally, see core.Puller.
+func (r *roqNode) pull(ctx context.Context, rawURL string, params router.PeerParams) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.Wrap(err, "parse roq url")
+	}
+
+	namespace, stream, ok := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	if !ok || namespace == "" || stream == "" {
+		return fmt.Errorf("%w: %s", roq.ErrInvalidURL, rawURL)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	src, err := r.client.Subscribe(ctx, u.Host, namespace, stream)
+	if err != nil {
+		return errors.Wrap(err, "roq subscribe")
+	}
+
+	params.Producer = true
+	params.Protocol = roq.Protocol
+	params.HasAudio = src.Metadata().HasAudio()
+	params.HasVideo = src.Metadata().HasVideo()
+
+	session := core.NewSession(ctx, params, r.logger.WithField("stream", params.RouterID))
+	if err := session.BindFrameSource(src); err != nil {
+		src.Close()
+		return errors.Wrap(err, "bind frame source")
+	}
+
+	if err := session.Join(); err != nil {
+		session.Finalize(err)
+		return errors.Wrap(err, "join")
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-src.Context().Done():
+		return src.Err()
+	}
+}
+
+// publish takes a stream pushed by a remote publisher, the session ends with
+// the channel.
+func (r *roqNode) publish(_ context.Context, qc quic.Connection, pub relay.Publish, src *roq.FrameSource) error {
+	params := r.peerParams(qc, pub.Namespace, pub.Stream)
+	params.Producer = true
+	params.HasAudio = src.Metadata().HasAudio()
+	params.HasVideo = src.Metadata().HasVideo()
+
+	session := core.NewSession(src.Context(), params, r.logger.WithField("stream", pub.Stream))
+	if err := session.BindFrameSource(src); err != nil {
+		return errors.Wrap(err, "bind frame source")
+	}
+
+	if err := session.Join(); err != nil {
+		session.Finalize(err)
+		return errors.Wrap(err, "join")
+	}
+
+	return nil
+}
+
+// subscribe plays a local stream to a remote subscriber.
+func (r *roqNode) subscribe(_ context.Context, qc quic.Connection, sub relay.Subscribe, dest *roq.FrameDestination) error {
+	params := r.peerParams(qc, sub.Namespace, sub.Stream)
+	params.HasAudio = true
+	params.HasVideo = true
+
+	session := core.NewSession(dest.Context(), params, r.logger.WithField("stream", sub.Stream))
+	if err := session.BindFrameDestination(dest); err != nil {
+		return errors.Wrap(err, "bind frame destination")
+	}
+
+	// a stream without producer yet gets the destination once it is
+	// published
+	if err := session.Join(); err != nil && !errors.Is(err, router.ErrPaddingDestination) {
+		return errors.Wrap(err, "join")
+	}
+
+	return nil
+}
+
+func (r *roqNode) peerParams(qc quic.Connection, namespace, stream string) router.PeerParams {
+	return router.PeerParams{
+		RouterID:   stream,
+		Namespace:  namespace,
+		RemoteAddr: qc.RemoteAddr().String(),
+		LocalAddr:  qc.LocalAddr().String(),
+		URI:        "/" + namespace + "/" + stream,
+		PeerID:     qc.RemoteAddr().String(),
+		Protocol:   roq.Protocol,
+	}
+}
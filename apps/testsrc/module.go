@@ -0,0 +1,170 @@
+package testsrc
+
+import (
+	"context"
+	"time"
+
+	"github.com/let-light/gomodule"
+	feature_testsrc "github.com/pingostack/neon/features/testsrc"
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/pingostack/neon/pkg/testsrc"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Protocol names the sessions of test signals.
+const Protocol = "testsrc"
+
+// retried after the stream could not be published or ended
+const retryInterval = 5 * time.Second
+
+var testsrcModule *generator
+
+type StreamSettings struct {
+	Namespace string `json:"namespace" mapstructure:"namespace"`
+	Stream    string `json:"stream" mapstructure:"stream"`
+	Width     int    `json:"width" mapstructure:"width"`
+	Height    int    `json:"height" mapstructure:"height"`
+	FPS       int    `json:"fps" mapstructure:"fps"`
+	GOP       int    `json:"gop" mapstructure:"gop"`
+	// Audio is pcmu, pcma or opus, the latter when built with libopus. No
+	// audio when empty.
+	Audio  string `json:"audio" mapstructure:"audio"`
+	ToneHz int    `json:"toneHz" mapstructure:"toneHz"`
+}
+
+type TestsrcSettings struct {
+	Streams []StreamSettings `json:"streams" mapstructure:"streams"`
+}
+
+type generator struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings TestsrcSettings
+	settings    *TestsrcSettings
+	logger      *logrus.Entry
+}
+
+func init() {
+	testsrcModule = &generator{
+		logger: logrus.WithField("module", "testsrc"),
+	}
+}
+
+func TestsrcModule() *generator {
+	return testsrcModule
+}
+
+func (g *generator) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	g.ctx = ctx
+	return &g.preSettings, nil
+}
+
+func (g *generator) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+func (g *generator) ConfigChanged() {
+	if g.settings == nil {
+		g.settings = &g.preSettings
+	}
+}
+
+func (g *generator) ModuleRun() {
+	defer metrics.Track("testsrc")()
+
+	if len(g.settings.Streams) == 0 {
+		return
+	}
+
+	select {
+	case <-core.CoreModule().Ready():
+	case <-g.ctx.Done():
+		return
+	}
+
+	for _, s := range g.settings.Streams {
+		s := s
+		metrics.Go("testsrc", func() { g.serve(s) })
+	}
+
+	<-g.ctx.Done()
+}
+
+func (g *generator) Type() interface{} {
+	return feature_testsrc.Type()
+}
+
+// serve publishes the test signal of s until the module stops.
+func (g *generator) serve(s StreamSettings) {
+	logger := g.logger.WithField("stream", s.Namespace+"/"+s.Stream)
+	for {
+		err := g.publish(s, logger)
+		if g.ctx.Err() != nil {
+			return
+		}
+
+		logger.WithError(err).Warn("test signal ended, republishing")
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+func (g *generator) publish(s StreamSettings, logger *logrus.Entry) error {
+	ctx, cancel := context.WithCancel(g.ctx)
+	defer cancel()
+
+	audio := deliver.CodecTypeNone
+	if s.Audio != "" {
+		if audio = deliver.ConvCodecType(s.Audio); audio == deliver.CodecTypeNone {
+			return errors.Errorf("unknown audio codec %s", s.Audio)
+		}
+	}
+
+	src, err := testsrc.NewSource(ctx, testsrc.Options{
+		Width:  s.Width,
+		Height: s.Height,
+		FPS:    s.FPS,
+		GOP:    s.GOP,
+		Audio:  audio,
+		ToneHz: s.ToneHz,
+	}, logger)
+	if err != nil {
+		return errors.Wrap(err, "test signal")
+	}
+
+	params := router.PeerParams{
+		RouterID:  s.Stream,
+		Namespace: s.Namespace,
+		URI:       "/" + s.Namespace + "/" + s.Stream,
+		PeerID:    Protocol,
+		Protocol:  Protocol,
+		Producer:  true,
+		HasAudio:  src.Metadata().HasAudio(),
+		HasVideo:  true,
+	}
+
+	session := core.NewSession(ctx, params, logger)
+	if err := session.BindFrameSource(src); err != nil {
+		src.Close()
+		return errors.Wrap(err, "bind frame source")
+	}
+
+	if err := session.Join(); err != nil {
+		session.Finalize(err)
+		return errors.Wrap(err, "join")
+	}
+
+	logger.Info("test signal published")
+
+	<-src.Context().Done()
+
+	return errors.New("source closed")
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/let-light/gomodule"
 	feature_whip "github.com/pingostack/neon/features/whip"
 	"github.com/pingostack/neon/internal/httpserv"
+	"github.com/pingostack/neon/pkg/metrics"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -57,6 +58,8 @@ func (whip *whip) ConfigChanged() {
 }
 
 func (whip *whip) ModuleRun() {
+	defer metrics.Track("whip")()
+
 	whip.serv = NewSignalServer(whip.ctx, whip.settings.HttpParams, whip.logger)
 	if err := whip.serv.Start(); err != nil {
 		whip.logger.Errorf("whip start error: %v", err)
@@ -6,19 +6,30 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/gogf/gf/util/guid"
 	"github.com/let-light/gomodule"
+	feature_auth "github.com/pingostack/neon/features/auth"
+	feature_cluster "github.com/pingostack/neon/features/cluster"
 	feature_rtc "github.com/pingostack/neon/features/rtc"
 	"github.com/pingostack/neon/internal/core/router"
 	"github.com/pingostack/neon/internal/httpserv"
 	inter_rtc "github.com/pingostack/neon/internal/rtc"
+	"github.com/pingostack/neon/pkg/acl"
+	"github.com/pingostack/neon/pkg/auth"
 	"github.com/pingostack/neon/pkg/deliver/rtc"
+	"github.com/pingostack/neon/pkg/eventbus"
+	"github.com/pingostack/neon/pkg/rtclib/sdpassistor"
+	"github.com/pingostack/neon/pkg/trace"
+	"github.com/pingostack/neon/pkg/vhost"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
 type SignalServer struct {
@@ -27,6 +38,12 @@ type SignalServer struct {
 	logger     *logrus.Entry
 	httpParams httpserv.HttpParams
 	rtc        feature_rtc.Feature
+	auth       feature_auth.Feature
+	cluster    feature_cluster.Feature
+	// moved maps sessions ended by a drain to where their viewers went
+	moved sync.Map
+	// subscribers are the joined whep sessions by their resource secret
+	subscribers sync.Map
 }
 
 func NewSignalServer(ctx context.Context, httpParams httpserv.HttpParams, logger *logrus.Entry) *SignalServer {
@@ -41,6 +58,14 @@ func NewSignalServer(ctx context.Context, httpParams httpserv.HttpParams, logger
 		ss.rtc = rtc
 	})
 
+	gomodule.RequireFeatures(func(auth feature_auth.Feature) {
+		ss.auth = auth
+	})
+
+	gomodule.RequireFeatures(func(cluster feature_cluster.Feature) {
+		ss.cluster = cluster
+	})
+
 	return ss
 }
 
@@ -61,6 +86,7 @@ func (ss *SignalServer) Start() error {
 		AllowCredentials: true,
 	}
 
+	ss.ss.DefaultRouter().Use(httpserv.ACLCheckHandler("whip"))
 	ss.ss.DefaultRouter().Use(cors.New(corsConfig))
 	ss.ss.DefaultRouter().RedirectTrailingSlash = false
 
@@ -145,13 +171,94 @@ func (ss *SignalServer) handlePost(gc *gin.Context) {
 
 	routerID := fmt.Sprint(app, "/", stream)
 
+	action := auth.ActionPlay
 	if typ == "whip" {
-		ss.handlePostWhip(gc, routerID)
+		action = auth.ActionPublish
+	}
+
+	id, err := ss.authenticate(gc, routerID, action)
+	if err != nil {
+		gc.Writer.Header().Set("WWW-Authenticate", "Bearer")
+		gc.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if typ == "whep" && ss.redirect(gc) {
+		return
+	}
+
+	if ss.cluster != nil && ss.cluster.Draining() {
+		gc.Writer.Header().Set("Retry-After", "5")
+		gc.JSON(http.StatusServiceUnavailable, gin.H{"error": router.ErrDraining.Error()})
+		return
+	}
+
+	tenant := ""
+	if id != nil {
+		tenant = id.Tenant
+	}
+
+	if typ == "whip" {
+		err = ss.handlePostWhip(gc, routerID, tenant)
 	} else {
-		ss.handlePostWhep(gc, routerID)
+		err = ss.handlePostWhep(gc, routerID, tenant)
+	}
+
+	var offerErr *sdpassistor.OfferError
+	switch {
+	case err == nil:
+	case errors.As(err, &offerErr):
+		gc.JSON(http.StatusBadRequest, gin.H{"error": offerErr.Error(), "offer": offerErr})
+	case errors.Is(err, vhost.ErrQuotaExceeded), errors.Is(err, acl.ErrTooManyConnections),
+		errors.Is(err, acl.ErrDenied), errors.Is(err, acl.ErrBanned):
+		gc.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, router.ErrStreamPublished):
+		gc.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 	}
 }
 
+func (ss *SignalServer) authenticate(gc *gin.Context, routerID string, action auth.Action) (*auth.Identity, error) {
+	if ss.auth == nil || !ss.auth.Enabled() {
+		return nil, nil
+	}
+
+	token := auth.BearerToken(gc.Request.Header)
+	if token == "" {
+		token = auth.TokenFromURL(gc.Request.URL)
+	}
+
+	return ss.auth.Authenticate(gc.Request.Context(), &auth.Request{
+		Protocol:   auth.ProtocolWebRTC,
+		Action:     action,
+		Path:       routerID,
+		Host:       gc.Request.Host,
+		RemoteAddr: gc.Request.RemoteAddr,
+		Token:      token,
+		Args:       auth.ArgsFromURL(gc.Request.URL),
+	})
+}
+
+// redirect sends a new subscriber to a less loaded node of the cluster.
+func (ss *SignalServer) redirect(gc *gin.Context) bool {
+	if ss.cluster == nil {
+		return false
+	}
+
+	base, ok := ss.cluster.RedirectTarget(feature_cluster.ProtocolWHEP)
+	if !ok {
+		return false
+	}
+
+	location := strings.TrimSuffix(base, "/") + gc.Request.URL.RequestURI()
+	ss.logger.WithField("location", location).Info("whep redirected")
+	gc.Writer.Header().Set("Access-Control-Expose-Headers", "Location")
+	gc.Redirect(http.StatusTemporaryRedirect, location)
+
+	return true
+}
+
 func sessionLocation(publish bool, secret string) string {
 	ret := ""
 	if publish {
@@ -163,7 +270,14 @@ func sessionLocation(publish bool, secret string) string {
 	return ret
 }
 
-func (ss *SignalServer) handlePostWhip(gc *gin.Context, routerID string) error {
+func (ss *SignalServer) handlePostWhip(gc *gin.Context, routerID, tenant string) (err error) {
+	ctx, span := trace.Start(trace.Extract(ss.ctx, gc.Request.Header), "whip.publish",
+		oteltrace.WithSpanKind(oteltrace.SpanKindServer),
+		oteltrace.WithAttributes(attribute.String("stream", routerID)))
+	defer func() {
+		trace.RecordError(span, err)
+		span.End()
+	}()
 
 	peerID := guid.S()
 
@@ -178,15 +292,18 @@ func (ss *SignalServer) handlePostWhip(gc *gin.Context, routerID string) error {
 		domain = sp[0]
 	}
 
-	s := rtc.NewServSession(ss.ctx, inter_rtc.StreamFactory(), router.PeerParams{
+	s := rtc.NewServSession(ctx, inter_rtc.StreamFactory(), router.PeerParams{
 		RemoteAddr: gc.Request.RemoteAddr,
 		LocalAddr:  gc.Request.Host,
+		Protocol:   eventbus.ProtocolWebRTC,
 		PeerID:     peerID,
 		RouterID:   routerID,
 		Domain:     domain,
+		Tenant:     tenant,
 		URI:        gc.Request.URL.Path,
 		Producer:   true,
 	}, logger)
+	s.SetACL(acl.For("whip"))
 
 	sdpOffer, err := io.ReadAll(gc.Request.Body)
 	if err != nil {
@@ -213,7 +330,15 @@ func (ss *SignalServer) handlePostWhip(gc *gin.Context, routerID string) error {
 	return nil
 }
 
-func (ss *SignalServer) handlePostWhep(gc *gin.Context, routerID string) error {
+func (ss *SignalServer) handlePostWhep(gc *gin.Context, routerID, tenant string) (err error) {
+	ctx, span := trace.Start(trace.Extract(ss.ctx, gc.Request.Header), "whep.subscribe",
+		oteltrace.WithSpanKind(oteltrace.SpanKindServer),
+		oteltrace.WithAttributes(attribute.String("stream", routerID)))
+	defer func() {
+		trace.RecordError(span, err)
+		span.End()
+	}()
+
 	peerID := guid.S()
 
 	logger := ss.logger.WithFields(logrus.Fields{
@@ -221,15 +346,19 @@ func (ss *SignalServer) handlePostWhep(gc *gin.Context, routerID string) error {
 		"router":  routerID,
 	})
 
-	s := rtc.NewServSession(ss.ctx, inter_rtc.StreamFactory(), router.PeerParams{
+	s := rtc.NewServSession(ctx, inter_rtc.StreamFactory(), router.PeerParams{
 		RemoteAddr: gc.Request.RemoteAddr,
 		LocalAddr:  gc.Request.Host,
+		Protocol:   eventbus.ProtocolWebRTC,
 		PeerID:     peerID,
 		RouterID:   routerID,
 		Domain:     gc.Request.Host,
+		Tenant:     tenant,
 		URI:        gc.Request.URL.Path,
+		Args:       auth.ArgsFromURL(gc.Request.URL),
 		Producer:   true,
 	}, logger)
+	s.SetACL(acl.For("whip"))
 
 	sdpOffer, err := io.ReadAll(gc.Request.Body)
 	if err != nil {
@@ -244,16 +373,108 @@ func (ss *SignalServer) handlePostWhep(gc *gin.Context, routerID string) error {
 
 	logger.WithField("answer", lsdp.SDP).Debug("resp answer")
 
+	go ss.watchMove(s.Context(), peerID, gc.Request.URL.RequestURI())
+
+	ss.subscribers.Store(peerID, s)
+	go func() {
+		<-s.Context().Done()
+		ss.subscribers.Delete(peerID)
+	}()
+
+	gc.Writer.Header().Set("Access-Control-Expose-Headers", "ID, Location, Accept-Patch")
+	gc.Writer.Header().Set("ID", peerID)
+	gc.Writer.Header().Set("Accept-Patch", "application/sdp")
+	gc.Writer.Header().Set("Location", sessionLocation(false, peerID))
 	gc.String(http.StatusOK, lsdp.SDP)
 
 	return nil
 }
 
+// movedTTL is how long the resource of a drained session points to its new
+// node.
+const movedTTL = time.Minute
+
+// watchMove remembers where the viewer of a session ended by a drain
+// continues, requests to the session resource are redirected there.
+func (ss *SignalServer) watchMove(ctx context.Context, peerID, uri string) {
+	<-ctx.Done()
+
+	if ss.cluster == nil || !ss.cluster.Draining() {
+		return
+	}
+
+	base, ok := ss.cluster.RedirectTarget(feature_cluster.ProtocolWHEP)
+	if !ok {
+		return
+	}
+
+	ss.moved.Store(peerID, strings.TrimSuffix(base, "/")+uri)
+	time.AfterFunc(movedTTL, func() {
+		ss.moved.Delete(peerID)
+	})
+}
+
+// terminated answers requests to the resource of a session moved by a drain.
+func (ss *SignalServer) terminated(gc *gin.Context, secret string) bool {
+	location, ok := ss.moved.Load(secret)
+	if !ok {
+		return false
+	}
+
+	gc.Writer.Header().Set("Access-Control-Expose-Headers", "Location")
+	gc.Redirect(http.StatusTemporaryRedirect, location.(string))
+
+	return true
+}
+
 func (ss *SignalServer) handlePatch(gc *gin.Context, secret string) {
+	if ss.terminated(gc, secret) {
+		return
+	}
+
+	// a new offer renegotiates the media of a subscriber
+	if strings.HasPrefix(gc.ContentType(), "application/sdp") {
+		ss.handleRenegotiate(gc, secret)
+		return
+	}
+
 	ss.logger.Infof("handlePatch")
 }
 
+func (ss *SignalServer) handleRenegotiate(gc *gin.Context, secret string) {
+	v, ok := ss.subscribers.Load(secret)
+	if !ok {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	s := v.(*rtc.ServSession)
+
+	sdpOffer, err := io.ReadAll(gc.Request.Body)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sdp offer"})
+		return
+	}
+
+	lsdp, err := s.Renegotiate(string(sdpOffer), 4*time.Second)
+	if err != nil {
+		var offerErr *sdpassistor.OfferError
+		if errors.As(err, &offerErr) {
+			gc.JSON(http.StatusBadRequest, gin.H{"error": offerErr.Error(), "offer": offerErr})
+			return
+		}
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	gc.Writer.Header().Set("Content-Type", "application/sdp")
+	gc.String(http.StatusOK, lsdp.SDP)
+}
+
 func (ss *SignalServer) handleDelete(gc *gin.Context, secret string) {
+	if ss.terminated(gc, secret) {
+		return
+	}
+
 	ss.logger.Infof("handleDelete")
 
 }
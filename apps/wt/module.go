@@ -0,0 +1,111 @@
+package wt
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	"github.com/let-light/gomodule"
+	feature_wt "github.com/pingostack/neon/features/wt"
+	"github.com/pingostack/neon/pkg/certmgr"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var wtModule *wtNode
+
+// WtSettings configure webtransport playback, players open
+// https://host/wt/<app>/<stream>?format=fmp4|raw on Listen.
+type WtSettings struct {
+	// Listen is an udp address, empty disables the endpoint.
+	Listen string `json:"listen" mapstructure:"listen"`
+	// Cert and Key are the certificate of the server, the one of the certs
+	// module when empty.
+	Cert string `json:"cert" mapstructure:"cert"`
+	Key  string `json:"key" mapstructure:"key"`
+	// AllowOrigin are the pages allowed to play, "*" any, only pages of the
+	// server itself when empty.
+	AllowOrigin          []string `json:"allowOrigin" mapstructure:"allowOrigin"`
+	FragmentMilliseconds int      `json:"fragmentMilliseconds" mapstructure:"fragmentMilliseconds"`
+}
+
+type wtNode struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings WtSettings
+	settings    *WtSettings
+	logger      *logrus.Entry
+}
+
+func init() {
+	wtModule = &wtNode{
+		logger: logrus.WithField("module", "webtransport"),
+	}
+}
+
+func WtModule() *wtNode {
+	return wtModule
+}
+
+func (w *wtNode) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	w.ctx = ctx
+	return &w.preSettings, nil
+}
+
+func (w *wtNode) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+func (w *wtNode) ConfigChanged() {
+	if w.settings == nil {
+		w.settings = &w.preSettings
+	}
+}
+
+func (w *wtNode) ModuleRun() {
+	defer metrics.Track("webtransport")()
+
+	if w.settings.Listen == "" {
+		<-w.ctx.Done()
+		return
+	}
+
+	tlsConfig, err := w.tlsConfig()
+	if err != nil {
+		w.logger.WithError(err).Error("webtransport certificate")
+		return
+	}
+
+	serv := NewServer(w.ctx, w.settings.Listen, tlsConfig, w.settings.AllowOrigin,
+		time.Duration(w.settings.FragmentMilliseconds)*time.Millisecond, w.logger)
+
+	w.logger.WithField("listen", w.settings.Listen).Info("webtransport server started")
+
+	if err := serv.ListenAndServe(); err != nil {
+		w.logger.WithError(err).Error("webtransport server failed")
+	}
+}
+
+// tlsConfig serves Cert and Key, or the certificates of the certs module,
+// http/3 has no plaintext mode.
+func (w *wtNode) tlsConfig() (*tls.Config, error) {
+	if w.settings.Cert != "" || w.settings.Key != "" {
+		kp, err := certmgr.LoadKeyPair(w.settings.Cert, w.settings.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		return &tls.Config{MinVersion: tls.VersionTLS13, GetCertificate: kp.GetCertificate}, nil
+	}
+
+	if !certmgr.Default().Enabled() {
+		return nil, certmgr.ErrNoCertificate
+	}
+
+	return certmgr.Default().TLSConfig(), nil
+}
+
+func (w *wtNode) Type() interface{} {
+	return feature_wt.Type()
+}
@@ -0,0 +1,201 @@
+package wt
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gogf/gf/util/guid"
+	"github.com/let-light/gomodule"
+	feature_auth "github.com/pingostack/neon/features/auth"
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/auth"
+	"github.com/pingostack/neon/pkg/deliver/wt"
+	"github.com/pkg/errors"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
+	"github.com/sirupsen/logrus"
+)
+
+// PathPrefix is where players connect, /wt/<app>/<stream>.
+const PathPrefix = "/wt/"
+
+// Server plays streams to webtransport sessions. It is plain net/http, the
+// upgrade needs the response writer of http3 that gin wraps.
+type Server struct {
+	ctx      context.Context
+	wts      *webtransport.Server
+	fragment time.Duration
+	auth     feature_auth.Feature
+	logger   *logrus.Entry
+}
+
+func NewServer(ctx context.Context, addr string, tlsConfig *tls.Config, allowOrigin []string, fragment time.Duration, logger *logrus.Entry) *Server {
+	s := &Server{
+		ctx:      ctx,
+		fragment: fragment,
+		logger:   logger,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(PathPrefix, s.handlePlay)
+
+	s.wts = &webtransport.Server{
+		H3: http3.Server{
+			Addr:      addr,
+			TLSConfig: tlsConfig,
+			Handler:   mux,
+		},
+	}
+	if len(allowOrigin) > 0 {
+		s.wts.CheckOrigin = checkOrigin(allowOrigin)
+	}
+
+	gomodule.RequireFeatures(func(auth feature_auth.Feature) {
+		s.auth = auth
+	})
+
+	return s
+}
+
+// ListenAndServe runs until the server fails or its context is done.
+func (s *Server) ListenAndServe() error {
+	go func() {
+		<-s.ctx.Done()
+		s.wts.Close()
+	}()
+
+	err := s.wts.ListenAndServe()
+	if s.ctx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
+
+func checkOrigin(allowed []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		for _, o := range allowed {
+			if o == "*" || strings.EqualFold(o, origin) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// handlePlay serves /wt/<app>/<stream>?format=fmp4|raw.
+func (s *Server) handlePlay(w http.ResponseWriter, r *http.Request) {
+	app, stream, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, PathPrefix), "/")
+	if !ok || app == "" || stream == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	format := wt.Format(r.URL.Query().Get("format"))
+	switch format {
+	case "":
+		format = wt.FormatFMP4
+	case wt.FormatFMP4, wt.FormatRaw:
+	default:
+		http.Error(w, wt.ErrUnsupportedFormat.Error(), http.StatusBadRequest)
+		return
+	}
+
+	routerID := app + "/" + stream
+	tenant, err := s.authenticate(r, routerID)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	session, err := s.wts.Upgrade(w, r)
+	if err != nil {
+		s.logger.WithError(err).Warn("webtransport upgrade failed")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := s.play(session, r, routerID, tenant, format); err != nil {
+		s.logger.WithError(err).WithField("router", routerID).Warn("webtransport play failed")
+		session.CloseWithError(0, err.Error())
+	}
+}
+
+func (s *Server) play(session *webtransport.Session, r *http.Request, routerID, tenant string, format wt.Format) error {
+	peerID := guid.S()
+	logger := s.logger.WithFields(logrus.Fields{
+		"session": peerID,
+		"router":  routerID,
+		"format":  format,
+	})
+
+	domain, _, _ := strings.Cut(r.Host, ":")
+	dest := wt.NewFrameDestination(s.ctx, session, wt.Options{
+		Format:           format,
+		FragmentDuration: s.fragment,
+	}, logger)
+
+	cs := core.NewSession(dest.Context(), router.PeerParams{
+		RemoteAddr: session.RemoteAddr().String(),
+		LocalAddr:  session.LocalAddr().String(),
+		Protocol:   wt.Protocol,
+		PeerID:     peerID,
+		RouterID:   routerID,
+		Domain:     domain,
+		Tenant:     tenant,
+		URI:        r.URL.Path,
+		HasAudio:   true,
+		HasVideo:   true,
+	}, logger)
+	if err := cs.BindFrameDestination(dest); err != nil {
+		dest.Close()
+		return errors.Wrap(err, "bind frame destination")
+	}
+
+	// a stream without producer yet gets the player once it is published
+	if err := cs.Join(); err != nil && !errors.Is(err, router.ErrPaddingDestination) {
+		cs.Finalize(err)
+		return errors.Wrap(err, "join")
+	}
+
+	logger.Info("webtransport player joined")
+
+	return nil
+}
+
+func (s *Server) authenticate(r *http.Request, routerID string) (string, error) {
+	if s.auth == nil || !s.auth.Enabled() {
+		return "", nil
+	}
+
+	token := auth.BearerToken(r.Header)
+	if token == "" {
+		token = auth.TokenFromURL(r.URL)
+	}
+
+	id, err := s.auth.Authenticate(r.Context(), &auth.Request{
+		Protocol:   auth.ProtocolWebTransport,
+		Action:     auth.ActionPlay,
+		Path:       routerID,
+		Host:       r.Host,
+		RemoteAddr: r.RemoteAddr,
+		Token:      token,
+		Args:       auth.ArgsFromURL(r.URL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if id == nil {
+		return "", nil
+	}
+
+	return id.Tenant, nil
+}
@@ -2,26 +2,51 @@ package main
 
 import (
 	"context"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/let-light/gomodule"
-	"github.com/pingostack/neon/apps/pms"
-	"github.com/pingostack/neon/apps/whip"
-	"github.com/pingostack/neon/internal/core"
-	"github.com/pingostack/neon/internal/rtc"
+	"github.com/pingostack/neon"
+	"github.com/pingostack/neon/apps/cluster"
+	"github.com/pingostack/neon/internal/bench"
 	"github.com/sirupsen/logrus"
 )
 
 func serv(ctx context.Context) {
-	gomodule.RegisterDefaultModules()
-	gomodule.RegisterWithName(whip.WhipModule(), "whip")
-	gomodule.RegisterWithName(pms.PMSModule(), "pms")
-	gomodule.RegisterWithName(core.CoreModule(), "core")
-	gomodule.RegisterWithName(rtc.RtcModule(), "webrtc")
+	neon.RegisterModules()
+	gomodule.GetRootCmd().AddCommand(bench.Command())
 	gomodule.Launch(ctx)
 
+	go drainOnSignal(ctx)
+
 	gomodule.Wait()
 }
 
+// drainOnSignal moves sessions to other nodes before exiting on SIGTERM.
+// gomodule stops all modules on SIGTERM right away, its handler is replaced
+// once the modules run.
+func drainOnSignal(ctx context.Context) {
+	if !cluster.ClusterModule().DrainOnSignal() {
+		return
+	}
+
+	signal.Reset(syscall.SIGTERM)
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGTERM)
+
+	<-ch
+	// a second SIGTERM exits right away
+	signal.Stop(ch)
+
+	logrus.Info("SIGTERM received, draining")
+	if err := cluster.ClusterModule().Drain(ctx); err != nil {
+		logrus.WithError(err).Warn("drain incomplete")
+	}
+
+	gomodule.Stop()
+}
+
 func main() {
 	defer func() {
 		if err := recover(); err != nil {
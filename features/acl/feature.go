@@ -0,0 +1,11 @@
+package feature_acl
+
+import "github.com/let-light/gomodule"
+
+type Feature interface {
+	gomodule.IModule
+}
+
+func Type() interface{} {
+	return (*Feature)(nil)
+}
@@ -0,0 +1,22 @@
+package feature_auth
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/let-light/gomodule"
+	"github.com/pingostack/neon/pkg/auth"
+)
+
+type Feature interface {
+	gomodule.IModule
+	Enabled() bool
+	Realm() string
+	Authenticate(ctx context.Context, req *auth.Request) (*auth.Identity, error)
+	SignURL(action auth.Action, streamPath string, ttl time.Duration, ip string) (url.Values, error)
+}
+
+func Type() interface{} {
+	return (*Feature)(nil)
+}
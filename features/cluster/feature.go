@@ -0,0 +1,29 @@
+package feature_cluster
+
+import (
+	"context"
+
+	"github.com/let-light/gomodule"
+	"github.com/pingostack/neon/pkg/registry"
+)
+
+const (
+	ProtocolRTSP = "rtsp"
+	ProtocolWHEP = "whep"
+)
+
+type Feature interface {
+	gomodule.IModule
+	Streams(ctx context.Context) ([]registry.Entry, error)
+	// RedirectTarget returns the base url new subscribers of protocol are
+	// redirected to, false serves them here.
+	RedirectTarget(protocol string) (string, bool)
+	// Drain refuses new sessions and moves the viewers of this node to
+	// peers, it returns once they left or ctx is done.
+	Drain(ctx context.Context) error
+	Draining() bool
+}
+
+func Type() interface{} {
+	return (*Feature)(nil)
+}
@@ -0,0 +1,54 @@
+package feature_event
+
+import (
+	"time"
+
+	"github.com/pingostack/neon/pkg/eventemitter"
+)
+
+var (
+	EventStreamPublished    = eventemitter.GenEventID()
+	EventStreamEnded        = eventemitter.GenEventID()
+	EventClientConnected    = eventemitter.GenEventID()
+	EventClientDisconnected = eventemitter.GenEventID()
+	EventRecordingFinished  = eventemitter.GenEventID()
+	EventAuthFailed         = eventemitter.GenEventID()
+	EventStreamFailover     = eventemitter.GenEventID()
+	EventStreamFailback     = eventemitter.GenEventID()
+	EventViewersThreshold   = eventemitter.GenEventID()
+	EventGOPExceeded        = eventemitter.GenEventID()
+	EventStreamUnhealthy    = eventemitter.GenEventID()
+	EventStreamRecovered    = eventemitter.GenEventID()
+	EventStreamQuarantined  = eventemitter.GenEventID()
+	EventRecordingUploaded  = eventemitter.GenEventID()
+)
+
+const (
+	EventNameStreamPublished    = "stream_published"
+	EventNameStreamEnded        = "stream_ended"
+	EventNameClientConnected    = "client_connected"
+	EventNameClientDisconnected = "client_disconnected"
+	EventNameRecordingFinished  = "recording_finished"
+	EventNameAuthFailed         = "auth_failed"
+	EventNameStreamFailover     = "stream_failover"
+	EventNameStreamFailback     = "stream_failback"
+	EventNameViewersThreshold   = "viewers_threshold"
+	EventNameGOPExceeded        = "gop_exceeded"
+	EventNameStreamUnhealthy    = "stream_unhealthy"
+	EventNameStreamRecovered    = "stream_recovered"
+	EventNameStreamQuarantined  = "stream_quarantined"
+	EventNameRecordingUploaded  = "recording_uploaded"
+)
+
+// Event is the payload emitted for all core events.
+type Event struct {
+	Name       string                 `json:"event"`
+	Time       time.Time              `json:"time"`
+	Namespace  string                 `json:"namespace,omitempty"`
+	Stream     string                 `json:"stream,omitempty"`
+	Session    string                 `json:"session,omitempty"`
+	RemoteAddr string                 `json:"remoteAddr,omitempty"`
+	Producer   bool                   `json:"producer"`
+	Reason     string                 `json:"reason,omitempty"`
+	Extra      map[string]interface{} `json:"extra,omitempty"`
+}
@@ -1,9 +1,21 @@
 package feature_event
 
-import "github.com/let-light/gomodule"
+import (
+	"github.com/let-light/gomodule"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/eventemitter"
+)
 
 type Feature interface {
 	gomodule.IModule
+	Namespaces() []*router.Namespace
+	Sessions() []router.Session
+	LookupSession(id string) (router.Session, bool)
+	LookupRouter(namespace, id string) (router.Router, bool)
+	// Pull publishes url as stream of namespace until StopPull.
+	Pull(namespace, stream, url string) error
+	StopPull(namespace, stream string) bool
+	EventEmitter() eventemitter.EventEmitter
 }
 
 func Type() interface{} {
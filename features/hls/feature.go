@@ -0,0 +1,27 @@
+package feature_hls
+
+import (
+	"context"
+
+	"github.com/let-light/gomodule"
+	"github.com/pingostack/neon/pkg/hls"
+)
+
+type Feature interface {
+	gomodule.IModule
+	// Method is how segments are encrypted, hls.MethodNone when they aren't.
+	Method() hls.Method
+	// SegmentKey returns the key a segment of stream is encrypted with and
+	// the EXT-X-KEY line preceding it in the playlist.
+	SegmentKey(ctx context.Context, stream string, sequence uint64) (*hls.Key, string, error)
+	// EncryptSegment encrypts a muxed segment of stream for AES-128 and
+	// returns it with its EXT-X-KEY line, as is for other methods.
+	EncryptSegment(ctx context.Context, stream string, sequence uint64, segment []byte) ([]byte, string, error)
+	// SampleEncrypter encrypts the samples of a segment of stream while it
+	// is muxed for SAMPLE-AES, nil for other methods.
+	SampleEncrypter(ctx context.Context, stream string, sequence uint64) (*hls.SampleEncrypter, string, error)
+}
+
+func Type() interface{} {
+	return (*Feature)(nil)
+}
@@ -0,0 +1,16 @@
+package feature_logging
+
+import (
+	"github.com/let-light/gomodule"
+	"github.com/pingostack/neon/pkg/logger"
+)
+
+type Feature interface {
+	gomodule.IModule
+	// Tail returns up to n of the last log lines, the oldest first.
+	Tail(n int) []logger.TailEntry
+}
+
+func Type() interface{} {
+	return (*Feature)(nil)
+}
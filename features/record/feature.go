@@ -0,0 +1,67 @@
+package feature_record
+
+import (
+	"time"
+
+	"github.com/let-light/gomodule"
+	"github.com/pingostack/neon/pkg/record"
+	"github.com/pingostack/neon/pkg/record/catalog"
+)
+
+// ScheduleInfo is a recording schedule and whether its window is open.
+type ScheduleInfo struct {
+	Streams         []string   `json:"streams"`
+	Start           string     `json:"start"`
+	DurationMinutes int        `json:"durationMinutes"`
+	Except          []string   `json:"except"`
+	Timezone        string     `json:"timezone"`
+	Active          bool       `json:"active"`
+	Until           *time.Time `json:"until,omitempty"`
+	Next            *time.Time `json:"next,omitempty"`
+}
+
+// Override records a stream, or keeps it from being recorded, whatever the
+// schedules say. Until zero lasts until removed.
+type Override struct {
+	Path   string    `json:"path"`
+	Record bool      `json:"record"`
+	Until  time.Time `json:"until"`
+}
+
+// Clip is an mp4 cut from recordings, File is the name to download it by
+// and Key the object of its upload.
+type Clip struct {
+	File     string    `json:"file,omitempty"`
+	Key      string    `json:"key,omitempty"`
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"duration"`
+	Size     int64     `json:"size"`
+}
+
+type Feature interface {
+	gomodule.IModule
+	// Recording returns the index of a file of the record dir.
+	Recording(name string) (*record.Index, error)
+	// Seek and SetRate move and speed up recordings pulled as streams,
+	// false when the stream isn't played from one.
+	Seek(namespace, stream string, span record.Span) (record.Position, bool, error)
+	SetRate(namespace, stream string, scale, speed float64) (float64, float64, bool)
+	// Schedules start and stop the recordings of the streams they match,
+	// overrides of a namespace/stream path take precedence.
+	Schedules() []ScheduleInfo
+	Overrides() []Override
+	SetOverride(o Override) error
+	RemoveOverride(path string) bool
+	// Recordings are kept in a catalog, DeleteRecording removes one with its
+	// file and upload.
+	Recordings(f catalog.Filter) ([]catalog.Entry, error)
+	DeleteRecording(id string) error
+	// ExportClip cuts the recordings of a stream from from to to, on
+	// keyframes and without re-encoding.
+	ExportClip(namespace, stream string, from, to time.Time, upload bool) (Clip, error)
+	ClipPath(name string) (string, error)
+}
+
+func Type() interface{} {
+	return (*Feature)(nil)
+}
@@ -3,11 +3,15 @@ package feature_rtc
 import (
 	"github.com/let-light/gomodule"
 
+	deliver_rtc "github.com/pingostack/neon/pkg/deliver/rtc"
 	rtc_conf "github.com/pingostack/neon/pkg/rtclib/config"
 )
 
 type Settings struct {
-	DefaultSettings rtc_conf.Settings `json:"default" mapstructure:"default" yaml:"default"`
+	DefaultSettings rtc_conf.Settings              `json:"default" mapstructure:"default" yaml:"default"`
+	Congestion      deliver_rtc.CongestionSettings `json:"congestion" mapstructure:"congestion" yaml:"congestion"`
+	FEC             deliver_rtc.FECSettings        `json:"fec" mapstructure:"fec" yaml:"fec"`
+	RED             deliver_rtc.REDSettings        `json:"red" mapstructure:"red" yaml:"red"`
 }
 
 type Feature interface {
@@ -0,0 +1,121 @@
+package neon
+
+import (
+	"context"
+
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Protocol is the protocol of the sessions of the application, in events and
+// the admin api.
+const Protocol = "embed"
+
+type (
+	Session   = router.Session
+	Stream    = router.Router
+	Namespace = router.Namespace
+)
+
+// StreamParams name the stream a session joins.
+type StreamParams struct {
+	Namespace string
+	Stream    string
+	// PeerID tells the application apart in logs and events, Protocol when
+	// empty.
+	PeerID   string
+	HasAudio bool
+	HasVideo bool
+	// Args are the query arguments of the session, as on the url of a
+	// protocol.
+	Args map[string]string
+}
+
+func (p StreamParams) peerParams(producer bool) router.PeerParams {
+	peerID := p.PeerID
+	if peerID == "" {
+		peerID = Protocol
+	}
+
+	return router.PeerParams{
+		RouterID:  p.Stream,
+		Namespace: p.Namespace,
+		URI:       "/" + p.Namespace + "/" + p.Stream,
+		PeerID:    peerID,
+		Protocol:  Protocol,
+		Args:      p.Args,
+		Producer:  producer,
+		HasAudio:  p.HasAudio,
+		HasVideo:  p.HasVideo,
+	}
+}
+
+// Hub is the in process access to the streams of the server.
+type Hub struct{}
+
+// Publish joins src to a stream as its publisher. The session ends when ctx
+// is done or src is closed.
+func (h *Hub) Publish(ctx context.Context, params StreamParams, src deliver.FrameSource) (Session, error) {
+	if err := h.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	session := core.NewSession(ctx, params.peerParams(true), logrus.WithField("stream", params.Stream))
+	if err := session.BindFrameSource(src); err != nil {
+		return nil, errors.Wrap(err, "bind frame source")
+	}
+
+	if err := session.Join(); err != nil {
+		session.Finalize(err)
+		return nil, errors.Wrap(err, "join")
+	}
+
+	return session, nil
+}
+
+// Subscribe joins dest to a stream as a subscriber. The stream may have no
+// publisher yet, dest gets frames once it has. The session ends when ctx is
+// done or dest is closed.
+func (h *Hub) Subscribe(ctx context.Context, params StreamParams, dest deliver.FrameDestination) (Session, error) {
+	if err := h.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	session := core.NewSession(ctx, params.peerParams(false), logrus.WithField("stream", params.Stream))
+	if err := session.BindFrameDestination(dest); err != nil {
+		return nil, errors.Wrap(err, "bind frame destination")
+	}
+
+	if err := session.Join(); err != nil && !errors.Is(err, router.ErrPaddingDestination) {
+		session.Finalize(err)
+		return nil, errors.Wrap(err, "join")
+	}
+
+	return session, nil
+}
+
+// Lookup returns a stream of the hub, false until a session joined it.
+func (h *Hub) Lookup(namespace, stream string) (Stream, bool) {
+	return core.CoreModule().LookupRouter(namespace, stream)
+}
+
+func (h *Hub) Namespaces() []*Namespace {
+	return core.CoreModule().Namespaces()
+}
+
+func (h *Hub) Sessions() []Session {
+	return core.CoreModule().Sessions()
+}
+
+// wait blocks until the hub takes sessions.
+func (h *Hub) wait(ctx context.Context) error {
+	select {
+	case <-core.CoreModule().Ready():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,77 @@
+package acl
+
+import (
+	"context"
+
+	"github.com/let-light/gomodule"
+	feature_acl "github.com/pingostack/neon/features/acl"
+	acllib "github.com/pingostack/neon/pkg/acl"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var aclModule *acl
+
+type ACLSettings struct {
+	Default acllib.Settings            `json:"default" mapstructure:"default"`
+	Modules map[string]acllib.Settings `json:"modules" mapstructure:"modules"`
+}
+
+type acl struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings ACLSettings
+	settings    *ACLSettings
+	logger      *logrus.Entry
+}
+
+func init() {
+	aclModule = &acl{
+		logger: logrus.WithField("module", "acl"),
+	}
+}
+
+func ACLModule() *acl {
+	return aclModule
+}
+
+func (a *acl) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	a.ctx = ctx
+	return &a.preSettings, nil
+}
+
+func (a *acl) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+func (a *acl) ConfigChanged() {
+	if a.settings == nil {
+		a.settings = &a.preSettings
+	}
+
+	a.apply(acllib.DefaultModule, a.settings.Default)
+	for name, settings := range a.settings.Modules {
+		a.apply(name, settings)
+	}
+}
+
+func (a *acl) apply(name string, settings acllib.Settings) {
+	l, err := acllib.New(settings, acllib.Bans())
+	if err != nil {
+		a.logger.WithError(err).Errorf("invalid acl for %s", name)
+		return
+	}
+
+	acllib.Set(name, l)
+}
+
+func (a *acl) ModuleRun() {
+	defer metrics.Track("acl")()
+
+	<-a.ctx.Done()
+}
+
+func (a *acl) Type() interface{} {
+	return feature_acl.Type()
+}
@@ -0,0 +1,9 @@
+package auth
+
+import "errors"
+
+var (
+	ErrNoSigningKey    = errors.New("no signing key configured")
+	ErrNoClientIP      = errors.New("signed urls are bound to the client ip, an ip is required")
+	ErrInvalidClientIP = errors.New("invalid client ip")
+)
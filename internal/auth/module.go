@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/let-light/gomodule"
+	feature_auth "github.com/pingostack/neon/features/auth"
+	feature_core "github.com/pingostack/neon/features/core"
+	authlib "github.com/pingostack/neon/pkg/auth"
+	"github.com/pingostack/neon/pkg/eventemitter"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/pingostack/neon/pkg/vhost"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var authModule *auth
+
+const (
+	defaultRealm = "neon"
+)
+
+type StaticSettings struct {
+	Users []authlib.StaticUser `json:"users" mapstructure:"users"`
+}
+
+type AuthSettings struct {
+	Enable    bool                         `json:"enable" mapstructure:"enable"`
+	Realm     string                       `json:"realm" mapstructure:"realm"`
+	Providers []string                     `json:"providers" mapstructure:"providers"`
+	Static    StaticSettings               `json:"static" mapstructure:"static"`
+	JWT       authlib.JWTSettings          `json:"jwt" mapstructure:"jwt"`
+	HTTP      authlib.HTTPCallbackSettings `json:"http" mapstructure:"http"`
+	GRPC      authlib.GRPCSettings         `json:"grpc" mapstructure:"grpc"`
+	Signed    authlib.SignedURLSettings    `json:"signed" mapstructure:"signed"`
+}
+
+type auth struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings AuthSettings
+	settings    *AuthSettings
+	logger      *logrus.Entry
+	chain       *authlib.Chain
+	providers   map[string]authlib.Provider
+	ee          eventemitter.EventEmitter
+}
+
+func init() {
+	authModule = &auth{
+		logger: logrus.WithField("module", "auth"),
+	}
+}
+
+func AuthModule() *auth {
+	return authModule
+}
+
+func (a *auth) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	a.ctx = ctx
+	return &a.preSettings, nil
+}
+
+func (a *auth) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+func (a *auth) ConfigChanged() {
+	if a.settings == nil {
+		a.settings = &a.preSettings
+	}
+
+	if a.settings.Realm == "" {
+		a.settings.Realm = defaultRealm
+	}
+
+	providers := make([]authlib.Provider, 0)
+	byName := make(map[string]authlib.Provider)
+	for _, name := range a.settings.Providers {
+		var p authlib.Provider
+		switch name {
+		case "static":
+			p = authlib.NewStaticProvider(a.settings.Static.Users)
+		case "jwt":
+			if a.settings.JWT.Secret == "" {
+				a.logger.Warn("jwt auth provider without a secret, skipped")
+				continue
+			}
+			p = authlib.NewJWTProvider(a.settings.JWT)
+		case "http":
+			p = authlib.NewHTTPProvider(a.settings.HTTP)
+		case "grpc":
+			p = authlib.NewGRPCProvider(a.settings.GRPC)
+		case "signed":
+			p = authlib.NewSignedURLProvider(a.settings.Signed)
+		default:
+			a.logger.Warnf("unknown auth provider %s", name)
+			continue
+		}
+
+		providers = append(providers, p)
+		byName[name] = p
+	}
+
+	prev := a.providers
+	a.chain = authlib.NewChain(providers...)
+	a.providers = byName
+
+	// the connections of the callouts replaced
+	for _, p := range prev {
+		if c, ok := p.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+// chainOf is the chain of the providers allowed for tenant, in the order of
+// the tenant.
+func (a *auth) chainOf(tenant *vhost.Tenant) *authlib.Chain {
+	if tenant == nil || len(tenant.Providers) == 0 {
+		return a.chain
+	}
+
+	providers := make([]authlib.Provider, 0, len(tenant.Providers))
+	for _, name := range tenant.Providers {
+		if p, found := a.providers[name]; found {
+			providers = append(providers, p)
+		}
+	}
+
+	return authlib.NewChain(providers...)
+}
+
+// authenticate runs the chain of the tenant of the host or path. The tenant
+// the credentials name must be the same and allow the provider.
+func (a *auth) authenticate(ctx context.Context, req *authlib.Request) (*authlib.Identity, error) {
+	vhosts := vhost.Default()
+	tenant, _, _ := vhosts.Resolve(req.Host, req.Path, "")
+
+	id, err := a.chainOf(tenant).Authenticate(ctx, req)
+	if err != nil || id.Tenant == "" {
+		return id, err
+	}
+
+	claimed, _, err := vhosts.Resolve(req.Host, req.Path, id.Tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	if claimed != nil && len(claimed.Providers) > 0 {
+		for _, name := range claimed.Providers {
+			if name == id.Provider {
+				return id, nil
+			}
+		}
+		return nil, authlib.ErrForbidden
+	}
+
+	return id, nil
+}
+
+func (a *auth) ModuleRun() {
+	defer metrics.Track("auth")()
+
+	gomodule.RequireFeatures(func(core feature_core.Feature) {
+		a.ee = core.EventEmitter()
+	})
+
+	<-a.ctx.Done()
+}
+
+func (a *auth) Type() interface{} {
+	return feature_auth.Type()
+}
+
+func (a *auth) Enabled() bool {
+	return a.settings != nil && a.settings.Enable
+}
+
+func (a *auth) Realm() string {
+	if a.settings == nil || a.settings.Realm == "" {
+		return defaultRealm
+	}
+
+	return a.settings.Realm
+}
+
+func (a *auth) Authenticate(ctx context.Context, req *authlib.Request) (*authlib.Identity, error) {
+	if !a.Enabled() {
+		return &authlib.Identity{}, nil
+	}
+
+	id, err := a.authenticate(ctx, req)
+	if err != nil {
+		a.logger.WithFields(logrus.Fields{
+			"protocol":   req.Protocol,
+			"action":     req.Action.String(),
+			"path":       req.Path,
+			"remoteAddr": req.RemoteAddr,
+		}).WithError(err).Warn("authentication failed")
+
+		if a.ee != nil {
+			a.ee.EmitEvent(feature_core.EventAuthFailed, feature_core.Event{
+				Name:       feature_core.EventNameAuthFailed,
+				Time:       time.Now(),
+				Stream:     req.Path,
+				RemoteAddr: req.RemoteAddr,
+				Producer:   req.Action == authlib.ActionPublish,
+				Reason:     err.Error(),
+				Extra:      map[string]interface{}{"protocol": req.Protocol},
+			})
+		}
+
+		return nil, err
+	}
+
+	return id, nil
+}
+
+// SignURL signs with the first configured key, which is the current one during rotation.
+// The ip of the client is required when links are bound to it, and left out
+// otherwise since it would never be verified.
+func (a *auth) SignURL(action authlib.Action, streamPath string, ttl time.Duration, ip string) (url.Values, error) {
+	if a.settings == nil || len(a.settings.Signed.Keys) == 0 {
+		return nil, ErrNoSigningKey
+	}
+
+	if !a.settings.Signed.BindIP {
+		ip = ""
+	} else if ip == "" {
+		return nil, ErrNoClientIP
+	} else if parsed := net.ParseIP(ip); parsed == nil {
+		return nil, ErrInvalidClientIP
+	} else {
+		// as the remote address it is verified against is written
+		ip = parsed.String()
+	}
+
+	return authlib.SignURL(a.settings.Signed.Keys[0], action, streamPath, time.Now().Add(ttl), ip), nil
+}
@@ -0,0 +1,245 @@
+// Package bench is a load testing client: it connects many players or
+// publishers to a server and reports how many connected, how fast, and the
+// bitrate they received or sent.
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/testsrc"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ModePlay    = "play"
+	ModePublish = "publish"
+)
+
+var (
+	ErrUnsupportedProtocol = errors.New("unsupported protocol")
+	ErrNoFrames            = errors.New("no frames received")
+)
+
+type Options struct {
+	// URL of the stream, rtsp:// or the http(s):// whip and whep endpoints of
+	// webrtc. {n} is replaced by the number of the client, e.g. for
+	// publishers of distinct streams.
+	URL     string
+	Mode    string
+	Clients int
+	// Duration is how long a client stays connected.
+	Duration time.Duration
+	// Rate is the number of clients started a second, all at once when zero.
+	Rate float64
+	// Timeout bounds connecting and the first frame.
+	Timeout time.Duration
+	// Token is sent as the bearer token of whip and whep requests.
+	Token string
+}
+
+// client runs one connection until ctx is done, it fills in r as it goes.
+type client func(ctx context.Context, opts Options, u *url.URL, r *result) error
+
+type result struct {
+	start      time.Time
+	connected  time.Duration
+	firstFrame time.Duration
+	bytes      int64
+	err        error
+}
+
+func (r *result) onConnected() {
+	r.connected = time.Since(r.start)
+}
+
+// onBytes counts n bytes of media, the first ones tell when frames flowed.
+func (r *result) onBytes(n int) {
+	if atomic.AddInt64(&r.bytes, int64(n)) == int64(n) {
+		r.firstFrame = time.Since(r.start)
+	}
+}
+
+// Report sums up a run.
+type Report struct {
+	Mode       string
+	Clients    int
+	Connected  int
+	Connect    Percentiles
+	FirstFrame Percentiles
+	// Bitrate is the sum over the clients, bits a second received by
+	// players and sent by publishers.
+	Bitrate float64
+	Errors  map[string]int
+}
+
+type Percentiles struct {
+	P50, P95, Max time.Duration
+}
+
+// Run connects opts.Clients clients and waits for them to end.
+func Run(ctx context.Context, opts Options, logger *logrus.Entry) (*Report, error) {
+	u, err := url.Parse(strings.ReplaceAll(opts.URL, "{n}", "0"))
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Clients <= 0 {
+		opts.Clients = 1
+	}
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	var run client
+	switch {
+	case u.Scheme == "rtsp" && opts.Mode == ModePlay:
+		run = rtspPlay
+	case u.Scheme == "rtsp" && opts.Mode == ModePublish:
+		run = rtspPublish
+	case (u.Scheme == "http" || u.Scheme == "https") && opts.Mode == ModePlay:
+		run = whepPlay
+	case (u.Scheme == "http" || u.Scheme == "https") && opts.Mode == ModePublish:
+		run = whipPublish
+	default:
+		// rtmp has no client in this tree
+		return nil, fmt.Errorf("%w: %s %s", ErrUnsupportedProtocol, u.Scheme, opts.Mode)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if opts.Mode == ModePublish {
+		// publishers share one test signal
+		src, err := testsrc.NewSource(ctx, testsrc.Options{Audio: deliver.CodecTypePCMU}, logger)
+		if err != nil {
+			return nil, err
+		}
+		ctx = withSource(ctx, src)
+	}
+
+	results := make([]*result, opts.Clients)
+	var wg sync.WaitGroup
+	for i := range results {
+		if i > 0 && opts.Rate > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Duration(float64(time.Second) / opts.Rate)):
+			}
+		}
+
+		r := &result{start: time.Now()}
+		results[i] = r
+		cu, err := url.Parse(strings.ReplaceAll(opts.URL, "{n}", strconv.Itoa(i)))
+		if err != nil {
+			return nil, err
+		}
+
+		wg.Add(1)
+		go func(r *result, cu *url.URL) {
+			defer wg.Done()
+
+			cctx, ccancel := context.WithTimeout(ctx, opts.Duration)
+			defer ccancel()
+
+			r.err = run(cctx, opts, cu, r)
+			if errors.Is(r.err, context.DeadlineExceeded) || errors.Is(r.err, context.Canceled) || errors.Is(r.err, io.EOF) && cctx.Err() != nil {
+				r.err = nil
+			}
+			if r.err == nil && atomic.LoadInt64(&r.bytes) == 0 {
+				r.err = ErrNoFrames
+			}
+			if r.err != nil {
+				logger.WithError(r.err).WithField("url", cu.String()).Debug("client failed")
+			}
+		}(r, cu)
+	}
+	wg.Wait()
+
+	return report(opts, results), nil
+}
+
+func report(opts Options, results []*result) *Report {
+	rep := &Report{
+		Mode:    opts.Mode,
+		Clients: len(results),
+		Errors:  make(map[string]int),
+	}
+
+	var connect, first []time.Duration
+	for _, r := range results {
+		if r.connected > 0 {
+			rep.Connected++
+			connect = append(connect, r.connected)
+		}
+
+		if r.firstFrame > 0 {
+			first = append(first, r.firstFrame)
+		}
+
+		if d := opts.Duration - r.firstFrame; r.bytes > 0 && d > 0 {
+			rep.Bitrate += float64(r.bytes*8) / d.Seconds()
+		}
+
+		if r.err != nil {
+			rep.Errors[r.err.Error()]++
+		}
+	}
+
+	rep.Connect = percentiles(connect)
+	rep.FirstFrame = percentiles(first)
+
+	return rep
+}
+
+func percentiles(ds []time.Duration) Percentiles {
+	if len(ds) == 0 {
+		return Percentiles{}
+	}
+
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	at := func(p float64) time.Duration {
+		return ds[int(p*float64(len(ds)-1))]
+	}
+
+	return Percentiles{P50: at(0.5), P95: at(0.95), Max: ds[len(ds)-1]}
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	rate := 0.0
+	if r.Clients > 0 {
+		rate = float64(r.Connected) * 100 / float64(r.Clients)
+	}
+
+	direction := "received"
+	if r.Mode == ModePublish {
+		direction = "sent"
+	}
+
+	fmt.Fprintf(&b, "clients:     %d, connected %d (%.1f%%)\n", r.Clients, r.Connected, rate)
+	fmt.Fprintf(&b, "connect:     p50 %v, p95 %v, max %v\n", r.Connect.P50, r.Connect.P95, r.Connect.Max)
+	fmt.Fprintf(&b, "first frame: p50 %v, p95 %v, max %v\n", r.FirstFrame.P50, r.FirstFrame.P95, r.FirstFrame.Max)
+	fmt.Fprintf(&b, "%-12s %.2f Mbps", direction+":", r.Bitrate/1e6)
+	if r.Connected > 0 {
+		fmt.Fprintf(&b, ", %.2f Mbps a client", r.Bitrate/1e6/float64(r.Connected))
+	}
+	b.WriteString("\n")
+
+	for err, n := range r.Errors {
+		fmt.Fprintf(&b, "error:       %s (x%d)\n", err, n)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,44 @@
+package bench
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Command is the bench subcommand of neon.
+func Command() *cobra.Command {
+	opts := Options{}
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "load test a server with many rtsp or webrtc clients",
+		Example: "  neon bench --url rtsp://127.0.0.1:554/live/cam1 -n 100 --duration 30s\n" +
+			"  neon bench --url http://127.0.0.1:8080/whip/live/bench{n} --mode publish -n 10",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if opts.URL == "" {
+				return fmt.Errorf("--url is required")
+			}
+
+			report, err := Run(cmd.Context(), opts, logrus.WithField("module", "bench"))
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprint(cmd.OutOrStdout(), report.String())
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.URL, "url", "", "url of the stream, rtsp:// or the http(s):// whip and whep endpoint, {n} is replaced by the number of the client")
+	flags.StringVar(&opts.Mode, "mode", ModePlay, "play or publish")
+	flags.IntVarP(&opts.Clients, "clients", "n", 1, "number of clients")
+	flags.DurationVar(&opts.Duration, "duration", 10*time.Second, "how long each client stays connected")
+	flags.Float64Var(&opts.Rate, "rate", 0, "clients started a second, all at once when 0")
+	flags.DurationVar(&opts.Timeout, "timeout", 10*time.Second, "timeout of connecting")
+	flags.StringVar(&opts.Token, "token", "", "bearer token of whip and whep requests")
+
+	return cmd
+}
@@ -0,0 +1,336 @@
+package bench
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/protocols/rtsp"
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+)
+
+const (
+	rtspDefaultPort = "554"
+	// players keep their session alive
+	rtspKeepAlive = 20 * time.Second
+)
+
+// the sdp announced by publishers, the tracks of the test signal
+const rtspAnnounceSDP = "v=0\r\n" +
+	"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+	"s=neon bench\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"t=0 0\r\n" +
+	"m=video 0 RTP/AVP 96\r\n" +
+	"a=rtpmap:96 H264/90000\r\n" +
+	"a=fmtp:96 packetization-mode=1\r\n" +
+	"a=control:trackID=0\r\n" +
+	"m=audio 0 RTP/AVP 111\r\n" +
+	"a=rtpmap:111 PCMU/8000\r\n" +
+	"a=control:trackID=1\r\n"
+
+type rtspConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	client *rtsp.Client
+	lock   sync.Mutex
+}
+
+func dialRTSP(ctx context.Context, u *url.URL, timeout time.Duration) (*rtspConn, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), rtspDefaultPort)
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	c := &rtspConn{
+		conn:   conn,
+		reader: bufio.NewReaderSize(conn, 64*1024),
+	}
+	c.client = rtsp.NewClient(c.write)
+	c.client.SetUrl(u.String())
+
+	return c, nil
+}
+
+func (c *rtspConn) write(data []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	_, err := c.conn.Write(data)
+	return err
+}
+
+// do sends req and reads its response, interleaved frames in between are
+// counted to r.
+func (c *rtspConn) do(req rtsp.IRequest, session string, r *result) (*rtsp.Response, error) {
+	if session != "" {
+		req.SetLine("Session", session)
+	}
+
+	if err := c.write([]byte(req.String())); err != nil {
+		return nil, err
+	}
+
+	for {
+		resp, err := c.read(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp == nil {
+			continue
+		}
+
+		if resp.Status() != 200 {
+			return nil, fmt.Errorf("rtsp %s: %d", req.MethodStr(), resp.Status())
+		}
+
+		return resp, nil
+	}
+}
+
+// read reads the next response or interleaved frame, nil for the latter.
+func (c *rtspConn) read(r *result) (*rtsp.Response, error) {
+	b, err := c.reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if b[0] == '$' {
+		head, err := c.reader.Peek(4)
+		if err != nil {
+			return nil, err
+		}
+
+		n := 4 + (int(head[2])<<8 | int(head[3]))
+		if head[1]%2 == 0 {
+			r.onBytes(n - 4)
+		}
+		_, err = c.reader.Discard(n)
+		return nil, err
+	}
+
+	var buf []byte
+	length := 0
+	for {
+		line, err := c.reader.ReadSlice('\n')
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, line...)
+		if len(buf) > rtsp.DefaultLimits.MaxHeaderSize {
+			return nil, rtsp.ErrHeaderTooLarge
+		}
+
+		if key, value, ok := strings.Cut(string(line), ":"); ok && strings.EqualFold(strings.TrimSpace(key), "content-length") {
+			length, _ = strconv.Atoi(strings.TrimSpace(value))
+		}
+
+		if len(strings.TrimSpace(string(line))) == 0 {
+			break
+		}
+	}
+
+	if length < 0 || length > rtsp.DefaultLimits.MaxContentLength {
+		return nil, fmt.Errorf("%w: %d bytes", rtsp.ErrContentTooLarge, length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return nil, err
+	}
+
+	resp, _, err := rtsp.UnmarshalResponseWithLimits(append(buf, body...), rtsp.DefaultLimits)
+	return resp, err
+}
+
+// tracks returns the control urls of the media of an sdp.
+func tracks(desc []byte, base string) ([]string, error) {
+	var sd sdp.SessionDescription
+	if err := sd.Unmarshal(desc); err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	for _, md := range sd.MediaDescriptions {
+		control, _ := md.Attribute("control")
+		switch {
+		case strings.Contains(control, "://"):
+			urls = append(urls, control)
+		case control == "" || control == "*":
+			urls = append(urls, base)
+		default:
+			urls = append(urls, strings.TrimSuffix(base, "/")+"/"+control)
+		}
+	}
+
+	return urls, nil
+}
+
+func rtspSession(resp *rtsp.Response) string {
+	session, _, _ := strings.Cut(resp.Session(), ";")
+	return strings.TrimSpace(session)
+}
+
+func rtspPlay(ctx context.Context, opts Options, u *url.URL, r *result) error {
+	c, err := dialRTSP(ctx, u, opts.Timeout)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.do(c.client.NewOptionsRequest(), "", r); err != nil {
+		return err
+	}
+
+	describe := c.client.NewRequest("DESCRIBE")
+	describe.SetLine("Accept", "application/sdp")
+	resp, err := c.do(describe, "", r)
+	if err != nil {
+		return err
+	}
+
+	base := resp.Line("content-base")
+	if base == "" {
+		base = u.String()
+	}
+
+	urls, err := tracks(resp.Content(), base)
+	if err != nil {
+		return err
+	}
+
+	session := ""
+	for i, track := range urls {
+		setup := c.client.NewSetupRequest(i, rtsp.NewTcpTransport(rtsp.RtpProfileAVP, []int{2 * i, 2*i + 1}))
+		setup.IRequest.(*rtsp.Request).SetUrl(track)
+		resp, err := c.do(setup, session, r)
+		if err != nil {
+			return err
+		}
+		session = rtspSession(resp)
+	}
+
+	if _, err := c.do(c.client.NewPlayRequest(), session, r); err != nil {
+		return err
+	}
+	r.onConnected()
+
+	go func() {
+		ticker := time.NewTicker(rtspKeepAlive)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				req := c.client.NewOptionsRequest()
+				req.SetLine("Session", session)
+				c.write([]byte(req.String()))
+			}
+		}
+	}()
+
+	for {
+		if _, err := c.read(r); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+	}
+}
+
+func rtspPublish(ctx context.Context, opts Options, u *url.URL, r *result) error {
+	c, err := dialRTSP(ctx, u, opts.Timeout)
+	if err != nil {
+		return err
+	}
+
+	announce := c.client.NewAnnounceRequest()
+	announce.SetLine("Content-Type", "application/sdp")
+	announce.SetContent(rtspAnnounceSDP)
+	if _, err := c.do(announce, "", r); err != nil {
+		return err
+	}
+
+	session := ""
+	for i := 0; i < 2; i++ {
+		transport := rtsp.NewTcpTransport(rtsp.RtpProfileAVP, []int{2 * i, 2*i + 1})
+		transport.SetMode("record")
+		setup := c.client.NewSetupRequest(i, transport)
+		setup.IRequest.(*rtsp.Request).SetUrl(strings.TrimSuffix(u.String(), "/") + "/trackID=" + strconv.Itoa(i))
+		resp, err := c.do(setup, session, r)
+		if err != nil {
+			return err
+		}
+		session = rtspSession(resp)
+	}
+
+	if _, err := c.do(c.client.NewRecordRequest(), session, r); err != nil {
+		return err
+	}
+	r.onConnected()
+
+	errs := make(chan error, 1)
+	err = subscribe(ctx, func(codec deliver.CodecType, packet *rtp.Packet) {
+		channel := 0
+		if codec.IsAudio() {
+			channel = 2
+		}
+
+		data, err := packet.Marshal()
+		if err != nil {
+			return
+		}
+
+		if err := c.write(rtsp.MarshalInterleaved(channel, data)); err != nil {
+			select {
+			case errs <- err:
+			default:
+			}
+			return
+		}
+		r.onBytes(len(data))
+	})
+	if err != nil {
+		return err
+	}
+
+	// responses and rtcp of the server are read and dropped
+	go func() {
+		ignored := &result{}
+		for {
+			if _, err := c.read(ignored); err != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-errs:
+		return err
+	}
+}
@@ -0,0 +1,53 @@
+package bench
+
+import (
+	"context"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/testsrc"
+	"github.com/pion/rtp"
+)
+
+type sourceKey struct{}
+
+func withSource(ctx context.Context, src *testsrc.Source) context.Context {
+	return context.WithValue(ctx, sourceKey{}, src)
+}
+
+// packetSink hands the rtp packets of the test signal to a publisher.
+type packetSink struct {
+	deliver.FrameDestination
+	write   func(codec deliver.CodecType, packet *rtp.Packet)
+	started bool
+}
+
+// subscribe calls write with the packets of the test signal until ctx is
+// done, from a keyframe on.
+func subscribe(ctx context.Context, write func(codec deliver.CodecType, packet *rtp.Packet)) error {
+	src := ctx.Value(sourceKey{}).(*testsrc.Source)
+	sink := &packetSink{
+		FrameDestination: deliver.NewFrameDestinationImpl(ctx, deliver.FormatSettings{
+			PacketType: deliver.PacketTypeRtp,
+		}),
+		write: write,
+	}
+
+	if err := deliver.AddDestination(src, sink); err != nil {
+		return err
+	}
+
+	return sink.DeliverFeedback(deliver.FeedbackMsg{
+		Type: deliver.FeedbackTypeVideo,
+		Cmd:  deliver.FeedbackCmdKeyFrame,
+	})
+}
+
+func (s *packetSink) OnFrame(frame deliver.Frame, _ deliver.Attributes) {
+	if info, ok := frame.AdditionalInfo.(*deliver.VideoFrameSpecificInfo); ok && info.IsKeyFrame {
+		s.started = true
+	}
+
+	if packet, ok := frame.RawPacket.(*rtp.Packet); ok && s.started {
+		s.write(frame.Codec, packet)
+	}
+}
@@ -0,0 +1,230 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+// signal posts the offer of pc to a whip or whep endpoint and applies the
+// answer, it returns the url of the session the endpoint created.
+func signal(ctx context.Context, opts Options, u *url.URL, pc *webrtc.PeerConnection) (string, error) {
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		return "", err
+	}
+
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(offer); err != nil {
+		return "", err
+	}
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-gathered:
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), strings.NewReader(pc.LocalDescription().SDP))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/sdp")
+	if opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.Token)
+	}
+
+	client := http.Client{Timeout: opts.Timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	answer, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	// whip answers 201, whep endpoints 200 or 201
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", u.String(), resp.Status)
+	}
+
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{
+		Type: webrtc.SDPTypeAnswer,
+		SDP:  string(answer),
+	}); err != nil {
+		return "", err
+	}
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return "", nil
+	}
+
+	session, err := u.Parse(location)
+	if err != nil {
+		return "", nil
+	}
+
+	return session.String(), nil
+}
+
+// hangup deletes the session of a whip or whep endpoint.
+func hangup(opts Options, session string) {
+	if session == "" {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, session, nil)
+	if err != nil {
+		return
+	}
+	if opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.Token)
+	}
+
+	client := http.Client{Timeout: opts.Timeout}
+	if resp, err := client.Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// connect waits for pc to connect, the error is set when it failed.
+func connect(ctx context.Context, pc *webrtc.PeerConnection, r *result) <-chan error {
+	failed := make(chan error, 1)
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		switch state {
+		case webrtc.PeerConnectionStateConnected:
+			r.onConnected()
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			select {
+			case failed <- fmt.Errorf("peer connection %s", state):
+			default:
+			}
+		}
+	})
+
+	return failed
+}
+
+func whepPlay(ctx context.Context, opts Options, u *url.URL, r *result) error {
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeVideo, webrtc.RTPCodecTypeAudio} {
+		if _, err := pc.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionRecvonly,
+		}); err != nil {
+			return err
+		}
+	}
+
+	pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		buf := make([]byte, 1500)
+		for {
+			n, _, err := track.Read(buf)
+			if err != nil {
+				return
+			}
+			r.onBytes(n)
+		}
+	})
+
+	failed := connect(ctx, pc, r)
+	session, err := signal(ctx, opts, u, pc)
+	if err != nil {
+		return err
+	}
+	defer hangup(opts, session)
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-failed:
+		return err
+	}
+}
+
+func whipPublish(ctx context.Context, opts Options, u *url.URL, r *result) error {
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+
+	video, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{
+		MimeType:    webrtc.MimeTypeH264,
+		ClockRate:   90000,
+		SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+	}, "video", "bench")
+	if err != nil {
+		return err
+	}
+
+	audio, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{
+		MimeType:  webrtc.MimeTypePCMU,
+		ClockRate: 8000,
+	}, "audio", "bench")
+	if err != nil {
+		return err
+	}
+
+	for _, track := range []*webrtc.TrackLocalStaticRTP{video, audio} {
+		sender, err := pc.AddTransceiverFromTrack(track, webrtc.RTPTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionSendonly,
+		})
+		if err != nil {
+			return err
+		}
+
+		// rtcp is read for the interceptors to see it
+		go func(sender *webrtc.RTPSender) {
+			buf := make([]byte, 1500)
+			for {
+				if _, _, err := sender.Read(buf); err != nil {
+					return
+				}
+			}
+		}(sender.Sender())
+	}
+
+	failed := connect(ctx, pc, r)
+	session, err := signal(ctx, opts, u, pc)
+	if err != nil {
+		return err
+	}
+	defer hangup(opts, session)
+
+	err = subscribe(ctx, func(codec deliver.CodecType, packet *rtp.Packet) {
+		track := video
+		if codec.IsAudio() {
+			track = audio
+		}
+
+		if err := track.WriteRTP(packet); err == nil {
+			r.onBytes(len(packet.Payload))
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-failed:
+		return err
+	}
+}
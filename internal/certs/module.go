@@ -0,0 +1,74 @@
+package certs
+
+import (
+	"context"
+
+	"github.com/let-light/gomodule"
+	feature_certs "github.com/pingostack/neon/features/certs"
+	"github.com/pingostack/neon/pkg/certmgr"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var certsModule *certs
+
+type certs struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	cancelWatch context.CancelFunc
+	preSettings certmgr.Settings
+	settings    *certmgr.Settings
+	logger      *logrus.Entry
+}
+
+func init() {
+	certsModule = &certs{
+		logger: logrus.WithField("module", "certs"),
+	}
+}
+
+func CertsModule() *certs {
+	return certsModule
+}
+
+func (c *certs) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	c.ctx = ctx
+	return &c.preSettings, nil
+}
+
+func (c *certs) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+func (c *certs) ConfigChanged() {
+	if c.settings == nil {
+		c.settings = &c.preSettings
+	}
+
+	m, err := certmgr.NewManager(*c.settings, c.logger)
+	if err != nil {
+		c.logger.WithError(err).Error("failed to load certificates")
+		return
+	}
+
+	if c.cancelWatch != nil {
+		c.cancelWatch()
+	}
+
+	var ctx context.Context
+	ctx, c.cancelWatch = context.WithCancel(c.ctx)
+	metrics.Go("certs", func() { m.Watch(ctx) })
+
+	certmgr.SetDefault(m)
+}
+
+func (c *certs) ModuleRun() {
+	defer metrics.Track("certs")()
+
+	<-c.ctx.Done()
+}
+
+func (c *certs) Type() interface{} {
+	return feature_certs.Type()
+}
@@ -0,0 +1,21 @@
+package core
+
+import "sync/atomic"
+
+var draining int32
+
+// SetDraining stops or resumes accepting sessions, it returns false if the
+// node already was in that state.
+func SetDraining(enable bool) bool {
+	if enable {
+		return atomic.CompareAndSwapInt32(&draining, 0, 1)
+	}
+
+	return atomic.CompareAndSwapInt32(&draining, 1, 0)
+}
+
+// Draining reports whether new sessions are refused while the node shuts
+// down.
+func Draining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
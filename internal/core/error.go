@@ -9,4 +9,8 @@ var (
 	ErrFrameDestinationNil     = errors.New("frame destination is nil")
 	ErrFrameSourceClosed       = errors.New("frame source closed")
 	ErrFrameDestinationClosed  = errors.New("frame destination closed")
+	ErrNoPuller                = errors.New("no puller for source scheme")
+	ErrStreamPulled            = errors.New("stream already pulled")
+	ErrStreamPublished         = errors.New("stream already published")
+	ErrPullUnavailable         = errors.New("pulls unavailable")
 )
@@ -6,6 +6,9 @@ import (
 	"github.com/let-light/gomodule"
 	feature_core "github.com/pingostack/neon/features/core"
 	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/eventbus"
+	"github.com/pingostack/neon/pkg/eventemitter"
+	"github.com/pingostack/neon/pkg/metrics"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -20,6 +23,15 @@ var coreModule *core
 type CoreSettings struct {
 	//httpserv.HttpParams `json:"http" mapstructure:"http"`
 	Namespaces router.NSManagerParams `json:"namespaces" mapstructure:"namespaces"`
+	Routes     router.RouteSettings   `json:"routes" mapstructure:"routes"`
+	Sources    []SourceSettings       `json:"sources" mapstructure:"sources"`
+	Viewers    ViewerSettings         `json:"viewers" mapstructure:"viewers"`
+}
+
+type ViewerSettings struct {
+	// Thresholds of subscribers per stream, crossing one up or down emits
+	// a viewers_threshold event.
+	Thresholds []int `json:"thresholds" mapstructure:"thresholds"`
 }
 
 type core struct {
@@ -28,11 +40,14 @@ type core struct {
 	preSettings CoreSettings
 	settings    *CoreSettings
 	logger      *logrus.Entry
+	ee          eventemitter.EventEmitter
+	ready       chan struct{}
 }
 
 func init() {
 	coreModule = &core{
 		logger: logrus.WithField("module", "core"),
+		ready:  make(chan struct{}),
 	}
 }
 
@@ -42,9 +57,35 @@ func CoreModule() *core {
 
 func (core *core) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
 	core.ctx = ctx
+	core.ee = eventemitter.NewEventEmitter(ctx, defaultEventEmitterSize, core.logger, eventemitter.WithName("core"))
+	core.bridgeEvents()
 	return &core.preSettings, nil
 }
 
+// bridgeEvents republishes the core events on the event bus.
+func (core *core) bridgeEvents() {
+	bridge := func(topic eventemitter.Topic[feature_core.Event]) func(data interface{}) error {
+		return func(data interface{}) error {
+			return eventbus.Emit(topic.String(), data)
+		}
+	}
+
+	core.ee.AddEvent(feature_core.EventStreamPublished, bridge(eventbus.TopicStreamPublished))
+	core.ee.AddEvent(feature_core.EventStreamEnded, bridge(eventbus.TopicStreamEnded))
+	core.ee.AddEvent(feature_core.EventClientConnected, bridge(eventbus.TopicClientConnected))
+	core.ee.AddEvent(feature_core.EventClientDisconnected, bridge(eventbus.TopicClientDisconnected))
+	core.ee.AddEvent(feature_core.EventRecordingFinished, bridge(eventbus.TopicRecordingFinished))
+	core.ee.AddEvent(feature_core.EventAuthFailed, bridge(eventbus.TopicAuthFailed))
+	core.ee.AddEvent(feature_core.EventStreamFailover, bridge(eventbus.TopicStreamFailover))
+	core.ee.AddEvent(feature_core.EventStreamFailback, bridge(eventbus.TopicStreamFailback))
+	core.ee.AddEvent(feature_core.EventViewersThreshold, bridge(eventbus.TopicViewersThreshold))
+	core.ee.AddEvent(feature_core.EventGOPExceeded, bridge(eventbus.TopicGOPExceeded))
+	core.ee.AddEvent(feature_core.EventStreamUnhealthy, bridge(eventbus.TopicStreamUnhealthy))
+	core.ee.AddEvent(feature_core.EventStreamRecovered, bridge(eventbus.TopicStreamRecovered))
+	core.ee.AddEvent(feature_core.EventStreamQuarantined, bridge(eventbus.TopicStreamQuarantined))
+	core.ee.AddEvent(feature_core.EventRecordingUploaded, bridge(eventbus.TopicRecordingUploaded))
+}
+
 func (core *core) InitCommand() ([]*cobra.Command, error) {
 
 	return nil, nil
@@ -57,9 +98,75 @@ func (core *core) ConfigChanged() {
 }
 
 func (core *core) ModuleRun() {
-	defaultServ = NewServ(core.ctx, core.settings.Namespaces)
+	defer metrics.Track("core")()
+
+	routes, err := router.NewRoutes(core.settings.Routes)
+	if err != nil {
+		core.logger.WithError(err).Error("invalid routes, routing rules disabled")
+	}
+
+	defaultServ = NewServ(core.ctx, core.settings.Namespaces, WithEventEmitter(core.ee), WithRoutes(routes), WithSources(core.settings.Sources),
+		WithViewerThresholds(core.settings.Viewers.Thresholds))
+	close(core.ready)
+}
+
+// Ready is closed once the hub runs and sessions may join.
+func (core *core) Ready() <-chan struct{} {
+	return core.ready
 }
 
 func (core *core) Type() interface{} {
 	return feature_core.Type()
 }
+
+func (core *core) EventEmitter() eventemitter.EventEmitter {
+	return core.ee
+}
+
+func (core *core) Namespaces() []*router.Namespace {
+	if defaultServ == nil {
+		return nil
+	}
+
+	return defaultServ.Namespaces()
+}
+
+func (core *core) Sessions() []router.Session {
+	if defaultServ == nil {
+		return nil
+	}
+
+	return defaultServ.Sessions()
+}
+
+func (core *core) LookupSession(id string) (router.Session, bool) {
+	if defaultServ == nil {
+		return nil, false
+	}
+
+	return defaultServ.LookupSession(id)
+}
+
+func (core *core) LookupRouter(namespace, id string) (router.Router, bool) {
+	if defaultServ == nil {
+		return nil, false
+	}
+
+	return defaultServ.LookupRouter(namespace, id)
+}
+
+func (core *core) Pull(namespace, stream, url string) error {
+	if defaultServ == nil {
+		return ErrPullUnavailable
+	}
+
+	return defaultServ.Pull(namespace, stream, url)
+}
+
+func (core *core) StopPull(namespace, stream string) bool {
+	if defaultServ == nil {
+		return false
+	}
+
+	return defaultServ.StopPull(namespace, stream)
+}
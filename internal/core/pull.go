@@ -0,0 +1,387 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/clock"
+	"github.com/pingostack/neon/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// SourceSettings maps stream paths to an upstream pulled on demand. {stream}
+// in URL is replaced with the requested stream path.
+type SourceSettings struct {
+	Pattern     string `json:"pattern" mapstructure:"pattern"`
+	URL         string `json:"url" mapstructure:"url"`
+	HoldSeconds int    `json:"holdSeconds" mapstructure:"holdSeconds"`
+}
+
+// Puller pulls url and publishes it as a producer session with params, see
+// NewSession. It blocks until ctx is done or the upstream fails.
+type Puller func(ctx context.Context, url string, params router.PeerParams) error
+
+// Locator finds the upstream url of a stream nobody publishes locally, e.g.
+// on another node of a cluster. It returns an error when the stream is
+// nowhere to be found.
+type Locator func(ctx context.Context, namespace, stream string) (string, error)
+
+// LocatorSettings apply to streams pulled from a located upstream.
+type LocatorSettings struct {
+	HoldSeconds int
+}
+
+const (
+	defaultPullHold       = 10 * time.Second
+	pullRetryInterval     = 2 * time.Second
+	pullSubscribersTicker = time.Second
+	defaultQuarantine     = 5 * time.Minute
+)
+
+var (
+	pullers     = make(map[string]Puller)
+	pullersLock sync.RWMutex
+)
+
+// RegisterPuller makes upstreams of scheme, e.g. "rtsp", available to sources.
+func RegisterPuller(scheme string, puller Puller) {
+	pullersLock.Lock()
+	defer pullersLock.Unlock()
+
+	pullers[strings.ToLower(scheme)] = puller
+}
+
+var (
+	locator         Locator
+	locatorSettings LocatorSettings
+	locatorLock     sync.RWMutex
+)
+
+// SetLocator is consulted for streams no source pattern matches, nil removes it.
+func SetLocator(l Locator, settings LocatorSettings) {
+	locatorLock.Lock()
+	defer locatorLock.Unlock()
+
+	locator, locatorSettings = l, settings
+}
+
+func currentLocator() (Locator, LocatorSettings) {
+	locatorLock.RLock()
+	defer locatorLock.RUnlock()
+
+	return locator, locatorSettings
+}
+
+var (
+	addedSources     = make(map[string][]SourceSettings)
+	addedSourcesLock sync.RWMutex
+)
+
+// SetSources replaces the sources owner added at runtime, e.g. discovered
+// cameras. They match after the configured sources, nil removes them.
+func SetSources(owner string, sources []SourceSettings) {
+	addedSourcesLock.Lock()
+	defer addedSourcesLock.Unlock()
+
+	if len(sources) == 0 {
+		delete(addedSources, owner)
+		return
+	}
+
+	addedSources[owner] = append([]SourceSettings(nil), sources...)
+}
+
+func matchAddedSource(stream string) (SourceSettings, bool) {
+	addedSourcesLock.RLock()
+	defer addedSourcesLock.RUnlock()
+
+	owners := make([]string, 0, len(addedSources))
+	for owner := range addedSources {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+
+	for _, owner := range owners {
+		for _, source := range addedSources[owner] {
+			if utils.MatchStreamPath(source.Pattern, stream) {
+				return source, true
+			}
+		}
+	}
+
+	return SourceSettings{}, false
+}
+
+func lookupPuller(scheme string) (Puller, bool) {
+	pullersLock.RLock()
+	defer pullersLock.RUnlock()
+
+	p, ok := pullers[strings.ToLower(scheme)]
+	return p, ok
+}
+
+type pullManager struct {
+	ctx     context.Context
+	sources []SourceSettings
+	pulls   map[string]context.CancelFunc
+	// quarantined streams are not pulled until the time
+	quarantined map[string]time.Time
+	lock        sync.Mutex
+	logger      *logrus.Entry
+	clock       clock.Clock
+}
+
+func newPullManager(ctx context.Context, sources []SourceSettings) *pullManager {
+	return &pullManager{
+		ctx:         ctx,
+		sources:     sources,
+		pulls:       make(map[string]context.CancelFunc),
+		quarantined: make(map[string]time.Time),
+		logger:      DefaultLogger().WithField("obj", "pull"),
+		clock:       clock.Default(),
+	}
+}
+
+func (pm *pullManager) match(stream string) (SourceSettings, bool) {
+	if pm == nil {
+		return SourceSettings{}, false
+	}
+
+	for _, source := range pm.sources {
+		if utils.MatchStreamPath(source.Pattern, stream) {
+			return source, true
+		}
+	}
+
+	return matchAddedSource(stream)
+}
+
+// ensure starts pulling the stream of r unless it is published or already
+// being pulled.
+func (pm *pullManager) ensure(ns *router.Namespace, r router.Router, domain string) {
+	if pm == nil || r.Producer() != nil {
+		return
+	}
+
+	source, ok := pm.match(r.ID())
+	if !ok {
+		l, settings := currentLocator()
+		if l == nil {
+			return
+		}
+
+		source = SourceSettings{HoldSeconds: settings.HoldSeconds}
+	}
+
+	key := ns.Name() + "/" + r.ID()
+
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	if _, ok := pm.pulls[key]; ok {
+		return
+	}
+
+	if until, ok := pm.quarantined[key]; ok {
+		if pm.clock.Now().Before(until) {
+			return
+		}
+		delete(pm.quarantined, key)
+	}
+
+	ctx, cancel := context.WithCancel(pm.ctx)
+	pm.pulls[key] = cancel
+
+	go pm.run(ctx, key, ns, r.ID(), domain, source, true)
+}
+
+// start pulls rawURL as stream until stop, whether it is watched or not.
+func (pm *pullManager) start(ns *router.Namespace, stream, rawURL string) error {
+	if pm == nil {
+		return ErrPullUnavailable
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := lookupPuller(u.Scheme); !ok {
+		return fmt.Errorf("%w: %s", ErrNoPuller, u.Scheme)
+	}
+
+	if r := ns.Router(stream); r != nil && r.Producer() != nil {
+		return ErrStreamPublished
+	}
+
+	key := ns.Name() + "/" + stream
+
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	if _, ok := pm.pulls[key]; ok {
+		return ErrStreamPulled
+	}
+
+	ctx, cancel := context.WithCancel(pm.ctx)
+	pm.pulls[key] = cancel
+
+	go pm.run(ctx, key, ns, stream, "", SourceSettings{URL: rawURL}, false)
+
+	return nil
+}
+
+// stop stops the pull of stream, false when it is not pulled.
+func (pm *pullManager) stop(ns *router.Namespace, stream string) bool {
+	if pm == nil {
+		return false
+	}
+
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	cancel, ok := pm.pulls[ns.Name()+"/"+stream]
+	if ok {
+		cancel()
+	}
+
+	return ok
+}
+
+// run pulls the source of stream until ctx is done, held ones only while
+// the stream is watched.
+func (pm *pullManager) run(ctx context.Context, key string, ns *router.Namespace, stream, domain string, source SourceSettings, held bool) {
+	logger := pm.logger.WithField("stream", key)
+
+	defer func() {
+		pm.lock.Lock()
+		delete(pm.pulls, key)
+		pm.lock.Unlock()
+	}()
+
+	rawURL := strings.ReplaceAll(source.URL, "{stream}", stream)
+	if source.URL == "" {
+		l, _ := currentLocator()
+		if l == nil {
+			return
+		}
+
+		located, err := l(ctx, ns.Name(), stream)
+		if err != nil {
+			logger.WithError(err).Info("stream not located")
+			return
+		}
+		rawURL = located
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		logger.WithError(err).Error("invalid source url")
+		return
+	}
+
+	puller, ok := lookupPuller(u.Scheme)
+	if !ok {
+		logger.WithField("scheme", u.Scheme).Error("no puller for source scheme")
+		return
+	}
+
+	hold := defaultPullHold
+	if source.HoldSeconds > 0 {
+		hold = time.Duration(source.HoldSeconds) * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if held {
+		go pm.hold(ctx, cancel, ns, stream, hold)
+	}
+
+	// the params are shown to hooks and the admin api, the url is only
+	// handed to the puller with its credentials
+	uri := *u
+	uri.User = nil
+
+	params := router.PeerParams{
+		RouterID:   stream,
+		Domain:     domain,
+		Namespace:  ns.Name(),
+		URI:        uri.String(),
+		RemoteAddr: u.Host,
+		PeerID:     "pull",
+		Protocol:   u.Scheme,
+		Producer:   true,
+	}
+
+	for {
+		logger.WithField("url", u.Redacted()).Info("pulling source")
+		err := puller(ctx, rawURL, params)
+		if ctx.Err() != nil {
+			logger.Info("pull stopped")
+			return
+		}
+
+		logger.WithError(err).Warn("pull failed, retrying")
+		select {
+		case <-ctx.Done():
+			return
+		case <-pm.clock.After(pullRetryInterval):
+		}
+	}
+}
+
+// quarantine stops pulling stream, a broken upstream is not pulled again
+// before the quarantine of its params ends.
+func (pm *pullManager) quarantine(ns *router.Namespace, stream string) {
+	if pm == nil {
+		return
+	}
+
+	duration := defaultQuarantine
+	if s := ns.RouterParams(stream).Health.QuarantineS; s > 0 {
+		duration = time.Duration(s) * time.Second
+	}
+
+	key := ns.Name() + "/" + stream
+
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	pm.quarantined[key] = pm.clock.Now().Add(duration)
+	if cancel, ok := pm.pulls[key]; ok {
+		pm.logger.WithField("stream", key).WithField("duration", duration).Warn("pull quarantined")
+		cancel()
+	}
+}
+
+// hold stops the pull once the stream has had no subscribers for hold.
+func (pm *pullManager) hold(ctx context.Context, cancel context.CancelFunc, ns *router.Namespace, stream string, hold time.Duration) {
+	ticker := pm.clock.NewTicker(pullSubscribersTicker)
+	defer ticker.Stop()
+
+	idleSince := pm.clock.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if r := ns.Router(stream); r != nil && r.SubscriberCount() > 0 {
+				idleSince = now
+				continue
+			}
+
+			if now.Sub(idleSince) >= hold {
+				pm.logger.WithField("stream", stream).Info("no subscribers left, stopping pull")
+				cancel()
+				return
+			}
+		}
+	}
+}
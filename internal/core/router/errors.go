@@ -10,6 +10,7 @@ var (
 	ErrSessionIdleTimeout   = errors.New("session idle timeout")
 	ErrProducerEmpty        = errors.New("producer empty")
 	ErrProducerRepeated     = errors.New("producer repeated")
+	ErrStreamPublished      = errors.New("stream already published")
 	ErrStreamFormatNotFound = errors.New("stream format not found")
 	ErrStreamClosed         = errors.New("stream closed")
 	ErrNilFrameDestination  = errors.New("nil frame destination")
@@ -17,4 +18,12 @@ var (
 	ErrStreamTimeout        = errors.New("stream timeout")
 	ErrFrameSourceExists    = errors.New("frame source exists")
 	ErrPaddingDestination   = errors.New("padding destination")
+	ErrSessionKicked        = errors.New("session kicked")
+	ErrStreamStopped        = errors.New("stream stopped")
+	ErrNoFailover           = errors.New("stream has no failover configured")
+	ErrDraining             = errors.New("node draining")
+	ErrSEIUnsupported       = errors.New("sei needs h264 or h265 video")
+	ErrSEITooLarge          = errors.New("sei payload too large")
+	ErrSEIQueueFull         = errors.New("too many sei pending")
+	ErrSubscriberNotFound   = errors.New("subscriber not found")
 )
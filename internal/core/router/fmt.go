@@ -4,7 +4,10 @@ import (
 	"context"
 
 	sourcemanager "github.com/pingostack/neon/internal/core/router/source_manager"
+	"github.com/pingostack/neon/pkg/codec"
 	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/transcoder"
+	"github.com/sirupsen/logrus"
 )
 
 type StreamFormat interface {
@@ -13,9 +16,19 @@ type StreamFormat interface {
 
 type StreamFormatImpl struct {
 	deliver.MediaFramePipe
-	ctx    context.Context
-	cancel context.CancelFunc
-	sm     *sourcemanager.Instance
+	ctx       context.Context
+	cancel    context.CancelFunc
+	sm        *sourcemanager.Instance
+	src       deliver.FrameSource
+	transcode *deliver.AudioMetadata
+	rebaser   *deliver.Rebaser
+	inspector *VideoInspector
+	sei       *seiInjector
+	audioOnly bool
+	// the audio track of the source the destinations get as theirs
+	audioTrack int
+	fanout     deliver.FanoutOptions
+	logger     *logrus.Entry
 }
 
 type StreamFormatOption func(*StreamFormatImpl)
@@ -26,8 +39,56 @@ func WithFrameSourceManager(sm *sourcemanager.Instance) StreamFormatOption {
 	}
 }
 
+// WithSource feeds the format from src instead of the default source of the
+// frame source manager.
+func WithSource(src deliver.FrameSource) StreamFormatOption {
+	return func(fmt *StreamFormatImpl) {
+		fmt.src = src
+	}
+}
+
+// WithAudioTranscode converts the audio of the source to out.
+func WithAudioTranscode(out deliver.AudioMetadata, logger *logrus.Entry) StreamFormatOption {
+	return func(fmt *StreamFormatImpl) {
+		fmt.transcode = &out
+		fmt.logger = logger
+	}
+}
+
+// WithRebaser stamps the frames of the format on the hub clock of the
+// stream, see deliver.Rebaser.
+func WithRebaser(opts deliver.RebaserOptions) StreamFormatOption {
+	return func(fmt *StreamFormatImpl) {
+		fmt.rebaser = deliver.NewRebaser(opts)
+	}
+}
+
+// WithInspector inspects the video of the format, see VideoInspector.
+func WithInspector(in *VideoInspector) StreamFormatOption {
+	return func(fmt *StreamFormatImpl) {
+		fmt.inspector = in
+	}
+}
+
+// WithAudioTrack feeds the destinations with audio track i of the source
+// instead of the first, see deliver.Metadata.AudioTracks.
+func WithAudioTrack(i int) StreamFormatOption {
+	return func(fmt *StreamFormatImpl) {
+		fmt.audioTrack = i
+	}
+}
+
+// WithAudioOnly drops the video of the source, the destinations of the
+// format are fed with fanout.
+func WithAudioOnly(fanout deliver.FanoutOptions) StreamFormatOption {
+	return func(fmt *StreamFormatImpl) {
+		fmt.audioOnly = true
+		fmt.fanout = fanout
+	}
+}
+
 func NewStreamFormat(ctx context.Context, fmtSettings deliver.FormatSettings, opts ...StreamFormatOption) (StreamFormat, error) {
-	fmt := &StreamFormatImpl{}
+	fmt := &StreamFormatImpl{sei: newSEIInjector()}
 
 	fmt.ctx, fmt.cancel = context.WithCancel(ctx)
 
@@ -37,17 +98,88 @@ func NewStreamFormat(ctx context.Context, fmtSettings deliver.FormatSettings, op
 		opt(fmt)
 	}
 
-	if fmt.sm.DefaultSource() == nil {
+	if fmt.src == nil {
+		fmt.src = fmt.sm.DefaultSource()
+	}
+
+	if fmt.src == nil {
+		fmt.cancel()
 		return nil, ErrNilFrameSource
 	}
 
-	fmt.MediaFramePipe = deliver.NewMediaFramePipe(ctx, fmtSettings)
+	if fmt.transcode != nil {
+		t, err := transcoder.NewAudioTranscoder(ctx, fmtSettings, *fmt.transcode, fmt.logger)
+		if err != nil {
+			fmt.cancel()
+			return nil, err
+		}
+		fmt.MediaFramePipe = t
+	} else {
+		fmt.MediaFramePipe = deliver.NewFanoutMediaFramePipe(ctx, fmtSettings, fmt.fanout)
+	}
 
-	deliver.AddDestination(fmt.sm.DefaultSource(), fmt)
+	deliver.AddDestination(fmt.src, fmt)
 
 	return fmt, nil
 }
 
+func (fmt *StreamFormatImpl) OnMetaData(metadata *deliver.Metadata) {
+	// the destinations get one audio track
+	if len(metadata.AudioTracks) > 0 {
+		md := *metadata
+		md.Audio, md.AudioTracks = md.AudioTrack(fmt.audioTrack), nil
+		if md.Audio == nil {
+			md.Audio = metadata.Audio
+		}
+		metadata = &md
+	}
+
+	if fmt.rebaser != nil && metadata.HasAudio() {
+		fmt.rebaser.SetAudioRate(metadata.Audio.SampleRate)
+	}
+
+	if fmt.audioOnly && metadata.Video != nil {
+		md := *metadata
+		md.Video = nil
+		metadata = &md
+	}
+
+	fmt.MediaFramePipe.OnMetaData(metadata)
+}
+
+func (fmt *StreamFormatImpl) OnFrame(frame deliver.Frame, attr deliver.Attributes) {
+	if fmt.inspector != nil {
+		frame = fmt.inspector.Inspect(frame)
+	}
+
+	if fmt.audioOnly && frame.Codec.IsVideo() {
+		return
+	}
+
+	if frame.Codec.IsAudio() {
+		if frame.Track != fmt.audioTrack {
+			return
+		}
+		frame.Track = 0
+	}
+
+	if fmt.rebaser != nil {
+		frame = fmt.rebaser.Rebase(frame)
+	}
+
+	before, frame := fmt.sei.inject(frame)
+	for _, f := range before {
+		fmt.MediaFramePipe.OnFrame(f, attr)
+	}
+
+	fmt.MediaFramePipe.OnFrame(frame, attr)
+}
+
+// InjectSEI puts ud into the next frames of the video of the format.
+func (fmt *StreamFormatImpl) InjectSEI(ud codec.UserData, frames int) error {
+	return fmt.sei.add(ud, frames)
+}
+
 func (fmt *StreamFormatImpl) Close() {
 	fmt.MediaFramePipe.Close()
 	fmt.cancel()
@@ -0,0 +1,92 @@
+package router
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/pingostack/neon/pkg/codec"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pion/rtp"
+)
+
+// VideoInspector reads the bitstream of the h264 and h265 frames of a
+// stream, it flags the keyframes of raw frames that came without and keeps
+// what the last sps tells.
+type VideoInspector struct {
+	lock sync.Mutex
+	sps  []byte
+	info *codec.SPS
+	// rejected is the last sps that failed to parse, not parsed again
+	rejected []byte
+}
+
+func NewVideoInspector() *VideoInspector {
+	return &VideoInspector{}
+}
+
+// Inspect returns frame with its keyframe flag set.
+func (in *VideoInspector) Inspect(frame deliver.Frame) deliver.Frame {
+	if frame.Codec != deliver.CodecTypeH264 && frame.Codec != deliver.CodecTypeH265 {
+		return frame
+	}
+
+	if p, ok := frame.RawPacket.(*rtp.Packet); ok {
+		for _, nalu := range codec.SplitRTP(frame.Codec, p.Payload) {
+			in.observe(frame.Codec, nalu)
+		}
+		return frame
+	}
+
+	if frame.PacketType != deliver.PacketTypeRaw {
+		return frame
+	}
+
+	keyframe := false
+	codec.ForEachAnnexB(frame.Payload, func(nalu []byte) bool {
+		keyframe = keyframe || codec.IsKeyframeNALU(frame.Codec, nalu)
+		in.observe(frame.Codec, nalu)
+		return true
+	})
+
+	if _, ok := frame.AdditionalInfo.(*deliver.VideoFrameSpecificInfo); !ok {
+		frame.AdditionalInfo = &deliver.VideoFrameSpecificInfo{IsKeyFrame: keyframe}
+	}
+
+	return frame
+}
+
+func (in *VideoInspector) observe(c deliver.CodecType, nalu []byte) {
+	typ := codec.NALUType(c, nalu)
+	if !(c == deliver.CodecTypeH264 && typ == codec.H264NALUTypeSPS) &&
+		!(c == deliver.CodecTypeH265 && typ == codec.H265NALUTypeSPS) {
+		return
+	}
+
+	in.lock.Lock()
+	defer in.lock.Unlock()
+
+	// encoders repeat the sps with every keyframe
+	if bytes.Equal(nalu, in.sps) || bytes.Equal(nalu, in.rejected) {
+		return
+	}
+
+	info, err := codec.ParseSPS(c, nalu)
+	if err != nil {
+		in.rejected = append(in.rejected[:0], nalu...)
+		return
+	}
+	in.sps, in.info = append([]byte(nil), nalu...), info
+}
+
+// Info returns what the last sps of the stream tells, nil before one.
+func (in *VideoInspector) Info() *codec.SPS {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+
+	if in.info == nil {
+		return nil
+	}
+
+	info := *in.info
+	return &info
+}
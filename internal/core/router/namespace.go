@@ -4,13 +4,76 @@ import (
 	"context"
 	"sync"
 
+	"github.com/pingostack/neon/pkg/metrics"
 	"github.com/sirupsen/logrus"
 )
 
+type FailoverParams struct {
+	// Backup is the stream path the backup publisher uses.
+	Backup    string `yaml:"backup" json:"backup" mapstructure:"backup"`
+	TimeoutMs int    `yaml:"timeout_ms" json:"timeout_ms" mapstructure:"timeout_ms"`
+	RecoverMs int    `yaml:"recover_ms" json:"recover_ms" mapstructure:"recover_ms"`
+}
+
+// Policies for a publisher of a stream that is already published.
+const (
+	// DuplicateKick replaces the publisher, the default.
+	DuplicateKick = "kick"
+	// DuplicateReject keeps the publisher and fails the new one.
+	DuplicateReject = "reject"
+	// DuplicateSuffix publishes the new one to the first free path of
+	// <path>_2, <path>_3...
+	DuplicateSuffix = "suffix"
+)
+
+// TimestampParams tune the rebasing of the timestamps of publishers on the
+// hub clock, see deliver.Rebaser.
+type TimestampParams struct {
+	Disable    bool `yaml:"disable" json:"disable" mapstructure:"disable"`
+	MaxJumpMs  int  `yaml:"max_jump_ms" json:"max_jump_ms" mapstructure:"max_jump_ms"`
+	MaxDriftMs int  `yaml:"max_drift_ms" json:"max_drift_ms" mapstructure:"max_drift_ms"`
+	// MaxSyncMs bounds the lip sync error of publishers sending sender
+	// reports.
+	MaxSyncMs int `yaml:"max_sync_ms" json:"max_sync_ms" mapstructure:"max_sync_ms"`
+}
+
+// KeyframeParams bound the keyframe interval of publishers, see
+// deliver.WatchGOP. Request is pli or fir, empty only warns.
+type KeyframeParams struct {
+	MaxIntervalMs int    `yaml:"max_interval_ms" json:"max_interval_ms" mapstructure:"max_interval_ms"`
+	Request       string `yaml:"request" json:"request" mapstructure:"request"`
+}
+
+// HealthParams judge the health score of publishers, see deliver.Health. A
+// publisher scoring below MinScore is unhealthy, one unhealthy for
+// QuarantineAfterS is quarantined: pulls of the stream stop for QuarantineS.
+// A MinScore of 0 disables both.
+type HealthParams struct {
+	MinScore         int `yaml:"min_score" json:"min_score" mapstructure:"min_score"`
+	QuarantineAfterS int `yaml:"quarantine_after_s" json:"quarantine_after_s" mapstructure:"quarantine_after_s"`
+	QuarantineS      int `yaml:"quarantine_s" json:"quarantine_s" mapstructure:"quarantine_s"`
+}
+
+// AudioOnlyParams tune the format shared by subscribers taking no video,
+// e.g. the listeners of a radio over webrtc. Video is dropped before their
+// fan-out and they get no video track, RingSize and BatchMs are its
+// deliver.FanoutOptions. Disable feeds them like any other subscriber.
+type AudioOnlyParams struct {
+	Disable  bool `yaml:"disable" json:"disable" mapstructure:"disable"`
+	RingSize int  `yaml:"ring_size" json:"ring_size" mapstructure:"ring_size"`
+	BatchMs  int  `yaml:"batch_ms" json:"batch_ms" mapstructure:"batch_ms"`
+}
+
 type RouterParams struct {
-	IdleSubscriberTimeout int `yaml:"idle_subscriber_timeout" json:"idle_subscriber_timeout" mapstructure:"idle_subscriber_timeout"`
-	MaxProducerTimeout    int `yaml:"max_producer_timeout" json:"max_producer_timeout" mapstructure:"max_producer_timeout"`
-	MaxSubscriberTimeout  int `yaml:"max_subscriber_timeout" json:"max_subscriber_timeout" mapstructure:"max_subscriber_timeout"`
+	IdleSubscriberTimeout int             `yaml:"idle_subscriber_timeout" json:"idle_subscriber_timeout" mapstructure:"idle_subscriber_timeout"`
+	MaxProducerTimeout    int             `yaml:"max_producer_timeout" json:"max_producer_timeout" mapstructure:"max_producer_timeout"`
+	MaxSubscriberTimeout  int             `yaml:"max_subscriber_timeout" json:"max_subscriber_timeout" mapstructure:"max_subscriber_timeout"`
+	Failover              FailoverParams  `yaml:"failover" json:"failover" mapstructure:"failover"`
+	DuplicatePublisher    string          `yaml:"duplicate_publisher" json:"duplicate_publisher" mapstructure:"duplicate_publisher"`
+	Timestamps            TimestampParams `yaml:"timestamps" json:"timestamps" mapstructure:"timestamps"`
+	Keyframes             KeyframeParams  `yaml:"keyframes" json:"keyframes" mapstructure:"keyframes"`
+	Health                HealthParams    `yaml:"health" json:"health" mapstructure:"health"`
+	AudioOnly             AudioOnlyParams `yaml:"audio_only" json:"audio_only" mapstructure:"audio_only"`
 }
 
 type NamespaceParams struct {
@@ -67,6 +130,16 @@ func (ns *Namespace) Router(name string) Router {
 	return ns.routers[name]
 }
 
+func (ns *Namespace) Routers() []Router {
+	ns.lock.RLock()
+	defer ns.lock.RUnlock()
+	routers := make([]Router, 0, len(ns.routers))
+	for _, r := range ns.routers {
+		routers = append(routers, r)
+	}
+	return routers
+}
+
 func (ns *Namespace) GetOrNewRouter(id string) (Router, bool) {
 	ns.lock.Lock()
 	defer ns.lock.Unlock()
@@ -76,21 +149,29 @@ func (ns *Namespace) GetOrNewRouter(id string) (Router, bool) {
 			delete(ns.routers, id)
 		}
 
-		routerParams := ns.params.DefaultRouterParams
-		if params, ok := ns.params.RoutersParams[id]; ok {
-			routerParams = params
-		}
-
-		router = NewRouter(ns.ctx, ns, routerParams, id, ns.logger)
+		router = NewRouter(ns.ctx, ns, ns.RouterParams(id), id, ns.logger)
 		ns.routers[id] = router
+		metrics.ActiveStreams.With(ns.name).Inc()
 		go ns.waitRouterDone(router)
 	}
 
 	return router, !ok
 }
 
+// RouterParams returns the params of the stream id, the default ones when
+// it has none of its own.
+func (ns *Namespace) RouterParams(id string) RouterParams {
+	if params, ok := ns.params.RoutersParams[id]; ok {
+		return params
+	}
+
+	return ns.params.DefaultRouterParams
+}
+
 func (ns *Namespace) waitRouterDone(router Router) {
 	<-router.Context().Done()
+	metrics.ActiveStreams.With(ns.name).Dec()
+
 	ns.lock.Lock()
 	defer ns.lock.Unlock()
 
@@ -98,6 +179,17 @@ func (ns *Namespace) waitRouterDone(router Router) {
 	ns.logger.Infof("router %s removed", router.ID())
 }
 
+// BackupOf returns the stream a backup publish path feeds.
+func (ns *Namespace) BackupOf(path string) (string, bool) {
+	for id, params := range ns.params.RoutersParams {
+		if params.Failover.Backup == path {
+			return id, true
+		}
+	}
+
+	return "", false
+}
+
 func (ns *Namespace) HasDomain(domain string) bool {
 	ns.lock.RLock()
 	defer ns.lock.RUnlock()
@@ -39,7 +39,9 @@ func (m *NSManager) GetOrNewNamespace(ctx context.Context, name string) (*Namesp
 			Name: name,
 		}
 
-		if params, ok = m.params.Namespaces[name]; !ok && m.params.DefaultNamespaceParams != nil {
+		if configured, found := m.params.Namespaces[name]; found {
+			params = configured
+		} else if m.params.DefaultNamespaceParams != nil {
 			params = *m.params.DefaultNamespaceParams
 			params.Name = name
 		}
@@ -2,6 +2,7 @@ package router
 
 import (
 	"context"
+	"time"
 
 	"github.com/pingostack/neon/pkg/deliver"
 	"github.com/sirupsen/logrus"
@@ -13,9 +14,12 @@ type PeerParams struct {
 	PacketType     deliver.PacketType `json:"packet_type"`
 	RemoteAddr     string
 	LocalAddr      string
+	Protocol       string // Protocol of the session, e.g. webrtc or rtsp
 	PeerID         string
 	RouterID       string
 	Domain         string
+	Namespace      string // Namespace, when set, is joined instead of the one of Domain
+	Tenant         string // Tenant is the tenant the credentials of the peer name, see vhost
 	URI            string // URI is the path of the request, e.g. /live/room1
 	Args           map[string]string
 	Producer       bool
@@ -24,6 +28,19 @@ type PeerParams struct {
 	HasDataChannel bool
 }
 
+// SessionKeyBackup marks a producer session as the backup publisher of its
+// stream, see FailoverParams.
+const SessionKeyBackup = "router.backup"
+
+// SessionKeyFallbackOf is the stream a subscriber asked for while it plays the
+// fallback stream, see RoutesSettings.Fallback.
+const SessionKeyFallbackOf = "router.fallbackOf"
+
+func IsBackupSession(s Session) bool {
+	backup, _ := s.Get(SessionKeyBackup).(bool)
+	return backup && s.PeerParams().Producer
+}
+
 type Session interface {
 	ID() string
 	Set(key, value interface{})
@@ -37,9 +54,11 @@ type Session interface {
 	PeerParams() PeerParams
 	Finalize(e error)
 	RouterID() string
+	SetRouterID(id string)
 	BindFrameSource(src deliver.FrameSource) error
 	BindFrameDestination(dest deliver.FrameDestination) error
 	FrameSource() deliver.FrameSource
 	FrameDestination() deliver.FrameDestination
 	Join() error
+	CreatedAt() time.Time
 }
@@ -0,0 +1,66 @@
+package router
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pingostack/neon/pkg/deliver"
+)
+
+// Processor changes the frames of a stream on their way to its destinations,
+// e.g. draws an overlay on the video. It is a destination of the source of
+// the stream and the source of its formats.
+type Processor interface {
+	deliver.FrameDestination
+	deliver.FrameSource
+}
+
+// ProcessorFactory returns the processor of namespace/stream, nil leaves its
+// frames as they are.
+type ProcessorFactory func(ctx context.Context, namespace, stream string) (Processor, error)
+
+var (
+	processorFactory ProcessorFactory
+	processorLock    sync.RWMutex
+)
+
+// SetProcessorFactory is consulted when a stream gets its first destination,
+// nil removes it. Streams keep the processor they got.
+func SetProcessorFactory(f ProcessorFactory) {
+	processorLock.Lock()
+	defer processorLock.Unlock()
+
+	processorFactory = f
+}
+
+// source is what the formats of the stream are fed from, the processor of
+// the stream if it has one. Must be called with s.lock held.
+func (s *StreamImpl) source() deliver.FrameSource {
+	if !s.processorChecked {
+		s.processorChecked = true
+
+		processorLock.RLock()
+		f := processorFactory
+		processorLock.RUnlock()
+
+		if f != nil {
+			p, err := f(s.ctx, s.namespace, s.id)
+			if err != nil {
+				s.logger.WithError(err).Error("failed to create stream processor, frames left as they are")
+			} else if p != nil {
+				if err := deliver.AddDestination(s.sm.DefaultSource(), p); err != nil {
+					s.logger.WithError(err).Error("failed to attach stream processor")
+					p.Close()
+				} else {
+					s.processor = p
+				}
+			}
+		}
+	}
+
+	if s.processor != nil {
+		return s.processor
+	}
+
+	return s.sm.DefaultSource()
+}
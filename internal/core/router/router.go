@@ -6,8 +6,14 @@ import (
 	"time"
 
 	"github.com/gogf/gf/os/gtimer"
+	"github.com/pingostack/neon/pkg/capture"
+	"github.com/pingostack/neon/pkg/codec"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/trace"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
 type Router interface {
@@ -16,6 +22,34 @@ type Router interface {
 	Namespace() *Namespace
 	Context() context.Context
 	Closed() bool
+	Producer() Session
+	Backup() Session
+	OnFailover(f func(backup bool))
+	OnGOPExceeded(f func(interval time.Duration))
+	// OnHealth is called when the publisher turns unhealthy, recovers or is
+	// quarantined.
+	OnHealth(f func(event HealthEvent, h deliver.Health))
+	// Health is the last score of the publisher, false before one.
+	Health() (deliver.Health, bool)
+	// OnSubscribers is called whenever a subscriber joined or left. The
+	// first callback set is called once for the subscribers already there.
+	OnSubscribers(f func(prev, count int))
+	Subscribers() []Session
+	// RemoveSubscriber takes s off the stream without ending it, e.g. to
+	// move it to another one, false when it is no subscriber.
+	RemoveSubscriber(s Session) bool
+	SubscriberCount() int
+	PeakSubscriberCount() int
+	// VideoInfo is what the bitstream of the video of the stream tells.
+	VideoInfo() *codec.SPS
+	// InjectSEI puts user data into the next frames of the video played
+	// to the subscribers.
+	InjectSEI(ud codec.UserData, frames int) error
+	// RefreshSubscriber plays the stream to a subscriber by the format
+	// settings of its destination again, after they changed.
+	RefreshSubscriber(s Session) error
+	CreatedAt() time.Time
+	Close(e error)
 }
 
 type RouterImpl struct {
@@ -24,6 +58,7 @@ type RouterImpl struct {
 	id          string
 	ns          *Namespace
 	producer    Session
+	backup      Session
 	subscribers map[string]Session
 	lock        sync.RWMutex
 	logger      *logrus.Entry
@@ -31,8 +66,13 @@ type RouterImpl struct {
 	params      RouterParams
 	closeTimer  *gtimer.Entry
 	stream      Stream
+	createdAt   time.Time
+	peak        int
+	onSubscribe func(prev, count int)
 }
 
+// NewRouter is called with the lock of ns held, the name of ns is read as is
+// since it never changes.
 func NewRouter(ctx context.Context, ns *Namespace, params RouterParams, id string, logger *logrus.Entry) Router {
 	r := &RouterImpl{
 		ns:          ns,
@@ -40,7 +80,8 @@ func NewRouter(ctx context.Context, ns *Namespace, params RouterParams, id strin
 		id:          id,
 		subscribers: make(map[string]Session),
 		logger:      logger.WithField("obj", "router"),
-		stream:      NewStreamImpl(ctx, id),
+		stream:      NewStreamImpl(ctx, ns.name, id, params),
+		createdAt:   time.Now(),
 	}
 
 	r.ctx, r.cancel = context.WithCancel(ctx)
@@ -68,13 +109,32 @@ func (r *RouterImpl) addProducer(s Session) error {
 		r.closeTimer = nil
 	}
 
+	if IsBackupSession(s) {
+		return r.addBackup(s)
+	}
+
 	if r.producer != nil {
+		if r.producer.ID() == s.ID() {
+			return ErrSessionAlreadyExists
+		}
+
+		switch r.params.DuplicatePublisher {
+		case DuplicateReject, DuplicateSuffix:
+			r.logger.Warnf("producer %s rejected, stream published by %s", s.ID(), r.producer.ID())
+			return ErrStreamPublished
+		}
+
+		// the source of the old publisher leaves before the new one joins,
+		// both would feed the subscribers otherwise
+		r.logger.Infof("producer %s replaced by %s", r.producer.ID(), s.ID())
 		r.producer.Finalize(ErrProducerRepeated)
+		r.stream.RemoveFrameSource(r.producer.FrameSource())
 	}
 
 	r.producer = s
 
 	if err := r.stream.AddFrameSource(s.FrameSource()); err != nil {
+		r.producer = nil
 		r.logger.WithError(err).Error("failed to add frame source")
 		return errors.Wrap(err, "failed to add frame source")
 	}
@@ -84,9 +144,33 @@ func (r *RouterImpl) addProducer(s Session) error {
 	return nil
 }
 
-func (r *RouterImpl) addSubscriber(s Session) error {
+// addBackup must be called with r.lock held.
+func (r *RouterImpl) addBackup(s Session) error {
+	if r.backup != nil {
+		r.backup.Finalize(ErrProducerRepeated)
+	}
+
+	r.backup = s
+
+	if err := r.stream.AddBackupFrameSource(s.FrameSource()); err != nil {
+		r.logger.WithError(err).Error("failed to add backup frame source")
+		return errors.Wrap(err, "failed to add backup frame source")
+	}
+
+	go r.waitSessionDone(s)
+
+	return nil
+}
+
+func (r *RouterImpl) addSubscriber(ctx context.Context, s Session) error {
+	var notify func()
 	r.lock.Lock()
-	defer r.lock.Unlock()
+	defer func() {
+		r.lock.Unlock()
+		if notify != nil {
+			notify()
+		}
+	}()
 
 	if r.closed {
 		return ErrRouterClosed
@@ -97,8 +181,13 @@ func (r *RouterImpl) addSubscriber(s Session) error {
 	}
 
 	r.subscribers[s.ID()] = s
+	notify = r.subscribersChanged(len(r.subscribers) - 1)
 
-	if err := r.stream.AddFrameDestination(s.FrameDestination()); err != nil {
+	_, span := trace.Start(ctx, "stream.fanout")
+	err := r.stream.AddFrameDestination(s.FrameDestination())
+	trace.RecordError(span, err)
+	span.End()
+	if err != nil {
 		return errors.Wrap(err, "failed to add frame destination")
 	}
 
@@ -107,78 +196,197 @@ func (r *RouterImpl) addSubscriber(s Session) error {
 	return nil
 }
 
-func (r *RouterImpl) AddSession(s Session) error {
+func (r *RouterImpl) AddSession(s Session) (err error) {
+	name := "router.subscribe"
 	if s.PeerParams().Producer {
-		return r.addProducer(s)
-	} else {
-		return r.addSubscriber(s)
+		name = "router.publish"
 	}
-}
 
-func (r *RouterImpl) waitSessionDone(s Session) {
-	<-s.Context().Done()
+	ctx, span := trace.Start(s.Context(), name, oteltrace.WithAttributes(
+		attribute.String("stream", r.id),
+		attribute.String("session", s.ID())))
+	defer func() {
+		trace.RecordError(span, err)
+		span.End()
 
-	close := func(e error) {
-		if r.closed {
+		if err != nil {
+			r.record(s.ID(), "session rejected", map[string]interface{}{"error": err.Error()})
 			return
 		}
+		r.record(s.ID(), "session joined", map[string]interface{}{
+			"producer": s.PeerParams().Producer,
+			"protocol": s.PeerParams().Protocol,
+			"remote":   s.PeerParams().RemoteAddr,
+		})
+	}()
 
-		r.closed = true
-		r.cancel()
+	if s.PeerParams().Producer {
+		return r.addProducer(s)
+	} else {
+		return r.addSubscriber(ctx, s)
+	}
+}
 
-		if r.producer != nil {
-			r.producer.Finalize(e)
+func (r *RouterImpl) RemoveSubscriber(s Session) bool {
+	var notify func()
+	r.lock.Lock()
+	defer func() {
+		r.lock.Unlock()
+		if notify != nil {
+			notify()
 		}
+	}()
 
-		for _, s := range r.subscribers {
-			s.Finalize(e)
-		}
+	if _, ok := r.subscribers[s.ID()]; !ok {
+		return false
+	}
+
+	delete(r.subscribers, s.ID())
+	notify = r.subscribersChanged(len(r.subscribers) + 1)
+	r.stream.RemoveFrameDestination(s.FrameDestination())
+	r.record(s.ID(), "session moved", nil)
 
-		r.logger.Infof("router closed")
+	if len(r.subscribers) == 0 && r.producer == nil && r.backup == nil {
+		r.logger.Infof("no producer and subscribers, close router")
+		r.close(nil)
 	}
 
+	return true
+}
+
+func (r *RouterImpl) waitSessionDone(s Session) {
+	<-s.Context().Done()
+	r.record(s.ID(), "session left", nil)
+
 	delayClose := func() {
 		r.closeTimer = gtimer.AddOnce(time.Duration(r.params.IdleSubscriberTimeout)*time.Second, func() {
 			r.lock.Lock()
 			defer r.lock.Unlock()
 
-			if r.producer != nil {
+			if r.producer == nil {
 				r.logger.Infof("router idle timeout")
-				close(ErrSessionIdleTimeout)
+				r.close(ErrSessionIdleTimeout)
 			}
 		})
 		r.closeTimer.Start()
 	}
 
+	var notify func()
 	r.lock.Lock()
-	defer r.lock.Unlock()
+	defer func() {
+		r.lock.Unlock()
+		if notify != nil {
+			notify()
+		}
+	}()
+
+	if IsBackupSession(s) {
+		if r.backup != s {
+			return
+		}
+
+		r.backup = nil
+		r.logger.Infof("backup producer %s removed", s.ID())
+	} else if s.PeerParams().Producer {
+		if r.producer != s {
+			// already replaced by a reconnected publisher
+			return
+		}
 
-	if s.PeerParams().Producer {
 		r.producer = nil
 		r.logger.Infof("producer %s removed", s.ID())
-		if len(r.subscribers) > 0 {
+		if len(r.subscribers) > 0 && r.backup == nil {
 			if r.params.IdleSubscriberTimeout > 0 {
 				delayClose()
 				return
 			} else if r.params.IdleSubscriberTimeout == 0 {
 				r.logger.Infof("router idle timeout is 0, close router")
-				close(ErrProducerEmpty)
+				r.close(ErrProducerEmpty)
 				return
 			} else {
 				r.logger.Debugf("router idle timeout disabled, keep router")
 			}
 		}
 	} else {
-		delete(r.subscribers, s.ID())
+		if _, ok := r.subscribers[s.ID()]; ok {
+			delete(r.subscribers, s.ID())
+			notify = r.subscribersChanged(len(r.subscribers) + 1)
+		}
 		r.logger.Infof("subscriber %s removed", s.ID())
 	}
 
-	if len(r.subscribers) == 0 && r.producer == nil {
+	if len(r.subscribers) == 0 && r.producer == nil && r.backup == nil {
 		r.logger.Infof("no producer and subscribers, close router")
-		close(nil)
+		r.close(nil)
+	}
+}
+
+// subscribersChanged must be called with r.lock held, the returned func
+// reports the change once the lock is released.
+func (r *RouterImpl) subscribersChanged(prev int) func() {
+	count := len(r.subscribers)
+	if count > r.peak {
+		r.peak = count
+	}
+
+	f := r.onSubscribe
+	if f == nil {
+		return nil
+	}
+
+	return func() {
+		f(prev, count)
 	}
 }
 
+// close must be called with r.lock held
+func (r *RouterImpl) close(e error) {
+	if r.closed {
+		return
+	}
+
+	r.closed = true
+	r.cancel()
+
+	data := map[string]interface{}{}
+	if e != nil {
+		data["reason"] = e.Error()
+	}
+	r.record("", "router closed", data)
+
+	if r.producer != nil {
+		r.producer.Finalize(e)
+	}
+
+	if r.backup != nil {
+		r.backup.Finalize(e)
+	}
+
+	for _, s := range r.subscribers {
+		s.Finalize(e)
+	}
+
+	r.logger.Infof("router closed")
+}
+
+// record adds a state change of the stream to its captures, see package
+// capture.
+func (r *RouterImpl) record(session, message string, data map[string]interface{}) {
+	target := capture.Target{Stream: r.id, Session: session}
+	if r.ns != nil {
+		target.Namespace = r.ns.Name()
+	}
+
+	capture.Record(target, capture.KindState, message, data)
+}
+
+func (r *RouterImpl) Close(e error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.close(e)
+}
+
 func (r *RouterImpl) Namespace() *Namespace {
 	return r.ns
 }
@@ -190,3 +398,95 @@ func (r *RouterImpl) Context() context.Context {
 func (r *RouterImpl) Closed() bool {
 	return r.closed
 }
+
+func (r *RouterImpl) Producer() Session {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.producer
+}
+
+func (r *RouterImpl) Backup() Session {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.backup
+}
+
+func (r *RouterImpl) OnFailover(f func(backup bool)) {
+	r.stream.OnFailover(f)
+}
+
+func (r *RouterImpl) OnGOPExceeded(f func(interval time.Duration)) {
+	r.stream.OnGOPExceeded(f)
+}
+
+func (r *RouterImpl) OnHealth(f func(event HealthEvent, h deliver.Health)) {
+	r.stream.OnHealth(f)
+}
+
+func (r *RouterImpl) Health() (deliver.Health, bool) {
+	return r.stream.Health()
+}
+
+func (r *RouterImpl) OnSubscribers(f func(prev, count int)) {
+	r.lock.Lock()
+	first := r.onSubscribe == nil
+	r.onSubscribe = f
+	count := len(r.subscribers)
+	r.lock.Unlock()
+
+	// the subscribers added before the first callback count as joined now
+	if first && count > 0 && f != nil {
+		f(0, count)
+	}
+}
+
+func (r *RouterImpl) Subscribers() []Session {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	subscribers := make([]Session, 0, len(r.subscribers))
+	for _, s := range r.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	return subscribers
+}
+
+func (r *RouterImpl) SubscriberCount() int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return len(r.subscribers)
+}
+
+// PeakSubscriberCount is the most subscribers the stream had at once.
+func (r *RouterImpl) PeakSubscriberCount() int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.peak
+}
+
+func (r *RouterImpl) VideoInfo() *codec.SPS {
+	return r.stream.VideoInfo()
+}
+
+func (r *RouterImpl) InjectSEI(ud codec.UserData, frames int) error {
+	return r.stream.InjectSEI(ud, frames)
+}
+
+func (r *RouterImpl) RefreshSubscriber(s Session) error {
+	r.lock.RLock()
+	_, ok := r.subscribers[s.ID()]
+	closed := r.closed
+	r.lock.RUnlock()
+
+	if closed {
+		return ErrRouterClosed
+	}
+	if !ok {
+		return ErrSubscriberNotFound
+	}
+
+	return r.stream.RefreshFrameDestination(s.FrameDestination())
+}
+
+func (r *RouterImpl) CreatedAt() time.Time {
+	return r.createdAt
+}
@@ -0,0 +1,122 @@
+package router
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+type AliasRule struct {
+	Alias  string `yaml:"alias" json:"alias" mapstructure:"alias"`
+	Stream string `yaml:"stream" json:"stream" mapstructure:"stream"`
+}
+
+type RewriteRule struct {
+	Match   string `yaml:"match" json:"match" mapstructure:"match"`
+	Replace string `yaml:"replace" json:"replace" mapstructure:"replace"`
+}
+
+// TenantRule maps domains matching Match to a namespace, Namespace may refer
+// to submatches, e.g. "$1" for "^(.+)\.example\.com$".
+type TenantRule struct {
+	Match     string `yaml:"match" json:"match" mapstructure:"match"`
+	Namespace string `yaml:"namespace" json:"namespace" mapstructure:"namespace"`
+}
+
+type RouteSettings struct {
+	Aliases  []AliasRule   `yaml:"aliases" json:"aliases" mapstructure:"aliases"`
+	Rewrites []RewriteRule `yaml:"rewrites" json:"rewrites" mapstructure:"rewrites"`
+	Tenants  []TenantRule  `yaml:"tenants" json:"tenants" mapstructure:"tenants"`
+	Fallback string        `yaml:"fallback" json:"fallback" mapstructure:"fallback"`
+}
+
+type rewrite struct {
+	re      *regexp.Regexp
+	replace string
+}
+
+type tenant struct {
+	re        *regexp.Regexp
+	namespace string
+}
+
+type Routes struct {
+	aliases  map[string]string
+	rewrites []rewrite
+	tenants  []tenant
+	fallback string
+}
+
+func NewRoutes(settings RouteSettings) (*Routes, error) {
+	r := &Routes{
+		aliases:  make(map[string]string, len(settings.Aliases)),
+		fallback: settings.Fallback,
+	}
+
+	for _, rule := range settings.Aliases {
+		r.aliases[rule.Alias] = rule.Stream
+	}
+
+	for _, rule := range settings.Rewrites {
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid rewrite %q", rule.Match)
+		}
+		r.rewrites = append(r.rewrites, rewrite{re: re, replace: rule.Replace})
+	}
+
+	for _, rule := range settings.Tenants {
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid tenant %q", rule.Match)
+		}
+		r.tenants = append(r.tenants, tenant{re: re, namespace: rule.Namespace})
+	}
+
+	return r, nil
+}
+
+// Path returns the canonical stream path, aliases are resolved first, then
+// the first matching rewrite is applied.
+func (r *Routes) Path(path string) string {
+	if r == nil {
+		return path
+	}
+
+	if target, ok := r.aliases[path]; ok {
+		path = target
+	}
+
+	for _, rw := range r.rewrites {
+		if rw.re.MatchString(path) {
+			return rw.re.ReplaceAllString(path, rw.replace)
+		}
+	}
+
+	return path
+}
+
+// Namespace returns the tenant namespace of a domain, false when no tenant
+// rule matches and the domain lookup applies.
+func (r *Routes) Namespace(domain string) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+
+	for _, t := range r.tenants {
+		if m := t.re.FindStringSubmatchIndex(domain); m != nil {
+			return string(t.re.ExpandString(nil, t.namespace, domain, m)), true
+		}
+	}
+
+	return "", false
+}
+
+// Fallback is the stream played to subscribers of a path nobody publishes.
+func (r *Routes) Fallback() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.fallback
+}
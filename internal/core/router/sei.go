@@ -0,0 +1,143 @@
+package router
+
+import (
+	"sync"
+
+	"github.com/pingostack/neon/pkg/codec"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pion/rtp"
+)
+
+const (
+	// an sei has to fit a single rtp packet
+	MaxSEIPayload = 1024
+	// messages waiting for the next frames of a format
+	maxSEIQueue = 64
+)
+
+type seiMessage struct {
+	ud     codec.UserData
+	frames int
+	nalus  map[deliver.CodecType][]byte
+}
+
+// seiInjector puts user data sei in front of the next video frames of a
+// format. A raw frame gets it in its access unit, an rtp frame a packet of
+// its own before its first, the sequence numbers of the packets after it are
+// shifted for good.
+type seiInjector struct {
+	lock      sync.Mutex
+	queue     []*seiMessage
+	started   bool
+	lastTS    uint32
+	seqOffset uint16
+}
+
+func newSEIInjector() *seiInjector {
+	return &seiInjector{}
+}
+
+// add injects ud into the next frames, at least one.
+func (in *seiInjector) add(ud codec.UserData, frames int) error {
+	if len(ud.Payload) > MaxSEIPayload {
+		return ErrSEITooLarge
+	}
+	if frames < 1 {
+		frames = 1
+	}
+
+	in.lock.Lock()
+	defer in.lock.Unlock()
+
+	if len(in.queue) >= maxSEIQueue {
+		return ErrSEIQueueFull
+	}
+	in.queue = append(in.queue, &seiMessage{ud: ud, frames: frames, nalus: make(map[deliver.CodecType][]byte)})
+
+	return nil
+}
+
+// take returns the sei nal units of the frame about to be delivered.
+func (in *seiInjector) take(c deliver.CodecType) [][]byte {
+	var nalus [][]byte
+	queue := in.queue[:0]
+	for _, m := range in.queue {
+		nalu, ok := m.nalus[c]
+		if !ok {
+			var err error
+			if nalu, err = codec.NewUserDataSEI(c, m.ud); err != nil {
+				continue
+			}
+			m.nalus[c] = nalu
+		}
+		nalus = append(nalus, nalu)
+
+		if m.frames--; m.frames > 0 {
+			queue = append(queue, m)
+		}
+	}
+	in.queue = queue
+
+	return nalus
+}
+
+// inject returns the packets to deliver before frame and frame as it is
+// delivered.
+func (in *seiInjector) inject(frame deliver.Frame) ([]deliver.Frame, deliver.Frame) {
+	if frame.Codec != deliver.CodecTypeH264 && frame.Codec != deliver.CodecTypeH265 {
+		return nil, frame
+	}
+
+	in.lock.Lock()
+	defer in.lock.Unlock()
+
+	p, ok := frame.RawPacket.(*rtp.Packet)
+	if !ok {
+		if frame.PacketType == deliver.PacketTypeRaw && len(in.queue) > 0 {
+			for _, nalu := range in.take(frame.Codec) {
+				frame.Payload = codec.InsertNALU(frame.Codec, frame.Payload, nalu)
+			}
+			frame.Length = len(frame.Payload)
+		}
+		return nil, frame
+	}
+
+	first := !in.started || p.Timestamp != in.lastTS
+	in.started, in.lastTS = true, p.Timestamp
+
+	var before []deliver.Frame
+	if first && len(in.queue) > 0 {
+		keyframe := false
+		if info, ok := frame.AdditionalInfo.(*deliver.VideoFrameSpecificInfo); ok {
+			keyframe = info.IsKeyFrame
+		}
+
+		for _, nalu := range in.take(frame.Codec) {
+			packet := &rtp.Packet{Header: p.Header, Payload: nalu}
+			packet.Marker, packet.Padding, packet.PaddingSize = false, false, 0
+			packet.SequenceNumber += in.seqOffset
+			in.seqOffset++
+
+			before = append(before, in.packetFrame(frame, packet, &deliver.VideoFrameSpecificInfo{IsKeyFrame: keyframe}))
+		}
+	}
+
+	if in.seqOffset != 0 {
+		packet := *p
+		packet.SequenceNumber += in.seqOffset
+		frame = in.packetFrame(frame, &packet, frame.AdditionalInfo)
+	}
+
+	return before, frame
+}
+
+func (in *seiInjector) packetFrame(frame deliver.Frame, packet *rtp.Packet, info deliver.FrameSpecificInfo) deliver.Frame {
+	frame.RawPacket = packet
+	frame.Length = packet.MarshalSize()
+	frame.AdditionalInfo = info
+	if frame.Payload != nil {
+		frame.Payload, _ = packet.Marshal()
+	}
+
+	return frame
+}
@@ -38,7 +38,7 @@ func (i *Instance) RemoveSource(id string) {
 	defer i.lock.Unlock()
 
 	delete(i.sources, id)
-	if i.defaultSource.ID() == id {
+	if i.defaultSource != nil && i.defaultSource.ID() == id {
 		i.defaultSource = nil
 	}
 
@@ -2,10 +2,14 @@ package router
 
 import (
 	"context"
+	"strconv"
 	"sync"
+	"time"
 
 	sourcemanager "github.com/pingostack/neon/internal/core/router/source_manager"
+	"github.com/pingostack/neon/pkg/codec"
 	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/transcoder"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -13,7 +17,28 @@ import (
 type Stream interface {
 	GetFormat(fmtName string) (StreamFormat, error)
 	AddFrameSource(source deliver.FrameSource) error
+	RemoveFrameSource(source deliver.FrameSource)
+	AddBackupFrameSource(source deliver.FrameSource) error
+	OnFailover(f func(backup bool))
+	// OnGOPExceeded is called when a keyframe is late, see KeyframeParams.
+	OnGOPExceeded(f func(interval time.Duration))
+	// OnHealth is called when the publisher turns unhealthy, recovers or is
+	// quarantined, see HealthParams.
+	OnHealth(f func(event HealthEvent, h deliver.Health))
+	// Health is the last score of the publisher, false before one.
+	Health() (deliver.Health, bool)
 	AddFrameDestination(dest deliver.FrameDestination) (err error)
+	// RemoveFrameDestination stops playing the stream to dest.
+	RemoveFrameDestination(dest deliver.FrameDestination)
+	// RefreshFrameDestination moves dest to the format its format settings
+	// call for after they changed, e.g. with a renegotiation.
+	RefreshFrameDestination(dest deliver.FrameDestination) error
+	// VideoInfo is what the bitstream of the video tells, nil before a
+	// parameter set was seen.
+	VideoInfo() *codec.SPS
+	// InjectSEI puts ud into the next frames of the h264 or h265 video
+	// played to the subscribers.
+	InjectSEI(ud codec.UserData, frames int) error
 	Close()
 }
 
@@ -27,17 +52,58 @@ type StreamImpl struct {
 	logger       *logrus.Entry
 	sm           *sourcemanager.Instance
 	paddingDests []deliver.FrameDestination
+	switcher     *deliver.Switcher
+	onFailover   func(backup bool)
+	timestamps   TimestampParams
+	epoch        time.Time
+	inspector    *VideoInspector
+	keyframes    KeyframeParams
+	onGOP        func(interval time.Duration)
+	healthParams HealthParams
+	audioOnly    AudioOnlyParams
+	health       *deliver.Health
+	onHealth     func(event HealthEvent, h deliver.Health)
+	namespace    string
+	id           string
+	// the frames pass through it before the formats, see SetProcessorFactory
+	processor        Processor
+	processorChecked bool
 }
 
-func NewStreamImpl(ctx context.Context, id string) Stream {
+type HealthEvent int
+
+const (
+	HealthUnhealthy HealthEvent = iota + 1
+	HealthRecovered
+	HealthQuarantined
+)
+
+func NewStreamImpl(ctx context.Context, namespace, id string, params RouterParams) Stream {
 	s := &StreamImpl{
-		formats: make(map[string]StreamFormat),
-		logger:  logrus.WithField("stream", id),
-		sm:      sourcemanager.NewInstance(),
+		namespace: namespace,
+		id:        id,
+		formats:   make(map[string]StreamFormat),
+		logger:    logrus.WithField("stream", id),
+		sm:        sourcemanager.NewInstance(),
+		// the hub clock of the stream
+		timestamps:   params.Timestamps,
+		epoch:        time.Now(),
+		inspector:    NewVideoInspector(),
+		keyframes:    params.Keyframes,
+		healthParams: params.Health,
+		audioOnly:    params.AudioOnly,
 	}
 
 	s.ctx, s.cancel = context.WithCancel(ctx)
 
+	if params.Failover.Backup != "" {
+		s.switcher = deliver.NewSwitcher(s.ctx, deliver.SwitcherOptions{
+			Timeout:  time.Duration(params.Failover.TimeoutMs) * time.Millisecond,
+			Recover:  time.Duration(params.Failover.RecoverMs) * time.Millisecond,
+			OnSwitch: s.switched,
+		})
+	}
+
 	go func() {
 		<-ctx.Done()
 
@@ -83,22 +149,304 @@ func (s *StreamImpl) AddFrameSource(source deliver.FrameSource) error {
 		return ErrStreamClosed
 	}
 
+	if s.switcher != nil {
+		if err := s.switcher.SetPrimary(source); err != nil {
+			return errors.Wrap(err, "failed to set primary source")
+		}
+
+		s.watchGOP(source)
+		s.watchHealth(source)
+
+		s.addSwitcher()
+		return nil
+	}
+
 	if !s.sm.AddIfNotExist(source) {
 		return ErrFrameSourceExists
 	}
+	s.watchGOP(source)
+	s.watchHealth(source)
+
+	// a publisher coming back within the grace window feeds the formats its
+	// predecessor set up, subscribers stay attached
+	if s.processor != nil {
+		if err := deliver.AddDestination(source, s.processor); err != nil {
+			s.logger.WithError(err).Error("failed to reattach stream processor")
+		}
+	} else {
+		for name, format := range s.formats {
+			if err := deliver.AddDestination(source, format); err != nil {
+				s.logger.WithError(err).WithField("format", name).Error("failed to reattach format")
+			}
+		}
+	}
 
 	for _, dest := range s.paddingDests {
 		s.addFrameDestination(dest)
 	}
+	s.paddingDests = nil
+
+	go func() {
+		<-source.Context().Done()
+		s.sm.RemoveSource(source.ID())
+	}()
 
 	return nil
 }
 
+// RemoveFrameSource detaches the source of a replaced publisher at once,
+// without waiting for it to be closed.
+func (s *StreamImpl) RemoveFrameSource(source deliver.FrameSource) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.switcher == nil {
+		s.sm.RemoveSource(source.ID())
+	}
+}
+
+func (s *StreamImpl) AddBackupFrameSource(source deliver.FrameSource) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return ErrStreamClosed
+	}
+
+	if s.switcher == nil {
+		return ErrNoFailover
+	}
+
+	if err := s.switcher.SetBackup(source); err != nil {
+		return errors.Wrap(err, "failed to set backup source")
+	}
+
+	s.addSwitcher()
+
+	return nil
+}
+
+// addSwitcher makes the switcher the source of the stream once one of its
+// inputs is there, must be called with s.lock held.
+func (s *StreamImpl) addSwitcher() {
+	if !s.sm.AddIfNotExist(s.switcher) {
+		return
+	}
+
+	for _, dest := range s.paddingDests {
+		s.addFrameDestination(dest)
+	}
+	s.paddingDests = nil
+}
+
+func (s *StreamImpl) OnFailover(f func(backup bool)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.onFailover = f
+}
+
+func (s *StreamImpl) VideoInfo() *codec.SPS {
+	return s.inspector.Info()
+}
+
+func (s *StreamImpl) InjectSEI(ud codec.UserData, frames int) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.closed {
+		return ErrStreamClosed
+	}
+
+	src := s.sm.DefaultSource()
+	if src == nil {
+		return ErrProducerEmpty
+	}
+	if md := src.Metadata(); !md.HasVideo() ||
+		md.Video.CodecType != deliver.CodecTypeH264 && md.Video.CodecType != deliver.CodecTypeH265 {
+		return ErrSEIUnsupported
+	}
+
+	for _, format := range s.formats {
+		f, ok := format.(*StreamFormatImpl)
+		if !ok {
+			continue
+		}
+		if err := f.InjectSEI(ud, frames); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *StreamImpl) OnGOPExceeded(f func(interval time.Duration)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.onGOP = f
+}
+
+// watchGOP watches the keyframes of a publisher while it lasts.
+func (s *StreamImpl) watchGOP(source deliver.FrameSource) {
+	if s.keyframes.MaxIntervalMs <= 0 {
+		return
+	}
+
+	opts := deliver.GOPOptions{
+		MaxInterval: time.Duration(s.keyframes.MaxIntervalMs) * time.Millisecond,
+		OnExceeded:  s.gopExceeded,
+	}
+
+	switch s.keyframes.Request {
+	case "pli":
+		opts.Request = deliver.FeedbackCmdPLI
+	case "fir":
+		opts.Request = deliver.FeedbackCmdFIR
+	case "":
+	default:
+		s.logger.WithField("request", s.keyframes.Request).Warn("unknown keyframe request, only warning")
+	}
+
+	deliver.WatchGOP(source.Context(), source, opts)
+}
+
+func (s *StreamImpl) gopExceeded(interval time.Duration) {
+	s.lock.RLock()
+	f := s.onGOP
+	s.lock.RUnlock()
+
+	s.logger.WithFields(logrus.Fields{
+		"interval": interval,
+		"max":      time.Duration(s.keyframes.MaxIntervalMs) * time.Millisecond,
+	}).Warn("keyframe interval exceeded")
+
+	if f != nil {
+		f(interval)
+	}
+}
+
+func (s *StreamImpl) OnHealth(f func(event HealthEvent, h deliver.Health)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.onHealth = f
+}
+
+func (s *StreamImpl) Health() (deliver.Health, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.health == nil {
+		return deliver.Health{}, false
+	}
+
+	return *s.health, true
+}
+
+// watchHealth scores a publisher while it lasts. It logs once when the
+// publisher turns unhealthy and once when it recovers, a broken source would
+// flood the log otherwise.
+func (s *StreamImpl) watchHealth(source deliver.FrameSource) {
+	params := s.healthParams
+	quarantineAfter := time.Duration(params.QuarantineAfterS) * time.Second
+
+	var unhealthySince time.Time
+	quarantined := false
+	deliver.WatchHealth(source.Context(), source, deliver.HealthOptions{
+		OnSample: func(h deliver.Health) {
+			s.lock.Lock()
+			s.health = &h
+			f := s.onHealth
+			s.lock.Unlock()
+
+			if params.MinScore <= 0 {
+				return
+			}
+
+			event := HealthEvent(0)
+			now := time.Now()
+			switch {
+			case h.Score < float64(params.MinScore) && unhealthySince.IsZero():
+				unhealthySince = now
+				event = HealthUnhealthy
+				s.logger.WithField("health", h).Warn("publisher unhealthy")
+			case h.Score < float64(params.MinScore):
+				if quarantineAfter > 0 && !quarantined && now.Sub(unhealthySince) >= quarantineAfter {
+					quarantined = true
+					event = HealthQuarantined
+					s.logger.WithField("health", h).Error("publisher quarantined")
+				}
+			case !unhealthySince.IsZero():
+				unhealthySince = time.Time{}
+				event = HealthRecovered
+				s.logger.WithField("health", h).Info("publisher recovered")
+			}
+
+			if event != 0 && f != nil {
+				f(event, h)
+			}
+		},
+	})
+}
+
+func (s *StreamImpl) switched(backup bool) {
+	s.lock.RLock()
+	f := s.onFailover
+	s.lock.RUnlock()
+
+	s.logger.WithField("backup", backup).Warn("stream source switched")
+	if f != nil {
+		f(backup)
+	}
+}
+
 func (s *StreamImpl) addFrameDestination(dest deliver.FrameDestination) (err error) {
 	fmtName := dest.Metadata().FormatName()
+	opts := []StreamFormatOption{WithFrameSourceManager(s.sm), WithSource(s.source()), WithInspector(s.inspector)}
+	if !s.timestamps.Disable {
+		opts = append(opts, WithRebaser(deliver.RebaserOptions{
+			Epoch:    s.epoch,
+			MaxJump:  time.Duration(s.timestamps.MaxJumpMs) * time.Millisecond,
+			MaxDrift: time.Duration(s.timestamps.MaxDriftMs) * time.Millisecond,
+			MaxSync:  time.Duration(s.timestamps.MaxSyncMs) * time.Millisecond,
+		}))
+	}
+
+	// destinations picking another audio track share a format of it
+	md := s.sm.DefaultSource().Metadata()
+	if sel := dest.FormatSettings().AudioTrack; sel != "" {
+		if i, ok := md.FindAudioTrack(sel); ok && i > 0 {
+			fmtName += "/track" + strconv.Itoa(i)
+			opts = append(opts, WithAudioTrack(i))
+
+			picked := *md
+			picked.Audio, picked.AudioTracks = md.AudioTrack(i), nil
+			md = &picked
+		}
+	}
+
+	// destinations accepting none of the audio of the source share a
+	// format transcoding it to their codec
+	if out, ok := transcoder.AudioTarget(md, dest.FormatSettings()); ok {
+		fmtName += "/" + out.CodecType.String()
+		opts = append(opts, WithAudioTranscode(out, s.logger))
+	}
+
+	// listeners share a format without the video, it is never fanned out
+	// to them
+	if settings := dest.FormatSettings(); !s.audioOnly.Disable &&
+		len(settings.AudioCandidates) > 0 && len(settings.VideoCandidates) == 0 {
+		fmtName += "/audio"
+		opts = append(opts, WithAudioOnly(deliver.FanoutOptions{
+			RingSize: s.audioOnly.RingSize,
+			Batch:    time.Duration(s.audioOnly.BatchMs) * time.Millisecond,
+		}))
+	}
+
 	format, ok := s.formats[fmtName]
 	if !ok {
-		format, err = NewStreamFormat(s.ctx, dest.FormatSettings(), WithFrameSourceManager(s.sm))
+		format, err = NewStreamFormat(s.ctx, dest.FormatSettings(), opts...)
 		if err != nil {
 			return errors.Wrap(err, "failed to create stream format")
 		}
@@ -127,6 +475,42 @@ func (s *StreamImpl) AddFrameDestination(dest deliver.FrameDestination) (err err
 	return s.addFrameDestination(dest)
 }
 
+func (s *StreamImpl) RemoveFrameDestination(dest deliver.FrameDestination) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i, d := range s.paddingDests {
+		if d == dest {
+			s.paddingDests = append(s.paddingDests[:i:i], s.paddingDests[i+1:]...)
+			break
+		}
+	}
+
+	for _, format := range s.formats {
+		format.RemoveDestination(dest)
+	}
+}
+
+func (s *StreamImpl) RefreshFrameDestination(dest deliver.FrameDestination) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return ErrStreamClosed
+	}
+
+	// waiting destinations get a format once the source is there
+	if s.sm.DefaultSource() == nil {
+		return nil
+	}
+
+	for _, format := range s.formats {
+		format.RemoveDestination(dest)
+	}
+
+	return s.addFrameDestination(dest)
+}
+
 func (s *StreamImpl) Close() {
 	s.cancel()
 }
@@ -2,17 +2,30 @@ package core
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
+	feature_core "github.com/pingostack/neon/features/core"
 	"github.com/pingostack/neon/internal/core/middleware"
 	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/eventbus"
 	"github.com/pingostack/neon/pkg/eventemitter"
+	"github.com/pingostack/neon/pkg/trace"
+	"github.com/pingostack/neon/pkg/vhost"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
 type serv struct {
 	*router.NSManager
 	middleware middleware.Matcher
+	routes     *router.Routes
+	pulls      *pullManager
 	ee         eventemitter.EventEmitter
 	ctx        context.Context
+	thresholds []int
 }
 
 type ServerOption func(*serv)
@@ -23,48 +36,456 @@ var (
 
 const (
 	defaultEventEmitterSize = 100
+	// the last path tried for a duplicate publisher, see router.DuplicateSuffix
+	maxPathSuffix = 100
 )
 
-func NewServ(ctx context.Context, params router.NSManagerParams) *serv {
+func WithEventEmitter(ee eventemitter.EventEmitter) ServerOption {
+	return func(s *serv) {
+		s.ee = ee
+	}
+}
+
+func WithRoutes(routes *router.Routes) ServerOption {
+	return func(s *serv) {
+		s.routes = routes
+	}
+}
+
+func WithSources(sources []SourceSettings) ServerOption {
+	return func(s *serv) {
+		s.pulls = newPullManager(s.ctx, sources)
+	}
+}
+
+// WithViewerThresholds emits EventViewersThreshold when the subscriber
+// count of a stream crosses one of thresholds.
+func WithViewerThresholds(thresholds []int) ServerOption {
+	return func(s *serv) {
+		s.thresholds = thresholds
+	}
+}
+
+func NewServ(ctx context.Context, params router.NSManagerParams, opts ...ServerOption) *serv {
 	s := &serv{
 		ctx:        ctx,
 		middleware: middleware.New(),
-		ee:         eventemitter.NewEventEmitter(ctx, defaultEventEmitterSize, DefaultLogger()),
 		NSManager:  router.NewNSManager(params),
 	}
 
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.ee == nil {
+		s.ee = eventemitter.NewEventEmitter(ctx, defaultEventEmitterSize, DefaultLogger())
+	}
+
 	return s
 }
 
+func (s *serv) namespace(session router.Session) (*router.Namespace, error) {
+	params := session.PeerParams()
+	if params.Namespace != "" {
+		ns, _ := s.NSManager.GetOrNewNamespace(s.ctx, params.Namespace)
+		return ns, nil
+	}
+
+	// the namespace of a tenant is named after it, the prefix naming the
+	// tenant is not part of the stream
+	tenant, path, err := vhost.Default().Resolve(params.Domain, params.RouterID, params.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	if tenant != nil {
+		if path != params.RouterID {
+			session.SetRouterID(path)
+		}
+		ns, _ := s.NSManager.GetOrNewNamespace(s.ctx, tenant.Name)
+		return ns, nil
+	}
+
+	return s.domainNamespace(params), nil
+}
+
+func (s *serv) domainNamespace(params router.PeerParams) *router.Namespace {
+	domain := params.Domain
+	if name, ok := s.routes.Namespace(domain); ok {
+		ns, _ := s.NSManager.GetOrNewNamespace(s.ctx, name)
+		return ns
+	}
+
+	ns, _ := s.NSManager.GetOrNewNamespaceByDomain(s.ctx, domain)
+	return ns
+}
+
+// route applies the routing rules, subscribers of a path without a publisher
+// are sent to the fallback stream when it is live, until it is published.
+func (s *serv) route(ns *router.Namespace, session router.Session) {
+	id := s.routes.Path(session.RouterID())
+
+	if session.PeerParams().Producer {
+		if primary, ok := ns.BackupOf(id); ok {
+			session.Set(router.SessionKeyBackup, true)
+			id = primary
+		}
+	}
+
+	if fallback := s.routes.Fallback(); fallback != "" && !session.PeerParams().Producer && fallback != id {
+		if r := ns.Router(id); r == nil || r.Producer() == nil {
+			if fr := ns.Router(fallback); fr != nil && fr.Producer() != nil {
+				session.Set(router.SessionKeyFallbackOf, id)
+				id = fallback
+			}
+		}
+	}
+
+	if id != session.RouterID() {
+		session.Logger().WithField("from", session.RouterID()).WithField("to", id).Info("stream routed")
+		session.SetRouterID(id)
+	}
+}
+
 func (s *serv) join(session router.Session) error {
-	ns, _ := s.NSManager.GetOrNewNamespaceByDomain(s.ctx, session.PeerParams().Domain)
-	// if ns == nil {
-	// 	return router.ErrNamespaceNotFound
-	// }
+	ns, err := s.namespace(session)
+	if err != nil {
+		return err
+	}
+
+	s.route(ns, session)
+
+	tenant, _ := vhost.Default().Tenant(ns.Name())
+	release, err := tenant.Acquire(session.PeerParams().Producer)
+	if err != nil {
+		session.Logger().WithError(err).Warn("session rejected")
+		return err
+	}
+
+	// each suffixed path is tried by its own policy, one rejecting or
+	// replacing ends the search
+	r, err := s.addSession(ns, session)
+	path := session.RouterID()
+	for n := 2; n <= maxPathSuffix && err == router.ErrStreamPublished &&
+		ns.RouterParams(session.RouterID()).DuplicatePublisher == router.DuplicateSuffix; n++ {
+		session.SetRouterID(fmt.Sprintf("%s_%d", path, n))
+		r, err = s.addSession(ns, session)
+	}
+	if err == nil && session.RouterID() != path {
+		session.Logger().WithField("from", path).Info("stream published, suffixed")
+	}
+	if err != nil {
+		release()
+		return err
+	}
+
+	go func() {
+		<-session.Context().Done()
+		release()
+	}()
+
+	session.SetRouter(r)
+	session.SetNamespace(ns)
+	s.watchFailover(ns, r)
+	s.watchViewers(ns, r)
+	s.watchGOP(ns, r)
+	s.watchHealth(ns, r)
+
+	if !session.PeerParams().Producer {
+		s.pulls.ensure(ns, r, session.PeerParams().Domain)
+	}
+
+	if session.PeerParams().Producer && !router.IsBackupSession(session) {
+		s.reattach(ns, r)
+	}
+
+	s.emitSessionEvents(ns, session)
+
+	return nil
+}
+
+// reattach moves the subscribers playing the fallback stream in place of r
+// to r, now that it is published.
+func (s *serv) reattach(ns *router.Namespace, r router.Router) {
+	fallback := s.routes.Fallback()
+	if fallback == "" || fallback == r.ID() {
+		return
+	}
+
+	fr := ns.Router(fallback)
+	if fr == nil {
+		return
+	}
+
+	for _, sub := range fr.Subscribers() {
+		if of, _ := sub.Get(router.SessionKeyFallbackOf).(string); of != r.ID() || !fr.RemoveSubscriber(sub) {
+			continue
+		}
+
+		sub.Set(router.SessionKeyFallbackOf, nil)
+		sub.SetRouterID(r.ID())
+		// a stream without its source yet plays to it once there
+		if err := r.AddSession(sub); err != nil && !errors.Is(err, router.ErrPaddingDestination) {
+			sub.Logger().WithError(err).Warn("subscriber not moved off the fallback stream")
+			sub.Finalize(err)
+			continue
+		}
 
+		sub.SetRouter(r)
+		sub.Logger().WithField("from", fallback).Info("subscriber moved off the fallback stream")
+	}
+}
+
+// addSession adds session to the router of its path, a router closing
+// meanwhile is replaced.
+func (s *serv) addSession(ns *router.Namespace, session router.Session) (router.Router, error) {
 	r, _ := ns.GetOrNewRouter(session.PeerParams().RouterID)
 	err := r.AddSession(session)
 	if err == router.ErrRouterClosed {
 		ns.RemoveRouter(r)
 		r, _ = ns.GetOrNewRouter(session.PeerParams().RouterID)
 		err = r.AddSession(session)
-		if err != nil {
-			return err
+	}
+
+	return r, err
+}
+
+func (s *serv) newEvent(name string, ns *router.Namespace, session router.Session) feature_core.Event {
+	return feature_core.Event{
+		Name:       name,
+		Time:       time.Now(),
+		Namespace:  ns.Name(),
+		Stream:     session.RouterID(),
+		Session:    session.ID(),
+		RemoteAddr: session.PeerParams().RemoteAddr,
+		Producer:   session.PeerParams().Producer,
+	}
+}
+
+func (s *serv) watchFailover(ns *router.Namespace, r router.Router) {
+	r.OnFailover(func(backup bool) {
+		e := feature_core.Event{
+			Name:      feature_core.EventNameStreamFailback,
+			Time:      time.Now(),
+			Namespace: ns.Name(),
+			Stream:    r.ID(),
+			Producer:  true,
 		}
-	} else if err != nil {
-		return err
+
+		id, session := feature_core.EventStreamFailback, r.Producer()
+		if backup {
+			id, session = feature_core.EventStreamFailover, r.Backup()
+			e.Name = feature_core.EventNameStreamFailover
+		}
+
+		if session != nil {
+			e.Session = session.ID()
+			e.RemoteAddr = session.PeerParams().RemoteAddr
+		}
+
+		s.ee.EmitEvent(id, e)
+	})
+}
+
+func (s *serv) watchGOP(ns *router.Namespace, r router.Router) {
+	r.OnGOPExceeded(func(interval time.Duration) {
+		e := feature_core.Event{
+			Name:      feature_core.EventNameGOPExceeded,
+			Time:      time.Now(),
+			Namespace: ns.Name(),
+			Stream:    r.ID(),
+			Producer:  true,
+			Extra: map[string]interface{}{
+				"intervalMs": interval.Milliseconds(),
+			},
+		}
+
+		if session := r.Producer(); session != nil {
+			e.Session = session.ID()
+			e.RemoteAddr = session.PeerParams().RemoteAddr
+		}
+
+		s.ee.EmitEvent(feature_core.EventGOPExceeded, e)
+	})
+}
+
+func (s *serv) watchHealth(ns *router.Namespace, r router.Router) {
+	r.OnHealth(func(event router.HealthEvent, h deliver.Health) {
+		e := feature_core.Event{
+			Time:      time.Now(),
+			Namespace: ns.Name(),
+			Stream:    r.ID(),
+			Producer:  true,
+			Extra: map[string]interface{}{
+				"score":              h.Score,
+				"fractionLost":       h.FractionLost,
+				"volatility":         h.Volatility,
+				"timestampAnomalies": h.TimestampAnomalies,
+				"decodeErrors":       h.DecodeErrors,
+			},
+		}
+
+		if session := r.Producer(); session != nil {
+			e.Session = session.ID()
+			e.RemoteAddr = session.PeerParams().RemoteAddr
+		}
+
+		switch event {
+		case router.HealthUnhealthy:
+			e.Name = feature_core.EventNameStreamUnhealthy
+			s.ee.EmitEvent(feature_core.EventStreamUnhealthy, e)
+		case router.HealthRecovered:
+			e.Name = feature_core.EventNameStreamRecovered
+			s.ee.EmitEvent(feature_core.EventStreamRecovered, e)
+		case router.HealthQuarantined:
+			e.Name = feature_core.EventNameStreamQuarantined
+			s.ee.EmitEvent(feature_core.EventStreamQuarantined, e)
+			s.pulls.quarantine(ns, r.ID())
+		}
+	})
+}
+
+func (s *serv) watchViewers(ns *router.Namespace, r router.Router) {
+	if len(s.thresholds) == 0 {
+		return
 	}
 
-	session.SetRouter(r)
-	session.SetNamespace(ns)
+	r.OnSubscribers(func(prev, count int) {
+		for _, threshold := range s.thresholds {
+			direction := ""
+			if prev < threshold && count >= threshold {
+				direction = "up"
+			} else if prev >= threshold && count < threshold {
+				direction = "down"
+			} else {
+				continue
+			}
 
-	return nil
+			s.ee.EmitEvent(feature_core.EventViewersThreshold, feature_core.Event{
+				Name:      feature_core.EventNameViewersThreshold,
+				Time:      time.Now(),
+				Namespace: ns.Name(),
+				Stream:    r.ID(),
+				Extra: map[string]interface{}{
+					"viewers":   count,
+					"peak":      r.PeakSubscriberCount(),
+					"threshold": threshold,
+					"direction": direction,
+				},
+			})
+		}
+	})
+}
+
+func (s *serv) emitSessionEvents(ns *router.Namespace, session router.Session) {
+	s.ee.EmitEvent(feature_core.EventClientConnected, s.newEvent(feature_core.EventNameClientConnected, ns, session))
+	if session.PeerParams().Producer {
+		s.ee.EmitEvent(feature_core.EventStreamPublished, s.newEvent(feature_core.EventNameStreamPublished, ns, session))
+	}
+	publishSession(ns, session, true)
+
+	go func() {
+		<-session.Context().Done()
+
+		s.ee.EmitEvent(feature_core.EventClientDisconnected, s.newEvent(feature_core.EventNameClientDisconnected, ns, session))
+		if session.PeerParams().Producer {
+			s.ee.EmitEvent(feature_core.EventStreamEnded, s.newEvent(feature_core.EventNameStreamEnded, ns, session))
+		}
+		publishSession(ns, session, false)
+	}()
+}
+
+// publishSession announces a session of a known protocol on the event bus,
+// e.g. as rtsp.publish.start.
+func publishSession(ns *router.Namespace, session router.Session, start bool) {
+	params := session.PeerParams()
+	if params.Protocol == "" {
+		return
+	}
+
+	eventemitter.Publish(eventbus.Default(), eventbus.SessionTopic(params.Protocol, params.Producer, start), eventbus.Session{
+		Protocol:   params.Protocol,
+		Namespace:  ns.Name(),
+		Stream:     session.RouterID(),
+		Session:    session.ID(),
+		RemoteAddr: params.RemoteAddr,
+		Producer:   params.Producer,
+		Time:       time.Now(),
+	})
+}
+
+func (s *serv) Sessions() []router.Session {
+	sessions := make([]router.Session, 0)
+	for _, ns := range s.NSManager.Namespaces() {
+		for _, r := range ns.Routers() {
+			if producer := r.Producer(); producer != nil {
+				sessions = append(sessions, producer)
+			}
+			sessions = append(sessions, r.Subscribers()...)
+		}
+	}
+
+	return sessions
+}
+
+func (s *serv) LookupSession(id string) (router.Session, bool) {
+	for _, session := range s.Sessions() {
+		if session.ID() == id {
+			return session, true
+		}
+	}
+
+	return nil, false
+}
+
+func (s *serv) LookupRouter(namespace, id string) (router.Router, bool) {
+	for _, ns := range s.NSManager.Namespaces() {
+		if ns.Name() != namespace {
+			continue
+		}
+
+		if r := ns.Router(id); r != nil {
+			return r, true
+		}
+	}
+
+	return nil, false
+}
+
+// Pull publishes rawURL as stream of namespace until StopPull, whether it is
+// watched or not.
+func (s *serv) Pull(namespace, stream, rawURL string) error {
+	ns, _ := s.NSManager.GetOrNewNamespace(s.ctx, namespace)
+	return s.pulls.start(ns, stream, rawURL)
+}
+
+// StopPull stops a pull of Pull or of a source, false when stream is not
+// pulled.
+func (s *serv) StopPull(namespace, stream string) bool {
+	for _, ns := range s.NSManager.Namespaces() {
+		if ns.Name() == namespace {
+			return s.pulls.stop(ns, stream)
+		}
+	}
+
+	return false
 }
 
 func (s *serv) Join(ctx context.Context, session router.Session) error {
+	_, span := trace.Start(ctx, "core.join", oteltrace.WithAttributes(
+		attribute.String("domain", session.PeerParams().Domain),
+		attribute.String("stream", session.RouterID()),
+		attribute.Bool("producer", session.PeerParams().Producer)))
+	defer span.End()
+
+	if Draining() {
+		trace.RecordError(span, router.ErrDraining)
+		return router.ErrDraining
+	}
+
 	//	h := func(ctx context.Context, req middleware.Request) (interface{}, error) {
 	err := s.join(session)
 	if err != nil {
+		trace.RecordError(span, err)
 		return err
 	}
 
@@ -4,11 +4,13 @@ import (
 	"context"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"github.com/gogf/gf/util/guid"
 	"github.com/pingostack/neon/internal/core/router"
 	"github.com/pingostack/neon/pkg/deliver"
+	nlogger "github.com/pingostack/neon/pkg/logger"
 	"github.com/sirupsen/logrus"
 )
 
@@ -24,19 +26,20 @@ type SessionImpl struct {
 	frameSource      deliver.FrameSource
 	frameDestination deliver.FrameDestination
 	onceClose        sync.Once
+	createdAt        time.Time
 }
 
 func NewSession(ctx context.Context, params router.PeerParams, logger *logrus.Entry) router.Session {
 	session := &SessionImpl{
-		id:     guid.S(),
-		kv:     &sync.Map{},
-		params: params,
+		id:        guid.S(),
+		kv:        &sync.Map{},
+		params:    params,
+		createdAt: time.Now(),
 	}
 
-	session.logger = logger.WithFields(logrus.Fields{
-		"session": session.id,
-		"peer":    params.PeerID,
-	})
+	session.logger = logger.
+		WithFields(nlogger.SessionFields(params.RouterID, session.id, params.RemoteAddr)).
+		WithField("peer", params.PeerID)
 	session.ctx, session.cancel = context.WithCancel(ctx)
 
 	return session
@@ -46,10 +49,21 @@ func (session *SessionImpl) ID() string {
 	return session.id
 }
 
+func (session *SessionImpl) CreatedAt() time.Time {
+	return session.createdAt
+}
+
 func (session *SessionImpl) RouterID() string {
 	return session.params.RouterID
 }
 
+// SetRouterID moves the session to another stream, used when routing rules
+// rewrite the requested path and when a subscriber leaves the fallback stream.
+func (session *SessionImpl) SetRouterID(id string) {
+	session.params.RouterID = id
+	session.logger = session.logger.WithField("routed", id)
+}
+
 func (session *SessionImpl) close(e error) {
 	session.onceClose.Do(func() {
 		session.cancel()
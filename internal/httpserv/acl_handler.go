@@ -0,0 +1,36 @@
+package httpserv
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingostack/neon/pkg/acl"
+)
+
+// ACLHandler rejects requests refused by the acl of module, the acl is looked
+// up per request so configuration reloads take effect immediately.
+func ACLHandler(module string) gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		release, err := acl.For(module).Acquire(gc.Request.RemoteAddr)
+		if err != nil {
+			gc.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		defer release()
+
+		gc.Next()
+	}
+}
+
+// ACLCheckHandler rejects requests refused by the acl of module without
+// counting them, for servers whose sessions are counted while they last.
+func ACLCheckHandler(module string) gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		if err := acl.For(module).Check(gc.Request.RemoteAddr); err != nil {
+			gc.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		gc.Next()
+	}
+}
@@ -0,0 +1,21 @@
+package httpserv
+
+import (
+	"net/http"
+)
+
+// limitHandler bounds request bodies, reading past the limit fails.
+type limitHandler struct {
+	http.Handler
+	maxBodyBytes int64
+}
+
+func (h *limitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ContentLength > h.maxBodyBytes {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodyBytes)
+	h.Handler.ServeHTTP(w, r)
+}
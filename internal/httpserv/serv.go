@@ -6,6 +6,7 @@ import (
 	"net"
 	"net/http"
 
+	"github.com/pingostack/neon/pkg/certmgr"
 	"github.com/pingostack/neon/pkg/logger"
 	"github.com/sirupsen/logrus"
 )
@@ -17,6 +18,9 @@ type Server struct {
 	logger    logger.Logger
 	ctx       context.Context
 	headers   map[string]string
+	// 0 leaves them unlimited
+	maxHeaderBytes int
+	maxBodyBytes   int64
 }
 
 type ServerOption func(*Server)
@@ -29,14 +33,21 @@ func WithListener(ln net.Listener) ServerOption {
 
 func WithSSL(cert, key string) ServerOption {
 	return func(s *Server) {
-		tlsConfig := &tls.Config{}
-		cert, err := tls.LoadX509KeyPair(cert, key)
+		m, err := certmgr.NewManager(certmgr.Settings{
+			Certs: []certmgr.CertSettings{{Cert: cert, Key: key}},
+		}, nil)
 		if err != nil {
 			panic(err)
 		}
 
-		tlsConfig.Certificates = []tls.Certificate{cert}
+		go m.Watch(s.ctx)
 
+		s.tlsConfig = m.TLSConfig()
+	}
+}
+
+func WithTLSConfig(tlsConfig *tls.Config) ServerOption {
+	return func(s *Server) {
 		s.tlsConfig = tlsConfig
 	}
 }
@@ -53,6 +64,14 @@ func WithHeaders(headers map[string]string) ServerOption {
 	}
 }
 
+// WithLimits bounds the headers and the body of requests.
+func WithLimits(maxHeaderBytes int, maxBodyBytes int64) ServerOption {
+	return func(s *Server) {
+		s.maxHeaderBytes = maxHeaderBytes
+		s.maxBodyBytes = maxBodyBytes
+	}
+}
+
 func NewServer(ctx context.Context, handler http.Handler, opts ...ServerOption) *Server {
 	s := &Server{
 		ctx: ctx,
@@ -63,6 +82,13 @@ func NewServer(ctx context.Context, handler http.Handler, opts ...ServerOption)
 	}
 
 	h := handler
+	if s.maxBodyBytes > 0 {
+		h = &limitHandler{
+			Handler:      h,
+			maxBodyBytes: s.maxBodyBytes,
+		}
+	}
+
 	h = &loggerHandler{
 		logger:  logrus.WithField("handler", "logger"),
 		Handler: h,
@@ -80,8 +106,9 @@ func NewServer(ctx context.Context, handler http.Handler, opts ...ServerOption)
 	}
 
 	s.serv = &http.Server{
-		Handler:   h,
-		TLSConfig: s.tlsConfig,
+		Handler:        h,
+		TLSConfig:      s.tlsConfig,
+		MaxHeaderBytes: s.maxHeaderBytes,
 	}
 
 	if s.tlsConfig != nil {
@@ -8,11 +8,15 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/pingostack/neon/pkg/certmgr"
+	"github.com/pingostack/neon/pkg/tcp"
 	"github.com/sirupsen/logrus"
 )
 
 const (
-	defaultMaxAgeSecond = 12 * 60 * 60
+	defaultMaxAgeSecond   = 12 * 60 * 60
+	defaultMaxHeaderBytes = 64 << 10
+	defaultMaxBodyBytes   = 1 << 20
 )
 
 type HttpParams struct {
@@ -28,15 +32,30 @@ type HttpParams struct {
 	MaxAge           int               `json:"maxAge" mapstructure:"maxAge"`
 	Headers          map[string]string `json:"headers" mapstructure:"headers"`
 	AllowOriginHook  string            `json:"allowOriginHook" mapstructure:"allowOriginHook"`
+	ProxyProtocol    bool              `json:"proxyProtocol" mapstructure:"proxyProtocol"`
+	// TrustedProxies are the networks PROXY headers are taken from, see
+	// tcp.ListenOptions.
+	TrustedProxies []string `json:"trustedProxies" mapstructure:"trustedProxies"`
+	// HttpAddrs and HttpsAddrs add listeners, e.g. "tcp6://[::]:7001" or "unix:///run/neon/whip.sock".
+	HttpAddrs  []string `json:"httpAddrs" mapstructure:"httpAddrs"`
+	HttpsAddrs []string `json:"httpsAddrs" mapstructure:"httpsAddrs"`
+	ReusePort  bool     `json:"reusePort" mapstructure:"reusePort"`
+	// UnixSocket sets the permissions of the unix:// listeners.
+	UnixSocket tcp.UnixSocketOptions `json:"unixSocket" mapstructure:"unixSocket"`
+	// MaxHeaderBytes and MaxBodyBytes bound requests, e.g. sdp offers, 64 KiB
+	// and 1 MiB when 0.
+	MaxHeaderBytes int   `json:"maxHeaderBytes" mapstructure:"maxHeaderBytes"`
+	MaxBodyBytes   int64 `json:"maxBodyBytes" mapstructure:"maxBodyBytes"`
 }
 
 type SignalServer struct {
-	l         *logrus.Entry
-	ctx       context.Context
-	params    HttpParams
-	httpServ  *Server
-	httpsServ *Server
-	router    *gin.Engine
+	l          *logrus.Entry
+	ctx        context.Context
+	params     HttpParams
+	httpServs  []*Server
+	httpsServs []*Server
+	router     *gin.Engine
+	sameOrigin bool
 }
 
 func NewSignalServer(ctx context.Context, params HttpParams, logger *logrus.Entry) *SignalServer {
@@ -49,15 +68,15 @@ func NewSignalServer(ctx context.Context, params HttpParams, logger *logrus.Entr
 }
 
 func (ss *SignalServer) validate() error {
-	if ss.params.HttpAddr == "" && ss.params.HttpsAddr == "" {
+	if len(ss.httpAddrs()) == 0 && len(ss.httpsAddrs()) == 0 {
 		return errors.New("httpAddr and httpsAddr can't be both empty")
 	}
 
-	if ss.params.HttpsAddr != "" && (ss.params.Cert == "" || ss.params.Key == "") {
-		return errors.New("cert and key can't be empty when httpsAddr is not empty")
+	if len(ss.httpsAddrs()) > 0 && (ss.params.Cert == "" || ss.params.Key == "") && !certmgr.Default().Enabled() {
+		return errors.New("cert and key can't be empty when httpsAddr is not empty and no certificate is configured in certs")
 	}
 
-	if len(ss.params.AllowOrigin) == 0 {
+	if len(ss.params.AllowOrigin) == 0 && !ss.sameOrigin {
 		ss.params.AllowOrigin = []string{"*"}
 	}
 
@@ -77,9 +96,23 @@ func (ss *SignalServer) validate() error {
 		ss.params.MaxAge = defaultMaxAgeSecond
 	}
 
+	if ss.params.MaxHeaderBytes == 0 {
+		ss.params.MaxHeaderBytes = defaultMaxHeaderBytes
+	}
+
+	if ss.params.MaxBodyBytes == 0 {
+		ss.params.MaxBodyBytes = defaultMaxBodyBytes
+	}
+
 	return nil
 }
 
+// SameOriginOnly makes an empty AllowOrigin allow only the pages of the server
+// itself rather than any page.
+func (ss *SignalServer) SameOriginOnly() {
+	ss.sameOrigin = true
+}
+
 func (ss *SignalServer) DefaultRouter() *gin.Engine {
 	return ss.router
 }
@@ -105,54 +138,96 @@ func (ss *SignalServer) Start(handles ...gin.HandlerFunc) error {
 
 	if ss.params.AllowOriginHook != "" {
 		corsConfig.AllowOriginFunc = ss.allowOriginHook
+	} else if len(ss.params.AllowOrigin) == 0 {
+		// pages of the server itself are let through before
+		corsConfig.AllowOriginFunc = func(string) bool { return false }
 	}
 
 	router.Use(cors.New(corsConfig))
 
-	if ss.params.HttpAddr != "" {
-		ln, err := net.Listen("tcp", ss.params.HttpAddr)
+	for _, addr := range ss.httpAddrs() {
+		ln, err := ss.listen(addr)
 		if err != nil {
-			ss.l.WithError(err).Errorf("http server listen on %s failed", ss.params.HttpAddr)
+			ss.l.WithError(err).Errorf("http server listen on %s failed", addr)
 			panic(err)
 		}
 
-		ss.l.WithField("port", ss.params.HttpAddr).Info("http server listen on")
+		ss.l.WithField("port", addr).Info("http server listen on")
 
-		ss.httpServ = NewServer(ss.ctx,
-			router,
+		ss.httpServs = append(ss.httpServs, NewServer(ss.ctx,
+			certmgr.Default().HTTPHandler(router),
 			WithListener(ln),
 			WithHeaders(ss.params.Headers),
-			WithLogger(ss.l))
+			WithLimits(ss.params.MaxHeaderBytes, ss.params.MaxBodyBytes),
+			WithLogger(ss.l)))
+	}
+
+	httpsAddrs := ss.httpsAddrs()
+	if len(httpsAddrs) == 0 {
+		return nil
+	}
+
+	// a module specific key pair wins over the shared certificate manager
+	sslOption := WithTLSConfig(certmgr.Default().TLSConfig())
+	if ss.params.Cert != "" && ss.params.Key != "" {
+		sslOption = WithSSL(ss.params.Cert, ss.params.Key)
 	}
 
-	if ss.params.HttpsAddr != "" && ss.params.Cert != "" && ss.params.Key != "" {
-		ln, err := net.Listen("tcp", ss.params.HttpsAddr)
+	for _, addr := range httpsAddrs {
+		ln, err := ss.listen(addr)
 		if err != nil {
-			ss.l.WithError(err).Errorf("https server listen on %s failed", ss.params.HttpsAddr)
+			ss.l.WithError(err).Errorf("https server listen on %s failed", addr)
 			panic(err)
 		}
 
-		ss.l.WithField("port", ss.params.HttpsAddr).Info("https server listen on")
+		ss.l.WithField("port", addr).Info("https server listen on")
 
-		ss.httpsServ = NewServer(ss.ctx,
+		ss.httpsServs = append(ss.httpsServs, NewServer(ss.ctx,
 			router,
 			WithListener(ln),
 			WithHeaders(ss.params.Headers),
-			WithSSL(ss.params.Cert, ss.params.Key),
-			WithLogger(ss.l))
+			WithLimits(ss.params.MaxHeaderBytes, ss.params.MaxBodyBytes),
+			sslOption,
+			WithLogger(ss.l)))
 	}
 
 	return nil
 }
 
+func (ss *SignalServer) httpAddrs() []string {
+	if ss.params.HttpAddr == "" {
+		return ss.params.HttpAddrs
+	}
+
+	return append([]string{ss.params.HttpAddr}, ss.params.HttpAddrs...)
+}
+
+func (ss *SignalServer) httpsAddrs() []string {
+	if ss.params.HttpsAddr == "" {
+		return ss.params.HttpsAddrs
+	}
+
+	return append([]string{ss.params.HttpsAddr}, ss.params.HttpsAddrs...)
+}
+
+func (ss *SignalServer) listen(addr string) (net.Listener, error) {
+	return tcp.ListenOne(addr, tcp.ListenOptions{
+		ReusePort:      ss.params.ReusePort,
+		ProxyProtocol:  ss.params.ProxyProtocol,
+		TrustedProxies: ss.params.TrustedProxies,
+		UnixSocket:     ss.params.UnixSocket,
+	})
+}
+
 func (ss *SignalServer) Close() error {
-	if ss.httpServ != nil {
-		ss.httpServ.Close()
+	for _, s := range ss.httpServs {
+		s.Close()
 	}
 
-	if ss.httpsServ != nil {
-		ss.httpsServ.Close()
+	for _, s := range ss.httpsServs {
+		s.Close()
 	}
+
 	return nil
 }
 
@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"context"
+
+	"github.com/let-light/gomodule"
+	feature_logging "github.com/pingostack/neon/features/logging"
+	"github.com/pingostack/neon/pkg/logger"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var loggingModule *logging
+
+// LoggingSettings complements the builtin logger section, which already covers
+// output file, json/text formatter and size/time based rotation.
+type LoggingSettings struct {
+	Levels map[string]string `json:"levels" mapstructure:"levels"`
+	// Tail is the number of lines kept for the admin api, set at start.
+	Tail int `json:"tail" mapstructure:"tail"`
+}
+
+const defaultTailLines = 1000
+
+type logging struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings LoggingSettings
+	settings    *LoggingSettings
+	logger      *logrus.Entry
+	tail        *logger.Tail
+}
+
+func init() {
+	loggingModule = &logging{
+		logger: logrus.WithField("module", "logging"),
+	}
+}
+
+func LoggingModule() *logging {
+	return loggingModule
+}
+
+func (l *logging) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	l.ctx = ctx
+	return &l.preSettings, nil
+}
+
+func (l *logging) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+// ConfigChanged runs after the builtin logger module reloaded its settings.
+func (l *logging) ConfigChanged() {
+	if l.settings == nil {
+		l.settings = &l.preSettings
+	}
+
+	if l.tail == nil {
+		if l.settings.Tail <= 0 {
+			l.settings.Tail = defaultTailLines
+		}
+		l.tail = logger.NewTail(l.settings.Tail)
+		logrus.StandardLogger().AddHook(l.tail)
+	}
+
+	if err := logger.SetModuleLevels(logrus.StandardLogger(), l.settings.Levels); err != nil {
+		l.logger.WithError(err).Error("invalid module log level")
+		return
+	}
+
+	l.logger.WithField("levels", l.settings.Levels).Debug("module log levels applied")
+}
+
+func (l *logging) ModuleRun() {
+	defer metrics.Track("logging")()
+
+	<-l.ctx.Done()
+}
+
+func (l *logging) Type() interface{} {
+	return feature_logging.Type()
+}
+
+func (l *logging) Tail(n int) []logger.TailEntry {
+	if l.tail == nil {
+		return nil
+	}
+
+	return l.tail.Lines(n)
+}
@@ -0,0 +1,71 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/let-light/gomodule"
+	feature_ports "github.com/pingostack/neon/features/ports"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/pingostack/neon/pkg/udp"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var portsModule *ports
+
+type ports struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings udp.PortSettings
+	settings    *udp.PortSettings
+	logger      *logrus.Entry
+}
+
+func init() {
+	portsModule = &ports{
+		logger: logrus.WithField("module", "ports"),
+	}
+}
+
+func PortsModule() *ports {
+	return portsModule
+}
+
+func (p *ports) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	p.ctx = ctx
+	return &p.preSettings, nil
+}
+
+func (p *ports) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+func (p *ports) ConfigChanged() {
+	if p.settings == nil {
+		p.settings = &p.preSettings
+	}
+
+	// the range is shared by live sessions, it is only set up once
+	if udp.DefaultPorts() != nil || p.settings.MinPort == 0 {
+		return
+	}
+
+	allocator, err := udp.NewPortAllocator(*p.settings)
+	if err != nil {
+		p.logger.WithError(err).Error("failed to create port allocator")
+		return
+	}
+
+	udp.SetDefaultPorts(allocator)
+	p.logger.WithField("settings", p.settings).Info("udp port range configured")
+}
+
+func (p *ports) ModuleRun() {
+	defer metrics.Track("ports")()
+
+	<-p.ctx.Done()
+}
+
+func (p *ports) Type() interface{} {
+	return feature_ports.Type()
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"context"
+
+	"github.com/let-light/gomodule"
+	feature_core "github.com/pingostack/neon/features/core"
+	feature_ratelimit "github.com/pingostack/neon/features/ratelimit"
+	"github.com/pingostack/neon/pkg/metrics"
+	ratelimitlib "github.com/pingostack/neon/pkg/ratelimit"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var ratelimitModule *ratelimit
+
+type ratelimit struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings ratelimitlib.Settings
+	settings    *ratelimitlib.Settings
+	logger      *logrus.Entry
+}
+
+func init() {
+	ratelimitModule = &ratelimit{
+		logger: logrus.WithField("module", "ratelimit"),
+	}
+}
+
+func RatelimitModule() *ratelimit {
+	return ratelimitModule
+}
+
+func (r *ratelimit) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	r.ctx = ctx
+	return &r.preSettings, nil
+}
+
+func (r *ratelimit) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+func (r *ratelimit) ConfigChanged() {
+	if r.settings == nil {
+		r.settings = &r.preSettings
+	}
+
+	ratelimitlib.SetDefault(ratelimitlib.NewManager(*r.settings))
+	r.logger.WithField("settings", r.settings).Debug("rate limits applied")
+}
+
+func (r *ratelimit) ModuleRun() {
+	defer metrics.Track("ratelimit")()
+
+	gomodule.RequireFeatures(func(core feature_core.Feature) {
+		core.EventEmitter().AddEvent(feature_core.EventStreamEnded, func(data interface{}) error {
+			if e, ok := data.(feature_core.Event); ok {
+				ratelimitlib.Default().ReleaseStream(e.Stream)
+			}
+			return nil
+		})
+	})
+
+	<-r.ctx.Done()
+}
+
+func (r *ratelimit) Type() interface{} {
+	return feature_ratelimit.Type()
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/let-light/gomodule"
 	feature_rtc "github.com/pingostack/neon/features/rtc"
+	deliver_rtc "github.com/pingostack/neon/pkg/deliver/rtc"
 	"github.com/pingostack/neon/pkg/rtclib"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -48,6 +49,10 @@ func (rtc *rtc) ConfigChanged() {
 		rtc.settings = &rtc.preSettings
 		rtc.logger.WithField("settings", rtc.settings).Info("settings changed")
 	}
+
+	deliver_rtc.SetCongestionSettings(rtc.settings.Congestion)
+	deliver_rtc.SetFECSettings(rtc.settings.FEC)
+	deliver_rtc.SetREDSettings(rtc.settings.RED)
 }
 
 func (rtc *rtc) ModuleRun() {
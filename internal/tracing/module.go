@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/let-light/gomodule"
+	feature_tracing "github.com/pingostack/neon/features/tracing"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/pingostack/neon/pkg/trace"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+var tracingModule *tracing
+
+const defaultSampleRatio = 1
+
+type TracingSettings struct {
+	Enable      bool              `json:"enable" mapstructure:"enable"`
+	Endpoint    string            `json:"endpoint" mapstructure:"endpoint"`
+	Headers     map[string]string `json:"headers" mapstructure:"headers"`
+	ServiceName string            `json:"serviceName" mapstructure:"serviceName"`
+	// SampleRatio is the fraction of root traces exported, from 0 to 1, all
+	// of them when unset. Tracing is turned off with Enable.
+	SampleRatio          float64 `json:"sampleRatio" mapstructure:"sampleRatio"`
+	BatchSize            int     `json:"batchSize" mapstructure:"batchSize"`
+	FlushIntervalSeconds int     `json:"flushIntervalSeconds" mapstructure:"flushIntervalSeconds"`
+}
+
+type tracing struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings TracingSettings
+	settings    *TracingSettings
+	logger      *logrus.Entry
+	provider    *sdktrace.TracerProvider
+}
+
+func init() {
+	tracingModule = &tracing{
+		logger: logrus.WithField("module", "tracing"),
+	}
+}
+
+func TracingModule() *tracing {
+	return tracingModule
+}
+
+func (t *tracing) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	t.ctx = ctx
+	return &t.preSettings, nil
+}
+
+func (t *tracing) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+func (t *tracing) ConfigChanged() {
+	if t.settings != nil {
+		return
+	}
+
+	t.settings = &t.preSettings
+	if !t.settings.Enable || t.settings.Endpoint == "" {
+		return
+	}
+
+	if t.settings.SampleRatio <= 0 || t.settings.SampleRatio > 1 {
+		if t.settings.SampleRatio != 0 {
+			t.logger.WithField("sampleRatio", t.settings.SampleRatio).Warn("sample ratio out of range, sampling all traces")
+		}
+		t.settings.SampleRatio = defaultSampleRatio
+	}
+
+	provider, err := trace.SetupOTLP(t.ctx, trace.OTLPOptions{
+		Endpoint:      t.settings.Endpoint,
+		Headers:       t.settings.Headers,
+		ServiceName:   t.settings.ServiceName,
+		SampleRatio:   t.settings.SampleRatio,
+		BatchSize:     t.settings.BatchSize,
+		FlushInterval: time.Duration(t.settings.FlushIntervalSeconds) * time.Second,
+		Logger:        t.logger,
+	})
+	if err != nil {
+		t.logger.WithError(err).Error("tracing setup failed")
+		return
+	}
+	t.provider = provider
+
+	t.logger.WithField("endpoint", t.settings.Endpoint).Info("tracing enabled")
+}
+
+func (t *tracing) ModuleRun() {
+	defer metrics.Track("tracing")()
+
+	<-t.ctx.Done()
+
+	if t.provider == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := t.provider.Shutdown(ctx); err != nil {
+		t.logger.WithError(err).Error("tracing shutdown failed")
+	}
+}
+
+func (t *tracing) Type() interface{} {
+	return feature_tracing.Type()
+}
@@ -0,0 +1,91 @@
+package vhost
+
+import (
+	"context"
+	"time"
+
+	"github.com/let-light/gomodule"
+	feature_vhost "github.com/pingostack/neon/features/vhost"
+	"github.com/pingostack/neon/pkg/eventbus"
+	"github.com/pingostack/neon/pkg/eventemitter"
+	"github.com/pingostack/neon/pkg/metrics"
+	vhostlib "github.com/pingostack/neon/pkg/vhost"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var vhostModule *vhost
+
+type vhost struct {
+	gomodule.DefaultModule
+	ctx         context.Context
+	preSettings vhostlib.Settings
+	settings    *vhostlib.Settings
+	logger      *logrus.Entry
+}
+
+func init() {
+	vhostModule = &vhost{
+		logger: logrus.WithField("module", "vhost"),
+	}
+}
+
+func VhostModule() *vhost {
+	return vhostModule
+}
+
+func (v *vhost) InitModule(ctx context.Context, _ *gomodule.Manager) (interface{}, error) {
+	v.ctx = ctx
+	return &v.preSettings, nil
+}
+
+func (v *vhost) InitCommand() ([]*cobra.Command, error) {
+	return nil, nil
+}
+
+func (v *vhost) ConfigChanged() {
+	if v.settings == nil {
+		v.settings = &v.preSettings
+	}
+
+	m, err := vhostlib.NewManager(*v.settings)
+	if err != nil {
+		v.logger.WithError(err).Error("invalid vhosts, tenants disabled")
+		vhostlib.SetDefault(nil)
+		return
+	}
+
+	m.Adopt(vhostlib.Default())
+	m.OnWarning(v.onWarning)
+	vhostlib.SetDefault(m)
+	v.logger.WithField("tenants", len(v.settings.Tenants)).Debug("vhosts applied")
+}
+
+func (v *vhost) onWarning(w vhostlib.Warning) {
+	v.logger.WithFields(logrus.Fields{
+		"tenant":  w.Tenant,
+		"counter": w.Counter,
+		"value":   w.Value,
+		"soft":    w.Limit.Soft,
+		"hard":    w.Limit.Hard,
+	}).Warn("tenant quota reached soft limit")
+
+	eventemitter.Publish(eventbus.Default(), eventbus.TopicQuotaWarning, eventbus.QuotaWarning{
+		Tenant:  w.Tenant,
+		Counter: string(w.Counter),
+		Value:   w.Value,
+		Soft:    w.Limit.Soft,
+		Hard:    w.Limit.Hard,
+		Time:    time.Now(),
+	})
+}
+
+func (v *vhost) ModuleRun() {
+	defer metrics.Track("vhost")()
+
+	<-v.ctx.Done()
+}
+
+func (v *vhost) Type() interface{} {
+	return feature_vhost.Type()
+}
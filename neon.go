@@ -0,0 +1,143 @@
+// Package neon embeds the neon server in a Go application: it runs the modules
+// of cmd/neon in process and gives access to the hub, to publish frames to
+// streams and subscribe to them without a protocol in between.
+//
+//	srv := neon.NewServer(neon.Config{ConfigFile: "config.yml"})
+//	if err := srv.Start(ctx); err != nil {
+//		...
+//	}
+//	session, err := srv.Hub().Publish(ctx, neon.StreamParams{Namespace: "live", Stream: "cam1"}, src)
+//
+// The modules are process wide, a process runs a single Server.
+package neon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/let-light/gomodule"
+	"github.com/pingostack/neon/apps/admin"
+	"github.com/pingostack/neon/apps/cluster"
+	"github.com/pingostack/neon/apps/compositor"
+	"github.com/pingostack/neon/apps/hls"
+	"github.com/pingostack/neon/apps/hooks"
+	"github.com/pingostack/neon/apps/mixer"
+	"github.com/pingostack/neon/apps/onvif"
+	"github.com/pingostack/neon/apps/overlay"
+	"github.com/pingostack/neon/apps/playout"
+	"github.com/pingostack/neon/apps/pms"
+	"github.com/pingostack/neon/apps/record"
+	"github.com/pingostack/neon/apps/relay"
+	"github.com/pingostack/neon/apps/roq"
+	"github.com/pingostack/neon/apps/testsrc"
+	"github.com/pingostack/neon/apps/whip"
+	"github.com/pingostack/neon/apps/wt"
+	"github.com/pingostack/neon/internal/acl"
+	"github.com/pingostack/neon/internal/auth"
+	"github.com/pingostack/neon/internal/certs"
+	"github.com/pingostack/neon/internal/core"
+	"github.com/pingostack/neon/internal/logging"
+	"github.com/pingostack/neon/internal/ports"
+	"github.com/pingostack/neon/internal/ratelimit"
+	"github.com/pingostack/neon/internal/rtc"
+	"github.com/pingostack/neon/internal/tracing"
+	"github.com/pingostack/neon/internal/vhost"
+)
+
+var ErrStarted = errors.New("neon server already started")
+
+var started int32
+
+type Config struct {
+	// ConfigFile is the configuration of the modules, config.yml of the
+	// working directory when empty.
+	ConfigFile string
+	// Args are the flags of the modules, the command line of the application
+	// is left alone.
+	Args []string
+}
+
+type Server struct {
+	cfg Config
+	hub *Hub
+}
+
+func NewServer(cfg Config) *Server {
+	return &Server{
+		cfg: cfg,
+		hub: &Hub{},
+	}
+}
+
+// RegisterModules registers the modules of the server with gomodule, for
+// applications that launch gomodule themselves.
+func RegisterModules() {
+	gomodule.RegisterDefaultModules()
+	gomodule.RegisterWithName(logging.LoggingModule(), "logging")
+	gomodule.RegisterWithName(acl.ACLModule(), "acl")
+	gomodule.RegisterWithName(certs.CertsModule(), "certs")
+	gomodule.RegisterWithName(tracing.TracingModule(), "tracing")
+	gomodule.RegisterWithName(ratelimit.RatelimitModule(), "ratelimit")
+	gomodule.RegisterWithName(vhost.VhostModule(), "vhost")
+	gomodule.RegisterWithName(ports.PortsModule(), "ports")
+	gomodule.RegisterWithName(whip.WhipModule(), "whip")
+	gomodule.RegisterWithName(pms.PMSModule(), "pms")
+	gomodule.RegisterWithName(core.CoreModule(), "core")
+	gomodule.RegisterWithName(relay.RelayModule(), "relay")
+	gomodule.RegisterWithName(roq.RoqModule(), "roq")
+	gomodule.RegisterWithName(cluster.ClusterModule(), "cluster")
+	gomodule.RegisterWithName(auth.AuthModule(), "auth")
+	gomodule.RegisterWithName(rtc.RtcModule(), "webrtc")
+	gomodule.RegisterWithName(admin.AdminModule(), "admin")
+	gomodule.RegisterWithName(hooks.HooksModule(), "hooks")
+	gomodule.RegisterWithName(record.RecordModule(), "record")
+	gomodule.RegisterWithName(onvif.OnvifModule(), "onvif")
+	gomodule.RegisterWithName(hls.HlsModule(), "hls")
+	gomodule.RegisterWithName(wt.WtModule(), "webtransport")
+	gomodule.RegisterWithName(testsrc.TestsrcModule(), "testsrc")
+	gomodule.RegisterWithName(mixer.MixerModule(), "mixer")
+	gomodule.RegisterWithName(compositor.CompositorModule(), "compositor")
+	gomodule.RegisterWithName(playout.PlayoutModule(), "playout")
+	gomodule.RegisterWithName(overlay.OverlayModule(), "overlay")
+}
+
+// Start runs the modules until ctx is done or Stop is called. The hub takes
+// sessions a moment later, Publish and Subscribe wait for it.
+func (s *Server) Start(ctx context.Context) (err error) {
+	if !atomic.CompareAndSwapInt32(&started, 0, 1) {
+		return ErrStarted
+	}
+
+	args := []string{}
+	if s.cfg.ConfigFile != "" {
+		args = append(args, "-c", s.cfg.ConfigFile)
+	}
+	args = append(args, s.cfg.Args...)
+	gomodule.GetRootCmd().SetArgs(args)
+
+	RegisterModules()
+
+	// the modules panic on invalid configuration
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("start neon: %v", r)
+		}
+	}()
+
+	return gomodule.Launch(ctx)
+}
+
+// Wait blocks until the modules stopped.
+func (s *Server) Wait() {
+	gomodule.Wait()
+}
+
+func (s *Server) Stop() {
+	gomodule.Stop()
+}
+
+func (s *Server) Hub() *Hub {
+	return s.hub
+}
@@ -0,0 +1,268 @@
+package acl
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Settings struct {
+	Allow         []string `json:"allow" mapstructure:"allow"`
+	Deny          []string `json:"deny" mapstructure:"deny"`
+	MaxConnsPerIP int      `json:"maxConnsPerIP" mapstructure:"maxConnsPerIP"`
+}
+
+// ACL applies allow/deny lists, the shared ban list and a per-ip connection limit.
+// A nil *ACL allows everything.
+type ACL struct {
+	allow         []*net.IPNet
+	deny          []*net.IPNet
+	maxConnsPerIP int
+	lock          sync.Mutex
+	conns         map[string]int
+	bans          *BanList
+}
+
+func New(settings Settings, bans *BanList) (*ACL, error) {
+	a := &ACL{
+		maxConnsPerIP: settings.MaxConnsPerIP,
+		conns:         make(map[string]int),
+		bans:          bans,
+	}
+
+	var err error
+	if a.allow, err = parseCIDRs(settings.Allow); err != nil {
+		return nil, err
+	}
+
+	if a.deny, err = parseCIDRs(settings.Deny); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// LocalPeer is the address of unix socket peers, as net/http names them.
+// They have no ip, the permissions of the socket file guard them.
+const LocalPeer = "@"
+
+// Check reports whether addr (ip or ip:port) may connect, without counting it.
+func (a *ACL) Check(addr string) error {
+	if a == nil || addr == LocalPeer {
+		return nil
+	}
+
+	ip := parseIP(addr)
+	if ip == nil {
+		return ErrInvalidAddress
+	}
+
+	if a.bans != nil && a.bans.Banned(ip) {
+		return ErrBanned
+	}
+
+	if contains(a.deny, ip) {
+		return ErrDenied
+	}
+
+	if len(a.allow) > 0 && !contains(a.allow, ip) {
+		return ErrDenied
+	}
+
+	return nil
+}
+
+// Acquire checks addr and accounts one connection for it, release must be
+// called when the connection is closed.
+func (a *ACL) Acquire(addr string) (release func(), err error) {
+	if a == nil {
+		return func() {}, nil
+	}
+
+	if err := a.Check(addr); err != nil {
+		return nil, err
+	}
+
+	if a.maxConnsPerIP <= 0 || addr == LocalPeer {
+		return func() {}, nil
+	}
+
+	key := parseIP(addr).String()
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.conns[key] >= a.maxConnsPerIP {
+		return nil, ErrTooManyConnections
+	}
+	a.conns[key]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			a.lock.Lock()
+			defer a.lock.Unlock()
+
+			if a.conns[key]--; a.conns[key] <= 0 {
+				delete(a.conns, key)
+			}
+		})
+	}, nil
+}
+
+func (a *ACL) Connections() map[string]int {
+	if a == nil {
+		return nil
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	conns := make(map[string]int, len(a.conns))
+	for k, v := range a.conns {
+		conns[k] = v
+	}
+
+	return conns
+}
+
+type Ban struct {
+	CIDR      string    `json:"cidr"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+	network   *net.IPNet
+}
+
+// BanList holds manual blocks shared by all ACLs.
+type BanList struct {
+	lock sync.RWMutex
+	bans map[string]*Ban
+}
+
+func NewBanList() *BanList {
+	return &BanList{
+		bans: make(map[string]*Ban),
+	}
+}
+
+// Add bans an ip or cidr, a zero duration bans forever.
+func (bl *BanList) Add(target string, d time.Duration, reason string) (*Ban, error) {
+	nets, err := parseCIDRs([]string{target})
+	if err != nil {
+		return nil, err
+	}
+
+	ban := &Ban{
+		CIDR:      nets[0].String(),
+		Reason:    reason,
+		CreatedAt: time.Now(),
+		network:   nets[0],
+	}
+
+	if d > 0 {
+		ban.ExpiresAt = ban.CreatedAt.Add(d)
+	}
+
+	bl.lock.Lock()
+	defer bl.lock.Unlock()
+
+	bl.bans[ban.CIDR] = ban
+
+	return ban, nil
+}
+
+func (bl *BanList) Remove(target string) bool {
+	nets, err := parseCIDRs([]string{target})
+	if err != nil {
+		return false
+	}
+
+	bl.lock.Lock()
+	defer bl.lock.Unlock()
+
+	_, found := bl.bans[nets[0].String()]
+	delete(bl.bans, nets[0].String())
+
+	return found
+}
+
+func (bl *BanList) List() []Ban {
+	bl.lock.RLock()
+	defer bl.lock.RUnlock()
+
+	now := time.Now()
+	bans := make([]Ban, 0, len(bl.bans))
+	for _, b := range bl.bans {
+		if b.expired(now) {
+			continue
+		}
+		bans = append(bans, *b)
+	}
+
+	return bans
+}
+
+func (bl *BanList) Banned(ip net.IP) bool {
+	bl.lock.RLock()
+	defer bl.lock.RUnlock()
+
+	now := time.Now()
+	for _, b := range bl.bans {
+		if !b.expired(now) && b.network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b *Ban) expired(now time.Time) bool {
+	return !b.ExpiresAt.IsZero() && now.After(b.ExpiresAt)
+}
+
+func parseIP(addr string) net.IP {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+
+	return net.ParseIP(strings.Trim(addr, "[]"))
+}
+
+func parseCIDRs(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, ErrInvalidAddress
+			}
+
+			if ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
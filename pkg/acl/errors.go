@@ -0,0 +1,10 @@
+package acl
+
+import "errors"
+
+var (
+	ErrInvalidAddress     = errors.New("invalid address")
+	ErrBanned             = errors.New("address banned")
+	ErrDenied             = errors.New("address denied")
+	ErrTooManyConnections = errors.New("too many connections from address")
+)
@@ -0,0 +1,36 @@
+package acl
+
+import "sync"
+
+var (
+	lock    sync.RWMutex
+	modules = make(map[string]*ACL)
+	bans    = NewBanList()
+)
+
+func Bans() *BanList {
+	return bans
+}
+
+func Set(module string, a *ACL) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	modules[module] = a
+}
+
+// For returns the ACL of module, falling back to the "default" entry.
+func For(module string) *ACL {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	if a, found := modules[module]; found {
+		return a
+	}
+
+	return modules[DefaultModule]
+}
+
+const (
+	DefaultModule = "default"
+)
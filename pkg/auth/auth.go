@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type Action int
+
+const (
+	ActionPlay Action = 1 + iota
+	ActionPublish
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionPlay:
+		return "play"
+	case ActionPublish:
+		return "publish"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	ProtocolRTSP         = "rtsp"
+	ProtocolWebRTC       = "webrtc"
+	ProtocolRTMP         = "rtmp"
+	ProtocolHLS          = "hls"
+	ProtocolWebTransport = "webtransport"
+)
+
+// Request carries whatever credentials the protocol was able to extract.
+type Request struct {
+	Protocol   string
+	Action     Action
+	Path       string
+	RemoteAddr string
+	// Host is the host the client connected to, tenants are told by it.
+	Host     string
+	Username string
+	Password string
+	Token    string
+	Digest   *DigestCredentials
+	Args     map[string]string
+}
+
+type Identity struct {
+	Subject  string
+	Provider string
+	// Tenant is the tenant the credentials belong to, if they name one.
+	Tenant string
+}
+
+// Provider returns ErrNotApplicable when it can not judge the request, letting
+// the next provider try. Any other error denies the request.
+type Provider interface {
+	Name() string
+	Authenticate(ctx context.Context, req *Request) (*Identity, error)
+}
+
+type Authenticator interface {
+	Authenticate(ctx context.Context, req *Request) (*Identity, error)
+}
+
+type Chain struct {
+	providers []Provider
+}
+
+func NewChain(providers ...Provider) *Chain {
+	return &Chain{
+		providers: providers,
+	}
+}
+
+func (c *Chain) Authenticate(ctx context.Context, req *Request) (*Identity, error) {
+	for _, p := range c.providers {
+		id, err := p.Authenticate(ctx, req)
+		if err == ErrNotApplicable {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if id.Provider == "" {
+			id.Provider = p.Name()
+		}
+
+		return id, nil
+	}
+
+	return nil, ErrUnauthorized
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer" header.
+func BearerToken(h http.Header) string {
+	v := h.Get("Authorization")
+	if len(v) > 7 && strings.EqualFold(v[:7], "bearer ") {
+		return strings.TrimSpace(v[7:])
+	}
+
+	return ""
+}
+
+// TokenFromURL extracts the token from the "token" query parameter, as used by
+// protocols that can only carry credentials in the url.
+func TokenFromURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+
+	return u.Query().Get("token")
+}
+
+func ArgsFromURL(u *url.URL) map[string]string {
+	args := make(map[string]string)
+	if u == nil {
+		return args
+	}
+
+	for k, v := range u.Query() {
+		if len(v) > 0 {
+			args[k] = v[0]
+		}
+	}
+
+	return args
+}
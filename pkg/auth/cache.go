@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+type decision struct {
+	id      *Identity
+	err     error
+	expires time.Time
+}
+
+// decisionCache remembers the answers of a callout for the same
+// credentials, keyed by a hash so that no secret is kept.
+type decisionCache struct {
+	lock    sync.Mutex
+	entries map[[sha256.Size]byte]decision
+	max     int
+}
+
+func newDecisionCache(max int) *decisionCache {
+	return &decisionCache{
+		entries: make(map[[sha256.Size]byte]decision),
+		max:     max,
+	}
+}
+
+// cacheKey covers all the request tells the callout, the address without
+// its port since clients reconnect from other ports.
+func cacheKey(req *Request) [sha256.Size]byte {
+	h := sha256.New()
+	addr := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+
+	for _, s := range []string{req.Protocol, req.Action.String(), req.Path, addr, req.Host, req.Username, req.Password, req.Token} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+
+	keys := make([]string, 0, len(req.Args))
+	for k := range req.Args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{'='})
+		h.Write([]byte(req.Args[k]))
+		h.Write([]byte{0})
+	}
+
+	var key [sha256.Size]byte
+	copy(key[:], h.Sum(nil))
+
+	return key
+}
+
+func (c *decisionCache) get(key [sha256.Size]byte) (decision, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	d, found := c.entries[key]
+	if !found {
+		return decision{}, false
+	}
+
+	if time.Now().After(d.expires) {
+		delete(c.entries, key)
+		return decision{}, false
+	}
+
+	return d, true
+}
+
+func (c *decisionCache) put(key [sha256.Size]byte, d decision) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(c.entries) >= c.max {
+		now := time.Now()
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+
+		// still full, any entry makes room
+		for k := range c.entries {
+			if len(c.entries) < c.max {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[key] = d
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DigestCredentials is a parsed RFC 2617 Authorization: Digest header.
+type DigestCredentials struct {
+	Username string
+	Realm    string
+	Nonce    string
+	URI      string
+	Response string
+	Method   string
+}
+
+func ParseDigest(header, method string) (*DigestCredentials, error) {
+	if len(header) < 7 || !strings.EqualFold(header[:7], "digest ") {
+		return nil, ErrInvalidDigest
+	}
+
+	d := &DigestCredentials{Method: strings.ToUpper(method)}
+	for _, kv := range splitParams(header[7:]) {
+		idx := strings.Index(kv, "=")
+		if idx == -1 {
+			continue
+		}
+
+		key := strings.ToLower(strings.TrimSpace(kv[:idx]))
+		value := strings.Trim(strings.TrimSpace(kv[idx+1:]), `"`)
+		switch key {
+		case "username":
+			d.Username = value
+		case "realm":
+			d.Realm = value
+		case "nonce":
+			d.Nonce = value
+		case "uri":
+			d.URI = value
+		case "response":
+			d.Response = value
+		}
+	}
+
+	if d.Username == "" || d.Nonce == "" || d.Response == "" {
+		return nil, ErrInvalidDigest
+	}
+
+	return d, nil
+}
+
+func splitParams(s string) []string {
+	params := make([]string, 0)
+	quoted := false
+	start := 0
+	for i, c := range s {
+		switch c {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				params = append(params, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(params, s[start:])
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func (d *DigestCredentials) Verify(password string) bool {
+	ha1 := md5Hex(d.Username + ":" + d.Realm + ":" + password)
+	ha2 := md5Hex(d.Method + ":" + d.URI)
+	return md5Hex(ha1+":"+d.Nonce+":"+ha2) == strings.ToLower(d.Response)
+}
+
+// MatchURI tells whether the digest was computed for target, the url of the
+// request. Clients send the url or only its path, a digest of another uri
+// is a replayed one.
+func (d *DigestCredentials) MatchURI(target string) bool {
+	if d.URI == target {
+		return true
+	}
+
+	got, err := url.Parse(d.URI)
+	if err != nil {
+		return false
+	}
+	want, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSuffix(got.Path, "/") == strings.TrimSuffix(want.Path, "/") && got.RawQuery == want.RawQuery
+}
+
+func NewNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func DigestChallenge(realm, nonce string) string {
+	return fmt.Sprintf(`Digest realm="%s", nonce="%s"`, realm, nonce)
+}
+
+// ParseDigestChallenge reads the realm and nonce of a WWW-Authenticate:
+// Digest header, what a client answers with DigestAuthorization.
+func ParseDigestChallenge(header string) (realm, nonce string, err error) {
+	if len(header) < 7 || !strings.EqualFold(header[:7], "digest ") {
+		return "", "", ErrInvalidDigest
+	}
+
+	for _, kv := range splitParams(header[7:]) {
+		idx := strings.Index(kv, "=")
+		if idx == -1 {
+			continue
+		}
+
+		value := strings.Trim(strings.TrimSpace(kv[idx+1:]), `"`)
+		switch strings.ToLower(strings.TrimSpace(kv[:idx])) {
+		case "realm":
+			realm = value
+		case "nonce":
+			nonce = value
+		}
+	}
+
+	if nonce == "" {
+		return "", "", ErrInvalidDigest
+	}
+
+	return realm, nonce, nil
+}
+
+// DigestAuthorization is the Authorization header of a request of method to
+// uri answering a challenge of realm and nonce.
+func DigestAuthorization(username, password, realm, nonce, method, uri string) string {
+	ha1 := md5Hex(username + ":" + realm + ":" + password)
+	ha2 := md5Hex(strings.ToUpper(method) + ":" + uri)
+
+	return fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		username, realm, nonce, uri, md5Hex(ha1+":"+nonce+":"+ha2))
+}
@@ -0,0 +1,14 @@
+package auth
+
+import "errors"
+
+var (
+	ErrNotApplicable  = errors.New("auth provider not applicable")
+	ErrUnauthorized   = errors.New("unauthorized")
+	ErrForbidden      = errors.New("forbidden")
+	ErrInvalidToken   = errors.New("invalid token")
+	ErrTokenExpired   = errors.New("token expired")
+	ErrInvalidDigest  = errors.New("invalid digest credentials")
+	ErrUnsupportedAlg = errors.New("unsupported jwt algorithm")
+	ErrNoSecret       = errors.New("no jwt secret configured")
+)
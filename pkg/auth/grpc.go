@@ -0,0 +1,331 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	grpcMethod = "/neon.auth.AuthService/Authenticate"
+
+	// status codes of grpc
+	grpcOK               = 0
+	grpcPermissionDenied = 7
+	grpcUnauthenticated  = 16
+
+	defaultGRPCConns      = 2
+	defaultGRPCTimeout    = 500 * time.Millisecond
+	defaultCacheEntries   = 10000
+	defaultAllowCacheTime = 30 * time.Second
+	defaultDenyCacheTime  = 5 * time.Second
+)
+
+type GRPCCacheSettings struct {
+	// AllowSeconds and DenySeconds are how long decisions are reused, a
+	// negative value disables caching of the decision.
+	AllowSeconds int `json:"allowSeconds" mapstructure:"allowSeconds"`
+	DenySeconds  int `json:"denySeconds" mapstructure:"denySeconds"`
+	MaxEntries   int `json:"maxEntries" mapstructure:"maxEntries"`
+}
+
+type GRPCSettings struct {
+	// Address of the AuthService of grpc.proto, host:port.
+	Address string `json:"address" mapstructure:"address"`
+	TLS     bool   `json:"tls" mapstructure:"tls"`
+	// Conns is the number of http/2 connections the calls are spread over.
+	Conns     int `json:"conns" mapstructure:"conns"`
+	TimeoutMs int `json:"timeoutMs" mapstructure:"timeoutMs"`
+	// Metadata is sent with every call, e.g. authorization.
+	Metadata map[string]string `json:"metadata" mapstructure:"metadata"`
+	Cache    GRPCCacheSettings `json:"cache" mapstructure:"cache"`
+}
+
+// GRPCProvider asks the AuthService of grpc.proto over a pool of http/2
+// connections and caches the decisions. Failed calls are not cached and
+// deny the request.
+type GRPCProvider struct {
+	settings GRPCSettings
+	url      string
+	timeout  time.Duration
+	conns    []*http2.Transport
+	next     uint32
+	cache    *decisionCache
+}
+
+func NewGRPCProvider(settings GRPCSettings) *GRPCProvider {
+	if settings.Conns <= 0 {
+		settings.Conns = defaultGRPCConns
+	}
+
+	if settings.Cache.MaxEntries <= 0 {
+		settings.Cache.MaxEntries = defaultCacheEntries
+	}
+
+	p := &GRPCProvider{
+		settings: settings,
+		timeout:  defaultGRPCTimeout,
+		cache:    newDecisionCache(settings.Cache.MaxEntries),
+	}
+
+	if settings.TimeoutMs > 0 {
+		p.timeout = time.Duration(settings.TimeoutMs) * time.Millisecond
+	}
+
+	scheme := "http"
+	if settings.TLS {
+		scheme = "https"
+	}
+	p.url = (&url.URL{Scheme: scheme, Host: settings.Address, Path: grpcMethod}).String()
+
+	for i := 0; i < settings.Conns; i++ {
+		t := &http2.Transport{}
+		if !settings.TLS {
+			// h2c, http/2 without tls
+			t.AllowHTTP = true
+			t.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			}
+		}
+		p.conns = append(p.conns, t)
+	}
+
+	return p
+}
+
+func (p *GRPCProvider) Name() string {
+	return "grpc"
+}
+
+// Close closes the connections of the pool.
+func (p *GRPCProvider) Close() error {
+	for _, t := range p.conns {
+		t.CloseIdleConnections()
+	}
+
+	return nil
+}
+
+func (p *GRPCProvider) Authenticate(ctx context.Context, req *Request) (*Identity, error) {
+	if req.Digest != nil {
+		// digest responses can not be verified without the password
+		return nil, ErrNotApplicable
+	}
+
+	key := cacheKey(req)
+	if d, found := p.cache.get(key); found {
+		if d.id == nil {
+			return nil, d.err
+		}
+
+		// the chain names the provider on the identity
+		id := *d.id
+		return &id, nil
+	}
+
+	resp, err := p.call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	d := decision{err: ErrUnauthorized}
+	ttl := time.Duration(p.settings.Cache.DenySeconds) * time.Second
+	if p.settings.Cache.DenySeconds == 0 {
+		ttl = defaultDenyCacheTime
+	}
+
+	switch {
+	case resp.allow:
+		d = decision{id: &Identity{Subject: resp.subject, Tenant: resp.tenant}}
+		ttl = time.Duration(p.settings.Cache.AllowSeconds) * time.Second
+		if p.settings.Cache.AllowSeconds == 0 {
+			ttl = defaultAllowCacheTime
+		}
+	case resp.forbidden:
+		d.err = ErrForbidden
+	}
+
+	if resp.cacheSeconds != 0 {
+		ttl = time.Duration(resp.cacheSeconds) * time.Second
+	}
+
+	if ttl > 0 {
+		d.expires = time.Now().Add(ttl)
+		p.cache.put(key, d)
+	}
+
+	if d.id == nil {
+		return nil, d.err
+	}
+
+	id := *d.id
+	return &id, nil
+}
+
+type grpcResponse struct {
+	allow        bool
+	forbidden    bool
+	subject      string
+	tenant       string
+	cacheSeconds int32
+}
+
+// call makes the unary call, a message is framed by a compression flag and
+// its length, the status comes in the trailers.
+func (p *GRPCProvider) call(ctx context.Context, req *Request) (*grpcResponse, error) {
+	msg := marshalAuthRequest(req)
+	body := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(msg)))
+	body = append(body, msg...)
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	hreq.Header.Set("Content-Type", "application/grpc+proto")
+	hreq.Header.Set("TE", "trailers")
+	hreq.Header.Set("Grpc-Timeout", strconv.FormatInt(p.timeout.Milliseconds(), 10)+"m")
+	for k, v := range p.settings.Metadata {
+		hreq.Header.Set(k, v)
+	}
+
+	t := p.conns[atomic.AddUint32(&p.next, 1)%uint32(len(p.conns))]
+	resp, err := t.RoundTrip(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("grpc auth callout unexpected status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// a call failing at once answers with the status in the headers
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return nil, fmt.Errorf("grpc auth callout without status")
+	}
+
+	switch code {
+	case grpcOK:
+	case grpcUnauthenticated:
+		return &grpcResponse{}, nil
+	case grpcPermissionDenied:
+		return &grpcResponse{forbidden: true}, nil
+	default:
+		return nil, fmt.Errorf("grpc auth callout failed with status %d: %s", code, message)
+	}
+
+	if len(data) < 5 || data[0] != 0 {
+		return nil, fmt.Errorf("grpc auth callout bad response")
+	}
+
+	n := binary.BigEndian.Uint32(data[1:5])
+	if uint32(len(data)-5) < n {
+		return nil, fmt.Errorf("grpc auth callout short response")
+	}
+
+	return unmarshalAuthResponse(data[5 : 5+n])
+}
+
+func marshalAuthRequest(req *Request) []byte {
+	var b []byte
+	for i, s := range []string{req.Protocol, req.Action.String(), req.Path, req.RemoteAddr, req.Host, req.Username, req.Password, req.Token} {
+		if s != "" {
+			b = protowire.AppendTag(b, protowire.Number(i+1), protowire.BytesType)
+			b = protowire.AppendString(b, s)
+		}
+	}
+
+	// a map field is a repeated entry of key 1 and value 2
+	for k, v := range req.Args {
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, k)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendString(entry, v)
+
+		b = protowire.AppendTag(b, 9, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+
+	return b
+}
+
+func unmarshalAuthResponse(b []byte) (*grpcResponse, error) {
+	resp := &grpcResponse{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch {
+		case typ == protowire.VarintType:
+			x, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+
+			switch num {
+			case 1:
+				resp.allow = protowire.DecodeBool(x)
+			case 2:
+				resp.forbidden = protowire.DecodeBool(x)
+			case 5:
+				resp.cacheSeconds = int32(x)
+			}
+		case typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+
+			switch num {
+			case 3:
+				resp.subject = string(v)
+			case 4:
+				resp.tenant = string(v)
+			}
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+
+	return resp, nil
+}
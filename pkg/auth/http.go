@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type HTTPCallbackSettings struct {
+	URL            string            `json:"url" mapstructure:"url"`
+	Headers        map[string]string `json:"headers" mapstructure:"headers"`
+	TimeoutSeconds int               `json:"timeoutSeconds" mapstructure:"timeoutSeconds"`
+}
+
+type callbackRequest struct {
+	Protocol   string `json:"protocol"`
+	Action     string `json:"action"`
+	Path       string `json:"path"`
+	RemoteAddr string `json:"remoteAddr"`
+	Host       string `json:"host,omitempty"`
+	Username   string `json:"username,omitempty"`
+	Password   string `json:"password,omitempty"`
+	Token      string `json:"token,omitempty"`
+}
+
+type callbackResponse struct {
+	Subject string `json:"subject"`
+	Tenant  string `json:"tenant"`
+}
+
+// HTTPProvider asks an external service. A 2xx answer allows the request,
+// 401 and 403 deny it, anything else is treated as an error.
+type HTTPProvider struct {
+	settings HTTPCallbackSettings
+	client   *http.Client
+}
+
+func NewHTTPProvider(settings HTTPCallbackSettings) *HTTPProvider {
+	if settings.TimeoutSeconds <= 0 {
+		settings.TimeoutSeconds = 3
+	}
+
+	return &HTTPProvider{
+		settings: settings,
+		client:   &http.Client{Timeout: time.Duration(settings.TimeoutSeconds) * time.Second},
+	}
+}
+
+func (p *HTTPProvider) Name() string {
+	return "http"
+}
+
+func (p *HTTPProvider) Authenticate(ctx context.Context, req *Request) (*Identity, error) {
+	if req.Digest != nil {
+		// digest responses can not be verified without the password
+		return nil, ErrNotApplicable
+	}
+
+	body, err := json.Marshal(callbackRequest{
+		Protocol:   req.Protocol,
+		Action:     req.Action.String(),
+		Path:       req.Path,
+		RemoteAddr: req.RemoteAddr,
+		Host:       req.Host,
+		Username:   req.Username,
+		Password:   req.Password,
+		Token:      req.Token,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.settings.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	hreq.Header.Set("Content-Type", "application/json")
+	for k, v := range p.settings.Headers {
+		hreq.Header.Set(k, v)
+	}
+
+	resp, err := p.client.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return nil, ErrUnauthorized
+	case resp.StatusCode == http.StatusForbidden:
+		return nil, ErrForbidden
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return nil, fmt.Errorf("auth callback unexpected status %s", resp.Status)
+	}
+
+	var cr callbackResponse
+	json.NewDecoder(resp.Body).Decode(&cr)
+
+	return &Identity{Subject: cr.Subject, Tenant: cr.Tenant}, nil
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"hash"
+	"strings"
+	"time"
+)
+
+type JWTSettings struct {
+	Secret   string `json:"secret" mapstructure:"secret"`
+	Issuer   string `json:"issuer" mapstructure:"issuer"`
+	Audience string `json:"audience" mapstructure:"audience"`
+	// TenantClaim names the claim holding the tenant of the client.
+	TenantClaim string `json:"tenantClaim" mapstructure:"tenantClaim"`
+}
+
+// Claims are the token claims understood by JWTProvider, permissions are taken
+// from the publish/play claims.
+type Claims struct {
+	Subject   string `json:"sub"`
+	Issuer    string `json:"iss"`
+	Audience  string `json:"aud"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf"`
+	Permissions
+
+	tenant string
+}
+
+// JWTProvider validates HMAC signed (HS256/HS384/HS512) bearer tokens.
+type JWTProvider struct {
+	settings JWTSettings
+}
+
+func NewJWTProvider(settings JWTSettings) *JWTProvider {
+	return &JWTProvider{
+		settings: settings,
+	}
+}
+
+func (p *JWTProvider) Name() string {
+	return "jwt"
+}
+
+func (p *JWTProvider) Authenticate(ctx context.Context, req *Request) (*Identity, error) {
+	if req.Token == "" || strings.Count(req.Token, ".") != 2 {
+		return nil, ErrNotApplicable
+	}
+
+	claims, err := p.Parse(req.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.Allowed(req.Action, req.Path) {
+		return nil, ErrForbidden
+	}
+
+	return &Identity{Subject: claims.Subject, Tenant: claims.tenant}, nil
+}
+
+func (p *JWTProvider) Parse(token string) (*Claims, error) {
+	// anyone could sign with an empty key
+	if p.settings.Secret == "" {
+		return nil, ErrNoSecret
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var h func() hash.Hash
+	switch header.Alg {
+	case "HS256":
+		h = sha256.New
+	case "HS384":
+		h = sha512.New384
+	case "HS512":
+		h = sha512.New
+	default:
+		return nil, ErrUnsupportedAlg
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	mac := hmac.New(h, []byte(p.settings.Secret))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if p.settings.TenantClaim != "" {
+		var all map[string]interface{}
+		json.Unmarshal(payload, &all)
+		if tenant, ok := all[p.settings.TenantClaim].(string); ok {
+			claims.tenant = tenant
+		}
+	}
+
+	now := time.Now().Unix()
+	if claims.ExpiresAt != 0 && now >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+
+	if claims.NotBefore != 0 && now < claims.NotBefore {
+		return nil, ErrInvalidToken
+	}
+
+	if p.settings.Issuer != "" && claims.Issuer != p.settings.Issuer {
+		return nil, ErrInvalidToken
+	}
+
+	if p.settings.Audience != "" && claims.Audience != p.settings.Audience {
+		return nil, ErrInvalidToken
+	}
+
+	return &claims, nil
+}
@@ -0,0 +1,28 @@
+package auth
+
+import "github.com/pingostack/neon/pkg/utils"
+
+// Permissions lists stream path patterns per action, see utils.MatchStreamPath
+// for the pattern syntax.
+type Permissions struct {
+	Publish []string `json:"publish" mapstructure:"publish"`
+	Play    []string `json:"play" mapstructure:"play"`
+}
+
+func (p Permissions) Allowed(action Action, streamPath string) bool {
+	var patterns []string
+	switch action {
+	case ActionPublish:
+		patterns = p.Publish
+	case ActionPlay:
+		patterns = p.Play
+	}
+
+	for _, pattern := range patterns {
+		if utils.MatchStreamPath(pattern, streamPath) {
+			return true
+		}
+	}
+
+	return false
+}
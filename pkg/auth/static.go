@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+)
+
+type StaticUser struct {
+	Username    string `json:"username" mapstructure:"username"`
+	Password    string `json:"password" mapstructure:"password"`
+	Token       string `json:"token" mapstructure:"token"`
+	Permissions `mapstructure:",squash"`
+}
+
+// StaticProvider authenticates against users listed in the configuration.
+type StaticProvider struct {
+	users []StaticUser
+}
+
+func NewStaticProvider(users []StaticUser) *StaticProvider {
+	return &StaticProvider{
+		users: users,
+	}
+}
+
+func (p *StaticProvider) Name() string {
+	return "static"
+}
+
+func (p *StaticProvider) Authenticate(ctx context.Context, req *Request) (*Identity, error) {
+	user, err := p.lookup(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.Allowed(req.Action, req.Path) {
+		return nil, ErrForbidden
+	}
+
+	return &Identity{Subject: user.Username}, nil
+}
+
+func (p *StaticProvider) lookup(req *Request) (*StaticUser, error) {
+	for i := range p.users {
+		u := &p.users[i]
+		switch {
+		case req.Digest != nil:
+			if u.Username != req.Digest.Username {
+				continue
+			}
+			if !req.Digest.Verify(u.Password) {
+				return nil, ErrInvalidDigest
+			}
+			return u, nil
+
+		case req.Token != "":
+			if u.Token != "" && subtle.ConstantTimeCompare([]byte(u.Token), []byte(req.Token)) == 1 {
+				return u, nil
+			}
+
+		case req.Username != "":
+			if u.Username != req.Username {
+				continue
+			}
+			if subtle.ConstantTimeCompare([]byte(u.Password), []byte(req.Password)) != 1 {
+				return nil, ErrUnauthorized
+			}
+			return u, nil
+		}
+	}
+
+	return nil, ErrNotApplicable
+}
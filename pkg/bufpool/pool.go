@@ -0,0 +1,114 @@
+package bufpool
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// size classes cover an RTP packet, a jumbo datagram and a typical video frame
+var classes = []int{1500, 9000, 64 * 1024, 1024 * 1024}
+
+var pools = func() []*sync.Pool {
+	ps := make([]*sync.Pool, len(classes))
+	for i, size := range classes {
+		size := size
+		ps[i] = &sync.Pool{
+			New: func() interface{} {
+				return &Buffer{data: make([]byte, size)}
+			},
+		}
+	}
+	return ps
+}()
+
+// Buffer is a pooled, reference counted byte slice. The creator holds one
+// reference, every consumer that keeps the data beyond the call it was handed
+// in must Retain it and Release it when done.
+type Buffer struct {
+	data  []byte
+	n     int
+	refs  int32
+	class int
+}
+
+// Get returns a buffer of at least size bytes with its length set to size.
+func Get(size int) *Buffer {
+	class := -1
+	for i, c := range classes {
+		if size <= c {
+			class = i
+			break
+		}
+	}
+
+	var b *Buffer
+	if class < 0 {
+		b = &Buffer{data: make([]byte, size)}
+	} else {
+		b = pools[class].Get().(*Buffer)
+	}
+
+	b.n = size
+	b.class = class
+	atomic.StoreInt32(&b.refs, 1)
+
+	return b
+}
+
+// Bytes is the used part of the buffer.
+func (b *Buffer) Bytes() []byte {
+	return b.data[:b.n]
+}
+
+// SetLen shrinks the used part, e.g. to the number of bytes actually read.
+func (b *Buffer) SetLen(n int) {
+	if n < 0 || n > len(b.data) {
+		panic("bufpool: length out of range")
+	}
+
+	b.n = n
+}
+
+func (b *Buffer) Len() int {
+	return b.n
+}
+
+func (b *Buffer) Retain() *Buffer {
+	if atomic.AddInt32(&b.refs, 1) <= 1 {
+		panic("bufpool: retain of released buffer")
+	}
+
+	return b
+}
+
+// TryRetain takes a reference only if the buffer is still alive, for readers
+// racing with the owner's last Release.
+func (b *Buffer) TryRetain() bool {
+	for {
+		refs := atomic.LoadInt32(&b.refs)
+		if refs <= 0 {
+			return false
+		}
+
+		if atomic.CompareAndSwapInt32(&b.refs, refs, refs+1) {
+			return true
+		}
+	}
+}
+
+// Release drops a reference, the last one returns the buffer to its pool.
+// The data must not be used after releasing.
+func (b *Buffer) Release() {
+	refs := atomic.AddInt32(&b.refs, -1)
+	if refs > 0 {
+		return
+	}
+
+	if refs < 0 {
+		panic("bufpool: release of released buffer")
+	}
+
+	if b.class >= 0 {
+		pools[b.class].Put(b)
+	}
+}
@@ -0,0 +1,74 @@
+// Package caption reads the closed captions h264 and h265 carry in their
+// sei, the cc_data of atsc a/53 holding cea-608 and cea-708, and writes the
+// cea-608 captions as webvtt.
+package caption
+
+import (
+	"github.com/pingostack/neon/pkg/codec"
+	"github.com/pingostack/neon/pkg/deliver"
+)
+
+// CCType is the cc_type of a cc_data pair.
+type CCType uint8
+
+const (
+	CCField1 CCType = iota
+	CCField2
+	CCDTVCCData
+	CCDTVCCStart
+)
+
+// CC is a valid pair of cc_data bytes.
+type CC struct {
+	Type CCType
+	Data [2]byte
+}
+
+const (
+	// user_data_registered_itu_t_t35
+	seiPayloadRegisteredT35 = 4
+	countryUS               = 0xb5
+	providerATSC            = 0x0031
+	userDataTypeCC          = 0x03
+)
+
+// ExtractCC returns the valid cc_data of the sei of the annex b access unit
+// au of codec.
+func ExtractCC(c deliver.CodecType, au []byte) []CC {
+	var ccs []CC
+	codec.ForEachAnnexB(au, func(nalu []byte) bool {
+		codec.ForEachSEIMessage(c, nalu, func(typ int, body []byte) {
+			if typ == seiPayloadRegisteredT35 {
+				ccs = appendA53(ccs, body)
+			}
+		})
+		return true
+	})
+
+	return ccs
+}
+
+// appendA53 appends the cc_data of an atsc a/53 message, b starting at its
+// country code.
+func appendA53(ccs []CC, b []byte) []CC {
+	if len(b) < 10 || b[0] != countryUS || int(b[1])<<8|int(b[2]) != providerATSC ||
+		string(b[3:7]) != "GA94" || b[7] != userDataTypeCC {
+		return ccs
+	}
+
+	// process_cc_data_flag and cc_count, em_data follows
+	if b[8]&0x40 == 0 {
+		return ccs
+	}
+	count := int(b[8] & 0x1f)
+	b = b[10:]
+
+	for i := 0; i < count && len(b) >= 3; i++ {
+		if b[0]&0x04 != 0 {
+			ccs = append(ccs, CC{Type: CCType(b[0] & 0x03), Data: [2]byte{b[1], b[2]}})
+		}
+		b = b[3:]
+	}
+
+	return ccs
+}
@@ -0,0 +1,321 @@
+package caption
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	rows    = 15
+	columns = 32
+)
+
+type mode int
+
+const (
+	modePopOn mode = iota
+	modeRollUp
+	modePaintOn
+)
+
+// Cue is a caption shown from Start to End, on the timeline the decoder is
+// fed on.
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+type memory [rows][columns]rune
+
+// Decoder turns the cea-608 pairs of CC1, the first channel of field 1, into
+// cues. Pop-on captions are shown as sent, roll-up captions a line at once
+// and paint-on captions as they are drawn.
+type Decoder struct {
+	displayed    memory
+	nonDisplayed memory
+	mode         mode
+	rollUp       int
+	row          int
+	col          int
+	channel      int
+	textMode     bool
+	lastCtrl     [2]byte
+	shown        string
+	since        time.Duration
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{row: rows - 1}
+}
+
+// Decode feeds the pairs of an access unit presented at, it returns the
+// cues that ended.
+func (d *Decoder) Decode(at time.Duration, ccs []CC) []Cue {
+	var cues []Cue
+	for _, cc := range ccs {
+		if cc.Type != CCField1 {
+			continue
+		}
+		cues = d.decode(at, cc.Data[0]&0x7f, cc.Data[1]&0x7f, cues)
+	}
+
+	return cues
+}
+
+// Flush ends the cue shown at at.
+func (d *Decoder) Flush(at time.Duration) []Cue {
+	var cues []Cue
+	if d.shown != "" && at > d.since {
+		cues = append(cues, Cue{Start: d.since, End: at, Text: d.shown})
+	}
+	d.shown, d.since = "", at
+
+	return cues
+}
+
+func (d *Decoder) decode(at time.Duration, c1, c2 byte, cues []Cue) []Cue {
+	if c1 == 0 && c2 == 0 {
+		return cues
+	}
+
+	if c1 < 0x10 || c1 > 0x1f {
+		d.lastCtrl = [2]byte{}
+		if d.channel != 0 || d.textMode {
+			return cues
+		}
+
+		for _, c := range [2]byte{c1, c2} {
+			if c >= 0x20 {
+				d.put(basicChar(c))
+			}
+		}
+		return d.drawn(at, cues)
+	}
+
+	// control codes are sent twice in a row
+	if d.lastCtrl == [2]byte{c1, c2} {
+		d.lastCtrl = [2]byte{}
+		return cues
+	}
+	d.lastCtrl = [2]byte{c1, c2}
+
+	d.channel = int(c1>>3) & 0x01
+	if d.channel != 0 {
+		return cues
+	}
+
+	switch c := c1 & 0xf7; {
+	case c2 >= 0x40:
+		d.preamble(c, c2)
+	case c == 0x14 && c2 >= 0x20 && c2 <= 0x2f:
+		return d.command(at, c2, cues)
+	case c == 0x17 && c2 >= 0x21 && c2 <= 0x23:
+		d.col += int(c2 - 0x20)
+		if d.col >= columns {
+			d.col = columns - 1
+		}
+	case d.textMode:
+	case c == 0x11 && c2 >= 0x20 && c2 <= 0x2f:
+		// a mid-row code shows as a space
+		d.put(' ')
+		return d.drawn(at, cues)
+	case c == 0x11 && c2 >= 0x30 && c2 <= 0x3f:
+		d.put(specialChars[c2-0x30])
+		return d.drawn(at, cues)
+	case (c == 0x12 || c == 0x13) && c2 >= 0x20 && c2 <= 0x3f:
+		// an extended character replaces the basic one sent before it
+		if d.col > 0 {
+			d.col--
+		}
+		d.put(extendedChars[c-0x12][c2-0x20])
+		return d.drawn(at, cues)
+	}
+
+	return cues
+}
+
+func (d *Decoder) command(at time.Duration, c2 byte, cues []Cue) []Cue {
+	switch c2 {
+	case 0x20:
+		// resume caption loading
+		d.mode, d.textMode = modePopOn, false
+	case 0x25, 0x26, 0x27:
+		if d.mode != modeRollUp {
+			d.displayed, d.nonDisplayed = memory{}, memory{}
+			d.row = rows - 1
+		}
+		d.mode, d.rollUp, d.col, d.textMode = modeRollUp, int(c2-0x23), 0, false
+		return d.update(at, cues)
+	case 0x29:
+		// resume direct captioning
+		d.mode, d.textMode = modePaintOn, false
+	case 0x2a, 0x2b:
+		// text restart and resume text display, not captions
+		d.textMode = true
+	case 0x21:
+		if d.col > 0 {
+			d.col--
+			d.memory()[d.row][d.col] = 0
+		}
+		return d.drawn(at, cues)
+	case 0x24:
+		m := d.memory()
+		for i := d.col; i < columns; i++ {
+			m[d.row][i] = 0
+		}
+		return d.drawn(at, cues)
+	case 0x2c:
+		d.displayed = memory{}
+		return d.update(at, cues)
+	case 0x2d:
+		if d.mode == modeRollUp {
+			d.carriageReturn()
+			return d.update(at, cues)
+		}
+		if d.row < rows-1 {
+			d.row++
+		}
+		d.col = 0
+	case 0x2e:
+		d.nonDisplayed = memory{}
+	case 0x2f:
+		d.displayed, d.nonDisplayed = d.nonDisplayed, d.displayed
+		return d.update(at, cues)
+	}
+
+	return cues
+}
+
+// preamble moves the cursor to the row and indent of a preamble address code.
+func (d *Decoder) preamble(c1, c2 byte) {
+	row := preambleRows[int(c1&0x07)<<1|int(c2&0x20)>>5] - 1
+	if d.mode == modeRollUp && row != d.row {
+		// the window of the roll-up rows moves with its base row
+		d.displayed[row] = d.displayed[d.row]
+		d.displayed[d.row] = [columns]rune{}
+	}
+
+	d.row, d.col = row, 0
+	if c2&0x10 != 0 {
+		d.col = int(c2&0x0e) << 1
+	}
+}
+
+func (d *Decoder) carriageReturn() {
+	top := d.row - d.rollUp + 1
+	if top < 0 {
+		top = 0
+	}
+
+	for r := 0; r < d.row; r++ {
+		if r < top {
+			d.displayed[r] = [columns]rune{}
+		} else {
+			d.displayed[r] = d.displayed[r+1]
+		}
+	}
+	d.displayed[d.row] = [columns]rune{}
+	d.col = 0
+}
+
+func (d *Decoder) memory() *memory {
+	if d.mode == modePopOn {
+		return &d.nonDisplayed
+	}
+
+	return &d.displayed
+}
+
+func (d *Decoder) put(r rune) {
+	d.memory()[d.row][d.col] = r
+	if d.col < columns-1 {
+		d.col++
+	}
+}
+
+// drawn updates the cue after characters were drawn, those of roll-up
+// captions are shown with their line.
+func (d *Decoder) drawn(at time.Duration, cues []Cue) []Cue {
+	if d.mode != modePaintOn {
+		return cues
+	}
+
+	return d.update(at, cues)
+}
+
+// update ends the cue shown when the displayed memory changed.
+func (d *Decoder) update(at time.Duration, cues []Cue) []Cue {
+	text := d.displayed.text()
+	if text == d.shown {
+		return cues
+	}
+
+	if d.shown != "" && at > d.since {
+		cues = append(cues, Cue{Start: d.since, End: at, Text: d.shown})
+	}
+	d.shown, d.since = text, at
+
+	return cues
+}
+
+func (m *memory) text() string {
+	var lines []string
+	for _, row := range m {
+		line := strings.TrimSpace(strings.Map(func(r rune) rune {
+			if r == 0 {
+				return ' '
+			}
+			return r
+		}, string(row[:])))
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// the rows of the preamble codes by the low bits of the first byte and bit
+// 5 of the second
+var preambleRows = [16]int{11, 11, 1, 2, 3, 4, 12, 13, 14, 15, 5, 6, 7, 8, 9, 10}
+
+func basicChar(b byte) rune {
+	switch b {
+	case 0x2a:
+		return 'á'
+	case 0x5c:
+		return 'é'
+	case 0x5e:
+		return 'í'
+	case 0x5f:
+		return 'ó'
+	case 0x60:
+		return 'ú'
+	case 0x7b:
+		return 'ç'
+	case 0x7c:
+		return '÷'
+	case 0x7d:
+		return 'Ñ'
+	case 0x7e:
+		return 'ñ'
+	case 0x7f:
+		return '█'
+	}
+
+	return rune(b)
+}
+
+var specialChars = [16]rune{'®', '°', '½', '¿', '™', '¢', '£', '♪', 'à', ' ', 'è', 'â', 'ê', 'î', 'ô', 'û'}
+
+var extendedChars = [2][32]rune{
+	{
+		'Á', 'É', 'Ó', 'Ú', 'Ü', 'ü', '‘', '¡', '*', '’', '—', '©', '℠', '•', '“', '”',
+		'À', 'Â', 'Ç', 'È', 'Ê', 'Ë', 'ë', 'Î', 'Ï', 'ï', 'Ô', 'Ù', 'ù', 'Û', '«', '»',
+	},
+	{
+		'Ã', 'ã', 'Í', 'Ì', 'ì', 'Ò', 'ò', 'Õ', 'õ', '{', '}', '\\', '^', '_', '|', '~',
+		'Ä', 'ä', 'Ö', 'ö', 'ß', '¥', '¤', '¦', 'Å', 'å', 'Ø', 'ø', '┌', '┐', '└', '┘',
+	},
+}
@@ -0,0 +1,52 @@
+package caption
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// WebVTTWriter writes cues as webvtt, the header before the first.
+type WebVTTWriter struct {
+	w      io.Writer
+	header bool
+	cues   int
+}
+
+func NewWebVTTWriter(w io.Writer) *WebVTTWriter {
+	return &WebVTTWriter{w: w}
+}
+
+func (vw *WebVTTWriter) WriteCue(c Cue) error {
+	if !vw.header {
+		if _, err := io.WriteString(vw.w, "WEBVTT\n"); err != nil {
+			return err
+		}
+		vw.header = true
+	}
+
+	_, err := fmt.Fprintf(vw.w, "\n%s --> %s\n%s\n", Timestamp(c.Start), Timestamp(c.End), textEscaper.Replace(c.Text))
+	if err == nil {
+		vw.cues++
+	}
+
+	return err
+}
+
+// Cues is how many cues were written.
+func (vw *WebVTTWriter) Cues() int {
+	return vw.cues
+}
+
+// Timestamp formats d as a webvtt timestamp, hh:mm:ss.ttt.
+func Timestamp(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,315 @@
+// Package capture records what happens to one stream or session while it is
+// debugged, e.g. the rtsp messages of a camera, its state changes and stats,
+// in a ring of the last entries. Nothing is recorded while no capture runs.
+package capture
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogf/gf/util/guid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSize     = 500
+	maxSize         = 10000
+	defaultDuration = 10 * time.Minute
+	maxDuration     = 24 * time.Hour
+	// stopped captures are kept this long to be retrieved
+	keepStopped = time.Hour
+)
+
+// Entry kinds.
+const (
+	KindRTSP      = "rtsp"
+	KindSignaling = "signaling"
+	KindState     = "state"
+	KindStats     = "stats"
+)
+
+// Target is what a capture records, empty fields match anything: a session
+// by its id, a stream by its path, of any namespace without Namespace.
+type Target struct {
+	Namespace string `json:"namespace,omitempty"`
+	Stream    string `json:"stream,omitempty"`
+	Session   string `json:"session,omitempty"`
+}
+
+// Match tells whether t covers e.
+func (t Target) Match(e Target) bool {
+	return (t.Namespace == "" || t.Namespace == e.Namespace) &&
+		(t.Stream == "" || t.Stream == e.Stream) &&
+		(t.Session == "" || t.Session == e.Session)
+}
+
+type Options struct {
+	// Size is the number of entries kept, 500 when zero.
+	Size int `json:"size"`
+	// DurationSeconds stops the capture, 10 minutes when zero.
+	DurationSeconds int `json:"durationSeconds"`
+	// Log writes the entries to the log too, at info level, so one stream is
+	// logged verbosely without raising the global level.
+	Log bool `json:"log"`
+}
+
+type Entry struct {
+	Time    time.Time              `json:"time"`
+	Kind    string                 `json:"kind"`
+	Session string                 `json:"session,omitempty"`
+	Message string                 `json:"message"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+// Bundle is a capture as retrieved, entries oldest first.
+type Bundle struct {
+	ID        string    `json:"id"`
+	Target    Target    `json:"target"`
+	StartedAt time.Time `json:"startedAt"`
+	Until     time.Time `json:"until"`
+	Running   bool      `json:"running"`
+	// Recorded counts all entries, those beyond Size were overwritten.
+	Recorded uint64  `json:"recorded"`
+	Entries  []Entry `json:"entries,omitempty"`
+}
+
+type Capture struct {
+	id        string
+	target    Target
+	opts      Options
+	startedAt time.Time
+	until     time.Time
+	ctx       context.Context
+	cancel    context.CancelFunc
+	logger    *logrus.Entry
+
+	lock     sync.Mutex
+	entries  []Entry
+	next     int
+	recorded uint64
+}
+
+var (
+	captures = make(map[string]*Capture)
+	lock     sync.RWMutex
+	// running counts the captures, the hot paths check it first
+	running int32
+)
+
+// Start captures target until the duration of opts passed or Stop.
+func Start(target Target, opts Options) *Capture {
+	if opts.Size <= 0 {
+		opts.Size = defaultSize
+	} else if opts.Size > maxSize {
+		opts.Size = maxSize
+	}
+
+	duration := time.Duration(opts.DurationSeconds) * time.Second
+	if duration <= 0 {
+		duration = defaultDuration
+	} else if duration > maxDuration {
+		duration = maxDuration
+	}
+
+	now := time.Now()
+	c := &Capture{
+		id:        guid.S(),
+		target:    target,
+		opts:      opts,
+		startedAt: now,
+		until:     now.Add(duration),
+		entries:   make([]Entry, 0, opts.Size),
+	}
+	c.ctx, c.cancel = context.WithTimeout(context.Background(), duration)
+	c.logger = logrus.WithFields(logrus.Fields{
+		"obj":       "capture",
+		"capture":   c.id,
+		"namespace": target.Namespace,
+		"stream":    target.Stream,
+		"session":   target.Session,
+	})
+
+	lock.Lock()
+	for id, old := range captures {
+		if old.stopped() && now.Sub(old.until) > keepStopped {
+			delete(captures, id)
+		}
+	}
+	captures[c.id] = c
+	lock.Unlock()
+	atomic.AddInt32(&running, 1)
+
+	go func() {
+		<-c.ctx.Done()
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		// stopped early
+		if now := time.Now(); now.Before(c.until) {
+			c.until = now
+		}
+		atomic.AddInt32(&running, -1)
+	}()
+
+	return c
+}
+
+// Get returns a capture, running or stopped, until it is removed.
+func Get(id string) (*Capture, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	c, ok := captures[id]
+	return c, ok
+}
+
+// List returns the captures, the latest first.
+func List() []*Capture {
+	lock.RLock()
+	list := make([]*Capture, 0, len(captures))
+	for _, c := range captures {
+		list = append(list, c)
+	}
+	lock.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].startedAt.After(list[j].startedAt)
+	})
+
+	return list
+}
+
+// Remove stops a capture and drops its entries.
+func Remove(id string) bool {
+	lock.Lock()
+	c, ok := captures[id]
+	delete(captures, id)
+	lock.Unlock()
+
+	if ok {
+		c.Stop()
+	}
+
+	return ok
+}
+
+// Record adds an entry to the captures of target. It returns at once while
+// none runs, data is only built by callers checking Enabled first.
+func Record(target Target, kind, message string, data map[string]interface{}) {
+	if atomic.LoadInt32(&running) == 0 {
+		return
+	}
+
+	lock.RLock()
+	var matched []*Capture
+	for _, c := range captures {
+		if c.target.Match(target) && !c.stopped() {
+			matched = append(matched, c)
+		}
+	}
+	lock.RUnlock()
+
+	for _, c := range matched {
+		c.Add(Entry{Time: time.Now(), Kind: kind, Session: target.Session, Message: message, Data: data})
+	}
+}
+
+// Enabled tells whether a capture may record target, to skip building costly
+// entries.
+func Enabled(target Target) bool {
+	if atomic.LoadInt32(&running) == 0 {
+		return false
+	}
+
+	lock.RLock()
+	defer lock.RUnlock()
+
+	for _, c := range captures {
+		if c.target.Match(target) && !c.stopped() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Capture) ID() string {
+	return c.id
+}
+
+func (c *Capture) Target() Target {
+	return c.target
+}
+
+// Done is closed once the capture stopped.
+func (c *Capture) Done() <-chan struct{} {
+	return c.ctx.Done()
+}
+
+func (c *Capture) Stop() {
+	c.cancel()
+}
+
+func (c *Capture) stopped() bool {
+	return c.ctx.Err() != nil
+}
+
+// Add records e, overwriting the oldest entry once the ring is full.
+func (c *Capture) Add(e Entry) {
+	if c.stopped() {
+		return
+	}
+
+	if c.opts.Log {
+		c.logger.WithField("kind", e.Kind).WithField("data", e.Data).Info(e.Message)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.recorded++
+	if len(c.entries) < c.opts.Size {
+		c.entries = append(c.entries, e)
+		return
+	}
+
+	c.entries[c.next] = e
+	c.next = (c.next + 1) % c.opts.Size
+}
+
+// Bundle returns the capture with its entries.
+func (c *Capture) Bundle() Bundle {
+	b := c.Info()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	b.Entries = make([]Entry, 0, len(c.entries))
+	b.Entries = append(b.Entries, c.entries[c.next:]...)
+	b.Entries = append(b.Entries, c.entries[:c.next]...)
+
+	return b
+}
+
+// Info returns the capture without its entries.
+func (c *Capture) Info() Bundle {
+	lock.RLock()
+	until := c.until
+	lock.RUnlock()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return Bundle{
+		ID:        c.id,
+		Target:    c.target,
+		StartedAt: c.startedAt,
+		Until:     until,
+		Running:   !c.stopped(),
+		Recorded:  c.recorded,
+	}
+}
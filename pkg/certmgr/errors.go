@@ -0,0 +1,8 @@
+package certmgr
+
+import "errors"
+
+var (
+	ErrNoCertificate = errors.New("no certificate")
+	ErrEmptyKeyPair  = errors.New("cert and key can't be empty")
+)
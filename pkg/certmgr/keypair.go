@@ -0,0 +1,111 @@
+package certmgr
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyPair is a certificate loaded from files, it is reloaded when either file
+// changes on disk, e.g. after an external renewal.
+type KeyPair struct {
+	certFile string
+	keyFile  string
+	lock     sync.RWMutex
+	cert     *tls.Certificate
+	modTime  time.Time
+}
+
+func LoadKeyPair(certFile, keyFile string) (*KeyPair, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, ErrEmptyKeyPair
+	}
+
+	kp := &KeyPair{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if _, err := kp.Reload(); err != nil {
+		return nil, err
+	}
+
+	return kp, nil
+}
+
+func (kp *KeyPair) lastModified() (time.Time, error) {
+	var last time.Time
+	for _, file := range []string{kp.certFile, kp.keyFile} {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return last, err
+		}
+
+		if fi.ModTime().After(last) {
+			last = fi.ModTime()
+		}
+	}
+
+	return last, nil
+}
+
+// Reload loads the files again if they changed, it reports whether the
+// certificate was replaced.
+func (kp *KeyPair) Reload() (bool, error) {
+	modTime, err := kp.lastModified()
+	if err != nil {
+		return false, err
+	}
+
+	kp.lock.RLock()
+	unchanged := kp.cert != nil && modTime.Equal(kp.modTime)
+	kp.lock.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(kp.certFile, kp.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	if cert.Leaf == nil && len(cert.Certificate) > 0 {
+		cert.Leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	}
+
+	kp.lock.Lock()
+	defer kp.lock.Unlock()
+
+	kp.cert = &cert
+	kp.modTime = modTime
+
+	return true, nil
+}
+
+func (kp *KeyPair) Certificate() *tls.Certificate {
+	kp.lock.RLock()
+	defer kp.lock.RUnlock()
+
+	return kp.cert
+}
+
+// Matches reports whether the certificate is valid for serverName.
+func (kp *KeyPair) Matches(serverName string) bool {
+	cert := kp.Certificate()
+	if cert == nil || cert.Leaf == nil {
+		return false
+	}
+
+	return cert.Leaf.VerifyHostname(strings.TrimSuffix(serverName, ".")) == nil
+}
+
+func (kp *KeyPair) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if cert := kp.Certificate(); cert != nil {
+		return cert, nil
+	}
+
+	return nil, ErrNoCertificate
+}
@@ -0,0 +1,222 @@
+package certmgr
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	defaultReloadInterval = time.Minute
+	defaultACMECacheDir   = "certs/acme"
+)
+
+type CertSettings struct {
+	Cert string `json:"cert" mapstructure:"cert"`
+	Key  string `json:"key" mapstructure:"key"`
+}
+
+type ACMESettings struct {
+	Enable bool     `json:"enable" mapstructure:"enable"`
+	Email  string   `json:"email" mapstructure:"email"`
+	Hosts  []string `json:"hosts" mapstructure:"hosts"`
+	// CacheDir keeps issued certificates and the account key across restarts.
+	CacheDir     string `json:"cacheDir" mapstructure:"cacheDir"`
+	DirectoryURL string `json:"directoryURL" mapstructure:"directoryURL"`
+}
+
+type Settings struct {
+	Certs                 []CertSettings `json:"certs" mapstructure:"certs"`
+	ReloadIntervalSeconds int            `json:"reloadIntervalSeconds" mapstructure:"reloadIntervalSeconds"`
+	ACME                  ACMESettings   `json:"acme" mapstructure:"acme"`
+}
+
+// Manager serves certificates for every TLS listener. Static certificates
+// are picked by SNI, the first one is the fallback, ACME is used for hosts
+// none of them covers.
+type Manager struct {
+	settings Settings
+	lock     sync.RWMutex
+	pairs    []*KeyPair
+	acme     *autocert.Manager
+	logger   *logrus.Entry
+}
+
+func NewManager(settings Settings, logger *logrus.Entry) (*Manager, error) {
+	if logger == nil {
+		logger = logrus.WithField("obj", "certmgr")
+	}
+
+	m := &Manager{
+		settings: settings,
+		logger:   logger,
+	}
+
+	for _, cs := range settings.Certs {
+		kp, err := LoadKeyPair(cs.Cert, cs.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		m.pairs = append(m.pairs, kp)
+	}
+
+	if settings.ACME.Enable {
+		cacheDir := settings.ACME.CacheDir
+		if cacheDir == "" {
+			cacheDir = defaultACMECacheDir
+		}
+
+		m.acme = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(cacheDir),
+			HostPolicy: autocert.HostWhitelist(settings.ACME.Hosts...),
+			Email:      settings.ACME.Email,
+		}
+
+		if settings.ACME.DirectoryURL != "" {
+			m.acme.Client = &acme.Client{DirectoryURL: settings.ACME.DirectoryURL}
+		}
+	}
+
+	return m, nil
+}
+
+// Enabled reports whether the manager can serve any certificate.
+func (m *Manager) Enabled() bool {
+	if m == nil {
+		return false
+	}
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return len(m.pairs) > 0 || m.acme != nil
+}
+
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.lock.RLock()
+	pairs := m.pairs
+	m.lock.RUnlock()
+
+	if hello.ServerName != "" {
+		for _, kp := range pairs {
+			if kp.Matches(hello.ServerName) {
+				return kp.Certificate(), nil
+			}
+		}
+	}
+
+	if m.acme != nil && hello.ServerName != "" {
+		cert, err := m.acme.GetCertificate(hello)
+		if err == nil || len(pairs) == 0 {
+			return cert, err
+		}
+
+		m.logger.WithError(err).WithField("serverName", hello.ServerName).Warn("acme certificate unavailable")
+	}
+
+	if len(pairs) > 0 {
+		return pairs[0].GetCertificate(hello)
+	}
+
+	return nil, ErrNoCertificate
+}
+
+// TLSConfig returns a config for RTSPS, HTTPS and WSS listeners, certificate
+// renewals are picked up without restarting them.
+func (m *Manager) TLSConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: m.GetCertificate,
+	}
+
+	if m.acme != nil {
+		cfg.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+	}
+
+	return cfg
+}
+
+// HTTPHandler answers ACME HTTP-01 challenges and passes everything else to
+// fallback, it must wrap a handler served on port 80.
+func (m *Manager) HTTPHandler(fallback http.Handler) http.Handler {
+	if m == nil || m.acme == nil {
+		return fallback
+	}
+
+	acmeHandler := m.acme.HTTPHandler(fallback)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/.well-known/acme-challenge/") {
+			acmeHandler.ServeHTTP(w, r)
+			return
+		}
+
+		fallback.ServeHTTP(w, r)
+	})
+}
+
+// Watch reloads certificate files that changed on disk until ctx is done.
+func (m *Manager) Watch(ctx context.Context) {
+	interval := time.Duration(m.settings.ReloadIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.reload()
+		}
+	}
+}
+
+func (m *Manager) reload() {
+	m.lock.RLock()
+	pairs := m.pairs
+	m.lock.RUnlock()
+
+	for _, kp := range pairs {
+		reloaded, err := kp.Reload()
+		if err != nil {
+			m.logger.WithError(err).WithField("cert", kp.certFile).Error("failed to reload certificate")
+			continue
+		}
+
+		if reloaded {
+			m.logger.WithField("cert", kp.certFile).Info("certificate reloaded")
+		}
+	}
+}
+
+var (
+	defaultManager *Manager
+	defaultLock    sync.RWMutex
+)
+
+func SetDefault(m *Manager) {
+	defaultLock.Lock()
+	defer defaultLock.Unlock()
+
+	defaultManager = m
+}
+
+func Default() *Manager {
+	defaultLock.RLock()
+	defer defaultLock.RUnlock()
+
+	return defaultManager
+}
@@ -0,0 +1,114 @@
+// Package clock is the time of the media pipeline. Timers, jitter buffers
+// and segmenters read it from a Clock, the wall clock unless a Virtual one is
+// set, which only moves when told to so timing runs without real sleeps.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and makes timers on it.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	Until(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) *Timer
+	NewTicker(d time.Duration) *Ticker
+	// AfterFunc calls f once d elapsed, in its own goroutine on the wall
+	// clock and in the one moving a virtual clock.
+	AfterFunc(d time.Duration, f func()) *Timer
+	Sleep(d time.Duration)
+}
+
+// Timer is a time.Timer of a clock.
+type Timer struct {
+	C     <-chan time.Time
+	stop  func() bool
+	reset func(d time.Duration) bool
+}
+
+// Stop prevents the timer from firing, false when it fired or was stopped.
+func (t *Timer) Stop() bool {
+	return t.stop()
+}
+
+// Reset fires the timer after d, false when it fired or was stopped.
+func (t *Timer) Reset(d time.Duration) bool {
+	return t.reset(d)
+}
+
+// Ticker is a time.Ticker of a clock.
+type Ticker struct {
+	C     <-chan time.Time
+	stop  func()
+	reset func(d time.Duration)
+}
+
+func (t *Ticker) Stop() {
+	t.stop()
+}
+
+func (t *Ticker) Reset(d time.Duration) {
+	t.reset(d)
+}
+
+// Real is the wall clock.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) Until(t time.Time) time.Duration        { return time.Until(t) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+
+func (realClock) NewTimer(d time.Duration) *Timer {
+	t := time.NewTimer(d)
+	return &Timer{C: t.C, stop: t.Stop, reset: t.Reset}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) *Timer {
+	t := time.AfterFunc(d, f)
+	return &Timer{stop: t.Stop, reset: t.Reset}
+}
+
+func (realClock) NewTicker(d time.Duration) *Ticker {
+	t := time.NewTicker(d)
+	return &Ticker{C: t.C, stop: t.Stop, reset: t.Reset}
+}
+
+var (
+	defaultClock Clock = Real
+	defaultLock  sync.RWMutex
+)
+
+// SetDefault sets the clock of what is not given one, a Virtual clock runs
+// the whole pipeline in simulation.
+func SetDefault(c Clock) {
+	defaultLock.Lock()
+	defer defaultLock.Unlock()
+
+	if c == nil {
+		c = Real
+	}
+	defaultClock = c
+}
+
+func Default() Clock {
+	defaultLock.RLock()
+	defer defaultLock.RUnlock()
+
+	return defaultClock
+}
+
+// Or is c, the default clock when nil.
+func Or(c Clock) Clock {
+	if c == nil {
+		return Default()
+	}
+
+	return c
+}
@@ -0,0 +1,244 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Virtual is a clock moved by Add, Set and Next. The timers due fire in the
+// order of their deadlines, those of one deadline in the order they were set,
+// the clock reading the deadline of each as it fires.
+type Virtual struct {
+	lock    sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	seq     uint64
+	waiters map[*waiter]struct{}
+}
+
+type waiter struct {
+	at  time.Time
+	seq uint64
+	// period of a ticker
+	period time.Duration
+	c      chan time.Time
+	f      func()
+}
+
+func NewVirtual(start time.Time) *Virtual {
+	v := &Virtual{
+		now:     start,
+		waiters: make(map[*waiter]struct{}),
+	}
+	v.cond = sync.NewCond(&v.lock)
+
+	return v
+}
+
+func (v *Virtual) Now() time.Time {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	return v.now
+}
+
+func (v *Virtual) Since(t time.Time) time.Duration {
+	return v.Now().Sub(t)
+}
+
+func (v *Virtual) Until(t time.Time) time.Duration {
+	return t.Sub(v.Now())
+}
+
+func (v *Virtual) After(d time.Duration) <-chan time.Time {
+	return v.NewTimer(d).C
+}
+
+func (v *Virtual) Sleep(d time.Duration) {
+	<-v.After(d)
+}
+
+func (v *Virtual) NewTimer(d time.Duration) *Timer {
+	w := &waiter{c: make(chan time.Time, 1)}
+	v.schedule(w, d)
+
+	return &Timer{
+		C:     w.c,
+		stop:  func() bool { return v.unschedule(w) },
+		reset: func(d time.Duration) bool { return v.schedule(w, d) },
+	}
+}
+
+func (v *Virtual) AfterFunc(d time.Duration, f func()) *Timer {
+	w := &waiter{f: f}
+	v.schedule(w, d)
+
+	return &Timer{
+		stop:  func() bool { return v.unschedule(w) },
+		reset: func(d time.Duration) bool { return v.schedule(w, d) },
+	}
+}
+
+func (v *Virtual) NewTicker(d time.Duration) *Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+
+	w := &waiter{c: make(chan time.Time, 1), period: d}
+	v.schedule(w, d)
+
+	return &Ticker{
+		C:    w.c,
+		stop: func() { v.unschedule(w) },
+		reset: func(d time.Duration) {
+			v.lock.Lock()
+			w.period = d
+			v.lock.Unlock()
+			v.schedule(w, d)
+		},
+	}
+}
+
+// schedule sets w to fire after d, it tells whether w was waiting.
+func (v *Virtual) schedule(w *waiter, d time.Duration) bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	_, waiting := v.waiters[w]
+	v.seq++
+	w.at, w.seq = v.now.Add(d), v.seq
+	v.waiters[w] = struct{}{}
+	v.cond.Broadcast()
+
+	return waiting
+}
+
+func (v *Virtual) unschedule(w *waiter) bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	_, waiting := v.waiters[w]
+	delete(v.waiters, w)
+	v.cond.Broadcast()
+
+	return waiting
+}
+
+// next is the first waiter due by until, nil with none.
+func (v *Virtual) next(until time.Time) *waiter {
+	var first *waiter
+	for w := range v.waiters {
+		if w.at.After(until) {
+			continue
+		}
+		if first == nil || w.at.Before(first.at) || (w.at.Equal(first.at) && w.seq < first.seq) {
+			first = w
+		}
+	}
+
+	return first
+}
+
+// fire moves the clock to the deadline of w and fires it, outside the lock.
+func (v *Virtual) fire(w *waiter) {
+	if w.at.After(v.now) {
+		v.now = w.at
+	}
+	at := v.now
+
+	if w.period > 0 {
+		v.seq++
+		w.at, w.seq = w.at.Add(w.period), v.seq
+	} else {
+		delete(v.waiters, w)
+	}
+	v.cond.Broadcast()
+
+	v.lock.Unlock()
+	defer v.lock.Lock()
+
+	if w.f != nil {
+		w.f()
+		return
+	}
+
+	// like those of time, a tick not read is dropped
+	select {
+	case w.c <- at:
+	default:
+	}
+}
+
+// Add moves the clock by d, firing the timers due on the way.
+func (v *Virtual) Add(d time.Duration) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	until := v.now.Add(d)
+	for w := v.next(until); w != nil; w = v.next(until) {
+		v.fire(w)
+	}
+
+	if until.After(v.now) {
+		v.now = until
+	}
+}
+
+// Set moves the clock to t, firing the timers due on the way. A t before
+// the time of the clock sets it back without firing anything.
+func (v *Virtual) Set(t time.Time) {
+	v.lock.Lock()
+	if !t.After(v.now) {
+		v.now = t
+		v.lock.Unlock()
+		return
+	}
+	v.lock.Unlock()
+
+	v.Add(t.Sub(v.Now()))
+}
+
+// Next moves the clock to the first deadline and fires the timers due then,
+// it returns how far the clock moved, false without timers.
+func (v *Virtual) Next() (time.Duration, bool) {
+	v.lock.Lock()
+	var first *waiter
+	for w := range v.waiters {
+		if first == nil || w.at.Before(first.at) {
+			first = w
+		}
+	}
+	if first == nil {
+		v.lock.Unlock()
+		return 0, false
+	}
+
+	d := first.at.Sub(v.now)
+	if d < 0 {
+		d = 0
+	}
+	v.lock.Unlock()
+
+	v.Add(d)
+
+	return d, true
+}
+
+// Waiters are the timers, tickers and sleeps waiting on the clock.
+func (v *Virtual) Waiters() int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	return len(v.waiters)
+}
+
+// BlockUntil waits for n timers, tickers or sleeps waiting on the clock,
+// e.g. for a goroutine to set its next timer before the clock is moved.
+func (v *Virtual) BlockUntil(n int) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	for len(v.waiters) < n {
+		v.cond.Wait()
+	}
+}
@@ -0,0 +1,54 @@
+package codec
+
+import "github.com/pingostack/neon/pkg/deliver"
+
+// AUSplitter cuts an annex b byte stream into access units at their access
+// unit delimiters, what comes before the first is dropped.
+type AUSplitter struct {
+	buf     []byte
+	from    int
+	started bool
+}
+
+// Write adds b to the stream, emit is called with every access unit
+// complete.
+func (s *AUSplitter) Write(b []byte, emit func(au []byte)) {
+	s.buf = append(s.buf, b...)
+
+	for {
+		next := s.nextAUD()
+		if next < 0 {
+			return
+		}
+
+		if s.started && next > 0 {
+			emit(append([]byte(nil), s.buf[:next]...))
+		}
+		s.started = true
+
+		s.buf = append(s.buf[:0], s.buf[next:]...)
+		// past the start code of the delimiter found
+		s.from = 4
+	}
+}
+
+// nextAUD returns where the start code of the next delimiter is, -1 when there
+// is none yet.
+func (s *AUSplitter) nextAUD() int {
+	i := s.from
+	for ; i+3 < len(s.buf); i++ {
+		if s.buf[i] != 0 || s.buf[i+1] != 0 || s.buf[i+2] != 1 {
+			continue
+		}
+
+		if NALUType(deliver.CodecTypeH264, s.buf[i+3:]) == H264NALUTypeAUD {
+			if i > 0 && s.buf[i-1] == 0 {
+				return i - 1
+			}
+			return i
+		}
+	}
+
+	s.from = i
+	return -1
+}
@@ -0,0 +1,235 @@
+// Package codec inspects h264 and h265 bitstreams: their framings, nal units,
+// parameter sets and keyframes.
+package codec
+
+import (
+	"errors"
+
+	"github.com/pingostack/neon/pkg/deliver"
+)
+
+var (
+	ErrInvalidSPS  = errors.New("invalid sps")
+	ErrInvalidAVCC = errors.New("invalid avcc")
+	ErrUnsupported = errors.New("codec not supported")
+)
+
+const (
+	H264NALUTypeIDR   = 5
+	H264NALUTypeSEI   = 6
+	H264NALUTypeSPS   = 7
+	H264NALUTypePPS   = 8
+	H264NALUTypeAUD   = 9
+	H264NALUTypeSTAPA = 24
+	H264NALUTypeFUA   = 28
+
+	H265NALUTypeBLAWLP   = 16
+	H265NALUTypeIDRWRADL = 19
+	H265NALUTypeIDRNLP   = 20
+	H265NALUTypeCRA      = 21
+	H265NALUTypeVPS      = 32
+	H265NALUTypeSPS      = 33
+	H265NALUTypePPS      = 34
+	H265NALUTypeAUD      = 35
+	H265NALUTypeAP       = 48
+	H265NALUTypeFU       = 49
+)
+
+// NALUType returns the type in the header of nalu, -1 for an empty unit or
+// another codec.
+func NALUType(codec deliver.CodecType, nalu []byte) int {
+	switch {
+	case len(nalu) == 0:
+		return -1
+	case codec == deliver.CodecTypeH264:
+		return int(nalu[0] & 0x1f)
+	case codec == deliver.CodecTypeH265:
+		return int(nalu[0]>>1) & 0x3f
+	}
+
+	return -1
+}
+
+// IsAnnexB tells whether data starts with a start code.
+func IsAnnexB(data []byte) bool {
+	return len(data) >= 3 && data[0] == 0 && data[1] == 0 &&
+		(data[2] == 1 || len(data) >= 4 && data[2] == 0 && data[3] == 1)
+}
+
+// SplitAnnexB returns the nal units of an annex b access unit, data without
+// start code is a single nal unit.
+func SplitAnnexB(data []byte) [][]byte {
+	var nalus [][]byte
+	ForEachAnnexB(data, func(nalu []byte) bool {
+		nalus = append(nalus, nalu)
+		return true
+	})
+
+	return nalus
+}
+
+// ForEachAnnexB calls f with the nal units of an annex b access unit until f
+// returns false, without allocating.
+func ForEachAnnexB(data []byte, f func(nalu []byte) bool) {
+	start := -1
+	for i := 0; i+2 < len(data); i++ {
+		if data[i] != 0 || data[i+1] != 0 || data[i+2] != 1 {
+			continue
+		}
+
+		if start >= 0 {
+			end := i
+			if end > start && data[end-1] == 0 {
+				end--
+			}
+			if !f(data[start:end]) {
+				return
+			}
+		}
+		start = i + 3
+		i += 2
+	}
+
+	if start >= 0 && start < len(data) {
+		f(data[start:])
+	} else if start < 0 && len(data) > 0 {
+		f(data)
+	}
+}
+
+// SplitAVCC returns the nal units of length prefixed data, lengths of size
+// bytes.
+func SplitAVCC(data []byte, size int) ([][]byte, error) {
+	if size < 1 || size > 4 {
+		return nil, ErrInvalidAVCC
+	}
+
+	var nalus [][]byte
+	for len(data) > 0 {
+		if len(data) < size {
+			return nil, ErrInvalidAVCC
+		}
+
+		n := 0
+		for _, b := range data[:size] {
+			n = n<<8 | int(b)
+		}
+		data = data[size:]
+		if n > len(data) {
+			return nil, ErrInvalidAVCC
+		}
+
+		nalus = append(nalus, data[:n])
+		data = data[n:]
+	}
+
+	return nalus, nil
+}
+
+// AnnexBToAVCC converts an access unit to 4 byte length prefixed nal units.
+func AnnexBToAVCC(data []byte) []byte {
+	out := make([]byte, 0, len(data)+16)
+	ForEachAnnexB(data, func(nalu []byte) bool {
+		if len(nalu) > 0 {
+			n := len(nalu)
+			out = append(out, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+			out = append(out, nalu...)
+		}
+		return true
+	})
+
+	return out
+}
+
+// AVCCToAnnexB converts 4 byte length prefixed nal units to an access unit
+// with start codes.
+func AVCCToAnnexB(data []byte) ([]byte, error) {
+	nalus, err := SplitAVCC(data, 4)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(data))
+	for _, nalu := range nalus {
+		out = append(out, 0, 0, 0, 1)
+		out = append(out, nalu...)
+	}
+
+	return out, nil
+}
+
+// SplitRTP returns the complete nal units of an rtp payload, a single unit
+// or those of an aggregation packet. Fragments are not reassembled.
+func SplitRTP(codec deliver.CodecType, payload []byte) [][]byte {
+	typ := NALUType(codec, payload)
+	pos := 0
+	switch {
+	case codec == deliver.CodecTypeH264 && typ == H264NALUTypeSTAPA:
+		pos = 1
+	case codec == deliver.CodecTypeH265 && typ == H265NALUTypeAP:
+		pos = 2
+	case codec == deliver.CodecTypeH264 && typ == H264NALUTypeFUA,
+		codec == deliver.CodecTypeH265 && typ == H265NALUTypeFU,
+		typ < 0:
+		return nil
+	default:
+		return [][]byte{payload}
+	}
+
+	var nalus [][]byte
+	for pos+2 <= len(payload) {
+		n := int(payload[pos])<<8 | int(payload[pos+1])
+		pos += 2
+		if n == 0 || pos+n > len(payload) {
+			break
+		}
+		nalus = append(nalus, payload[pos:pos+n])
+		pos += n
+	}
+
+	return nalus
+}
+
+// IsKeyframe tells whether the annex b access unit au of codec starts a
+// group of pictures, an idr picture of h264 or an irap picture of h265.
+func IsKeyframe(codec deliver.CodecType, au []byte) bool {
+	keyframe := false
+	ForEachAnnexB(au, func(nalu []byte) bool {
+		keyframe = IsKeyframeNALU(codec, nalu)
+		return !keyframe
+	})
+
+	return keyframe
+}
+
+// IsKeyframeNALU tells whether nalu is a slice of a keyframe, see IsKeyframe.
+func IsKeyframeNALU(codec deliver.CodecType, nalu []byte) bool {
+	typ := NALUType(codec, nalu)
+	switch codec {
+	case deliver.CodecTypeH264:
+		return typ == H264NALUTypeIDR
+	case deliver.CodecTypeH265:
+		// bla, idr and cra, the reserved irap types up to 23 included
+		return typ >= H265NALUTypeBLAWLP && typ <= 23
+	}
+
+	return false
+}
+
+// FindSPS returns the last sps of the annex b access unit au, nil without.
+func FindSPS(codec deliver.CodecType, au []byte) []byte {
+	want := H264NALUTypeSPS
+	if codec == deliver.CodecTypeH265 {
+		want = H265NALUTypeSPS
+	}
+
+	var sps []byte
+	ForEachAnnexB(au, func(nalu []byte) bool {
+		if NALUType(codec, nalu) == want {
+			sps = nalu
+		}
+		return true
+	})
+
+	return sps
+}
@@ -0,0 +1,188 @@
+package codec
+
+import (
+	"errors"
+
+	"github.com/pingostack/neon/pkg/deliver"
+)
+
+var ErrInvalidSEI = errors.New("invalid sei")
+
+const (
+	H265NALUTypePrefixSEI = 39
+	H265NALUTypeSuffixSEI = 40
+
+	// the sei payload of user data identified by a uuid
+	seiPayloadUserDataUnregistered = 5
+)
+
+// UserData is a user_data_unregistered sei message, a payload identified by
+// the uuid of whoever defined it.
+type UserData struct {
+	UUID    [16]byte
+	Payload []byte
+}
+
+// IsSEI tells whether nalu is an sei of codec.
+func IsSEI(codec deliver.CodecType, nalu []byte) bool {
+	typ := NALUType(codec, nalu)
+	switch codec {
+	case deliver.CodecTypeH264:
+		return typ == H264NALUTypeSEI
+	case deliver.CodecTypeH265:
+		return typ == H265NALUTypePrefixSEI || typ == H265NALUTypeSuffixSEI
+	}
+
+	return false
+}
+
+// IsVCL tells whether nalu is a slice of a picture.
+func IsVCL(codec deliver.CodecType, nalu []byte) bool {
+	typ := NALUType(codec, nalu)
+	switch codec {
+	case deliver.CodecTypeH264:
+		return typ >= 1 && typ <= H264NALUTypeIDR
+	case deliver.CodecTypeH265:
+		return typ >= 0 && typ < H265NALUTypeVPS
+	}
+
+	return false
+}
+
+// NewUserDataSEI returns a prefix sei nal unit of codec carrying ud.
+func NewUserDataSEI(codec deliver.CodecType, ud UserData) ([]byte, error) {
+	var header []byte
+	switch codec {
+	case deliver.CodecTypeH264:
+		header = []byte{H264NALUTypeSEI}
+	case deliver.CodecTypeH265:
+		header = []byte{H265NALUTypePrefixSEI << 1, 1}
+	default:
+		return nil, ErrUnsupported
+	}
+
+	rbsp := make([]byte, 0, len(ud.Payload)+24)
+	rbsp = appendSEIValue(rbsp, seiPayloadUserDataUnregistered)
+	rbsp = appendSEIValue(rbsp, len(ud.UUID)+len(ud.Payload))
+	rbsp = append(rbsp, ud.UUID[:]...)
+	rbsp = append(rbsp, ud.Payload...)
+	// rbsp_trailing_bits
+	rbsp = append(rbsp, 0x80)
+
+	return append(header, escape(rbsp)...), nil
+}
+
+// ParseUserDataSEI returns the user data messages of the sei nalu, nil for
+// another unit.
+func ParseUserDataSEI(codec deliver.CodecType, nalu []byte) ([]UserData, error) {
+	var uds []UserData
+	err := ForEachSEIMessage(codec, nalu, func(typ int, body []byte) {
+		if typ != seiPayloadUserDataUnregistered || len(body) < 16 {
+			return
+		}
+
+		var ud UserData
+		copy(ud.UUID[:], body)
+		ud.Payload = append([]byte(nil), body[16:]...)
+		uds = append(uds, ud)
+	})
+
+	return uds, err
+}
+
+// ForEachSEIMessage calls f with the payload type and the unescaped body of
+// the messages of the sei nalu, not at all for another unit.
+func ForEachSEIMessage(codec deliver.CodecType, nalu []byte, f func(typ int, body []byte)) error {
+	if !IsSEI(codec, nalu) {
+		return nil
+	}
+
+	header := 1
+	if codec == deliver.CodecTypeH265 {
+		header = 2
+	}
+	if len(nalu) <= header {
+		return ErrInvalidSEI
+	}
+
+	rbsp := unescape(nalu[header:])
+	// messages follow each other until the trailing bits
+	for len(rbsp) > 1 || len(rbsp) == 1 && rbsp[0] != 0x80 {
+		typ, n := readSEIValue(rbsp)
+		if n == 0 {
+			return ErrInvalidSEI
+		}
+		rbsp = rbsp[n:]
+
+		size, n := readSEIValue(rbsp)
+		if n == 0 || size > len(rbsp)-n {
+			return ErrInvalidSEI
+		}
+		f(typ, rbsp[n:n+size])
+		rbsp = rbsp[n+size:]
+	}
+
+	return nil
+}
+
+// InsertNALU returns the annex b access unit au with nalu put in front of
+// its first slice, where an sei belongs.
+func InsertNALU(codec deliver.CodecType, au, nalu []byte) []byte {
+	out := make([]byte, 0, len(au)+len(nalu)+8)
+	inserted := false
+	ForEachAnnexB(au, func(n []byte) bool {
+		if !inserted && IsVCL(codec, n) {
+			out = append(append(out, 0, 0, 0, 1), nalu...)
+			inserted = true
+		}
+		out = append(append(out, 0, 0, 0, 1), n...)
+		return true
+	})
+
+	if !inserted {
+		out = append(append(out, 0, 0, 0, 1), nalu...)
+	}
+
+	return out
+}
+
+// appendSEIValue writes a payload type or size, 0xff for each 255 of it.
+func appendSEIValue(b []byte, v int) []byte {
+	for ; v >= 0xff; v -= 0xff {
+		b = append(b, 0xff)
+	}
+
+	return append(b, byte(v))
+}
+
+func readSEIValue(b []byte) (int, int) {
+	v := 0
+	for i, c := range b {
+		v += int(c)
+		if c != 0xff {
+			return v, i + 1
+		}
+	}
+
+	return 0, 0
+}
+
+// escape adds the emulation prevention bytes of a nal unit, see unescape.
+func escape(rbsp []byte) []byte {
+	out := make([]byte, 0, len(rbsp)+len(rbsp)/64+1)
+	zeros := 0
+	for _, b := range rbsp {
+		if zeros >= 2 && b <= 3 {
+			out = append(out, 3)
+			zeros = 0
+		}
+		out = append(out, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+
+	return out
+}
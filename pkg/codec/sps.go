@@ -0,0 +1,656 @@
+package codec
+
+import (
+	"fmt"
+
+	"github.com/pingostack/neon/pkg/deliver"
+)
+
+// SPS is what a sequence parameter set tells of a video stream.
+type SPS struct {
+	Codec deliver.CodecType `json:"codec"`
+	// Profile and Level are the profile_idc and level_idc of the sps.
+	Profile int `json:"profile"`
+	Level   int `json:"level"`
+	// Width and Height are the size of the pictures, cropping applied.
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// FrameRate is from the timing information of the vui, zero without.
+	FrameRate float64 `json:"frameRate,omitempty"`
+	// ReorderFrames is how many frames may precede a frame in decoding order
+	// and follow it in output order, B-frames. -1 when the sps does not
+	// tell.
+	ReorderFrames int `json:"reorderFrames"`
+}
+
+// ProfileName is the name of the profile, e.g. High.
+func (s *SPS) ProfileName() string {
+	var names map[int]string
+	if s.Codec == deliver.CodecTypeH265 {
+		names = h265Profiles
+	} else {
+		names = h264Profiles
+	}
+
+	if name, found := names[s.Profile]; found {
+		return name
+	}
+
+	return fmt.Sprintf("%d", s.Profile)
+}
+
+// LevelName is the level as written, e.g. 3.1.
+func (s *SPS) LevelName() string {
+	if s.Codec == deliver.CodecTypeH265 {
+		// general_level_idc is 30 times the level
+		if s.Level%30 == 0 {
+			return fmt.Sprintf("%d", s.Level/30)
+		}
+		return fmt.Sprintf("%d.%d", s.Level/30, s.Level%30/3)
+	}
+
+	if s.Level == 9 {
+		return "1b"
+	}
+
+	return fmt.Sprintf("%d.%d", s.Level/10, s.Level%10)
+}
+
+var h264Profiles = map[int]string{
+	44:  "CAVLC 4:4:4 Intra",
+	66:  "Baseline",
+	77:  "Main",
+	83:  "Scalable Baseline",
+	86:  "Scalable High",
+	88:  "Extended",
+	100: "High",
+	110: "High 10",
+	118: "Multiview High",
+	122: "High 4:2:2",
+	128: "Stereo High",
+	244: "High 4:4:4 Predictive",
+}
+
+var h265Profiles = map[int]string{
+	1: "Main",
+	2: "Main 10",
+	3: "Main Still Picture",
+	4: "Format Range Extensions",
+	5: "High Throughput",
+	9: "Screen Content Coding",
+}
+
+// ParseSPS parses the sps nal unit of codec, its header included.
+func ParseSPS(codec deliver.CodecType, nalu []byte) (*SPS, error) {
+	switch codec {
+	case deliver.CodecTypeH264:
+		return parseH264SPS(nalu)
+	case deliver.CodecTypeH265:
+		return parseH265SPS(nalu)
+	}
+
+	return nil, ErrUnsupported
+}
+
+func parseH264SPS(nalu []byte) (*SPS, error) {
+	if len(nalu) < 4 || NALUType(deliver.CodecTypeH264, nalu) != H264NALUTypeSPS {
+		return nil, ErrInvalidSPS
+	}
+
+	s := &SPS{Codec: deliver.CodecTypeH264, ReorderFrames: -1}
+	r := &bitReader{data: unescape(nalu[1:])}
+	profile, _ := r.bits(8)
+	r.bits(8) // constraint flags
+	level, _ := r.bits(8)
+	s.Profile, s.Level = int(profile), int(level)
+	if _, err := r.ue(); err != nil {
+		return nil, err
+	}
+
+	chromaFormat := uint32(1)
+	var err error
+	switch profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		if chromaFormat, err = r.ue(); err != nil {
+			return nil, err
+		}
+		if chromaFormat == 3 {
+			r.bit() // separate colour planes
+		}
+		r.ue()  // bit depth luma
+		r.ue()  // bit depth chroma
+		r.bit() // transform bypass
+		scaling, _ := r.bit()
+		if scaling == 1 {
+			lists := 8
+			if chromaFormat == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				present, err := r.bit()
+				if err != nil {
+					return nil, err
+				}
+				if present == 0 {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				last, next := int32(8), int32(8)
+				for j := 0; j < size && next != 0; j++ {
+					delta, err := r.se()
+					if err != nil {
+						return nil, err
+					}
+					next = (last + delta + 256) % 256
+					if next != 0 {
+						last = next
+					}
+				}
+			}
+		}
+	}
+
+	r.ue() // log2 max frame num
+	pocType, err := r.ue()
+	if err != nil {
+		return nil, err
+	}
+	switch pocType {
+	case 0:
+		r.ue()
+	case 1:
+		r.bit()
+		r.se()
+		r.se()
+		cycle, err := r.ue()
+		if err != nil {
+			return nil, err
+		}
+		// at most 255, a hostile count would keep the loop reading past
+		// the data for seconds
+		if cycle > 255 {
+			return nil, ErrInvalidSPS
+		}
+		for i := uint32(0); i < cycle; i++ {
+			if _, err := r.se(); err != nil {
+				return nil, err
+			}
+		}
+	case 2:
+	default:
+		return nil, ErrInvalidSPS
+	}
+
+	r.ue()  // max ref frames
+	r.bit() // gaps allowed
+	mbWidth, _ := r.ue()
+	mbHeight, _ := r.ue()
+	frameMbsOnly, _ := r.bit()
+	if frameMbsOnly == 0 {
+		r.bit() // adaptive frame field
+	}
+	r.bit() // direct 8x8 inference
+
+	s.Width = (int(mbWidth) + 1) * 16
+	s.Height = int(2-frameMbsOnly) * (int(mbHeight) + 1) * 16
+
+	cropping, err := r.bit()
+	if err != nil {
+		return nil, err
+	}
+	if cropping == 1 {
+		left, _ := r.ue()
+		right, _ := r.ue()
+		top, _ := r.ue()
+		bottom, err := r.ue()
+		if err != nil {
+			return nil, err
+		}
+
+		cropX, cropY := 2, 2*int(2-frameMbsOnly)
+		if chromaFormat == 0 || chromaFormat == 3 {
+			cropX, cropY = 1, int(2-frameMbsOnly)
+		}
+		s.Width -= cropX * (int(left) + int(right))
+		s.Height -= cropY * (int(top) + int(bottom))
+	}
+	if s.Width <= 0 || s.Height <= 0 {
+		return nil, ErrInvalidSPS
+	}
+
+	if profile == 66 {
+		// baseline has no B-frames
+		s.ReorderFrames = 0
+	}
+
+	// the vui is optional, a truncated one leaves what it tells unknown
+	if vui, _ := r.bit(); vui == 1 {
+		r.h264VUI(s)
+	}
+
+	return s, nil
+}
+
+func (r *bitReader) h264VUI(s *SPS) {
+	r.aspectRatio()
+	if overscan, _ := r.bit(); overscan == 1 {
+		r.bit()
+	}
+	r.videoSignal()
+	if chromaLoc, _ := r.bit(); chromaLoc == 1 {
+		r.ue()
+		r.ue()
+	}
+
+	if timing, _ := r.bit(); timing == 1 {
+		units, _ := r.bits(32)
+		scale, err := r.bits(32)
+		if err != nil {
+			return
+		}
+		r.bit() // fixed frame rate
+		if units > 0 {
+			// a frame is two fields
+			s.FrameRate = float64(scale) / float64(2*units)
+		}
+	}
+
+	nal, _ := r.bit()
+	if nal == 1 {
+		r.h264HRD()
+	}
+	vcl, _ := r.bit()
+	if vcl == 1 {
+		r.h264HRD()
+	}
+	if nal == 1 || vcl == 1 {
+		r.bit() // low delay
+	}
+	r.bit() // pic struct
+
+	restriction, err := r.bit()
+	if err != nil || restriction == 0 {
+		return
+	}
+
+	r.bit() // motion vectors over picture boundaries
+	r.ue()  // max bytes per picture
+	r.ue()  // max bits per macroblock
+	r.ue()  // log2 max mv length horizontal
+	r.ue()  // log2 max mv length vertical
+	if reorder, err := r.ue(); err == nil {
+		s.ReorderFrames = int(reorder)
+	}
+}
+
+func (r *bitReader) h264HRD() {
+	count, _ := r.ue()
+	r.bits(8) // bit rate and cpb size scales
+	for i := uint32(0); i <= count && i < 32 && r.ok(); i++ {
+		r.ue()
+		r.ue()
+		r.bit()
+	}
+	r.bits(20) // delay and offset lengths
+}
+
+func (r *bitReader) aspectRatio() {
+	if present, _ := r.bit(); present == 1 {
+		if idc, _ := r.bits(8); idc == 255 {
+			// extended sar
+			r.bits(32)
+		}
+	}
+}
+
+func (r *bitReader) videoSignal() {
+	if present, _ := r.bit(); present == 1 {
+		r.bits(4) // format, full range
+		if colour, _ := r.bit(); colour == 1 {
+			r.bits(24)
+		}
+	}
+}
+
+func parseH265SPS(nalu []byte) (*SPS, error) {
+	if len(nalu) < 4 || NALUType(deliver.CodecTypeH265, nalu) != H265NALUTypeSPS {
+		return nil, ErrInvalidSPS
+	}
+
+	s := &SPS{Codec: deliver.CodecTypeH265}
+	r := &bitReader{data: unescape(nalu[2:])}
+	r.bits(4) // vps id
+	maxSubLayers, _ := r.bits(3)
+	r.bit() // temporal id nesting
+
+	// profile_tier_level, the general profile and level only
+	r.bits(3) // profile space, tier
+	profile, _ := r.bits(5)
+	r.bits(32) // compatibility flags
+	r.bits(32) // source and constraint flags
+	r.bits(16)
+	level, err := r.bits(8)
+	if err != nil {
+		return nil, err
+	}
+	s.Profile, s.Level = int(profile), int(level)
+
+	var profilePresent, levelPresent [8]uint32
+	for i := uint32(0); i < maxSubLayers; i++ {
+		profilePresent[i], _ = r.bit()
+		levelPresent[i], _ = r.bit()
+	}
+	if maxSubLayers > 0 {
+		r.bits(2 * int(8-maxSubLayers))
+	}
+	for i := uint32(0); i < maxSubLayers; i++ {
+		if profilePresent[i] == 1 {
+			r.bits(32)
+			r.bits(32)
+			r.bits(24)
+		}
+		if levelPresent[i] == 1 {
+			r.bits(8)
+		}
+	}
+
+	r.ue() // sps id
+	chromaFormat, err := r.ue()
+	if err != nil {
+		return nil, err
+	}
+	if chromaFormat == 3 {
+		r.bit() // separate colour planes
+	}
+
+	width, _ := r.ue()
+	height, err := r.ue()
+	if err != nil {
+		return nil, err
+	}
+	s.Width, s.Height = int(width), int(height)
+
+	if window, _ := r.bit(); window == 1 {
+		left, _ := r.ue()
+		right, _ := r.ue()
+		top, _ := r.ue()
+		bottom, err := r.ue()
+		if err != nil {
+			return nil, err
+		}
+
+		cropX, cropY := 1, 1
+		switch chromaFormat {
+		case 1:
+			cropX, cropY = 2, 2
+		case 2:
+			cropX = 2
+		}
+		s.Width -= cropX * (int(left) + int(right))
+		s.Height -= cropY * (int(top) + int(bottom))
+	}
+	if s.Width <= 0 || s.Height <= 0 {
+		return nil, ErrInvalidSPS
+	}
+
+	r.ue() // bit depth luma
+	r.ue() // bit depth chroma
+	pocBits, err := r.ue()
+	if err != nil || pocBits > 12 {
+		return nil, ErrInvalidSPS
+	}
+
+	orderingInfo, _ := r.bit()
+	first := maxSubLayers
+	if orderingInfo == 1 {
+		first = 0
+	}
+	for i := first; i <= maxSubLayers; i++ {
+		r.ue() // max decoded picture buffering
+		reorder, err := r.ue()
+		if err != nil {
+			return nil, err
+		}
+		// the highest sub layer holds for the stream
+		s.ReorderFrames = int(reorder)
+		r.ue() // max latency increase
+	}
+
+	// the frame rate is in the vui, past the rest of the sps which can not
+	// be skipped without parsing it
+	for i := 0; i < 6; i++ {
+		r.ue() // coding and transform block sizes, hierarchy depths
+	}
+	if scaling, _ := r.bit(); scaling == 1 {
+		if data, _ := r.bit(); data == 1 && !r.h265ScalingLists() {
+			return s, nil
+		}
+	}
+	r.bits(2) // amp, sample adaptive offset
+	if pcm, _ := r.bit(); pcm == 1 {
+		r.bits(8) // pcm bit depths
+		r.ue()
+		r.ue()
+		r.bit()
+	}
+
+	sets, err := r.ue()
+	if err != nil || sets > 64 {
+		return s, nil
+	}
+	deltaPocs := make([]uint32, sets)
+	for i := uint32(0); i < sets; i++ {
+		if !r.h265ShortTermRefPicSet(i, deltaPocs) {
+			return s, nil
+		}
+	}
+
+	if longTerm, _ := r.bit(); longTerm == 1 {
+		n, _ := r.ue()
+		for i := uint32(0); i < n && i < 33 && r.ok(); i++ {
+			r.bits(int(pocBits) + 4)
+			r.bit()
+		}
+	}
+	r.bits(2) // temporal mvp, strong intra smoothing
+
+	if vui, _ := r.bit(); vui == 1 {
+		r.h265VUI(s)
+	}
+
+	return s, nil
+}
+
+// h265ScalingLists skips the scaling lists, false when they run past the
+// data.
+func (r *bitReader) h265ScalingLists() bool {
+	for size := 0; size < 4; size++ {
+		step := 1
+		if size == 3 {
+			step = 3
+		}
+		for matrix := 0; matrix < 6; matrix += step {
+			if pred, _ := r.bit(); pred == 0 {
+				r.ue() // delta of the reference list
+				continue
+			}
+
+			coefs := 1 << (4 + size<<1)
+			if coefs > 64 {
+				coefs = 64
+			}
+			if size > 1 {
+				r.se() // dc
+			}
+			for i := 0; i < coefs; i++ {
+				if _, err := r.se(); err != nil {
+					return false
+				}
+			}
+		}
+	}
+
+	return r.ok()
+}
+
+// h265ShortTermRefPicSet skips the set idx of the sps, deltaPocs holds the
+// number of pictures of the sets before it.
+func (r *bitReader) h265ShortTermRefPicSet(idx uint32, deltaPocs []uint32) bool {
+	inter := uint32(0)
+	if idx > 0 {
+		inter, _ = r.bit()
+	}
+
+	if inter == 1 {
+		r.bit() // delta rps sign
+		r.ue()  // abs delta rps
+		var n uint32
+		for j := uint32(0); j <= deltaPocs[idx-1]; j++ {
+			used, err := r.bit()
+			if err != nil {
+				return false
+			}
+			useDelta := uint32(1)
+			if used == 0 {
+				useDelta, _ = r.bit()
+			}
+			if used == 1 || useDelta == 1 {
+				n++
+			}
+		}
+		deltaPocs[idx] = n
+
+		return r.ok()
+	}
+
+	negative, _ := r.ue()
+	positive, err := r.ue()
+	if err != nil || negative > 16 || positive > 16 {
+		return false
+	}
+	for i := uint32(0); i < negative+positive; i++ {
+		r.ue() // delta poc
+		if _, err := r.bit(); err != nil {
+			return false
+		}
+	}
+	deltaPocs[idx] = negative + positive
+
+	return r.ok()
+}
+
+func (r *bitReader) h265VUI(s *SPS) {
+	r.aspectRatio()
+	if overscan, _ := r.bit(); overscan == 1 {
+		r.bit()
+	}
+	r.videoSignal()
+	if chromaLoc, _ := r.bit(); chromaLoc == 1 {
+		r.ue()
+		r.ue()
+	}
+	r.bits(3) // neutral chroma, field seq, frame field info
+	if window, _ := r.bit(); window == 1 {
+		for i := 0; i < 4; i++ {
+			r.ue()
+		}
+	}
+
+	if timing, _ := r.bit(); timing == 1 {
+		units, _ := r.bits(32)
+		scale, err := r.bits(32)
+		if err == nil && units > 0 {
+			s.FrameRate = float64(scale) / float64(units)
+		}
+	}
+}
+
+type bitReader struct {
+	data []byte
+	pos  int
+	// short is set once a read ran past the data
+	short bool
+}
+
+func (r *bitReader) ok() bool {
+	return !r.short
+}
+
+func (r *bitReader) bit() (uint32, error) {
+	if r.pos >= len(r.data)*8 {
+		r.short = true
+		return 0, ErrInvalidSPS
+	}
+
+	v := uint32(r.data[r.pos/8]>>(7-r.pos%8)) & 1
+	r.pos++
+
+	return v, nil
+}
+
+func (r *bitReader) bits(n int) (uint32, error) {
+	var v uint32
+	for i := 0; i < n; i++ {
+		b, err := r.bit()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<1 | b
+	}
+
+	return v, nil
+}
+
+// ue reads an exp-golomb coded number.
+func (r *bitReader) ue() (uint32, error) {
+	zeros := 0
+	for {
+		b, err := r.bit()
+		if err != nil {
+			return 0, err
+		}
+		if b == 1 {
+			break
+		}
+		zeros++
+		if zeros > 31 {
+			return 0, ErrInvalidSPS
+		}
+	}
+
+	v, err := r.bits(zeros)
+	if err != nil {
+		return 0, err
+	}
+
+	return 1<<zeros - 1 + v, nil
+}
+
+func (r *bitReader) se() (int32, error) {
+	v, err := r.ue()
+	if err != nil {
+		return 0, err
+	}
+
+	if v&1 == 1 {
+		return int32(v/2 + 1), nil
+	}
+
+	return -int32(v / 2), nil
+}
+
+// unescape removes the emulation prevention bytes of a nal unit.
+func unescape(nalu []byte) []byte {
+	out := make([]byte, 0, len(nalu))
+	for i := 0; i < len(nalu); i++ {
+		if i >= 2 && nalu[i] == 3 && nalu[i-1] == 0 && nalu[i-2] == 0 {
+			continue
+		}
+		out = append(out, nalu[i])
+	}
+
+	return out
+}
@@ -0,0 +1,148 @@
+package codec
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver"
+)
+
+// bitWriter builds the hostile sps of the tests.
+type bitWriter struct {
+	data []byte
+	n    int
+}
+
+func (w *bitWriter) bits(v uint32, n int) *bitWriter {
+	for i := n - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		w.data[len(w.data)-1] |= byte(v>>i&1) << (7 - w.n%8)
+		w.n++
+	}
+	return w
+}
+
+func (w *bitWriter) ue(v uint32) *bitWriter {
+	n := 0
+	for x := uint64(v) + 1; x > 1; x >>= 1 {
+		n++
+	}
+	w.bits(0, n)
+	return w.bits(v+1, n+1)
+}
+
+func h264SPS(w *bitWriter) []byte {
+	return append([]byte{0x67}, w.data...)
+}
+
+func mustDecode(s string) []byte {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+var (
+	// 1280x720 baseline at 25 fps
+	validH264SPS = mustDecode("Z0LgH9oBQBbpUgAAAwACAAADAGQeMGVA")
+	// 1920x1080 main
+	validH265SPS = mustDecode("QgEBAWAAAAMAsAAAAwAAAwB4oAPAgBDlja5JMvTcBAQEAgA=")
+)
+
+func TestParseSPS(t *testing.T) {
+	tests := []struct {
+		name   string
+		codec  deliver.CodecType
+		nalu   []byte
+		width  int
+		height int
+		fail   bool
+	}{
+		{name: "h264", codec: deliver.CodecTypeH264, nalu: validH264SPS, width: 1280, height: 720},
+		{name: "h265", codec: deliver.CodecTypeH265, nalu: validH265SPS, width: 1920, height: 1080},
+		{name: "empty", codec: deliver.CodecTypeH264, fail: true},
+		{name: "h264 pps", codec: deliver.CodecTypeH264, nalu: []byte{0x68, 0xce, 0x32, 0xc8}, fail: true},
+		{name: "h265 vps", codec: deliver.CodecTypeH265, nalu: []byte{0x40, 0x01, 0x0c, 0x01, 0xff, 0xff}, fail: true},
+		{name: "h264 header only", codec: deliver.CodecTypeH264, nalu: validH264SPS[:4], fail: true},
+		{name: "h265 header only", codec: deliver.CodecTypeH265, nalu: validH265SPS[:4], fail: true},
+		{name: "vp8", codec: deliver.CodecTypeVP8, nalu: validH264SPS, fail: true},
+		{
+			name:  "h264 poc cycle too long",
+			codec: deliver.CodecTypeH264,
+			nalu: h264SPS((&bitWriter{}).bits(66, 8).bits(0, 8).bits(31, 8).
+				ue(0).ue(0).ue(1).bits(0, 1).ue(0).ue(0).ue(1 << 29)),
+			fail: true,
+		},
+		{
+			name:  "h264 poc cycle past the data",
+			codec: deliver.CodecTypeH264,
+			nalu: h264SPS((&bitWriter{}).bits(66, 8).bits(0, 8).bits(31, 8).
+				ue(0).ue(0).ue(1).bits(0, 1).ue(0).ue(0).ue(255)),
+			fail: true,
+		},
+		{
+			name:  "h264 unknown poc type",
+			codec: deliver.CodecTypeH264,
+			nalu: h264SPS((&bitWriter{}).bits(66, 8).bits(0, 8).bits(31, 8).
+				ue(0).ue(0).ue(3).ue(1).bits(0, 1).ue(79).ue(44).bits(1, 1).bits(1, 1).bits(0, 1).bits(0, 1)),
+			fail: true,
+		},
+		{
+			name:  "h264 cropped away",
+			codec: deliver.CodecTypeH264,
+			nalu: h264SPS((&bitWriter{}).bits(66, 8).bits(0, 8).bits(31, 8).
+				ue(0).ue(0).ue(2).ue(1).bits(0, 1).ue(0).ue(0).bits(1, 1).bits(1, 1).
+				bits(1, 1).ue(8).ue(0).ue(0).ue(0).bits(0, 1)),
+			fail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			s, err := ParseSPS(tt.codec, tt.nalu)
+			if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+				t.Errorf("parsing took %v", elapsed)
+			}
+
+			if tt.fail {
+				if err == nil {
+					t.Fatalf("parsed %+v, want an error", s)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Width != tt.width || s.Height != tt.height {
+				t.Errorf("size = %dx%d, want %dx%d", s.Width, s.Height, tt.width, tt.height)
+			}
+		})
+	}
+}
+
+// TestParseTruncatedSPS parses every prefix of the valid sps, none may panic
+// and the ones cut before the size may not pass.
+func TestParseTruncatedSPS(t *testing.T) {
+	for _, tt := range []struct {
+		codec deliver.CodecType
+		nalu  []byte
+		// sized is the length from which the size is complete
+		sized int
+	}{
+		{codec: deliver.CodecTypeH264, nalu: validH264SPS, sized: 9},
+		{codec: deliver.CodecTypeH265, nalu: validH265SPS, sized: 26},
+	} {
+		for n := 0; n < len(tt.nalu); n++ {
+			s, err := ParseSPS(tt.codec, tt.nalu[:n])
+			if n < tt.sized && err == nil {
+				t.Errorf("%s cut at %d: parsed %+v", tt.codec, n, s)
+			}
+		}
+	}
+}
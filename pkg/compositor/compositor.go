@@ -0,0 +1,547 @@
+// Package compositor composes the video of streams into one picture, in a
+// grid or picture in picture, with an ffmpeg process it runs. ffmpeg reads
+// the h264 of every input on a pipe of its own and writes the composed h264
+// to its output, it is restarted with a new filter graph when the layout or
+// the inputs sending change.
+package compositor
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingostack/neon/pkg/codec"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/rtclib"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	videoPayloadType = 96
+	videoClockRate   = 90000
+
+	defaultCommand = "ffmpeg"
+	defaultWidth   = 1280
+	defaultHeight  = 720
+	defaultFPS     = 25
+	defaultBitrate = 2000
+
+	// the inputs sending are checked this often, a change restarts ffmpeg
+	checkInterval = time.Second
+	// ffmpeg is started again this long after it failed
+	retryInterval = 2 * time.Second
+	// the end of the errors of ffmpeg kept for the log
+	stderrTail = 2048
+)
+
+type Options struct {
+	// Command is the ffmpeg binary, found in PATH when not absolute.
+	Command string
+	Width   int
+	Height  int
+	FPS     int
+	// Bitrate of the composed video in kbps.
+	Bitrate int
+	// EncoderArgs replace the default libx264 arguments of the output, they
+	// must encode h264.
+	EncoderArgs []string
+	Layout      Layout
+}
+
+type Info struct {
+	ID        string      `json:"id"`
+	Layout    Layout      `json:"layout"`
+	Width     int         `json:"width"`
+	Height    int         `json:"height"`
+	FPS       int         `json:"fps"`
+	Inputs    []InputInfo `json:"inputs"`
+	Running   bool        `json:"running"`
+	Restarts  uint64      `json:"restarts"`
+	StartedAt time.Time   `json:"startedAt"`
+}
+
+// Compositor is a frame source of the composed h264. Its timestamps carry on
+// over restarts of ffmpeg, which start with a keyframe.
+type Compositor struct {
+	deliver.FrameSource
+	id         string
+	opts       Options
+	logger     *logrus.Entry
+	packetizer *rtclib.Packetizer
+	changed    chan struct{}
+	startedAt  time.Time
+	frames     uint64
+	restarts   uint64
+	running    int32
+
+	lock     sync.Mutex
+	inputs   map[string]*input
+	layout   Layout
+	composed []string
+}
+
+var (
+	compositions = make(map[string]*Compositor)
+	lock         sync.RWMutex
+)
+
+// New starts the composition id until ctx is done, it is found with Get
+// meanwhile.
+func New(ctx context.Context, id string, opts Options, logger *logrus.Entry) (*Compositor, error) {
+	if opts.Command == "" {
+		opts.Command = defaultCommand
+	}
+	if opts.Width <= 0 || opts.Height <= 0 {
+		opts.Width, opts.Height = defaultWidth, defaultHeight
+	}
+	opts.Width, opts.Height = even(opts.Width), even(opts.Height)
+	if opts.FPS <= 0 {
+		opts.FPS = defaultFPS
+	}
+	if opts.Bitrate <= 0 {
+		opts.Bitrate = defaultBitrate
+	}
+	if opts.Layout.Kind == "" {
+		opts.Layout.Kind = LayoutGrid
+	}
+	if err := opts.Layout.validate(); err != nil {
+		return nil, err
+	}
+
+	packetizer, err := rtclib.NewPacketizer(deliver.CodecTypeH264, videoPayloadType, videoClockRate)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Compositor{
+		id:         id,
+		opts:       opts,
+		logger:     logger.WithField("composition", id),
+		packetizer: packetizer,
+		changed:    make(chan struct{}, 1),
+		startedAt:  time.Now(),
+		inputs:     make(map[string]*input),
+		layout:     opts.Layout,
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if _, ok := compositions[id]; ok {
+		return nil, ErrCompositionExists
+	}
+
+	c.FrameSource = deliver.NewFrameSourceImpl(ctx, deliver.Metadata{
+		PacketType: deliver.PacketTypeRtp,
+		Video: &deliver.VideoMetadata{
+			Codec:          deliver.CodecTypeH264.String(),
+			CodecType:      deliver.CodecTypeH264,
+			Width:          opts.Width,
+			Height:         opts.Height,
+			FPS:            opts.FPS,
+			RtpPayloadType: videoPayloadType,
+			ClockRate:      videoClockRate,
+		},
+	})
+	compositions[id] = c
+
+	go func() {
+		<-c.Context().Done()
+
+		lock.Lock()
+		delete(compositions, id)
+		lock.Unlock()
+	}()
+
+	go c.run()
+
+	return c, nil
+}
+
+// Get returns the running composition id.
+func Get(id string) (*Compositor, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	c, ok := compositions[id]
+	return c, ok
+}
+
+// List returns the running compositions by id.
+func List() []*Compositor {
+	lock.RLock()
+	list := make([]*Compositor, 0, len(compositions))
+	for _, c := range compositions {
+		list = append(list, c)
+	}
+	lock.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].id < list[j].id
+	})
+
+	return list
+}
+
+func (c *Compositor) ID() string {
+	return c.id
+}
+
+// AddInput composes the video of stream once it sends, the returned
+// destination is subscribed to it. The input leaves the composition when the
+// destination is closed.
+func (c *Compositor) AddInput(stream string) (deliver.FrameDestination, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.inputs[stream]; ok {
+		return nil, ErrInputExists
+	}
+
+	in := newInput(c, stream)
+	c.inputs[stream] = in
+
+	go func() {
+		<-in.Context().Done()
+
+		c.lock.Lock()
+		if c.inputs[stream] == in {
+			delete(c.inputs, stream)
+		}
+		c.lock.Unlock()
+	}()
+
+	c.logger.WithField("input", stream).Info("composition input added")
+
+	return in, nil
+}
+
+func (c *Compositor) RemoveInput(stream string) {
+	c.lock.Lock()
+	in, ok := c.inputs[stream]
+	delete(c.inputs, stream)
+	c.lock.Unlock()
+
+	if ok {
+		in.Close()
+		c.logger.WithField("input", stream).Info("composition input removed")
+	}
+}
+
+func (c *Compositor) HasInput(stream string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	_, ok := c.inputs[stream]
+	return ok
+}
+
+// Inputs returns the streams added.
+func (c *Compositor) Inputs() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	streams := make([]string, 0, len(c.inputs))
+	for stream := range c.inputs {
+		streams = append(streams, stream)
+	}
+	sort.Strings(streams)
+
+	return streams
+}
+
+// SetLayout switches the layout, ffmpeg restarts with it.
+func (c *Compositor) SetLayout(layout Layout) error {
+	if err := layout.validate(); err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	c.layout = layout
+	c.lock.Unlock()
+
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+func (c *Compositor) Info() Info {
+	c.lock.Lock()
+	composed := make(map[string]bool, len(c.composed))
+	for _, stream := range c.composed {
+		composed[stream] = true
+	}
+	info := Info{
+		ID:        c.id,
+		Layout:    c.layout,
+		Width:     c.opts.Width,
+		Height:    c.opts.Height,
+		FPS:       c.opts.FPS,
+		Inputs:    make([]InputInfo, 0, len(c.inputs)),
+		Running:   atomic.LoadInt32(&c.running) == 1,
+		Restarts:  atomic.LoadUint64(&c.restarts),
+		StartedAt: c.startedAt,
+	}
+	for stream, in := range c.inputs {
+		info.Inputs = append(info.Inputs, in.info(composed[stream]))
+	}
+	c.lock.Unlock()
+
+	sort.Slice(info.Inputs, func(i, j int) bool {
+		return info.Inputs[i].Stream < info.Inputs[j].Stream
+	})
+
+	return info
+}
+
+// live returns the inputs sending and the layout, the main input first.
+func (c *Compositor) live() ([]*input, Layout) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var inputs []*input
+	for _, in := range c.inputs {
+		if in.live() {
+			inputs = append(inputs, in)
+		}
+	}
+
+	main := c.layout.Main
+	sort.Slice(inputs, func(i, j int) bool {
+		if (inputs[i].stream == main) != (inputs[j].stream == main) {
+			return inputs[i].stream == main
+		}
+		return inputs[i].stream < inputs[j].stream
+	})
+
+	return inputs, c.layout
+}
+
+func sameInputs(a, b []*input) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// run keeps an ffmpeg composing the inputs sending until the context is
+// done.
+func (c *Compositor) run() {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for c.Context().Err() == nil {
+		inputs, layout := c.live()
+
+		err := c.compose(inputs, layout, ticker.C)
+		if c.Context().Err() != nil {
+			return
+		}
+
+		atomic.AddUint64(&c.restarts, 1)
+		if err == nil {
+			continue
+		}
+
+		c.logger.WithError(err).Warn("ffmpeg failed, restarting")
+		select {
+		case <-c.Context().Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// compose runs ffmpeg with inputs until it fails, nil when it was stopped
+// because the layout or the inputs sending changed.
+func (c *Compositor) compose(inputs []*input, layout Layout, check <-chan time.Time) error {
+	ctx, cancel := context.WithCancel(c.Context())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, c.opts.Command, c.args(len(inputs), layout)...)
+	stderr := &tailBuffer{max: stderrTail}
+	cmd.Stderr = stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	writers := make([]*os.File, 0, len(inputs))
+	defer func() {
+		for _, w := range writers {
+			w.Close()
+		}
+	}()
+	for range inputs {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		cmd.ExtraFiles = append(cmd.ExtraFiles, r)
+		writers = append(writers, w)
+	}
+
+	err = cmd.Start()
+	for _, r := range cmd.ExtraFiles {
+		r.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	composed := make([]string, len(inputs))
+	for i, in := range inputs {
+		in.attach(writers[i])
+		composed[i] = in.stream
+	}
+	// the inputs close their pipes once detached
+	writers = nil
+	defer func() {
+		for _, in := range inputs {
+			in.detach()
+		}
+	}()
+
+	c.lock.Lock()
+	c.composed = composed
+	c.lock.Unlock()
+	atomic.StoreInt32(&c.running, 1)
+	defer atomic.StoreInt32(&c.running, 0)
+
+	c.logger.WithFields(logrus.Fields{
+		"inputs": composed,
+		"layout": layout.Kind,
+	}).Info("ffmpeg composing")
+
+	exited := make(chan error, 1)
+	go func() {
+		c.readOutput(stdout)
+		exited <- cmd.Wait()
+	}()
+
+	for {
+		select {
+		case err := <-exited:
+			if err == nil {
+				err = ErrFFmpegExited
+			}
+			return errors.Wrap(err, stderr.String())
+		case <-c.changed:
+			cancel()
+			<-exited
+			return nil
+		case <-check:
+			if now, _ := c.live(); !sameInputs(now, inputs) {
+				cancel()
+				<-exited
+				return nil
+			}
+		}
+	}
+}
+
+func (c *Compositor) args(n int, layout Layout) []string {
+	args := []string{"-hide_banner", "-loglevel", "error", "-nostdin"}
+	for i := 0; i < n; i++ {
+		args = append(args,
+			"-thread_queue_size", "512",
+			"-fflags", "nobuffer",
+			"-use_wallclock_as_timestamps", "1",
+			"-f", "h264",
+			// the pipes of the inputs follow stdin, stdout and stderr
+			"-i", "pipe:"+strconv.Itoa(3+i))
+	}
+
+	args = append(args,
+		"-filter_complex", layout.filterGraph(n, c.opts.Width, c.opts.Height, c.opts.FPS),
+		"-map", "[out]", "-an", "-r", strconv.Itoa(c.opts.FPS))
+
+	if len(c.opts.EncoderArgs) > 0 {
+		args = append(args, c.opts.EncoderArgs...)
+	} else {
+		bitrate := strconv.Itoa(c.opts.Bitrate) + "k"
+		args = append(args,
+			"-c:v", "libx264", "-preset", "veryfast", "-tune", "zerolatency",
+			"-profile:v", "baseline", "-g", strconv.Itoa(2*c.opts.FPS),
+			"-b:v", bitrate, "-maxrate", bitrate, "-bufsize", bitrate)
+	}
+
+	// the delimiters cut the output into access units
+	return append(args, "-bsf:v", "h264_metadata=aud=insert", "-f", "h264", "pipe:1")
+}
+
+// readOutput publishes the access units ffmpeg writes, until it exits.
+func (c *Compositor) readOutput(r io.Reader) {
+	var s codec.AUSplitter
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			s.Write(buf[:n], c.deliverAU)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *Compositor) deliverAU(au []byte) {
+	n := atomic.AddUint64(&c.frames, 1) - 1
+	keyframe := codec.IsKeyframe(deliver.CodecTypeH264, au)
+
+	for _, f := range c.packetizer.Packetize(deliver.Frame{
+		Codec:          deliver.CodecTypeH264,
+		PacketType:     deliver.PacketTypeRaw,
+		Payload:        au,
+		Length:         len(au),
+		TimeStamp:      uint32(n * videoClockRate / uint64(c.opts.FPS)),
+		AdditionalInfo: &deliver.VideoFrameSpecificInfo{IsKeyFrame: keyframe},
+	}) {
+		c.FrameSource.DeliverFrame(f, nil)
+	}
+}
+
+// tailBuffer keeps the last max bytes written.
+type tailBuffer struct {
+	lock sync.Mutex
+	max  int
+	buf  bytes.Buffer
+}
+
+func (t *tailBuffer) Write(b []byte) (int, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.buf.Write(b)
+	if over := t.buf.Len() - t.max; over > 0 {
+		t.buf.Next(over)
+	}
+
+	return len(b), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return string(bytes.TrimSpace(t.buf.Bytes()))
+}
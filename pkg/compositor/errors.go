@@ -0,0 +1,10 @@
+package compositor
+
+import "errors"
+
+var (
+	ErrCompositionExists = errors.New("composition exists")
+	ErrInputExists       = errors.New("composition input exists")
+	ErrInvalidLayout     = errors.New("invalid layout")
+	ErrFFmpegExited      = errors.New("ffmpeg exited")
+)
@@ -0,0 +1,165 @@
+package compositor
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/record"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// an input without a frame this long leaves the composition until it
+	// sends again
+	staleAfter = 3 * time.Second
+	// access units queued for ffmpeg, beyond the input drops to its next
+	// keyframe
+	inputQueue = 64
+)
+
+type InputInfo struct {
+	Stream string `json:"stream"`
+	// Codec is the video of the stream, only h264 is composed.
+	Codec    string `json:"codec"`
+	Composed bool   `json:"composed"`
+	Dropped  uint64 `json:"dropped"`
+}
+
+// input writes the h264 of a stream to its pipe of the running ffmpeg.
+type input struct {
+	*record.FrameDestination
+	stream string
+	logger *logrus.Entry
+	// unix nanoseconds of the last h264 access unit
+	lastFrame int64
+	dropped   uint64
+
+	lock         sync.Mutex
+	codec        string
+	feed         chan []byte
+	waitKeyframe bool
+}
+
+func newInput(c *Compositor, stream string) *input {
+	in := &input{
+		stream: stream,
+		logger: c.logger.WithField("input", stream),
+	}
+	in.FrameDestination = record.NewFrameDestination(c.Context(), in.logger)
+	in.OnMetadataChange(in.onMetadata)
+	in.OnRawFrame(in.onFrame)
+
+	return in
+}
+
+// OnFrame keeps the audio from the depacketizers, only video is composed.
+func (in *input) OnFrame(frame deliver.Frame, attr deliver.Attributes) {
+	if !frame.Codec.IsVideo() {
+		return
+	}
+
+	in.FrameDestination.OnFrame(frame, attr)
+}
+
+func (in *input) onMetadata(md *deliver.Metadata) {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+
+	in.codec = ""
+	if md.HasVideo() {
+		in.codec = md.Video.CodecType.String()
+		if md.Video.CodecType != deliver.CodecTypeH264 {
+			in.logger.WithField("codec", in.codec).Warn("video not composed, only h264 is")
+		}
+	}
+
+	// ffmpeg takes the parameter sets of the new codec from a keyframe
+	in.waitKeyframe = true
+}
+
+func (in *input) onFrame(frame deliver.Frame) {
+	if frame.Codec != deliver.CodecTypeH264 {
+		return
+	}
+	atomic.StoreInt64(&in.lastFrame, time.Now().UnixNano())
+
+	in.lock.Lock()
+	defer in.lock.Unlock()
+
+	if in.feed == nil {
+		return
+	}
+
+	keyframe := false
+	if info, ok := frame.AdditionalInfo.(*deliver.VideoFrameSpecificInfo); ok {
+		keyframe = info.IsKeyFrame
+	}
+	if in.waitKeyframe && !keyframe {
+		return
+	}
+	in.waitKeyframe = false
+
+	select {
+	case in.feed <- append([]byte(nil), frame.Payload...):
+	default:
+		atomic.AddUint64(&in.dropped, 1)
+		in.waitKeyframe = true
+		in.RequestKeyframe()
+	}
+}
+
+// live tells whether the stream sends h264, ffmpeg would wait on it
+// otherwise.
+func (in *input) live() bool {
+	last := atomic.LoadInt64(&in.lastFrame)
+	return last != 0 && time.Since(time.Unix(0, last)) < staleAfter
+}
+
+// attach feeds w, the pipe of a new ffmpeg, from the next keyframe.
+func (in *input) attach(w *os.File) {
+	feed := make(chan []byte, inputQueue)
+
+	in.lock.Lock()
+	in.feed, in.waitKeyframe = feed, true
+	in.lock.Unlock()
+
+	in.RequestKeyframe()
+
+	go func() {
+		defer w.Close()
+
+		for au := range feed {
+			if _, err := w.Write(au); err != nil {
+				in.logger.WithError(err).Debug("composition input pipe closed")
+				for range feed {
+				}
+				return
+			}
+		}
+	}()
+}
+
+func (in *input) detach() {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+
+	if in.feed != nil {
+		close(in.feed)
+		in.feed = nil
+	}
+}
+
+func (in *input) info(composed bool) InputInfo {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+
+	return InputInfo{
+		Stream:   in.stream,
+		Codec:    in.codec,
+		Composed: composed,
+		Dropped:  atomic.LoadUint64(&in.dropped),
+	}
+}
@@ -0,0 +1,110 @@
+package compositor
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+type Kind string
+
+const (
+	// LayoutGrid tiles the inputs in equal cells.
+	LayoutGrid Kind = "grid"
+	// LayoutPiP shows the main input in full and the others small in the
+	// lower right corner.
+	LayoutPiP Kind = "pip"
+)
+
+type Layout struct {
+	Kind Kind `json:"kind"`
+	// Main is the stream shown in full of pip and first of a grid, the
+	// first input when empty or not composed.
+	Main string `json:"main"`
+}
+
+func (l Layout) validate() error {
+	switch l.Kind {
+	case LayoutGrid, LayoutPiP:
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrInvalidLayout, l.Kind)
+}
+
+// box is where an input is drawn, its picture is scaled into it keeping the
+// aspect ratio.
+type box struct {
+	x, y, w, h int
+}
+
+func even(n int) int {
+	return n &^ 1
+}
+
+// boxes places n inputs on a width x height canvas, the main input first.
+func (l Layout) boxes(n, width, height int) []box {
+	if n == 0 {
+		return nil
+	}
+
+	if l.Kind == LayoutPiP {
+		boxes := []box{{0, 0, width, height}}
+
+		w, h, margin := even(width/4), even(height/4), even(width/40)
+		perRow := (width - margin) / (w + margin)
+		if perRow < 1 {
+			perRow = 1
+		}
+		for i := 0; i < n-1; i++ {
+			row, col := i/perRow, i%perRow
+			boxes = append(boxes, box{
+				x: width - (col+1)*(w+margin),
+				y: height - (row+1)*(h+margin),
+				w: w,
+				h: h,
+			})
+		}
+
+		return boxes
+	}
+
+	cols := int(math.Ceil(math.Sqrt(float64(n))))
+	rows := (n + cols - 1) / cols
+	w, h := even(width/cols), even(height/rows)
+
+	boxes := make([]box, n)
+	for i := range boxes {
+		boxes[i] = box{x: (i % cols) * w, y: (i / cols) * h, w: w, h: h}
+	}
+
+	return boxes
+}
+
+// filterGraph draws the inputs 0..n-1 of ffmpeg over a black canvas, the
+// composed picture is [out].
+func (l Layout) filterGraph(n, width, height, fps int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "color=c=black:s=%dx%d:r=%d", width, height, fps)
+	if n == 0 {
+		b.WriteString(",format=yuv420p[out]")
+		return b.String()
+	}
+	b.WriteString("[b0]")
+
+	for i, bx := range l.boxes(n, width, height) {
+		fmt.Fprintf(&b, ";[%d:v]scale=%d:%d:force_original_aspect_ratio=decrease:force_divisible_by=2,"+
+			"pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1[v%d]", i, bx.w, bx.h, bx.w, bx.h, i)
+
+		// a stalled input keeps its last picture instead of holding up
+		// the others
+		fmt.Fprintf(&b, ";[b%d][v%d]overlay=%d:%d:eof_action=repeat:repeatlast=1", i, i, bx.x, bx.y)
+		if i == n-1 {
+			b.WriteString(",format=yuv420p[out]")
+		} else {
+			fmt.Fprintf(&b, "[b%d]", i+1)
+		}
+	}
+
+	return b.String()
+}
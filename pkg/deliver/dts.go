@@ -0,0 +1,124 @@
+package deliver
+
+import "sort"
+
+const (
+	// DefaultReorderDepth covers B-frames and a pyramid of them, the common
+	// encodings of H.264 and H.265.
+	DefaultReorderDepth = 2
+	maxReorderDepth     = 16
+)
+
+// DTSExtractor computes the decoding timestamps of the video frames of a
+// publisher, which arrive in decoding order stamped with their presentation
+// timestamp only, as over rtp. The frame n of the stream is decoded at the
+// n-th smallest timestamp of the stream, shifted by the reorder depth so that
+// no frame is decoded after it is presented. Knowing the smallest timestamps
+// takes that many frames of lookahead, the frames are held until then.
+//
+// The decoding timestamp of a frame is its TimeStamp less its
+// CompositionOffset.
+type DTSExtractor struct {
+	depth   int
+	frames  []heldFrame
+	pending []int64
+	n       int
+	first   int64
+	lastDTS int64
+	lastIn  uint32
+	ts      int64
+}
+
+type heldFrame struct {
+	Frame
+	// pts is the unwrapped TimeStamp
+	pts int64
+}
+
+// NewDTSExtractor reorders over depth frames, a depth of 0 takes the
+// timestamps for decoding timestamps, streams without B-frames.
+func NewDTSExtractor(depth int) *DTSExtractor {
+	if depth < 0 {
+		depth = 0
+	}
+
+	if depth > maxReorderDepth {
+		depth = maxReorderDepth
+	}
+
+	return &DTSExtractor{depth: depth}
+}
+
+// Push takes the next frame in decoding order and returns the frames whose
+// decoding timestamp is known, with their CompositionOffset set.
+func (e *DTSExtractor) Push(frame Frame) []Frame {
+	if e.depth == 0 {
+		frame.CompositionOffset = 0
+		return []Frame{frame}
+	}
+
+	// timestamps are unwrapped, the clock of rtp rolls over
+	if e.n == 0 && len(e.frames) == 0 {
+		e.ts = int64(frame.TimeStamp)
+	} else {
+		e.ts += int64(int32(frame.TimeStamp - e.lastIn))
+	}
+	e.lastIn = frame.TimeStamp
+
+	e.frames = append(e.frames, heldFrame{Frame: frame, pts: e.ts})
+	i := sort.Search(len(e.pending), func(i int) bool { return e.pending[i] > e.ts })
+	e.pending = append(e.pending, 0)
+	copy(e.pending[i+1:], e.pending[i:])
+	e.pending[i] = e.ts
+
+	var out []Frame
+	for len(e.frames) > e.depth {
+		out = append(out, e.pop())
+	}
+
+	return out
+}
+
+// Flush returns the frames held for lookahead, at the end of the stream.
+func (e *DTSExtractor) Flush() []Frame {
+	var out []Frame
+	for len(e.frames) > 0 {
+		out = append(out, e.pop())
+	}
+
+	return out
+}
+
+func (e *DTSExtractor) pop() Frame {
+	held := e.frames[0]
+	e.frames = e.frames[1:]
+
+	if e.n == 0 {
+		e.first = e.pending[0]
+	}
+
+	var dts int64
+	if e.n < e.depth {
+		// the first frames are decoded a tick apart, before the smallest
+		// timestamp
+		dts = e.first - int64(e.depth-e.n)
+	} else {
+		dts = e.pending[0]
+		e.pending = e.pending[1:]
+	}
+	e.n++
+
+	if e.n > 1 && dts <= e.lastDTS {
+		dts = e.lastDTS + 1
+	}
+	if dts > held.pts {
+		// reordered deeper than depth, decoded as it is presented
+		dts = held.pts
+	}
+	e.lastDTS = dts
+
+	frame := held.Frame
+	frame.CompositionOffset = uint32(held.pts - dts)
+
+	return frame
+}
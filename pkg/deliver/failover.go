@@ -0,0 +1,196 @@
+package deliver
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFailoverTimeout = 2 * time.Second
+	defaultFailoverRecover = 5 * time.Second
+)
+
+type SwitcherOptions struct {
+	// Timeout without primary frames after which the backup takes over.
+	Timeout time.Duration
+	// Recover is how long the primary must flow again before switching back.
+	Recover time.Duration
+	// OnSwitch is called after every switch, backup tells the new input.
+	OnSwitch func(backup bool)
+}
+
+// Switcher is a frame source fed by a primary and a backup source. It forwards
+// the primary while it flows and switches to the backup, and back, on video
+// keyframes so destinations never start mid GOP.
+type Switcher struct {
+	FrameSource
+	ctx           context.Context
+	opts          SwitcherOptions
+	lock          sync.Mutex
+	primary       *switchInput
+	backup        *switchInput
+	onBackup      bool
+	lastPrimary   time.Time
+	primarySince  time.Time
+	metadataReady bool
+}
+
+func NewSwitcher(ctx context.Context, opts SwitcherOptions) *Switcher {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultFailoverTimeout
+	}
+
+	if opts.Recover <= 0 {
+		opts.Recover = defaultFailoverRecover
+	}
+
+	// the primary gets Timeout to show up before the backup may take over
+	return &Switcher{
+		ctx:         ctx,
+		opts:        opts,
+		lastPrimary: time.Now(),
+		FrameSource: NewFrameSourceImpl(ctx, Metadata{}),
+	}
+}
+
+func (sw *Switcher) SetPrimary(src FrameSource) error {
+	return sw.setInput(src, false)
+}
+
+func (sw *Switcher) SetBackup(src FrameSource) error {
+	return sw.setInput(src, true)
+}
+
+// OnBackup tells whether the backup is currently forwarded.
+func (sw *Switcher) OnBackup() bool {
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+
+	return sw.onBackup
+}
+
+func (sw *Switcher) setInput(src FrameSource, backup bool) error {
+	in := &switchInput{
+		FrameDestination: NewFrameDestinationImpl(sw.ctx, src.FormatSettings()),
+		sw:               sw,
+		backup:           backup,
+	}
+
+	sw.lock.Lock()
+	old := sw.primary
+	if backup {
+		old = sw.backup
+		sw.backup = in
+	} else {
+		sw.primary = in
+	}
+
+	if !sw.metadataReady {
+		sw.metadataReady = true
+		sw.FrameSource.DeliverMetaData(*src.Metadata())
+	}
+	sw.lock.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+
+	return AddDestination[FrameSource, FrameDestination](src, in)
+}
+
+func (sw *Switcher) AddDestination(dest FrameDestination) error {
+	return AddDestination(sw, dest)
+}
+
+// OnFeedback goes to the input being forwarded, e.g. PLIs from players.
+func (sw *Switcher) OnFeedback(fb FeedbackMsg) {
+	sw.lock.Lock()
+	in := sw.primary
+	if sw.onBackup {
+		in = sw.backup
+	}
+	sw.lock.Unlock()
+
+	if in != nil {
+		in.DeliverFeedback(fb)
+	}
+}
+
+func (sw *Switcher) onFrame(in *switchInput, frame Frame, attr Attributes) {
+	now := time.Now()
+
+	sw.lock.Lock()
+	if in != sw.primary && in != sw.backup {
+		sw.lock.Unlock()
+		return
+	}
+
+	if !in.backup {
+		if now.Sub(sw.lastPrimary) > sw.opts.Timeout {
+			sw.primarySince = now
+		}
+		sw.lastPrimary = now
+	}
+
+	switched := false
+	if in.backup != sw.onBackup && sw.canSwitch(frame) {
+		if in.backup && now.Sub(sw.lastPrimary) > sw.opts.Timeout {
+			sw.onBackup, switched = true, true
+		} else if !in.backup && now.Sub(sw.primarySince) >= sw.opts.Recover {
+			sw.onBackup, switched = false, true
+		}
+	}
+
+	forward := in.backup == sw.onBackup
+	sw.lock.Unlock()
+
+	if switched {
+		// the destinations learn the codecs of the input they get from now on
+		sw.FrameSource.DeliverMetaData(*in.Metadata())
+		if sw.opts.OnSwitch != nil {
+			sw.opts.OnSwitch(in.backup)
+		}
+	}
+
+	if forward {
+		sw.FrameSource.DeliverFrame(frame, attr)
+	}
+}
+
+// canSwitch is true on frames a destination can start from.
+func (sw *Switcher) canSwitch(frame Frame) bool {
+	if !sw.FrameSource.Metadata().HasVideo() {
+		return true
+	}
+
+	if !frame.Codec.IsVideo() {
+		return false
+	}
+
+	info, ok := frame.AdditionalInfo.(*VideoFrameSpecificInfo)
+	return ok && info.IsKeyFrame
+}
+
+type switchInput struct {
+	FrameDestination
+	sw     *Switcher
+	backup bool
+}
+
+func (in *switchInput) OnFrame(frame Frame, attr Attributes) {
+	in.sw.onFrame(in, frame, attr)
+}
+
+// OnMetaData passes the metadata of the input forwarded on.
+func (in *switchInput) OnMetaData(metadata *Metadata) {
+	in.FrameDestination.OnMetaData(metadata)
+
+	in.sw.lock.Lock()
+	active := (in == in.sw.primary || in == in.sw.backup) && in.backup == in.sw.onBackup
+	in.sw.lock.Unlock()
+
+	if active {
+		in.sw.FrameSource.DeliverMetaData(*metadata)
+	}
+}
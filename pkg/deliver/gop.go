@@ -0,0 +1,85 @@
+package deliver
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingostack/neon/pkg/clock"
+)
+
+const (
+	minGOPCheck = 100 * time.Millisecond
+	maxGOPCheck = time.Second
+)
+
+type GOPOptions struct {
+	// MaxInterval is the longest time between two keyframes of the source.
+	MaxInterval time.Duration
+	// Request is the feedback asking the publisher for a keyframe once
+	// MaxInterval passed without, FeedbackCmdPLI or FeedbackCmdFIR, repeated
+	// every MaxInterval until one comes. Zero only warns.
+	Request FeedbackCmd
+	// OnExceeded is called once per group of pictures longer than
+	// MaxInterval, with the time since its keyframe.
+	OnExceeded func(interval time.Duration)
+	// Clock ticks the checks, clock.Default() when nil. It must be the one
+	// the stats of the source are stamped with.
+	Clock clock.Clock
+}
+
+// WatchGOP watches the keyframe interval of the video of source until ctx is
+// done. Long groups of pictures break the segmenting of hls and keep viewers
+// joining waiting for a keyframe.
+func WatchGOP(ctx context.Context, source FrameSource, opts GOPOptions) {
+	if opts.MaxInterval <= 0 {
+		return
+	}
+
+	check := opts.MaxInterval / 4
+	if check < minGOPCheck {
+		check = minGOPCheck
+	} else if check > maxGOPCheck {
+		check = maxGOPCheck
+	}
+
+	c := clock.Or(opts.Clock)
+	go func() {
+		ticker := c.NewTicker(check)
+		defer ticker.Stop()
+
+		var warned, requested time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if md := source.Metadata(); md == nil || !md.HasVideo() {
+					continue
+				}
+
+				stats := source.Stats()
+				last := stats.LastKeyframeAt
+				if last.IsZero() {
+					last = stats.StartedAt
+				}
+
+				interval := now.Sub(last)
+				if interval <= opts.MaxInterval {
+					continue
+				}
+
+				if !warned.Equal(last) {
+					warned = last
+					if opts.OnExceeded != nil {
+						opts.OnExceeded(interval)
+					}
+				}
+
+				if opts.Request != FeedbackCmdUnknown && now.Sub(requested) >= opts.MaxInterval {
+					requested = now
+					source.OnFeedback(FeedbackMsg{Type: FeedbackTypeVideo, Cmd: opts.Request})
+				}
+			}
+		}
+	}()
+}
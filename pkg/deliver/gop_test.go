@@ -0,0 +1,92 @@
+package deliver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pingostack/neon/pkg/clock"
+)
+
+// checkedSource tells when WatchGOP checks it, so the clock is only moved
+// once the previous tick was read.
+type checkedSource struct {
+	FrameSource
+	checked chan struct{}
+}
+
+func (s *checkedSource) Metadata() *Metadata {
+	s.checked <- struct{}{}
+	return s.FrameSource.Metadata()
+}
+
+func TestWatchGOPOnVirtualClock(t *testing.T) {
+	v := clock.NewVirtual(time.Unix(0, 0))
+	clock.SetDefault(v)
+	defer clock.SetDefault(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := &checkedSource{
+		FrameSource: NewFrameSourceImpl(ctx, Metadata{Video: &VideoMetadata{CodecType: CodecTypeH264}}),
+		checked:     make(chan struct{}),
+	}
+
+	exceeded := make(chan time.Duration, 1)
+	WatchGOP(ctx, src, GOPOptions{
+		MaxInterval: time.Second,
+		OnExceeded: func(interval time.Duration) {
+			exceeded <- interval
+		},
+	})
+	v.BlockUntil(1)
+
+	keyframe := func(ts uint32) {
+		src.DeliverFrame(Frame{
+			Codec:          CodecTypeH264,
+			Payload:        []byte{0x65},
+			TimeStamp:      ts,
+			AdditionalInfo: &VideoFrameSpecificInfo{IsKeyFrame: true},
+		}, nil)
+	}
+
+	// checks every quarter of the max interval
+	tick := func() {
+		v.Add(250 * time.Millisecond)
+		<-src.checked
+	}
+
+	keyframe(0)
+	for i := 0; i < 4; i++ {
+		tick()
+	}
+
+	tick()
+	select {
+	case interval := <-exceeded:
+		if interval != 1250*time.Millisecond {
+			t.Fatalf("interval = %v, want 1.25s", interval)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("long group of pictures not reported")
+	}
+
+	// once per group of pictures
+	tick()
+	tick()
+
+	keyframe(90000 * 2)
+	for i := 0; i < 3; i++ {
+		tick()
+	}
+
+	// a keyframe each max interval is fine, once this check is read the
+	// ones before have reported
+	tick()
+	select {
+	case interval := <-exceeded:
+		t.Fatalf("reported %v twice or for a short group of pictures", interval)
+	default:
+	}
+}
@@ -0,0 +1,135 @@
+package deliver
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/pingostack/neon/pkg/clock"
+)
+
+const (
+	defaultHealthInterval = 2 * time.Second
+	defaultHealthWindow   = 30
+)
+
+type HealthOptions struct {
+	// Interval is how often the source is sampled, 2s when zero.
+	Interval time.Duration
+	// Window is the number of samples the score is computed over, 30 when
+	// zero.
+	Window int
+	// OnSample is called with the score after every sample.
+	OnSample func(h Health)
+	// Clock ticks the samples, clock.Default() when nil.
+	Clock clock.Clock
+}
+
+// Health scores a publisher over the last window of samples, 100 being
+// flawless. Each of loss, bitrate volatility, timestamp anomalies and decode
+// errors takes off up to its share of the score.
+type Health struct {
+	Score        float64 `json:"score"`
+	FractionLost float64 `json:"fractionLost"`
+	// Volatility is the standard deviation of the bitrate over its mean, 1
+	// for a stalled source.
+	Volatility         float64 `json:"volatility"`
+	TimestampAnomalies uint64  `json:"timestampAnomalies"`
+	DecodeErrors       uint64  `json:"decodeErrors"`
+}
+
+type healthSample struct {
+	bitrate      uint64
+	fractionLost float64
+	anomalies    uint64
+	decodeErrors uint64
+}
+
+// WatchHealth samples source until ctx is done.
+func WatchHealth(ctx context.Context, source FrameSource, opts HealthOptions) {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultHealthInterval
+	}
+	if opts.Window <= 1 {
+		opts.Window = defaultHealthWindow
+	}
+
+	c := clock.Or(opts.Clock)
+	go func() {
+		ticker := c.NewTicker(opts.Interval)
+		defer ticker.Stop()
+
+		var samples []healthSample
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			stats := source.Stats()
+			sample := healthSample{
+				bitrate:      stats.Bitrate,
+				anomalies:    stats.TimestampAnomalies,
+				decodeErrors: stats.DecodeErrors,
+			}
+			if ts, ok := source.(EnableTransportStats); ok {
+				sample.fractionLost = ts.TransportStats().FractionLost
+			}
+
+			// the window keeps one sample more, counters are deltas
+			if len(samples) == opts.Window+1 {
+				samples = samples[1:]
+			}
+			samples = append(samples, sample)
+
+			if len(samples) < 2 {
+				continue
+			}
+
+			if opts.OnSample != nil {
+				opts.OnSample(scoreHealth(samples))
+			}
+		}
+	}()
+}
+
+func scoreHealth(samples []healthSample) Health {
+	first, last := samples[0], samples[len(samples)-1]
+	h := Health{
+		TimestampAnomalies: last.anomalies - first.anomalies,
+		DecodeErrors:       last.decodeErrors - first.decodeErrors,
+	}
+
+	var sum, sumSquares float64
+	for _, s := range samples[1:] {
+		h.FractionLost += s.fractionLost
+		sum += float64(s.bitrate)
+		sumSquares += float64(s.bitrate) * float64(s.bitrate)
+	}
+
+	n := float64(len(samples) - 1)
+	h.FractionLost /= n
+	mean := sum / n
+	if mean > 0 {
+		h.Volatility = math.Sqrt(math.Max(sumSquares/n-mean*mean, 0)) / mean
+	} else {
+		h.Volatility = 1
+	}
+
+	h.Score = 100 -
+		penalty(h.FractionLost*400, 40) -
+		penalty(h.Volatility*50, 25) -
+		penalty(float64(h.TimestampAnomalies)*5, 20) -
+		penalty(float64(h.DecodeErrors), 15)
+
+	return h
+}
+
+func penalty(v, limit float64) float64 {
+	if v > limit {
+		return limit
+	}
+
+	return v
+}
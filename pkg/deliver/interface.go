@@ -15,6 +15,12 @@ type FrameDestinationReceiver interface {
 	OnMetaData(metadata *Metadata)
 }
 
+// FrameGapReceiver is implemented by destinations that want to know when they
+// fell behind the source and frames were skipped.
+type FrameGapReceiver interface {
+	OnFrameGap(lost uint64)
+}
+
 type FrameDestinationDeliver interface {
 	DeliverFeedback(fb FeedbackMsg) error
 	OnSource(src FrameSource) error
@@ -59,6 +65,7 @@ type FrameSource interface {
 	FrameSourceReceiver
 	EnableClose
 	EnableMetaData
+	EnableStats
 	FrameFormat
 }
 
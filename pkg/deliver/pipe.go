@@ -17,13 +17,19 @@ type MediaFramePipeImpl struct {
 }
 
 func NewMediaFramePipe(ctx context.Context, fmtSettings FormatSettings) MediaFramePipe {
+	return NewFanoutMediaFramePipe(ctx, fmtSettings, FanoutOptions{})
+}
+
+// NewFanoutMediaFramePipe is a pipe feeding its destinations with opts, see
+// NewFanoutFrameSource.
+func NewFanoutMediaFramePipe(ctx context.Context, fmtSettings FormatSettings, opts FanoutOptions) MediaFramePipe {
 	m := &MediaFramePipeImpl{
 		id: guid.S(),
 	}
 
 	m.ctx, m.cancel = context.WithCancel(ctx)
 	m.FrameDestination = NewFrameDestinationImpl(m.ctx, fmtSettings)
-	m.FrameSource = NewFrameSourceImpl(m.ctx, Metadata{})
+	m.FrameSource = NewFanoutFrameSource(m.ctx, Metadata{}, opts)
 
 	return m
 }
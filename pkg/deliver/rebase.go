@@ -0,0 +1,206 @@
+package deliver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+const (
+	defaultRebaseMaxJump  = time.Second
+	defaultRebaseMaxDrift = 500 * time.Millisecond
+	defaultRebaseMaxSync  = 20 * time.Millisecond
+	videoClockRate        = 90000
+	// drift is corrected by at most 1/rebaseSlew of every step
+	rebaseSlew = 100
+)
+
+type RebaserOptions struct {
+	// Epoch is the origin of the hub clock, shared by the rebasers of a
+	// stream.
+	Epoch time.Time
+	// MaxJump is how far the clock of a publisher may run from the wall clock
+	// between two frames before it is taken as a jump.
+	MaxJump time.Duration
+	// MaxDrift is how far a track may run from the hub clock before it is
+	// slewed back.
+	MaxDrift time.Duration
+	// MaxSync replaces MaxDrift for frames stamped with the wall clock of
+	// the publisher, it bounds how far audio and video get apart.
+	MaxSync time.Duration
+}
+
+// Rebaser maps the rtp clock of the publishers of a stream to the hub clock,
+// the time since Epoch in the clock rate of each track. When the clock of a
+// publisher jumps, e.g. a camera rebooted or another publisher took over, the
+// timeline continues after its last timestamp. Drift against the hub clock is
+// slewed back a little every frame, so the timeline never steps back for it.
+// Frames reordered by the publisher, e.g. B-frames, keep their offset.
+//
+// Frames stamped with the wall clock of the publisher, see Frame.NTPTime, are
+// slewed to it instead, which keeps audio and video in sync however long the
+// publisher sends.
+type Rebaser struct {
+	opts  RebaserOptions
+	lock  sync.Mutex
+	audio rebaseTrack
+	video rebaseTrack
+	sync  senderSync
+}
+
+// senderSync ties the wall clock of the publisher to the hub clock, at the
+// first frame stamped with it.
+type senderSync struct {
+	set    bool
+	sender time.Time
+	hub    time.Duration
+}
+
+// at returns the hub clock of the publisher wall clock t.
+func (s *senderSync) at(t, now, epoch time.Time) time.Duration {
+	if !s.set {
+		s.set, s.sender, s.hub = true, t, now.Sub(epoch)
+	}
+
+	return s.hub + t.Sub(s.sender)
+}
+
+type rebaseTrack struct {
+	rate     int64
+	started  bool
+	lastIn   uint32
+	lastOut  int64
+	lastWall time.Time
+}
+
+func NewRebaser(opts RebaserOptions) *Rebaser {
+	if opts.Epoch.IsZero() {
+		opts.Epoch = time.Now()
+	}
+
+	if opts.MaxJump <= 0 {
+		opts.MaxJump = defaultRebaseMaxJump
+	}
+
+	if opts.MaxDrift <= 0 {
+		opts.MaxDrift = defaultRebaseMaxDrift
+	}
+
+	if opts.MaxSync <= 0 {
+		opts.MaxSync = defaultRebaseMaxSync
+	}
+
+	return &Rebaser{
+		opts:  opts,
+		video: rebaseTrack{rate: videoClockRate},
+	}
+}
+
+// SetAudioRate sets the clock of audio, the sample rate of the metadata of
+// the source.
+func (rb *Rebaser) SetAudioRate(rate uint32) {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	if int64(rate) != rb.audio.rate {
+		rb.audio = rebaseTrack{rate: int64(rate)}
+	}
+}
+
+// Rebase returns frame stamped on the hub clock. An rtp packet is copied
+// rather than rewritten, other formats of the stream share it.
+func (rb *Rebaser) Rebase(frame Frame) Frame {
+	return rb.rebase(frame, time.Now())
+}
+
+func (rb *Rebaser) rebase(frame Frame, now time.Time) Frame {
+	track := &rb.video
+	if frame.Codec.IsAudio() {
+		track = &rb.audio
+	} else if !frame.Codec.IsVideo() {
+		return frame
+	}
+
+	rb.lock.Lock()
+	if track.rate == 0 {
+		rb.lock.Unlock()
+		return frame
+	}
+
+	hub, tolerance := now.Sub(rb.opts.Epoch), rb.opts.MaxDrift
+	if !frame.NTPTime.IsZero() {
+		tolerance = rb.opts.MaxSync
+		at := rb.sync.at(frame.NTPTime, now, rb.opts.Epoch)
+		if d := at - hub; d > rb.opts.MaxJump || d < -rb.opts.MaxJump {
+			// another publisher or its wall clock was stepped
+			rb.sync.set = false
+			at = rb.sync.at(frame.NTPTime, now, rb.opts.Epoch)
+		}
+		hub = at
+	}
+	ts := track.rebase(frame.TimeStamp, now, ticks(hub, track.rate), tolerance, rb.opts)
+	rb.lock.Unlock()
+
+	frame.TimeStamp = ts
+	if p, ok := frame.RawPacket.(*rtp.Packet); ok {
+		packet := *p
+		packet.Timestamp = ts
+		frame.RawPacket = &packet
+	}
+
+	return frame
+}
+
+// ticks converts d to the clock of rate without overflowing on long
+// durations.
+func ticks(d time.Duration, rate int64) int64 {
+	return int64(d/time.Second)*rate + int64(d%time.Second)*rate/int64(time.Second)
+}
+
+// rebase stamps timestamp in on the timeline of the track, hub is where
+// the frame belongs on the hub clock, give or take tolerance.
+func (t *rebaseTrack) rebase(in uint32, now time.Time, hub int64, tolerance time.Duration, opts RebaserOptions) uint32 {
+	if !t.started {
+		t.started, t.lastIn, t.lastOut, t.lastWall = true, in, hub, now
+		return uint32(hub)
+	}
+
+	step := int64(int32(in - t.lastIn))
+	wall := ticks(now.Sub(t.lastWall), t.rate)
+	maxJump := ticks(opts.MaxJump, t.rate)
+	maxDrift := ticks(tolerance, t.rate)
+
+	switch {
+	case step > wall+maxJump || step < -maxJump:
+		// the publisher clock jumped, the timeline goes on at the pace of
+		// the wall clock
+		step = wall
+		if step < 1 {
+			step = 1
+		}
+	case step > 0:
+		drift := t.lastOut + step - hub
+		slew := step / rebaseSlew
+		if drift > maxDrift {
+			step -= minInt64(slew, drift-maxDrift)
+		} else if drift < -maxDrift {
+			step += minInt64(slew, -maxDrift-drift)
+		}
+	}
+
+	t.lastIn, t.lastOut = in, t.lastOut+step
+	if step != 0 {
+		t.lastWall = now
+	}
+
+	return uint32(t.lastOut)
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,216 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const defaultDialTimeout = 5 * time.Second
+
+// Client pulls streams from other nodes, all streams of one node share a
+// single connection.
+type Client struct {
+	ctx         context.Context
+	token       string
+	dialTimeout time.Duration
+	conns       map[string]*clientConn
+	lock        sync.Mutex
+	logger      *logrus.Entry
+}
+
+func NewClient(ctx context.Context, token string, dialTimeout time.Duration, logger *logrus.Entry) *Client {
+	if dialTimeout <= 0 {
+		dialTimeout = defaultDialTimeout
+	}
+
+	if logger == nil {
+		logger = logrus.WithField("obj", "relay-client")
+	} else {
+		logger = logger.WithField("obj", "relay-client")
+	}
+
+	return &Client{
+		ctx:         ctx,
+		token:       token,
+		dialTimeout: dialTimeout,
+		conns:       make(map[string]*clientConn),
+		logger:      logger,
+	}
+}
+
+// Subscribe opens a channel for stream of namespace on the node at addr and
+// returns once the stream metadata arrived.
+func (c *Client) Subscribe(ctx context.Context, addr, namespace, stream string) (*FrameSource, error) {
+	cc, err := c.conn(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := cc.open(ctx, Subscribe{
+		Namespace: namespace,
+		Stream:    stream,
+		Token:     c.token,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-src.ready:
+		return src, nil
+	case <-src.Context().Done():
+		if err := src.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrChannelClosed
+	case <-ctx.Done():
+		src.Close()
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Client) conn(ctx context.Context, addr string) (*clientConn, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if cc, ok := c.conns[addr]; ok && cc.ctx.Err() == nil {
+		return cc, nil
+	}
+
+	dialer := net.Dialer{Timeout: c.dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	cc := &clientConn{
+		Conn:     NewConn(conn),
+		channels: make(map[uint32]*FrameSource),
+		logger:   c.logger.WithField("addr", addr),
+	}
+	cc.ctx, cc.cancel = context.WithCancel(c.ctx)
+	c.conns[addr] = cc
+
+	go cc.loop()
+	go func() {
+		<-cc.ctx.Done()
+		c.lock.Lock()
+		if c.conns[addr] == cc {
+			delete(c.conns, addr)
+		}
+		c.lock.Unlock()
+	}()
+
+	c.logger.WithField("addr", addr).Info("relay connection opened")
+
+	return cc, nil
+}
+
+type clientConn struct {
+	*Conn
+	ctx      context.Context
+	cancel   context.CancelFunc
+	channels map[uint32]*FrameSource
+	next     uint32
+	lock     sync.Mutex
+	logger   *logrus.Entry
+}
+
+func (cc *clientConn) open(ctx context.Context, sub Subscribe) (*FrameSource, error) {
+	cc.lock.Lock()
+	cc.next++
+	src := newFrameSource(ctx, cc, cc.next, cc.logger)
+	cc.channels[src.channel] = src
+	cc.lock.Unlock()
+
+	err := cc.WriteMessage(&Message{
+		Channel:   src.channel,
+		Type:      MessageSubscribe,
+		Subscribe: sub,
+	})
+	if err != nil {
+		src.closeWith(err)
+		cc.cancel()
+		return nil, err
+	}
+
+	// a source closed by its session tells the remote node
+	go func() {
+		<-src.Context().Done()
+		src.Close()
+	}()
+
+	return src, nil
+}
+
+func (cc *clientConn) remove(channel uint32) {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	delete(cc.channels, channel)
+}
+
+func (cc *clientConn) channel(id uint32) *FrameSource {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	return cc.channels[id]
+}
+
+func (cc *clientConn) loop() {
+	defer func() {
+		cc.cancel()
+		cc.Close()
+
+		cc.lock.Lock()
+		channels := cc.channels
+		cc.channels = make(map[uint32]*FrameSource)
+		cc.lock.Unlock()
+
+		for _, src := range channels {
+			src.closeWith(ErrConnClosed)
+		}
+	}()
+
+	go func() {
+		<-cc.ctx.Done()
+		cc.Close()
+	}()
+
+	var m Message
+	for {
+		buf, err := cc.ReadMessage(&m)
+		if err != nil {
+			if cc.ctx.Err() == nil {
+				cc.logger.WithError(err).Warn("relay connection lost")
+			}
+			return
+		}
+
+		src := cc.channel(m.Channel)
+		if src == nil {
+			buf.Release()
+			continue
+		}
+
+		switch m.Type {
+		case MessageMetadata:
+			src.onMetadata(m.Metadata)
+		case MessageFrame:
+			src.onFrame(m.Frame, buf)
+		case MessageClose:
+			reason := ErrChannelClosed
+			if m.Reason != "" {
+				reason = fmt.Errorf("%w: %s", ErrChannelClosed, m.Reason)
+			}
+			src.closeWith(reason)
+		}
+
+		buf.Release()
+	}
+}
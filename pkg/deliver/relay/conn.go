@@ -0,0 +1,150 @@
+// Package relay carries streams between nodes. All streams of a pair of nodes
+// share one tcp connection as channels of the Envelope messages of
+// relay.proto, each written after its varint length.
+//
+// It is not a grpc service although the auth callouts of pkg/auth speak grpc.
+// Those are unary calls over an http/2 client, the tree has no http/2 server
+// to accept long lived streams, and the frames gain nothing from http/2 on a
+// single connection but its framing and flow control. The messages are
+// those of relay.proto, a grpc service can carry them should one be needed.
+package relay
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/pingostack/neon/pkg/bufpool"
+	"github.com/pkg/errors"
+)
+
+// Protocol names relay sessions in stats.
+const Protocol = "relay"
+
+const (
+	maxMessageSize  = 4 * 1024 * 1024
+	writeBufferSize = 64 * 1024
+)
+
+// Conn carries relay messages, each prefixed with its varint length. Writes
+// are serialized, messages of different channels interleave frame by frame.
+type Conn struct {
+	conn  net.Conn
+	r     *bufio.Reader
+	w     *bufio.Writer
+	wlock sync.Mutex
+	wbuf  []byte
+	// frames that fit datagramSize go to datagram, see SetDatagramWriter
+	datagram     func(b []byte) error
+	datagramSize int
+}
+
+func NewConn(conn net.Conn) *Conn {
+	return &Conn{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    bufio.NewWriterSize(conn, writeBufferSize),
+	}
+}
+
+func (c *Conn) WriteMessage(m *Message) error {
+	var payload []byte
+	if m.Type == MessageFrame {
+		p, buf, err := framePayload(&m.Frame)
+		if err != nil {
+			return err
+		}
+
+		if buf != nil {
+			defer buf.Release()
+		}
+		payload = p
+	}
+
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+
+	c.wbuf = appendEnvelope(c.wbuf[:0], m, payload)
+
+	// a failed datagram, e.g. the path mtu shrunk, takes the connection
+	if m.Type == MessageFrame && c.datagram != nil && len(c.wbuf) <= c.datagramSize {
+		if c.datagram(c.wbuf) == nil {
+			return nil
+		}
+	}
+
+	var head [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(head[:], uint64(len(c.wbuf)))
+	if _, err := c.w.Write(head[:n]); err != nil {
+		return err
+	}
+
+	if _, err := c.w.Write(c.wbuf); err != nil {
+		return err
+	}
+
+	return c.w.Flush()
+}
+
+// ReadMessage reads the next message. Frame payloads live in the returned
+// buffer, the caller releases it once the frame is delivered.
+func (c *Conn) ReadMessage(m *Message) (*bufpool.Buffer, error) {
+	size, err := binary.ReadUvarint(c.r)
+	if err != nil {
+		return nil, err
+	}
+
+	if size > maxMessageSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrMessageTooLarge, size)
+	}
+
+	buf := bufpool.Get(int(size))
+	if _, err := io.ReadFull(c.r, buf.Bytes()); err != nil {
+		buf.Release()
+		return nil, err
+	}
+
+	*m = Message{}
+	if err := decodeEnvelope(buf.Bytes(), m); err != nil {
+		buf.Release()
+		return nil, errors.Wrap(err, "invalid message")
+	}
+
+	return buf, nil
+}
+
+// SetDatagramWriter sends the frames whose message fits in size bytes with
+// write instead, unframed, e.g. as unreliable quic datagrams the other side
+// decodes with UnmarshalMessage. write must not keep the bytes.
+func (c *Conn) SetDatagramWriter(size int, write func(b []byte) error) {
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+
+	c.datagram, c.datagramSize = write, size
+}
+
+// UnmarshalMessage decodes a message sent by a datagram writer, frame
+// payloads point into b.
+func UnmarshalMessage(b []byte, m *Message) error {
+	*m = Message{}
+	if err := decodeEnvelope(b, m); err != nil {
+		return errors.Wrap(err, "invalid message")
+	}
+
+	return nil
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
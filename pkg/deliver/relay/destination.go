@@ -0,0 +1,161 @@
+package relay
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/sirupsen/logrus"
+)
+
+// FrameDestination sends a local stream down one channel of a server
+// connection.
+type FrameDestination struct {
+	deliver.FrameDestination
+	conn         *Conn
+	channel      uint32
+	logger       *logrus.Entry
+	lock         sync.Mutex
+	lastMetadata string
+	waitKeyframe bool
+	closeOnce    sync.Once
+	bytesSent    uint64
+}
+
+func NewFrameDestination(ctx context.Context, conn *Conn, channel uint32, logger *logrus.Entry) *FrameDestination {
+	return &FrameDestination{
+		FrameDestination: deliver.NewFrameDestinationImpl(ctx, deliver.FormatSettings{
+			PacketType: deliver.PacketTypeRtp,
+		}),
+		conn:    conn,
+		channel: channel,
+		logger:  logger.WithField("channel", channel),
+	}
+}
+
+func (fd *FrameDestination) OnSource(src deliver.FrameSource) error {
+	if err := fd.FrameDestination.OnSource(src); err != nil {
+		return err
+	}
+
+	fd.sendMetadata(src.Metadata())
+
+	return nil
+}
+
+func (fd *FrameDestination) OnMetaData(metadata *deliver.Metadata) {
+	fd.FrameDestination.OnMetaData(metadata)
+	fd.sendMetadata(metadata)
+}
+
+func (fd *FrameDestination) sendMetadata(metadata *deliver.Metadata) {
+	if !metadata.HasAudio() && !metadata.HasVideo() {
+		return
+	}
+
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	str := metadata.String()
+	if str == fd.lastMetadata {
+		return
+	}
+	fd.lastMetadata = str
+
+	// the remote side resumes on a keyframe
+	fd.waitKeyframe = metadata.HasVideo()
+
+	err := fd.conn.WriteMessage(&Message{
+		Channel:  fd.channel,
+		Type:     MessageMetadata,
+		Metadata: *metadata,
+	})
+	if err != nil {
+		fd.logger.WithError(err).Error("failed to send metadata")
+	}
+}
+
+func (fd *FrameDestination) OnFrame(frame deliver.Frame, attr deliver.Attributes) {
+	if !fd.allow(frame) {
+		return
+	}
+
+	err := fd.conn.WriteMessage(&Message{
+		Channel: fd.channel,
+		Type:    MessageFrame,
+		Frame:   frame,
+	})
+	if err != nil {
+		fd.logger.WithError(err).Error("failed to send frame")
+		fd.CloseRemote()
+		return
+	}
+
+	atomic.AddUint64(&fd.bytesSent, uint64(frame.Length))
+}
+
+func (fd *FrameDestination) TransportStats() deliver.TransportStats {
+	return deliver.TransportStats{
+		Protocol:  Protocol,
+		BytesSent: atomic.LoadUint64(&fd.bytesSent),
+	}
+}
+
+// allow drops video until the next keyframe after a gap, audio always passes.
+func (fd *FrameDestination) allow(frame deliver.Frame) bool {
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	if !fd.waitKeyframe || !frame.Codec.IsVideo() {
+		return true
+	}
+
+	info, ok := frame.AdditionalInfo.(*deliver.VideoFrameSpecificInfo)
+	if !ok || !info.IsKeyFrame {
+		return false
+	}
+
+	fd.waitKeyframe = false
+
+	return true
+}
+
+// OnFrameGap is called when the connection fell behind the stream.
+func (fd *FrameDestination) OnFrameGap(lost uint64) {
+	fd.logger.WithField("lost", lost).Warn("relay fell behind, waiting for keyframe")
+
+	fd.lock.Lock()
+	fd.waitKeyframe = fd.Metadata().HasVideo()
+	fd.lock.Unlock()
+
+	fd.DeliverFeedback(deliver.FeedbackMsg{
+		Type: deliver.FeedbackTypeVideo,
+		Cmd:  deliver.FeedbackCmdPLI,
+	})
+}
+
+// Close ends the channel and tells the remote node.
+func (fd *FrameDestination) Close() {
+	fd.CloseWith("")
+}
+
+// CloseWith ends the channel, the remote node is told reason.
+func (fd *FrameDestination) CloseWith(reason string) {
+	fd.closeOnce.Do(func() {
+		fd.conn.WriteMessage(&Message{
+			Channel: fd.channel,
+			Type:    MessageClose,
+			Reason:  reason,
+		})
+		fd.FrameDestination.Close()
+	})
+}
+
+// CloseRemote ends a channel without telling the remote node, it closed the
+// channel or can't be reached.
+func (fd *FrameDestination) CloseRemote() {
+	fd.closeOnce.Do(func() {
+		fd.FrameDestination.Close()
+	})
+}
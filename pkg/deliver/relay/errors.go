@@ -0,0 +1,13 @@
+package relay
+
+import "errors"
+
+var (
+	ErrUnknownMessage     = errors.New("unknown relay message")
+	ErrMessageTooLarge    = errors.New("relay message too large")
+	ErrUnauthorized       = errors.New("relay unauthorized")
+	ErrChannelClosed      = errors.New("relay channel closed")
+	ErrConnClosed         = errors.New("relay connection closed")
+	ErrInvalidURL         = errors.New("invalid relay url")
+	ErrPublishUnsupported = errors.New("relay publish unsupported")
+)
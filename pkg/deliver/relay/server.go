@@ -0,0 +1,152 @@
+package relay
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Handler attaches dest to the stream sub asks for. dest is closed, and the
+// remote node told, when it returns an error.
+type Handler func(ctx context.Context, conn *Conn, sub Subscribe, dest *FrameDestination) error
+
+// Server serves the streams of this node to other nodes, to the ones sending
+// its token. Without a token it serves none.
+type Server struct {
+	ctx     context.Context
+	token   string
+	handler Handler
+	logger  *logrus.Entry
+}
+
+func NewServer(ctx context.Context, token string, handler Handler, logger *logrus.Entry) *Server {
+	if logger == nil {
+		logger = logrus.WithField("obj", "relay-server")
+	} else {
+		logger = logger.WithField("obj", "relay-server")
+	}
+
+	return &Server{
+		ctx:     ctx,
+		token:   token,
+		handler: handler,
+		logger:  logger,
+	}
+}
+
+// Serve accepts connections on ln until it fails or the server context is
+// done.
+func (s *Server) Serve(ln net.Listener) error {
+	go func() {
+		<-s.ctx.Done()
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		go s.serveConn(NewConn(conn))
+	}
+}
+
+func (s *Server) serveConn(conn *Conn) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	logger := s.logger.WithField("remote", conn.RemoteAddr().String())
+	channels := make(map[uint32]*FrameDestination)
+	lock := sync.Mutex{}
+
+	defer func() {
+		cancel()
+		conn.Close()
+
+		lock.Lock()
+		defer lock.Unlock()
+		for _, dest := range channels {
+			dest.CloseRemote()
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	logger.Info("relay connection accepted")
+
+	var m Message
+	for {
+		buf, err := conn.ReadMessage(&m)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.WithError(err).Info("relay connection closed")
+			}
+			return
+		}
+		buf.Release()
+
+		lock.Lock()
+		dest := channels[m.Channel]
+		lock.Unlock()
+
+		switch m.Type {
+		case MessageSubscribe:
+			if dest != nil {
+				continue
+			}
+
+			dest = NewFrameDestination(ctx, conn, m.Channel, logger)
+			if !s.authorized(m.Subscribe.Token) {
+				logger.WithField("stream", m.Subscribe.Stream).Warn("relay subscribe unauthorized")
+				dest.CloseWith(ErrUnauthorized.Error())
+				continue
+			}
+
+			lock.Lock()
+			channels[m.Channel] = dest
+			lock.Unlock()
+
+			go func(dest *FrameDestination) {
+				<-dest.Context().Done()
+				lock.Lock()
+				if channels[dest.channel] == dest {
+					delete(channels, dest.channel)
+				}
+				lock.Unlock()
+			}(dest)
+
+			go func(sub Subscribe, dest *FrameDestination) {
+				if err := s.handler(ctx, conn, sub, dest); err != nil {
+					logger.WithError(err).WithField("stream", sub.Stream).Warn("relay subscribe failed")
+					dest.CloseWith(err.Error())
+				}
+			}(m.Subscribe, dest)
+		case MessagePublish:
+			conn.WriteMessage(&Message{
+				Channel: m.Channel,
+				Type:    MessageClose,
+				Reason:  ErrPublishUnsupported.Error(),
+			})
+		case MessageFeedback:
+			if dest != nil {
+				dest.DeliverFeedback(m.Feedback)
+			}
+		case MessageClose:
+			if dest != nil {
+				dest.CloseRemote()
+			}
+		}
+	}
+}
+
+func (s *Server) authorized(token string) bool {
+	return s.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
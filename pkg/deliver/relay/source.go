@@ -0,0 +1,102 @@
+package relay
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pingostack/neon/pkg/bufpool"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/sirupsen/logrus"
+)
+
+// FrameSource is one channel of a client connection, the stream of another
+// node republished locally.
+type FrameSource struct {
+	deliver.FrameSource
+	cc        *clientConn
+	channel   uint32
+	logger    *logrus.Entry
+	ready     chan struct{}
+	readyOnce sync.Once
+	closeOnce sync.Once
+	lock      sync.Mutex
+	err       error
+	bytes     uint64
+}
+
+func newFrameSource(ctx context.Context, cc *clientConn, channel uint32, logger *logrus.Entry) *FrameSource {
+	return &FrameSource{
+		FrameSource: deliver.NewFrameSourceImpl(ctx, deliver.Metadata{}),
+		cc:          cc,
+		channel:     channel,
+		logger:      logger.WithField("channel", channel),
+		ready:       make(chan struct{}),
+	}
+}
+
+func (fs *FrameSource) onMetadata(md deliver.Metadata) {
+	fs.FrameSource.DeliverMetaData(md)
+	fs.readyOnce.Do(func() {
+		close(fs.ready)
+	})
+}
+
+func (fs *FrameSource) onFrame(frame deliver.Frame, buf *bufpool.Buffer) {
+	frame.Buffer = buf
+	atomic.AddUint64(&fs.bytes, uint64(frame.Length))
+	fs.FrameSource.DeliverFrame(frame, nil)
+}
+
+func (fs *FrameSource) TransportStats() deliver.TransportStats {
+	return deliver.TransportStats{
+		Protocol:      Protocol,
+		BytesReceived: atomic.LoadUint64(&fs.bytes),
+	}
+}
+
+// OnFeedback is sent upstream, e.g. keyframe requests of local subscribers.
+func (fs *FrameSource) OnFeedback(fb deliver.FeedbackMsg) {
+	err := fs.cc.WriteMessage(&Message{
+		Channel:  fs.channel,
+		Type:     MessageFeedback,
+		Feedback: fb,
+	})
+	if err != nil {
+		fs.logger.WithError(err).Debug("failed to send feedback")
+	}
+}
+
+// Err tells why the channel was closed.
+func (fs *FrameSource) Err() error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	return fs.err
+}
+
+func (fs *FrameSource) closeWith(err error) {
+	fs.closeOnce.Do(func() {
+		fs.lock.Lock()
+		fs.err = err
+		fs.lock.Unlock()
+
+		fs.cc.remove(fs.channel)
+		fs.FrameSource.Close()
+	})
+}
+
+func (fs *FrameSource) Close() {
+	fs.closeOnce.Do(func() {
+		fs.lock.Lock()
+		fs.err = ErrChannelClosed
+		fs.lock.Unlock()
+
+		fs.cc.WriteMessage(&Message{
+			Channel: fs.channel,
+			Type:    MessageClose,
+		})
+		fs.cc.remove(fs.channel)
+		fs.FrameSource.Close()
+	})
+}
@@ -0,0 +1,392 @@
+package relay
+
+import (
+	"github.com/pingostack/neon/pkg/bufpool"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pion/rtp"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type MessageType int
+
+const (
+	MessageUnknown MessageType = 0 + iota
+	MessageSubscribe
+	MessageMetadata
+	MessageFrame
+	MessageClose
+	MessageFeedback
+	MessagePublish
+)
+
+// field numbers of relay.proto
+const (
+	fieldChannel protowire.Number = 1
+	fieldPublish protowire.Number = 7
+)
+
+type Subscribe struct {
+	Namespace string
+	Stream    string
+	Token     string
+}
+
+// Publish opens a channel that pushes a stream to the receiving side, the
+// relay server itself only serves subscribes.
+type Publish struct {
+	Namespace string
+	Stream    string
+	Token     string
+}
+
+// Message is a decoded Envelope, only the field of Type is set.
+type Message struct {
+	Channel   uint32
+	Type      MessageType
+	Subscribe Subscribe
+	Publish   Publish
+	Metadata  deliver.Metadata
+	Frame     deliver.Frame
+	Feedback  deliver.FeedbackMsg
+	Reason    string
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	return appendVarint(b, num, protowire.EncodeBool(v))
+}
+
+func appendMessage(b []byte, num protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
+
+// appendEnvelope encodes m, frames carry their payload, see framePayload.
+func appendEnvelope(b []byte, m *Message, payload []byte) []byte {
+	b = appendVarint(b, fieldChannel, uint64(m.Channel))
+
+	var body []byte
+	switch m.Type {
+	case MessageSubscribe:
+		body = appendString(body, 1, m.Subscribe.Namespace)
+		body = appendString(body, 2, m.Subscribe.Stream)
+		body = appendString(body, 3, m.Subscribe.Token)
+	case MessageMetadata:
+		body = appendMetadata(body, &m.Metadata)
+	case MessageFrame:
+		body = appendFrame(body, &m.Frame, payload)
+	case MessageClose:
+		body = appendString(body, 1, m.Reason)
+	case MessageFeedback:
+		body = appendVarint(body, 1, uint64(m.Feedback.Type))
+		body = appendVarint(body, 2, uint64(m.Feedback.Cmd))
+	case MessagePublish:
+		body = appendString(body, 1, m.Publish.Namespace)
+		body = appendString(body, 2, m.Publish.Stream)
+		body = appendString(body, 3, m.Publish.Token)
+	}
+
+	// the body number follows the message type, see Envelope
+	return appendMessage(b, protowire.Number(m.Type)+fieldChannel, body)
+}
+
+func appendMetadata(b []byte, md *deliver.Metadata) []byte {
+	b = appendVarint(b, 1, uint64(md.PacketType))
+
+	if md.Audio != nil {
+		var audio []byte
+		audio = appendString(audio, 1, md.Audio.Codec)
+		audio = appendVarint(audio, 2, uint64(md.Audio.CodecType))
+		audio = appendVarint(audio, 3, uint64(md.Audio.SampleRate))
+		audio = appendVarint(audio, 4, uint64(md.Audio.Channels))
+		audio = appendVarint(audio, 5, uint64(md.Audio.RtpPayloadType))
+		b = appendMessage(b, 2, audio)
+	}
+
+	if md.Video != nil {
+		var video []byte
+		video = appendString(video, 1, md.Video.Codec)
+		video = appendVarint(video, 2, uint64(md.Video.CodecType))
+		video = appendVarint(video, 3, uint64(md.Video.Width))
+		video = appendVarint(video, 4, uint64(md.Video.Height))
+		video = appendVarint(video, 5, uint64(md.Video.FPS))
+		video = appendVarint(video, 6, uint64(md.Video.RtpPayloadType))
+		video = appendVarint(video, 7, uint64(md.Video.ClockRate))
+		b = appendMessage(b, 3, video)
+	}
+
+	return b
+}
+
+func appendFrame(b []byte, frame *deliver.Frame, payload []byte) []byte {
+	b = appendVarint(b, 1, uint64(frame.Codec))
+	b = appendVarint(b, 2, uint64(frame.PacketType))
+	b = appendVarint(b, 3, uint64(frame.TimeStamp))
+	b = protowire.AppendTag(b, 4, protowire.BytesType)
+	b = protowire.AppendBytes(b, payload)
+
+	switch info := frame.AdditionalInfo.(type) {
+	case *deliver.VideoFrameSpecificInfo:
+		b = appendBool(b, 5, info.IsKeyFrame)
+		b = appendVarint(b, 6, uint64(info.Width))
+		b = appendVarint(b, 7, uint64(info.Height))
+	case *deliver.AudioFrameSpecificInfo:
+		b = appendVarint(b, 8, uint64(info.SampleRate))
+		b = appendVarint(b, 9, uint64(info.Channels))
+		b = appendVarint(b, 10, uint64(info.NbSamples))
+		b = appendVarint(b, 11, uint64(info.AudioLevel))
+	}
+
+	return b
+}
+
+// framePayload returns the bytes sent for a frame, rtp frames are marshaled
+// into a pooled buffer the caller releases.
+func framePayload(frame *deliver.Frame) ([]byte, *bufpool.Buffer, error) {
+	pkt, ok := frame.RawPacket.(*rtp.Packet)
+	if !ok || frame.PacketType != deliver.PacketTypeRtp {
+		return frame.Payload, nil, nil
+	}
+
+	buf := bufpool.Get(pkt.MarshalSize())
+	n, err := pkt.MarshalTo(buf.Bytes())
+	if err != nil {
+		buf.Release()
+		return nil, nil, errors.Wrap(err, "marshal rtp packet")
+	}
+	buf.SetLen(n)
+
+	return buf.Bytes(), buf, nil
+}
+
+// fields calls f for every field of b, values of unknown wire types are
+// skipped.
+func fields(b []byte, f func(num protowire.Number, typ protowire.Type, v []byte, x uint64)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch typ {
+		case protowire.VarintType:
+			x, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			f(num, typ, nil, x)
+			b = b[n:]
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			f(num, typ, v, 0)
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+
+	return nil
+}
+
+// decodeEnvelope decodes b into m. Frame payloads point into b, rtp frames
+// get their packet parsed into RawPacket.
+func decodeEnvelope(b []byte, m *Message) error {
+	var body []byte
+	err := fields(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) {
+		if num == fieldChannel && typ == protowire.VarintType {
+			m.Channel = uint32(x)
+		} else if num > fieldChannel && num <= fieldPublish && typ == protowire.BytesType {
+			m.Type, body = MessageType(num-fieldChannel), v
+		}
+	})
+	if err != nil {
+		return errors.Wrap(err, "decode envelope")
+	}
+
+	switch m.Type {
+	case MessageSubscribe:
+		err = fields(body, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) {
+			switch num {
+			case 1:
+				m.Subscribe.Namespace = string(v)
+			case 2:
+				m.Subscribe.Stream = string(v)
+			case 3:
+				m.Subscribe.Token = string(v)
+			}
+		})
+	case MessageMetadata:
+		err = decodeMetadata(body, &m.Metadata)
+	case MessageFrame:
+		err = decodeFrame(body, &m.Frame)
+	case MessageClose:
+		err = fields(body, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) {
+			if num == 1 {
+				m.Reason = string(v)
+			}
+		})
+	case MessageFeedback:
+		err = fields(body, func(num protowire.Number, _ protowire.Type, _ []byte, x uint64) {
+			switch num {
+			case 1:
+				m.Feedback.Type = deliver.FeedbackType(x)
+			case 2:
+				m.Feedback.Cmd = deliver.FeedbackCmd(x)
+			}
+		})
+	case MessagePublish:
+		err = fields(body, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) {
+			switch num {
+			case 1:
+				m.Publish.Namespace = string(v)
+			case 2:
+				m.Publish.Stream = string(v)
+			case 3:
+				m.Publish.Token = string(v)
+			}
+		})
+	default:
+		return ErrUnknownMessage
+	}
+
+	return errors.Wrapf(err, "decode message %d", m.Type)
+}
+
+func decodeMetadata(b []byte, md *deliver.Metadata) error {
+	var audio, video []byte
+	err := fields(b, func(num protowire.Number, _ protowire.Type, v []byte, x uint64) {
+		switch num {
+		case 1:
+			md.PacketType = deliver.PacketType(x)
+		case 2:
+			audio = v
+		case 3:
+			video = v
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if audio != nil {
+		md.Audio = &deliver.AudioMetadata{}
+		err = fields(audio, func(num protowire.Number, _ protowire.Type, v []byte, x uint64) {
+			switch num {
+			case 1:
+				md.Audio.Codec = string(v)
+			case 2:
+				md.Audio.CodecType = deliver.CodecType(x)
+			case 3:
+				md.Audio.SampleRate = uint32(x)
+			case 4:
+				md.Audio.Channels = uint8(x)
+			case 5:
+				md.Audio.RtpPayloadType = uint8(x)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if video != nil {
+		md.Video = &deliver.VideoMetadata{}
+		err = fields(video, func(num protowire.Number, _ protowire.Type, v []byte, x uint64) {
+			switch num {
+			case 1:
+				md.Video.Codec = string(v)
+			case 2:
+				md.Video.CodecType = deliver.CodecType(x)
+			case 3:
+				md.Video.Width = int(x)
+			case 4:
+				md.Video.Height = int(x)
+			case 5:
+				md.Video.FPS = int(x)
+			case 6:
+				md.Video.RtpPayloadType = uint8(x)
+			case 7:
+				md.Video.ClockRate = uint32(x)
+			}
+		})
+	}
+
+	return err
+}
+
+func decodeFrame(b []byte, frame *deliver.Frame) error {
+	video := &deliver.VideoFrameSpecificInfo{}
+	audio := &deliver.AudioFrameSpecificInfo{}
+	err := fields(b, func(num protowire.Number, _ protowire.Type, v []byte, x uint64) {
+		switch num {
+		case 1:
+			frame.Codec = deliver.CodecType(x)
+		case 2:
+			frame.PacketType = deliver.PacketType(x)
+		case 3:
+			frame.TimeStamp = uint32(x)
+		case 4:
+			frame.Payload = v
+		case 5:
+			video.IsKeyFrame = x != 0
+		case 6:
+			video.Width = uint16(x)
+		case 7:
+			video.Height = uint16(x)
+		case 8:
+			audio.SampleRate = uint32(x)
+		case 9:
+			audio.Channels = uint8(x)
+		case 10:
+			audio.NbSamples = uint32(x)
+		case 11:
+			audio.AudioLevel = uint8(x)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	frame.Length = len(frame.Payload)
+	if frame.Codec.IsVideo() {
+		frame.AdditionalInfo = video
+	} else if frame.Codec.IsAudio() {
+		frame.AdditionalInfo = audio
+	}
+
+	if frame.PacketType == deliver.PacketTypeRtp {
+		pkt := &rtp.Packet{}
+		if err := pkt.Unmarshal(frame.Payload); err != nil {
+			return errors.Wrap(err, "unmarshal rtp packet")
+		}
+		frame.RawPacket = pkt
+	}
+
+	return nil
+}
@@ -0,0 +1,205 @@
+package deliver
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultRingSize = 1024
+)
+
+// FanoutOptions tune how a source hands its frames to its destinations.
+type FanoutOptions struct {
+	// RingSize is how many frames a destination may fall behind before it
+	// skips, defaultRingSize when 0.
+	RingSize int
+	// Batch wakes a destination that caught up at most once per Batch, it
+	// then takes all frames since. Many destinations of small frames, e.g.
+	// audio listeners, cost fewer wakeups for up to Batch more latency.
+	Batch time.Duration
+}
+
+type ringEntry struct {
+	seq   uint64
+	frame Frame
+	attr  Attributes
+}
+
+// frameRing is written by the source and read by every destination through its
+// own cursor, so publishing a frame costs one store and one wakeup no matter how
+// many destinations are attached. Slow readers are overrun instead of blocking
+// the writer.
+type frameRing struct {
+	slots  []atomic.Value
+	mask   uint64
+	head   uint64
+	notify atomic.Value
+	wlock  sync.Mutex
+	closed int32
+}
+
+func newFrameRing(size int) *frameRing {
+	n := 1
+	for n < size {
+		n <<= 1
+	}
+
+	r := &frameRing{
+		slots: make([]atomic.Value, n),
+		mask:  uint64(n - 1),
+	}
+	r.notify.Store(make(chan struct{}))
+
+	return r
+}
+
+// write publishes a frame. Tracks of one source are read by separate
+// goroutines, so writers are serialized; readers never take the lock.
+func (r *frameRing) write(frame Frame, attr Attributes) {
+	if frame.Buffer != nil {
+		frame.Buffer.Retain()
+	}
+
+	r.wlock.Lock()
+	if atomic.LoadInt32(&r.closed) == 1 {
+		r.wlock.Unlock()
+		if frame.Buffer != nil {
+			frame.Buffer.Release()
+		}
+		return
+	}
+
+	seq := atomic.LoadUint64(&r.head)
+	slot := &r.slots[seq&r.mask]
+	old, _ := slot.Load().(*ringEntry)
+	slot.Store(&ringEntry{seq: seq, frame: frame, attr: attr})
+	atomic.StoreUint64(&r.head, seq+1)
+	notify := r.notify.Load().(chan struct{})
+	r.notify.Store(make(chan struct{}))
+	r.wlock.Unlock()
+
+	close(notify)
+
+	if old != nil && old.frame.Buffer != nil {
+		old.frame.Buffer.Release()
+	}
+}
+
+// close wakes up all readers and releases the buffers still held by the ring.
+func (r *frameRing) close() {
+	r.wlock.Lock()
+	defer r.wlock.Unlock()
+
+	if !atomic.CompareAndSwapInt32(&r.closed, 0, 1) {
+		return
+	}
+
+	close(r.notify.Load().(chan struct{}))
+
+	for i := range r.slots {
+		if e, _ := r.slots[i].Load().(*ringEntry); e != nil && e.frame.Buffer != nil {
+			e.frame.Buffer.Release()
+		}
+	}
+}
+
+func (r *frameRing) reader(batch time.Duration) *ringReader {
+	return &ringReader{
+		ring:   r,
+		cursor: atomic.LoadUint64(&r.head),
+		batch:  batch,
+	}
+}
+
+type ringReader struct {
+	ring   *frameRing
+	cursor uint64
+	batch  time.Duration
+	timer  *time.Timer
+}
+
+// next blocks until the frame at the cursor is available. The returned entry
+// holds its own buffer reference, which the caller releases once done.
+// skipped reports how many frames were overwritten before they could be read.
+func (rr *ringReader) next(ctx context.Context) (e *ringEntry, skipped uint64, err error) {
+	r := rr.ring
+	for {
+		if atomic.LoadInt32(&r.closed) == 1 {
+			return nil, 0, ErrFrameSourceClosed
+		}
+
+		notify := r.notify.Load().(chan struct{})
+		head := atomic.LoadUint64(&r.head)
+
+		if rr.cursor == head {
+			select {
+			case <-ctx.Done():
+				return nil, 0, ctx.Err()
+			case <-notify:
+			}
+
+			if rr.batch > 0 {
+				if err := rr.linger(ctx); err != nil {
+					return nil, 0, err
+				}
+			}
+			continue
+		}
+
+		if head-rr.cursor > uint64(len(r.slots)) {
+			lag := head - uint64(len(r.slots)) - rr.cursor
+			rr.cursor += lag
+			skipped += lag
+		}
+
+		slot := &r.slots[rr.cursor&r.mask]
+		e, _ = slot.Load().(*ringEntry)
+		if e == nil || e.seq != rr.cursor {
+			// overwritten between loading head and the slot
+			if e != nil && e.seq > rr.cursor {
+				skipped += e.seq - rr.cursor
+				rr.cursor = e.seq
+			}
+			continue
+		}
+
+		if e.frame.Buffer != nil {
+			if !e.frame.Buffer.TryRetain() {
+				continue
+			}
+
+			// the ring still owned the entry after we took our reference, so
+			// the buffer was not recycled in between
+			if check, _ := slot.Load().(*ringEntry); check != e || atomic.LoadInt32(&r.closed) == 1 {
+				e.frame.Buffer.Release()
+				continue
+			}
+		}
+
+		rr.cursor++
+
+		return e, skipped, nil
+	}
+}
+
+// linger lets frames pile up for a batch after a wakeup.
+func (rr *ringReader) linger(ctx context.Context) error {
+	if rr.timer == nil {
+		rr.timer = time.NewTimer(rr.batch)
+	} else {
+		rr.timer.Reset(rr.batch)
+	}
+
+	select {
+	case <-ctx.Done():
+		if !rr.timer.Stop() {
+			<-rr.timer.C
+		}
+		return ctx.Err()
+	case <-rr.timer.C:
+		return nil
+	}
+}
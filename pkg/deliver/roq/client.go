@@ -0,0 +1,166 @@
+package roq
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver/relay"
+	"github.com/quic-go/quic-go"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultDialTimeout = 5 * time.Second
+
+// Client publishes streams to and subscribes streams of roq servers, all
+// channels to one server share a single connection.
+type Client struct {
+	ctx         context.Context
+	token       string
+	tlsConfig   *tls.Config
+	opt         Options
+	dialTimeout time.Duration
+	conns       map[string]*conn
+	lock        sync.Mutex
+	logger      *logrus.Entry
+}
+
+// NewClient dials with tlsConfig, nil verifies the servers with the system
+// roots. ALPN is added to it.
+func NewClient(ctx context.Context, token string, tlsConfig *tls.Config, opt Options, dialTimeout time.Duration, logger *logrus.Entry) *Client {
+	if dialTimeout <= 0 {
+		dialTimeout = defaultDialTimeout
+	}
+
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{ALPN}
+
+	if logger == nil {
+		logger = logrus.WithField("obj", "roq-client")
+	} else {
+		logger = logger.WithField("obj", "roq-client")
+	}
+
+	return &Client{
+		ctx:         ctx,
+		token:       token,
+		tlsConfig:   tlsConfig,
+		opt:         opt,
+		dialTimeout: dialTimeout,
+		conns:       make(map[string]*conn),
+		logger:      logger,
+	}
+}
+
+// Subscribe opens a channel for stream of namespace on the server at addr
+// and returns once the stream metadata arrived.
+func (c *Client) Subscribe(ctx context.Context, addr, namespace, stream string) (*FrameSource, error) {
+	cc, rc, channel, err := c.open(ctx, addr, &relay.Message{
+		Type: relay.MessageSubscribe,
+		Subscribe: relay.Subscribe{
+			Namespace: namespace,
+			Stream:    stream,
+			Token:     c.token,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	src := newFrameSource(cc.Context(), cc, rc, channel)
+
+	select {
+	case <-src.Ready():
+		return src, nil
+	case <-src.Context().Done():
+		if err := src.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrChannelClosed
+	case <-ctx.Done():
+		src.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// Publish opens a channel pushing stream of namespace to the server at addr,
+// the returned destination takes the frames of a local source.
+func (c *Client) Publish(ctx context.Context, addr, namespace, stream string) (*FrameDestination, error) {
+	cc, rc, channel, err := c.open(ctx, addr, &relay.Message{
+		Type: relay.MessagePublish,
+		Publish: relay.Publish{
+			Namespace: namespace,
+			Stream:    stream,
+			Token:     c.token,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newFrameDestination(cc.Context(), cc, rc, channel), nil
+}
+
+// open starts a channel with m on the connection to addr.
+func (c *Client) open(ctx context.Context, addr string, m *relay.Message) (*conn, *relay.Conn, uint32, error) {
+	cc, err := c.conn(ctx, addr)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	stream, err := cc.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	rc := cc.channel(stream)
+	m.Channel = uint32(stream.StreamID())
+	if err := rc.WriteMessage(m); err != nil {
+		rc.Close()
+		return nil, nil, 0, err
+	}
+
+	return cc, rc, m.Channel, nil
+}
+
+func (c *Client) conn(ctx context.Context, addr string) (*conn, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if cc, ok := c.conns[addr]; ok && cc.Context().Err() == nil {
+		return cc, nil
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, c.dialTimeout)
+	defer cancel()
+
+	qc, err := quic.DialAddr(dialCtx, addr, c.tlsConfig, c.opt.config())
+	if err != nil {
+		return nil, err
+	}
+
+	cc := newConn(qc, c.opt, c.logger)
+	c.conns[addr] = cc
+
+	go func() {
+		select {
+		case <-cc.Context().Done():
+		case <-c.ctx.Done():
+			cc.CloseWithError(0, "client closed")
+		}
+
+		c.lock.Lock()
+		if c.conns[addr] == cc {
+			delete(c.conns, addr)
+		}
+		c.lock.Unlock()
+	}()
+
+	cc.logger.WithField("datagrams", cc.datagrams()).Info("roq connection opened")
+
+	return cc, nil
+}
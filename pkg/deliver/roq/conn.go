@@ -0,0 +1,161 @@
+package roq
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/bufpool"
+	"github.com/pingostack/neon/pkg/deliver/relay"
+	"github.com/quic-go/quic-go"
+	"github.com/sirupsen/logrus"
+)
+
+// Protocol names roq sessions in stats.
+const Protocol = "roq"
+
+// ALPN is negotiated by both sides of a roq connection.
+const ALPN = "neon-roq"
+
+const (
+	defaultIdleTimeout = 30 * time.Second
+	// larger frames, or those the current path mtu can't take, go on the
+	// stream of their channel
+	maxDatagramSize = 1400
+)
+
+// Options are shared by the client and the server.
+type Options struct {
+	// Datagrams sends the frames as unreliable quic datagrams when both sides
+	// enable them, lost ones are not sent again. Metadata, feedback and
+	// frames too large for a datagram stay on the stream.
+	Datagrams   bool
+	IdleTimeout time.Duration
+}
+
+func (o Options) config() *quic.Config {
+	idle := o.IdleTimeout
+	if idle <= 0 {
+		idle = defaultIdleTimeout
+	}
+
+	return &quic.Config{
+		MaxIdleTimeout:  idle,
+		KeepAlivePeriod: idle / 3,
+		EnableDatagrams: o.Datagrams,
+	}
+}
+
+// conn is a quic connection, every bidirectional stream is one channel with
+// the relay messages of a stream, the id of the stream is the channel.
+type conn struct {
+	quic.Connection
+	opt     Options
+	lock    sync.Mutex
+	sources map[uint32]*FrameSource
+	logger  *logrus.Entry
+}
+
+func newConn(qc quic.Connection, opt Options, logger *logrus.Entry) *conn {
+	c := &conn{
+		Connection: qc,
+		opt:        opt,
+		sources:    make(map[uint32]*FrameSource),
+		logger:     logger.WithField("remote", qc.RemoteAddr().String()),
+	}
+
+	if c.datagrams() {
+		go c.readDatagrams()
+	}
+
+	return c
+}
+
+func (c *conn) datagrams() bool {
+	return c.opt.Datagrams && c.ConnectionState().SupportsDatagrams
+}
+
+// channel wraps stream as a relay connection.
+func (c *conn) channel(stream quic.Stream) *relay.Conn {
+	rc := relay.NewConn(&streamConn{Stream: stream, conn: c})
+	if c.datagrams() {
+		rc.SetDatagramWriter(maxDatagramSize, c.SendDatagram)
+	}
+
+	return rc
+}
+
+func (c *conn) addSource(src *FrameSource) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.sources[src.channel] = src
+}
+
+func (c *conn) removeSource(src *FrameSource) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.sources[src.channel] == src {
+		delete(c.sources, src.channel)
+	}
+}
+
+func (c *conn) source(channel uint32) *FrameSource {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.sources[channel]
+}
+
+func (c *conn) readDatagrams() {
+	var m relay.Message
+	for {
+		b, err := c.ReceiveDatagram(c.Context())
+		if err != nil {
+			return
+		}
+
+		// the frame keeps its payload until it is delivered
+		buf := bufpool.Get(len(b))
+		copy(buf.Bytes(), b)
+		if err := relay.UnmarshalMessage(buf.Bytes(), &m); err != nil || m.Type != relay.MessageFrame {
+			c.logger.WithError(err).Debug("invalid datagram")
+			buf.Release()
+			continue
+		}
+
+		// the channel of a message is the id of its stream
+		if src := c.source(m.Channel); src != nil {
+			src.onFrame(m.Frame, buf)
+		}
+		buf.Release()
+	}
+}
+
+// streamConn is a quic stream as the net.Conn relay.Conn reads.
+type streamConn struct {
+	quic.Stream
+	conn *conn
+}
+
+func (s *streamConn) LocalAddr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+func (s *streamConn) RemoteAddr() net.Addr {
+	return s.conn.RemoteAddr()
+}
+
+// Close ends both directions, quic streams only close the sending one.
+func (s *streamConn) Close() error {
+	s.Stream.CancelRead(0)
+	return s.Stream.Close()
+}
+
+// closeContext closes c once ctx is done, a reader blocked on it returns.
+func closeContext(ctx context.Context, c *relay.Conn) {
+	<-ctx.Done()
+	c.Close()
+}
@@ -0,0 +1,55 @@
+package roq
+
+import (
+	"context"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/deliver/relay"
+)
+
+// FrameDestination sends a local stream down a channel, to a subscriber on a
+// server or to the server a client publishes to. It writes as the relay
+// does, frames go as datagrams when the connection sends them.
+type FrameDestination struct {
+	*relay.FrameDestination
+	rc *relay.Conn
+}
+
+func newFrameDestination(ctx context.Context, c *conn, rc *relay.Conn, channel uint32) *FrameDestination {
+	dest := &FrameDestination{
+		FrameDestination: relay.NewFrameDestination(ctx, rc, channel, c.logger),
+		rc:               rc,
+	}
+
+	go dest.loop()
+	go closeContext(dest.Context(), rc)
+
+	return dest
+}
+
+// loop takes the feedback of the other side until it closes the channel.
+func (fd *FrameDestination) loop() {
+	var m relay.Message
+	for {
+		buf, err := fd.rc.ReadMessage(&m)
+		if err != nil {
+			fd.CloseRemote()
+			return
+		}
+		buf.Release()
+
+		switch m.Type {
+		case relay.MessageFeedback:
+			fd.DeliverFeedback(m.Feedback)
+		case relay.MessageClose:
+			fd.CloseRemote()
+		}
+	}
+}
+
+func (fd *FrameDestination) TransportStats() deliver.TransportStats {
+	stats := fd.FrameDestination.TransportStats()
+	stats.Protocol = Protocol
+
+	return stats
+}
@@ -0,0 +1,12 @@
+package roq
+
+import "errors"
+
+var (
+	ErrUnauthorized    = errors.New("roq unauthorized")
+	ErrChannelClosed   = errors.New("roq channel closed")
+	ErrUnexpectedOpen  = errors.New("roq channel opened without publish or subscribe")
+	ErrMetadataTimeout = errors.New("roq metadata timeout")
+	ErrInvalidURL      = errors.New("invalid roq url")
+	ErrHandlerMissing  = errors.New("roq handler missing")
+)
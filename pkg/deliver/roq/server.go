@@ -0,0 +1,166 @@
+package roq
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver/relay"
+	"github.com/quic-go/quic-go"
+	"github.com/sirupsen/logrus"
+)
+
+// a channel is closed when its first message or the metadata of a publisher
+// takes longer
+const openTimeout = 10 * time.Second
+
+// Handlers attach the channels of a server to streams. A channel is closed,
+// and the other side told, when they return an error.
+type Handlers struct {
+	// Publish takes src once its metadata arrived, src is closed with the
+	// channel.
+	Publish func(ctx context.Context, qc quic.Connection, pub relay.Publish, src *FrameSource) error
+	// Subscribe attaches dest to the stream sub asks for.
+	Subscribe func(ctx context.Context, qc quic.Connection, sub relay.Subscribe, dest *FrameDestination) error
+}
+
+// Server takes streams published over quic and serves local streams to
+// subscribers, experimental.
+type Server struct {
+	ctx      context.Context
+	token    string
+	opt      Options
+	handlers Handlers
+	logger   *logrus.Entry
+}
+
+func NewServer(ctx context.Context, token string, opt Options, handlers Handlers, logger *logrus.Entry) *Server {
+	if logger == nil {
+		logger = logrus.WithField("obj", "roq-server")
+	} else {
+		logger = logger.WithField("obj", "roq-server")
+	}
+
+	return &Server{
+		ctx:      ctx,
+		token:    token,
+		opt:      opt,
+		handlers: handlers,
+		logger:   logger,
+	}
+}
+
+// Listen binds the udp address addr, tlsConfig has the certificate of the
+// server, ALPN is added to it.
+func (s *Server) Listen(addr string, tlsConfig *tls.Config) (*quic.Listener, error) {
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{ALPN}
+
+	return quic.ListenAddr(addr, tlsConfig, s.opt.config())
+}
+
+// Serve accepts connections on ln until it fails or the server context is
+// done.
+func (s *Server) Serve(ln *quic.Listener) error {
+	defer ln.Close()
+
+	for {
+		qc, err := ln.Accept(s.ctx)
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		go s.serveConn(newConn(qc, s.opt, s.logger))
+	}
+}
+
+func (s *Server) serveConn(c *conn) {
+	c.logger.WithField("datagrams", c.datagrams()).Info("roq connection accepted")
+
+	go func() {
+		<-s.ctx.Done()
+		c.CloseWithError(0, "server closed")
+	}()
+
+	for {
+		stream, err := c.AcceptStream(c.Context())
+		if err != nil {
+			c.logger.WithError(err).Info("roq connection closed")
+			return
+		}
+
+		go s.serveChannel(c, stream)
+	}
+}
+
+func (s *Server) serveChannel(c *conn, stream quic.Stream) {
+	rc := c.channel(stream)
+	channel := uint32(stream.StreamID())
+	logger := c.logger.WithField("channel", channel)
+
+	var m relay.Message
+	stream.SetReadDeadline(time.Now().Add(openTimeout))
+	buf, err := rc.ReadMessage(&m)
+	if err != nil {
+		logger.WithError(err).Debug("roq channel closed before open")
+		rc.Close()
+		return
+	}
+	buf.Release()
+	stream.SetReadDeadline(time.Time{})
+
+	ctx := c.Context()
+	switch m.Type {
+	case relay.MessageSubscribe:
+		dest := newFrameDestination(ctx, c, rc, channel)
+		if err := s.authorize(m.Subscribe.Token, s.handlers.Subscribe != nil); err != nil {
+			logger.WithField("stream", m.Subscribe.Stream).WithError(err).Warn("roq subscribe rejected")
+			dest.CloseWith(err.Error())
+			return
+		}
+
+		if err := s.handlers.Subscribe(ctx, c.Connection, m.Subscribe, dest); err != nil {
+			logger.WithError(err).WithField("stream", m.Subscribe.Stream).Warn("roq subscribe failed")
+			dest.CloseWith(err.Error())
+		}
+	case relay.MessagePublish:
+		src := newFrameSource(ctx, c, rc, channel)
+		if err := s.authorize(m.Publish.Token, s.handlers.Publish != nil); err != nil {
+			logger.WithField("stream", m.Publish.Stream).WithError(err).Warn("roq publish rejected")
+			src.CloseWith(err.Error())
+			return
+		}
+
+		select {
+		case <-src.Ready():
+		case <-src.Context().Done():
+			return
+		case <-time.After(openTimeout):
+			src.CloseWith(ErrMetadataTimeout.Error())
+			return
+		}
+
+		if err := s.handlers.Publish(ctx, c.Connection, m.Publish, src); err != nil {
+			logger.WithError(err).WithField("stream", m.Publish.Stream).Warn("roq publish failed")
+			src.CloseWith(err.Error())
+		}
+	default:
+		logger.Warn(ErrUnexpectedOpen.Error())
+		rc.Close()
+	}
+}
+
+func (s *Server) authorize(token string, handled bool) error {
+	if s.token != "" && token != s.token {
+		return ErrUnauthorized
+	}
+
+	if !handled {
+		return ErrHandlerMissing
+	}
+
+	return nil
+}
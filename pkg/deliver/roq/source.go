@@ -0,0 +1,149 @@
+package roq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pingostack/neon/pkg/bufpool"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/deliver/relay"
+	"github.com/sirupsen/logrus"
+)
+
+// FrameSource is a channel the other side pushes a stream on, a publisher
+// on a server or a subscribed stream on a client.
+type FrameSource struct {
+	deliver.FrameSource
+	conn      *conn
+	rc        *relay.Conn
+	channel   uint32
+	logger    *logrus.Entry
+	ready     chan struct{}
+	readyOnce sync.Once
+	closeOnce sync.Once
+	lock      sync.Mutex
+	err       error
+	bytes     uint64
+}
+
+func newFrameSource(ctx context.Context, c *conn, rc *relay.Conn, channel uint32) *FrameSource {
+	src := &FrameSource{
+		FrameSource: deliver.NewFrameSourceImpl(ctx, deliver.Metadata{}),
+		conn:        c,
+		rc:          rc,
+		channel:     channel,
+		logger:      c.logger.WithField("channel", channel),
+		ready:       make(chan struct{}),
+	}
+	c.addSource(src)
+
+	go src.loop()
+	go closeContext(src.Context(), rc)
+
+	return src
+}
+
+// loop reads the stream of the channel, frames sent as datagrams come from
+// the connection.
+func (fs *FrameSource) loop() {
+	var m relay.Message
+	for {
+		buf, err := fs.rc.ReadMessage(&m)
+		if err != nil {
+			fs.closeWith(ErrChannelClosed)
+			return
+		}
+
+		switch m.Type {
+		case relay.MessageMetadata:
+			fs.FrameSource.DeliverMetaData(m.Metadata)
+			fs.readyOnce.Do(func() {
+				close(fs.ready)
+			})
+		case relay.MessageFrame:
+			fs.onFrame(m.Frame, buf)
+		case relay.MessageClose:
+			reason := ErrChannelClosed
+			if m.Reason != "" {
+				reason = fmt.Errorf("%w: %s", ErrChannelClosed, m.Reason)
+			}
+			fs.closeWith(reason)
+		}
+
+		buf.Release()
+	}
+}
+
+func (fs *FrameSource) onFrame(frame deliver.Frame, buf *bufpool.Buffer) {
+	frame.Buffer = buf
+	atomic.AddUint64(&fs.bytes, uint64(frame.Length))
+	fs.FrameSource.DeliverFrame(frame, nil)
+}
+
+// Ready is closed once the metadata of the stream arrived.
+func (fs *FrameSource) Ready() <-chan struct{} {
+	return fs.ready
+}
+
+func (fs *FrameSource) TransportStats() deliver.TransportStats {
+	return deliver.TransportStats{
+		Protocol:      Protocol,
+		BytesReceived: atomic.LoadUint64(&fs.bytes),
+	}
+}
+
+// OnFeedback is sent to the other side, e.g. keyframe requests of local
+// subscribers.
+func (fs *FrameSource) OnFeedback(fb deliver.FeedbackMsg) {
+	err := fs.rc.WriteMessage(&relay.Message{
+		Channel:  fs.channel,
+		Type:     relay.MessageFeedback,
+		Feedback: fb,
+	})
+	if err != nil {
+		fs.logger.WithError(err).Debug("failed to send feedback")
+	}
+}
+
+// Err tells why the channel was closed.
+func (fs *FrameSource) Err() error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	return fs.err
+}
+
+func (fs *FrameSource) closeWith(err error) {
+	fs.closeOnce.Do(func() {
+		fs.lock.Lock()
+		fs.err = err
+		fs.lock.Unlock()
+
+		fs.conn.removeSource(fs)
+		fs.FrameSource.Close()
+	})
+}
+
+// CloseWith ends the channel, the other side is told reason.
+func (fs *FrameSource) CloseWith(reason string) {
+	fs.closeOnce.Do(func() {
+		fs.lock.Lock()
+		fs.err = ErrChannelClosed
+		fs.lock.Unlock()
+
+		fs.rc.WriteMessage(&relay.Message{
+			Channel: fs.channel,
+			Type:    relay.MessageClose,
+			Reason:  reason,
+		})
+		fs.conn.removeSource(fs)
+		fs.FrameSource.Close()
+	})
+}
+
+// Close ends the channel and tells the other side.
+func (fs *FrameSource) Close() {
+	fs.CloseWith("")
+}
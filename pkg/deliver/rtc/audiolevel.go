@@ -0,0 +1,195 @@
+package rtc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/eventbus"
+	"github.com/pingostack/neon/pkg/eventemitter"
+	"github.com/pion/rtp"
+)
+
+const (
+	audioLevelInterval = 500 * time.Millisecond
+	// silenceLevel is the quietest level, -127 dBov
+	silenceLevel = 127
+	// intervals a new speaker has to be the loudest before it is active
+	speakerHold = 2
+)
+
+// audioLevels averages the levels a publisher reports with every audio packet,
+// RFC 6464, over audioLevelInterval.
+type audioLevels struct {
+	lock    sync.Mutex
+	sum     uint64
+	count   uint64
+	voice   bool
+	startAt time.Time
+	onLevel func(level uint8, voice bool)
+}
+
+func (al *audioLevels) observe(packet *rtp.Packet, id uint8) (level uint8, voice bool, ok bool) {
+	payload := packet.GetExtension(id)
+	if payload == nil {
+		return 0, false, false
+	}
+
+	ext := rtp.AudioLevelExtension{}
+	if err := ext.Unmarshal(payload); err != nil {
+		return 0, false, false
+	}
+
+	now := time.Now()
+
+	al.lock.Lock()
+	if al.startAt.IsZero() {
+		al.startAt = now
+	}
+	al.sum += uint64(ext.Level)
+	al.count++
+	al.voice = al.voice || ext.Voice
+
+	var report func(level uint8, voice bool)
+	var avg uint8
+	var anyVoice bool
+	if now.Sub(al.startAt) >= audioLevelInterval {
+		report, avg, anyVoice = al.onLevel, uint8(al.sum/al.count), al.voice
+		al.sum, al.count, al.voice, al.startAt = 0, 0, false, now
+	}
+	al.lock.Unlock()
+
+	if report != nil {
+		report(avg, anyVoice)
+	}
+
+	return ext.Level, ext.Voice, true
+}
+
+// speakers picks the active speaker of each namespace, the loudest stream with
+// voice activity.
+type speakers struct {
+	lock       sync.Mutex
+	namespaces map[string]*namespaceSpeakers
+}
+
+type namespaceSpeakers struct {
+	active    string
+	candidate string
+	held      int
+	levels    map[string]uint8
+}
+
+var activeSpeakers = &speakers{namespaces: make(map[string]*namespaceSpeakers)}
+
+// publishAudioLevel publishes the level of a stream and the voice activity
+// and active speaker changes it causes.
+func publishAudioLevel(namespace, stream, session string, level uint8, voice bool) {
+	e := eventbus.AudioLevel{
+		Namespace: namespace,
+		Stream:    stream,
+		Session:   session,
+		Level:     level,
+		Voice:     voice,
+		Time:      time.Now(),
+	}
+
+	eventemitter.Publish(eventbus.Default(), eventbus.TopicAudioLevel, e)
+
+	changed, speaker, previous := activeSpeakers.update(namespace, stream, level, voice)
+	if changed {
+		eventemitter.Publish(eventbus.Default(), eventbus.TopicVoiceActivity, e)
+	}
+
+	publishSpeaker(namespace, speaker, previous)
+}
+
+// forgetAudioLevel removes a stream that stopped publishing from the speakers.
+func forgetAudioLevel(namespace, stream string) {
+	speaker, previous := activeSpeakers.remove(namespace, stream)
+	publishSpeaker(namespace, speaker, previous)
+}
+
+func publishSpeaker(namespace, speaker, previous string) {
+	if speaker == previous {
+		return
+	}
+
+	eventemitter.Publish(eventbus.Default(), eventbus.TopicActiveSpeaker, eventbus.ActiveSpeaker{
+		Namespace: namespace,
+		Stream:    speaker,
+		Previous:  previous,
+		Time:      time.Now(),
+	})
+}
+
+// update returns whether the voice activity of stream changed and the active
+// speaker before and after.
+func (s *speakers) update(namespace, stream string, level uint8, voice bool) (changed bool, speaker, previous string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ns := s.namespaces[namespace]
+	if ns == nil {
+		ns = &namespaceSpeakers{levels: make(map[string]uint8)}
+		s.namespaces[namespace] = ns
+	}
+
+	if !voice {
+		level = silenceLevel
+	}
+
+	old, seen := ns.levels[stream]
+	ns.levels[stream] = level
+	changed = !seen && voice || seen && (old < silenceLevel) != voice
+
+	previous = ns.active
+	loudest, loudestLevel := "", uint8(silenceLevel)
+	for id, l := range ns.levels {
+		if l < loudestLevel {
+			loudest, loudestLevel = id, l
+		}
+	}
+
+	switch {
+	case loudest == ns.active:
+		ns.candidate, ns.held = "", 0
+	case loudest == "":
+		// nobody speaks, the last speaker stays active
+	case loudest == ns.candidate:
+		ns.held++
+	default:
+		ns.candidate, ns.held = loudest, 1
+	}
+
+	if ns.candidate != "" && (ns.held >= speakerHold || ns.active == "") {
+		ns.active, ns.candidate, ns.held = ns.candidate, "", 0
+	}
+
+	return changed, ns.active, previous
+}
+
+// remove forgets a stream that stopped publishing.
+func (s *speakers) remove(namespace, stream string) (speaker, previous string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ns := s.namespaces[namespace]
+	if ns == nil {
+		return "", ""
+	}
+
+	delete(ns.levels, stream)
+	previous = ns.active
+	if ns.active == stream {
+		ns.active = ""
+	}
+	if ns.candidate == stream {
+		ns.candidate, ns.held = "", 0
+	}
+
+	if len(ns.levels) == 0 {
+		delete(s.namespaces, namespace)
+	}
+
+	return ns.active, previous
+}
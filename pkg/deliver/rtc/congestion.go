@@ -0,0 +1,266 @@
+package rtc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pion/rtp"
+)
+
+// DropPolicy decides which video frames a congested subscriber loses, there
+// are no simulcast layers to switch to.
+type DropPolicy string
+
+const (
+	// DropPolicyNone sends everything, the player queues or loses packets
+	DropPolicyNone DropPolicy = "none"
+	// DropPolicyNonReference drops frames no other frame depends on
+	DropPolicyNonReference DropPolicy = "nonReference"
+	// DropPolicyGOP drops the rest of the group of pictures, video resumes
+	// on the next keyframe of the publisher
+	DropPolicyGOP DropPolicy = "gop"
+)
+
+type CongestionSettings struct {
+	Policy DropPolicy `json:"policy" mapstructure:"policy"`
+	// MinBitrate is the floor of the loss based estimate, bits per second.
+	MinBitrate uint64 `json:"minBitrate" mapstructure:"minBitrate"`
+	// ProbeBitrate is the rate probing with padding goes up to once a
+	// subscriber connected, bits per second, 0 disables probing.
+	ProbeBitrate uint64 `json:"probeBitrate" mapstructure:"probeBitrate"`
+}
+
+const (
+	defaultMinBitrate = 150_000
+	sendRateWindow    = time.Second
+	// loss thresholds of the loss based controller, see GCC
+	lossHigh = 0.1
+	lossLow  = 0.02
+)
+
+var (
+	congestionLock     sync.RWMutex
+	congestionSettings = CongestionSettings{Policy: DropPolicyNone}
+)
+
+// SetCongestionSettings applies to subscribers created afterwards.
+func SetCongestionSettings(settings CongestionSettings) {
+	if settings.Policy == "" {
+		settings.Policy = DropPolicyNone
+	}
+
+	if settings.MinBitrate == 0 {
+		settings.MinBitrate = defaultMinBitrate
+	}
+
+	congestionLock.Lock()
+	defer congestionLock.Unlock()
+
+	congestionSettings = settings
+}
+
+func getCongestionSettings() CongestionSettings {
+	congestionLock.RLock()
+	defer congestionLock.RUnlock()
+
+	return congestionSettings
+}
+
+// congestion estimates the bandwidth towards one subscriber from the REMB and
+// the loss the player reports, and drops video frames while more is sent.
+type congestion struct {
+	settings CongestionSettings
+	lock     sync.Mutex
+	remb     uint64
+	estimate uint64
+	lastLoss float64
+
+	windowAt    time.Time
+	windowBytes uint64
+	sendRate    uint64
+
+	frameTimestamp uint32
+	started        bool
+	dropping       bool
+	skipGOP        bool
+	dropped        uint64
+}
+
+func newCongestion(settings CongestionSettings) *congestion {
+	return &congestion{settings: settings}
+}
+
+func (c *congestion) onREMB(bitrate uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.remb = bitrate
+}
+
+// onLoss adjusts the loss based estimate after a receiver report.
+func (c *congestion) onLoss(fractionLost float64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.lastLoss = fractionLost
+	if c.sendRate == 0 {
+		return
+	}
+
+	switch {
+	case fractionLost > lossHigh:
+		c.estimate = uint64(float64(c.sendRate) * (1 - 0.5*fractionLost))
+		if c.estimate < c.settings.MinBitrate {
+			c.estimate = c.settings.MinBitrate
+		}
+	case fractionLost < lossLow && c.estimate != 0:
+		c.estimate = uint64(float64(c.estimate) * 1.08)
+		// far above what is sent the estimate is no limit anymore
+		if c.estimate > 2*c.sendRate {
+			c.estimate = 0
+		}
+	}
+}
+
+// probed tells whether rate got through to the player, the rate it reports
+// otherwise.
+func (c *congestion) probed(rate uint64) (uint64, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.lastLoss > lossLow {
+		return 0, false
+	}
+
+	if c.remb != 0 && c.remb < rate {
+		return c.remb, false
+	}
+
+	return rate, true
+}
+
+// seed starts the estimate at the bandwidth probing found, unless loss set
+// one already.
+func (c *congestion) seed(bitrate uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.estimate == 0 && bitrate >= c.settings.MinBitrate {
+		c.estimate = bitrate
+	}
+}
+
+func (c *congestion) availableBitrate() uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.available()
+}
+
+// available is the estimated bandwidth, 0 if unknown.
+func (c *congestion) available() uint64 {
+	available := c.remb
+	if c.estimate != 0 && (available == 0 || c.estimate < available) {
+		available = c.estimate
+	}
+
+	return available
+}
+
+// allow decides on the first packet of a video frame, the rest of the frame
+// follows it. All packets are counted to the send rate.
+func (c *congestion) allow(frame deliver.Frame, packet *rtp.Packet) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.settings.Policy == DropPolicyNone || !frame.Codec.IsVideo() {
+		c.count(packet.MarshalSize())
+		return true
+	}
+
+	if !c.started || packet.Timestamp != c.frameTimestamp {
+		c.started, c.frameTimestamp = true, packet.Timestamp
+		c.dropping = c.drop(frame, packet)
+		if c.dropping {
+			c.dropped++
+		}
+	}
+
+	if c.dropping {
+		return false
+	}
+
+	c.count(packet.MarshalSize())
+
+	return true
+}
+
+func (c *congestion) drop(frame deliver.Frame, packet *rtp.Packet) bool {
+	keyframe := isKeyframe(frame)
+	if keyframe {
+		c.skipGOP = false
+	}
+
+	available := c.available()
+	congested := available != 0 && c.sendRate > available
+
+	switch c.settings.Policy {
+	case DropPolicyNonReference:
+		return congested && !keyframe && !isReference(frame.Codec, packet.Payload)
+	case DropPolicyGOP:
+		if congested && !keyframe {
+			c.skipGOP = true
+		}
+		return c.skipGOP
+	}
+
+	return false
+}
+
+func (c *congestion) count(size int) {
+	now := time.Now()
+	if c.windowAt.IsZero() {
+		c.windowAt = now
+	}
+
+	c.windowBytes += uint64(size)
+	if elapsed := now.Sub(c.windowAt); elapsed >= sendRateWindow {
+		c.sendRate = uint64(float64(c.windowBytes*8) / elapsed.Seconds())
+		c.windowAt, c.windowBytes = now, 0
+	}
+}
+
+func (c *congestion) framesDropped() uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.dropped
+}
+
+// isReference tells from the first packet of a frame whether other frames
+// may depend on it, codecs it can not inspect are references.
+func isReference(codec deliver.CodecType, payload []byte) bool {
+	if len(payload) == 0 {
+		return true
+	}
+
+	switch codec {
+	case deliver.CodecTypeH264:
+		// nal_ref_idc, of the aggregated or fragmented nal unit as well
+		header := payload[0]
+		if t := header & 0x1f; t == 24 && len(payload) > 3 {
+			header = payload[3]
+		}
+		// an sei or delimiter leads the slices, it tells nothing of them
+		if t := header & 0x1f; t == 6 || t == 9 {
+			return true
+		}
+		return header&0x60 != 0
+	case deliver.CodecTypeVP8:
+		// N bit of the payload descriptor
+		return payload[0]&0x20 == 0
+	}
+
+	return true
+}
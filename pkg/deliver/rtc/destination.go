@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/pingostack/neon/pkg/ratelimit"
 	"github.com/pingostack/neon/pkg/rtclib"
 	"github.com/pingostack/neon/pkg/rtclib/sdpassistor"
 	"github.com/pion/rtcp"
@@ -26,8 +30,35 @@ type FrameDestination struct {
 	videoTrack              *rtclib.TrackLocl
 	onceClose               sync.Once
 	chSourceCompletePromise chan error
+	limitLock               sync.Mutex
+	limiter                 ratelimit.Group
+	sessionLimit            *ratelimit.TokenBucket
+	frameTimestamp          uint32
+	started                 bool
+	dropping                bool
+	waitKeyframe            bool
+	lastLimitPLI            time.Time
+	bytesSent               uint64
+	meter                   atomic.Value
+	statsLock               sync.Mutex
+	rtt                     time.Duration
+	fractionLost            float64
+	jitter                  time.Duration
+	reportedMOS             float64 // of the player's voip metrics
+	lost                    map[uint32]uint32
+	congestion              *congestion
+	connected               chan struct{}
+	fecGroup                int
+	redDistance             int
+	audioSelect             string
+	// the deliver.FormatSettings of the last renegotiation
+	negotiated atomic.Value
 }
 
+const (
+	limitPLIInterval = time.Second
+)
+
 func NewFrameDestination(ctx context.Context, streamFactory rtclib.StreamFactory, preferTCP bool, logger *logrus.Entry) (fd *FrameDestination, err error) {
 	if logger == nil {
 		logger = logrus.WithField("obj", "frame-destination")
@@ -51,6 +82,8 @@ func NewFrameDestination(ctx context.Context, streamFactory rtclib.StreamFactory
 	fd = &FrameDestination{
 		chSourceCompletePromise: make(chan error, 1),
 		logger:                  logger.WithField("obj", "frame-destination"),
+		congestion:              newCongestion(getCongestionSettings()),
+		connected:               make(chan struct{}),
 	}
 
 	fd.ctx, fd.cancel = context.WithCancel(ctx)
@@ -66,6 +99,10 @@ func NewFrameDestination(ctx context.Context, streamFactory rtclib.StreamFactory
 		return nil, err
 	}
 
+	fd.LocalStream.OnInitialConnected(func() {
+		close(fd.connected)
+	})
+
 	return fd, nil
 }
 
@@ -90,6 +127,37 @@ func (fd *FrameDestination) SetRemoteDescription(remoteSdp webrtc.SessionDescrip
 	return nil
 }
 
+// Renegotiate answers a new offer of the player, refresh moves the
+// destination to the format of the media it offers, adding the tracks the
+// answer sends. Tracks it no longer offers stay, they are sent nothing.
+func (fd *FrameDestination) Renegotiate(ctx context.Context, sdpOffer string, refresh func() error) (*webrtc.SessionDescription, error) {
+	offer := webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: sdpOffer}
+	payloadUnion, err := sdpassistor.NewPayloadUnion(offer)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create payload union")
+	}
+
+	lsdp, err := fd.LocalStream.Renegotiate(ctx, offer, func() error {
+		prev, ok := fd.negotiated.Load().(deliver.FormatSettings)
+		if !ok {
+			prev = fd.FrameDestination.FormatSettings()
+		}
+
+		fd.negotiated.Store(convFormatSettings(payloadUnion))
+		if err := refresh(); err != nil {
+			fd.negotiated.Store(prev)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &lsdp, nil
+}
+
 func (fd *FrameDestination) CreateOffer(options *webrtc.OfferOptions) (webrtc.SessionDescription, error) {
 	return fd.LocalStream.CreateOffer(options)
 }
@@ -107,11 +175,16 @@ func (fd *FrameDestination) Start() error {
 }
 
 func (fd *FrameDestination) AddAudioTrack(am *deliver.AudioMetadata) (err error) {
-	if am == nil {
+	if am == nil || fd.audioTrack != nil {
 		return nil
 	}
 
-	fd.audioTrack, err = fd.LocalStream.AddTrack(am.CodecType, am.SampleRate, fd.logger)
+	var opts []rtclib.TrackOption
+	if fd.redDistance > 0 {
+		opts = append(opts, rtclib.WithRED(fd.redDistance))
+	}
+
+	fd.audioTrack, err = fd.LocalStream.AddTrack(am.CodecType, am.SampleRate, fd.logger, opts...)
 	if err != nil {
 		return err
 	}
@@ -122,17 +195,30 @@ func (fd *FrameDestination) AddAudioTrack(am *deliver.AudioMetadata) (err error)
 }
 
 func (fd *FrameDestination) AddVideoTrack(vm *deliver.VideoMetadata) (err error) {
-	if vm == nil {
+	if vm == nil || fd.videoTrack != nil {
 		return nil
 	}
 
-	fd.videoTrack, err = fd.LocalStream.AddTrack(vm.CodecType, vm.ClockRate, fd.logger)
+	var opts []rtclib.TrackOption
+	if fd.fecGroup > 0 {
+		opts = append(opts, rtclib.WithFEC(fd.fecGroup))
+	}
+
+	fd.videoTrack, err = fd.LocalStream.AddTrack(vm.CodecType, vm.ClockRate, fd.logger, opts...)
 	if err != nil {
 		return err
 	}
+	fd.videoTrack.OnResync(func() {
+		fd.logger.Info("publisher changed, resuming on next keyframe")
+		fd.resync()
+	})
 
 	go fd.loopReadRTCP(fd.videoTrack)
 
+	if limit := fd.congestion.settings.ProbeBitrate; limit > 0 {
+		go fd.probe(fd.videoTrack, limit)
+	}
+
 	return nil
 }
 
@@ -143,7 +229,11 @@ func (fd *FrameDestination) OnSource(src deliver.FrameSource) (err error) {
 			fd.logger.WithError(err).Error("OnSource panic")
 		}
 
-		fd.chSourceCompletePromise <- err
+		// a renegotiation adds the destination to a source again
+		select {
+		case fd.chSourceCompletePromise <- err:
+		default:
+		}
 	}()
 
 	if err = fd.AddAudioTrack(src.Metadata().Audio); err != nil {
@@ -197,12 +287,167 @@ func (fd *FrameDestination) OnFrame(frame deliver.Frame, attr deliver.Attributes
 		return
 	}
 
+	if !fd.allow(frame, packet) || !fd.congestion.allow(frame, packet) {
+		return
+	}
+
 	err := track.WriteRTP(packet)
 	if err != nil {
 		fd.logger.WithError(err).Error("failed to write rtp packet")
+		return
+	}
+
+	size := uint64(packet.MarshalSize())
+	atomic.AddUint64(&fd.bytesSent, size)
+	if m, ok := fd.meter.Load().(EgressMeter); ok {
+		m.AddEgress(size)
 	}
 }
 
+// EgressMeter counts the bytes sent by destinations, e.g. the monthly quota
+// of a tenant.
+type EgressMeter interface {
+	AddEgress(n uint64)
+}
+
+func (fd *FrameDestination) SetEgressMeter(m EgressMeter) {
+	fd.meter.Store(m)
+}
+
+// SetFECGroup protects every group packets of the video with an ulpfec
+// packet, 0 disables fec. It must be called before the source is added.
+func (fd *FrameDestination) SetFECGroup(group int) {
+	fd.fecGroup = group
+}
+
+// SetREDDistance repeats the distance packets before in every packet of opus
+// audio, 0 disables red. It must be called before the source is added.
+func (fd *FrameDestination) SetREDDistance(distance int) {
+	fd.redDistance = distance
+}
+
+// SelectAudioTrack picks the audio track of a source carrying more than one
+// by its index, label or language, the first when empty or not found.
+func (fd *FrameDestination) SelectAudioTrack(sel string) {
+	fd.audioSelect = sel
+}
+
+func (fd *FrameDestination) FormatSettings() deliver.FormatSettings {
+	fs, ok := fd.negotiated.Load().(deliver.FormatSettings)
+	if !ok {
+		fs = fd.FrameDestination.FormatSettings()
+	}
+	fs.AudioTrack = fd.audioSelect
+
+	return fs
+}
+
+// SetLimiter sets the egress buckets shared with other sessions, e.g. global and per stream.
+func (fd *FrameDestination) SetLimiter(limiter ratelimit.Group) {
+	fd.limitLock.Lock()
+	defer fd.limitLock.Unlock()
+
+	fd.limiter = limiter
+}
+
+// SetMaxBitrate caps this session only, 0 removes the cap.
+func (fd *FrameDestination) SetMaxBitrate(bitrate uint64) {
+	fd.limitLock.Lock()
+	defer fd.limitLock.Unlock()
+
+	if bitrate == 0 {
+		fd.sessionLimit = nil
+	} else if fd.sessionLimit == nil {
+		fd.sessionLimit = ratelimit.NewTokenBucket(bitrate, 0)
+	} else {
+		fd.sessionLimit.SetBitrate(bitrate)
+	}
+}
+
+// allow never drops audio, only charges it. Video is dropped a whole frame at
+// a time and, once dropped, resumes on the next keyframe which is requested
+// from the publisher.
+func (fd *FrameDestination) allow(frame deliver.Frame, packet *rtp.Packet) bool {
+	fd.limitLock.Lock()
+	defer fd.limitLock.Unlock()
+
+	limiter := fd.limiter
+	if fd.sessionLimit != nil {
+		limiter = append(limiter[:len(limiter):len(limiter)], fd.sessionLimit)
+	}
+
+	if len(limiter) == 0 && !fd.waitKeyframe {
+		return true
+	}
+
+	size := packet.MarshalSize()
+
+	if frame.Codec.IsAudio() {
+		limiter.Force(size)
+		return true
+	}
+
+	// the first packet of a frame decides, the rest of the frame follows it
+	if fd.started && packet.Timestamp == fd.frameTimestamp {
+		if fd.dropping {
+			return false
+		}
+
+		limiter.Force(size)
+		return true
+	}
+
+	fd.started, fd.frameTimestamp = true, packet.Timestamp
+
+	if fd.waitKeyframe && !isKeyframe(frame) {
+		fd.dropping = true
+		fd.requestKeyframe()
+		return false
+	}
+
+	fd.dropping = !limiter.Allow(size)
+	if fd.dropping {
+		fd.waitKeyframe = true
+		fd.requestKeyframe()
+		return false
+	}
+
+	fd.waitKeyframe = false
+
+	return true
+}
+
+// OnFrameGap is called when this subscriber fell behind and frames were
+// skipped, video is broken until the next keyframe.
+func (fd *FrameDestination) OnFrameGap(lost uint64) {
+	fd.logger.WithField("lost", lost).Warn("subscriber overrun, waiting for keyframe")
+	fd.resync()
+}
+
+// resync holds video back until the next keyframe, which is requested.
+func (fd *FrameDestination) resync() {
+	fd.limitLock.Lock()
+	defer fd.limitLock.Unlock()
+
+	fd.started = false
+	fd.waitKeyframe = true
+	fd.requestKeyframe()
+}
+
+func isKeyframe(frame deliver.Frame) bool {
+	info, ok := frame.AdditionalInfo.(*deliver.VideoFrameSpecificInfo)
+	return !ok || info.IsKeyFrame
+}
+
+func (fd *FrameDestination) requestKeyframe() {
+	if time.Since(fd.lastLimitPLI) < limitPLIInterval {
+		return
+	}
+
+	fd.lastLimitPLI = time.Now()
+	go fd.sendPLI()
+}
+
 func (fd *FrameDestination) loopReadRTCP(track *rtclib.TrackLocl) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -241,6 +486,12 @@ func (fd *FrameDestination) loopReadRTCP(track *rtclib.TrackLocl) {
 					case *rtcp.FullIntraRequest:
 						fd.logger.WithField("ssrc", p.MediaSSRC).WithField("attri", a).Debug("received fir")
 						fd.sendFIR()
+					case *rtcp.ReceiverReport:
+						fd.onReceptionReports(p.Reports)
+					case *rtcp.ReceiverEstimatedMaximumBitrate:
+						fd.congestion.onREMB(uint64(p.Bitrate))
+					case *rtcp.ExtendedReport:
+						fd.onXR(p, track)
 					default:
 						//	fd.logger.WithField("pkt-type", reflect.TypeOf(pkt)).Debug("received rtcp")
 					}
@@ -251,6 +502,104 @@ func (fd *FrameDestination) loopReadRTCP(track *rtclib.TrackLocl) {
 	}
 }
 
+// onReceptionReports keeps the latest loss and round trip time the player
+// reported.
+func (fd *FrameDestination) onReceptionReports(reports []rtcp.ReceptionReport) {
+	now := time.Now()
+
+	fd.statsLock.Lock()
+	defer fd.statsLock.Unlock()
+
+	if fd.lost == nil {
+		fd.lost = make(map[uint32]uint32)
+	}
+
+	for _, r := range reports {
+		fd.lost[r.SSRC] = r.TotalLost
+		fd.fractionLost = float64(r.FractionLost) / 256
+		fd.congestion.onLoss(fd.fractionLost)
+		if rtt, ok := rttFromReport(r, now); ok {
+			fd.rtt = rtt
+		}
+		if clockRate := fd.clockRate(r.SSRC); clockRate > 0 {
+			fd.jitter = time.Duration(float64(r.Jitter) / float64(clockRate) * float64(time.Second))
+		}
+	}
+}
+
+func (fd *FrameDestination) clockRate(ssrc uint32) uint32 {
+	for _, track := range []*rtclib.TrackLocl{fd.audioTrack, fd.videoTrack} {
+		if track != nil && track.SSRC() == ssrc {
+			return track.ClockRate()
+		}
+	}
+
+	return 0
+}
+
+// onXR answers the reference time blocks of a player with the delay since
+// their arrival and keeps the loss and score it reports.
+func (fd *FrameDestination) onXR(xr *rtcp.ExtendedReport, track *rtclib.TrackLocl) {
+	now := time.Now()
+
+	var answer []rtcp.ReportBlock
+	for _, block := range xr.Reports {
+		switch b := block.(type) {
+		case *rtcp.ReceiverReferenceTimeReportBlock:
+			answer = append(answer, dlrr(xr.SenderSSRC, b, now, time.Now()))
+		case *rtcp.LossRLEReportBlock:
+			if expected, lost := rtclib.LossRLECounts(b); expected > 0 {
+				fd.statsLock.Lock()
+				fd.fractionLost = float64(lost) / float64(expected)
+				fd.statsLock.Unlock()
+			}
+		case *rtcp.VoIPMetricsReportBlock:
+			if mos, ok := reportedMOS(b); ok {
+				fd.statsLock.Lock()
+				fd.reportedMOS = mos
+				fd.statsLock.Unlock()
+			}
+		}
+	}
+
+	if len(answer) == 0 {
+		return
+	}
+
+	err := fd.LocalStream.WriteRTCP([]rtcp.Packet{&rtcp.ExtendedReport{
+		SenderSSRC: track.SSRC(),
+		Reports:    answer,
+	}})
+	if err != nil {
+		fd.logger.WithError(err).Error("failed to send xr")
+	}
+}
+
+func (fd *FrameDestination) TransportStats() deliver.TransportStats {
+	stats := deliver.TransportStats{
+		Protocol:         metrics.ProtocolWebRTC,
+		BytesSent:        atomic.LoadUint64(&fd.bytesSent),
+		FramesDropped:    fd.congestion.framesDropped(),
+		AvailableBitrate: fd.congestion.availableBitrate(),
+	}
+
+	fd.statsLock.Lock()
+	defer fd.statsLock.Unlock()
+
+	for _, lost := range fd.lost {
+		stats.PacketsLost += uint64(lost)
+	}
+	stats.FractionLost = fd.fractionLost
+	stats.RTT = float64(fd.rtt) / float64(time.Millisecond)
+	stats.Jitter = float64(fd.jitter) / float64(time.Millisecond)
+	stats.MOS = fd.reportedMOS
+	if stats.MOS == 0 && len(fd.lost) > 0 {
+		stats.MOS, _ = estimateMOS(fd.fractionLost, fd.rtt, fd.jitter)
+	}
+
+	return stats
+}
+
 func (fd *FrameDestination) close() {
 	fd.onceClose.Do(func() {
 		fd.cancel()
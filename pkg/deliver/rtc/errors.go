@@ -0,0 +1,7 @@
+package rtc
+
+import "errors"
+
+var (
+	ErrNotSubscriber = errors.New("session is not a subscriber")
+)
@@ -2,9 +2,11 @@ package rtc
 
 import (
 	"strconv"
+	"strings"
 
 	"github.com/pingostack/neon/pkg/deliver"
 	"github.com/pingostack/neon/pkg/rtclib/sdpassistor"
+	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v4"
 )
 
@@ -104,3 +106,101 @@ func NewMetadataFromSDP(sdpStr string) (deliver.Metadata, error) {
 
 	return convMetadata(pu), nil
 }
+
+// audioTracks reads the audio sections of desc, with their a=lang and
+// a=label, the codecs those negotiated in codecs with the same mid. ids are
+// the msid track ids of the tracks.
+func audioTracks(desc, codecs string) (tracks []deliver.AudioMetadata, ids []string) {
+	var d, c sdp.SessionDescription
+	if d.Unmarshal([]byte(desc)) != nil || c.Unmarshal([]byte(codecs)) != nil {
+		return nil, nil
+	}
+
+	lang, _ := d.Attribute("lang")
+	for _, m := range d.MediaDescriptions {
+		if !isActiveAudio(m) {
+			continue
+		}
+
+		mid, _ := m.Attribute("mid")
+		negotiated := mediaByMid(&c, mid)
+		if negotiated == nil || !isActiveAudio(negotiated) {
+			continue
+		}
+
+		am, ok := firstAudioPayload(negotiated)
+		if !ok {
+			continue
+		}
+		if am.Language, ok = m.Attribute("lang"); !ok {
+			am.Language = lang
+		}
+		am.Label, _ = m.Attribute("label")
+
+		id := ""
+		if msid, ok := m.Attribute("msid"); ok {
+			if fields := strings.Fields(msid); len(fields) == 2 {
+				id = fields[1]
+			}
+		}
+
+		tracks = append(tracks, am)
+		ids = append(ids, id)
+	}
+
+	return tracks, ids
+}
+
+func isActiveAudio(m *sdp.MediaDescription) bool {
+	if m.MediaName.Media != "audio" || m.MediaName.Port.Value == 0 {
+		return false
+	}
+	_, inactive := m.Attribute("inactive")
+
+	return !inactive
+}
+
+func mediaByMid(d *sdp.SessionDescription, mid string) *sdp.MediaDescription {
+	for _, m := range d.MediaDescriptions {
+		if v, _ := m.Attribute("mid"); v == mid {
+			return m
+		}
+	}
+
+	return nil
+}
+
+// firstAudioPayload is the codec of the first format of m, from its rtpmap,
+// e.g. 111 opus/48000/2.
+func firstAudioPayload(m *sdp.MediaDescription) (deliver.AudioMetadata, bool) {
+	if len(m.MediaName.Formats) == 0 {
+		return deliver.AudioMetadata{}, false
+	}
+	pt := m.MediaName.Formats[0]
+
+	for _, a := range m.Attributes {
+		if a.Key != "rtpmap" || !strings.HasPrefix(a.Value, pt+" ") {
+			continue
+		}
+
+		parts := strings.Split(strings.TrimSpace(a.Value[len(pt)+1:]), "/")
+		payloadType, _ := strconv.ParseUint(pt, 10, 8)
+		am := deliver.AudioMetadata{
+			Codec:          parts[0],
+			CodecType:      deliver.ConvCodecType(parts[0]),
+			RtpPayloadType: uint8(payloadType),
+		}
+		if len(parts) > 1 {
+			rate, _ := strconv.ParseUint(parts[1], 10, 32)
+			am.SampleRate = uint32(rate)
+		}
+		if len(parts) > 2 {
+			channels, _ := strconv.ParseUint(parts[2], 10, 8)
+			am.Channels = uint8(channels)
+		}
+
+		return am, true
+	}
+
+	return deliver.AudioMetadata{}, false
+}
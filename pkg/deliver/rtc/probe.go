@@ -0,0 +1,90 @@
+package rtc
+
+import (
+	"time"
+
+	"github.com/pingostack/neon/pkg/rtclib"
+)
+
+const (
+	probeStartBitrate = 300_000
+	// each rate is sent for probeDuration, then the reports of the player are
+	// waited for
+	probeDuration = 500 * time.Millisecond
+	probeFeedback = time.Second
+	probeTick     = 10 * time.Millisecond
+)
+
+// probe doubles the rate towards a newly connected player by filling up the
+// video with padding, until it reaches the probe bitrate, the player reports
+// loss or a lower REMB. The last rate that got through seeds the estimate, so
+// the subscriber starts at its bandwidth instead of growing into it.
+func (fd *FrameDestination) probe(track *rtclib.TrackLocl, limit uint64) {
+	select {
+	case <-fd.ctx.Done():
+		return
+	case <-fd.connected:
+	}
+
+	var through uint64
+	for rate := uint64(probeStartBitrate); ; rate *= 2 {
+		if rate > limit {
+			rate = limit
+		}
+
+		if !fd.probeRate(track, rate) {
+			return
+		}
+
+		select {
+		case <-fd.ctx.Done():
+			return
+		case <-time.After(probeFeedback):
+		}
+
+		got, ok := fd.congestion.probed(rate)
+		if !ok {
+			if got > through {
+				through = got
+			}
+			break
+		}
+
+		through = rate
+		if rate == limit {
+			// no limit below the probe bitrate
+			fd.logger.WithField("bitrate", rate).Debug("probe reached the probe bitrate")
+			return
+		}
+	}
+
+	fd.logger.WithField("bitrate", through).Debug("probed bandwidth")
+	fd.congestion.seed(through)
+}
+
+// probeRate pads the bytes the video sent up to rate for probeDuration.
+func (fd *FrameDestination) probeRate(track *rtclib.TrackLocl, rate uint64) bool {
+	ticker := time.NewTicker(probeTick)
+	defer ticker.Stop()
+
+	start, startBytes := time.Now(), track.BytesSent()
+	for {
+		select {
+		case <-fd.ctx.Done():
+			return false
+		case now := <-ticker.C:
+			elapsed := now.Sub(start)
+			if elapsed >= probeDuration {
+				return true
+			}
+
+			target := uint64(elapsed.Seconds() * float64(rate) / 8)
+			if sent := track.BytesSent() - startBytes; sent < target {
+				if _, err := track.WritePadding(int(target - sent)); err != nil {
+					fd.logger.WithError(err).Debug("failed to write probe padding")
+					return false
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package rtc
+
+import (
+	"sync"
+
+	"github.com/pingostack/neon/pkg/utils"
+)
+
+// REDStream sends the opus of matching streams in red towards players that
+// negotiate it.
+type REDStream struct {
+	Pattern string `json:"pattern" mapstructure:"pattern"`
+	// Distance is the number of earlier packets every packet repeats, at
+	// most 3. 1 doubles the audio bitrate and repairs every single loss, 0
+	// disables red for the streams.
+	Distance int `json:"distance" mapstructure:"distance"`
+}
+
+type REDSettings struct {
+	Streams []REDStream `json:"streams" mapstructure:"streams"`
+}
+
+var (
+	redLock     sync.RWMutex
+	redSettings REDSettings
+)
+
+// SetREDSettings applies to subscribers created afterwards.
+func SetREDSettings(settings REDSettings) {
+	redLock.Lock()
+	defer redLock.Unlock()
+
+	redSettings = settings
+}
+
+// REDDistance is the red distance of the first stream pattern matching
+// streamPath, 0 without red.
+func REDDistance(streamPath string) int {
+	redLock.RLock()
+	defer redLock.RUnlock()
+
+	for _, s := range redSettings.Streams {
+		if utils.MatchStreamPath(s.Pattern, streamPath) {
+			return s.Distance
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,45 @@
+package rtc
+
+import (
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+// seconds between the ntp epoch 1900 and the unix epoch 1970
+const ntpEpochOffset = 2208988800
+
+// rttFromReport computes the round trip time from a reception report about a
+// stream this side sends sender reports for, RFC 3550 6.4.1.
+func rttFromReport(r rtcp.ReceptionReport, now time.Time) (time.Duration, bool) {
+	return rttSince(r.LastSenderReport, r.Delay, now)
+}
+
+// rttFromDLRR computes the round trip time from the answer to a receiver
+// reference time block this side sent, RFC 3611 4.5.
+func rttFromDLRR(r rtcp.DLRRReport, now time.Time) (time.Duration, bool) {
+	return rttSince(r.LastRR, r.DLRR, now)
+}
+
+// rttSince takes the middle 32 bits of the ntp time of the report sent and
+// the delay of the peer since it received it, both in 1/65536 seconds.
+func rttSince(last, delay uint32, now time.Time) (time.Duration, bool) {
+	if last == 0 {
+		return 0, false
+	}
+
+	mid := uint32(toNTP(now) >> 16)
+	d := mid - last - delay
+	if int32(d) < 0 {
+		return 0, false
+	}
+
+	return time.Duration(float64(d) / 65536 * float64(time.Second)), true
+}
+
+func toNTP(t time.Time) uint64 {
+	secs := uint64(t.Unix()) + ntpEpochOffset
+	frac := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+
+	return secs<<32 | frac
+}
@@ -2,12 +2,19 @@ package rtc
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/pingostack/neon/internal/core"
 	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/acl"
+	"github.com/pingostack/neon/pkg/capture"
+	"github.com/pingostack/neon/pkg/clock"
+	"github.com/pingostack/neon/pkg/ratelimit"
 	"github.com/pingostack/neon/pkg/rtclib"
 	"github.com/pingostack/neon/pkg/rtclib/sdpassistor"
+	"github.com/pingostack/neon/pkg/rtclib/transport"
+	"github.com/pingostack/neon/pkg/vhost"
 	"github.com/pion/webrtc/v4"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -21,13 +28,18 @@ type ServSession struct {
 	dest   *FrameDestination
 	src    *FrameSource
 	sf     rtclib.StreamFactory
+	acl    *acl.ACL
+	clock  clock.Clock
+	// renegotiations run one at a time
+	negotiateLock sync.Mutex
 }
 
 func NewServSession(ctx context.Context, sf rtclib.StreamFactory, pm router.PeerParams, logger *logrus.Entry) *ServSession {
 	s := &ServSession{
-		ctx: ctx,
-		pm:  pm,
-		sf:  sf,
+		ctx:   ctx,
+		pm:    pm,
+		sf:    sf,
+		clock: clock.Default(),
 		logger: logger.WithFields(logrus.Fields{
 			"session-type": "serv-session",
 		}),
@@ -36,15 +48,44 @@ func NewServSession(ctx context.Context, sf rtclib.StreamFactory, pm router.Peer
 	return s
 }
 
+// SetACL accounts the session to a from Publish or Subscribe on, as one
+// connection of its remote address until the session ends.
+func (s *ServSession) SetACL(a *acl.ACL) {
+	s.acl = a
+}
+
+// account holds the connection acquired for the session while it lasts,
+// it is released right away when the session did not join.
+func (s *ServSession) account(release func(), joined bool) {
+	if !joined {
+		release()
+		return
+	}
+
+	go func() {
+		<-s.Session.Context().Done()
+		release()
+	}()
+}
+
 func (s *ServSession) Publish(keyFrameInterval time.Duration, sdpOffer string) (*webrtc.SessionDescription, error) {
 	logger := s.logger
 
+	release, err := s.acl.Acquire(s.pm.RemoteAddr)
+	if err != nil {
+		logger.WithError(err).Warn("remote refused")
+		return nil, errors.Wrap(err, "remote refused")
+	}
+	defer func() { s.account(release, s.src != nil) }()
+
 	src, err := NewFrameSource(s.ctx, s.sf, false, keyFrameInterval, logger)
 	if err != nil {
 		logger.WithError(err).Error("failed to create frame source")
 		return nil, errors.Wrap(err, "failed to create frame source")
 	}
 
+	src.SetMaxBitrate(ratelimit.Default().StreamBitrate(s.pm.RouterID))
+
 	err = src.SetRemoteDescription(webrtc.SessionDescription{
 		Type: webrtc.SDPTypeOffer,
 		SDP:  sdpOffer,
@@ -89,6 +130,8 @@ func (s *ServSession) Publish(keyFrameInterval time.Duration, sdpOffer string) (
 		return nil, errors.Wrap(err, "join failed")
 	}
 
+	s.watchAudioLevel(src)
+
 	lsdp, err := src.GatheringCompleteLocalSdp(context.Background())
 	if err != nil {
 		logger.WithError(err).Error("failed to get completed sdp")
@@ -96,12 +139,21 @@ func (s *ServSession) Publish(keyFrameInterval time.Duration, sdpOffer string) (
 	}
 
 	s.src = src
+	s.capture(src.Transport, sdpOffer, lsdp.SDP)
 
 	return &lsdp, nil
 }
 
 func (s *ServSession) Subscribe(sdpOffer string, timeout time.Duration) (*webrtc.SessionDescription, error) {
 	logger := s.logger
+
+	release, err := s.acl.Acquire(s.pm.RemoteAddr)
+	if err != nil {
+		logger.WithError(err).Warn("remote refused")
+		return nil, errors.Wrap(err, "remote refused")
+	}
+	defer func() { s.account(release, s.dest != nil) }()
+
 	hasAudio, hasVideo, hasData, err := sdpassistor.GetPayloadStatus(sdpOffer, webrtc.SDPTypeOffer)
 	if err != nil {
 		logger.WithError(err).Error("failed to get payload status")
@@ -122,6 +174,16 @@ func (s *ServSession) Subscribe(sdpOffer string, timeout time.Duration) (*webrtc
 		return nil, errors.Wrap(err, "failed create frame destination")
 	}
 
+	limiter := ratelimit.Default().ForSession(s.pm.RouterID)
+	if tenant, _, err := vhost.Default().Resolve(s.pm.Domain, s.pm.RouterID, s.pm.Tenant); err == nil && tenant != nil {
+		limiter = append(limiter, tenant.Limiter()...)
+		dest.SetEgressMeter(tenant)
+	}
+	dest.SetLimiter(limiter)
+	dest.SetFECGroup(FECGroup(s.pm.RouterID))
+	dest.SetREDDistance(REDDistance(s.pm.RouterID))
+	dest.SelectAudioTrack(s.pm.Args["audio"])
+
 	err = dest.SetRemoteDescription(webrtc.SessionDescription{
 		Type: webrtc.SDPTypeOffer,
 		SDP:  sdpOffer,
@@ -150,7 +212,7 @@ func (s *ServSession) Subscribe(sdpOffer string, timeout time.Duration) (*webrtc
 				} else {
 					logger.Info("join success")
 				}
-			case <-time.After(timeout):
+			case <-s.clock.After(timeout):
 				logger.WithField("timeout", timeout).Error("join timeout")
 				return nil, errors.New("join timeout")
 			}
@@ -179,6 +241,87 @@ func (s *ServSession) Subscribe(sdpOffer string, timeout time.Duration) (*webrtc
 	}
 
 	s.dest = dest
+	s.capture(dest.Transport, sdpOffer, lsdp.SDP)
 
 	return &lsdp, nil
 }
+
+// capture records the negotiation and the transport states of a joined
+// session to its captures, see package capture.
+func (s *ServSession) capture(t *transport.Transport, offer, answer string) {
+	target := capture.Target{
+		Namespace: s.Session.GetNamespace().Name(),
+		Stream:    s.Session.RouterID(),
+		Session:   s.Session.ID(),
+	}
+
+	capture.Record(target, capture.KindSignaling, "offer", map[string]interface{}{"sdp": offer})
+	capture.Record(target, capture.KindSignaling, "answer", map[string]interface{}{"sdp": answer})
+
+	t.OnStateChange(func(kind, state string) {
+		capture.Record(target, capture.KindState, kind+" state", map[string]interface{}{"state": state})
+	})
+}
+
+// watchAudioLevel publishes the audio levels of a joined publisher on the
+// event bus.
+func (s *ServSession) watchAudioLevel(src *FrameSource) {
+	namespace, stream, id := s.Session.GetNamespace().Name(), s.Session.RouterID(), s.Session.ID()
+
+	src.OnAudioLevel(func(level uint8, voice bool) {
+		publishAudioLevel(namespace, stream, id, level, voice)
+	})
+
+	go func() {
+		<-s.Session.Context().Done()
+		forgetAudioLevel(namespace, stream)
+	}()
+}
+
+// SetMaxBitrate caps the egress of a subscriber session.
+func (s *ServSession) SetMaxBitrate(bitrate uint64) error {
+	if s.dest == nil {
+		return ErrNotSubscriber
+	}
+
+	s.dest.SetMaxBitrate(bitrate)
+
+	return nil
+}
+
+// Renegotiate answers a new offer of a joined subscriber, e.g. adding the
+// video to a session that started with the audio only.
+func (s *ServSession) Renegotiate(sdpOffer string, timeout time.Duration) (*webrtc.SessionDescription, error) {
+	if s.dest == nil {
+		return nil, ErrNotSubscriber
+	}
+
+	r := s.Session.GetRouter()
+	if r == nil {
+		return nil, errors.New("session not joined")
+	}
+
+	s.negotiateLock.Lock()
+	defer s.negotiateLock.Unlock()
+
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
+	defer cancel()
+
+	lsdp, err := s.dest.Renegotiate(ctx, sdpOffer, func() error {
+		return r.RefreshSubscriber(s.Session)
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("failed to renegotiate")
+		return nil, errors.Wrap(err, "failed to renegotiate")
+	}
+
+	target := capture.Target{
+		Namespace: s.Session.GetNamespace().Name(),
+		Stream:    s.Session.RouterID(),
+		Session:   s.Session.ID(),
+	}
+	capture.Record(target, capture.KindSignaling, "renegotiation offer", map[string]interface{}{"sdp": sdpOffer})
+	capture.Record(target, capture.KindSignaling, "renegotiation answer", map[string]interface{}{"sdp": lsdp.SDP})
+
+	return lsdp, nil
+}
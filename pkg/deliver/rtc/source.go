@@ -4,13 +4,18 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/pingostack/neon/pkg/clock"
 	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/metrics"
 	"github.com/pingostack/neon/pkg/rtclib"
 	"github.com/pingostack/neon/pkg/rtclib/sdpassistor"
 	"github.com/pion/rtcp"
+	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v4"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -28,9 +33,34 @@ type FrameSource struct {
 	keyFrameInterval time.Duration
 	videoTrack       *rtclib.TrackRemote
 	audioTrack       *rtclib.TrackRemote
+	tracksLock       sync.RWMutex
 	onceClose        sync.Once
+	maxBitrate       uint64
+	levels           audioLevels
+	firSeq           uint32
+
+	// all audio tracks by their index in the metadata, audioTrack the first
+	audioTracks []*rtclib.TrackRemote
+	// the msid track ids of the audio tracks
+	audioIDs  []string
+	remoteSdp string
+
+	// the ssrc of the extended reports, this side sends no media
+	xrSSRC       uint32
+	qoeLock      sync.Mutex
+	fractionLost float64
+	rtt          time.Duration
+	mos          float64
+
+	// times the rtcp intervals
+	clock clock.Clock
 }
 
+const (
+	rembInterval   = time.Second
+	videoClockRate = 90000
+)
+
 func NewFrameSource(ctx context.Context, streamFactory rtclib.StreamFactory, preferTCP bool, keyFrameInterval time.Duration, logger *logrus.Entry) (fs *FrameSource, err error) {
 	if logger == nil {
 		logger = logrus.WithField("obj", "frame-source")
@@ -54,6 +84,8 @@ func NewFrameSource(ctx context.Context, streamFactory rtclib.StreamFactory, pre
 	fs = &FrameSource{
 		keyFrameInterval: keyFrameInterval,
 		logger:           logger,
+		xrSSRC:           rand.Uint32(),
+		clock:            clock.Default(),
 	}
 
 	fs.ctx, fs.cancel = context.WithCancel(ctx)
@@ -86,6 +118,16 @@ func (fs *FrameSource) createFrameSource(sdp webrtc.SessionDescription) (err err
 	}
 	fs.metadata = convMetadata(payloadUnion)
 
+	// publishers may send more than one audio track, e.g. a language each
+	tracks, ids := audioTracks(fs.remoteSdp, sdp.SDP)
+	if fs.metadata.Audio != nil && len(tracks) > 0 {
+		fs.metadata.Audio.Language, fs.metadata.Audio.Label = tracks[0].Language, tracks[0].Label
+		if len(tracks) > 1 {
+			tracks[0] = *fs.metadata.Audio
+			fs.metadata.AudioTracks, fs.audioIDs = tracks, ids
+		}
+	}
+
 	fs.logger.WithField("metadata", fs.metadata).Debug("metadata")
 
 	if fs.RemoteStream.LocalSdpType() == webrtc.SDPTypeAnswer {
@@ -96,6 +138,8 @@ func (fs *FrameSource) createFrameSource(sdp webrtc.SessionDescription) (err err
 }
 
 func (fs *FrameSource) SetRemoteDescription(remoteSdp webrtc.SessionDescription) (err error) {
+	fs.remoteSdp = remoteSdp.SDP
+
 	err = fs.RemoteStream.SetRemoteDescription(remoteSdp)
 	if err != nil {
 		return errors.Wrap(err, "failed to set remote description")
@@ -137,22 +181,86 @@ func (fs *FrameSource) Start() (err error) {
 }
 
 func (fs *FrameSource) gatheringTracks() error {
-	tracks, err := fs.RemoteStream.GatheringTracks(true, true, 20*time.Second)
+	audio := fs.metadata.AudioTrackCount()
+	if audio == 0 {
+		audio = 1
+	}
+
+	tracks, err := fs.RemoteStream.GatherTracks(audio, 1, 20*time.Second)
 	if err != nil {
 		return err
 	}
 
+	fs.tracksLock.Lock()
+	defer fs.tracksLock.Unlock()
+
+	fs.audioTracks = make([]*rtclib.TrackRemote, audio)
 	for _, track := range tracks {
 		if track.IsAudio() {
-			fs.audioTrack = track
+			fs.placeAudio(track)
 		} else if track.IsVideo() {
 			fs.videoTrack = track
 		}
 	}
+	fs.audioTrack = fs.audioTracks[0]
 
 	return nil
 }
 
+// placeAudio puts track at the index of its msid, the first free one
+// without.
+func (fs *FrameSource) placeAudio(track *rtclib.TrackRemote) {
+	for i, id := range fs.audioIDs {
+		if id != "" && id == track.ID() && fs.audioTracks[i] == nil {
+			fs.audioTracks[i] = track
+			return
+		}
+	}
+
+	for i := range fs.audioTracks {
+		if fs.audioTracks[i] == nil {
+			fs.audioTracks[i] = track
+			return
+		}
+	}
+}
+
+// tracks are the audio tracks and the video track.
+func (fs *FrameSource) tracks() []*rtclib.TrackRemote {
+	tracks := make([]*rtclib.TrackRemote, 0, len(fs.audioTracks)+1)
+	for _, track := range append(fs.audioTracks, fs.videoTrack) {
+		if track != nil {
+			tracks = append(tracks, track)
+		}
+	}
+
+	return tracks
+}
+
+func (fs *FrameSource) TransportStats() deliver.TransportStats {
+	stats := deliver.TransportStats{
+		Protocol: metrics.ProtocolWebRTC,
+	}
+
+	fs.tracksLock.RLock()
+	defer fs.tracksLock.RUnlock()
+
+	for _, track := range fs.tracks() {
+		stats.BytesReceived += track.BytesReceived()
+		stats.PacketsLost += track.PacketsLost()
+	}
+	stats.Jitter = float64(fs.jitter()) / float64(time.Millisecond)
+
+	fs.qoeLock.Lock()
+	defer fs.qoeLock.Unlock()
+
+	stats.FractionLost = fs.fractionLost
+	stats.RTT = float64(fs.rtt) / float64(time.Millisecond)
+	stats.MOS = fs.mos
+
+	return stats
+}
+
 func (fs *FrameSource) readRTP() {
 
 	err := fs.gatheringTracks()
@@ -161,19 +269,33 @@ func (fs *FrameSource) readRTP() {
 		return
 	}
 
-	if fs.audioTrack != nil {
-		go fs.loopReadRTP(fs.audioTrack)
-		go fs.loopReadRTCP(fs.audioTrack)
+	// sender reports of a track stamp its frames with the wall clock of the
+	// publisher, which syncs audio and video in the hub
+	for i, track := range fs.audioTracks {
+		if track == nil {
+			continue
+		}
+
+		clock := deliver.NewSenderClock(fs.metadata.AudioTrack(i).SampleRate)
+		go fs.loopReadRTP(track, i, clock)
+		go fs.loopReadRTCP(track, clock)
 	}
 
 	if fs.videoTrack != nil {
-		go fs.loopReadRTP(fs.videoTrack)
-		go fs.loopReadRTCP(fs.videoTrack)
+		clock := deliver.NewSenderClock(videoClockRate)
+		go fs.loopReadRTP(fs.videoTrack, 0, clock)
+		go fs.loopReadRTCP(fs.videoTrack, clock)
 
 		if fs.keyFrameInterval > 0 {
 			go fs.cycleKeyframe()
 		}
+
+		if fs.maxBitrate > 0 {
+			go fs.cycleREMB()
+		}
 	}
+
+	go fs.cycleXR()
 }
 
 func (fs *FrameSource) cycleKeyframe() {
@@ -181,7 +303,7 @@ func (fs *FrameSource) cycleKeyframe() {
 		select {
 		case <-fs.ctx.Done():
 			return
-		case <-time.After(fs.keyFrameInterval):
+		case <-fs.clock.After(fs.keyFrameInterval):
 			fs.sendPLI()
 		}
 	}
@@ -205,7 +327,150 @@ func (fs *FrameSource) sendPLI() {
 	fs.logger.WithField("track", fs.videoTrack.SSRC()).Debug("send pli")
 }
 
-func (fs *FrameSource) loopReadRTCP(track *rtclib.TrackRemote) {
+// sendFIR asks for a keyframe with a full intra request, for publishers
+// ignoring pli. The sequence number tells a new request from a repeated one.
+func (fs *FrameSource) sendFIR() {
+	if fs.videoTrack == nil {
+		return
+	}
+
+	ssrc := uint32(fs.videoTrack.SSRC())
+	err := fs.RemoteStream.PeerConnection.WriteRTCP([]rtcp.Packet{
+		&rtcp.FullIntraRequest{
+			MediaSSRC: ssrc,
+			FIR: []rtcp.FIREntry{{
+				SSRC:           ssrc,
+				SequenceNumber: uint8(atomic.AddUint32(&fs.firSeq, 1)),
+			}},
+		},
+	})
+	if err != nil {
+		fs.logger.WithError(err).Error("failed to send fir")
+		return
+	}
+
+	fs.logger.WithField("track", ssrc).Debug("send fir")
+}
+
+// SetMaxBitrate asks the publisher to stay below bitrate via REMB, it must be
+// called before Start.
+func (fs *FrameSource) SetMaxBitrate(bitrate uint64) {
+	fs.maxBitrate = bitrate
+}
+
+func (fs *FrameSource) cycleREMB() {
+	for {
+		select {
+		case <-fs.ctx.Done():
+			return
+		case <-fs.clock.After(rembInterval):
+			fs.sendREMB()
+		}
+	}
+}
+
+func (fs *FrameSource) sendREMB() {
+	if fs.videoTrack == nil {
+		return
+	}
+
+	err := fs.RemoteStream.PeerConnection.WriteRTCP([]rtcp.Packet{
+		&rtcp.ReceiverEstimatedMaximumBitrate{
+			Bitrate: float32(fs.maxBitrate),
+			SSRCs:   []uint32{uint32(fs.videoTrack.SSRC())},
+		},
+	})
+	if err != nil {
+		fs.logger.WithError(err).Error("failed to send remb")
+	}
+}
+
+func (fs *FrameSource) cycleXR() {
+	for {
+		select {
+		case <-fs.ctx.Done():
+			return
+		case <-fs.clock.After(xrInterval):
+			fs.sendXR()
+		}
+	}
+}
+
+// sendXR reports the loss of the last interval to the publisher and scores
+// it. The reference time block asks for a dlrr answer, the round trip time.
+func (fs *FrameSource) sendXR() {
+	xr := &rtcp.ExtendedReport{
+		SenderSSRC: fs.xrSSRC,
+		Reports: []rtcp.ReportBlock{
+			&rtcp.ReceiverReferenceTimeReportBlock{NTPTimestamp: toNTP(fs.clock.Now())},
+		},
+	}
+
+	expected, lost := 0, 0
+	for _, track := range fs.tracks() {
+		if block := track.LossReport(); block != nil {
+			xr.Reports = append(xr.Reports, block)
+			e, l := rtclib.LossRLECounts(block)
+			expected += e
+			lost += l
+		}
+	}
+
+	fs.qoeLock.Lock()
+	if expected > 0 {
+		fs.fractionLost = float64(lost) / float64(expected)
+	}
+	fractionLost, rtt := fs.fractionLost, fs.rtt
+	mos, r := estimateMOS(fractionLost, rtt, fs.jitter())
+	fs.mos = mos
+	fs.qoeLock.Unlock()
+
+	if fs.audioTrack != nil {
+		xr.Reports = append(xr.Reports, voipMetrics(uint32(fs.audioTrack.SSRC()), fractionLost, rtt, mos, r))
+	}
+
+	if err := fs.RemoteStream.PeerConnection.WriteRTCP([]rtcp.Packet{xr}); err != nil {
+		fs.logger.WithError(err).Error("failed to send xr")
+	}
+}
+
+// jitter is the larger jitter of the tracks.
+func (fs *FrameSource) jitter() time.Duration {
+	var jitter time.Duration
+	for _, track := range fs.tracks() {
+		if track.Jitter() > jitter {
+			jitter = track.Jitter()
+		}
+	}
+
+	return jitter
+}
+
+// onXR takes the round trip time from the publisher's answers to the
+// reference time blocks of sendXR.
+func (fs *FrameSource) onXR(xr *rtcp.ExtendedReport) {
+	now := fs.clock.Now()
+	for _, block := range xr.Reports {
+		b, ok := block.(*rtcp.DLRRReportBlock)
+		if !ok {
+			continue
+		}
+
+		for _, r := range b.Reports {
+			if r.SSRC != fs.xrSSRC {
+				continue
+			}
+
+			if rtt, ok := rttFromDLRR(r, now); ok {
+				fs.qoeLock.Lock()
+				fs.rtt = rtt
+				fs.qoeLock.Unlock()
+			}
+		}
+	}
+}
+
+func (fs *FrameSource) loopReadRTCP(track *rtclib.TrackRemote, clock *deliver.SenderClock) {
 	defer func() {
 		if r := recover(); r != nil {
 			fs.logger.WithField("error", r).Error("loopReadRTCP panic")
@@ -219,7 +484,7 @@ func (fs *FrameSource) loopReadRTCP(track *rtclib.TrackRemote) {
 		case <-fs.ctx.Done():
 			return
 		default:
-			_, _, err := track.ReadRTCP(buf)
+			n, _, err := track.ReadRTCP(buf)
 			if err != nil {
 				if errors.Is(err, io.EOF) {
 					fs.logger.WithError(err).Info("read rtcp EOF")
@@ -228,13 +493,32 @@ func (fs *FrameSource) loopReadRTCP(track *rtclib.TrackRemote) {
 				}
 
 				fs.logger.WithError(err).Error("failed to read rtcp")
+				continue
+			}
+
+			packets, err := rtcp.Unmarshal(buf[:n])
+			if err != nil {
+				continue
+			}
+
+			for _, p := range packets {
+				switch p := p.(type) {
+				case *rtcp.SenderReport:
+					if p.SSRC == uint32(track.SSRC()) {
+						clock.Update(p.NTPTime, p.RTPTime)
+					}
+				case *rtcp.ExtendedReport:
+					fs.onXR(p)
+				}
 			}
 
 		}
 	}
 }
 
-func (fs *FrameSource) loopReadRTP(track *rtclib.TrackRemote) {
+// loopReadRTP delivers the frames of track, index is that of an audio
+// track, see deliver.Frame.Track.
+func (fs *FrameSource) loopReadRTP(track *rtclib.TrackRemote, index int, clock *deliver.SenderClock) {
 	defer func() {
 		if r := recover(); r != nil {
 			fs.logger.WithField("error", r).Error("loopReadRTP panic")
@@ -242,12 +526,17 @@ func (fs *FrameSource) loopReadRTP(track *rtclib.TrackRemote) {
 		}
 	}()
 
+	var audioLevelID uint8
+	if track.IsAudio() && index == 0 {
+		audioLevelID = track.HeaderExtensionID(sdp.AudioLevelURI)
+	}
+
 	for {
 		select {
 		case <-fs.ctx.Done():
 			return
 		default:
-			rtpPacket, err := track.ReadRTP()
+			rtpPacket, buf, err := track.ReadRTPBuffer()
 			if err != nil {
 				if errors.Is(err, io.EOF) {
 					fs.logger.WithField("track", track.SSRC()).Info("read rtp EOF")
@@ -255,39 +544,65 @@ func (fs *FrameSource) loopReadRTP(track *rtclib.TrackRemote) {
 					return
 				}
 				fs.logger.WithError(err).Error("failed to read frame")
+				deliver.CountDecodeError(fs.FrameSource)
+				continue
 			}
 
 			//fs.logger.WithField("rtpPacket", rtpPacket).Debug("read rtp packet")
 
 			var codec deliver.CodecType
 			if track.IsAudio() {
-				codec = deliver.ConvCodecType(fs.metadata.Audio.Codec)
+				codec = deliver.ConvCodecType(fs.metadata.AudioTrack(index).Codec)
 			} else if track.IsVideo() {
 				codec = deliver.ConvCodecType(fs.metadata.Video.Codec)
 			}
 
 			var additionalInfo deliver.FrameSpecificInfo
 			if track.IsAudio() {
-				additionalInfo = &deliver.AudioFrameSpecificInfo{
-					SampleRate: fs.metadata.Audio.SampleRate,
+				info := &deliver.AudioFrameSpecificInfo{
+					SampleRate: fs.metadata.AudioTrack(index).SampleRate,
 				}
+				if audioLevelID != 0 {
+					if level, voice, ok := fs.levels.observe(rtpPacket, audioLevelID); ok {
+						info.AudioLevel = level
+						if voice {
+							info.Voice = 1
+						}
+					}
+				}
+				additionalInfo = info
 			} else if track.IsVideo() {
-				additionalInfo = &deliver.VideoFrameSpecificInfo{}
+				additionalInfo = &deliver.VideoFrameSpecificInfo{
+					IsKeyFrame: rtclib.IsKeyframe(codec, rtpPacket.Payload),
+				}
 			}
 
 			frame := deliver.Frame{
 				Codec:          codec,
 				PacketType:     deliver.PacketTypeRtp,
-				Length:         0,
+				Length:         rtpPacket.MarshalSize(),
 				TimeStamp:      rtpPacket.Timestamp,
+				NTPTime:        clock.Time(rtpPacket.Timestamp),
 				AdditionalInfo: additionalInfo,
 				RawPacket:      rtpPacket,
+				Track:          index,
+				Buffer:         buf,
 			}
 			fs.DeliverFrame(frame, nil)
+			buf.Release()
 		}
 	}
 }
 
+// OnAudioLevel is called with the average audio level and whether there was
+// voice activity about twice a second, if the publisher sends levels.
+func (fs *FrameSource) OnAudioLevel(f func(level uint8, voice bool)) {
+	fs.levels.lock.Lock()
+	defer fs.levels.lock.Unlock()
+
+	fs.levels.onLevel = f
+}
+
 // func (fs *FrameSource) LocalSdp() webrtc.SessionDescription {
 // 	return fs.lsdp
 // }
@@ -306,8 +621,10 @@ func (fs *FrameSource) OnFeedback(feedback deliver.FeedbackMsg) {
 	}
 
 	switch feedback.Cmd {
-	case deliver.FeedbackCmdPLI:
+	case deliver.FeedbackCmdPLI, deliver.FeedbackCmdKeyFrame:
 		fs.sendPLI()
+	case deliver.FeedbackCmdFIR:
+		fs.sendFIR()
 	}
 
 }
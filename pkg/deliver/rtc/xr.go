@@ -0,0 +1,94 @@
+package rtc
+
+import (
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+const (
+	// publishers get an extended report this often
+	xrInterval = 5 * time.Second
+	// the value of voip metrics fields with no measurement, RFC 3611 4.7
+	xrUnavailable = 127
+)
+
+// estimateMOS maps loss, round trip time and jitter to a mean opinion score
+// between 1 and 4.5 with the E-model of ITU-T G.107, the codec assumed ideal
+// and the loss random.
+func estimateMOS(fractionLost float64, rtt, jitter time.Duration) (mos, r float64) {
+	// one way delay, a jitter buffer of twice the jitter and 10ms of codec
+	delay := float64(rtt/2+2*jitter)/float64(time.Millisecond) + 10
+
+	id := 0.024 * delay
+	if delay > 177.3 {
+		id += 0.11 * (delay - 177.3)
+	}
+
+	loss := fractionLost * 100
+	ie := 95 * loss / (loss + 25.1)
+
+	r = 93.2 - id - ie
+	switch {
+	case r < 0:
+		r = 0
+	case r > 100:
+		r = 100
+	}
+
+	mos = 1 + 0.035*r + 7e-6*r*(r-60)*(100-r)
+	if mos < 1 {
+		mos = 1
+	}
+
+	return mos, r
+}
+
+// voipMetrics is the voip metrics block of an audio stream, the fields this
+// side can't measure are unavailable.
+func voipMetrics(ssrc uint32, fractionLost float64, rtt time.Duration, mos, r float64) *rtcp.VoIPMetricsReportBlock {
+	lossRate := fractionLost * 256
+	if lossRate > 255 {
+		lossRate = 255
+	}
+
+	roundTrip := rtt / time.Millisecond
+	if roundTrip > 0xffff {
+		roundTrip = 0xffff
+	}
+
+	return &rtcp.VoIPMetricsReportBlock{
+		SSRC:           ssrc,
+		LossRate:       uint8(lossRate),
+		RoundTripDelay: uint16(roundTrip),
+		SignalLevel:    xrUnavailable,
+		NoiseLevel:     xrUnavailable,
+		RERL:           xrUnavailable,
+		Gmin:           16,
+		RFactor:        uint8(r),
+		ExtRFactor:     xrUnavailable,
+		MOSLQ:          uint8(mos * 10),
+		MOSCQ:          uint8(mos * 10),
+	}
+}
+
+// reportedMOS reads the listening quality score of a voip metrics block, false
+// when the peer has none.
+func reportedMOS(b *rtcp.VoIPMetricsReportBlock) (float64, bool) {
+	if b.MOSLQ < 10 || b.MOSLQ > 50 {
+		return 0, false
+	}
+
+	return float64(b.MOSLQ) / 10, true
+}
+
+// dlrr answers a receiver reference time block received at, RFC 3611 4.5.
+func dlrr(ssrc uint32, b *rtcp.ReceiverReferenceTimeReportBlock, at, now time.Time) *rtcp.DLRRReportBlock {
+	return &rtcp.DLRRReportBlock{
+		Reports: []rtcp.DLRRReport{{
+			SSRC:   ssrc,
+			LastRR: uint32(b.NTPTimestamp >> 16),
+			DLRR:   uint32(now.Sub(at) * 65536 / time.Second),
+		}},
+	}
+}
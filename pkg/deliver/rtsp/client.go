@@ -0,0 +1,463 @@
+package rtsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/auth"
+	"github.com/pingostack/neon/pkg/deliver"
+	rtspproto "github.com/pingostack/neon/protocols/rtsp"
+	"github.com/pion/sdp/v3"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	Protocol = "rtsp"
+
+	defaultPort        = "554"
+	defaultDialTimeout = 5 * time.Second
+	// servers time sessions out after 60 seconds unless they tell
+	defaultSessionTimeout = 60 * time.Second
+	readBufferSize        = 64 * 1024
+)
+
+// conn is the connection of a pull, the requests are answered in order and
+// the media is interleaved.
+type conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	client *rtspproto.Client
+	// url is the stream without the credentials
+	url     *url.URL
+	user    *url.Userinfo
+	timeout time.Duration
+	session string
+	// authorize is the Authorization of a request once challenged
+	authorize func(method, uri string) string
+	// keepAlive is how often the session is refreshed
+	keepAlive   time.Duration
+	requestLock sync.Mutex
+	lock        sync.Mutex
+}
+
+// Dial pulls the stream at rawURL over interleaved tcp, the credentials of
+// the url answer basic and digest challenges. It returns once PLAY was
+// answered, the first video and the first audio track are played.
+func Dial(ctx context.Context, rawURL string, timeout time.Duration, logger *logrus.Entry) (*FrameSource, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != Protocol || u.Host == "" {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidURL, rawURL)
+	}
+
+	if timeout <= 0 {
+		timeout = defaultDialTimeout
+	}
+
+	if logger == nil {
+		logger = logrus.WithField("obj", "rtsp-client")
+	} else {
+		logger = logger.WithField("obj", "rtsp-client")
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	nc, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &conn{
+		conn:      nc,
+		reader:    bufio.NewReaderSize(nc, readBufferSize),
+		client:    rtspproto.NewClient(nil),
+		url:       redact(u),
+		user:      u.User,
+		timeout:   timeout,
+		keepAlive: defaultSessionTimeout / 3,
+	}
+	c.client.Write = c.write
+
+	fs, err := c.play(ctx, logger.WithField("url", c.url.String()))
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	return fs, nil
+}
+
+// redact is u without the credentials.
+func redact(u *url.URL) *url.URL {
+	ret := *u
+	ret.User = nil
+
+	return &ret
+}
+
+func (c *conn) write(data []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	_, err := c.conn.Write(data)
+
+	return err
+}
+
+func (c *conn) newRequest(method, uri string) *rtspproto.Request {
+	req := c.client.NewRequest(method)
+	req.SetUrl(uri)
+	if c.session != "" {
+		req.SetLine("Session", c.session)
+	}
+	if c.authorize != nil {
+		req.SetLine("Authorization", c.authorize(method, uri))
+	}
+
+	return req
+}
+
+// send sends a request of the session whose response is not waited for, the
+// reader of the media drops it.
+func (c *conn) send(method string) error {
+	c.requestLock.Lock()
+	req := c.newRequest(method, c.url.String())
+	c.requestLock.Unlock()
+
+	return c.write([]byte(req.String()))
+}
+
+// do sends a request and reads its response, once more with credentials
+// when challenged. set adds the lines of the method to the request.
+func (c *conn) do(method, uri string, set func(req *rtspproto.Request)) (*rtspproto.Response, error) {
+	for challenged := false; ; challenged = true {
+		req := c.newRequest(method, uri)
+		if set != nil {
+			set(req)
+		}
+
+		if err := c.write([]byte(req.String())); err != nil {
+			return nil, err
+		}
+
+		c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+		resp, err := c.readResponse()
+		c.conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			return nil, err
+		}
+
+		status := resp.Status()
+		if status == rtspproto.StatusUnauthorized && !challenged {
+			if err := c.challenge(resp); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if status == rtspproto.StatusUnauthorized {
+			return nil, ErrUnauthorized
+		}
+
+		if status < 200 || status >= 300 {
+			return nil, fmt.Errorf("rtsp %s: %d", method, status)
+		}
+
+		return resp, nil
+	}
+}
+
+// challenge answers the WWW-Authenticate of resp from now on, digest when
+// offered.
+func (c *conn) challenge(resp *rtspproto.Response) error {
+	if c.user == nil {
+		return ErrUnauthorized
+	}
+
+	username := c.user.Username()
+	password, _ := c.user.Password()
+
+	basic := false
+	for _, header := range resp.GetLines("www-authenticate") {
+		if realm, nonce, err := auth.ParseDigestChallenge(header); err == nil {
+			c.authorize = func(method, uri string) string {
+				return auth.DigestAuthorization(username, password, realm, nonce, method, uri)
+			}
+			return nil
+		}
+
+		if strings.HasPrefix(strings.ToLower(header), "basic") {
+			basic = true
+		}
+	}
+
+	if !basic {
+		return ErrUnauthorized
+	}
+
+	credentials := "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	c.authorize = func(_, _ string) string {
+		return credentials
+	}
+
+	return nil
+}
+
+// read reads the next response or interleaved packet, resp is nil for the
+// latter.
+func (c *conn) read() (resp *rtspproto.Response, channel int, payload []byte, err error) {
+	b, err := c.reader.Peek(1)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	if b[0] != '$' {
+		resp, err = c.readResponse()
+		return resp, 0, nil, err
+	}
+
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(c.reader, head); err != nil {
+		return nil, 0, nil, err
+	}
+
+	payload = make([]byte, int(head[2])<<8|int(head[3]))
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return nil, 0, nil, err
+	}
+
+	return nil, int(head[1]), payload, nil
+}
+
+// readResponse reads a response, interleaved packets before it are dropped.
+func (c *conn) readResponse() (*rtspproto.Response, error) {
+	for {
+		b, err := c.reader.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+
+		if b[0] == '$' {
+			head, err := c.reader.Peek(4)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := c.reader.Discard(4 + (int(head[2])<<8 | int(head[3]))); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		break
+	}
+
+	var buf []byte
+	length := 0
+	for {
+		line, err := c.reader.ReadSlice('\n')
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, line...)
+		if len(buf) > rtspproto.DefaultLimits.MaxHeaderSize {
+			return nil, rtspproto.ErrHeaderTooLarge
+		}
+
+		if key, value, ok := strings.Cut(string(line), ":"); ok && strings.EqualFold(strings.TrimSpace(key), "content-length") {
+			length, _ = strconv.Atoi(strings.TrimSpace(value))
+		}
+
+		if len(strings.TrimSpace(string(line))) == 0 {
+			break
+		}
+	}
+
+	if length < 0 || length > rtspproto.DefaultLimits.MaxContentLength {
+		return nil, fmt.Errorf("%w: %d bytes", rtspproto.ErrContentTooLarge, length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return nil, err
+	}
+
+	resp, _, err := rtspproto.UnmarshalResponseWithLimits(append(buf, body...), rtspproto.DefaultLimits)
+	return resp, err
+}
+
+// setSession takes the session of a SETUP response, and the timeout it
+// tells to keep it alive in time.
+func (c *conn) setSession(resp *rtspproto.Response) {
+	session, params, _ := strings.Cut(resp.Session(), ";")
+	if session = strings.TrimSpace(session); session != "" {
+		c.session = session
+	}
+
+	for _, param := range strings.Split(params, ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		if !strings.EqualFold(key, "timeout") {
+			continue
+		}
+
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			c.keepAlive = time.Duration(seconds) * time.Second / 3
+		}
+	}
+}
+
+// play describes, sets up and plays the stream.
+func (c *conn) play(ctx context.Context, logger *logrus.Entry) (*FrameSource, error) {
+	resp, err := c.do("DESCRIBE", c.url.String(), func(req *rtspproto.Request) {
+		req.SetLine("Accept", "application/sdp")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	base := resp.Line("content-base")
+	if base == "" {
+		base = resp.Line("content-location")
+	}
+	if base == "" {
+		base = c.url.String()
+	}
+
+	var sd sdp.SessionDescription
+	if err := sd.Unmarshal(resp.Content()); err != nil {
+		return nil, err
+	}
+
+	metadata, setups := selectTracks(&sd, base)
+	if len(setups) == 0 {
+		return nil, ErrNoTracks
+	}
+
+	tracks := make(map[int]track)
+	for i, setup := range setups {
+		transport := rtspproto.NewTcpTransport(rtspproto.RtpProfileAVP, []int{2 * i, 2*i + 1})
+		resp, err := c.do("SETUP", setup.control, func(req *rtspproto.Request) {
+			req.SetLine("Transport", transport.String())
+		})
+		if err != nil {
+			return nil, err
+		}
+		c.setSession(resp)
+
+		channel := 2 * i
+		if t, err := rtspproto.UnmarshalTransport(resp.Line("transport")); err == nil && t.RtpInterleaved() >= 0 {
+			channel = t.RtpInterleaved()
+		}
+		tracks[channel] = setup.track
+	}
+
+	if _, err := c.do("PLAY", base, func(req *rtspproto.Request) {
+		req.SetLine("Range", "npt=0.000-")
+	}); err != nil {
+		return nil, err
+	}
+
+	fs := newFrameSource(ctx, c, metadata, tracks, logger)
+	go fs.run()
+
+	return fs, nil
+}
+
+type setup struct {
+	control string
+	track   track
+}
+
+// selectTracks picks the first video and the first audio of a codec that is
+// delivered and returns their metadata and the urls they are set up with.
+func selectTracks(sd *sdp.SessionDescription, base string) (deliver.Metadata, []setup) {
+	metadata := deliver.Metadata{PacketType: deliver.PacketTypeRtp}
+	var setups []setup
+
+	for _, md := range sd.MediaDescriptions {
+		if len(md.MediaName.Formats) == 0 {
+			continue
+		}
+
+		pt, err := strconv.Atoi(md.MediaName.Formats[0])
+		if err != nil {
+			continue
+		}
+
+		rtpCodec, err := sd.GetCodecForPayloadType(uint8(pt))
+		if err != nil {
+			continue
+		}
+
+		codec := codecType(rtpCodec.Name)
+		switch {
+		case codec.IsVideo() && metadata.Video == nil:
+			metadata.Video = &deliver.VideoMetadata{
+				Codec:          codec.String(),
+				CodecType:      codec,
+				RtpPayloadType: uint8(pt),
+				ClockRate:      rtpCodec.ClockRate,
+			}
+		case codec.IsAudio() && metadata.Audio == nil:
+			channels := uint8(1)
+			if n, err := strconv.Atoi(rtpCodec.EncodingParameters); err == nil && n > 0 {
+				channels = uint8(n)
+			}
+
+			metadata.Audio = &deliver.AudioMetadata{
+				Codec:          codec.String(),
+				CodecType:      codec,
+				SampleRate:     rtpCodec.ClockRate,
+				Channels:       channels,
+				RtpPayloadType: uint8(pt),
+			}
+		default:
+			continue
+		}
+
+		control, _ := md.Attribute("control")
+		setups = append(setups, setup{
+			control: controlURL(base, control),
+			track:   track{codec: codec, clockRate: rtpCodec.ClockRate},
+		})
+	}
+
+	return metadata, setups
+}
+
+// codecType maps an rtpmap encoding name.
+func codecType(name string) deliver.CodecType {
+	switch strings.ToUpper(name) {
+	case "MPEG4-GENERIC":
+		return deliver.CodecTypeAAC
+	case "G722":
+		return deliver.CodecTypeG722_16000_1
+	case "HEVC":
+		return deliver.CodecTypeH265
+	}
+
+	return deliver.ConvCodecType(name)
+}
+
+func controlURL(base, control string) string {
+	switch {
+	case strings.Contains(control, "://"):
+		return control
+	case control == "" || control == "*":
+		return base
+	}
+
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(control, "/")
+}
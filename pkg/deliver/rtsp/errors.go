@@ -0,0 +1,10 @@
+package rtsp
+
+import "errors"
+
+var (
+	ErrInvalidURL   = errors.New("invalid rtsp url")
+	ErrUnauthorized = errors.New("rtsp unauthorized")
+	ErrNoTracks     = errors.New("rtsp stream without supported tracks")
+	ErrClosed       = errors.New("rtsp source closed")
+)
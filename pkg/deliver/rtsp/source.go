@@ -0,0 +1,141 @@
+package rtsp
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/rtclib"
+	"github.com/pion/rtp"
+	"github.com/sirupsen/logrus"
+)
+
+type track struct {
+	codec     deliver.CodecType
+	clockRate uint32
+}
+
+// FrameSource is the stream of an rtsp server, e.g. a camera, played over
+// one connection.
+type FrameSource struct {
+	deliver.FrameSource
+	conn *conn
+	// by the interleaved channel of their rtp
+	tracks    map[int]track
+	logger    *logrus.Entry
+	closeOnce sync.Once
+	lock      sync.Mutex
+	err       error
+	bytes     uint64
+}
+
+func newFrameSource(ctx context.Context, c *conn, metadata deliver.Metadata, tracks map[int]track, logger *logrus.Entry) *FrameSource {
+	return &FrameSource{
+		FrameSource: deliver.NewFrameSourceImpl(ctx, metadata),
+		conn:        c,
+		tracks:      tracks,
+		logger:      logger,
+	}
+}
+
+// run delivers the packets until the connection fails or the source is
+// closed, the session is kept alive meanwhile.
+func (fs *FrameSource) run() {
+	go fs.keepAlive()
+
+	for {
+		resp, channel, payload, err := fs.conn.read()
+		if err != nil {
+			fs.closeWith(err)
+			return
+		}
+
+		// answers to the keep alives and rtcp
+		if resp != nil || channel%2 != 0 {
+			continue
+		}
+
+		t, ok := fs.tracks[channel]
+		if !ok {
+			continue
+		}
+
+		packet := &rtp.Packet{}
+		if err := packet.Unmarshal(payload); err != nil {
+			continue
+		}
+		atomic.AddUint64(&fs.bytes, uint64(len(payload)))
+
+		frame := deliver.Frame{
+			Codec:      t.codec,
+			PacketType: deliver.PacketTypeRtp,
+			Length:     len(payload),
+			TimeStamp:  packet.Timestamp,
+			RawPacket:  packet,
+		}
+		if t.codec.IsVideo() {
+			frame.AdditionalInfo = &deliver.VideoFrameSpecificInfo{IsKeyFrame: rtclib.IsKeyframe(t.codec, packet.Payload)}
+		} else {
+			frame.AdditionalInfo = &deliver.AudioFrameSpecificInfo{SampleRate: t.clockRate}
+		}
+
+		fs.FrameSource.DeliverFrame(frame, nil)
+	}
+}
+
+func (fs *FrameSource) keepAlive() {
+	ticker := time.NewTicker(fs.conn.keepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-fs.Context().Done():
+			return
+		case <-ticker.C:
+			if err := fs.conn.send("GET_PARAMETER"); err != nil {
+				fs.logger.WithError(err).Debug("keep alive failed")
+			}
+		}
+	}
+}
+
+func (fs *FrameSource) TransportStats() deliver.TransportStats {
+	return deliver.TransportStats{
+		Protocol:      Protocol,
+		BytesReceived: atomic.LoadUint64(&fs.bytes),
+	}
+}
+
+// Err tells why the source was closed.
+func (fs *FrameSource) Err() error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	return fs.err
+}
+
+func (fs *FrameSource) closeWith(err error) {
+	fs.closeOnce.Do(func() {
+		fs.lock.Lock()
+		fs.err = err
+		fs.lock.Unlock()
+
+		fs.conn.conn.Close()
+		fs.FrameSource.Close()
+	})
+}
+
+// Close tears the session down.
+func (fs *FrameSource) Close() {
+	fs.closeOnce.Do(func() {
+		fs.lock.Lock()
+		fs.err = ErrClosed
+		fs.lock.Unlock()
+
+		fs.conn.send("TEARDOWN")
+		fs.conn.conn.Close()
+		fs.FrameSource.Close()
+	})
+}
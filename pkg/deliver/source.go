@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/gogf/gf/util/guid"
+	"github.com/pingostack/neon/pkg/metrics"
 )
 
 type DestinationInfo struct {
@@ -17,20 +19,38 @@ type DestinationInfo struct {
 type FrameSourceImpl struct {
 	dests     []FrameDestination
 	destIndex map[FrameDestination]FrameDestination
+	cursors   map[FrameDestination]context.CancelFunc
+	ring      *frameRing
 	lock      sync.RWMutex
 	ctx       context.Context
 	cancel    context.CancelFunc
 	closed    bool
 	metadata  Metadata
 	id        string
+	meter     *rateMeter
+	batch     time.Duration
 }
 
 func NewFrameSourceImpl(ctx context.Context, metadata Metadata) FrameSource {
+	return NewFanoutFrameSource(ctx, metadata, FanoutOptions{})
+}
+
+// NewFanoutFrameSource is a source with its own fan-out tuning, e.g. for
+// large audiences.
+func NewFanoutFrameSource(ctx context.Context, metadata Metadata, opts FanoutOptions) FrameSource {
+	if opts.RingSize <= 0 {
+		opts.RingSize = defaultRingSize
+	}
+
 	fs := &FrameSourceImpl{
 		metadata:  metadata,
 		id:        guid.S(),
 		dests:     make([]FrameDestination, 0),
 		destIndex: make(map[FrameDestination]FrameDestination),
+		cursors:   make(map[FrameDestination]context.CancelFunc),
+		ring:      newFrameRing(opts.RingSize),
+		meter:     newRateMeter(),
+		batch:     opts.Batch,
 	}
 
 	fs.ctx, fs.cancel = context.WithCancel(ctx)
@@ -48,6 +68,7 @@ func NewFrameSourceImpl(ctx context.Context, metadata Metadata) FrameSource {
 		}()
 
 		fs.closed = true
+		fs.ring.close()
 
 		for _, d := range fs.dests {
 			d.unsetSource()
@@ -78,9 +99,49 @@ func (fs *FrameSourceImpl) addDestination(dest FrameDestination) error {
 
 	dest.OnMetaData(&fs.metadata)
 
+	ctx, cancel := context.WithCancel(fs.ctx)
+	fs.cursors[dest] = cancel
+	go fs.feed(ctx, dest, fs.ring.reader(fs.batch))
+
 	return nil
 }
 
+// feed hands the frames of the ring to one destination, in its own goroutine
+// so a slow destination only falls behind itself.
+func (fs *FrameSourceImpl) feed(ctx context.Context, dest FrameDestination, rr *ringReader) {
+	defer func() {
+		if err := recover(); err != nil {
+			fmt.Printf("FrameSource feed panic %v", err)
+		}
+	}()
+
+	for {
+		e, skipped, err := rr.next(ctx)
+		if err != nil {
+			return
+		}
+
+		if dest.Context().Err() != nil {
+			if e.frame.Buffer != nil {
+				e.frame.Buffer.Release()
+			}
+			return
+		}
+
+		if skipped > 0 {
+			if gr, ok := dest.(FrameGapReceiver); ok {
+				gr.OnFrameGap(skipped)
+			}
+		}
+
+		dest.OnFrame(e.frame, e.attr)
+
+		if e.frame.Buffer != nil {
+			e.frame.Buffer.Release()
+		}
+	}
+}
+
 func (fs *FrameSourceImpl) AddDestination(dest FrameDestination) error {
 	return AddDestination(fs, dest)
 }
@@ -95,10 +156,6 @@ func (fs *FrameSourceImpl) RemoveDestination(dest FrameDestination) error {
 		return ErrFrameSourceClosed
 	}
 
-	if !fs.metadata.HasAudio() {
-		return ErrFrameSourceAudioNotSupport
-	}
-
 	for i, d := range fs.dests {
 		if d == dest {
 			fs.dests = append(fs.dests[:i], fs.dests[i+1:]...)
@@ -108,6 +165,10 @@ func (fs *FrameSourceImpl) RemoveDestination(dest FrameDestination) error {
 	}
 
 	delete(fs.destIndex, dest)
+	if cancel, ok := fs.cursors[dest]; ok {
+		cancel()
+		delete(fs.cursors, dest)
+	}
 
 	return nil
 }
@@ -122,13 +183,43 @@ func (fs *FrameSourceImpl) DeliverFrame(frame Frame, attr Attributes) error {
 		return ErrFrameSourceClosed
 	}
 
-	for _, d := range fs.dests {
-		d.OnFrame(frame, attr)
+	if frame.Length > 0 {
+		fs.meter.add(frame, frame.Length, fs.clockRate(frame.Codec))
+	} else {
+		fs.meter.add(frame, len(frame.Payload), fs.clockRate(frame.Codec))
 	}
 
+	start := time.Now()
+	fs.ring.write(frame, attr)
+	metrics.FrameLatency.With(fs.metadata.PacketType.String()).Observe(time.Since(start).Seconds())
+
 	return nil
 }
 
+func (fs *FrameSourceImpl) clockRate(codec CodecType) uint32 {
+	if codec.IsAudio() {
+		return fs.metadata.Audio.SampleRate
+	}
+
+	if fs.metadata.Video.ClockRate != 0 {
+		return fs.metadata.Video.ClockRate
+	}
+
+	return videoClockRate
+}
+
+func (fs *FrameSourceImpl) countDecodeError() {
+	fs.meter.decodeError()
+}
+
+// CountDecodeError counts a packet of the publisher of source that could not
+// be read, see SourceStats.DecodeErrors.
+func CountDecodeError(source FrameSource) {
+	if c, ok := source.(interface{ countDecodeError() }); ok {
+		c.countDecodeError()
+	}
+}
+
 func (fs *FrameSourceImpl) OnFeedback(fb FeedbackMsg) {
 	fs.lock.RLock()
 	defer func() {
@@ -163,6 +254,10 @@ func (fs *FrameSourceImpl) Metadata() *Metadata {
 	return &fs.metadata
 }
 
+func (fs *FrameSourceImpl) Stats() SourceStats {
+	return fs.meter.stats()
+}
+
 func (fs *FrameSourceImpl) Close() {
 	fs.cancel()
 }
@@ -2,7 +2,11 @@ package deliver
 
 import (
 	"encoding/json"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/pingostack/neon/pkg/bufpool"
 )
 
 type CodecType int
@@ -191,13 +195,26 @@ type FrameSpecificInfo interface {
 }
 
 type Frame struct {
-	Codec          CodecType
-	PacketType     PacketType
-	Payload        []byte
-	RawPacket      interface{}
-	Length         int
-	TimeStamp      uint32
-	AdditionalInfo FrameSpecificInfo
+	Codec      CodecType
+	PacketType PacketType
+	Payload    []byte
+	RawPacket  interface{}
+	Length     int
+	TimeStamp  uint32
+	// NTPTime is the wall clock of the publisher at TimeStamp, known from
+	// its sender reports, zero without them.
+	NTPTime time.Time
+	// CompositionOffset is how long after its decoding timestamp a frame
+	// reordered by the encoder, e.g. a B-frame, is presented, TimeStamp
+	// being the presentation timestamp. Zero for most frames.
+	CompositionOffset uint32
+	AdditionalInfo    FrameSpecificInfo
+	// Track is the index of the audio track of the frame in
+	// Metadata.AudioTracks, 0 for the first and every other frame.
+	Track int
+	// Buffer backs Payload/RawPacket when the source reads into pooled memory,
+	// destinations that keep the frame after OnFrame returns must Retain it.
+	Buffer *bufpool.Buffer
 }
 
 type AudioMetadata struct {
@@ -206,6 +223,10 @@ type AudioMetadata struct {
 	SampleRate     uint32    `json:"sampleRate"`
 	Channels       uint8     `json:"channels"`
 	RtpPayloadType uint8     `json:"rtpPayloadType"`
+	// Language is a bcp 47 tag, e.g. en or pt-BR, and Label names the track
+	// to people, either empty.
+	Language string `json:"language,omitempty"`
+	Label    string `json:"label,omitempty"`
 }
 
 type VideoMetadata struct {
@@ -224,10 +245,13 @@ type DataMetadata struct {
 }
 
 type Metadata struct {
-	Audio      *AudioMetadata `json:"audio"`
-	Video      *VideoMetadata `json:"video"`
-	Data       *DataMetadata  `json:"data"`
-	PacketType PacketType     `json:"packetType"`
+	Audio *AudioMetadata `json:"audio"`
+	// AudioTracks are all audio tracks of a source with more than one,
+	// Audio being the first. Their frames are told apart by Frame.Track.
+	AudioTracks []AudioMetadata `json:"audioTracks,omitempty"`
+	Video       *VideoMetadata  `json:"video"`
+	Data        *DataMetadata   `json:"data"`
+	PacketType  PacketType      `json:"packetType"`
 }
 
 func (md *Metadata) String() string {
@@ -291,17 +315,79 @@ func (md *Metadata) MatchFormat(md2 *Metadata) bool {
 	return true
 }
 
+// AudioTrackCount is how many audio tracks the source has.
+func (md *Metadata) AudioTrackCount() int {
+	if len(md.AudioTracks) > 0 {
+		return len(md.AudioTracks)
+	}
+	if md.Audio != nil {
+		return 1
+	}
+
+	return 0
+}
+
+// AudioTrack returns the metadata of audio track i, nil without.
+func (md *Metadata) AudioTrack(i int) *AudioMetadata {
+	if i == 0 && len(md.AudioTracks) == 0 {
+		return md.Audio
+	}
+	if i < 0 || i >= len(md.AudioTracks) {
+		return nil
+	}
+
+	return &md.AudioTracks[i]
+}
+
+// FindAudioTrack returns the audio track sel names, its index, its label or
+// its language, en matching en-US as well.
+func (md *Metadata) FindAudioTrack(sel string) (int, bool) {
+	n := md.AudioTrackCount()
+	if i, err := strconv.Atoi(sel); err == nil {
+		return i, i >= 0 && i < n
+	}
+
+	for i := 0; i < n; i++ {
+		if t := md.AudioTrack(i); t.Label != "" && strings.EqualFold(t.Label, sel) {
+			return i, true
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		lang := md.AudioTrack(i).Language
+		if lang == "" {
+			continue
+		}
+		if strings.EqualFold(lang, sel) || len(lang) > len(sel) && lang[len(sel)] == '-' && strings.EqualFold(lang[:len(sel)], sel) {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
 func (md *Metadata) FormatName() string {
 	return md.PacketType.String()
 }
 
 func (md *Metadata) ToFormatSettings() FormatSettings {
-	return FormatSettings{
-		AudioCandidates: []AudioMetadata{*md.Audio},
-		VideoCandidates: []VideoMetadata{*md.Video},
-		DataCandidates:  []DataMetadata{*md.Data},
-		PacketType:      md.PacketType,
+	fs := FormatSettings{
+		PacketType: md.PacketType,
 	}
+
+	if md.Audio != nil {
+		fs.AudioCandidates = []AudioMetadata{*md.Audio}
+	}
+
+	if md.Video != nil {
+		fs.VideoCandidates = []VideoMetadata{*md.Video}
+	}
+
+	if md.Data != nil {
+		fs.DataCandidates = []DataMetadata{*md.Data}
+	}
+
+	return fs
 }
 
 type FeedbackType int
@@ -334,4 +420,7 @@ type FormatSettings struct {
 	VideoCandidates []VideoMetadata `json:"videoCandidates"`
 	DataCandidates  []DataMetadata  `json:"dataCandidates"`
 	PacketType      PacketType      `json:"packetType"`
+	// AudioTrack picks the audio track of a source with more than one, see
+	// Metadata.FindAudioTrack, the first when empty or not found.
+	AudioTrack string `json:"audioTrack,omitempty"`
 }
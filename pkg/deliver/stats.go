@@ -0,0 +1,212 @@
+package deliver
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingostack/neon/pkg/clock"
+)
+
+const (
+	minBitrateWindow = time.Second
+	// timestamps running this far from the wall clock between two frames
+	// are counted as an anomaly
+	maxTimestampJump = time.Second
+)
+
+type SourceStats struct {
+	Frames  uint64 `json:"frames"`
+	Bytes   uint64 `json:"bytes"`
+	Bitrate uint64 `json:"bitrate"`
+	// FPS counts video frames, packets of one frame share a timestamp.
+	FPS              float64   `json:"fps"`
+	KeyframeInterval float64   `json:"keyframeInterval"` // seconds
+	LastKeyframeAt   time.Time `json:"lastKeyframeAt,omitempty"`
+	StartedAt        time.Time `json:"startedAt"`
+	// TimestampAnomalies counts the frames whose timestamp stepped back or
+	// ran ahead of the wall clock, DecodeErrors the packets of the publisher
+	// that could not be read.
+	TimestampAnomalies uint64 `json:"timestampAnomalies"`
+	DecodeErrors       uint64 `json:"decodeErrors"`
+}
+
+type EnableStats interface {
+	Stats() SourceStats
+}
+
+// TransportStats describe the network path of a session.
+type TransportStats struct {
+	Protocol      string  `json:"protocol"`
+	BytesSent     uint64  `json:"bytesSent"`
+	BytesReceived uint64  `json:"bytesReceived"`
+	PacketsLost   uint64  `json:"packetsLost"`
+	FractionLost  float64 `json:"fractionLost"`
+	RTT           float64 `json:"rtt"`    // milliseconds
+	Jitter        float64 `json:"jitter"` // milliseconds
+	// MOS estimates the perceived quality from 1 to 4.5, the score players
+	// report in rtcp xr or one computed from loss, delay and jitter. It is 0
+	// before there is one.
+	MOS float64 `json:"mos,omitempty"`
+	// FramesDropped counts the video frames held back from a congested
+	// subscriber.
+	FramesDropped uint64 `json:"framesDropped"`
+	// AvailableBitrate is the estimated bandwidth towards a subscriber, bits per
+	// second, 0 if unknown.
+	AvailableBitrate uint64 `json:"availableBitrate,omitempty"`
+}
+
+// EnableTransportStats is implemented by frame sources and destinations that
+// know about their connection, e.g. webrtc.
+type EnableTransportStats interface {
+	TransportStats() TransportStats
+}
+
+// EnablePacketTap is implemented by frame sources and destinations that see
+// the rtp and rtcp packets of their connection, e.g. webrtc.
+type EnablePacketTap interface {
+	// SetPacketTap calls tap with every packet sent and received, nil stops.
+	SetPacketTap(tap func(inbound, isRTCP bool, packet []byte))
+	// SelectedAddrs returns the addresses of the connection, nil while it is
+	// not connected.
+	SelectedAddrs() (local, remote net.Addr)
+}
+
+type rateMeter struct {
+	clock     clock.Clock
+	frames    uint64
+	bytes     uint64
+	lock      sync.Mutex
+	startedAt time.Time
+	lastAt    time.Time
+	lastBytes uint64
+	bitrate   uint64
+
+	videoFrames     uint64
+	lastVideoFrames uint64
+	videoSeen       bool
+	videoTimestamp  uint32
+	fps             float64
+	lastKeyframeAt  time.Time
+	keyframeGap     time.Duration
+
+	audioClock   trackClock
+	videoClock   trackClock
+	anomalies    uint64
+	decodeErrors uint64
+}
+
+// trackClock is the last timestamp of a track and when it came.
+type trackClock struct {
+	started bool
+	ts      uint32
+	at      time.Time
+}
+
+func newRateMeter() *rateMeter {
+	c := clock.Default()
+	now := c.Now()
+	return &rateMeter{
+		clock:     c,
+		startedAt: now,
+		lastAt:    now,
+	}
+}
+
+// add counts frame of n bytes, rate is the clock rate of its track, 0 if
+// unknown.
+func (m *rateMeter) add(frame Frame, n int, rate uint32) {
+	atomic.AddUint64(&m.frames, 1)
+	if n > 0 {
+		atomic.AddUint64(&m.bytes, uint64(n))
+	}
+
+	if frame.Codec.IsVideo() {
+		m.addVideo(frame)
+		m.checkTimestamp(&m.videoClock, frame.TimeStamp, rate)
+	} else if frame.Codec.IsAudio() {
+		m.checkTimestamp(&m.audioClock, frame.TimeStamp, rate)
+	}
+}
+
+// checkTimestamp counts a timestamp stepping back or ahead of the wall clock
+// by more than maxTimestampJump. Timestamps falling behind the wall clock
+// are the network stalling, not an anomaly.
+func (m *rateMeter) checkTimestamp(c *trackClock, ts, rate uint32) {
+	if rate == 0 {
+		return
+	}
+
+	now := m.clock.Now()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !c.started || ts == c.ts {
+		c.started, c.ts, c.at = true, ts, now
+		return
+	}
+
+	elapsed := time.Duration(int64(int32(ts-c.ts)) * int64(time.Second) / int64(rate))
+	if elapsed < -maxTimestampJump || elapsed-now.Sub(c.at) > maxTimestampJump {
+		m.anomalies++
+	}
+	c.ts, c.at = ts, now
+}
+
+func (m *rateMeter) decodeError() {
+	atomic.AddUint64(&m.decodeErrors, 1)
+}
+
+func (m *rateMeter) addVideo(frame Frame) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.videoSeen && frame.TimeStamp == m.videoTimestamp {
+		return
+	}
+	m.videoSeen = true
+	m.videoTimestamp = frame.TimeStamp
+	m.videoFrames++
+
+	info, ok := frame.AdditionalInfo.(*VideoFrameSpecificInfo)
+	if !ok || !info.IsKeyFrame {
+		return
+	}
+
+	now := m.clock.Now()
+	if !m.lastKeyframeAt.IsZero() {
+		m.keyframeGap = now.Sub(m.lastKeyframeAt)
+	}
+	m.lastKeyframeAt = now
+}
+
+func (m *rateMeter) stats() SourceStats {
+	bytes := atomic.LoadUint64(&m.bytes)
+
+	m.lock.Lock()
+	now := m.clock.Now()
+	if elapsed := now.Sub(m.lastAt); elapsed >= minBitrateWindow {
+		m.bitrate = uint64(float64((bytes-m.lastBytes)*8) / elapsed.Seconds())
+		m.fps = float64(m.videoFrames-m.lastVideoFrames) / elapsed.Seconds()
+		m.lastBytes = bytes
+		m.lastVideoFrames = m.videoFrames
+		m.lastAt = now
+	}
+	bitrate, fps, gap, lastKeyframe := m.bitrate, m.fps, m.keyframeGap, m.lastKeyframeAt
+	anomalies := m.anomalies
+	m.lock.Unlock()
+
+	return SourceStats{
+		Frames:             atomic.LoadUint64(&m.frames),
+		Bytes:              bytes,
+		Bitrate:            bitrate,
+		FPS:                fps,
+		KeyframeInterval:   gap.Seconds(),
+		LastKeyframeAt:     lastKeyframe,
+		StartedAt:          m.startedAt,
+		TimestampAnomalies: anomalies,
+		DecodeErrors:       atomic.LoadUint64(&m.decodeErrors),
+	}
+}
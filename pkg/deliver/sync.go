@@ -0,0 +1,56 @@
+package deliver
+
+import (
+	"sync"
+	"time"
+)
+
+// ntpEpochOffset is the number of seconds between 1900, the epoch of ntp
+// timestamps, and 1970.
+const ntpEpochOffset = 2208988800
+
+// SenderClock maps the rtp timestamps of a track to the wall clock of its
+// publisher, from the ntp and rtp timestamp pairs of its RTCP sender
+// reports. Tracks of a publisher share its wall clock, which tells how their
+// timestamps relate.
+type SenderClock struct {
+	lock sync.Mutex
+	rate int64
+	ntp  time.Time
+	rtp  uint32
+	set  bool
+}
+
+func NewSenderClock(rate uint32) *SenderClock {
+	return &SenderClock{rate: int64(rate)}
+}
+
+// Update takes the ntp timestamp of a sender report, 32.32 fixed point
+// seconds since 1900, for the rtp timestamp rtp.
+func (c *SenderClock) Update(ntp uint64, rtp uint32) {
+	secs := int64(ntp>>32) - ntpEpochOffset
+	nanos := int64((ntp & 0xffffffff) * uint64(time.Second) >> 32)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.ntp, c.rtp, c.set = time.Unix(secs, nanos), rtp, true
+}
+
+// Time returns the wall clock of the publisher at rtp timestamp ts, zero
+// before the first sender report.
+func (c *SenderClock) Time(ts uint32) time.Time {
+	if c == nil {
+		return time.Time{}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.set || c.rate == 0 {
+		return time.Time{}
+	}
+
+	d := int64(int32(ts - c.rtp))
+	return c.ntp.Add(time.Duration(d * int64(time.Second) / c.rate))
+}
@@ -0,0 +1,185 @@
+// Package wt plays streams to browsers over webtransport, every stream the
+// player gets starts with what it needs to decode, an init segment or the
+// metadata, and a keyframe. A player that falls behind has its stream reset
+// and gets a new one from the next keyframe instead of the frames it missed,
+// the way a websocket can not.
+package wt
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/record"
+	"github.com/quic-go/webtransport-go"
+	"github.com/sirupsen/logrus"
+)
+
+// Protocol names webtransport sessions in stats.
+const Protocol = "webtransport"
+
+const (
+	// a write blocked this long, the player can't keep up, resets the stream
+	writeTimeout = 2 * time.Second
+	// the stream is reset with it when the player fell behind
+	resetErrorCode webtransport.StreamErrorCode = 1
+)
+
+// Options of a player, the query of its url.
+type Options struct {
+	Format Format
+	// FragmentDuration is the most media of a fmp4 fragment,
+	// DefaultFragmentDuration when 0.
+	FragmentDuration time.Duration
+}
+
+// FrameDestination writes a stream to the unidirectional streams of a
+// webtransport session.
+type FrameDestination struct {
+	*record.FrameDestination
+	session *webtransport.Session
+	opt     Options
+	logger  *logrus.Entry
+
+	lock   sync.Mutex
+	md     *deliver.Metadata
+	stream webtransport.SendStream
+	muxer  muxer
+	bytes  uint64
+}
+
+func NewFrameDestination(ctx context.Context, session *webtransport.Session, opt Options, logger *logrus.Entry) *FrameDestination {
+	if opt.Format == "" {
+		opt.Format = FormatFMP4
+	}
+	if opt.FragmentDuration <= 0 {
+		opt.FragmentDuration = DefaultFragmentDuration
+	}
+
+	fd := &FrameDestination{
+		FrameDestination: record.NewFrameDestination(ctx, logger),
+		session:          session,
+		opt:              opt,
+		logger:           logger,
+	}
+	fd.OnMetadataChange(fd.onMetadata)
+	fd.OnRawFrame(fd.onFrame)
+
+	go func() {
+		select {
+		case <-fd.Context().Done():
+		case <-session.Context().Done():
+			fd.Close()
+		}
+		fd.closeStream(false)
+	}()
+
+	return fd
+}
+
+// onMetadata starts a new stream, the codecs of the old one are gone.
+func (fd *FrameDestination) onMetadata(md *deliver.Metadata) {
+	fd.lock.Lock()
+	fd.md = md
+	fd.lock.Unlock()
+
+	fd.closeStream(false)
+}
+
+func (fd *FrameDestination) onFrame(frame deliver.Frame) {
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	if fd.stream == nil && !fd.open(frame) {
+		return
+	}
+
+	fd.stream.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := fd.muxer.WriteFrame(frame); err != nil {
+		if fd.session.Context().Err() != nil || fd.Context().Err() != nil {
+			return
+		}
+
+		fd.logger.WithError(err).Warn("webtransport stream reset, waiting for keyframe")
+		fd.resetLocked()
+	}
+}
+
+// open starts a stream with frame, video streams start on a keyframe.
+func (fd *FrameDestination) open(frame deliver.Frame) bool {
+	if fd.md == nil || fd.md.HasVideo() && (!frame.Codec.IsVideo() || !isKeyframe(frame)) {
+		return false
+	}
+
+	stream, err := fd.session.OpenUniStreamSync(fd.Context())
+	if err != nil {
+		fd.logger.WithError(err).Debug("failed to open webtransport stream")
+		return false
+	}
+
+	stream.SetWriteDeadline(time.Now().Add(writeTimeout))
+	m, err := newMuxer(fd.opt.Format, &countingWriter{w: stream, n: &fd.bytes}, fd.md, fd.opt.FragmentDuration)
+	if err != nil {
+		fd.logger.WithError(err).Warn("webtransport stream not started")
+		stream.CancelWrite(resetErrorCode)
+		return false
+	}
+
+	fd.stream, fd.muxer = stream, m
+
+	return true
+}
+
+// resetLocked drops the stream, the next keyframe starts another.
+func (fd *FrameDestination) resetLocked() {
+	if fd.stream != nil {
+		fd.stream.CancelWrite(resetErrorCode)
+		fd.stream, fd.muxer = nil, nil
+	}
+
+	fd.RequestKeyframe()
+}
+
+// closeStream ends the stream, what was written is kept unless reset.
+func (fd *FrameDestination) closeStream(reset bool) {
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	if reset {
+		fd.resetLocked()
+		return
+	}
+
+	if fd.stream != nil {
+		fd.stream.Close()
+		fd.stream, fd.muxer = nil, nil
+	}
+}
+
+// OnFrameGap resets the stream of a player that fell behind.
+func (fd *FrameDestination) OnFrameGap(lost uint64) {
+	fd.logger.WithField("lost", lost).Warn("webtransport player fell behind, waiting for keyframe")
+	fd.closeStream(true)
+}
+
+func (fd *FrameDestination) TransportStats() deliver.TransportStats {
+	return deliver.TransportStats{
+		Protocol:  Protocol,
+		BytesSent: atomic.LoadUint64(&fd.bytes),
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *uint64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	atomic.AddUint64(c.n, uint64(n))
+
+	return n, err
+}
@@ -0,0 +1,8 @@
+package wt
+
+import "errors"
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported webtransport format")
+	ErrUnsupportedCodec  = errors.New("no track of the stream fits the format")
+)
@@ -0,0 +1,218 @@
+package wt
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/record/mp4"
+)
+
+// Format is what a player gets on its streams.
+type Format string
+
+const (
+	// FormatFMP4 is an init segment followed by fragments, for media source
+	// extensions. It carries h264 and opus.
+	FormatFMP4 Format = "fmp4"
+	// FormatRaw are the frames as they are, for webcodecs, see rawMuxer.
+	FormatRaw Format = "raw"
+)
+
+const (
+	defaultClockRate = 90000
+	// DefaultFragmentDuration keeps fmp4 players about a fragment behind.
+	DefaultFragmentDuration = 100 * time.Millisecond
+)
+
+// muxer writes the frames of a stream from its first, a keyframe when the
+// stream has video.
+type muxer interface {
+	WriteFrame(frame deliver.Frame) error
+}
+
+func newMuxer(format Format, w io.Writer, md *deliver.Metadata, fragment time.Duration) (muxer, error) {
+	switch format {
+	case FormatFMP4:
+		return newFMP4Muxer(w, md, fragment), nil
+	case FormatRaw:
+		return newRawMuxer(w, md)
+	}
+
+	return nil, ErrUnsupportedFormat
+}
+
+func isKeyframe(frame deliver.Frame) bool {
+	if info, ok := frame.AdditionalInfo.(*deliver.VideoFrameSpecificInfo); ok {
+		return info.IsKeyFrame
+	}
+
+	return !frame.Codec.IsVideo()
+}
+
+// fmp4Track puts the rtp timestamps of a track on the timeline of the
+// stream, the tracks start at the wall clock time their first frame arrived.
+type fmp4Track struct {
+	index     int
+	codec     deliver.CodecType
+	timescale uint32
+	started   bool
+	lastTS    uint32
+	dts       int64
+}
+
+type fmp4Muxer struct {
+	w        io.Writer
+	md       *deliver.Metadata
+	fragment time.Duration
+	start    time.Time
+	mw       *mp4.Writer
+	tracks   []*fmp4Track
+}
+
+func newFMP4Muxer(w io.Writer, md *deliver.Metadata, fragment time.Duration) *fmp4Muxer {
+	return &fmp4Muxer{w: w, md: md, fragment: fragment}
+}
+
+// open writes the init segment, h264 takes its parameter sets from the
+// first keyframe.
+func (m *fmp4Muxer) open(keyframe []byte) error {
+	var tracks []mp4.Track
+	if m.md.HasVideo() && m.md.Video.CodecType == deliver.CodecTypeH264 {
+		clockRate := m.md.Video.ClockRate
+		if clockRate == 0 {
+			clockRate = defaultClockRate
+		}
+		m.tracks = append(m.tracks, &fmp4Track{index: len(tracks), codec: deliver.CodecTypeH264, timescale: clockRate})
+		tracks = append(tracks, mp4.Track{
+			Codec:     deliver.CodecTypeH264,
+			Timescale: clockRate,
+			Width:     m.md.Video.Width,
+			Height:    m.md.Video.Height,
+			Keyframe:  keyframe,
+		})
+	}
+
+	if m.md.HasAudio() && m.md.Audio.CodecType == deliver.CodecTypeOpus {
+		m.tracks = append(m.tracks, &fmp4Track{index: len(tracks), codec: deliver.CodecTypeOpus, timescale: m.md.Audio.SampleRate})
+		tracks = append(tracks, mp4.Track{
+			Codec:     deliver.CodecTypeOpus,
+			Timescale: m.md.Audio.SampleRate,
+			Channels:  m.md.Audio.Channels,
+		})
+	}
+
+	if len(tracks) == 0 {
+		return ErrUnsupportedCodec
+	}
+
+	mw, err := mp4.NewWriter(m.w, tracks)
+	if err != nil {
+		return err
+	}
+	mw.SetFragmentDuration(m.fragment)
+
+	m.mw, m.start = mw, time.Now()
+
+	return nil
+}
+
+func (m *fmp4Muxer) track(codec deliver.CodecType) *fmp4Track {
+	for _, t := range m.tracks {
+		if t.codec == codec {
+			return t
+		}
+	}
+
+	return nil
+}
+
+func (m *fmp4Muxer) WriteFrame(frame deliver.Frame) error {
+	if m.mw == nil {
+		var keyframe []byte
+		if frame.Codec == deliver.CodecTypeH264 {
+			keyframe = frame.Payload
+		}
+		if err := m.open(keyframe); err != nil {
+			return err
+		}
+	}
+
+	t := m.track(frame.Codec)
+	if t == nil {
+		return nil
+	}
+
+	if !t.started {
+		t.started, t.lastTS = true, frame.TimeStamp
+		t.dts = int64(time.Since(m.start).Seconds() * float64(t.timescale))
+	} else {
+		t.dts += int64(int32(frame.TimeStamp - t.lastTS))
+		t.lastTS = frame.TimeStamp
+	}
+
+	return m.mw.WriteSample(t.index, mp4.Sample{
+		DTS:      t.dts - int64(frame.CompositionOffset),
+		CTS:      frame.CompositionOffset,
+		Keyframe: isKeyframe(frame),
+		Data:     frame.Payload,
+	})
+}
+
+const (
+	rawMessageMetadata byte = iota
+	rawMessageFrame
+
+	rawFlagKeyframe = 0x01
+)
+
+// rawMuxer writes messages of a 4 byte big endian size followed by the
+// type and the body, the first is the metadata of the stream as json:
+//
+//	metadata: 0, json of deliver.Metadata
+//	frame:    1, codec (1 byte), flags (1 byte, 0x01 keyframe),
+//	          rtp timestamp (4), composition offset (4), payload
+//
+// h264 is in annex b, opus a packet per frame.
+type rawMuxer struct {
+	w   io.Writer
+	buf []byte
+}
+
+func newRawMuxer(w io.Writer, md *deliver.Metadata) (*rawMuxer, error) {
+	m := &rawMuxer{w: w}
+
+	body, err := json.Marshal(md)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, m.write(rawMessageMetadata, nil, body)
+}
+
+func (m *rawMuxer) WriteFrame(frame deliver.Frame) error {
+	var head [10]byte
+	head[0] = byte(frame.Codec)
+	if isKeyframe(frame) && frame.Codec.IsVideo() {
+		head[1] |= rawFlagKeyframe
+	}
+	binary.BigEndian.PutUint32(head[2:], frame.TimeStamp)
+	binary.BigEndian.PutUint32(head[6:], frame.CompositionOffset)
+
+	return m.write(rawMessageFrame, head[:], frame.Payload)
+}
+
+// write sends a message in a single write.
+func (m *rawMuxer) write(typ byte, head, body []byte) error {
+	size := 1 + len(head) + len(body)
+	m.buf = append(m.buf[:0], 0, 0, 0, 0, typ)
+	binary.BigEndian.PutUint32(m.buf, uint32(size))
+	m.buf = append(m.buf, head...)
+	m.buf = append(m.buf, body...)
+
+	_, err := m.w.Write(m.buf)
+
+	return err
+}
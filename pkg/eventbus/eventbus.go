@@ -0,0 +1,45 @@
+// Package eventbus is the process wide namespace of events. Modules keep
+// their own emitters and bridge them here, so that listeners subscribe to
+// topics such as "rtsp.publish.start" without importing the module emitting
+// them. Topics and their payloads are listed in topics.go.
+package eventbus
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pingostack/neon/pkg/eventemitter"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultQueueSize = 1024
+
+var bus = eventemitter.NewEventEmitter(context.Background(), defaultQueueSize,
+	logrus.WithField("obj", "eventbus"), eventemitter.WithName("bus"))
+
+// Default returns the bus, e.g. for eventemitter.Subscribe.
+func Default() eventemitter.EventEmitter {
+	return bus
+}
+
+func Emit(topic string, data interface{}) error {
+	return bus.Emit(topic, data)
+}
+
+func On(pattern string, f eventemitter.TopicFunc, opts ...eventemitter.ListenerOption) func() {
+	return bus.On(pattern, f, opts...)
+}
+
+// Bridge republishes all topics of a module emitter on the bus, prefixed
+// with prefix, e.g. "rtsp". The returned func stops it.
+func Bridge(prefix string, ee eventemitter.EventEmitter) func() {
+	prefix = strings.TrimSuffix(prefix, ".")
+
+	return ee.On("**", func(topic string, data interface{}) error {
+		if prefix != "" {
+			topic = prefix + "." + topic
+		}
+
+		return bus.Emit(topic, data)
+	}, eventemitter.Sync())
+}
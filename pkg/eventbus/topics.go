@@ -0,0 +1,138 @@
+package eventbus
+
+import (
+	"time"
+
+	feature_core "github.com/pingostack/neon/features/core"
+	"github.com/pingostack/neon/pkg/eventemitter"
+)
+
+// Session is the payload of the protocol session topics.
+type Session struct {
+	Protocol   string    `json:"protocol"`
+	Namespace  string    `json:"namespace"`
+	Stream     string    `json:"stream"`
+	Session    string    `json:"session"`
+	RemoteAddr string    `json:"remoteAddr,omitempty"`
+	Producer   bool      `json:"producer"`
+	Time       time.Time `json:"time"`
+}
+
+// AudioLevel is the payload of the audio topics. Level is the average of an
+// interval in -dBov, 0 the loudest and 127 silence, RFC 6464.
+type AudioLevel struct {
+	Namespace string    `json:"namespace"`
+	Stream    string    `json:"stream"`
+	Session   string    `json:"session"`
+	Level     uint8     `json:"level"`
+	Voice     bool      `json:"voice"`
+	Time      time.Time `json:"time"`
+}
+
+// ActiveSpeaker is the payload of TopicActiveSpeaker, Stream is empty when
+// the speaker left.
+type ActiveSpeaker struct {
+	Namespace string    `json:"namespace"`
+	Stream    string    `json:"stream"`
+	Previous  string    `json:"previous,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// RoomEvent is the payload of the room topics, Stream is the stream of the
+// participant published or unpublished, in Namespace.
+type RoomEvent struct {
+	Room        string    `json:"room"`
+	Namespace   string    `json:"namespace,omitempty"`
+	Participant string    `json:"participant"`
+	Role        string    `json:"role,omitempty"`
+	Stream      string    `json:"stream,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// QuotaWarning is the payload of TopicQuotaWarning, Counter of Tenant
+// reached Soft, new sessions are rejected at Hard.
+type QuotaWarning struct {
+	Tenant  string    `json:"tenant"`
+	Counter string    `json:"counter"`
+	Value   uint64    `json:"value"`
+	Soft    uint64    `json:"soft"`
+	Hard    uint64    `json:"hard,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+const (
+	ProtocolRTSP   = "rtsp"
+	ProtocolWebRTC = "webrtc"
+	ProtocolRelay  = "relay"
+)
+
+// Protocol session topics, <protocol>.<publish|play>.<start|stop>, see
+// SessionTopic.
+const (
+	TopicRTSPPublishStart   eventemitter.Topic[Session] = "rtsp.publish.start"
+	TopicRTSPPublishStop    eventemitter.Topic[Session] = "rtsp.publish.stop"
+	TopicRTSPPlayStart      eventemitter.Topic[Session] = "rtsp.play.start"
+	TopicRTSPPlayStop       eventemitter.Topic[Session] = "rtsp.play.stop"
+	TopicWebRTCPublishStart eventemitter.Topic[Session] = "webrtc.publish.start"
+	TopicWebRTCPublishStop  eventemitter.Topic[Session] = "webrtc.publish.stop"
+	TopicWebRTCPlayStart    eventemitter.Topic[Session] = "webrtc.play.start"
+	TopicWebRTCPlayStop     eventemitter.Topic[Session] = "webrtc.play.stop"
+	TopicRelayPublishStart  eventemitter.Topic[Session] = "relay.publish.start"
+	TopicRelayPublishStop   eventemitter.Topic[Session] = "relay.publish.stop"
+	TopicRelayPlayStart     eventemitter.Topic[Session] = "relay.play.start"
+	TopicRelayPlayStop      eventemitter.Topic[Session] = "relay.play.stop"
+)
+
+// Core topics carry the events of the core emitter, see feature_core.
+const (
+	TopicStreamPublished    eventemitter.Topic[feature_core.Event] = "core.stream.published"
+	TopicStreamEnded        eventemitter.Topic[feature_core.Event] = "core.stream.ended"
+	TopicClientConnected    eventemitter.Topic[feature_core.Event] = "core.client.connected"
+	TopicClientDisconnected eventemitter.Topic[feature_core.Event] = "core.client.disconnected"
+	TopicRecordingFinished  eventemitter.Topic[feature_core.Event] = "core.recording.finished"
+	TopicAuthFailed         eventemitter.Topic[feature_core.Event] = "core.auth.failed"
+	TopicStreamFailover     eventemitter.Topic[feature_core.Event] = "core.stream.failover"
+	TopicStreamFailback     eventemitter.Topic[feature_core.Event] = "core.stream.failback"
+	TopicViewersThreshold   eventemitter.Topic[feature_core.Event] = "core.viewers.threshold"
+	TopicGOPExceeded        eventemitter.Topic[feature_core.Event] = "core.stream.gop_exceeded"
+	TopicStreamUnhealthy    eventemitter.Topic[feature_core.Event] = "core.stream.unhealthy"
+	TopicStreamRecovered    eventemitter.Topic[feature_core.Event] = "core.stream.recovered"
+	TopicStreamQuarantined  eventemitter.Topic[feature_core.Event] = "core.stream.quarantined"
+	TopicRecordingUploaded  eventemitter.Topic[feature_core.Event] = "core.recording.uploaded"
+)
+
+// Audio topics of webrtc publishers sending audio levels. TopicAudioLevel is
+// published about twice a second per stream, TopicVoiceActivity when a
+// stream starts or stops speaking.
+const (
+	TopicAudioLevel    eventemitter.Topic[AudioLevel]    = "audio.level"
+	TopicVoiceActivity eventemitter.Topic[AudioLevel]    = "audio.voice"
+	TopicActiveSpeaker eventemitter.Topic[ActiveSpeaker] = "audio.speaker"
+)
+
+// TopicQuotaWarning is published when a quota counter of a tenant reaches
+// its soft limit, see package vhost.
+const TopicQuotaWarning eventemitter.Topic[QuotaWarning] = "vhost.quota.warning"
+
+// Room topics, see package room.
+const (
+	TopicRoomJoin             eventemitter.Topic[RoomEvent] = "room.join"
+	TopicRoomLeave            eventemitter.Topic[RoomEvent] = "room.leave"
+	TopicRoomTrackPublished   eventemitter.Topic[RoomEvent] = "room.track.published"
+	TopicRoomTrackUnpublished eventemitter.Topic[RoomEvent] = "room.track.unpublished"
+	TopicRoomClosed           eventemitter.Topic[RoomEvent] = "room.closed"
+)
+
+// SessionTopic names the topic of a session of protocol starting or
+// stopping, e.g. "rtsp.publish.start".
+func SessionTopic(protocol string, producer, start bool) eventemitter.Topic[Session] {
+	action, state := "play", "stop"
+	if producer {
+		action = "publish"
+	}
+	if start {
+		state = "start"
+	}
+
+	return eventemitter.Topic[Session](protocol + "." + action + "." + state)
+}
@@ -0,0 +1,9 @@
+package eventemitter
+
+import "errors"
+
+var (
+	ErrQueueFull        = errors.New("event queue full")
+	ErrEmitterClosed    = errors.New("event emitter closed")
+	ErrListenerPanicked = errors.New("listener panicked")
+)
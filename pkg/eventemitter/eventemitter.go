@@ -6,6 +6,7 @@ import (
 	"sync"
 
 	"github.com/pingostack/neon/pkg/logger"
+	"github.com/pingostack/neon/pkg/metrics"
 	"github.com/pkg/errors"
 	"go.uber.org/atomic"
 )
@@ -17,24 +18,69 @@ type eventFunc func(data interface{}) error
 type EventEmitter interface {
 	AddEvent(eventID eventID, f eventFunc)
 	EmitEvent(eventID eventID, data interface{}) error
+	// On subscribes f to the topics matching pattern, see Emit. The returned
+	// func removes the subscription.
+	On(pattern string, f TopicFunc, opts ...ListenerOption) func()
+	// Emit passes data to the listeners of topic, sync listeners are called
+	// before Emit returns, the others from the queue.
+	Emit(topic string, data interface{}) error
 }
 
 type Event struct {
 	Signal eventID
+	Topic  string
 	Data   interface{}
 }
 
 func (e Event) String() string {
+	if e.Topic != "" {
+		return fmt.Sprintf("{topic: %s, data: %+v}", e.Topic, e.Data)
+	}
+
 	return fmt.Sprintf("{eventID: %d, data: %+v}", e.Signal, e.Data)
 }
 
+// OverflowPolicy decides what happens to events emitted while the queue is
+// full.
+type OverflowPolicy int
+
+const (
+	// OverflowDropNewest drops the event emitted, the default.
+	OverflowDropNewest OverflowPolicy = iota
+	// OverflowDropOldest makes room by dropping the oldest queued event.
+	OverflowDropOldest
+	// OverflowBlock waits for room, or for the emitter to close.
+	OverflowBlock
+)
+
+type Option func(m *EventEmitterImpl)
+
+// WithName labels the dropped events metric of the emitter.
+func WithName(name string) Option {
+	return func(m *EventEmitterImpl) {
+		m.name = name
+	}
+}
+
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(m *EventEmitterImpl) {
+		m.overflow = policy
+	}
+}
+
+const defaultName = "default"
+
 type EventEmitterImpl struct {
 	oneventLock sync.RWMutex
 	eventCh     chan Event
 	listeners   map[eventID][]eventFunc
+	topics      []*topicListener
+	nextTopicID uint64
 	logger      logger.Logger
 	ctx         context.Context
 	cancel      context.CancelFunc
+	name        string
+	overflow    OverflowPolicy
 }
 
 var (
@@ -45,11 +91,16 @@ func GenEventID() eventID {
 	return eventID(signalCounter.Inc())
 }
 
-func NewEventEmitter(ctx context.Context, size int, logger logger.Logger) EventEmitter {
+func NewEventEmitter(ctx context.Context, size int, logger logger.Logger, opts ...Option) EventEmitter {
 	m := &EventEmitterImpl{
 		eventCh:   make(chan Event, size),
 		listeners: make(map[eventID][]eventFunc),
 		logger:    logger,
+		name:      defaultName,
+	}
+
+	for _, opt := range opts {
+		opt(m)
 	}
 
 	m.ctx, m.cancel = context.WithCancel(ctx)
@@ -68,21 +119,51 @@ func (m *EventEmitterImpl) EmitEvent(eventID eventID, data interface{}) error {
 		}
 	}()
 
-	e := Event{
+	return m.enqueue(Event{
 		Signal: eventID,
 		Data:   data,
-	}
+	})
+}
 
-	select {
-	case m.eventCh <- e:
+func (m *EventEmitterImpl) enqueue(e Event) error {
+	switch m.overflow {
+	case OverflowBlock:
+		select {
+		case m.eventCh <- e:
+			return nil
+		case <-m.ctx.Done():
+			return ErrEmitterClosed
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case m.eventCh <- e:
+				return nil
+			default:
+			}
+
+			select {
+			case old := <-m.eventCh:
+				m.drop(old)
+			default:
+			}
+		}
 	default:
-		if m.logger != nil {
-			m.logger.Warnf("Event queue full, Event: %s", e)
+		select {
+		case m.eventCh <- e:
+			return nil
+		default:
+			m.drop(e)
+			return ErrQueueFull
 		}
-		return fmt.Errorf("Event queue full")
 	}
+}
 
-	return nil
+func (m *EventEmitterImpl) drop(e Event) {
+	metrics.EventsDropped.With(m.name).Inc()
+	if m.logger != nil {
+		m.logger.Warnf("Event queue full, Event: %s dropped", e)
+	}
 }
 
 func (m *EventEmitterImpl) SyncEmitEvent(eventID eventID, data interface{}) error {
@@ -121,6 +202,11 @@ func (m *EventEmitterImpl) run() {
 				return
 			}
 
+			if e.Topic != "" {
+				m.dispatch(e.Topic, e.Data, false)
+				continue
+			}
+
 			m.oneventLock.RLock()
 			listeners, found := m.listeners[e.Signal]
 			m.oneventLock.RUnlock()
@@ -0,0 +1,188 @@
+package eventemitter
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TopicFunc receives the events of the topics it subscribed to.
+type TopicFunc func(topic string, data interface{}) error
+
+type ListenerOption func(l *topicListener)
+
+// Sync calls the listener in the goroutine emitting the event, in the order
+// the events were emitted and before Emit returns. Sync listeners must not
+// block.
+func Sync() ListenerOption {
+	return func(l *topicListener) {
+		l.sync = true
+	}
+}
+
+type topicListener struct {
+	id      uint64
+	pattern []string
+	f       TopicFunc
+	sync    bool
+}
+
+// matchTopic matches dot separated topics, "*" in pattern matches one
+// segment and a trailing "**" any number of them, e.g. "stream.*"
+// matches "stream.publish" but not "stream.publish.start".
+func matchTopic(pattern []string, topic string) bool {
+	segments := strings.Split(topic, ".")
+	for i, p := range pattern {
+		if p == "**" && i == len(pattern)-1 {
+			return true
+		}
+
+		if i >= len(segments) || (p != "*" && p != segments[i]) {
+			return false
+		}
+	}
+
+	return len(pattern) == len(segments)
+}
+
+func (m *EventEmitterImpl) On(pattern string, f TopicFunc, opts ...ListenerOption) func() {
+	l := &topicListener{
+		pattern: strings.Split(pattern, "."),
+		f:       f,
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	m.oneventLock.Lock()
+	m.nextTopicID++
+	l.id = m.nextTopicID
+	m.topics = append(m.topics, l)
+	m.oneventLock.Unlock()
+
+	return func() {
+		m.oneventLock.Lock()
+		defer m.oneventLock.Unlock()
+
+		for i, tl := range m.topics {
+			if tl.id == l.id {
+				m.topics = append(m.topics[:i:i], m.topics[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Emit calls the sync listeners of topic and queues the event for the
+// others, which get it whether or not a sync listener failed. The first
+// error of a sync listener is returned, else the one of queueing.
+func (m *EventEmitterImpl) Emit(topic string, data interface{}) error {
+	defer func() {
+		if r := recover(); r != nil {
+			if m.logger != nil {
+				m.logger.Errorf("EventEmitter panic: %v", r)
+			}
+		}
+	}()
+
+	err := m.dispatch(topic, data, true)
+
+	if !m.hasListener(topic, false) {
+		return err
+	}
+
+	if qerr := m.enqueue(Event{
+		Topic: topic,
+		Data:  data,
+	}); err == nil {
+		err = qerr
+	}
+
+	return err
+}
+
+func (m *EventEmitterImpl) listenersOf(topic string, sync bool) []*topicListener {
+	m.oneventLock.RLock()
+	defer m.oneventLock.RUnlock()
+
+	listeners := make([]*topicListener, 0)
+	for _, l := range m.topics {
+		if l.sync == sync && matchTopic(l.pattern, topic) {
+			listeners = append(listeners, l)
+		}
+	}
+
+	return listeners
+}
+
+func (m *EventEmitterImpl) hasListener(topic string, sync bool) bool {
+	return len(m.listenersOf(topic, sync)) > 0
+}
+
+// dispatch calls the sync or the queued listeners of topic, the first error
+// of a sync listener is returned.
+func (m *EventEmitterImpl) dispatch(topic string, data interface{}, sync bool) error {
+	var first error
+	for _, l := range m.listenersOf(topic, sync) {
+		if err := m.call(l, topic, data); err != nil {
+			if m.logger != nil {
+				m.logger.Warnf("listener of %s failed: %v", topic, err)
+			}
+			if first == nil {
+				first = errors.Wrap(err, topic)
+			}
+		}
+	}
+
+	return first
+}
+
+// call turns a panic of the listener into its error, so the others and the
+// queued delivery still get the event.
+func (m *EventEmitterImpl) call(l *topicListener, topic string, data interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Wrapf(ErrListenerPanicked, "%v", r)
+		}
+	}()
+
+	return l.f(topic, data)
+}
+
+// Topic names events carrying a payload of type T.
+type Topic[T any] string
+
+func (t Topic[T]) String() string {
+	return string(t)
+}
+
+// Publish emits data on topic.
+func Publish[T any](ee EventEmitter, topic Topic[T], data T) error {
+	return ee.Emit(string(topic), data)
+}
+
+// Subscribe calls f with the payloads of topic.
+func Subscribe[T any](ee EventEmitter, topic Topic[T], f func(data T) error, opts ...ListenerOption) func() {
+	return SubscribePattern(ee, string(topic), func(_ string, data T) error {
+		return f(data)
+	}, opts...)
+}
+
+// SubscribePattern calls f with the events of all topics matching pattern
+// whose payload is a T, others are skipped.
+func SubscribePattern[T any](ee EventEmitter, pattern string, f func(topic string, data T) error, opts ...ListenerOption) func() {
+	return ee.On(pattern, func(topic string, data interface{}) error {
+		v, ok := data.(T)
+		if !ok {
+			return nil
+		}
+
+		return f(topic, v)
+	}, opts...)
+}
+
+// MatchTopic tells whether topic matches pattern, as for On.
+func MatchTopic(pattern, topic string) bool {
+	return matchTopic(strings.Split(pattern, "."), topic)
+}
@@ -0,0 +1,232 @@
+// Package hls encrypts the segments of hls streams and provides their keys.
+// It does not mux segments or write playlists, the packager serving them
+// encrypts each segment once muxed, or its samples while muxing, with the
+// key and EXT-X-KEY line of the hls module.
+package hls
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Method is the METHOD of an EXT-X-KEY.
+type Method string
+
+const (
+	MethodNone Method = "NONE"
+	// MethodAES128 encrypts whole segments, AES-128 CBC with PKCS7 padding.
+	MethodAES128 Method = "AES-128"
+	// MethodSampleAES encrypts h264 slices and aac frames of a segment, the
+	// container stays readable.
+	MethodSampleAES Method = "SAMPLE-AES"
+)
+
+const (
+	KeySize = 16
+
+	// h264 nal units are encrypted from byte 32 on, one block of ten
+	sampleAESClearLeader  = 32
+	sampleAESSkipBlocks   = 9
+	sampleAESMinNALLength = 48
+	// aac frames are encrypted from byte 16 after the adts header on
+	sampleAESAudioLeader = 16
+)
+
+// SequenceIV is the IV of a segment whose key names none, its media
+// sequence number as a 128 bit big endian integer.
+func SequenceIV(sequence uint64) []byte {
+	iv := make([]byte, KeySize)
+	binary.BigEndian.PutUint64(iv[8:], sequence)
+
+	return iv
+}
+
+// ivOf is the IV of key for the segment of sequence.
+func ivOf(key *Key, sequence uint64) []byte {
+	if len(key.IV) == KeySize {
+		return key.IV
+	}
+
+	return SequenceIV(sequence)
+}
+
+func newBlock(key *Key) (cipher.Block, error) {
+	if len(key.Key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+
+	return aes.NewCipher(key.Key)
+}
+
+// EncryptSegment encrypts a whole segment for AES-128.
+func EncryptSegment(key *Key, sequence uint64, segment []byte) ([]byte, error) {
+	block, err := newBlock(key)
+	if err != nil {
+		return nil, err
+	}
+
+	pad := KeySize - len(segment)%KeySize
+	out := make([]byte, len(segment)+pad)
+	copy(out, segment)
+	for i := len(segment); i < len(out); i++ {
+		out[i] = byte(pad)
+	}
+
+	cipher.NewCBCEncrypter(block, ivOf(key, sequence)).CryptBlocks(out, out)
+
+	return out, nil
+}
+
+// DecryptSegment reverses EncryptSegment.
+func DecryptSegment(key *Key, sequence uint64, segment []byte) ([]byte, error) {
+	block, err := newBlock(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(segment) == 0 || len(segment)%KeySize != 0 {
+		return nil, fmt.Errorf("%w: segment of %d bytes", ErrInvalidKey, len(segment))
+	}
+
+	out := make([]byte, len(segment))
+	cipher.NewCBCDecrypter(block, ivOf(key, sequence)).CryptBlocks(out, segment)
+
+	pad := int(out[len(out)-1])
+	if pad == 0 || pad > KeySize {
+		return nil, fmt.Errorf("%w: bad padding", ErrInvalidKey)
+	}
+
+	return out[:len(out)-pad], nil
+}
+
+// SampleEncrypter encrypts the samples of one segment for SAMPLE-AES, the
+// cbc chain starts over with every nal unit and frame.
+type SampleEncrypter struct {
+	block cipher.Block
+	iv    []byte
+}
+
+func NewSampleEncrypter(key *Key, sequence uint64) (*SampleEncrypter, error) {
+	block, err := newBlock(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SampleEncrypter{block: block, iv: ivOf(key, sequence)}, nil
+}
+
+// EncryptNALU encrypts an h264 nal unit, without start code, with emulation
+// prevention. Only slices longer than 48 bytes are encrypted, the first 32
+// bytes stay clear and of the rest one 16 byte block of every ten.
+func (e *SampleEncrypter) EncryptNALU(nalu []byte) []byte {
+	if len(nalu) == 0 {
+		return nalu
+	}
+
+	if typ := nalu[0] & 0x1f; typ != 1 && typ != 5 {
+		return nalu
+	}
+
+	data := unescapeRBSP(nalu)
+	if len(data) <= sampleAESMinNALLength {
+		return nalu
+	}
+
+	mode := cipher.NewCBCEncrypter(e.block, e.iv)
+	for i := sampleAESClearLeader; i+KeySize <= len(data); i += KeySize * (1 + sampleAESSkipBlocks) {
+		mode.CryptBlocks(data[i:i+KeySize], data[i:i+KeySize])
+	}
+
+	return escapeRBSP(data)
+}
+
+// EncryptADTS encrypts an aac frame with its adts header, the header and
+// 16 bytes after it stay clear, a last partial block too.
+func (e *SampleEncrypter) EncryptADTS(frame []byte) []byte {
+	if len(frame) < 7 || frame[0] != 0xff || frame[1]&0xf0 != 0xf0 {
+		return frame
+	}
+
+	header := 7
+	if frame[1]&0x01 == 0 {
+		// with crc
+		header = 9
+	}
+
+	start := header + sampleAESAudioLeader
+	if len(frame) < start+KeySize {
+		return frame
+	}
+
+	out := append([]byte(nil), frame...)
+	n := (len(out) - start) / KeySize * KeySize
+	cipher.NewCBCEncrypter(e.block, e.iv).CryptBlocks(out[start:start+n], out[start:start+n])
+
+	return out
+}
+
+// unescapeRBSP drops the emulation prevention bytes of a nal unit.
+func unescapeRBSP(nalu []byte) []byte {
+	out := make([]byte, 0, len(nalu))
+	zeros := 0
+	for _, b := range nalu {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, b)
+	}
+
+	return out
+}
+
+// escapeRBSP inserts emulation prevention bytes where encryption produced
+// start code prefixes.
+func escapeRBSP(data []byte) []byte {
+	out := make([]byte, 0, len(data)+len(data)/64)
+	zeros := 0
+	for _, b := range data {
+		if zeros >= 2 && b <= 0x03 {
+			out = append(out, 0x03)
+			zeros = 0
+		}
+
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, b)
+	}
+
+	return out
+}
+
+// KeyTag is the EXT-X-KEY line of key at uri, the IV is only written when
+// the key has its own.
+func KeyTag(method Method, uri string, key *Key) string {
+	if method == MethodNone || method == "" {
+		return "#EXT-X-KEY:METHOD=NONE"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "#EXT-X-KEY:METHOD=%s,URI=%q", method, uri)
+	if len(key.IV) == KeySize {
+		b.WriteString(",IV=0x" + hex.EncodeToString(key.IV))
+	}
+	if method == MethodSampleAES {
+		b.WriteString(`,KEYFORMAT="identity"`)
+	}
+
+	return b.String()
+}
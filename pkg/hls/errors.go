@@ -0,0 +1,10 @@
+package hls
+
+import "errors"
+
+var (
+	ErrInvalidKey       = errors.New("invalid hls key")
+	ErrKeyNotFound      = errors.New("hls key not found")
+	ErrUnknownProvider  = errors.New("unknown hls key provider")
+	ErrUnsupportedCrypt = errors.New("unsupported hls encryption method")
+)
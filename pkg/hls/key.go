@@ -0,0 +1,270 @@
+package hls
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ProviderStatic   = "static"
+	ProviderRotating = "rotating"
+	ProviderKMS      = "kms"
+
+	defaultRotateSegments = 10
+	defaultKMSTimeout     = 5 * time.Second
+	kmsCacheSize          = 4096
+)
+
+// Key encrypts segments, players fetch it by ID. IV is optional, segments
+// of keys without one use their sequence number.
+type Key struct {
+	ID  string
+	Key []byte
+	IV  []byte
+}
+
+// KeyProvider hands out the keys of streams.
+type KeyProvider interface {
+	// Key is the key the segment of sequence of stream is encrypted with.
+	Key(ctx context.Context, stream string, sequence uint64) (*Key, error)
+	// Lookup returns the key id of stream, for delivery to players.
+	Lookup(ctx context.Context, stream, id string) (*Key, error)
+}
+
+type KMSSettings struct {
+	// URL is fetched for a key, {stream} and {id} are replaced. The body
+	// is the key, raw, hex or base64.
+	URL            string `json:"url" mapstructure:"url"`
+	Token          string `json:"token" mapstructure:"token"`
+	TimeoutSeconds int    `json:"timeoutSeconds" mapstructure:"timeoutSeconds"`
+}
+
+type KeySettings struct {
+	Provider string `json:"provider" mapstructure:"provider"`
+	// Key of the static provider, 32 hex digits.
+	Key string `json:"key" mapstructure:"key"`
+	// Secret the rotating provider derives keys from, random when empty,
+	// which doesn't survive restarts.
+	Secret string `json:"secret" mapstructure:"secret"`
+	// RotateSegments is how many segments share a key of the rotating and
+	// kms providers.
+	RotateSegments int         `json:"rotateSegments" mapstructure:"rotateSegments"`
+	KMS            KMSSettings `json:"kms" mapstructure:"kms"`
+}
+
+func NewKeyProvider(settings KeySettings) (KeyProvider, error) {
+	switch strings.ToLower(settings.Provider) {
+	case ProviderStatic:
+		return NewStaticKeyProvider(settings.Key)
+	case ProviderRotating, "":
+		return NewRotatingKeyProvider(settings.Secret, settings.RotateSegments)
+	case ProviderKMS:
+		return NewKMSKeyProvider(settings.KMS, settings.RotateSegments)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, settings.Provider)
+	}
+}
+
+// parseKey reads a key of 16 raw bytes, 32 hex digits or base64.
+func parseKey(data []byte) ([]byte, error) {
+	if len(data) == KeySize {
+		return data, nil
+	}
+
+	s := strings.TrimSpace(string(data))
+	if key, err := hex.DecodeString(strings.TrimPrefix(s, "0x")); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+
+	if key, err := base64.StdEncoding.DecodeString(s); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+
+	return nil, ErrInvalidKey
+}
+
+type staticKeyProvider struct {
+	key *Key
+}
+
+// NewStaticKeyProvider encrypts all segments of all streams with one key.
+func NewStaticKeyProvider(hexKey string) (KeyProvider, error) {
+	key, err := parseKey([]byte(hexKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return &staticKeyProvider{key: &Key{ID: "static", Key: key}}, nil
+}
+
+func (p *staticKeyProvider) Key(ctx context.Context, stream string, sequence uint64) (*Key, error) {
+	return p.key, nil
+}
+
+func (p *staticKeyProvider) Lookup(ctx context.Context, stream, id string) (*Key, error) {
+	if id != p.key.ID {
+		return nil, ErrKeyNotFound
+	}
+
+	return p.key, nil
+}
+
+func rotateSegments(n int) uint64 {
+	if n <= 0 {
+		return defaultRotateSegments
+	}
+
+	return uint64(n)
+}
+
+// periodID names the key of the segments of period.
+func periodID(sequence, segments uint64) string {
+	return strconv.FormatUint(sequence/segments, 10)
+}
+
+type rotatingKeyProvider struct {
+	secret   []byte
+	segments uint64
+}
+
+// NewRotatingKeyProvider changes the key of a stream every segments
+// segments. Keys are derived from secret, nodes sharing it agree on them
+// without talking to each other.
+func NewRotatingKeyProvider(secret string, segments int) (KeyProvider, error) {
+	p := &rotatingKeyProvider{
+		secret:   []byte(secret),
+		segments: rotateSegments(segments),
+	}
+
+	if secret == "" {
+		p.secret = make([]byte, 32)
+		if _, err := rand.Read(p.secret); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+func (p *rotatingKeyProvider) derive(stream, id string) *Key {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(stream + "/" + id))
+
+	return &Key{ID: id, Key: mac.Sum(nil)[:KeySize]}
+}
+
+func (p *rotatingKeyProvider) Key(ctx context.Context, stream string, sequence uint64) (*Key, error) {
+	return p.derive(stream, periodID(sequence, p.segments)), nil
+}
+
+func (p *rotatingKeyProvider) Lookup(ctx context.Context, stream, id string) (*Key, error) {
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return nil, ErrKeyNotFound
+	}
+
+	return p.derive(stream, id), nil
+}
+
+type kmsKeyProvider struct {
+	settings KMSSettings
+	segments uint64
+	client   *http.Client
+	lock     sync.Mutex
+	cache    map[string]*Key
+}
+
+// NewKMSKeyProvider fetches the keys of a stream from an external key
+// management service, a new one every segments segments.
+func NewKMSKeyProvider(settings KMSSettings, segments int) (KeyProvider, error) {
+	if settings.URL == "" {
+		return nil, fmt.Errorf("%w: kms without url", ErrUnknownProvider)
+	}
+
+	timeout := defaultKMSTimeout
+	if settings.TimeoutSeconds > 0 {
+		timeout = time.Duration(settings.TimeoutSeconds) * time.Second
+	}
+
+	return &kmsKeyProvider{
+		settings: settings,
+		segments: rotateSegments(segments),
+		client:   &http.Client{Timeout: timeout},
+		cache:    make(map[string]*Key),
+	}, nil
+}
+
+func (p *kmsKeyProvider) Key(ctx context.Context, stream string, sequence uint64) (*Key, error) {
+	return p.Lookup(ctx, stream, periodID(sequence, p.segments))
+}
+
+func (p *kmsKeyProvider) Lookup(ctx context.Context, stream, id string) (*Key, error) {
+	cacheKey := stream + "/" + id
+
+	p.lock.Lock()
+	key := p.cache[cacheKey]
+	p.lock.Unlock()
+
+	if key != nil {
+		return key, nil
+	}
+
+	u := strings.NewReplacer("{stream}", url.PathEscape(stream), "{id}", url.PathEscape(id)).Replace(p.settings.URL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.settings.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.settings.Token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrKeyNotFound
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kms %s: %s", u, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := parseKey(data)
+	if err != nil {
+		return nil, err
+	}
+	key = &Key{ID: id, Key: raw}
+
+	p.lock.Lock()
+	if len(p.cache) >= kmsCacheSize {
+		p.cache = make(map[string]*Key)
+	}
+	p.cache[cacheKey] = key
+	p.lock.Unlock()
+
+	return key, nil
+}
+
+// KeyID is the 16 byte key id of key in common encryption, derived from
+// stream and the id players fetch it by.
+func KeyID(stream string, key *Key) []byte {
+	sum := sha256.Sum256([]byte(stream + "/" + key.ID))
+	return sum[:KeySize]
+}
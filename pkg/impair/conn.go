@@ -0,0 +1,295 @@
+package impair
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/clock"
+)
+
+const (
+	maxPacketSize = 65535
+	// packets arrived but not read, more are lost like on a full socket
+	receiveBuffer = 1024
+)
+
+// sender writes the packets of a direction when they arrive.
+type sender struct {
+	clock  clock.Clock
+	shaper *shaper
+	pipe   *pipe
+}
+
+func newSender(c clock.Clock, s *shaper, write func(p *packet)) *sender {
+	return &sender{clock: c, shaper: s, pipe: newPipe(c, write)}
+}
+
+func (s *sender) send(b []byte, addr net.Addr) bool {
+	at, ok := s.shaper.due(len(b), s.clock.Now())
+	if !ok {
+		return false
+	}
+
+	s.pipe.push(&packet{at: at, data: append([]byte(nil), b...), addr: addr})
+
+	return true
+}
+
+// receiver reads the packets of a connection as they arrive.
+type receiver struct {
+	clock   clock.Clock
+	shaper  *shaper
+	read    func(b []byte) (int, net.Addr, error)
+	pipe    *pipe
+	packets chan *packet
+	once    sync.Once
+	failed  chan struct{}
+
+	lock     sync.Mutex
+	err      error
+	deadline time.Time
+	// closed when the deadline changes
+	changed chan struct{}
+}
+
+func newReceiver(c clock.Clock, s *shaper, read func(b []byte) (int, net.Addr, error)) *receiver {
+	r := &receiver{
+		clock:   c,
+		shaper:  s,
+		read:    read,
+		packets: make(chan *packet, receiveBuffer),
+		failed:  make(chan struct{}),
+		changed: make(chan struct{}),
+	}
+	r.pipe = newPipe(c, func(p *packet) {
+		select {
+		case r.packets <- p:
+		default:
+		}
+	})
+
+	return r
+}
+
+func (r *receiver) loop() {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := r.read(buf)
+		if err != nil {
+			r.lock.Lock()
+			r.err = err
+			r.lock.Unlock()
+			close(r.failed)
+			return
+		}
+
+		if at, ok := r.shaper.due(n, r.clock.Now()); ok {
+			r.pipe.push(&packet{at: at, data: append([]byte(nil), buf[:n]...), addr: addr})
+		}
+	}
+}
+
+func (r *receiver) readFrom(b []byte) (int, net.Addr, error) {
+	r.once.Do(func() {
+		go r.loop()
+	})
+
+	for {
+		r.lock.Lock()
+		deadline, changed := r.deadline, r.changed
+		r.lock.Unlock()
+
+		// deadlines are on the wall clock of the caller
+		var expired <-chan time.Time
+		var timer *time.Timer
+		if !deadline.IsZero() {
+			wait := time.Until(deadline)
+			if wait <= 0 {
+				return 0, nil, os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(wait)
+			expired = timer.C
+		}
+
+		select {
+		case p := <-r.packets:
+			if timer != nil {
+				timer.Stop()
+			}
+			return copy(b, p.data), p.addr, nil
+		case <-r.failed:
+			if timer != nil {
+				timer.Stop()
+			}
+			r.lock.Lock()
+			defer r.lock.Unlock()
+			return 0, nil, r.err
+		case <-changed:
+			if timer != nil {
+				timer.Stop()
+			}
+		case <-expired:
+			return 0, nil, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+func (r *receiver) setDeadline(t time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.deadline = t
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func (r *receiver) close() {
+	r.pipe.close()
+}
+
+// PacketConn impairs a net.PacketConn, what is written on the way out and
+// what is read on the way in.
+type PacketConn struct {
+	net.PacketConn
+	sender   *sender
+	receiver *receiver
+}
+
+func NewPacketConn(conn net.PacketConn, settings Settings) *PacketConn {
+	c := &PacketConn{PacketConn: conn}
+	clk := clock.Or(settings.Clock)
+
+	if settings.Send.Enabled() {
+		c.sender = newSender(clk, newShaper(settings.Send, false, settings.rand(false)), func(p *packet) {
+			// a connected socket writes without an address
+			if w, ok := conn.(io.Writer); ok && p.addr == nil {
+				_, _ = w.Write(p.data)
+				return
+			}
+			_, _ = conn.WriteTo(p.data, p.addr)
+		})
+	}
+
+	if settings.Receive.Enabled() {
+		c.receiver = newReceiver(clk, newShaper(settings.Receive, false, settings.rand(true)), conn.ReadFrom)
+	}
+
+	return c
+}
+
+func (c *PacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	if c.receiver == nil {
+		return c.PacketConn.ReadFrom(b)
+	}
+
+	return c.receiver.readFrom(b)
+}
+
+// WriteTo writes b when it arrives, a lost packet is written as far as the
+// writer can tell.
+func (c *PacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if c.sender == nil {
+		return c.PacketConn.WriteTo(b, addr)
+	}
+
+	c.sender.send(b, addr)
+
+	return len(b), nil
+}
+
+func (c *PacketConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+
+	return c.PacketConn.SetWriteDeadline(t)
+}
+
+func (c *PacketConn) SetReadDeadline(t time.Time) error {
+	if c.receiver == nil {
+		return c.PacketConn.SetReadDeadline(t)
+	}
+
+	c.receiver.setDeadline(t)
+
+	return nil
+}
+
+func (c *PacketConn) Close() error {
+	if c.sender != nil {
+		c.sender.pipe.close()
+	}
+	if c.receiver != nil {
+		c.receiver.close()
+	}
+
+	return c.PacketConn.Close()
+}
+
+// Conn impairs what is written to a stream, e.g. rtsp over tcp. A stream
+// loses and reorders nothing, its bytes are delayed and paced in order, a
+// writer faster than the bandwidth is held back.
+type Conn struct {
+	net.Conn
+	clock  clock.Clock
+	sender *sender
+
+	lock sync.Mutex
+	err  error
+}
+
+func NewConn(conn net.Conn, settings Settings) *Conn {
+	c := &Conn{Conn: conn, clock: clock.Or(settings.Clock)}
+	if !settings.Send.Enabled() {
+		return c
+	}
+
+	c.sender = newSender(c.clock, newShaper(settings.Send, true, settings.rand(false)), func(p *packet) {
+		c.lock.Lock()
+		failed := c.err != nil
+		c.lock.Unlock()
+		if failed {
+			return
+		}
+
+		if _, err := conn.Write(p.data); err != nil {
+			c.lock.Lock()
+			c.err = err
+			c.lock.Unlock()
+		}
+	})
+
+	return c
+}
+
+// Write returns the error of a write of what was written before.
+func (c *Conn) Write(b []byte) (int, error) {
+	if c.sender == nil {
+		return c.Conn.Write(b)
+	}
+
+	c.lock.Lock()
+	err := c.err
+	c.lock.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	c.sender.send(b, nil)
+	if wait := c.sender.shaper.backlog(c.clock.Now()) - c.sender.shaper.queue(); wait > 0 {
+		c.clock.Sleep(wait)
+	}
+
+	return len(b), nil
+}
+
+func (c *Conn) Close() error {
+	if c.sender != nil {
+		c.sender.pipe.close()
+	}
+
+	return c.Conn.Close()
+}
@@ -0,0 +1,250 @@
+// Package impair degrades connections like a bad network does, losing,
+// reordering, delaying and pacing their packets, so nack, fec and bitrate
+// adaptation are tried in tests and a debug mode without tc or netem.
+package impair
+
+import (
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/clock"
+)
+
+const (
+	// how long packets wait for the bandwidth when Queue is 0
+	defaultQueue = 100 * time.Millisecond
+	// how much later than its delay a reordered packet arrives
+	reorderDelay = 20 * time.Millisecond
+)
+
+// Profile is how one direction of a connection is impaired, the zero value
+// leaves it alone.
+type Profile struct {
+	// Loss is the fraction of packets lost, 0.05 for 5%.
+	Loss float64 `json:"loss,omitempty" yaml:"loss,omitempty" mapstructure:"loss,omitempty"`
+	// Reorder is the fraction of packets held back for later ones to pass.
+	Reorder float64 `json:"reorder,omitempty" yaml:"reorder,omitempty" mapstructure:"reorder,omitempty"`
+	// Delay is how late every packet arrives.
+	Delay time.Duration `json:"delay,omitempty" yaml:"delay,omitempty" mapstructure:"delay,omitempty"`
+	// Jitter is added to or taken from the delay, uniformly, packets it
+	// moves past each other are reordered.
+	Jitter time.Duration `json:"jitter,omitempty" yaml:"jitter,omitempty" mapstructure:"jitter,omitempty"`
+	// Bandwidth caps the bits per second, 0 is unlimited.
+	Bandwidth uint64 `json:"bandwidth,omitempty" yaml:"bandwidth,omitempty" mapstructure:"bandwidth,omitempty"`
+	// Queue is how long packets wait for the bandwidth before the next are
+	// lost, 100ms when 0.
+	Queue time.Duration `json:"queue,omitempty" yaml:"queue,omitempty" mapstructure:"queue,omitempty"`
+}
+
+func (p Profile) Enabled() bool {
+	return p != (Profile{})
+}
+
+// Settings impair what a connection sends and what it receives.
+type Settings struct {
+	Send    Profile `json:"send,omitempty" yaml:"send,omitempty" mapstructure:"send,omitempty"`
+	Receive Profile `json:"receive,omitempty" yaml:"receive,omitempty" mapstructure:"receive,omitempty"`
+	// Seed repeats the same losses, a random one when 0.
+	Seed int64 `json:"seed,omitempty" yaml:"seed,omitempty" mapstructure:"seed,omitempty"`
+	// Clock times the packets, clock.Default() when nil.
+	Clock clock.Clock `json:"-" yaml:"-" mapstructure:"-"`
+}
+
+func (s *Settings) Enabled() bool {
+	return s.Send.Enabled() || s.Receive.Enabled()
+}
+
+// rand is the source of a direction, one sends with seed and receives with
+// the next.
+func (s *Settings) rand(receive bool) *rand.Rand {
+	seed := s.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	if receive {
+		seed++
+	}
+
+	return rand.New(rand.NewSource(seed))
+}
+
+// shaper decides when the packets of a direction arrive.
+type shaper struct {
+	profile Profile
+	// a stream loses and reorders nothing
+	stream bool
+	lock   sync.Mutex
+	rand   *rand.Rand
+	// when the bandwidth is free again
+	busyUntil time.Time
+	// when the last packet of a stream arrives
+	last time.Time
+}
+
+func newShaper(p Profile, stream bool, r *rand.Rand) *shaper {
+	return &shaper{profile: p, stream: stream, rand: r}
+}
+
+func (s *shaper) queue() time.Duration {
+	if s.profile.Queue > 0 {
+		return s.profile.Queue
+	}
+
+	return defaultQueue
+}
+
+// due is when a packet of size sent at now arrives, false when it is lost.
+func (s *shaper) due(size int, now time.Time) (time.Time, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	p := s.profile
+	if !s.stream && p.Loss > 0 && s.rand.Float64() < p.Loss {
+		return time.Time{}, false
+	}
+
+	at := now
+	if p.Bandwidth > 0 {
+		if s.busyUntil.After(at) {
+			at = s.busyUntil
+		}
+		if !s.stream && at.Sub(now) > s.queue() {
+			// the queue is full
+			return time.Time{}, false
+		}
+		at = at.Add(time.Duration(float64(size*8) / float64(p.Bandwidth) * float64(time.Second)))
+		s.busyUntil = at
+	}
+
+	at = at.Add(p.Delay)
+	if p.Jitter > 0 {
+		at = at.Add(time.Duration((s.rand.Float64()*2 - 1) * float64(p.Jitter)))
+	}
+	if !s.stream && p.Reorder > 0 && s.rand.Float64() < p.Reorder {
+		at = at.Add(reorderDelay + p.Jitter)
+	}
+
+	if at.Before(now) {
+		at = now
+	}
+	if s.stream {
+		// the bytes of a stream stay in order
+		if at.Before(s.last) {
+			at = s.last
+		}
+		s.last = at
+	}
+
+	return at, true
+}
+
+// backlog is how long what was sent by now waits for the bandwidth.
+func (s *shaper) backlog(now time.Time) time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.busyUntil.Sub(now)
+}
+
+type packet struct {
+	at   time.Time
+	data []byte
+	addr net.Addr
+}
+
+// pipe hands the packets over at their time, in the order of it.
+type pipe struct {
+	clock   clock.Clock
+	deliver func(p *packet)
+	lock    sync.Mutex
+	queue   []*packet
+	wake    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newPipe(c clock.Clock, deliver func(p *packet)) *pipe {
+	p := &pipe{
+		clock:   c,
+		deliver: deliver,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go p.run()
+
+	return p
+}
+
+func (p *pipe) push(pkt *packet) {
+	p.lock.Lock()
+	// those of the same time keep the order they were pushed in
+	i := sort.Search(len(p.queue), func(i int) bool {
+		return p.queue[i].at.After(pkt.at)
+	})
+	p.queue = append(p.queue, nil)
+	copy(p.queue[i+1:], p.queue[i:])
+	p.queue[i] = pkt
+	p.lock.Unlock()
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *pipe) run() {
+	for {
+		p.lock.Lock()
+		now := p.clock.Now()
+		var due []*packet
+		for len(p.queue) > 0 && !p.queue[0].at.After(now) {
+			due = append(due, p.queue[0])
+			p.queue = p.queue[1:]
+		}
+		wait := time.Duration(-1)
+		if len(p.queue) > 0 {
+			wait = p.queue[0].at.Sub(now)
+		}
+		p.lock.Unlock()
+
+		if len(due) > 0 {
+			for _, pkt := range due {
+				p.deliver(pkt)
+			}
+			continue
+		}
+
+		var timer *clock.Timer
+		var fired <-chan time.Time
+		if wait >= 0 {
+			timer = p.clock.NewTimer(wait)
+			fired = timer.C
+		}
+
+		select {
+		case <-p.done:
+		case <-p.wake:
+		case <-fired:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		select {
+		case <-p.done:
+			return
+		default:
+		}
+	}
+}
+
+// close drops what has not arrived.
+func (p *pipe) close() {
+	p.once.Do(func() {
+		close(p.done)
+	})
+}
@@ -0,0 +1,98 @@
+package impair
+
+import (
+	"net"
+	"time"
+
+	"github.com/pion/transport/v3"
+)
+
+// Net impairs the udp sockets of a pion network, e.g. those ice gathers on
+// with webrtc.SettingEngine.SetNet. Tcp is left alone.
+type Net struct {
+	transport.Net
+	settings Settings
+}
+
+func NewNet(n transport.Net, settings Settings) *Net {
+	return &Net{Net: n, settings: settings}
+}
+
+func (n *Net) ListenPacket(network string, address string) (net.PacketConn, error) {
+	conn, err := n.Net.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPacketConn(conn, n.settings), nil
+}
+
+func (n *Net) ListenUDP(network string, locAddr *net.UDPAddr) (transport.UDPConn, error) {
+	conn, err := n.Net.ListenUDP(network, locAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	return newUDPConn(conn, n.settings), nil
+}
+
+func (n *Net) DialUDP(network string, laddr, raddr *net.UDPAddr) (transport.UDPConn, error) {
+	conn, err := n.Net.DialUDP(network, laddr, raddr)
+	if err != nil {
+		return nil, err
+	}
+
+	return newUDPConn(conn, n.settings), nil
+}
+
+// udpConn is a PacketConn for the udp methods, the msg ones are not
+// impaired.
+type udpConn struct {
+	transport.UDPConn
+	impaired *PacketConn
+}
+
+func newUDPConn(conn transport.UDPConn, settings Settings) *udpConn {
+	return &udpConn{UDPConn: conn, impaired: NewPacketConn(conn, settings)}
+}
+
+func (c *udpConn) Read(b []byte) (int, error) {
+	n, _, err := c.impaired.ReadFrom(b)
+	return n, err
+}
+
+func (c *udpConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	return c.impaired.ReadFrom(b)
+}
+
+func (c *udpConn) ReadFromUDP(b []byte) (int, *net.UDPAddr, error) {
+	n, addr, err := c.impaired.ReadFrom(b)
+	udpAddr, _ := addr.(*net.UDPAddr)
+
+	return n, udpAddr, err
+}
+
+// Write sends to the remote address of a connected socket.
+func (c *udpConn) Write(b []byte) (int, error) {
+	return c.impaired.WriteTo(b, nil)
+}
+
+func (c *udpConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return c.impaired.WriteTo(b, addr)
+}
+
+func (c *udpConn) WriteToUDP(b []byte, addr *net.UDPAddr) (int, error) {
+	return c.impaired.WriteTo(b, addr)
+}
+
+func (c *udpConn) SetDeadline(t time.Time) error {
+	return c.impaired.SetDeadline(t)
+}
+
+func (c *udpConn) SetReadDeadline(t time.Time) error {
+	return c.impaired.SetReadDeadline(t)
+}
+
+func (c *udpConn) Close() error {
+	return c.impaired.Close()
+}
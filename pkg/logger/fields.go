@@ -0,0 +1,28 @@
+package logger
+
+import "github.com/sirupsen/logrus"
+
+const (
+	FieldModule     = "module"
+	FieldScope      = "scope"
+	FieldStream     = "stream"
+	FieldSession    = "session"
+	FieldRemoteAddr = "remoteAddr"
+)
+
+func SessionFields(stream, session, remoteAddr string) logrus.Fields {
+	fields := logrus.Fields{}
+	if stream != "" {
+		fields[FieldStream] = stream
+	}
+
+	if session != "" {
+		fields[FieldSession] = session
+	}
+
+	if remoteAddr != "" {
+		fields[FieldRemoteAddr] = remoteAddr
+	}
+
+	return fields
+}
@@ -0,0 +1,80 @@
+package logger
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ModuleLevelFormatter drops entries whose level is above the level configured
+// for the entry's module, so one module can be made verbose without raising
+// the global level.
+type ModuleLevelFormatter struct {
+	logrus.Formatter
+	DefaultLevel logrus.Level
+	Levels       map[string]logrus.Level
+}
+
+func (f *ModuleLevelFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if entry.Level > f.levelOf(entry) {
+		return nil, nil
+	}
+
+	return f.Formatter.Format(entry)
+}
+
+func (f *ModuleLevelFormatter) levelOf(entry *logrus.Entry) logrus.Level {
+	for _, key := range []string{FieldModule, FieldScope} {
+		name, ok := entry.Data[key].(string)
+		if !ok {
+			continue
+		}
+
+		if level, found := f.Levels[name]; found {
+			return level
+		}
+	}
+
+	return f.DefaultLevel
+}
+
+// SetModuleLevels installs a ModuleLevelFormatter on l. The logger level is raised
+// to the most verbose configured level so filtering happens in the formatter.
+func SetModuleLevels(l *logrus.Logger, levels map[string]string) error {
+	formatter := l.Formatter
+	defaultLevel := l.GetLevel()
+	if mf, ok := formatter.(*ModuleLevelFormatter); ok {
+		formatter = mf.Formatter
+		defaultLevel = mf.DefaultLevel
+	}
+
+	if len(levels) == 0 {
+		l.SetFormatter(formatter)
+		l.SetLevel(defaultLevel)
+		return nil
+	}
+
+	mf := &ModuleLevelFormatter{
+		Formatter:    formatter,
+		DefaultLevel: defaultLevel,
+		Levels:       make(map[string]logrus.Level, len(levels)),
+	}
+
+	maxLevel := defaultLevel
+	for name, lv := range levels {
+		level, err := logrus.ParseLevel(lv)
+		if err != nil {
+			return fmt.Errorf("module %s: %w", name, err)
+		}
+
+		mf.Levels[name] = level
+		if level > maxLevel {
+			maxLevel = level
+		}
+	}
+
+	l.SetFormatter(mf)
+	l.SetLevel(maxLevel)
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package logger
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TailEntry is a log line kept by Tail.
+type TailEntry struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// Tail is a hook keeping the last lines logged, as far as the module levels
+// let them through.
+type Tail struct {
+	lock    sync.Mutex
+	entries []TailEntry
+	next    int
+	full    bool
+}
+
+func NewTail(size int) *Tail {
+	if size <= 0 {
+		size = 1
+	}
+
+	return &Tail{entries: make([]TailEntry, size)}
+}
+
+func (t *Tail) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (t *Tail) Fire(entry *logrus.Entry) error {
+	if entry.Logger != nil {
+		if mf, ok := entry.Logger.Formatter.(*ModuleLevelFormatter); ok && entry.Level > mf.levelOf(entry) {
+			return nil
+		}
+	}
+
+	e := TailEntry{
+		Time:    entry.Time,
+		Level:   entry.Level.String(),
+		Message: entry.Message,
+	}
+	if len(entry.Data) > 0 {
+		e.Fields = make(map[string]string, len(entry.Data))
+		for k, v := range entry.Data {
+			if err, ok := v.(error); ok {
+				e.Fields[k] = err.Error()
+			} else {
+				e.Fields[k] = fmt.Sprint(v)
+			}
+		}
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.entries[t.next] = e
+	t.next++
+	if t.next == len(t.entries) {
+		t.next, t.full = 0, true
+	}
+
+	return nil
+}
+
+// Lines returns up to n of the last lines, the oldest first.
+func (t *Tail) Lines(n int) []TailEntry {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	count := t.next
+	if t.full {
+		count = len(t.entries)
+	}
+	if n <= 0 || n > count {
+		n = count
+	}
+
+	lines := make([]TailEntry, 0, n)
+	for i := t.next - n; i < t.next; i++ {
+		lines = append(lines, t.entries[(i+len(t.entries))%len(t.entries)])
+	}
+
+	return lines
+}
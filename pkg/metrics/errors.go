@@ -0,0 +1,7 @@
+package metrics
+
+import "errors"
+
+var (
+	ErrCollectorExists = errors.New("collector already registered")
+)
@@ -0,0 +1,408 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type metricType string
+
+const (
+	typeCounter   metricType = "counter"
+	typeGauge     metricType = "gauge"
+	typeHistogram metricType = "histogram"
+)
+
+type Collector interface {
+	Name() string
+	Help() string
+	collect() []sample
+	metricType() metricType
+}
+
+type sample struct {
+	labels  []string
+	values  []string
+	value   float64
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+type Counter struct {
+	bits uint64
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+
+	for {
+		old := atomic.LoadUint64(&c.bits)
+		n := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&c.bits, old, n) {
+			return
+		}
+	}
+}
+
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&c.bits))
+}
+
+type Gauge struct {
+	bits uint64
+}
+
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+func (g *Gauge) Add(v float64) {
+	for {
+		old := atomic.LoadUint64(&g.bits)
+		n := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&g.bits, old, n) {
+			return
+		}
+	}
+}
+
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+type Histogram struct {
+	lock    sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+
+	h.sum += v
+	h.count++
+}
+
+func (h *Histogram) snapshot() ([]uint64, float64, uint64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	counts := make([]uint64, len(h.counts))
+	copy(counts, h.counts)
+
+	return counts, h.sum, h.count
+}
+
+var (
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+)
+
+type vec struct {
+	name     string
+	help     string
+	labels   []string
+	lock     sync.RWMutex
+	children map[string]interface{}
+	values   map[string][]string
+	newChild func() interface{}
+}
+
+func newVec(name, help string, labels []string, newChild func() interface{}) *vec {
+	return &vec{
+		name:     name,
+		help:     help,
+		labels:   labels,
+		children: make(map[string]interface{}),
+		values:   make(map[string][]string),
+		newChild: newChild,
+	}
+}
+
+func (v *vec) Name() string {
+	return v.name
+}
+
+func (v *vec) Help() string {
+	return v.help
+}
+
+func (v *vec) with(values ...string) interface{} {
+	if len(values) != len(v.labels) {
+		panic("metrics: " + v.name + " label cardinality mismatch")
+	}
+
+	key := strings.Join(values, "\xff")
+
+	v.lock.RLock()
+	child, found := v.children[key]
+	v.lock.RUnlock()
+	if found {
+		return child
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if child, found = v.children[key]; found {
+		return child
+	}
+
+	child = v.newChild()
+	v.children[key] = child
+	v.values[key] = append([]string(nil), values...)
+
+	return child
+}
+
+func (v *vec) each(f func(values []string, child interface{})) {
+	v.lock.RLock()
+	keys := make([]string, 0, len(v.children))
+	for k := range v.children {
+		keys = append(keys, k)
+	}
+	v.lock.RUnlock()
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v.lock.RLock()
+		child, values := v.children[k], v.values[k]
+		v.lock.RUnlock()
+		f(values, child)
+	}
+}
+
+type CounterVec struct {
+	*vec
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{
+		vec: newVec(name, help, labels, func() interface{} { return &Counter{} }),
+	}
+}
+
+func (cv *CounterVec) With(values ...string) *Counter {
+	return cv.with(values...).(*Counter)
+}
+
+// Total sums the counters of all label values.
+func (cv *CounterVec) Total() float64 {
+	total := 0.0
+	cv.each(func(_ []string, child interface{}) {
+		total += child.(*Counter).Value()
+	})
+
+	return total
+}
+
+func (cv *CounterVec) metricType() metricType {
+	return typeCounter
+}
+
+func (cv *CounterVec) collect() []sample {
+	samples := make([]sample, 0)
+	cv.each(func(values []string, child interface{}) {
+		samples = append(samples, sample{
+			labels: cv.labels,
+			values: values,
+			value:  child.(*Counter).Value(),
+		})
+	})
+
+	return samples
+}
+
+type GaugeVec struct {
+	*vec
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{
+		vec: newVec(name, help, labels, func() interface{} { return &Gauge{} }),
+	}
+}
+
+func (gv *GaugeVec) With(values ...string) *Gauge {
+	return gv.with(values...).(*Gauge)
+}
+
+func (gv *GaugeVec) metricType() metricType {
+	return typeGauge
+}
+
+func (gv *GaugeVec) collect() []sample {
+	samples := make([]sample, 0)
+	gv.each(func(values []string, child interface{}) {
+		samples = append(samples, sample{
+			labels: gv.labels,
+			values: values,
+			value:  child.(*Gauge).Value(),
+		})
+	})
+
+	return samples
+}
+
+type HistogramVec struct {
+	*vec
+	buckets []float64
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	return &HistogramVec{
+		vec:     newVec(name, help, labels, func() interface{} { return newHistogram(sorted) }),
+		buckets: sorted,
+	}
+}
+
+func (hv *HistogramVec) With(values ...string) *Histogram {
+	return hv.with(values...).(*Histogram)
+}
+
+func (hv *HistogramVec) metricType() metricType {
+	return typeHistogram
+}
+
+func (hv *HistogramVec) collect() []sample {
+	samples := make([]sample, 0)
+	hv.each(func(values []string, child interface{}) {
+		counts, sum, count := child.(*Histogram).snapshot()
+		samples = append(samples, sample{
+			labels:  hv.labels,
+			values:  values,
+			buckets: hv.buckets,
+			counts:  counts,
+			sum:     sum,
+			count:   count,
+		})
+	})
+
+	return samples
+}
+
+type GaugeFunc struct {
+	name string
+	help string
+	f    func() float64
+}
+
+func NewGaugeFunc(name, help string, f func() float64) *GaugeFunc {
+	return &GaugeFunc{
+		name: name,
+		help: help,
+		f:    f,
+	}
+}
+
+func (gf *GaugeFunc) Name() string {
+	return gf.name
+}
+
+func (gf *GaugeFunc) Help() string {
+	return gf.help
+}
+
+func (gf *GaugeFunc) metricType() metricType {
+	return typeGauge
+}
+
+func (gf *GaugeFunc) collect() []sample {
+	return []sample{{value: gf.f()}}
+}
+
+// LabeledValue is one sample of a GaugeVecFunc.
+type LabeledValue struct {
+	Values []string
+	Value  float64
+}
+
+// GaugeVecFunc reports gauges of objects that come and go, e.g. streams,
+// the samples are taken on collection.
+type GaugeVecFunc struct {
+	name   string
+	help   string
+	labels []string
+	f      func() []LabeledValue
+}
+
+func NewGaugeVecFunc(name, help string, f func() []LabeledValue, labels ...string) *GaugeVecFunc {
+	return &GaugeVecFunc{
+		name:   name,
+		help:   help,
+		labels: labels,
+		f:      f,
+	}
+}
+
+func (gf *GaugeVecFunc) Name() string {
+	return gf.name
+}
+
+func (gf *GaugeVecFunc) Help() string {
+	return gf.help
+}
+
+func (gf *GaugeVecFunc) metricType() metricType {
+	return typeGauge
+}
+
+func (gf *GaugeVecFunc) collect() []sample {
+	values := gf.f()
+	samples := make([]sample, 0, len(values))
+	for _, v := range values {
+		if len(v.Values) != len(gf.labels) {
+			continue
+		}
+
+		samples = append(samples, sample{
+			labels: gf.labels,
+			values: v.Values,
+			value:  v.Value,
+		})
+	}
+
+	return samples
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import "runtime"
+
+const (
+	ProtocolRTSP   = "rtsp"
+	ProtocolWebRTC = "webrtc"
+)
+
+var (
+	Connections = NewCounterVec("neon_connections_total",
+		"Total number of accepted connections.", "protocol")
+	ActiveConnections = NewGaugeVec("neon_active_connections",
+		"Number of currently open connections.", "protocol")
+	BytesIn = NewCounterVec("neon_bytes_in_total",
+		"Total bytes received.", "protocol")
+	BytesOut = NewCounterVec("neon_bytes_out_total",
+		"Total bytes sent.", "protocol")
+	ActiveStreams = NewGaugeVec("neon_active_streams",
+		"Number of active streams.", "namespace")
+	RTPPacketsLost = NewCounterVec("neon_rtp_packets_lost_total",
+		"Total RTP packets detected as lost from sequence gaps.", "kind")
+	RTPJitter = NewHistogramVec("neon_rtp_jitter_seconds",
+		"Interarrival jitter of received RTP streams, RFC 3550.",
+		[]float64{.001, .005, .01, .02, .05, .1, .2, .5}, "kind")
+	FrameLatency = NewHistogramVec("neon_frame_deliver_seconds",
+		"Time spent fanning a frame out to all destinations.",
+		[]float64{.0001, .0005, .001, .005, .01, .05, .1}, "format")
+	UDPPortsInUse = NewGaugeVec("neon_udp_ports_in_use",
+		"Number of allocated media UDP ports.", "pool")
+	UDPPortsExhausted = NewCounterVec("neon_udp_ports_exhausted_total",
+		"Total media UDP port allocations that failed because the range was full.", "pool")
+	ServerErrors = NewCounterVec("neon_server_errors_total",
+		"Total errors of listeners and their connections, by kind: eventloop, read or serve.", "protocol", "kind")
+	EventsDropped = NewCounterVec("neon_events_dropped_total",
+		"Total events dropped because the queue of an emitter was full.", "emitter")
+	Goroutines = NewGaugeFunc("neon_goroutines",
+		"Number of goroutines that currently exist.", func() float64 {
+			return float64(runtime.NumGoroutine())
+		})
+	ModuleGoroutines = NewGaugeVec("neon_module_goroutines",
+		"Number of goroutines running the loop or a worker of a module.", "module")
+)
+
+// Track counts the calling goroutine in ModuleGoroutines of module until the
+// returned func is called, e.g. defer metrics.Track("core")().
+func Track(module string) func() {
+	g := ModuleGoroutines.With(module)
+	g.Inc()
+	return g.Dec
+}
+
+// Go runs f in a new goroutine counted in ModuleGoroutines of module.
+func Go(module string, f func()) {
+	g := ModuleGoroutines.With(module)
+	g.Inc()
+	go func() {
+		defer g.Dec()
+		f()
+	}()
+}
+
+func init() {
+	defaultRegistry.MustRegister(
+		Connections,
+		ActiveConnections,
+		BytesIn,
+		BytesOut,
+		ActiveStreams,
+		RTPPacketsLost,
+		RTPJitter,
+		FrameLatency,
+		UDPPortsInUse,
+		UDPPortsExhausted,
+		ServerErrors,
+		EventsDropped,
+		Goroutines,
+		ModuleGoroutines,
+	)
+}
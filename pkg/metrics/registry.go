@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Registry struct {
+	lock       sync.RWMutex
+	collectors map[string]Collector
+}
+
+var (
+	defaultRegistry = NewRegistry()
+)
+
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: make(map[string]Collector),
+	}
+}
+
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+func (r *Registry) Register(c Collector) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, found := r.collectors[c.Name()]; found {
+		return ErrCollectorExists
+	}
+
+	r.collectors[c.Name()] = c
+
+	return nil
+}
+
+func (r *Registry) MustRegister(cs ...Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(fmt.Sprintf("metrics: register %s: %v", c.Name(), err))
+		}
+	}
+}
+
+func (r *Registry) Unregister(name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.collectors, name)
+}
+
+// WritePrometheus writes all collectors in the prometheus text exposition format.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.lock.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	r.lock.RUnlock()
+
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		r.lock.RLock()
+		c, found := r.collectors[name]
+		r.lock.RUnlock()
+		if !found {
+			continue
+		}
+
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, escapeHelp(c.Help()))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, c.metricType())
+
+		for _, s := range c.collect() {
+			if c.metricType() != typeHistogram {
+				fmt.Fprintf(bw, "%s%s %s\n", name, formatLabels(s.labels, s.values), formatFloat(s.value))
+				continue
+			}
+
+			labels := append(append([]string(nil), s.labels...), "le")
+			for i, b := range s.buckets {
+				values := append(append([]string(nil), s.values...), formatFloat(b))
+				fmt.Fprintf(bw, "%s_bucket%s %d\n", name, formatLabels(labels, values), s.counts[i])
+			}
+
+			values := append(append([]string(nil), s.values...), "+Inf")
+			fmt.Fprintf(bw, "%s_bucket%s %d\n", name, formatLabels(labels, values), s.count)
+			fmt.Fprintf(bw, "%s_sum%s %s\n", name, formatLabels(s.labels, s.values), formatFloat(s.sum))
+			fmt.Fprintf(bw, "%s_count%s %d\n", name, formatLabels(s.labels, s.values), s.count)
+		}
+	}
+
+	return bw.Flush()
+}
+
+func formatLabels(labels, values []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(l)
+		sb.WriteString(`="`)
+		sb.WriteString(escapeLabel(values[i]))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+
+	return sb.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
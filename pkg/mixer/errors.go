@@ -0,0 +1,10 @@
+package mixer
+
+import "errors"
+
+var (
+	ErrMixerExists   = errors.New("mixer exists")
+	ErrInputExists   = errors.New("mixer input exists")
+	ErrInputNotFound = errors.New("mixer input not found")
+	ErrInvalidGain   = errors.New("invalid gain")
+)
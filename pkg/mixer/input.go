@@ -0,0 +1,171 @@
+package mixer
+
+import (
+	"sync"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/record"
+	"github.com/pingostack/neon/pkg/transcoder"
+	"github.com/sirupsen/logrus"
+)
+
+// InputInfo is the state of an input of a mix.
+type InputInfo struct {
+	Stream string  `json:"stream"`
+	Gain   float64 `json:"gain"`
+	// Codec is the audio of the stream, empty before it was seen or when it
+	// is not decoded.
+	Codec string `json:"codec"`
+	// Mixed is false while the input buffers, before it is heard and after
+	// it ran dry.
+	Mixed     bool   `json:"mixed"`
+	Underruns uint64 `json:"underruns"`
+	// Dropped are the samples per channel thrown away because the input sent
+	// faster than the mix or bursted beyond the buffer.
+	Dropped uint64 `json:"dropped"`
+}
+
+// input decodes the audio of a stream to the pcm of the mix and buffers it
+// until the mix takes it.
+type input struct {
+	*record.FrameDestination
+	stream string
+	mixer  *Mixer
+	logger *logrus.Entry
+
+	lock      sync.Mutex
+	gain      float64
+	codec     string
+	decoder   transcoder.AudioDecoder
+	resampler transcoder.Resampler
+	pcm       []int16
+	mixed     bool
+	underruns uint64
+	dropped   uint64
+}
+
+func newInput(m *Mixer, stream string, gain float64) *input {
+	in := &input{
+		stream: stream,
+		mixer:  m,
+		gain:   gain,
+		logger: m.logger.WithField("input", stream),
+	}
+	in.FrameDestination = record.NewFrameDestination(m.Context(), in.logger)
+	in.OnMetadataChange(in.onMetadata)
+	in.OnRawFrame(in.onFrame)
+
+	return in
+}
+
+// OnFrame keeps the video from the depacketizers, only audio is mixed.
+func (in *input) OnFrame(frame deliver.Frame, attr deliver.Attributes) {
+	if !frame.Codec.IsAudio() {
+		return
+	}
+
+	in.FrameDestination.OnFrame(frame, attr)
+}
+
+func (in *input) onMetadata(md *deliver.Metadata) {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+
+	in.decoder, in.resampler, in.codec = nil, nil, ""
+	in.pcm, in.mixed = in.pcm[:0], false
+
+	if !md.HasAudio() {
+		return
+	}
+
+	decoder, codec, err := transcoder.NewAudioDecoder(md.Audio.CodecType)
+	if err != nil {
+		in.logger.WithError(err).WithField("codec", md.Audio.CodecType.String()).Warn("audio not mixed")
+		return
+	}
+
+	in.decoder, in.codec = decoder, md.Audio.CodecType.String()
+	in.resampler = transcoder.NewResampler(int(codec.SampleRate), codec.Channels,
+		int(in.mixer.codec.SampleRate), in.mixer.codec.Channels)
+}
+
+func (in *input) onFrame(frame deliver.Frame) {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+
+	if in.decoder == nil {
+		return
+	}
+
+	pcm, err := in.decoder.Decode(frame.Payload)
+	if err != nil {
+		in.logger.WithError(err).Debug("audio decode failed")
+		return
+	}
+
+	in.pcm = append(in.pcm, in.resampler.Resample(pcm)...)
+
+	// a burst or a publisher clocked faster than the mix, the oldest goes
+	// so the input stays in time
+	channels := in.mixer.codec.Channels
+	if limit := in.mixer.maxDelay * channels; len(in.pcm) > limit {
+		drop := len(in.pcm) - limit
+		drop -= drop % channels
+		in.pcm = append(in.pcm[:0], in.pcm[drop:]...)
+		in.dropped += uint64(drop / channels)
+	}
+}
+
+// mixInto adds a frame of the input to mix, with its gain. The input starts
+// once it buffered the jitter of the mix and stops when it runs dry.
+func (in *input) mixInto(mix []int32) {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+
+	if !in.mixed {
+		if len(in.pcm) < in.mixer.jitter*in.mixer.codec.Channels {
+			return
+		}
+		in.mixed = true
+	}
+
+	n := len(mix)
+	if len(in.pcm) < n {
+		n = len(in.pcm)
+		in.mixed = false
+		in.underruns++
+	}
+
+	if in.gain == 1 {
+		for i, s := range in.pcm[:n] {
+			mix[i] += int32(s)
+		}
+	} else if in.gain > 0 {
+		for i, s := range in.pcm[:n] {
+			mix[i] += int32(float64(s) * in.gain)
+		}
+	}
+
+	in.pcm = append(in.pcm[:0], in.pcm[n:]...)
+}
+
+func (in *input) setGain(gain float64) {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+
+	in.gain = gain
+}
+
+func (in *input) info() InputInfo {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+
+	return InputInfo{
+		Stream:    in.stream,
+		Gain:      in.gain,
+		Codec:     in.codec,
+		Mixed:     in.mixed,
+		Underruns: in.underruns,
+		Dropped:   in.dropped,
+	}
+}
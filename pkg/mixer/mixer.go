@@ -0,0 +1,343 @@
+// Package mixer mixes the audio of streams into one, e.g. the speakers of a
+// room for its recording or a broadcast. Every input is decoded, brought to
+// the rate of the mix and buffered, the mix takes a frame of each at its own
+// clock so a late or missing input never holds up the others.
+package mixer
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/clock"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/rtclib"
+	"github.com/pingostack/neon/pkg/transcoder"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultJitter   = 60 * time.Millisecond
+	defaultMaxDelay = 300 * time.Millisecond
+	// MaxGain is +12 dB.
+	MaxGain = 4.0
+)
+
+type Options struct {
+	// Codec of the mix, pcmu and pcma always encode, opus when built with
+	// libopus.
+	Codec deliver.CodecType
+	// Jitter is the audio an input buffers before it is heard,
+	// defaultJitter when 0.
+	Jitter time.Duration
+	// MaxDelay bounds the audio buffered of an input, the oldest is dropped
+	// beyond, defaultMaxDelay when 0.
+	MaxDelay time.Duration
+	// Clock times the mix, clock.Default() when nil.
+	Clock clock.Clock
+}
+
+type Info struct {
+	ID        string      `json:"id"`
+	Codec     string      `json:"codec"`
+	Inputs    []InputInfo `json:"inputs"`
+	StartedAt time.Time   `json:"startedAt"`
+}
+
+// Mixer is a frame source of the mix of its inputs, silence while none is
+// heard.
+type Mixer struct {
+	deliver.FrameSource
+	id         string
+	logger     *logrus.Entry
+	encoder    transcoder.AudioEncoder
+	codec      transcoder.AudioCodec
+	packetizer *rtclib.Packetizer
+	out        deliver.CodecType
+	// in samples per channel
+	jitter    int
+	maxDelay  int
+	startedAt time.Time
+	clock     clock.Clock
+
+	lock   sync.Mutex
+	inputs map[string]*input
+}
+
+var (
+	mixers = make(map[string]*Mixer)
+	lock   sync.RWMutex
+)
+
+// New starts the mix id until ctx is done, it is found with Get meanwhile.
+func New(ctx context.Context, id string, opts Options, logger *logrus.Entry) (*Mixer, error) {
+	if opts.Jitter <= 0 {
+		opts.Jitter = defaultJitter
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = defaultMaxDelay
+	}
+	// an input is dropped to right away otherwise
+	if opts.MaxDelay < 2*opts.Jitter {
+		opts.MaxDelay = 2 * opts.Jitter
+	}
+	opts.Clock = clock.Or(opts.Clock)
+
+	encoder, codec, err := transcoder.NewAudioEncoder(opts.Codec)
+	if err != nil {
+		return nil, err
+	}
+
+	packetizer, err := rtclib.NewPacketizer(opts.Codec, codec.PayloadType, codec.SampleRate)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Mixer{
+		id:         id,
+		logger:     logger.WithField("mix", id),
+		encoder:    encoder,
+		codec:      codec,
+		packetizer: packetizer,
+		out:        opts.Codec,
+		jitter:     int(opts.Jitter * time.Duration(codec.SampleRate) / time.Second),
+		maxDelay:   int(opts.MaxDelay * time.Duration(codec.SampleRate) / time.Second),
+		startedAt:  opts.Clock.Now(),
+		clock:      opts.Clock,
+		inputs:     make(map[string]*input),
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if _, ok := mixers[id]; ok {
+		return nil, ErrMixerExists
+	}
+
+	m.FrameSource = deliver.NewFrameSourceImpl(ctx, deliver.Metadata{
+		PacketType: deliver.PacketTypeRtp,
+		Audio: &deliver.AudioMetadata{
+			Codec:          opts.Codec.String(),
+			CodecType:      opts.Codec,
+			SampleRate:     codec.SampleRate,
+			Channels:       uint8(codec.Channels),
+			RtpPayloadType: codec.PayloadType,
+		},
+	})
+	mixers[id] = m
+
+	go func() {
+		<-m.Context().Done()
+
+		lock.Lock()
+		delete(mixers, id)
+		lock.Unlock()
+	}()
+
+	go m.run()
+
+	return m, nil
+}
+
+// Get returns the running mix id.
+func Get(id string) (*Mixer, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	m, ok := mixers[id]
+	return m, ok
+}
+
+// List returns the running mixes by id.
+func List() []*Mixer {
+	lock.RLock()
+	list := make([]*Mixer, 0, len(mixers))
+	for _, m := range mixers {
+		list = append(list, m)
+	}
+	lock.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].id < list[j].id
+	})
+
+	return list
+}
+
+func (m *Mixer) ID() string {
+	return m.id
+}
+
+// AddInput mixes stream with gain, the returned destination is subscribed
+// to it. The input leaves the mix when the destination is closed.
+func (m *Mixer) AddInput(stream string, gain float64) (deliver.FrameDestination, error) {
+	if gain < 0 || gain > MaxGain {
+		return nil, ErrInvalidGain
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.inputs[stream]; ok {
+		return nil, ErrInputExists
+	}
+
+	in := newInput(m, stream, gain)
+	m.inputs[stream] = in
+
+	go func() {
+		<-in.Context().Done()
+
+		m.lock.Lock()
+		if m.inputs[stream] == in {
+			delete(m.inputs, stream)
+		}
+		m.lock.Unlock()
+	}()
+
+	m.logger.WithField("input", stream).WithField("gain", gain).Info("mix input added")
+
+	return in, nil
+}
+
+func (m *Mixer) RemoveInput(stream string) {
+	m.lock.Lock()
+	in, ok := m.inputs[stream]
+	delete(m.inputs, stream)
+	m.lock.Unlock()
+
+	if ok {
+		in.Close()
+		m.logger.WithField("input", stream).Info("mix input removed")
+	}
+}
+
+func (m *Mixer) HasInput(stream string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	_, ok := m.inputs[stream]
+	return ok
+}
+
+// Inputs returns the streams mixed.
+func (m *Mixer) Inputs() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	streams := make([]string, 0, len(m.inputs))
+	for stream := range m.inputs {
+		streams = append(streams, stream)
+	}
+	sort.Strings(streams)
+
+	return streams
+}
+
+// SetGain sets the linear gain of an input, 0 mutes it and 1 leaves it as
+// is, up to MaxGain.
+func (m *Mixer) SetGain(stream string, gain float64) error {
+	if gain < 0 || gain > MaxGain {
+		return ErrInvalidGain
+	}
+
+	m.lock.Lock()
+	in, ok := m.inputs[stream]
+	m.lock.Unlock()
+
+	if !ok {
+		return ErrInputNotFound
+	}
+
+	in.setGain(gain)
+
+	return nil
+}
+
+func (m *Mixer) Info() Info {
+	m.lock.Lock()
+	inputs := make([]*input, 0, len(m.inputs))
+	for _, in := range m.inputs {
+		inputs = append(inputs, in)
+	}
+	m.lock.Unlock()
+
+	info := Info{
+		ID:        m.id,
+		Codec:     m.out.String(),
+		Inputs:    make([]InputInfo, 0, len(inputs)),
+		StartedAt: m.startedAt,
+	}
+	for _, in := range inputs {
+		info.Inputs = append(info.Inputs, in.info())
+	}
+	sort.Slice(info.Inputs, func(i, j int) bool {
+		return info.Inputs[i].Stream < info.Inputs[j].Stream
+	})
+
+	return info
+}
+
+// run mixes a frame of the encoder at its time, frames late are mixed right
+// away so the mix keeps its rate.
+func (m *Mixer) run() {
+	size := m.encoder.FrameSize()
+	period := time.Duration(size) * time.Second / time.Duration(m.codec.SampleRate)
+	mix := make([]int32, size*m.codec.Channels)
+	pcm := make([]int16, len(mix))
+
+	start := m.clock.Now()
+	timer := m.clock.NewTimer(0)
+	defer timer.Stop()
+
+	for n := 0; ; n++ {
+		select {
+		case <-m.Context().Done():
+			return
+		case <-timer.C:
+		}
+
+		m.mixFrame(mix, pcm)
+
+		payload, err := m.encoder.Encode(pcm)
+		if err != nil {
+			m.logger.WithError(err).Warn("mix not encoded")
+		} else {
+			for _, f := range m.packetizer.Packetize(deliver.Frame{
+				Codec:      m.out,
+				PacketType: deliver.PacketTypeRaw,
+				Payload:    payload,
+				Length:     len(payload),
+				TimeStamp:  uint32(n * size),
+			}) {
+				m.FrameSource.DeliverFrame(f, nil)
+			}
+		}
+
+		timer.Reset(m.clock.Until(start.Add(time.Duration(n+1) * period)))
+	}
+}
+
+func (m *Mixer) mixFrame(mix []int32, pcm []int16) {
+	for i := range mix {
+		mix[i] = 0
+	}
+
+	m.lock.Lock()
+	for _, in := range m.inputs {
+		in.mixInto(mix)
+	}
+	m.lock.Unlock()
+
+	for i, s := range mix {
+		switch {
+		case s > 32767:
+			pcm[i] = 32767
+		case s < -32768:
+			pcm[i] = -32768
+		default:
+			pcm[i] = int16(s)
+		}
+	}
+}
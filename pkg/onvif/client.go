@@ -0,0 +1,197 @@
+package onvif
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Client talks to the device and media services of one camera.
+type Client struct {
+	xaddr    string
+	username string
+	password string
+	client   *http.Client
+
+	lock       sync.Mutex
+	offset     time.Duration
+	mediaXAddr string
+}
+
+// Profile is a media profile, one stream of the camera.
+type Profile struct {
+	Token    string
+	Name     string
+	Encoding string
+	Width    int
+	Height   int
+}
+
+func NewClient(xaddr, username, password string, timeout time.Duration) *Client {
+	return &Client{
+		xaddr:    xaddr,
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+func (c *Client) clockOffset() time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.offset
+}
+
+// SyncTime reads the clock of the device, tokens are rejected when their
+// creation time is too far off it.
+func (c *Client) SyncTime(ctx context.Context) error {
+	var resp struct {
+		Date struct {
+			Year  int `xml:"Year"`
+			Month int `xml:"Month"`
+			Day   int `xml:"Day"`
+		} `xml:"Body>GetSystemDateAndTimeResponse>SystemDateAndTime>UTCDateTime>Date"`
+		Time struct {
+			Hour   int `xml:"Hour"`
+			Minute int `xml:"Minute"`
+			Second int `xml:"Second"`
+		} `xml:"Body>GetSystemDateAndTimeResponse>SystemDateAndTime>UTCDateTime>Time"`
+	}
+
+	if err := c.call(ctx, c.xaddr, `<tds:GetSystemDateAndTime/>`, false, &resp); err != nil {
+		return err
+	}
+
+	if resp.Date.Year == 0 {
+		return nil
+	}
+
+	device := time.Date(resp.Date.Year, time.Month(resp.Date.Month), resp.Date.Day,
+		resp.Time.Hour, resp.Time.Minute, resp.Time.Second, 0, time.UTC)
+
+	c.lock.Lock()
+	c.offset = device.Sub(time.Now())
+	c.lock.Unlock()
+
+	return nil
+}
+
+func (c *Client) media(ctx context.Context) (string, error) {
+	c.lock.Lock()
+	xaddr := c.mediaXAddr
+	c.lock.Unlock()
+
+	if xaddr != "" {
+		return xaddr, nil
+	}
+
+	var resp struct {
+		XAddr string `xml:"Body>GetCapabilitiesResponse>Capabilities>Media>XAddr"`
+	}
+
+	body := `<tds:GetCapabilities><tds:Category>Media</tds:Category></tds:GetCapabilities>`
+	if err := c.call(ctx, c.xaddr, body, true, &resp); err != nil {
+		return "", err
+	}
+
+	if resp.XAddr == "" {
+		return "", ErrNoMediaService
+	}
+
+	c.lock.Lock()
+	c.mediaXAddr = resp.XAddr
+	c.lock.Unlock()
+
+	return resp.XAddr, nil
+}
+
+// Profiles lists the media profiles of the camera.
+func (c *Client) Profiles(ctx context.Context) ([]Profile, error) {
+	xaddr, err := c.media(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Profiles []struct {
+			Token string `xml:"token,attr"`
+			Name  string `xml:"Name"`
+			Video struct {
+				Encoding string `xml:"Encoding"`
+				Width    int    `xml:"Resolution>Width"`
+				Height   int    `xml:"Resolution>Height"`
+			} `xml:"VideoEncoderConfiguration"`
+		} `xml:"Body>GetProfilesResponse>Profiles"`
+	}
+
+	if err := c.call(ctx, xaddr, `<trt:GetProfiles/>`, true, &resp); err != nil {
+		return nil, err
+	}
+
+	profiles := make([]Profile, 0, len(resp.Profiles))
+	for _, p := range resp.Profiles {
+		profiles = append(profiles, Profile{
+			Token:    p.Token,
+			Name:     p.Name,
+			Encoding: p.Video.Encoding,
+			Width:    p.Video.Width,
+			Height:   p.Video.Height,
+		})
+	}
+
+	return profiles, nil
+}
+
+// StreamURI is the rtsp url of a profile, the credentials of the client are
+// added unless the device put some in.
+func (c *Client) StreamURI(ctx context.Context, token string) (string, error) {
+	xaddr, err := c.media(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		URI string `xml:"Body>GetStreamUriResponse>MediaUri>Uri"`
+	}
+
+	body := fmt.Sprintf(`<trt:GetStreamUri><trt:StreamSetup><tt:Stream>RTP-Unicast</tt:Stream>`+
+		`<tt:Transport><tt:Protocol>RTSP</tt:Protocol></tt:Transport></trt:StreamSetup>`+
+		`<trt:ProfileToken>%s</trt:ProfileToken></trt:GetStreamUri>`, escape(token))
+	if err := c.call(ctx, xaddr, body, true, &resp); err != nil {
+		return "", err
+	}
+
+	if resp.URI == "" {
+		return "", ErrNoStreamURI
+	}
+
+	u, err := url.Parse(resp.URI)
+	if err != nil {
+		return "", err
+	}
+
+	if u.User == nil && c.username != "" {
+		u.User = url.UserPassword(c.username, c.password)
+	}
+
+	return u.String(), nil
+}
+
+// Host is the host of a device service url.
+func Host(xaddr string) string {
+	u, err := url.Parse(xaddr)
+	if err != nil {
+		return ""
+	}
+
+	if host, _, err := net.SplitHostPort(u.Host); err == nil {
+		return host
+	}
+
+	return u.Host
+}
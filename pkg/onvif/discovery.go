@@ -0,0 +1,180 @@
+package onvif
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	discoveryAddr = "239.255.255.250:3702"
+	scopeName     = "onvif://www.onvif.org/name/"
+)
+
+const probeTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:dn="http://www.onvif.org/ver10/network/wsdl">
+<s:Header>
+<a:MessageID>uuid:%s</a:MessageID>
+<a:To s:mustUnderstand="true">urn:schemas-xmlsoap-org:ws:2005:04:discovery</a:To>
+<a:Action s:mustUnderstand="true">http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</a:Action>
+</s:Header>
+<s:Body><d:Probe><d:Types>dn:NetworkVideoTransmitter</d:Types></d:Probe></s:Body>
+</s:Envelope>`
+
+// Device is a camera answering a WS-Discovery probe.
+type Device struct {
+	// Address is the endpoint reference, stable across restarts of the device.
+	Address string
+	XAddrs  []string
+	// Name is the name scope of the device, if it has one.
+	Name string
+}
+
+// XAddr is the device service url to talk to, ipv4 urls are preferred.
+func (d Device) XAddr() string {
+	for _, xaddr := range d.XAddrs {
+		if host := Host(xaddr); net.ParseIP(host).To4() != nil {
+			return xaddr
+		}
+	}
+
+	if len(d.XAddrs) > 0 {
+		return d.XAddrs[0]
+	}
+
+	return ""
+}
+
+type probeMatches struct {
+	Matches []struct {
+		Address string `xml:"EndpointReference>Address"`
+		Scopes  string `xml:"Scopes"`
+		XAddrs  string `xml:"XAddrs"`
+	} `xml:"Body>ProbeMatches>ProbeMatch"`
+}
+
+// Discover multicasts a probe for network video transmitters and collects
+// the answers until ctx is done or timeout passed. iface picks the
+// interface the probe leaves from, the default route when empty.
+func Discover(ctx context.Context, iface string, timeout time.Duration) ([]Device, error) {
+	var laddr *net.UDPAddr
+	if iface != "" {
+		ip, err := interfaceIP(iface)
+		if err != nil {
+			return nil, err
+		}
+		laddr = &net.UDPAddr{IP: ip}
+	}
+
+	conn, err := net.ListenUDP("udp4", laddr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	raddr, err := net.ResolveUDPAddr("udp4", discoveryAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.WriteToUDP([]byte(fmt.Sprintf(probeTemplate, newUUID())), raddr); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+
+	seen := make(map[string]bool)
+	devices := make([]Device, 0)
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			// the deadline ends the probe
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return devices, nil
+			}
+			return devices, err
+		}
+
+		var matches probeMatches
+		if err := xml.Unmarshal(buf[:n], &matches); err != nil {
+			continue
+		}
+
+		for _, m := range matches.Matches {
+			d := Device{
+				Address: strings.TrimSpace(m.Address),
+				XAddrs:  strings.Fields(m.XAddrs),
+				Name:    scopeValue(m.Scopes, scopeName),
+			}
+
+			key := d.Address
+			if key == "" {
+				key = d.XAddr()
+			}
+
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			devices = append(devices, d)
+		}
+	}
+}
+
+func scopeValue(scopes, prefix string) string {
+	for _, scope := range strings.Fields(scopes) {
+		if strings.HasPrefix(scope, prefix) {
+			return strings.ReplaceAll(strings.TrimPrefix(scope, prefix), "%20", " ")
+		}
+	}
+
+	return ""
+}
+
+func interfaceIP(name string) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+			return ipnet.IP, nil
+		}
+	}
+
+	return nil, fmt.Errorf("interface %s has no ipv4 address", name)
+}
+
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,8 @@
+package onvif
+
+import "errors"
+
+var (
+	ErrNoMediaService = errors.New("device has no media service")
+	ErrNoStreamURI    = errors.New("profile has no stream uri")
+)
@@ -0,0 +1,118 @@
+package onvif
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	nsDevice = "http://www.onvif.org/ver10/device/wsdl"
+	nsMedia  = "http://www.onvif.org/ver10/media/wsdl"
+	nsSchema = "http://www.onvif.org/ver10/schema"
+)
+
+const envelopeTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:tds="` + nsDevice + `" xmlns:trt="` + nsMedia + `" xmlns:tt="` + nsSchema + `">
+<s:Header>%s</s:Header>
+<s:Body>%s</s:Body>
+</s:Envelope>`
+
+// usernameToken is the WS-Security header with a password digest,
+// base64(sha1(nonce + created + password)).
+const usernameTokenTemplate = `<Security s:mustUnderstand="1" xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">
+<UsernameToken>
+<Username>%s</Username>
+<Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest">%s</Password>
+<Nonce EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary">%s</Nonce>
+<Created xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">%s</Created>
+</UsernameToken>
+</Security>`
+
+// FaultError is a soap fault returned by the device.
+type FaultError struct {
+	Code   string
+	Reason string
+}
+
+func (e *FaultError) Error() string {
+	return fmt.Sprintf("onvif fault %s: %s", e.Code, e.Reason)
+}
+
+type fault struct {
+	Fault *struct {
+		Code    string `xml:"Code>Value"`
+		Subcode string `xml:"Code>Subcode>Value"`
+		Reason  string `xml:"Reason>Text"`
+	} `xml:"Body>Fault"`
+}
+
+func escape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+func usernameToken(username, password string, now time.Time) string {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	created := now.UTC().Format("2006-01-02T15:04:05.000Z")
+
+	h := sha1.New()
+	h.Write(nonce)
+	h.Write([]byte(created))
+	h.Write([]byte(password))
+
+	return fmt.Sprintf(usernameTokenTemplate, escape(username),
+		base64.StdEncoding.EncodeToString(h.Sum(nil)),
+		base64.StdEncoding.EncodeToString(nonce), created)
+}
+
+// call posts body to the service at xaddr and decodes the response envelope
+// into out, a header authenticates the request unless username is empty.
+func (c *Client) call(ctx context.Context, xaddr, body string, authenticate bool, out interface{}) error {
+	header := ""
+	if authenticate && c.username != "" {
+		header = usernameToken(c.username, c.password, time.Now().Add(c.clockOffset()))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, xaddr,
+		bytes.NewReader([]byte(fmt.Sprintf(envelopeTemplate, header, body))))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/soap+xml; charset=utf-8")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return err
+	}
+
+	var f fault
+	if xml.Unmarshal(data, &f) == nil && f.Fault != nil {
+		code := f.Fault.Subcode
+		if code == "" {
+			code = f.Fault.Code
+		}
+		return &FaultError{Code: code, Reason: f.Fault.Reason}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("onvif %s: %s", xaddr, resp.Status)
+	}
+
+	return xml.Unmarshal(data, out)
+}
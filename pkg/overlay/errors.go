@@ -0,0 +1,9 @@
+package overlay
+
+import "errors"
+
+var (
+	ErrNothingToDraw   = errors.New("overlay without image or text")
+	ErrInvalidPosition = errors.New("invalid overlay position")
+	ErrFFmpegExited    = errors.New("ffmpeg exited")
+)
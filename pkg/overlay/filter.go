@@ -0,0 +1,93 @@
+package overlay
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Position is the corner of the picture an image or text is drawn in.
+type Position string
+
+const (
+	TopLeft     Position = "top-left"
+	TopRight    Position = "top-right"
+	BottomLeft  Position = "bottom-left"
+	BottomRight Position = "bottom-right"
+)
+
+// the distance of what is drawn from the edges of the picture
+const margin = 16
+
+func (p Position) validate() error {
+	switch p {
+	case TopLeft, TopRight, BottomLeft, BottomRight:
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrInvalidPosition, p)
+}
+
+// xy are the expressions placing something of width w and height h on a
+// picture of width W and height H.
+func (p Position) xy(W, H, w, h string) (string, string) {
+	m := strconv.Itoa(margin)
+	x, y := m, m
+	if p == TopRight || p == BottomRight {
+		x = W + "-" + w + "-" + m
+	}
+	if p == BottomLeft || p == BottomRight {
+		y = H + "-" + h + "-" + m
+	}
+
+	return x, y
+}
+
+// filterGraph draws the image, the second input, and the text of textFile
+// over the video of the first.
+func (o *Options) filterGraph(textFile string) string {
+	var b strings.Builder
+	in := "[0:v]"
+
+	if o.Image != "" {
+		x, y := o.ImagePosition.xy("W", "H", "w", "h")
+		fmt.Fprintf(&b, "[1:v]format=rgba[img];%s[img]overlay=x=%s:y=%s:shortest=1", in, x, y)
+		in = "[v1]"
+		if textFile == "" {
+			b.WriteString("[out]")
+			return b.String()
+		}
+		b.WriteString(in + ";")
+	}
+
+	x, y := o.TextPosition.xy("w", "h", "tw", "th")
+	fmt.Fprintf(&b, "%sdrawtext=textfile=%s:expansion=normal:fontsize=%d:fontcolor=white:box=1:boxcolor=black@0.5:boxborderw=6:x=%s:y=%s",
+		in, escape(textFile), o.FontSize, x, y)
+	if o.FontFile != "" {
+		b.WriteString(":fontfile=" + escape(o.FontFile))
+	}
+	b.WriteString("[out]")
+
+	return b.String()
+}
+
+// text is the content of the text file of drawtext, the wall clock time
+// after the text of a timestamp overlay.
+func (o *Options) text() string {
+	// drawtext expands what follows % unless escaped
+	text := strings.NewReplacer(`\`, `\\`, `%`, `\%`).Replace(o.Text)
+	if o.Timestamp {
+		if text != "" {
+			text += " "
+		}
+		text += "%{localtime}"
+	}
+
+	return text
+}
+
+// escape quotes a value of a filter option, a quote ends the quoting for an
+// escaped one.
+func escape(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,525 @@
+// Package overlay draws an image, text or the wall clock time over the video
+// of a stream, for branding or to mark who watched it. The h264 of the
+// stream is decoded and encoded again by an ffmpeg process, which takes it
+// on a pipe and writes it to its output. The audio is passed as it is.
+package overlay
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/codec"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/record"
+	"github.com/pingostack/neon/pkg/rtclib"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultCommand  = "ffmpeg"
+	defaultFontSize = 24
+	defaultBitrate  = 2000
+	defaultClock    = 90000
+
+	// access units queued for ffmpeg, beyond the video drops to its next
+	// keyframe
+	inputQueue = 64
+	// timestamps and sei kept for the access units ffmpeg has not written yet
+	maxPending = 256
+	// ffmpeg is started again this long after it failed
+	retryInterval = 2 * time.Second
+	// the end of the errors of ffmpeg kept for the log
+	stderrTail = 2048
+)
+
+// Options of an overlay, an image, a text or both.
+type Options struct {
+	// Command is the ffmpeg binary, found in PATH when not absolute.
+	Command string
+	// Image is drawn in ImagePosition, a png with alpha e.g.
+	Image         string
+	ImagePosition Position
+	// Text is drawn in TextPosition, followed by the wall clock time when
+	// Timestamp.
+	Text         string
+	Timestamp    bool
+	TextPosition Position
+	FontFile     string
+	FontSize     int
+	// Bitrate of the video in kbps.
+	Bitrate int
+	// EncoderArgs replace the default libx264 arguments, they must encode
+	// h264 without B-frames.
+	EncoderArgs []string
+}
+
+func (o *Options) defaults() error {
+	if o.Image == "" && o.Text == "" && !o.Timestamp {
+		return ErrNothingToDraw
+	}
+
+	if o.Command == "" {
+		o.Command = defaultCommand
+	}
+	if o.ImagePosition == "" {
+		o.ImagePosition = TopRight
+	}
+	if o.TextPosition == "" {
+		o.TextPosition = BottomLeft
+	}
+	if o.FontSize <= 0 {
+		o.FontSize = defaultFontSize
+	}
+	if o.Bitrate <= 0 {
+		o.Bitrate = defaultBitrate
+	}
+
+	if err := o.ImagePosition.validate(); err != nil {
+		return err
+	}
+
+	return o.TextPosition.validate()
+}
+
+// Overlay is the processor of a stream, a destination of its source and the
+// source of its formats. The h264 frames ffmpeg writes take the timestamps
+// of the frames it was given in order. Other video codecs are passed as they
+// are.
+type Overlay struct {
+	*record.FrameDestination
+	deliver.FrameSource
+	opts   Options
+	logger *logrus.Entry
+	ctx    context.Context
+	cancel context.CancelFunc
+	// started again with the metadata of a new codec
+	restart chan struct{}
+
+	lock         sync.Mutex
+	md           *deliver.Metadata
+	packetizer   *rtclib.Packetizer
+	feed         chan []byte
+	pending      []pendingAU
+	lastTS       uint32
+	waitKeyframe bool
+}
+
+// New draws the overlay of opts on the video of the source it is added to,
+// until ctx is done.
+func New(ctx context.Context, opts Options, logger *logrus.Entry) (*Overlay, error) {
+	if err := opts.defaults(); err != nil {
+		return nil, err
+	}
+
+	o := &Overlay{
+		opts:    opts,
+		logger:  logger,
+		restart: make(chan struct{}, 1),
+	}
+	o.ctx, o.cancel = context.WithCancel(ctx)
+	o.FrameDestination = record.NewFrameDestination(o.ctx, logger)
+	o.FrameSource = deliver.NewFrameSourceImpl(o.ctx, deliver.Metadata{})
+	o.OnMetadataChange(o.onMetadata)
+	o.OnRawFrame(o.onRawFrame)
+
+	go o.run()
+
+	return o, nil
+}
+
+func (o *Overlay) OnSource(src deliver.FrameSource) error {
+	if err := o.FrameDestination.OnSource(src); err != nil {
+		return err
+	}
+
+	if md := src.Metadata(); md.HasAudio() || md.HasVideo() {
+		o.FrameSource.DeliverMetaData(*md)
+	}
+
+	return nil
+}
+
+func (o *Overlay) OnMetaData(metadata *deliver.Metadata) {
+	o.FrameDestination.OnMetaData(metadata)
+	o.FrameSource.DeliverMetaData(*metadata)
+}
+
+func (o *Overlay) onMetadata(md *deliver.Metadata) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.md, o.packetizer = md, nil
+	if o.drawn() && md.PacketType != deliver.PacketTypeRaw {
+		clockRate := md.Video.ClockRate
+		if clockRate == 0 {
+			clockRate = defaultClock
+		}
+
+		var err error
+		if o.packetizer, err = rtclib.NewPacketizer(deliver.CodecTypeH264, md.Video.RtpPayloadType, clockRate); err != nil {
+			o.logger.WithError(err).Error("overlay not drawn")
+		}
+	}
+
+	if md.HasVideo() && md.Video.CodecType != deliver.CodecTypeH264 {
+		o.logger.WithField("codec", md.Video.CodecType.String()).Warn("overlay not drawn, only on h264")
+	}
+
+	select {
+	case o.restart <- struct{}{}:
+	default:
+	}
+}
+
+// drawn tells whether the video is given to ffmpeg, must be called with
+// o.lock held.
+func (o *Overlay) drawn() bool {
+	return o.md != nil && o.md.HasVideo() && o.md.Video.CodecType == deliver.CodecTypeH264
+}
+
+// OnFrame passes the audio, and video the overlay is not drawn on, without
+// assembling it.
+func (o *Overlay) OnFrame(frame deliver.Frame, attr deliver.Attributes) {
+	o.lock.Lock()
+	drawn := o.drawn()
+	o.lock.Unlock()
+
+	if !frame.Codec.IsVideo() || !drawn {
+		o.FrameSource.DeliverFrame(frame, attr)
+		return
+	}
+
+	o.FrameDestination.OnFrame(frame, attr)
+}
+
+func (o *Overlay) onRawFrame(frame deliver.Frame) {
+	if frame.Codec != deliver.CodecTypeH264 {
+		return
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.feed == nil {
+		return
+	}
+
+	keyframe := false
+	if info, ok := frame.AdditionalInfo.(*deliver.VideoFrameSpecificInfo); ok {
+		keyframe = info.IsKeyFrame
+	}
+	if o.waitKeyframe && !keyframe {
+		return
+	}
+	o.waitKeyframe = false
+
+	select {
+	case o.feed <- append([]byte(nil), frame.Payload...):
+		if len(o.pending) < maxPending {
+			o.pending = append(o.pending, pendingAU{ts: frame.TimeStamp, sei: seiOf(frame.Payload)})
+		}
+	default:
+		o.waitKeyframe = true
+		o.RequestKeyframe()
+	}
+}
+
+// OnFeedback passes the keyframe requests of the destinations to the
+// publisher. The keyframes of ffmpeg follow those of the publisher, see
+// args.
+func (o *Overlay) OnFeedback(fb deliver.FeedbackMsg) {
+	o.FrameDestination.DeliverFeedback(fb)
+}
+
+// run keeps an ffmpeg drawing the overlay while the video is h264.
+func (o *Overlay) run() {
+	for o.ctx.Err() == nil {
+		o.lock.Lock()
+		drawn := o.drawn()
+		o.lock.Unlock()
+
+		if !drawn {
+			select {
+			case <-o.ctx.Done():
+				return
+			case <-o.restart:
+			}
+			continue
+		}
+
+		err := o.draw()
+		if o.ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			continue
+		}
+
+		o.logger.WithError(err).Warn("ffmpeg failed, restarting")
+		select {
+		case <-o.ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// draw runs ffmpeg until it fails, nil when it was stopped for new
+// metadata.
+func (o *Overlay) draw() error {
+	ctx, cancel := context.WithCancel(o.ctx)
+	defer cancel()
+
+	textFile := ""
+	if o.opts.Text != "" || o.opts.Timestamp {
+		f, err := os.CreateTemp("", "neon-overlay-*.txt")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+
+		_, err = f.WriteString(o.opts.text())
+		f.Close()
+		if err != nil {
+			return err
+		}
+		textFile = f.Name()
+	}
+
+	cmd := exec.CommandContext(ctx, o.opts.Command, o.args(textFile)...)
+	stderr := &tailBuffer{max: stderrTail}
+	cmd.Stderr = stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	cmd.ExtraFiles = []*os.File{r}
+
+	err = cmd.Start()
+	r.Close()
+	if err != nil {
+		w.Close()
+		return err
+	}
+
+	o.attach(w)
+	defer o.detach()
+
+	o.logger.Info("ffmpeg drawing overlay")
+
+	exited := make(chan error, 1)
+	go func() {
+		o.readOutput(stdout)
+		exited <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-exited:
+		if err == nil {
+			err = ErrFFmpegExited
+		}
+		return errors.Wrap(err, stderr.String())
+	case <-o.restart:
+		cancel()
+		<-exited
+		return nil
+	}
+}
+
+func (o *Overlay) args(textFile string) []string {
+	args := []string{"-hide_banner", "-loglevel", "error", "-nostdin",
+		"-fflags", "nobuffer", "-f", "h264", "-i", "pipe:3"}
+	if o.opts.Image != "" {
+		args = append(args, "-loop", "1", "-i", o.opts.Image)
+	}
+
+	args = append(args,
+		"-filter_complex", o.opts.filterGraph(textFile),
+		// a frame out for every frame in, they take its timestamp
+		"-map", "[out]", "-an", "-fps_mode", "passthrough")
+
+	if len(o.opts.EncoderArgs) > 0 {
+		args = append(args, o.opts.EncoderArgs...)
+	} else {
+		bitrate := strconv.Itoa(o.opts.Bitrate) + "k"
+		// keyframes where the publisher has them, a keyframe requested of
+		// the publisher comes out of ffmpeg too
+		args = append(args,
+			"-c:v", "libx264", "-preset", "veryfast", "-tune", "zerolatency",
+			"-profile:v", "baseline", "-bf", "0", "-force_key_frames", "source",
+			"-b:v", bitrate, "-maxrate", bitrate, "-bufsize", bitrate)
+	}
+
+	// the delimiters cut the output into access units
+	return append(args, "-bsf:v", "h264_metadata=aud=insert", "-f", "h264", "pipe:1")
+}
+
+// attach feeds w, the pipe of a new ffmpeg, from the next keyframe.
+func (o *Overlay) attach(w *os.File) {
+	feed := make(chan []byte, inputQueue)
+
+	o.lock.Lock()
+	o.feed, o.waitKeyframe, o.pending = feed, true, nil
+	o.lock.Unlock()
+
+	o.RequestKeyframe()
+
+	go func() {
+		defer w.Close()
+
+		for au := range feed {
+			if _, err := w.Write(au); err != nil {
+				o.logger.WithError(err).Debug("overlay pipe closed")
+				for range feed {
+				}
+				return
+			}
+		}
+	}()
+}
+
+func (o *Overlay) detach() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.feed != nil {
+		close(o.feed)
+		o.feed = nil
+	}
+}
+
+// readOutput delivers the access units ffmpeg writes, until it exits.
+func (o *Overlay) readOutput(r io.Reader) {
+	var s codec.AUSplitter
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			s.Write(buf[:n], o.deliverAU)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (o *Overlay) deliverAU(au []byte) {
+	o.lock.Lock()
+	ts := o.lastTS
+	if len(o.pending) > 0 {
+		// ffmpeg drops the sei of the publisher, telemetry and the like
+		for _, nalu := range o.pending[0].sei {
+			au = codec.InsertNALU(deliver.CodecTypeH264, au, nalu)
+		}
+		ts = o.pending[0].ts
+		o.pending = o.pending[1:]
+	}
+	o.lastTS = ts
+	packetizer := o.packetizer
+	o.lock.Unlock()
+
+	frame := deliver.Frame{
+		Codec:          deliver.CodecTypeH264,
+		PacketType:     deliver.PacketTypeRaw,
+		Payload:        au,
+		Length:         len(au),
+		TimeStamp:      ts,
+		AdditionalInfo: &deliver.VideoFrameSpecificInfo{IsKeyFrame: codec.IsKeyframe(deliver.CodecTypeH264, au)},
+	}
+
+	if packetizer == nil {
+		o.FrameSource.DeliverFrame(frame, nil)
+		return
+	}
+
+	for _, f := range packetizer.Packetize(frame) {
+		o.FrameSource.DeliverFrame(f, nil)
+	}
+}
+
+// pendingAU is what an access unit fed to ffmpeg gives the one it outputs.
+type pendingAU struct {
+	ts  uint32
+	sei [][]byte
+}
+
+func seiOf(au []byte) [][]byte {
+	var sei [][]byte
+	codec.ForEachAnnexB(au, func(nalu []byte) bool {
+		if codec.IsSEI(deliver.CodecTypeH264, nalu) {
+			sei = append(sei, append([]byte(nil), nalu...))
+		}
+		return true
+	})
+
+	return sei
+}
+
+func (o *Overlay) AddDestination(dest deliver.FrameDestination) error {
+	return deliver.AddDestination(o, dest)
+}
+
+func (o *Overlay) Context() context.Context {
+	return o.ctx
+}
+
+func (o *Overlay) ID() string {
+	return o.FrameSource.ID()
+}
+
+func (o *Overlay) Metadata() *deliver.Metadata {
+	return o.FrameSource.Metadata()
+}
+
+func (o *Overlay) Format() string {
+	return o.FrameDestination.Format()
+}
+
+func (o *Overlay) FormatSettings() deliver.FormatSettings {
+	return o.FrameDestination.FormatSettings()
+}
+
+func (o *Overlay) Close() {
+	o.FrameSource.Close()
+	o.FrameDestination.Close()
+	o.cancel()
+}
+
+// tailBuffer keeps the last max bytes written.
+type tailBuffer struct {
+	lock sync.Mutex
+	max  int
+	buf  bytes.Buffer
+}
+
+func (t *tailBuffer) Write(b []byte) (int, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.buf.Write(b)
+	if over := t.buf.Len() - t.max; over > 0 {
+		t.buf.Next(over)
+	}
+
+	return len(b), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return string(bytes.TrimSpace(t.buf.Bytes()))
+}
@@ -0,0 +1,390 @@
+package pcap
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gogf/gf/util/guid"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultFileSize = 10 << 20
+	defaultFiles    = 5
+	defaultDuration = 5 * time.Minute
+	maxDuration     = time.Hour
+	// stopped dumps are kept this long to be downloaded
+	keepStopped = 24 * time.Hour
+)
+
+var (
+	// the addresses of packets of a connection not known yet
+	unknownLocal  = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}
+	unknownRemote = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 1}
+)
+
+type Options struct {
+	// Dir is where the files are written, a temporary directory when empty.
+	Dir string `json:"-"`
+	// MaxFileSize rotates to a new file, 10MiB when zero.
+	MaxFileSize int64 `json:"maxFileSize"`
+	// MaxFiles is the number of files kept, the oldest is removed beyond, 5
+	// when zero.
+	MaxFiles int `json:"maxFiles"`
+	// DurationSeconds stops the dump, 5 minutes when zero.
+	DurationSeconds int `json:"durationSeconds"`
+}
+
+type File struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// Info is a dump as listed, files oldest first.
+type Info struct {
+	ID        string    `json:"id"`
+	Session   string    `json:"session"`
+	StartedAt time.Time `json:"startedAt"`
+	Until     time.Time `json:"until"`
+	Running   bool      `json:"running"`
+	Packets   uint64    `json:"packets"`
+	Files     []File    `json:"files"`
+}
+
+type Dump struct {
+	id        string
+	session   string
+	opts      Options
+	startedAt time.Time
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	lock    sync.Mutex
+	until   time.Time
+	files   []string
+	index   int
+	file    *os.File
+	w       *Writer
+	err     error
+	packets uint64
+	local   net.Addr
+	remote  net.Addr
+	// bytes of rtsp sent either way, the tcp sequence numbers
+	rtspIn, rtspOut uint32
+}
+
+var (
+	dumps = make(map[string]*Dump)
+	lock  sync.RWMutex
+)
+
+// Start dumps the packets of session that are written to it until the
+// duration of opts passed or Stop.
+func Start(session string, opts Options) (*Dump, error) {
+	if opts.MaxFileSize <= 0 {
+		opts.MaxFileSize = defaultFileSize
+	}
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = defaultFiles
+	}
+	if opts.Dir == "" {
+		opts.Dir = filepath.Join(os.TempDir(), "neon-pcap")
+	}
+
+	duration := time.Duration(opts.DurationSeconds) * time.Second
+	if duration <= 0 {
+		duration = defaultDuration
+	} else if duration > maxDuration {
+		duration = maxDuration
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "failed to create pcap dir")
+	}
+
+	now := time.Now()
+	d := &Dump{
+		id:        guid.S(),
+		session:   session,
+		opts:      opts,
+		startedAt: now,
+		until:     now.Add(duration),
+	}
+
+	if err := d.rotate(); err != nil {
+		return nil, err
+	}
+
+	d.ctx, d.cancel = context.WithTimeout(context.Background(), duration)
+
+	lock.Lock()
+	for id, old := range dumps {
+		if old.stopped() && now.Sub(old.Info().Until) > keepStopped {
+			old.remove()
+			delete(dumps, id)
+		}
+	}
+	dumps[d.id] = d
+	lock.Unlock()
+
+	go func() {
+		<-d.ctx.Done()
+
+		d.lock.Lock()
+		defer d.lock.Unlock()
+
+		if now := time.Now(); now.Before(d.until) {
+			d.until = now
+		}
+		if d.file != nil {
+			d.file.Close()
+			d.file, d.w = nil, nil
+		}
+	}()
+
+	return d, nil
+}
+
+func Get(id string) (*Dump, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	d, ok := dumps[id]
+	return d, ok
+}
+
+// List returns the dumps, the latest first.
+func List() []*Dump {
+	lock.RLock()
+	list := make([]*Dump, 0, len(dumps))
+	for _, d := range dumps {
+		list = append(list, d)
+	}
+	lock.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].startedAt.After(list[j].startedAt)
+	})
+
+	return list
+}
+
+// Lookup returns the running dumps of session.
+func Lookup(session string) []*Dump {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	var list []*Dump
+	for _, d := range dumps {
+		if d.session == session && !d.stopped() {
+			list = append(list, d)
+		}
+	}
+
+	return list
+}
+
+// Remove stops a dump and deletes its files.
+func Remove(id string) bool {
+	lock.Lock()
+	d, ok := dumps[id]
+	delete(dumps, id)
+	lock.Unlock()
+
+	if ok {
+		d.Stop()
+		d.remove()
+	}
+
+	return ok
+}
+
+func (d *Dump) ID() string {
+	return d.id
+}
+
+func (d *Dump) Session() string {
+	return d.session
+}
+
+// Done is closed once the dump stopped.
+func (d *Dump) Done() <-chan struct{} {
+	return d.ctx.Done()
+}
+
+func (d *Dump) Stop() {
+	d.cancel()
+}
+
+func (d *Dump) stopped() bool {
+	return d.ctx.Err() != nil
+}
+
+// SetAddrs sets the addresses the packets are written with, nil keeps one.
+func (d *Dump) SetAddrs(local, remote net.Addr) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if local != nil {
+		d.local = local
+	}
+	if remote != nil {
+		d.remote = remote
+	}
+}
+
+// WritePacket writes an rtp or rtcp packet of the connection.
+func (d *Dump) WritePacket(inbound bool, packet []byte) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	local, remote := udpAddr(d.local, unknownLocal), udpAddr(d.remote, unknownRemote)
+	if inbound {
+		local, remote = remote, local
+	}
+
+	d.write(func(w *Writer) error {
+		return w.WriteUDP(time.Now(), local, remote, packet)
+	})
+}
+
+// WriteRTSP writes an rtsp message sent or received on the connection.
+func (d *Dump) WriteRTSP(inbound bool, message []byte) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	local, remote := tcpAddr(d.local, unknownLocal), tcpAddr(d.remote, unknownRemote)
+	seq, ack := &d.rtspOut, d.rtspIn
+	if inbound {
+		local, remote = remote, local
+		seq, ack = &d.rtspIn, d.rtspOut
+	}
+
+	d.write(func(w *Writer) error {
+		return w.WriteTCP(time.Now(), local, remote, *seq, ack, message)
+	})
+	*seq += uint32(len(message))
+}
+
+// write is called locked, errors stop the dump.
+func (d *Dump) write(f func(w *Writer) error) {
+	if d.w == nil || d.err != nil {
+		return
+	}
+
+	if err := f(d.w); err != nil {
+		d.err = err
+		d.cancel()
+		return
+	}
+	d.packets++
+
+	if d.w.Size() >= d.opts.MaxFileSize {
+		if err := d.rotate(); err != nil {
+			d.err = err
+			d.cancel()
+		}
+	}
+}
+
+// rotate closes the current file for a new one, removing the oldest ones
+// beyond MaxFiles.
+func (d *Dump) rotate() error {
+	if d.file != nil {
+		d.file.Close()
+		d.file, d.w = nil, nil
+	}
+
+	d.index++
+	name := filepath.Join(d.opts.Dir, fmt.Sprintf("%s-%d.pcap", d.id, d.index))
+	f, err := os.Create(name)
+	if err != nil {
+		return errors.Wrap(err, "failed to create pcap file")
+	}
+
+	w, err := NewWriter(f)
+	if err != nil {
+		f.Close()
+		os.Remove(name)
+		return errors.Wrap(err, "failed to write pcap header")
+	}
+
+	d.file, d.w = f, w
+	d.files = append(d.files, name)
+	for len(d.files) > d.opts.MaxFiles {
+		os.Remove(d.files[0])
+		d.files = d.files[1:]
+	}
+
+	return nil
+}
+
+func (d *Dump) remove() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, name := range d.files {
+		os.Remove(name)
+	}
+	d.files = nil
+}
+
+// Path returns the path of a file of the dump by its name.
+func (d *Dump) Path(name string) (string, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, path := range d.files {
+		if filepath.Base(path) == name {
+			return path, true
+		}
+	}
+
+	return "", false
+}
+
+func (d *Dump) Info() Info {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	info := Info{
+		ID:        d.id,
+		Session:   d.session,
+		StartedAt: d.startedAt,
+		Until:     d.until,
+		Running:   !d.stopped(),
+		Packets:   d.packets,
+		Files:     make([]File, 0, len(d.files)),
+	}
+	for _, path := range d.files {
+		file := File{Name: filepath.Base(path)}
+		if fi, err := os.Stat(path); err == nil {
+			file.Size = fi.Size()
+		}
+		info.Files = append(info.Files, file)
+	}
+
+	return info
+}
+
+func udpAddr(addr net.Addr, unknown *net.UDPAddr) *net.UDPAddr {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a
+	case *net.TCPAddr:
+		return &net.UDPAddr{IP: a.IP, Port: a.Port}
+	}
+
+	return unknown
+}
+
+func tcpAddr(addr net.Addr, unknown *net.UDPAddr) *net.TCPAddr {
+	a := udpAddr(addr, unknown)
+	return &net.TCPAddr{IP: a.IP, Port: a.Port}
+}
@@ -0,0 +1,135 @@
+// Package pcap dumps the packets of a session to pcap files for wireshark.
+// Media is written as the udp datagrams of its connection, rtsp as tcp
+// segments, on made up ip headers since the packets are tapped after
+// decryption.
+package pcap
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	magic        = 0xa1b2c3d4
+	snapLen      = 65535
+	linkTypeRaw  = 101
+	fileHeader   = 24
+	recordHeader = 16
+
+	protoTCP = 6
+	protoUDP = 17
+)
+
+// Writer writes packets in the pcap format, each on an ipv4 or ipv6 header
+// by its addresses.
+type Writer struct {
+	w    io.Writer
+	size int64
+}
+
+func NewWriter(w io.Writer) (*Writer, error) {
+	var h [fileHeader]byte
+	binary.LittleEndian.PutUint32(h[0:], magic)
+	binary.LittleEndian.PutUint16(h[4:], 2)
+	binary.LittleEndian.PutUint16(h[6:], 4)
+	binary.LittleEndian.PutUint32(h[16:], snapLen)
+	binary.LittleEndian.PutUint32(h[20:], linkTypeRaw)
+
+	if _, err := w.Write(h[:]); err != nil {
+		return nil, err
+	}
+
+	return &Writer{w: w, size: fileHeader}, nil
+}
+
+// Size is the number of bytes written, headers included.
+func (w *Writer) Size() int64 {
+	return w.size
+}
+
+func (w *Writer) WriteUDP(t time.Time, src, dst *net.UDPAddr, payload []byte) error {
+	var udp [8]byte
+	binary.BigEndian.PutUint16(udp[0:], uint16(src.Port))
+	binary.BigEndian.PutUint16(udp[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint16(udp[4:], uint16(len(udp)+len(payload)))
+
+	return w.write(t, protoUDP, src.IP, dst.IP, udp[:], payload)
+}
+
+// WriteTCP writes a segment of a stream, seq being the number of bytes the
+// sender wrote before.
+func (w *Writer) WriteTCP(t time.Time, src, dst *net.TCPAddr, seq, ack uint32, payload []byte) error {
+	var tcp [20]byte
+	binary.BigEndian.PutUint16(tcp[0:], uint16(src.Port))
+	binary.BigEndian.PutUint16(tcp[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	binary.BigEndian.PutUint32(tcp[8:], ack)
+	tcp[12] = 5 << 4
+	tcp[13] = 0x18 // psh, ack
+	binary.BigEndian.PutUint16(tcp[14:], 0xffff)
+
+	return w.write(t, protoTCP, src.IP, dst.IP, tcp[:], payload)
+}
+
+func (w *Writer) write(t time.Time, proto byte, src, dst net.IP, transport, payload []byte) error {
+	ip := ipHeader(proto, src, dst, len(transport)+len(payload))
+	length := len(ip) + len(transport) + len(payload)
+	captured := length
+	if captured > snapLen {
+		captured = snapLen
+	}
+
+	var rec [recordHeader]byte
+	binary.LittleEndian.PutUint32(rec[0:], uint32(t.Unix()))
+	binary.LittleEndian.PutUint32(rec[4:], uint32(t.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(rec[8:], uint32(captured))
+	binary.LittleEndian.PutUint32(rec[12:], uint32(length))
+
+	packet := make([]byte, 0, recordHeader+length)
+	packet = append(packet, rec[:]...)
+	packet = append(packet, ip...)
+	packet = append(packet, transport...)
+	packet = append(packet, payload...)
+
+	n, err := w.w.Write(packet[:recordHeader+captured])
+	w.size += int64(n)
+
+	return err
+}
+
+// ipHeader returns an ipv6 header if either address is one, checksums are
+// left out but the one of ipv4.
+func ipHeader(proto byte, src, dst net.IP, length int) []byte {
+	src4, dst4 := src.To4(), dst.To4()
+	if src4 == nil || dst4 == nil {
+		h := make([]byte, 40)
+		h[0] = 6 << 4
+		binary.BigEndian.PutUint16(h[4:], uint16(length))
+		h[6] = proto
+		h[7] = 64
+		copy(h[8:], src.To16())
+		copy(h[24:], dst.To16())
+		return h
+	}
+
+	h := make([]byte, 20)
+	h[0] = 4<<4 | 5
+	binary.BigEndian.PutUint16(h[2:], uint16(len(h)+length))
+	h[8] = 64
+	h[9] = proto
+	copy(h[12:], src4)
+	copy(h[16:], dst4)
+
+	var sum uint32
+	for i := 0; i < len(h); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(h[i:]))
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	binary.BigEndian.PutUint16(h[10:], ^uint16(sum))
+
+	return h
+}
@@ -0,0 +1,11 @@
+package playout
+
+import "errors"
+
+var (
+	ErrPlayoutExists   = errors.New("playout exists")
+	ErrEmptyPlaylist   = errors.New("empty playlist")
+	ErrInvalidItem     = errors.New("invalid playlist item")
+	ErrNothingPlayable = errors.New("no playlist item playable")
+	ErrCodecMismatch   = errors.New("codecs differ from the channel")
+)
@@ -0,0 +1,194 @@
+package playout
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/record"
+	"github.com/pingostack/neon/pkg/record/av1"
+	"github.com/pingostack/neon/pkg/record/avc"
+	"github.com/pingostack/neon/pkg/record/mkv"
+)
+
+// Item is a recording of the playlist, File relative to the dir of the
+// playout. Start and End cut it, seconds or durations such as 1m30s, see
+// record.ParseStartEnd.
+type Item struct {
+	File  string `json:"file" mapstructure:"file"`
+	Start string `json:"start,omitempty" mapstructure:"start"`
+	End   string `json:"end,omitempty" mapstructure:"end"`
+}
+
+// entry is an item checked, its file found in the dir.
+type entry struct {
+	Item
+	path string
+	span record.Span
+}
+
+func resolve(dir string, items []Item) ([]entry, error) {
+	if len(items) == 0 {
+		return nil, ErrEmptyPlaylist
+	}
+
+	entries := make([]entry, 0, len(items))
+	for _, item := range items {
+		name := filepath.Clean(filepath.FromSlash(item.File))
+		if name == "." || filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidItem, item.File)
+		}
+
+		switch record.Format(strings.TrimPrefix(filepath.Ext(name), ".")) {
+		case record.FormatMKV, record.FormatWebM:
+		default:
+			return nil, fmt.Errorf("%w: %s", record.ErrUnsupportedFormat, item.File)
+		}
+
+		span, err := record.ParseStartEnd(item.Start, item.End)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry{Item: item, path: filepath.Join(dir, name), span: span})
+	}
+
+	return entries, nil
+}
+
+// itemTrack is a track of an item, played on the track of the channel of
+// its kind.
+type itemTrack struct {
+	codec    deliver.CodecType
+	sps, pps []byte
+	// the av1 sequence header
+	sequence []byte
+}
+
+// itemReader reads the frames of an item from the keyframe at or before its
+// start.
+type itemReader struct {
+	*mkv.Reader
+	f      *os.File
+	md     deliver.Metadata
+	tracks map[int]*itemTrack
+	from   time.Duration
+	// the end, 0 for the end of the file
+	until time.Duration
+}
+
+func (r *itemReader) Close() error {
+	return r.f.Close()
+}
+
+// open reads the tracks of the recording of e, the first video and the
+// first audio track are played. md is the metadata of the channel, nil for
+// the first item, the codecs of the item must be the same.
+func (e entry) open(md *deliver.Metadata) (*itemReader, error) {
+	f, err := os.Open(e.path)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := e.read(f, md)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (e entry) read(f *os.File, md *deliver.Metadata) (*itemReader, error) {
+	reader, err := mkv.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &itemReader{
+		Reader: reader,
+		f:      f,
+		md:     deliver.Metadata{PacketType: deliver.PacketTypeRtp},
+		tracks: make(map[int]*itemTrack),
+	}
+	for i, t := range reader.Tracks() {
+		it := &itemTrack{codec: t.Codec}
+		switch {
+		case t.Codec.IsVideo() && r.md.Video == nil:
+			switch t.Codec {
+			case deliver.CodecTypeH264:
+				it.sps, it.pps, err = avc.ParseDecoderConfig(t.CodecPrivate)
+			case deliver.CodecTypeAV1:
+				it.sequence, err = av1.ParseDecoderConfig(t.CodecPrivate)
+			}
+			r.md.Video = &deliver.VideoMetadata{
+				Codec:          t.Codec.String(),
+				CodecType:      t.Codec,
+				Width:          t.Width,
+				Height:         t.Height,
+				RtpPayloadType: videoPayloadType,
+				ClockRate:      videoClockRate,
+			}
+		case t.Codec.IsAudio() && r.md.Audio == nil:
+			channels := t.Channels
+			if channels == 0 {
+				channels = 2
+			}
+			r.md.Audio = &deliver.AudioMetadata{
+				Codec:          t.Codec.String(),
+				CodecType:      t.Codec,
+				SampleRate:     audioClockRate,
+				Channels:       channels,
+				RtpPayloadType: audioPayloadType,
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		r.tracks[i] = it
+	}
+
+	if len(r.tracks) == 0 {
+		return nil, record.ErrNoTracks
+	}
+
+	// the parameter sets of h264 are sent in band, only the codecs have to
+	// be the same
+	if md != nil && (r.md.HasVideo() && (!md.HasVideo() || md.Video.CodecType != r.md.Video.CodecType) ||
+		r.md.HasAudio() && (!md.HasAudio() || md.Audio.CodecType != r.md.Audio.CodecType)) {
+		return nil, ErrCodecMismatch
+	}
+
+	if e.span.Start == 0 && e.span.End == 0 {
+		return r, nil
+	}
+
+	ix, err := record.LoadIndex(e.path)
+	if err != nil {
+		return nil, err
+	}
+
+	pos, err := ix.Resolve(e.span)
+	if err != nil {
+		return nil, err
+	}
+
+	r.from = pos.Start
+	if pos.EndOffset < ix.Size {
+		r.until = pos.End
+	}
+
+	if pos.StartOffset > 0 {
+		if err := reader.SeekCluster(pos.StartOffset); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
@@ -0,0 +1,418 @@
+// Package playout publishes a playlist of recordings as a live stream, one
+// item after the other on a single timeline, for linear channels built from
+// archives. The items are played in real time with the rtp sequence numbers
+// and timestamps of the channel carrying on over the transitions, every item
+// starts at a keyframe.
+package playout
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/clock"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/record/av1"
+	"github.com/pingostack/neon/pkg/record/avc"
+	"github.com/pingostack/neon/pkg/record/mkv"
+	"github.com/pingostack/neon/pkg/rtclib"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	videoPayloadType = 96
+	audioPayloadType = 111
+	videoClockRate   = 90000
+	// opus is always clocked at 48khz over rtp
+	audioClockRate = 48000
+	// gap between the last frame of an item and the first one of the next
+	transitionGap = 20 * time.Millisecond
+)
+
+type Options struct {
+	// Dir has the files of the items.
+	Dir string
+	// Loop starts the playlist over after its last item.
+	Loop bool
+	// Clock times the frames, clock.Default() when nil.
+	Clock clock.Clock
+}
+
+type Info struct {
+	ID    string `json:"id"`
+	Items []Item `json:"items"`
+	Loop  bool   `json:"loop"`
+	// Current is the index of the item playing, Position how far it is.
+	Current   int           `json:"current"`
+	Position  time.Duration `json:"position"`
+	Pending   bool          `json:"pending"`
+	Played    uint64        `json:"played"`
+	Failed    uint64        `json:"failed"`
+	StartedAt time.Time     `json:"startedAt"`
+}
+
+// track is a track of the channel, the items of its kind are played on it.
+type track struct {
+	clockRate  uint32
+	packetizer *rtclib.Packetizer
+}
+
+// Playout is a frame source playing a playlist, the codecs of the channel
+// are those of its first playable item. Items with other codecs are skipped.
+type Playout struct {
+	deliver.FrameSource
+	id        string
+	opts      Options
+	logger    *logrus.Entry
+	md        deliver.Metadata
+	video     *track
+	audio     *track
+	skip      chan struct{}
+	startedAt time.Time
+	// the wall clock the channel played the timeline position at
+	anchorWall  time.Time
+	anchorMedia time.Duration
+
+	lock     sync.Mutex
+	entries  []entry
+	pending  []entry
+	current  int
+	position time.Duration
+	played   uint64
+	failed   uint64
+}
+
+var (
+	playouts = make(map[string]*Playout)
+	lock     sync.RWMutex
+)
+
+// New checks the playlist, Run plays it. The playout is found with Get until
+// ctx is done.
+func New(ctx context.Context, id string, items []Item, opts Options, logger *logrus.Entry) (*Playout, error) {
+	entries, err := resolve(opts.Dir, items)
+	if err != nil {
+		return nil, err
+	}
+	opts.Clock = clock.Or(opts.Clock)
+
+	p := &Playout{
+		id:        id,
+		opts:      opts,
+		logger:    logger.WithField("playout", id),
+		skip:      make(chan struct{}, 1),
+		startedAt: opts.Clock.Now(),
+		entries:   entries,
+		current:   -1,
+	}
+
+	found := false
+	for _, e := range entries {
+		r, err := e.open(nil)
+		if err != nil {
+			p.logger.WithError(err).WithField("file", e.File).Warn("playlist item not playable")
+			continue
+		}
+		p.md = r.md
+		r.Close()
+		found = true
+		break
+	}
+	if !found {
+		return nil, ErrNothingPlayable
+	}
+
+	if p.md.HasVideo() {
+		if p.video, err = newTrack(p.md.Video.CodecType, videoPayloadType, videoClockRate); err != nil {
+			return nil, err
+		}
+	}
+	if p.md.HasAudio() {
+		if p.audio, err = newTrack(p.md.Audio.CodecType, audioPayloadType, audioClockRate); err != nil {
+			return nil, err
+		}
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if _, ok := playouts[id]; ok {
+		return nil, ErrPlayoutExists
+	}
+
+	p.FrameSource = deliver.NewFrameSourceImpl(ctx, p.md)
+	playouts[id] = p
+
+	go func() {
+		<-p.Context().Done()
+
+		lock.Lock()
+		delete(playouts, id)
+		lock.Unlock()
+	}()
+
+	return p, nil
+}
+
+func newTrack(codec deliver.CodecType, payloadType uint8, clockRate uint32) (*track, error) {
+	packetizer, err := rtclib.NewPacketizer(codec, payloadType, clockRate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &track{clockRate: clockRate, packetizer: packetizer}, nil
+}
+
+// Get returns the playout id.
+func Get(id string) (*Playout, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	p, ok := playouts[id]
+	return p, ok
+}
+
+// List returns the playouts by id.
+func List() []*Playout {
+	lock.RLock()
+	list := make([]*Playout, 0, len(playouts))
+	for _, p := range playouts {
+		list = append(list, p)
+	}
+	lock.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].id < list[j].id
+	})
+
+	return list
+}
+
+func (p *Playout) ID() string {
+	return p.id
+}
+
+// SetPlaylist replaces the playlist, it starts with its first item once the
+// item playing ended.
+func (p *Playout) SetPlaylist(items []Item) error {
+	entries, err := resolve(p.opts.Dir, items)
+	if err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	p.pending = entries
+	p.lock.Unlock()
+
+	p.logger.WithField("items", len(entries)).Info("playlist replaced")
+
+	return nil
+}
+
+// Skip ends the item playing, the next starts right away.
+func (p *Playout) Skip() {
+	select {
+	case p.skip <- struct{}{}:
+	default:
+	}
+}
+
+func (p *Playout) Info() Info {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	info := Info{
+		ID:        p.id,
+		Items:     make([]Item, 0, len(p.entries)),
+		Loop:      p.opts.Loop,
+		Current:   p.current,
+		Position:  p.position,
+		Pending:   p.pending != nil,
+		Played:    p.played,
+		Failed:    p.failed,
+		StartedAt: p.startedAt,
+	}
+	for _, e := range p.entries {
+		info.Items = append(info.Items, e.Item)
+	}
+
+	return info
+}
+
+// next moves to the item to play, false at the end of a playlist not
+// looped.
+func (p *Playout) next() (entry, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.position = 0
+	if p.pending != nil {
+		p.entries, p.pending, p.current = p.pending, nil, 0
+		return p.entries[0], true
+	}
+
+	p.current++
+	if p.current >= len(p.entries) {
+		if !p.opts.Loop {
+			return entry{}, false
+		}
+		p.current = 0
+	}
+
+	return p.entries[p.current], true
+}
+
+// Run plays the playlist until its end, forever when looped, and until ctx
+// is done. It fails when none of the items could be played for a whole pass.
+func (p *Playout) Run() error {
+	// a skip before the start is not for the first item
+	select {
+	case <-p.skip:
+	default:
+	}
+
+	var offset time.Duration
+	failures := 0
+	for {
+		e, ok := p.next()
+		if !ok {
+			p.logger.Info("playlist ended")
+			return nil
+		}
+
+		logger := p.logger.WithField("file", e.File)
+		logger.Info("playlist item started")
+
+		last, err := p.play(e, offset)
+		if p.Context().Err() != nil {
+			return p.Context().Err()
+		}
+
+		p.lock.Lock()
+		if err != nil {
+			p.failed++
+		} else {
+			p.played++
+		}
+		count := len(p.entries)
+		p.lock.Unlock()
+
+		if err != nil {
+			logger.WithError(err).Warn("playlist item failed")
+		}
+
+		if last == 0 {
+			if failures++; failures >= count {
+				return ErrNothingPlayable
+			}
+			continue
+		}
+		failures = 0
+
+		offset += last + transitionGap
+	}
+}
+
+// play delivers the frames of e offset on the timeline, and returns the
+// timestamp of the last frame relative to its start.
+func (p *Playout) play(e entry, offset time.Duration) (time.Duration, error) {
+	r, err := e.open(&p.md)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	timer := p.opts.Clock.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	var last time.Duration
+	for {
+		frame, err := r.ReadFrame()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return last, nil
+		} else if err != nil {
+			return last, err
+		}
+
+		it := r.tracks[frame.Track]
+		if it == nil || frame.Timestamp < r.from {
+			continue
+		}
+
+		if r.until > 0 && frame.Timestamp >= r.until {
+			return last, nil
+		}
+
+		rel := frame.Timestamp - r.from
+		if rel > last {
+			last = rel
+		}
+
+		at := offset + rel
+		if p.anchorWall.IsZero() {
+			p.anchorWall, p.anchorMedia = p.opts.Clock.Now(), at
+		}
+		if wait := p.opts.Clock.Until(p.anchorWall.Add(at - p.anchorMedia)); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-p.Context().Done():
+				return last, p.Context().Err()
+			case <-p.skip:
+				return last, nil
+			case <-timer.C:
+			}
+		} else {
+			select {
+			case <-p.Context().Done():
+				return last, p.Context().Err()
+			case <-p.skip:
+				return last, nil
+			default:
+			}
+		}
+
+		p.deliver(it, at, frame)
+
+		p.lock.Lock()
+		if rel > p.position {
+			p.position = rel
+		}
+		p.lock.Unlock()
+	}
+}
+
+func (p *Playout) deliver(it *itemTrack, at time.Duration, frame mkv.Frame) {
+	t := p.audio
+	if it.codec.IsVideo() {
+		t = p.video
+	}
+
+	data := frame.Data
+	switch it.codec {
+	case deliver.CodecTypeH264:
+		data = avc.ToAnnexB(data, it.sps, it.pps, frame.Keyframe)
+	case deliver.CodecTypeAV1:
+		// matroska keeps the sequence header in the codec private data only
+		if frame.Keyframe && av1.SequenceHeader(data) == nil {
+			data = append(append([]byte{}, it.sequence...), data...)
+		}
+	}
+
+	raw := deliver.Frame{
+		Codec:      it.codec,
+		PacketType: deliver.PacketTypeRaw,
+		Payload:    data,
+		Length:     len(data),
+		TimeStamp:  uint32(int64(at/time.Microsecond) * int64(t.clockRate) / 1_000_000),
+	}
+	if it.codec.IsVideo() {
+		raw.AdditionalInfo = &deliver.VideoFrameSpecificInfo{IsKeyFrame: frame.Keyframe}
+	}
+
+	for _, f := range t.packetizer.Packetize(raw) {
+		p.FrameSource.DeliverFrame(f, nil)
+	}
+}
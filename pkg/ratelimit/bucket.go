@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/clock"
+)
+
+const (
+	defaultBurst = time.Second
+)
+
+// TokenBucket limits throughput in bytes, it is configured in bits per second
+// to match how bitrates are expressed everywhere else.
+type TokenBucket struct {
+	lock   sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+	window time.Duration
+	clock  clock.Clock
+}
+
+func NewTokenBucket(bitrate uint64, burst time.Duration) *TokenBucket {
+	if burst <= 0 {
+		burst = defaultBurst
+	}
+
+	c := clock.Default()
+	b := &TokenBucket{
+		window: burst,
+		last:   c.Now(),
+		clock:  c,
+	}
+	b.setRate(bitrate)
+	b.tokens = b.burst
+
+	return b
+}
+
+func (b *TokenBucket) setRate(bitrate uint64) {
+	b.rate = float64(bitrate) / 8
+	b.burst = b.rate * b.window.Seconds()
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+func (b *TokenBucket) SetBitrate(bitrate uint64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.setRate(bitrate)
+}
+
+func (b *TokenBucket) Bitrate() uint64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return uint64(b.rate * 8)
+}
+
+func (b *TokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+func (b *TokenBucket) Allow(n int) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refill(b.clock.Now())
+	if b.tokens < float64(n) {
+		return false
+	}
+
+	b.tokens -= float64(n)
+
+	return true
+}
+
+// Force consumes n bytes even if that drives the bucket negative, used for
+// traffic that must not be dropped, e.g. audio.
+func (b *TokenBucket) Force(n int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refill(b.clock.Now())
+	b.tokens -= float64(n)
+}
+
+func (b *TokenBucket) refund(n int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.tokens += float64(n)
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// Group applies several buckets at once, e.g. global, stream and session.
+type Group []*TokenBucket
+
+func (g Group) Allow(n int) bool {
+	for i, b := range g {
+		if !b.Allow(n) {
+			for _, taken := range g[:i] {
+				taken.refund(n)
+			}
+			return false
+		}
+	}
+
+	return true
+}
+
+func (g Group) Force(n int) {
+	for _, b := range g {
+		b.Force(n)
+	}
+}
+
+// Bitrate returns the smallest bitrate of the group, 0 means unlimited.
+func (g Group) Bitrate() uint64 {
+	var min uint64
+	for _, b := range g {
+		if br := b.Bitrate(); min == 0 || br < min {
+			min = br
+		}
+	}
+
+	return min
+}
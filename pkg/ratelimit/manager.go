@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/utils"
+)
+
+type StreamLimit struct {
+	Pattern string `json:"pattern" mapstructure:"pattern"`
+	Bitrate uint64 `json:"bitrate" mapstructure:"bitrate"`
+}
+
+// Settings bitrates are in bits per second, 0 disables the limit.
+type Settings struct {
+	GlobalBitrate  uint64        `json:"globalBitrate" mapstructure:"globalBitrate"`
+	SessionBitrate uint64        `json:"sessionBitrate" mapstructure:"sessionBitrate"`
+	BurstMs        int           `json:"burstMs" mapstructure:"burstMs"`
+	Streams        []StreamLimit `json:"streams" mapstructure:"streams"`
+}
+
+// Manager hands out egress limiters. Stream buckets are shared by every
+// subscriber of the same stream.
+type Manager struct {
+	settings Settings
+	burst    time.Duration
+	global   *TokenBucket
+	lock     sync.Mutex
+	streams  map[string]*TokenBucket
+}
+
+func NewManager(settings Settings) *Manager {
+	m := &Manager{
+		settings: settings,
+		burst:    time.Duration(settings.BurstMs) * time.Millisecond,
+		streams:  make(map[string]*TokenBucket),
+	}
+
+	if settings.GlobalBitrate > 0 {
+		m.global = NewTokenBucket(settings.GlobalBitrate, m.burst)
+	}
+
+	return m
+}
+
+// StreamBitrate returns the configured limit for streamPath, 0 if unlimited.
+func (m *Manager) StreamBitrate(streamPath string) uint64 {
+	if m == nil {
+		return 0
+	}
+
+	for _, sl := range m.settings.Streams {
+		if utils.MatchStreamPath(sl.Pattern, streamPath) {
+			return sl.Bitrate
+		}
+	}
+
+	return 0
+}
+
+func (m *Manager) streamBucket(streamPath string) *TokenBucket {
+	bitrate := m.StreamBitrate(streamPath)
+	if bitrate == 0 {
+		return nil
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	b, found := m.streams[streamPath]
+	if !found {
+		b = NewTokenBucket(bitrate, m.burst)
+		m.streams[streamPath] = b
+	}
+
+	return b
+}
+
+// ReleaseStream drops the shared bucket of a stream that has ended.
+func (m *Manager) ReleaseStream(streamPath string) {
+	if m == nil {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.streams, streamPath)
+}
+
+// ForSession returns the limiter of a new subscriber session, or nil when no limit applies.
+func (m *Manager) ForSession(streamPath string) Group {
+	if m == nil {
+		return nil
+	}
+
+	g := Group{}
+	if m.global != nil {
+		g = append(g, m.global)
+	}
+
+	if b := m.streamBucket(streamPath); b != nil {
+		g = append(g, b)
+	}
+
+	if m.settings.SessionBitrate > 0 {
+		g = append(g, NewTokenBucket(m.settings.SessionBitrate, m.burst))
+	}
+
+	if len(g) == 0 {
+		return nil
+	}
+
+	return g
+}
+
+var (
+	defaultManager *Manager
+	defaultLock    sync.RWMutex
+)
+
+func SetDefault(m *Manager) {
+	defaultLock.Lock()
+	defer defaultLock.Unlock()
+
+	defaultManager = m
+}
+
+func Default() *Manager {
+	defaultLock.RLock()
+	defer defaultLock.RUnlock()
+
+	return defaultManager
+}
@@ -0,0 +1,316 @@
+// Package av1 reads the obus of av1 temporal units for containers.
+package av1
+
+import "errors"
+
+var ErrInvalidSequenceHeader = errors.New("invalid av1 sequence header")
+
+const (
+	OBUTypeSequenceHeader    = 1
+	OBUTypeTemporalDelimiter = 2
+)
+
+// SplitOBUs returns the obus of a temporal unit in the low overhead format,
+// every obu with its size field set.
+func SplitOBUs(data []byte) [][]byte {
+	var obus [][]byte
+
+	for len(data) > 0 {
+		header := headerSize(data[0])
+		if len(data) < header || data[0]&0x02 == 0 {
+			break
+		}
+
+		size, n := readLeb128(data[header:])
+		if n == 0 || uint64(len(data)-header-n) < size {
+			break
+		}
+
+		end := header + n + int(size)
+		obus = append(obus, data[:end])
+		data = data[end:]
+	}
+
+	return obus
+}
+
+// Type is the type of an obu.
+func Type(obu []byte) int {
+	return int(obu[0]>>3) & 0x0f
+}
+
+// SequenceHeader finds the sequence header obu of a temporal unit, nil if
+// there is none.
+func SequenceHeader(data []byte) []byte {
+	for _, obu := range SplitOBUs(data) {
+		if Type(obu) == OBUTypeSequenceHeader {
+			return obu
+		}
+	}
+
+	return nil
+}
+
+// SequenceHeaderInfo are the fields of a sequence header a decoder
+// configuration carries, and the largest frame size.
+type SequenceHeaderInfo struct {
+	Profile              uint8
+	Level                uint8
+	Tier                 uint8
+	HighBitdepth         bool
+	TwelveBit            bool
+	Monochrome           bool
+	ChromaSubsamplingX   bool
+	ChromaSubsamplingY   bool
+	ChromaSamplePosition uint8
+	Width                int
+	Height               int
+}
+
+// ParseSequenceHeader reads a sequence header obu, see section 5.5 of the av1
+// bitstream specification.
+func ParseSequenceHeader(obu []byte) (SequenceHeaderInfo, error) {
+	var info SequenceHeaderInfo
+
+	if len(obu) == 0 || Type(obu) != OBUTypeSequenceHeader {
+		return info, ErrInvalidSequenceHeader
+	}
+
+	header := headerSize(obu[0])
+	if len(obu) < header {
+		return info, ErrInvalidSequenceHeader
+	}
+	payload := obu[header:]
+	if obu[0]&0x02 != 0 {
+		size, n := readLeb128(payload)
+		if n == 0 || uint64(len(payload)-n) < size {
+			return info, ErrInvalidSequenceHeader
+		}
+		payload = payload[n : n+int(size)]
+	}
+
+	r := &bitReader{data: payload}
+
+	info.Profile = uint8(r.f(3))
+	r.f(1) // still_picture
+	reduced := r.f(1) == 1
+
+	decoderModel := false
+	bufferDelayLength := 0
+	if reduced {
+		info.Level = uint8(r.f(5))
+	} else {
+		if r.f(1) == 1 { // timing_info_present_flag
+			r.f(32)
+			r.f(32)
+			if r.f(1) == 1 { // equal_picture_interval
+				r.uvlc()
+			}
+
+			if decoderModel = r.f(1) == 1; decoderModel {
+				bufferDelayLength = int(r.f(5)) + 1
+				r.f(32)
+				r.f(5)
+				r.f(5)
+			}
+		}
+
+		displayDelay := r.f(1) == 1
+		points := int(r.f(5)) + 1
+		for i := 0; i < points; i++ {
+			r.f(12) // operating_point_idc
+			level := uint8(r.f(5))
+			tier := uint8(0)
+			if level > 7 {
+				tier = uint8(r.f(1))
+			}
+			if i == 0 {
+				info.Level, info.Tier = level, tier
+			}
+
+			if decoderModel && r.f(1) == 1 {
+				r.f(bufferDelayLength)
+				r.f(bufferDelayLength)
+				r.f(1)
+			}
+			if displayDelay && r.f(1) == 1 {
+				r.f(4)
+			}
+		}
+	}
+
+	widthBits := int(r.f(4)) + 1
+	heightBits := int(r.f(4)) + 1
+	info.Width = int(r.f(widthBits)) + 1
+	info.Height = int(r.f(heightBits)) + 1
+
+	if !reduced && r.f(1) == 1 { // frame_id_numbers_present_flag
+		r.f(4)
+		r.f(3)
+	}
+
+	r.f(3) // use_128x128_superblock, enable_filter_intra, enable_intra_edge_filter
+	if !reduced {
+		r.f(4) // enable_interintra_compound, masked_compound, warped_motion, dual_filter
+		orderHint := r.f(1) == 1
+		if orderHint {
+			r.f(2) // enable_jnt_comp, enable_ref_frame_mvs
+		}
+
+		screenContentTools := uint32(2)
+		if r.f(1) == 0 { // seq_choose_screen_content_tools
+			screenContentTools = r.f(1)
+		}
+		if screenContentTools > 0 && r.f(1) == 0 { // seq_choose_integer_mv
+			r.f(1)
+		}
+
+		if orderHint {
+			r.f(3)
+		}
+	}
+	r.f(3) // enable_superres, enable_cdef, enable_restoration
+
+	// color_config
+	info.HighBitdepth = r.f(1) == 1
+	bitDepth := 8
+	if info.HighBitdepth {
+		bitDepth = 10
+		if info.Profile == 2 {
+			if info.TwelveBit = r.f(1) == 1; info.TwelveBit {
+				bitDepth = 12
+			}
+		}
+	}
+	if info.Profile != 1 {
+		info.Monochrome = r.f(1) == 1
+	}
+
+	primaries, transfer, matrix := uint32(2), uint32(2), uint32(2)
+	if r.f(1) == 1 { // color_description_present_flag
+		primaries, transfer, matrix = r.f(8), r.f(8), r.f(8)
+	}
+
+	switch {
+	case info.Monochrome:
+		info.ChromaSubsamplingX, info.ChromaSubsamplingY = true, true
+	case primaries == 1 && transfer == 13 && matrix == 0:
+		// srgb, 4:4:4
+	default:
+		r.f(1) // color_range
+		switch {
+		case info.Profile == 0:
+			info.ChromaSubsamplingX, info.ChromaSubsamplingY = true, true
+		case info.Profile == 1:
+		case bitDepth == 12:
+			if info.ChromaSubsamplingX = r.f(1) == 1; info.ChromaSubsamplingX {
+				info.ChromaSubsamplingY = r.f(1) == 1
+			}
+		default:
+			info.ChromaSubsamplingX = true
+		}
+
+		if info.ChromaSubsamplingX && info.ChromaSubsamplingY {
+			info.ChromaSamplePosition = uint8(r.f(2))
+		}
+	}
+
+	if r.err != nil {
+		return SequenceHeaderInfo{}, r.err
+	}
+
+	return info, nil
+}
+
+// DecoderConfig is the AV1CodecConfigurationRecord of a sequence header, the
+// av1C box of mp4 and the codec private data of matroska.
+func DecoderConfig(obu []byte) ([]byte, error) {
+	info, err := ParseSequenceHeader(obu)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := info.Tier << 7
+	for i, set := range []bool{info.HighBitdepth, info.TwelveBit, info.Monochrome, info.ChromaSubsamplingX, info.ChromaSubsamplingY} {
+		if set {
+			flags |= 1 << uint(6-i)
+		}
+	}
+	flags |= info.ChromaSamplePosition & 0x03
+
+	config := []byte{0x81, info.Profile<<5 | info.Level&0x1f, flags, 0}
+
+	return append(config, obu...), nil
+}
+
+// ParseDecoderConfig returns the sequence header of a decoder configuration.
+func ParseDecoderConfig(config []byte) ([]byte, error) {
+	if len(config) < 4 || config[0] != 0x81 {
+		return nil, ErrInvalidSequenceHeader
+	}
+
+	obu := SequenceHeader(config[4:])
+	if obu == nil {
+		return nil, ErrInvalidSequenceHeader
+	}
+
+	return obu, nil
+}
+
+func headerSize(first byte) int {
+	if first&0x04 != 0 {
+		return 2
+	}
+
+	return 1
+}
+
+// readLeb128 returns the value and length of a leb128 number, length 0 if
+// it is invalid.
+func readLeb128(data []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 8 && i < len(data); i++ {
+		v |= uint64(data[i]&0x7f) << (7 * uint(i))
+		if data[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+
+	return 0, 0
+}
+
+// bitReader keeps the first error, reads after it return 0.
+type bitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *bitReader) f(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		if r.err != nil || r.pos >= len(r.data)*8 {
+			r.err = ErrInvalidSequenceHeader
+			return 0
+		}
+		v = v<<1 | uint32(r.data[r.pos/8]>>(7-r.pos%8))&1
+		r.pos++
+	}
+
+	return v
+}
+
+func (r *bitReader) uvlc() uint32 {
+	zeros := 0
+	for r.f(1) == 0 {
+		if r.err != nil {
+			return 0
+		}
+		zeros++
+	}
+	if zeros >= 32 {
+		return 1<<32 - 1
+	}
+
+	return r.f(zeros) + 1<<zeros - 1
+}
@@ -0,0 +1,163 @@
+// Package avc converts between the h264 framings of rtp and of containers.
+package avc
+
+import (
+	"github.com/pingostack/neon/pkg/codec"
+	"github.com/pingostack/neon/pkg/deliver"
+)
+
+var ErrInvalidSPS = codec.ErrInvalidSPS
+
+const (
+	NALUTypeIDR = 5
+	NALUTypeSPS = 7
+	NALUTypePPS = 8
+	NALUTypeAUD = 9
+)
+
+// SplitAnnexB returns the nal units of an annex b access unit.
+func SplitAnnexB(data []byte) [][]byte {
+	return codec.SplitAnnexB(data)
+}
+
+// ParameterSets finds the last sps and pps of an access unit.
+func ParameterSets(data []byte) (sps, pps []byte) {
+	for _, nalu := range SplitAnnexB(data) {
+		if len(nalu) == 0 {
+			continue
+		}
+
+		switch nalu[0] & 0x1f {
+		case NALUTypeSPS:
+			sps = nalu
+		case NALUTypePPS:
+			pps = nalu
+		}
+	}
+
+	return sps, pps
+}
+
+// ToAVCC converts an access unit to 4 byte length prefixed nal units, the
+// parameter sets are left to the decoder configuration.
+func ToAVCC(data []byte) []byte {
+	out := make([]byte, 0, len(data)+16)
+	for _, nalu := range SplitAnnexB(data) {
+		if len(nalu) == 0 {
+			continue
+		}
+
+		switch nalu[0] & 0x1f {
+		case NALUTypeSPS, NALUTypePPS, NALUTypeAUD:
+			continue
+		}
+
+		n := len(nalu)
+		out = append(out, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+		out = append(out, nalu...)
+	}
+
+	return out
+}
+
+// ToAnnexB converts 4 byte length prefixed nal units back to an access unit
+// with start codes, sps and pps are put in front of keyframes.
+func ToAnnexB(data []byte, sps, pps []byte, keyframe bool) []byte {
+	startCode := []byte{0, 0, 0, 1}
+	out := make([]byte, 0, len(data)+len(sps)+len(pps)+8)
+	if keyframe && sps != nil && pps != nil {
+		out = append(append(out, startCode...), sps...)
+		out = append(append(out, startCode...), pps...)
+	}
+
+	for len(data) >= 4 {
+		n := int(data[0])<<24 | int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+		data = data[4:]
+		if n > len(data) {
+			break
+		}
+		out = append(append(out, startCode...), data[:n]...)
+		data = data[n:]
+	}
+
+	return out
+}
+
+// DecoderConfig is the AVCDecoderConfigurationRecord of sps and pps, e.g.
+// the avcC box of mp4.
+func DecoderConfig(sps, pps []byte) []byte {
+	out := []byte{
+		1,
+		sps[1], // profile
+		sps[2], // compatibility
+		sps[3], // level
+		0xff,   // 4 byte lengths
+		0xe1,   // one sps
+		byte(len(sps) >> 8), byte(len(sps)),
+	}
+	out = append(out, sps...)
+	out = append(out, 1, byte(len(pps)>>8), byte(len(pps)))
+
+	return append(out, pps...)
+}
+
+// ParseDecoderConfig returns the first sps and pps of a decoder
+// configuration.
+func ParseDecoderConfig(config []byte) (sps, pps []byte, err error) {
+	if len(config) < 7 {
+		return nil, nil, ErrInvalidSPS
+	}
+
+	pos := 6
+	n := int(config[pos-1] & 0x1f)
+	for i := 0; i < n; i++ {
+		if pos+2 > len(config) {
+			return nil, nil, ErrInvalidSPS
+		}
+		size := int(config[pos])<<8 | int(config[pos+1])
+		pos += 2
+		if pos+size > len(config) {
+			return nil, nil, ErrInvalidSPS
+		}
+		if sps == nil {
+			sps = config[pos : pos+size]
+		}
+		pos += size
+	}
+
+	if pos >= len(config) {
+		return nil, nil, ErrInvalidSPS
+	}
+	n = int(config[pos])
+	pos++
+	for i := 0; i < n; i++ {
+		if pos+2 > len(config) {
+			return nil, nil, ErrInvalidSPS
+		}
+		size := int(config[pos])<<8 | int(config[pos+1])
+		pos += 2
+		if pos+size > len(config) {
+			return nil, nil, ErrInvalidSPS
+		}
+		if pps == nil {
+			pps = config[pos : pos+size]
+		}
+		pos += size
+	}
+
+	if sps == nil || pps == nil {
+		return nil, nil, ErrInvalidSPS
+	}
+
+	return sps, pps, nil
+}
+
+// SPSSize reads the picture size of an sps, cropping applied.
+func SPSSize(sps []byte) (width, height int, err error) {
+	s, err := codec.ParseSPS(deliver.CodecTypeH264, sps)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return s.Width, s.Height, nil
+}
@@ -0,0 +1,188 @@
+// Package catalog keeps what is known of the recordings, where they are and
+// what they hold, so they are listed and found without reading the record
+// dir.
+package catalog
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/utils"
+)
+
+var (
+	ErrUnknownStore = errors.New("unknown catalog store")
+	ErrNotFound     = errors.New("recording not in catalog")
+	ErrInvalidEntry = errors.New("invalid catalog entry")
+)
+
+// Track is a track of a recording.
+type Track struct {
+	Stream   string `json:"stream"`
+	Codec    string `json:"codec"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	Channels int    `json:"channels,omitempty"`
+}
+
+// Entry is a recording. ID is its path relative to the record dir, slash
+// separated. Path is the local file, empty once it was deleted after an
+// upload, Key the object of the upload.
+type Entry struct {
+	ID        string        `json:"id"`
+	Namespace string        `json:"namespace"`
+	Stream    string        `json:"stream"`
+	Room      string        `json:"room,omitempty"`
+	Start     time.Time     `json:"start"`
+	End       time.Time     `json:"end"`
+	Duration  time.Duration `json:"duration"`
+	Size      int64         `json:"size"`
+	Tracks    []Track       `json:"tracks"`
+	Path      string        `json:"path,omitempty"`
+	Key       string        `json:"key,omitempty"`
+}
+
+// Codecs of the tracks, each once.
+func (e *Entry) Codecs() []string {
+	var codecs []string
+	for _, t := range e.Tracks {
+		if !contains(codecs, t.Codec) {
+			codecs = append(codecs, t.Codec)
+		}
+	}
+
+	return codecs
+}
+
+func (e *Entry) hasCodec(codec string) bool {
+	for _, t := range e.Tracks {
+		if strings.EqualFold(t.Codec, codec) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Filter selects entries, zero fields match all. Path is a namespace/stream
+// pattern, see utils.MatchStreamPath, From and To select the recordings
+// overlapping them.
+type Filter struct {
+	Path   string
+	Room   string
+	Codec  string
+	From   time.Time
+	To     time.Time
+	Offset int
+	Limit  int
+}
+
+// Match tells whether f selects e, Offset and Limit aside.
+func (f *Filter) Match(e *Entry) bool {
+	if f.Path != "" && !utils.MatchStreamPath(f.Path, e.Namespace+"/"+e.Stream) {
+		return false
+	}
+
+	if f.Room != "" && e.Room != f.Room {
+		return false
+	}
+
+	if f.Codec != "" && !e.hasCodec(f.Codec) {
+		return false
+	}
+
+	if !f.From.IsZero() && e.End.Before(f.From) {
+		return false
+	}
+
+	if !f.To.IsZero() && e.Start.After(f.To) {
+		return false
+	}
+
+	return true
+}
+
+// Page sorts entries by start, then id, and cuts them after Offset to Limit.
+func (f *Filter) Page(entries []Entry) []Entry {
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Start.Equal(entries[j].Start) {
+			return entries[i].Start.Before(entries[j].Start)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+
+	if f.Offset > 0 {
+		if f.Offset >= len(entries) {
+			return nil
+		}
+		entries = entries[f.Offset:]
+	}
+
+	if f.Limit > 0 && len(entries) > f.Limit {
+		entries = entries[:f.Limit]
+	}
+
+	return entries
+}
+
+// Store keeps the entries of a catalog.
+type Store interface {
+	// Put adds an entry or replaces the one with its id.
+	Put(e Entry) error
+	Get(id string) (Entry, error)
+	// List returns the entries f selects sorted by start.
+	List(f Filter) ([]Entry, error)
+	Delete(id string) error
+	// Len is the number of entries.
+	Len() (int, error)
+	Close() error
+}
+
+var (
+	stores     = make(map[string]func(dsn string) (Store, error))
+	storesLock sync.RWMutex
+)
+
+// StoreFile keeps the catalog in a json file, dsn is its path.
+const StoreFile = "file"
+
+func init() {
+	RegisterStore(StoreFile, func(dsn string) (Store, error) {
+		return OpenFileStore(dsn)
+	})
+}
+
+// RegisterStore makes a store available by name, e.g. from a build with a
+// database driver.
+func RegisterStore(name string, open func(dsn string) (Store, error)) {
+	storesLock.Lock()
+	defer storesLock.Unlock()
+
+	stores[name] = open
+}
+
+// Open opens the store registered as name.
+func Open(name, dsn string) (Store, error) {
+	storesLock.RLock()
+	open := stores[name]
+	storesLock.RUnlock()
+
+	if open == nil {
+		return nil, ErrUnknownStore
+	}
+
+	return open(dsn)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,129 @@
+package catalog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fileStore holds the catalog in memory and writes all of it to its file
+// on every change, the file is replaced so it is never left half written.
+type fileStore struct {
+	path    string
+	lock    sync.RWMutex
+	entries map[string]Entry
+}
+
+// OpenFileStore reads the catalog at path, a missing file is an empty
+// catalog.
+func OpenFileStore(path string) (Store, error) {
+	s := &fileStore{
+		path:    path,
+		entries: make(map[string]Entry),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		s.entries[e.ID] = e
+	}
+
+	return s, nil
+}
+
+func (s *fileStore) Put(e Entry) error {
+	if e.ID == "" {
+		return ErrInvalidEntry
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.entries[e.ID] = e
+
+	return s.save()
+}
+
+func (s *fileStore) Get(id string) (Entry, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	e, ok := s.entries[id]
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+
+	return e, nil
+}
+
+func (s *fileStore) List(f Filter) ([]Entry, error) {
+	s.lock.RLock()
+	var entries []Entry
+	for _, e := range s.entries {
+		if f.Match(&e) {
+			entries = append(entries, e)
+		}
+	}
+	s.lock.RUnlock()
+
+	return f.Page(entries), nil
+}
+
+func (s *fileStore) Delete(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.entries[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.entries, id)
+
+	return s.save()
+}
+
+func (s *fileStore) Len() (int, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return len(s.entries), nil
+}
+
+func (s *fileStore) Close() error {
+	return nil
+}
+
+// save must be called with s.lock held
+func (s *fileStore) save() error {
+	entries := make([]Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	entries = (&Filter{}).Page(entries)
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
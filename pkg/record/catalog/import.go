@@ -0,0 +1,70 @@
+package catalog
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/pingostack/neon/pkg/record"
+)
+
+// Import adds the recordings of dir s doesn't know, laid out as
+// namespace/stream/file the way the recorder writes them, e.g. into a new
+// catalog of an existing dir. Only the durations of mkv and webm are known.
+func Import(s Store, dir string) (int, error) {
+	imported := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		switch record.Format(strings.TrimPrefix(filepath.Ext(path), ".")) {
+		case record.FormatMP4, record.FormatMKV, record.FormatWebM:
+		default:
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil
+		}
+		id := filepath.ToSlash(rel)
+		if _, err := s.Get(id); err == nil {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		e := Entry{
+			ID:   id,
+			End:  info.ModTime(),
+			Size: info.Size(),
+			Path: path,
+		}
+		if parts := strings.Split(id, "/"); len(parts) == 3 {
+			e.Namespace, e.Stream = parts[0], parts[1]
+		}
+
+		if ix, err := record.LoadIndex(path); err == nil {
+			e.Duration = ix.Duration
+		}
+		e.Start = e.End.Add(-e.Duration)
+
+		if err := s.Put(e); err != nil {
+			return err
+		}
+		imported++
+
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) && imported == 0 {
+		// nothing recorded yet
+		return 0, nil
+	}
+
+	return imported, err
+}
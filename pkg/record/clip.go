@@ -0,0 +1,320 @@
+package record
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/record/avc"
+	"github.com/pingostack/neon/pkg/record/mkv"
+	"github.com/pingostack/neon/pkg/record/mp4"
+)
+
+const clipVideoTimescale = 90000
+
+// ClipPart is a recording a clip is cut from, Start the wall clock time of
+// its beginning.
+type ClipPart struct {
+	Path  string
+	Start time.Time
+}
+
+// ClipInfo is what was cut, from the keyframe at or before the start asked
+// for.
+type ClipInfo struct {
+	Start    time.Time
+	Duration time.Duration
+}
+
+type clipTrack struct {
+	index     int
+	codec     deliver.CodecType
+	private   []byte
+	timescale uint32
+	sps, pps  []byte
+	dts       *deliver.DTSExtractor
+}
+
+// clipper copies the frames of mkv and webm recordings into an mp4 as they
+// are, h264 and opus only.
+type clipper struct {
+	w        io.Writer
+	from, to time.Time
+	start    time.Time
+	end      time.Duration
+	mw       *mp4.Writer
+	video    *clipTrack
+	audio    *clipTrack
+	// the video starts on a keyframe, audio is skipped until then
+	started bool
+}
+
+// ExportClip writes the part of parts from from to to into w as an mp4,
+// without re-encoding, starting on the keyframe at or before from. The
+// parts are in order, the clip stops at a part whose tracks differ from the
+// first.
+func ExportClip(w io.Writer, parts []ClipPart, from, to time.Time) (ClipInfo, error) {
+	if !to.After(from) {
+		return ClipInfo{}, ErrInvalidRange
+	}
+
+	c := &clipper{w: w, from: from, to: to}
+	for _, part := range parts {
+		if !part.Start.Before(to) {
+			break
+		}
+
+		more, err := c.copy(part)
+		if err != nil {
+			return ClipInfo{}, err
+		}
+		if !more {
+			break
+		}
+	}
+
+	if c.mw == nil {
+		return ClipInfo{}, ErrNoKeyframes
+	}
+
+	if err := c.flush(); err != nil {
+		return ClipInfo{}, err
+	}
+
+	if err := c.mw.Close(); err != nil {
+		return ClipInfo{}, err
+	}
+
+	return ClipInfo{Start: c.start, Duration: c.end}, nil
+}
+
+// copy adds the frames of part, false when the clip ends with it.
+func (c *clipper) copy(part ClipPart) (bool, error) {
+	switch Format(strings.TrimPrefix(filepath.Ext(part.Path), ".")) {
+	case FormatMKV, FormatWebM:
+	default:
+		return false, ErrUnsupportedFormat
+	}
+
+	f, err := os.Open(part.Path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	reader, err := mkv.NewReader(f)
+	if err != nil {
+		return false, err
+	}
+
+	video, audio := -1, -1
+	for i, t := range reader.Tracks() {
+		switch {
+		case t.Codec == deliver.CodecTypeH264 && video < 0:
+			video = i
+		case t.Codec == deliver.CodecTypeOpus && audio < 0:
+			audio = i
+		}
+	}
+
+	if c.mw == nil {
+		if err := c.tracks(reader.Tracks(), video, audio); err != nil {
+			return false, err
+		}
+	} else if !c.same(reader.Tracks(), video, audio) {
+		return false, nil
+	}
+
+	// the first part is sought to the keyframe before from
+	if !c.started && c.from.After(part.Start) {
+		if ix, err := LoadIndex(part.Path); err == nil {
+			if entry, ok := ix.Seek(c.from.Sub(part.Start)); ok && entry.Offset > 0 {
+				if err := reader.SeekCluster(entry.Offset); err != nil {
+					return false, err
+				}
+			}
+		}
+	}
+
+	for {
+		frame, err := reader.ReadFrame()
+		if err == io.EOF {
+			return true, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		at := part.Start.Add(frame.Timestamp)
+		if !at.Before(c.to) {
+			return false, nil
+		}
+
+		switch frame.Track {
+		case video:
+			err = c.writeVideo(at, frame)
+		case audio:
+			err = c.writeAudio(at, frame)
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+func (c *clipper) tracks(tracks []mkv.TrackInfo, video, audio int) error {
+	if video < 0 && audio < 0 {
+		return mp4.ErrUnsupportedCodec
+	}
+
+	if video >= 0 {
+		t := tracks[video]
+		sps, pps, err := avc.ParseDecoderConfig(t.CodecPrivate)
+		if err != nil {
+			return err
+		}
+		c.video = &clipTrack{
+			codec:     t.Codec,
+			private:   t.CodecPrivate,
+			timescale: clipVideoTimescale,
+			sps:       sps,
+			pps:       pps,
+			dts:       deliver.NewDTSExtractor(deliver.DefaultReorderDepth),
+		}
+	}
+
+	if audio >= 0 {
+		t := tracks[audio]
+		sampleRate := t.SampleRate
+		if sampleRate == 0 {
+			sampleRate = 48000
+		}
+		c.audio = &clipTrack{codec: t.Codec, private: t.CodecPrivate, timescale: sampleRate}
+		if c.video != nil {
+			c.audio.index = 1
+		}
+	}
+
+	return nil
+}
+
+// same tells whether the tracks of a part are those of the clip.
+func (c *clipper) same(tracks []mkv.TrackInfo, video, audio int) bool {
+	if (c.video != nil) != (video >= 0) || (c.audio != nil) != (audio >= 0) {
+		return false
+	}
+
+	return c.video == nil || bytes.Equal(c.video.private, tracks[video].CodecPrivate)
+}
+
+// open writes the moov once the first video keyframe, or audio frame of a
+// clip without video, is at hand.
+func (c *clipper) open(at time.Time, keyframe []byte) error {
+	var tracks []mp4.Track
+	if c.video != nil {
+		tracks = append(tracks, mp4.Track{
+			Codec:     deliver.CodecTypeH264,
+			Timescale: c.video.timescale,
+			Keyframe:  keyframe,
+		})
+	}
+	if c.audio != nil {
+		tracks = append(tracks, mp4.Track{
+			Codec:     deliver.CodecTypeOpus,
+			Timescale: c.audio.timescale,
+		})
+	}
+
+	mw, err := mp4.NewWriter(c.w, tracks)
+	if err != nil {
+		return err
+	}
+
+	c.mw, c.start, c.started = mw, at, true
+
+	return nil
+}
+
+func (c *clipper) ts(t *clipTrack, at time.Time) int64 {
+	return int64(at.Sub(c.start)) * int64(t.timescale) / int64(time.Second)
+}
+
+func (c *clipper) writeVideo(at time.Time, frame mkv.Frame) error {
+	t := c.video
+	data := avc.ToAnnexB(frame.Data, t.sps, t.pps, frame.Keyframe)
+
+	if !c.started {
+		// the part was sought to the keyframe at or before from
+		if !frame.Keyframe {
+			return nil
+		}
+		if err := c.open(at, data); err != nil {
+			return err
+		}
+	}
+
+	if at.Sub(c.start) > c.end {
+		c.end = at.Sub(c.start)
+	}
+
+	out := t.dts.Push(deliver.Frame{
+		Codec:          deliver.CodecTypeH264,
+		Payload:        data,
+		TimeStamp:      uint32(c.ts(t, at)),
+		AdditionalInfo: &deliver.VideoFrameSpecificInfo{IsKeyFrame: frame.Keyframe},
+	})
+
+	return c.writeFrames(t, out)
+}
+
+func (c *clipper) writeAudio(at time.Time, frame mkv.Frame) error {
+	if !c.started {
+		if c.video != nil || at.Before(c.from) {
+			return nil
+		}
+		if err := c.open(at, nil); err != nil {
+			return err
+		}
+	}
+
+	if at.Before(c.start) {
+		return nil
+	}
+
+	if at.Sub(c.start) > c.end {
+		c.end = at.Sub(c.start)
+	}
+
+	return c.mw.WriteSample(c.audio.index, mp4.Sample{
+		DTS:      c.ts(c.audio, at),
+		Keyframe: true,
+		Data:     frame.Data,
+	})
+}
+
+func (c *clipper) writeFrames(t *clipTrack, frames []deliver.Frame) error {
+	for _, frame := range frames {
+		if err := c.mw.WriteSample(t.index, mp4.Sample{
+			DTS:      int64(frame.TimeStamp) - int64(frame.CompositionOffset),
+			CTS:      frame.CompositionOffset,
+			Keyframe: isKeyframe(frame),
+			Data:     frame.Payload,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// flush writes the video frames held for their decoding timestamps.
+func (c *clipper) flush() error {
+	if c.video == nil {
+		return nil
+	}
+
+	return c.writeFrames(c.video, c.video.dts.Flush())
+}
@@ -0,0 +1,163 @@
+package record
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/rtclib"
+	"github.com/pion/rtp"
+	"github.com/sirupsen/logrus"
+)
+
+// FrameDestination subscribes a recording to a stream, rtp is assembled into
+// raw frames.
+type FrameDestination struct {
+	deliver.FrameDestination
+	logger     *logrus.Entry
+	lock       sync.Mutex
+	audio      *rtclib.Depacketizer
+	video      *rtclib.Depacketizer
+	metadata   string
+	onMetadata func(md *deliver.Metadata)
+	onFrame    func(frame deliver.Frame)
+}
+
+func NewFrameDestination(ctx context.Context, logger *logrus.Entry) *FrameDestination {
+	return &FrameDestination{
+		FrameDestination: deliver.NewFrameDestinationImpl(ctx, deliver.FormatSettings{
+			PacketType: deliver.PacketTypeRtp,
+		}),
+		logger: logger,
+	}
+}
+
+// OnMetadataChange is called when the stream starts and when its codecs
+// change, before the frames of the new codecs.
+func (fd *FrameDestination) OnMetadataChange(f func(md *deliver.Metadata)) {
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	fd.onMetadata = f
+}
+
+// OnRawFrame is called with every frame assembled.
+func (fd *FrameDestination) OnRawFrame(f func(frame deliver.Frame)) {
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	fd.onFrame = f
+}
+
+func (fd *FrameDestination) OnSource(src deliver.FrameSource) error {
+	if err := fd.FrameDestination.OnSource(src); err != nil {
+		return err
+	}
+
+	fd.setup(src.Metadata())
+
+	return nil
+}
+
+func (fd *FrameDestination) OnMetaData(metadata *deliver.Metadata) {
+	fd.FrameDestination.OnMetaData(metadata)
+	fd.setup(metadata)
+}
+
+func (fd *FrameDestination) setup(md *deliver.Metadata) {
+	if !md.HasAudio() && !md.HasVideo() {
+		return
+	}
+
+	fd.lock.Lock()
+	str := md.String()
+	if str == fd.metadata {
+		fd.lock.Unlock()
+		return
+	}
+	fd.metadata = str
+
+	fd.audio, fd.video = nil, nil
+	var err error
+	if md.HasVideo() {
+		clockRate := md.Video.ClockRate
+		if clockRate == 0 {
+			clockRate = defaultClockRate
+		}
+		if fd.video, err = rtclib.NewDepacketizer(md.Video.CodecType, clockRate, 0); err != nil {
+			fd.logger.WithField("codec", md.Video.CodecType.String()).Warn("video not recorded")
+		}
+	}
+
+	if md.HasAudio() {
+		if fd.audio, err = rtclib.NewDepacketizer(md.Audio.CodecType, md.Audio.SampleRate, md.Audio.Channels); err != nil {
+			fd.logger.WithField("codec", md.Audio.CodecType.String()).Warn("audio not recorded")
+		}
+	}
+	f := fd.onMetadata
+	fd.lock.Unlock()
+
+	if f != nil {
+		f(md)
+	}
+}
+
+func (fd *FrameDestination) OnFrame(frame deliver.Frame, attr deliver.Attributes) {
+	fd.lock.Lock()
+	f := fd.onFrame
+	depacketizer := fd.audio
+	if frame.Codec.IsVideo() {
+		depacketizer = fd.video
+	}
+	fd.lock.Unlock()
+
+	if f == nil {
+		return
+	}
+
+	if frame.PacketType == deliver.PacketTypeRaw {
+		f(frame)
+		return
+	}
+
+	if depacketizer == nil {
+		return
+	}
+
+	// the depacketizer keeps packets after the frame was released
+	packet := &rtp.Packet{}
+	if src, ok := frame.RawPacket.(*rtp.Packet); ok {
+		*packet = *src
+		packet.Payload = append([]byte(nil), src.Payload...)
+	} else if err := packet.Unmarshal(append([]byte(nil), frame.Payload...)); err != nil {
+		return
+	}
+
+	for _, raw := range fd.push(depacketizer, packet) {
+		f(raw)
+	}
+}
+
+// push hands packet to depacketizer, the depacketizers share fd.lock with the
+// setup.
+func (fd *FrameDestination) push(depacketizer *rtclib.Depacketizer, packet *rtp.Packet) []deliver.Frame {
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	return depacketizer.Push(packet)
+}
+
+// RequestKeyframe asks the publisher for a keyframe, e.g. when a new file
+// starts.
+func (fd *FrameDestination) RequestKeyframe() {
+	fd.DeliverFeedback(deliver.FeedbackMsg{
+		Type: deliver.FeedbackTypeVideo,
+		Cmd:  deliver.FeedbackCmdPLI,
+	})
+}
+
+// OnFrameGap is called when the recording fell behind the stream.
+func (fd *FrameDestination) OnFrameGap(lost uint64) {
+	fd.logger.WithField("lost", lost).Warn("recording fell behind")
+	fd.RequestKeyframe()
+}
@@ -0,0 +1,16 @@
+package record
+
+import "errors"
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported recording format")
+	ErrRecorderStarted   = errors.New("recorder already started")
+	ErrRecorderClosed    = errors.New("recorder closed")
+	ErrNoTracks          = errors.New("no tracks to record")
+	ErrInvalidURL        = errors.New("invalid vod url")
+	ErrInvalidRange      = errors.New("invalid range")
+	ErrSeekOutOfRange    = errors.New("seek beyond the end of the recording")
+	ErrNoKeyframes       = errors.New("recording without keyframes")
+	ErrInvalidCron       = errors.New("invalid cron expression")
+	ErrInvalidSchedule   = errors.New("invalid recording schedule")
+)
@@ -0,0 +1,231 @@
+package record
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/record/mkv"
+)
+
+// IndexEntry is a keyframe of a recording, Offset the byte offset of the
+// cluster it is found in.
+type IndexEntry struct {
+	Time   time.Duration `json:"time"`
+	Offset int64         `json:"offset"`
+}
+
+// Index lists the keyframes of the first video track of a recording in time
+// order, of audio only files the first frame of every cluster.
+type Index struct {
+	Path     string
+	Size     int64
+	ModTime  time.Time
+	Duration time.Duration
+	// Header is the size of the file before the first cluster.
+	Header  int64
+	Entries []IndexEntry
+}
+
+var (
+	indexes     = make(map[string]*Index)
+	indexesLock sync.Mutex
+)
+
+// BuildIndex reads the recording at path, mkv and webm only.
+func BuildIndex(path string) (*Index, error) {
+	switch Format(strings.TrimPrefix(filepath.Ext(path), ".")) {
+	case FormatMKV, FormatWebM:
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := mkv.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	video := -1
+	for i, t := range reader.Tracks() {
+		if t.Codec.IsVideo() {
+			video = i
+			break
+		}
+	}
+
+	ix := &Index{
+		Path:    path,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Header:  -1,
+	}
+
+	lastCluster := int64(-1)
+	for {
+		frame, err := reader.ReadFrame()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// recordings still being written end anywhere
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if ix.Header < 0 {
+			ix.Header = frame.Cluster
+		}
+
+		if frame.Timestamp > ix.Duration {
+			ix.Duration = frame.Timestamp
+		}
+
+		keyframe := frame.Track == video && frame.Keyframe
+		if video < 0 {
+			keyframe = frame.Cluster != lastCluster
+		}
+		lastCluster = frame.Cluster
+
+		if n := len(ix.Entries); keyframe && (n == 0 || frame.Timestamp > ix.Entries[n-1].Time) {
+			ix.Entries = append(ix.Entries, IndexEntry{Time: frame.Timestamp, Offset: frame.Cluster})
+		}
+	}
+
+	if ix.Header < 0 {
+		ix.Header = ix.Size
+	}
+
+	return ix, nil
+}
+
+// LoadIndex returns the index of path, rebuilt when the file changed since it
+// was built, e.g. while it is still being recorded.
+func LoadIndex(path string) (*Index, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	indexesLock.Lock()
+	ix := indexes[path]
+	indexesLock.Unlock()
+
+	if ix != nil && ix.Size == info.Size() && ix.ModTime.Equal(info.ModTime()) {
+		return ix, nil
+	}
+
+	if ix, err = BuildIndex(path); err != nil {
+		return nil, err
+	}
+
+	indexesLock.Lock()
+	indexes[path] = ix
+	indexesLock.Unlock()
+
+	return ix, nil
+}
+
+// Seek returns the last keyframe at or before t, the first keyframe when t
+// precedes it.
+func (ix *Index) Seek(t time.Duration) (IndexEntry, bool) {
+	if len(ix.Entries) == 0 {
+		return IndexEntry{}, false
+	}
+
+	i := sort.Search(len(ix.Entries), func(i int) bool {
+		return ix.Entries[i].Time > t
+	})
+	if i == 0 {
+		return ix.Entries[0], true
+	}
+
+	return ix.Entries[i-1], true
+}
+
+// Position is a span resolved on a recording, it starts at a keyframe and
+// ends before the first cluster at or after End.
+type Position struct {
+	Start       time.Duration `json:"start"`
+	StartOffset int64         `json:"startOffset"`
+	End         time.Duration `json:"end"`
+	EndOffset   int64         `json:"endOffset"`
+}
+
+// Resolve maps span on the recording.
+func (ix *Index) Resolve(span Span) (Position, error) {
+	start := span.Start
+	if span.FromEnd {
+		start = ix.Duration - span.Start
+		if start < 0 {
+			start = 0
+		}
+	}
+
+	if start > ix.Duration {
+		return Position{}, ErrSeekOutOfRange
+	}
+
+	entry, ok := ix.Seek(start)
+	if !ok {
+		return Position{}, ErrNoKeyframes
+	}
+
+	pos := Position{
+		Start:       entry.Time,
+		StartOffset: entry.Offset,
+		End:         ix.Duration,
+		EndOffset:   ix.Size,
+	}
+
+	if span.End > 0 && span.End < ix.Duration {
+		if span.End <= start {
+			return Position{}, ErrInvalidRange
+		}
+
+		pos.End = span.End
+		i := sort.Search(len(ix.Entries), func(i int) bool {
+			return ix.Entries[i].Time >= span.End && ix.Entries[i].Offset > entry.Offset
+		})
+		if i < len(ix.Entries) {
+			pos.EndOffset = ix.Entries[i].Offset
+		}
+	}
+
+	return pos, nil
+}
+
+type clip struct {
+	io.Reader
+	f *os.File
+}
+
+func (c *clip) Close() error {
+	return c.f.Close()
+}
+
+// Clip reads the part of the file pos covers, the header and the clusters
+// from StartOffset to EndOffset, a file of its own. It returns the size.
+func (ix *Index) Clip(pos Position) (io.ReadCloser, int64, error) {
+	f, err := os.Open(ix.Path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	body := pos.EndOffset - pos.StartOffset
+	reader := io.MultiReader(io.NewSectionReader(f, 0, ix.Header), io.NewSectionReader(f, pos.StartOffset, body))
+
+	return &clip{Reader: reader, f: f}, ix.Header + body, nil
+}
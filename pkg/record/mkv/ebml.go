@@ -0,0 +1,302 @@
+package mkv
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// element ids, with their length marker
+const (
+	idEBML               = 0x1a45dfa3
+	idEBMLVersion        = 0x4286
+	idEBMLReadVersion    = 0x42f7
+	idEBMLMaxIDLength    = 0x42f2
+	idEBMLMaxSizeLength  = 0x42f3
+	idDocType            = 0x4282
+	idDocTypeVersion     = 0x4287
+	idDocTypeReadVersion = 0x4285
+
+	idSegment        = 0x18538067
+	idSeekHead       = 0x114d9b74
+	idInfo           = 0x1549a966
+	idTimestampScale = 0x2ad7b1
+	idMuxingApp      = 0x4d80
+	idWritingApp     = 0x5741
+	idTracks         = 0x1654ae6b
+	idTrackEntry     = 0xae
+	idTrackNumber    = 0xd7
+	idTrackUID       = 0x73c5
+	idTrackType      = 0x83
+	idFlagLacing     = 0x9c
+	idCodecID        = 0x86
+	idCodecPrivate   = 0x63a2
+	idCodecDelay     = 0x56aa
+	idSeekPreRoll    = 0x56bb
+	idVideo          = 0xe0
+	idPixelWidth     = 0xb0
+	idPixelHeight    = 0xba
+	idAudio          = 0xe1
+	idSampling       = 0xb5
+	idChannels       = 0x9f
+
+	idCluster        = 0x1f43b675
+	idClusterTime    = 0xe7
+	idSimpleBlock    = 0xa3
+	idBlockGroup     = 0xa0
+	idBlock          = 0xa1
+	idReferenceBlock = 0xfb
+	idCues           = 0x1c53bb6b
+	idTags           = 0x1254c367
+)
+
+const (
+	trackTypeVideo = 1
+	trackTypeAudio = 2
+
+	// all bits of an 8 byte size set, the size of live segments and clusters
+	unknownSize = 0x01ffffffffffffff
+	// elements read into memory, frames and headers
+	maxElementSize = 64 << 20
+)
+
+// element builds master elements, children are written into the payload
+// and the size is patched when it ends, always 8 bytes long.
+type element struct {
+	buf    []byte
+	starts []int
+}
+
+func (e *element) id(id uint32) {
+	switch {
+	case id >= 0x1000000:
+		e.buf = append(e.buf, byte(id>>24), byte(id>>16), byte(id>>8), byte(id))
+	case id >= 0x10000:
+		e.buf = append(e.buf, byte(id>>16), byte(id>>8), byte(id))
+	case id >= 0x100:
+		e.buf = append(e.buf, byte(id>>8), byte(id))
+	default:
+		e.buf = append(e.buf, byte(id))
+	}
+}
+
+func (e *element) size(n uint64) {
+	e.buf = append(e.buf, 0x01, byte(n>>48), byte(n>>40), byte(n>>32), byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func (e *element) begin(id uint32) {
+	e.id(id)
+	e.starts = append(e.starts, len(e.buf))
+	e.size(0)
+}
+
+// beginUnknown begins a master element that is never ended.
+func (e *element) beginUnknown(id uint32) {
+	e.id(id)
+	e.size(unknownSize)
+}
+
+func (e *element) end() {
+	start := e.starts[len(e.starts)-1]
+	e.starts = e.starts[:len(e.starts)-1]
+
+	n := uint64(len(e.buf) - start - 8)
+	binary.BigEndian.PutUint64(e.buf[start:], n)
+	e.buf[start] = 0x01
+}
+
+func (e *element) uint(id uint32, v uint64) {
+	var data []byte
+	for shift := 56; shift >= 0; shift -= 8 {
+		if b := byte(v >> uint(shift)); b != 0 || len(data) > 0 || shift == 0 {
+			data = append(data, b)
+		}
+	}
+	e.bytes(id, data)
+}
+
+func (e *element) float(id uint32, v float64) {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, math.Float64bits(v))
+	e.bytes(id, data)
+}
+
+func (e *element) string(id uint32, v string) {
+	e.bytes(id, []byte(v))
+}
+
+func (e *element) bytes(id uint32, data []byte) {
+	e.id(id)
+	e.size(uint64(len(data)))
+	e.buf = append(e.buf, data...)
+}
+
+// appendVint appends a variable length integer of the fewest bytes, e.g. the
+// track number of a block.
+func appendVint(buf []byte, v uint64) []byte {
+	n := 1
+	for n < 8 && v >= 1<<(7*n)-1 {
+		n++
+	}
+
+	v |= 1 << (7 * n)
+	for i := n - 1; i >= 0; i-- {
+		buf = append(buf, byte(v>>(8*i)))
+	}
+
+	return buf
+}
+
+// reader reads elements from a stream, pos is the offset in the stream.
+type reader struct {
+	r   *bufio.Reader
+	pos int64
+}
+
+// vint reads a variable length integer, see parseVint.
+func (r *reader) vint(keepMarker bool) (v uint64, n int, unknown bool, err error) {
+	first, err := r.r.Peek(1)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	data, err := r.r.Peek(vintLen(first[0]))
+	if err != nil {
+		return 0, 0, false, io.ErrUnexpectedEOF
+	}
+
+	v, n, unknown, err = parseVint(data, keepMarker)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	r.r.Discard(n)
+	r.pos += int64(n)
+
+	return v, n, unknown, nil
+}
+
+// header reads the id and size of the next element.
+func (r *reader) header() (id uint32, size uint64, unknown bool, err error) {
+	v, n, _, err := r.vint(true)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if n > 4 {
+		return 0, 0, false, ErrInvalidElement
+	}
+
+	size, _, unknown, err = r.vint(false)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return uint32(v), size, unknown, err
+}
+
+func (r *reader) data(size uint64) ([]byte, error) {
+	if size > maxElementSize {
+		return nil, ErrInvalidElement
+	}
+
+	data := make([]byte, size)
+	n, err := io.ReadFull(r.r, data)
+	r.pos += int64(n)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (r *reader) skip(size uint64) error {
+	if size > math.MaxInt32 {
+		return ErrInvalidElement
+	}
+
+	n, err := r.r.Discard(int(size))
+	r.pos += int64(n)
+	return err
+}
+
+func vintLen(first byte) int {
+	n := 1
+	for mask := byte(0x80); n <= 8 && first&mask == 0; mask >>= 1 {
+		n++
+	}
+
+	if n > 8 {
+		return 1
+	}
+
+	return n
+}
+
+// parseVint reads a variable length integer at the start of data, with the
+// marker kept for ids.
+func parseVint(data []byte, keepMarker bool) (v uint64, n int, unknown bool, err error) {
+	if len(data) == 0 {
+		return 0, 0, false, ErrInvalidElement
+	}
+
+	n = vintLen(data[0])
+	if data[0] == 0 || n > len(data) {
+		return 0, 0, false, ErrInvalidElement
+	}
+
+	v = uint64(data[0])
+	if !keepMarker {
+		v &= uint64(0xff >> n)
+	}
+	allOnes := v == uint64(0xff>>n)
+
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(data[i])
+		allOnes = allOnes && data[i] == 0xff
+	}
+
+	return v, n, allOnes && !keepMarker, nil
+}
+
+// children iterates the elements of a master element read into memory.
+func children(data []byte, f func(id uint32, data []byte) error) error {
+	for len(data) > 0 {
+		id, idLen, _, err := parseVint(data, true)
+		if err != nil || idLen > 4 {
+			return ErrInvalidElement
+		}
+
+		size, sizeLen, unknown, err := parseVint(data[idLen:], false)
+		if err != nil || unknown || uint64(len(data)-idLen-sizeLen) < size {
+			return ErrInvalidElement
+		}
+
+		start := idLen + sizeLen
+		if err := f(uint32(id), data[start:start+int(size)]); err != nil {
+			return err
+		}
+		data = data[start+int(size):]
+	}
+
+	return nil
+}
+
+func readUint(data []byte) uint64 {
+	var v uint64
+	for _, b := range data {
+		v = v<<8 | uint64(b)
+	}
+
+	return v
+}
+
+func readFloat(data []byte) float64 {
+	switch len(data) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(data))
+	}
+
+	return 0
+}
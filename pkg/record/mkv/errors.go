@@ -0,0 +1,13 @@
+package mkv
+
+import "errors"
+
+var (
+	ErrUnsupportedCodec = errors.New("codec not supported by matroska")
+	ErrNoParameterSets  = errors.New("keyframe without sps and pps")
+	ErrInvalidTrack     = errors.New("invalid track")
+	ErrInvalidElement   = errors.New("invalid matroska element")
+	ErrNoTracks         = errors.New("matroska file without tracks")
+	ErrWriterClosed     = errors.New("matroska writer closed")
+	ErrNotSeekable      = errors.New("matroska source not seekable")
+)
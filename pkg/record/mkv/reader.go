@@ -0,0 +1,306 @@
+package mkv
+
+import (
+	"bufio"
+	"io"
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver"
+)
+
+// TrackInfo describes a track of a file read.
+type TrackInfo struct {
+	Number       uint64
+	Codec        deliver.CodecType
+	CodecPrivate []byte
+	Width        int
+	Height       int
+	SampleRate   uint32
+	Channels     uint8
+}
+
+// Frame is a block of a file read, Track the index in Tracks. Cluster is the
+// byte offset of the cluster of the frame, see SeekCluster.
+type Frame struct {
+	Track     int
+	Timestamp time.Duration
+	Keyframe  bool
+	Data      []byte
+	Cluster   int64
+}
+
+// Reader reads the frames of a Matroska or WebM file in file order.
+type Reader struct {
+	src           io.Reader
+	r             *reader
+	scale         uint64
+	tracks        []TrackInfo
+	cluster       int64
+	clusterOffset int64
+}
+
+func NewReader(r io.Reader) (*Reader, error) {
+	mr := &Reader{
+		src:   r,
+		r:     &reader{r: bufio.NewReaderSize(r, 64<<10)},
+		scale: timestampScale,
+	}
+
+	id, size, _, err := mr.r.header()
+	if err != nil || id != idEBML {
+		return nil, ErrInvalidElement
+	}
+	if err := mr.r.skip(size); err != nil {
+		return nil, err
+	}
+
+	// the tracks precede the first cluster
+	for mr.tracks == nil {
+		id, size, unknown, err := mr.r.header()
+		if err == io.EOF {
+			return nil, ErrNoTracks
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch id {
+		case idSegment:
+			// children follow
+		case idInfo, idTracks:
+			data, err := mr.r.data(size)
+			if err != nil {
+				return nil, err
+			}
+			if id == idInfo {
+				err = mr.parseInfo(data)
+			} else {
+				err = mr.parseTracks(data)
+			}
+			if err != nil {
+				return nil, err
+			}
+		case idCluster:
+			return nil, ErrNoTracks
+		default:
+			if unknown {
+				return nil, ErrInvalidElement
+			}
+			if err := mr.r.skip(size); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(mr.tracks) == 0 {
+		return nil, ErrNoTracks
+	}
+
+	return mr, nil
+}
+
+func (mr *Reader) Tracks() []TrackInfo {
+	return mr.tracks
+}
+
+func (mr *Reader) parseInfo(data []byte) error {
+	return children(data, func(id uint32, data []byte) error {
+		if id == idTimestampScale {
+			if scale := readUint(data); scale != 0 {
+				mr.scale = scale
+			}
+		}
+
+		return nil
+	})
+}
+
+func (mr *Reader) parseTracks(data []byte) error {
+	mr.tracks = []TrackInfo{}
+
+	return children(data, func(id uint32, data []byte) error {
+		if id != idTrackEntry {
+			return nil
+		}
+
+		var t TrackInfo
+		err := children(data, func(id uint32, data []byte) error {
+			switch id {
+			case idTrackNumber:
+				t.Number = readUint(data)
+			case idCodecID:
+				t.Codec = codecOf(string(data))
+			case idCodecPrivate:
+				t.CodecPrivate = data
+			case idVideo:
+				return children(data, func(id uint32, data []byte) error {
+					switch id {
+					case idPixelWidth:
+						t.Width = int(readUint(data))
+					case idPixelHeight:
+						t.Height = int(readUint(data))
+					}
+					return nil
+				})
+			case idAudio:
+				return children(data, func(id uint32, data []byte) error {
+					switch id {
+					case idSampling:
+						t.SampleRate = uint32(readFloat(data))
+					case idChannels:
+						t.Channels = uint8(readUint(data))
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// tracks of other codecs are skipped
+		if t.Codec != deliver.CodecTypeNone {
+			mr.tracks = append(mr.tracks, t)
+		}
+
+		return nil
+	})
+}
+
+func codecOf(codecID string) deliver.CodecType {
+	for _, codec := range []deliver.CodecType{
+		deliver.CodecTypeH264,
+		deliver.CodecTypeVP8,
+		deliver.CodecTypeVP9,
+		deliver.CodecTypeAV1,
+		deliver.CodecTypeOpus,
+	} {
+		if CodecID(codec) == codecID {
+			return codec
+		}
+	}
+
+	return deliver.CodecTypeNone
+}
+
+// SeekCluster continues reading at the cluster at offset, the Cluster of a frame
+// read before. The source must be an io.Seeker.
+func (mr *Reader) SeekCluster(offset int64) error {
+	seeker, ok := mr.src.(io.Seeker)
+	if !ok {
+		return ErrNotSeekable
+	}
+
+	if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	mr.r.r.Reset(mr.src)
+	mr.r.pos = offset
+	mr.cluster, mr.clusterOffset = 0, offset
+
+	return nil
+}
+
+// ReadFrame returns the next frame, io.EOF at the end of the file. Laced
+// blocks and blocks of tracks not supported are skipped.
+func (mr *Reader) ReadFrame() (Frame, error) {
+	for {
+		start := mr.r.pos
+		id, size, unknown, err := mr.r.header()
+		if err != nil {
+			return Frame{}, err
+		}
+
+		switch id {
+		case idSegment:
+			// children follow
+		case idCluster:
+			mr.clusterOffset = start
+		case idClusterTime:
+			data, err := mr.r.data(size)
+			if err != nil {
+				return Frame{}, err
+			}
+			mr.cluster = int64(readUint(data))
+		case idSimpleBlock:
+			data, err := mr.r.data(size)
+			if err != nil {
+				return Frame{}, err
+			}
+			if frame, ok := mr.parseBlock(data, true, false); ok {
+				return frame, nil
+			}
+		case idBlockGroup:
+			data, err := mr.r.data(size)
+			if err != nil {
+				return Frame{}, err
+			}
+
+			var block []byte
+			keyframe := true
+			err = children(data, func(id uint32, data []byte) error {
+				switch id {
+				case idBlock:
+					block = data
+				case idReferenceBlock:
+					keyframe = false
+				}
+				return nil
+			})
+			if err != nil {
+				return Frame{}, err
+			}
+			if frame, ok := mr.parseBlock(block, false, keyframe); ok {
+				return frame, nil
+			}
+		default:
+			if unknown {
+				return Frame{}, ErrInvalidElement
+			}
+			if err := mr.r.skip(size); err != nil {
+				return Frame{}, err
+			}
+		}
+	}
+}
+
+// parseBlock parses a simple block, whose flags tell keyframes, or the block
+// of a block group.
+func (mr *Reader) parseBlock(data []byte, simple, keyframe bool) (Frame, bool) {
+	number, n, _, err := parseVint(data, false)
+	if err != nil || len(data) < n+3 {
+		return Frame{}, false
+	}
+
+	offset := int16(uint16(data[n])<<8 | uint16(data[n+1]))
+	flags := data[n+2]
+	if flags&0x06 != 0 {
+		return Frame{}, false
+	}
+
+	frame := Frame{
+		Track:    -1,
+		Keyframe: keyframe,
+		Data:     data[n+3:],
+		Cluster:  mr.clusterOffset,
+	}
+	if simple {
+		frame.Keyframe = flags&0x80 != 0
+	}
+
+	for i, t := range mr.tracks {
+		if t.Number == number {
+			frame.Track = i
+			break
+		}
+	}
+	if frame.Track < 0 {
+		return Frame{}, false
+	}
+
+	ticks := (mr.cluster + int64(offset)) * int64(mr.scale)
+	frame.Timestamp = time.Duration(ticks)
+
+	return frame, true
+}
@@ -0,0 +1,346 @@
+package mkv
+
+import (
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/record/av1"
+	"github.com/pingostack/neon/pkg/record/avc"
+)
+
+const (
+	// timestamps of blocks are in milliseconds
+	timestampScale = 1_000_000
+	// blocks of all tracks are written in timestamp order, a block waits
+	// until the other tracks are this far ahead
+	interleaveMs = 500
+	// block timestamps are 16 bit offsets to their cluster
+	maxClusterMs = 5000
+
+	opusPreSkip     = 312
+	opusSeekPreRoll = 80_000_000
+)
+
+// Track describes a track of the file.
+type Track struct {
+	Codec      deliver.CodecType
+	Timescale  uint32
+	SampleRate uint32
+	Channels   uint8
+	Width      int
+	Height     int
+	// Keyframe is the first keyframe of a video track, h264 takes its
+	// parameter sets and av1 its sequence header from it.
+	Keyframe []byte
+}
+
+// Sample is a frame of a track, DTS in the timescale of the track.
+type Sample struct {
+	DTS int64
+	// CTS is the composition offset, the presentation timestamp less DTS.
+	CTS      uint32
+	Keyframe bool
+	Data     []byte
+}
+
+type block struct {
+	track int
+	ms    int64
+	// pts is the time of the block, blocks are ordered by ms, their
+	// decoding time
+	pts      int64
+	keyframe bool
+	data     []byte
+}
+
+// Writer writes a live Matroska file, segment and clusters of unknown size
+// and without cues. Files of vp8, vp9, av1 and opus only are WebM.
+type Writer struct {
+	lock      sync.Mutex
+	w         io.Writer
+	tracks    []Track
+	queue     []block
+	lastMs    []int64
+	started   []bool
+	newest    int64
+	cluster   int64
+	inCluster bool
+	closed    bool
+}
+
+// CodecID is the matroska codec of codec, empty if not supported.
+func CodecID(codec deliver.CodecType) string {
+	switch codec {
+	case deliver.CodecTypeH264:
+		return "V_MPEG4/ISO/AVC"
+	case deliver.CodecTypeVP8:
+		return "V_VP8"
+	case deliver.CodecTypeVP9:
+		return "V_VP9"
+	case deliver.CodecTypeAV1:
+		return "V_AV1"
+	case deliver.CodecTypeOpus:
+		return "A_OPUS"
+	}
+
+	return ""
+}
+
+// IsWebM tells whether a file of codecs is WebM.
+func IsWebM(codecs ...deliver.CodecType) bool {
+	for _, codec := range codecs {
+		switch codec {
+		case deliver.CodecTypeVP8, deliver.CodecTypeVP9, deliver.CodecTypeAV1, deliver.CodecTypeOpus:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func NewWriter(w io.Writer, tracks []Track) (*Writer, error) {
+	if len(tracks) == 0 {
+		return nil, ErrInvalidTrack
+	}
+
+	mw := &Writer{
+		w:       w,
+		tracks:  tracks,
+		lastMs:  make([]int64, len(tracks)),
+		started: make([]bool, len(tracks)),
+	}
+
+	codecs := make([]deliver.CodecType, len(tracks))
+	for i, t := range tracks {
+		if CodecID(t.Codec) == "" {
+			return nil, ErrUnsupportedCodec
+		}
+		if t.Timescale == 0 {
+			return nil, ErrInvalidTrack
+		}
+		codecs[i] = t.Codec
+	}
+
+	docType := "matroska"
+	if IsWebM(codecs...) {
+		docType = "webm"
+	}
+
+	e := &element{}
+	e.begin(idEBML)
+	e.uint(idEBMLVersion, 1)
+	e.uint(idEBMLReadVersion, 1)
+	e.uint(idEBMLMaxIDLength, 4)
+	e.uint(idEBMLMaxSizeLength, 8)
+	e.string(idDocType, docType)
+	e.uint(idDocTypeVersion, 4)
+	e.uint(idDocTypeReadVersion, 2)
+	e.end()
+
+	e.beginUnknown(idSegment)
+
+	e.begin(idInfo)
+	e.uint(idTimestampScale, timestampScale)
+	e.string(idMuxingApp, "neon")
+	e.string(idWritingApp, "neon")
+	e.end()
+
+	e.begin(idTracks)
+	for i, t := range tracks {
+		if err := mw.trackEntry(e, i, t); err != nil {
+			return nil, err
+		}
+	}
+	e.end()
+
+	if _, err := w.Write(e.buf); err != nil {
+		return nil, err
+	}
+
+	return mw, nil
+}
+
+func (mw *Writer) trackEntry(e *element, i int, t Track) error {
+	e.begin(idTrackEntry)
+	e.uint(idTrackNumber, uint64(i+1))
+	e.uint(idTrackUID, uint64(i+1))
+	e.uint(idFlagLacing, 0)
+	e.string(idCodecID, CodecID(t.Codec))
+
+	switch t.Codec {
+	case deliver.CodecTypeH264:
+		sps, pps := avc.ParameterSets(t.Keyframe)
+		if sps == nil || pps == nil {
+			return ErrNoParameterSets
+		}
+		e.bytes(idCodecPrivate, avc.DecoderConfig(sps, pps))
+		if width, height, err := avc.SPSSize(sps); err == nil {
+			t.Width, t.Height = width, height
+		}
+	case deliver.CodecTypeAV1:
+		obu := av1.SequenceHeader(t.Keyframe)
+		if obu == nil {
+			return ErrNoParameterSets
+		}
+		config, err := av1.DecoderConfig(obu)
+		if err != nil {
+			return err
+		}
+		e.bytes(idCodecPrivate, config)
+		if info, err := av1.ParseSequenceHeader(obu); err == nil {
+			t.Width, t.Height = info.Width, info.Height
+		}
+	case deliver.CodecTypeOpus:
+		if t.Channels == 0 {
+			t.Channels = 2
+		}
+		e.bytes(idCodecPrivate, opusHead(t.Channels))
+		e.uint(idCodecDelay, uint64(opusPreSkip)*1_000_000_000/48000)
+		e.uint(idSeekPreRoll, opusSeekPreRoll)
+	}
+
+	if t.Codec.IsVideo() {
+		e.uint(idTrackType, trackTypeVideo)
+		e.begin(idVideo)
+		e.uint(idPixelWidth, uint64(t.Width))
+		e.uint(idPixelHeight, uint64(t.Height))
+		e.end()
+	} else {
+		rate := t.SampleRate
+		if rate == 0 {
+			rate = t.Timescale
+		}
+		e.uint(idTrackType, trackTypeAudio)
+		e.begin(idAudio)
+		e.float(idSampling, float64(rate))
+		e.uint(idChannels, uint64(t.Channels))
+		e.end()
+	}
+
+	e.end()
+
+	return nil
+}
+
+// opusHead is the identification header of the opus stream.
+func opusHead(channels uint8) []byte {
+	head := []byte("OpusHead")
+	head = append(head, 1, channels)
+	head = append(head, byte(opusPreSkip&0xff), byte(opusPreSkip>>8))
+	// input sample rate, output gain and the channel mapping family
+	head = append(head, 0x80, 0xbb, 0, 0)
+	head = append(head, 0, 0)
+
+	return append(head, 0)
+}
+
+// WriteSample queues a sample of track, the index of the track passed to
+// NewWriter.
+func (mw *Writer) WriteSample(track int, s Sample) error {
+	mw.lock.Lock()
+	defer mw.lock.Unlock()
+
+	if mw.closed {
+		return ErrWriterClosed
+	}
+
+	if track < 0 || track >= len(mw.tracks) {
+		return ErrInvalidTrack
+	}
+
+	t := mw.tracks[track]
+	if t.Codec == deliver.CodecTypeH264 {
+		s.Data = avc.ToAVCC(s.Data)
+	}
+
+	if len(s.Data) == 0 {
+		return nil
+	}
+
+	ms := s.DTS * 1000 / int64(t.Timescale)
+	if ms < 0 {
+		ms = 0
+	}
+	if mw.started[track] && ms < mw.lastMs[track] {
+		ms = mw.lastMs[track]
+	}
+	mw.started[track], mw.lastMs[track] = true, ms
+
+	pts := (s.DTS + int64(s.CTS)) * 1000 / int64(t.Timescale)
+	if pts < ms {
+		pts = ms
+	}
+
+	b := block{track: track, ms: ms, pts: pts, keyframe: s.Keyframe || !t.Codec.IsVideo(), data: s.Data}
+	i := sort.Search(len(mw.queue), func(i int) bool {
+		return mw.queue[i].ms > ms
+	})
+	mw.queue = append(mw.queue, block{})
+	copy(mw.queue[i+1:], mw.queue[i:])
+	mw.queue[i] = b
+
+	if ms > mw.newest {
+		mw.newest = ms
+	}
+
+	for len(mw.queue) > 0 && mw.queue[0].ms <= mw.newest-interleaveMs {
+		if err := mw.writeBlock(mw.queue[0]); err != nil {
+			return err
+		}
+		mw.queue = mw.queue[1:]
+	}
+
+	return nil
+}
+
+func (mw *Writer) writeBlock(b block) error {
+	e := &element{}
+
+	video := mw.tracks[b.track].Codec.IsVideo()
+	if !mw.inCluster || b.ms-mw.cluster >= maxClusterMs || b.ms < mw.cluster ||
+		video && b.keyframe && b.ms != mw.cluster {
+		// clusters start with video keyframes, seeking lands on them
+		e.beginUnknown(idCluster)
+		e.uint(idClusterTime, uint64(b.ms))
+		mw.inCluster, mw.cluster = true, b.ms
+	}
+
+	flags := byte(0)
+	if b.keyframe {
+		flags |= 0x80
+	}
+
+	data := appendVint(nil, uint64(b.track+1))
+	offset := uint16(int16(b.pts - mw.cluster))
+	data = append(data, byte(offset>>8), byte(offset))
+	data = append(data, flags)
+	data = append(data, b.data...)
+	e.bytes(idSimpleBlock, data)
+
+	_, err := mw.w.Write(e.buf)
+
+	return err
+}
+
+// Close writes the queued samples, it does not close the underlying writer.
+func (mw *Writer) Close() error {
+	mw.lock.Lock()
+	defer mw.lock.Unlock()
+
+	if mw.closed {
+		return nil
+	}
+	mw.closed = true
+
+	for _, b := range mw.queue {
+		if err := mw.writeBlock(b); err != nil {
+			return err
+		}
+	}
+	mw.queue = nil
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package motion
+
+import (
+	"sync"
+
+	"github.com/pingostack/neon/pkg/deliver"
+)
+
+const (
+	defaultLumaThreshold = 0.02
+	// pictures are compared in blocks of a grid this size
+	gridWidth  = 32
+	gridHeight = 18
+	// blocks whose mean luma changed less are noise
+	blockDelta = 12
+)
+
+// Decoder decodes the frames of a video codec, a frame may not give a
+// picture yet.
+type Decoder interface {
+	// Decode returns the luma plane of the picture of frame, nil when the
+	// decoder needs more frames.
+	Decode(frame deliver.Frame) (luma []byte, width, height, stride int, err error)
+	Close()
+}
+
+var (
+	decoders     = make(map[deliver.CodecType]func() (Decoder, error))
+	decodersLock sync.RWMutex
+)
+
+// RegisterDecoder makes the luma detector available for codec, e.g. from a
+// build with a video decoding library.
+func RegisterDecoder(codec deliver.CodecType, newDecoder func() (Decoder, error)) {
+	decodersLock.Lock()
+	defer decodersLock.Unlock()
+
+	decoders[codec] = newDecoder
+}
+
+// lumaDetector compares the mean luma of the blocks of a grid over the
+// pictures, motion is a share of the blocks changing.
+type lumaDetector struct {
+	decoder   Decoder
+	threshold float64
+	last      []int
+}
+
+func newLumaDetector(codec deliver.CodecType, threshold float64) (*lumaDetector, error) {
+	decodersLock.RLock()
+	newDecoder := decoders[codec]
+	decodersLock.RUnlock()
+
+	if newDecoder == nil {
+		return nil, ErrNoDecoder
+	}
+
+	decoder, err := newDecoder()
+	if err != nil {
+		return nil, err
+	}
+
+	if threshold <= 0 {
+		threshold = defaultLumaThreshold
+	}
+
+	return &lumaDetector{decoder: decoder, threshold: threshold}, nil
+}
+
+func (d *lumaDetector) Detect(frame deliver.Frame) bool {
+	luma, width, height, stride, err := d.decoder.Decode(frame)
+	if err != nil || width < gridWidth || height < gridHeight || len(luma) < (height-1)*stride+width {
+		return false
+	}
+
+	grid := meanGrid(luma, width, height, stride)
+	last := d.last
+	d.last = grid
+	if last == nil {
+		return false
+	}
+
+	changed := 0
+	for i := range grid {
+		if delta := grid[i] - last[i]; delta > blockDelta || delta < -blockDelta {
+			changed++
+		}
+	}
+
+	return float64(changed)/float64(len(grid)) > d.threshold
+}
+
+// meanGrid is the mean luma of the blocks of the picture, row by row.
+func meanGrid(luma []byte, width, height, stride int) []int {
+	grid := make([]int, gridWidth*gridHeight)
+	bw, bh := width/gridWidth, height/gridHeight
+
+	for gy := 0; gy < gridHeight; gy++ {
+		for gx := 0; gx < gridWidth; gx++ {
+			sum := 0
+			for y := gy * bh; y < (gy+1)*bh; y++ {
+				row := luma[y*stride+gx*bw : y*stride+(gx+1)*bw]
+				for _, v := range row {
+					sum += int(v)
+				}
+			}
+			grid[gy*gridWidth+gx] = sum / (bw * bh)
+		}
+	}
+
+	return grid
+}
+
+func (d *lumaDetector) Close() {
+	d.decoder.Close()
+}
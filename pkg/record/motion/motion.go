@@ -0,0 +1,61 @@
+// Package motion tells when the video of a stream shows motion, for
+// recordings of surveillance cameras that only keep what happens. The size
+// detector works on the encoded frames and costs next to nothing, the luma
+// detector compares decoded pictures and needs a decoder registered for the
+// codec.
+package motion
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pingostack/neon/pkg/deliver"
+)
+
+var (
+	ErrUnknownDetector = errors.New("unknown motion detector")
+	ErrNoDecoder       = errors.New("no video decoder for the luma detector")
+)
+
+const (
+	DetectorSize = "size"
+	DetectorLuma = "luma"
+)
+
+// Detector takes the raw video frames of a stream in order.
+type Detector interface {
+	// Detect tells whether frame shows motion.
+	Detect(frame deliver.Frame) bool
+	Close()
+}
+
+type Options struct {
+	// Threshold is how much has to change to be motion, the default of the
+	// detector when 0: the growth of the frame sizes for size, 1 is twice
+	// the usual, the share of the picture for luma.
+	Threshold float64
+}
+
+// New returns the detector name for the video of md, size when empty.
+func New(name string, md *deliver.Metadata, opts Options) (Detector, error) {
+	if !md.HasVideo() {
+		return nil, fmt.Errorf("%w: stream without video", ErrUnknownDetector)
+	}
+
+	switch name {
+	case "", DetectorSize:
+		return newSizeDetector(md.Video.FPS, opts.Threshold), nil
+	case DetectorLuma:
+		return newLumaDetector(md.Video.CodecType, opts.Threshold)
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownDetector, name)
+}
+
+func isKeyframe(frame deliver.Frame) bool {
+	if info, ok := frame.AdditionalInfo.(*deliver.VideoFrameSpecificInfo); ok {
+		return info.IsKeyFrame
+	}
+
+	return false
+}
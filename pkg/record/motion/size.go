@@ -0,0 +1,72 @@
+package motion
+
+import (
+	"math"
+
+	"github.com/pingostack/neon/pkg/deliver"
+)
+
+const (
+	defaultSizeThreshold = 1.0
+	// frames to learn the usual size from before motion is told
+	defaultWarmup = 50
+	// the usual size follows the frames this slowly, a scene moving all the
+	// time becomes the usual after a while
+	sizeSmoothing = 1.0 / 256
+)
+
+// sizeDetector reads motion off the sizes of the encoded frames, inter
+// frames grow with what changes between pictures and keyframes with what
+// the picture shows.
+type sizeDetector struct {
+	threshold float64
+	warmup    int
+	frames    int
+	usual     float64
+	keyframe  int
+}
+
+func newSizeDetector(fps int, threshold float64) *sizeDetector {
+	if threshold <= 0 {
+		threshold = defaultSizeThreshold
+	}
+
+	warmup := defaultWarmup
+	if fps > 0 {
+		warmup = 2 * fps
+	}
+
+	return &sizeDetector{threshold: threshold, warmup: warmup}
+}
+
+func (d *sizeDetector) Detect(frame deliver.Frame) bool {
+	size := len(frame.Payload)
+	if size == 0 {
+		return false
+	}
+
+	// a scene that changed encodes into keyframes of another size, half
+	// the threshold of inter frames as they vary much less
+	if isKeyframe(frame) {
+		last := d.keyframe
+		d.keyframe = size
+		if last == 0 || d.frames < d.warmup {
+			return false
+		}
+
+		return math.Abs(float64(size-last))/float64(last) > d.threshold/2
+	}
+
+	d.frames++
+	if d.usual == 0 {
+		d.usual = float64(size)
+		return false
+	}
+
+	motion := d.frames >= d.warmup && float64(size) > d.usual*(1+d.threshold)
+	d.usual += (float64(size) - d.usual) * sizeSmoothing
+
+	return motion
+}
+
+func (d *sizeDetector) Close() {}
@@ -0,0 +1,62 @@
+package mp4
+
+import "encoding/binary"
+
+// box builds a box, children are written into its payload and the size is
+// patched when it ends.
+type box struct {
+	buf    []byte
+	starts []int
+}
+
+func (b *box) begin(typ string) {
+	b.starts = append(b.starts, len(b.buf))
+	b.buf = append(b.buf, 0, 0, 0, 0)
+	b.buf = append(b.buf, typ...)
+}
+
+// beginFull begins a full box, with version and flags.
+func (b *box) beginFull(typ string, version uint8, flags uint32) {
+	b.begin(typ)
+	b.u32(uint32(version)<<24 | flags&0xffffff)
+}
+
+func (b *box) end() {
+	start := b.starts[len(b.starts)-1]
+	b.starts = b.starts[:len(b.starts)-1]
+	binary.BigEndian.PutUint32(b.buf[start:], uint32(len(b.buf)-start))
+}
+
+func (b *box) u8(v uint8) {
+	b.buf = append(b.buf, v)
+}
+
+func (b *box) u16(v uint16) {
+	b.buf = append(b.buf, byte(v>>8), byte(v))
+}
+
+func (b *box) u32(v uint32) {
+	b.buf = append(b.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (b *box) u64(v uint64) {
+	b.u32(uint32(v >> 32))
+	b.u32(uint32(v))
+}
+
+func (b *box) bytes(v []byte) {
+	b.buf = append(b.buf, v...)
+}
+
+func (b *box) zeros(n int) {
+	for i := 0; i < n; i++ {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+// matrix is the unity transformation of mvhd and tkhd.
+func (b *box) matrix() {
+	for _, v := range []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000} {
+		b.u32(v)
+	}
+}
@@ -0,0 +1,317 @@
+package mp4
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+
+	"github.com/pingostack/neon/pkg/deliver"
+)
+
+// Scheme is the common encryption scheme of ISO/IEC 23001-7.
+type Scheme string
+
+const (
+	// SchemeCENC is aes-ctr of whole blocks, per sample ivs.
+	SchemeCENC Scheme = "cenc"
+	// SchemeCBCS is aes-cbc of one block in ten with a constant iv, what
+	// FairPlay needs and Widevine and PlayReady accept.
+	SchemeCBCS Scheme = "cbcs"
+
+	KeySize = 16
+
+	cencIVSize = 8
+	// cbcs leaves the nal header and the start of the slice header clear
+	cbcsClearLeader = 32
+	cbcsCryptBlocks = 1
+	cbcsSkipBlocks  = 9
+	// a subsample holds up to 64k of clear bytes
+	maxClearBytes = 0xffff
+)
+
+// Encryption encrypts all tracks of a file with one key.
+type Encryption struct {
+	Scheme Scheme
+	KeyID  []byte
+	Key    []byte
+	// IV is the first iv of cenc, following samples count up, and the
+	// constant iv of cbcs. Random when empty.
+	IV   []byte
+	PSSH []PSSH
+}
+
+type subsample struct {
+	clear     uint32
+	protected uint32
+}
+
+type encryptor struct {
+	Encryption
+	block cipher.Block
+	iv    uint64
+}
+
+func newEncryptor(enc Encryption) (*encryptor, error) {
+	if enc.Scheme != SchemeCENC && enc.Scheme != SchemeCBCS {
+		return nil, ErrInvalidEncryption
+	}
+
+	if len(enc.KeyID) != KeySize || len(enc.Key) != KeySize {
+		return nil, ErrInvalidEncryption
+	}
+
+	block, err := aes.NewCipher(enc.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &encryptor{Encryption: enc, block: block}
+	switch {
+	case enc.Scheme == SchemeCBCS && len(enc.IV) != KeySize:
+		e.IV = make([]byte, KeySize)
+		if _, err := rand.Read(e.IV); err != nil {
+			return nil, err
+		}
+	case enc.Scheme == SchemeCENC && len(enc.IV) >= cencIVSize:
+		e.iv = binary.BigEndian.Uint64(enc.IV)
+	case enc.Scheme == SchemeCENC:
+		iv := make([]byte, cencIVSize)
+		if _, err := rand.Read(iv); err != nil {
+			return nil, err
+		}
+		e.iv = binary.BigEndian.Uint64(iv)
+	}
+
+	return e, nil
+}
+
+// ivSize is the size of the per sample iv.
+func (e *encryptor) ivSize() int {
+	if e.Scheme == SchemeCENC {
+		return cencIVSize
+	}
+
+	return 0
+}
+
+// encrypt encrypts a sample in place, h264 in avcc.
+func (e *encryptor) encrypt(codec deliver.CodecType, s *Sample) {
+	if e.Scheme == SchemeCENC {
+		s.iv = make([]byte, cencIVSize)
+		binary.BigEndian.PutUint64(s.iv, e.iv)
+		e.iv++
+	}
+
+	if codec.IsVideo() {
+		s.subsamples = e.subsamples(s.Data)
+	}
+
+	regions := [][]byte{s.Data}
+	if s.subsamples != nil {
+		regions = regions[:0]
+		off := uint32(0)
+		for _, sub := range s.subsamples {
+			off += sub.clear
+			regions = append(regions, s.Data[off:off+sub.protected])
+			off += sub.protected
+		}
+	}
+
+	switch e.Scheme {
+	case SchemeCENC:
+		// the counter runs on over the subsamples of a sample
+		counter := make([]byte, KeySize)
+		copy(counter, s.iv)
+		stream := cipher.NewCTR(e.block, counter)
+		for _, r := range regions {
+			stream.XORKeyStream(r, r)
+		}
+	case SchemeCBCS:
+		crypt, skip := cbcsCryptBlocks, cbcsSkipBlocks
+		if !codec.IsVideo() {
+			crypt, skip = 1, 0
+		}
+		for _, r := range regions {
+			mode := cipher.NewCBCEncrypter(e.block, e.IV)
+			for i := 0; i+KeySize*crypt <= len(r); i += KeySize * (crypt + skip) {
+				mode.CryptBlocks(r[i:i+KeySize*crypt], r[i:i+KeySize*crypt])
+			}
+		}
+	}
+}
+
+// subsamples splits avcc into clear and protected ranges, the length and
+// header of every nal unit and the parameter sets are clear.
+func (e *encryptor) subsamples(data []byte) []subsample {
+	var subs []subsample
+	clear := uint32(0)
+	add := func(s subsample) {
+		for s.clear > maxClearBytes {
+			subs = append(subs, subsample{clear: maxClearBytes})
+			s.clear -= maxClearBytes
+		}
+		subs = append(subs, s)
+	}
+
+	for off := 0; off+4 < len(data); {
+		n := int(binary.BigEndian.Uint32(data[off:]))
+		if n == 0 || off+4+n > len(data) {
+			clear += uint32(len(data) - off)
+			break
+		}
+
+		total := uint32(4 + n)
+		protected := uint32(0)
+		if typ := data[off+4] & 0x1f; typ >= 1 && typ <= 5 {
+			if e.Scheme == SchemeCENC {
+				// whole blocks after the header
+				protected = uint32(n-1) / KeySize * KeySize
+			} else if n > cbcsClearLeader {
+				protected = uint32(n - cbcsClearLeader)
+			}
+		}
+
+		if protected == 0 {
+			clear += total
+		} else {
+			add(subsample{clear: clear + total - protected, protected: protected})
+			clear = 0
+		}
+		off += 4 + n
+	}
+
+	if clear > 0 || len(subs) == 0 {
+		add(subsample{clear: clear})
+	}
+
+	return subs
+}
+
+// auxSize is the size of the auxiliary information of a sample in senc.
+func (e *encryptor) auxSize(s Sample) int {
+	size := len(s.iv)
+	if s.subsamples != nil {
+		size += 2 + 6*len(s.subsamples)
+	}
+
+	return size
+}
+
+// sinf follows the codec configuration of an encv or enca sample entry.
+func (e *encryptor) sinf(b *box, format string, video bool) {
+	b.begin("sinf")
+
+	b.begin("frma")
+	b.bytes([]byte(format))
+	b.end()
+
+	b.beginFull("schm", 0, 0)
+	b.bytes([]byte(e.Scheme))
+	b.u32(0x00010000)
+	b.end()
+
+	b.begin("schi")
+	if e.Scheme == SchemeCENC {
+		b.beginFull("tenc", 0, 0)
+		b.u8(0)
+		b.u8(0)
+		b.u8(1) // protected
+		b.u8(cencIVSize)
+		b.bytes(e.KeyID)
+	} else {
+		b.beginFull("tenc", 1, 0)
+		b.u8(0)
+		if video {
+			b.u8(cbcsCryptBlocks<<4 | cbcsSkipBlocks)
+		} else {
+			b.u8(0)
+		}
+		b.u8(1) // protected
+		b.u8(0) // constant iv
+		b.bytes(e.KeyID)
+		b.u8(KeySize)
+		b.bytes(e.IV)
+	}
+	b.end()
+	b.end()
+
+	b.end()
+}
+
+func (e *encryptor) pssh(b *box) {
+	for _, p := range e.PSSH {
+		version := uint8(0)
+		if len(p.KeyIDs) > 0 {
+			version = 1
+		}
+
+		b.beginFull("pssh", version, 0)
+		b.bytes(p.SystemID[:])
+		if version == 1 {
+			b.u32(uint32(len(p.KeyIDs)))
+			for _, kid := range p.KeyIDs {
+				b.bytes(kid)
+			}
+		}
+		b.u32(uint32(len(p.Data)))
+		b.bytes(p.Data)
+		b.end()
+	}
+}
+
+// senc writes the ivs and subsamples of a run, saiz and saio point to them.
+// It returns where the first sample's information starts in b.
+func (e *encryptor) senc(b *box, samples []Sample, video bool) uint32 {
+	flags := uint32(0)
+	if video {
+		// subsamples
+		flags = 0x2
+	}
+
+	b.beginFull("senc", 0, flags)
+	b.u32(uint32(len(samples)))
+	at := uint32(len(b.buf))
+	for _, s := range samples {
+		b.bytes(s.iv)
+		if video {
+			b.u16(uint16(len(s.subsamples)))
+			for _, sub := range s.subsamples {
+				b.u16(uint16(sub.clear))
+				b.u32(sub.protected)
+			}
+		}
+	}
+	b.end()
+
+	return at
+}
+
+func (e *encryptor) saiz(b *box, samples []Sample) {
+	b.beginFull("saiz", 0, 0)
+
+	size := e.auxSize(samples[0])
+	for _, s := range samples[1:] {
+		if e.auxSize(s) != size {
+			size = 0
+			break
+		}
+	}
+
+	b.u8(uint8(size))
+	b.u32(uint32(len(samples)))
+	if size == 0 {
+		for _, s := range samples {
+			b.u8(uint8(e.auxSize(s)))
+		}
+	}
+	b.end()
+}
+
+// saio points to the information in senc, relative to the moof.
+func (e *encryptor) saio(b *box, offset uint32) {
+	b.beginFull("saio", 0, 0)
+	b.u32(1)
+	b.u32(offset)
+	b.end()
+}
@@ -0,0 +1,11 @@
+package mp4
+
+import "errors"
+
+var (
+	ErrUnsupportedCodec  = errors.New("codec not supported by mp4")
+	ErrNoParameterSets   = errors.New("keyframe without sps and pps")
+	ErrInvalidTrack      = errors.New("invalid track")
+	ErrWriterClosed      = errors.New("mp4 writer closed")
+	ErrInvalidEncryption = errors.New("invalid mp4 encryption")
+)
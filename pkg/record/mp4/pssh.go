@@ -0,0 +1,100 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"unicode/utf16"
+)
+
+// PSSH signals a drm system in the moov, players ask its license server for
+// the key of KeyIDs.
+type PSSH struct {
+	SystemID [16]byte
+	KeyIDs   [][]byte
+	Data     []byte
+}
+
+var (
+	// SystemCommon is the W3C common pssh, clear key players read it.
+	SystemCommon    = [16]byte{0x10, 0x77, 0xef, 0xec, 0xc0, 0xb2, 0x4d, 0x02, 0xac, 0xe3, 0x3c, 0x1e, 0x52, 0xe2, 0xfb, 0x4b}
+	SystemWidevine  = [16]byte{0xed, 0xef, 0x8b, 0xa9, 0x79, 0xd6, 0x4a, 0xce, 0xa3, 0xc8, 0x27, 0xdc, 0xd5, 0x1d, 0x21, 0xed}
+	SystemPlayReady = [16]byte{0x9a, 0x04, 0xf0, 0x79, 0x98, 0x40, 0x42, 0x86, 0xab, 0x92, 0xe6, 0x5b, 0xe0, 0x88, 0x5f, 0x95}
+	SystemFairPlay  = [16]byte{0x94, 0xce, 0x86, 0xfb, 0x07, 0xff, 0x4f, 0x43, 0xad, 0xb8, 0x93, 0xd2, 0xfa, 0x96, 0x8c, 0xa2}
+)
+
+func CommonPSSH(kid []byte) PSSH {
+	return PSSH{SystemID: SystemCommon, KeyIDs: [][]byte{kid}}
+}
+
+// WidevinePSSH carries the WidevinePsshData protobuf with the key id and
+// the scheme.
+func WidevinePSSH(scheme Scheme, kid []byte) PSSH {
+	var data []byte
+	// key_id = 2
+	data = append(data, 0x12, byte(len(kid)))
+	data = append(data, kid...)
+	// protection_scheme = 9, the fourcc as varint
+	data = append(data, 0x48)
+	for v := binary.BigEndian.Uint32([]byte(scheme)); ; v >>= 7 {
+		if v < 0x80 {
+			data = append(data, byte(v))
+			break
+		}
+		data = append(data, byte(v)|0x80)
+	}
+
+	return PSSH{SystemID: SystemWidevine, Data: data}
+}
+
+// PlayReadyPSSH carries a PlayReady object with the header of the key id,
+// version 4.3 for cbcs. laURL is the license server, players use their
+// configured one when empty.
+func PlayReadyPSSH(scheme Scheme, kid []byte, laURL string) PSSH {
+	// the guid of the key id is little endian
+	guid := append([]byte(nil), kid...)
+	guid[0], guid[1], guid[2], guid[3] = guid[3], guid[2], guid[1], guid[0]
+	guid[4], guid[5] = guid[5], guid[4]
+	guid[6], guid[7] = guid[7], guid[6]
+	id := base64.StdEncoding.EncodeToString(guid)
+
+	var url bytes.Buffer
+	if laURL != "" {
+		url.WriteString("<LA_URL>")
+		xml.EscapeText(&url, []byte(laURL))
+		url.WriteString("</LA_URL>")
+	}
+
+	var header string
+	if scheme == SchemeCBCS {
+		header = `<WRMHEADER xmlns="http://schemas.microsoft.com/DRM/2007/03/PlayReadyHeader" version="4.3.0.0"><DATA>` +
+			`<PROTECTINFO><KIDS><KID ALGID="AESCBC" VALUE="` + id + `"></KID></KIDS></PROTECTINFO>` +
+			url.String() + `</DATA></WRMHEADER>`
+	} else {
+		header = `<WRMHEADER xmlns="http://schemas.microsoft.com/DRM/2007/03/PlayReadyHeader" version="4.0.0.0"><DATA>` +
+			`<PROTECTINFO><KEYLEN>16</KEYLEN><ALGID>AESCTR</ALGID></PROTECTINFO><KID>` + id + `</KID>` +
+			url.String() + `</DATA></WRMHEADER>`
+	}
+
+	var record []byte
+	for _, c := range utf16.Encode([]rune(header)) {
+		record = append(record, byte(c), byte(c>>8))
+	}
+
+	// length, record count, then the rights management header record
+	data := make([]byte, 10, 10+len(record))
+	binary.LittleEndian.PutUint32(data, uint32(10+len(record)))
+	binary.LittleEndian.PutUint16(data[4:], 1)
+	binary.LittleEndian.PutUint16(data[6:], 1)
+	binary.LittleEndian.PutUint16(data[8:], uint16(len(record)))
+	data = append(data, record...)
+
+	return PSSH{SystemID: SystemPlayReady, KeyIDs: [][]byte{kid}, Data: data}
+}
+
+// FairPlayPSSH only names the key, FairPlay players get the key uri from
+// the playlist.
+func FairPlayPSSH(kid []byte) PSSH {
+	return PSSH{SystemID: SystemFairPlay, KeyIDs: [][]byte{kid}}
+}
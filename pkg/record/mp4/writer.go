@@ -0,0 +1,545 @@
+package mp4
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/record/avc"
+)
+
+const (
+	movieTimescale = 1000
+	// a fragment is written about every second by default, the file is
+	// playable up to the last fragment if the server stops
+	defaultFragmentDuration = time.Second
+	// opus encoders delay their output by 6.5ms
+	opusPreSkip = 312
+
+	sampleFlagsSync    = 0x02000000
+	sampleFlagsNonSync = 0x01010000
+)
+
+// Track describes a track of the file.
+type Track struct {
+	Codec     deliver.CodecType
+	Timescale uint32
+	Channels  uint8
+	Width     int
+	Height    int
+	// Keyframe is the first keyframe of a video track, h264 takes its
+	// parameter sets from it.
+	Keyframe []byte
+}
+
+// Sample is a frame of a track, DTS in the timescale of the track. Samples
+// of a track must be written in decoding order.
+type Sample struct {
+	DTS int64
+	// CTS is the composition offset, the presentation timestamp less DTS.
+	CTS      uint32
+	Keyframe bool
+	Data     []byte
+
+	iv         []byte
+	subsamples []subsample
+}
+
+type trackWriter struct {
+	Track
+	id      uint32
+	sps     []byte
+	pps     []byte
+	samples []Sample
+	lastDTS int64
+	lastDur uint32
+	started bool
+}
+
+// Writer writes a fragmented mp4, the moov precedes fragments of all tracks
+// of about a second.
+type Writer struct {
+	lock     sync.Mutex
+	w        io.Writer
+	tracks   []*trackWriter
+	sequence uint32
+	closed   bool
+	enc      *encryptor
+	fragment time.Duration
+}
+
+func NewWriter(w io.Writer, tracks []Track) (*Writer, error) {
+	return newWriter(w, tracks, nil)
+}
+
+// NewEncryptedWriter writes a file of common encryption, the pssh boxes of
+// enc are written into the moov.
+func NewEncryptedWriter(w io.Writer, tracks []Track, enc Encryption) (*Writer, error) {
+	e, err := newEncryptor(enc)
+	if err != nil {
+		return nil, err
+	}
+
+	return newWriter(w, tracks, e)
+}
+
+func newWriter(w io.Writer, tracks []Track, enc *encryptor) (*Writer, error) {
+	if len(tracks) == 0 {
+		return nil, ErrInvalidTrack
+	}
+
+	mw := &Writer{w: w, enc: enc, fragment: defaultFragmentDuration}
+	for i, t := range tracks {
+		tw := &trackWriter{Track: t, id: uint32(i + 1)}
+
+		switch t.Codec {
+		case deliver.CodecTypeH264:
+			tw.sps, tw.pps = avc.ParameterSets(t.Keyframe)
+			if tw.sps == nil || tw.pps == nil {
+				return nil, ErrNoParameterSets
+			}
+			if width, height, err := avc.SPSSize(tw.sps); err == nil {
+				tw.Width, tw.Height = width, height
+			}
+		case deliver.CodecTypeOpus:
+			if tw.Channels == 0 {
+				tw.Channels = 2
+			}
+		default:
+			return nil, ErrUnsupportedCodec
+		}
+
+		if tw.Timescale == 0 {
+			return nil, ErrInvalidTrack
+		}
+
+		mw.tracks = append(mw.tracks, tw)
+	}
+
+	b := &box{}
+	mw.ftyp(b)
+	mw.moov(b)
+	if _, err := w.Write(b.buf); err != nil {
+		return nil, err
+	}
+
+	return mw, nil
+}
+
+// SetFragmentDuration sets how much of each track a fragment holds, live
+// players want less than the default second.
+func (mw *Writer) SetFragmentDuration(d time.Duration) {
+	mw.lock.Lock()
+	defer mw.lock.Unlock()
+
+	if d > 0 {
+		mw.fragment = d
+	}
+}
+
+// WriteSample queues a sample of track, the index of the track passed to
+// NewWriter.
+func (mw *Writer) WriteSample(track int, s Sample) error {
+	mw.lock.Lock()
+	defer mw.lock.Unlock()
+
+	if mw.closed {
+		return ErrWriterClosed
+	}
+
+	if track < 0 || track >= len(mw.tracks) {
+		return ErrInvalidTrack
+	}
+
+	tw := mw.tracks[track]
+	if tw.Codec == deliver.CodecTypeH264 {
+		s.Data = avc.ToAVCC(s.Data)
+	}
+
+	if len(s.Data) == 0 {
+		return nil
+	}
+
+	if mw.enc != nil {
+		s.Data = append([]byte(nil), s.Data...)
+		mw.enc.encrypt(tw.Codec, &s)
+	}
+
+	pts := s.DTS + int64(s.CTS)
+	if tw.started && s.DTS <= tw.lastDTS {
+		s.DTS = tw.lastDTS + 1
+	}
+	if s.DTS < 0 {
+		s.DTS = 0
+	}
+	s.CTS = 0
+	if pts > s.DTS {
+		s.CTS = uint32(pts - s.DTS)
+	}
+	tw.started, tw.lastDTS = true, s.DTS
+	tw.samples = append(tw.samples, s)
+
+	if n := len(tw.samples); tw.samples[n-1].DTS-tw.samples[0].DTS >= int64(tw.Timescale)*int64(mw.fragment)/int64(time.Second) {
+		return mw.flush(false)
+	}
+
+	return nil
+}
+
+// Close writes the queued samples, it does not close the underlying writer.
+func (mw *Writer) Close() error {
+	mw.lock.Lock()
+	defer mw.lock.Unlock()
+
+	if mw.closed {
+		return nil
+	}
+	mw.closed = true
+
+	return mw.flush(true)
+}
+
+// flush writes a fragment. The duration of a sample is known with the next
+// one, so unless last the newest sample of each track waits for the next
+// fragment.
+func (mw *Writer) flush(last bool) error {
+	type run struct {
+		tw      *trackWriter
+		samples []Sample
+		durs    []uint32
+	}
+
+	var runs []run
+	for _, tw := range mw.tracks {
+		n := len(tw.samples)
+		if !last {
+			n--
+		}
+		if n <= 0 {
+			continue
+		}
+
+		r := run{tw: tw, samples: tw.samples[:n], durs: make([]uint32, n)}
+		for i := 0; i < n; i++ {
+			if i+1 < len(tw.samples) {
+				r.durs[i] = uint32(tw.samples[i+1].DTS - tw.samples[i].DTS)
+				tw.lastDur = r.durs[i]
+			} else {
+				r.durs[i] = tw.lastDur
+			}
+		}
+
+		runs = append(runs, r)
+		tw.samples = append([]Sample(nil), tw.samples[n:]...)
+	}
+
+	if len(runs) == 0 {
+		return nil
+	}
+
+	mw.sequence++
+
+	// the data offsets depend on the size of the moof, which does not
+	// depend on their values
+	// so do the offsets of the sample encryption, relative to the moof
+	aux := make([]uint32, len(runs))
+	moof := func(offsets []uint32) *box {
+		b := &box{}
+		b.begin("moof")
+		b.beginFull("mfhd", 0, 0)
+		b.u32(mw.sequence)
+		b.end()
+
+		for i, r := range runs {
+			b.begin("traf")
+			// default-base-is-moof
+			b.beginFull("tfhd", 0, 0x020000)
+			b.u32(r.tw.id)
+			b.end()
+
+			b.beginFull("tfdt", 1, 0)
+			b.u64(uint64(r.samples[0].DTS))
+			b.end()
+
+			// data offset, sample duration, size and flags, composition
+			// offsets when reordered
+			flags := uint32(0x000701)
+			for _, s := range r.samples {
+				if s.CTS != 0 {
+					flags |= 0x000800
+					break
+				}
+			}
+			b.beginFull("trun", 0, flags)
+			b.u32(uint32(len(r.samples)))
+			b.u32(offsets[i])
+			for j, s := range r.samples {
+				b.u32(r.durs[j])
+				b.u32(uint32(len(s.Data)))
+				if s.Keyframe || !r.tw.Codec.IsVideo() {
+					b.u32(sampleFlagsSync)
+				} else {
+					b.u32(sampleFlagsNonSync)
+				}
+				if flags&0x000800 != 0 {
+					b.u32(s.CTS)
+				}
+			}
+			b.end()
+
+			if mw.enc != nil {
+				aux[i] = mw.enc.senc(b, r.samples, r.tw.Codec.IsVideo())
+				mw.enc.saiz(b, r.samples)
+				mw.enc.saio(b, aux[i])
+			}
+			b.end()
+		}
+		b.end()
+
+		return b
+	}
+
+	offsets := make([]uint32, len(runs))
+	size := uint32(len(moof(offsets).buf)) + 8
+	for i, r := range runs {
+		offsets[i] = size
+		for _, s := range r.samples {
+			size += uint32(len(s.Data))
+		}
+	}
+
+	b := moof(offsets)
+	b.begin("mdat")
+	for _, r := range runs {
+		for _, s := range r.samples {
+			b.bytes(s.Data)
+		}
+	}
+	b.end()
+
+	_, err := mw.w.Write(b.buf)
+
+	return err
+}
+
+func (mw *Writer) ftyp(b *box) {
+	b.begin("ftyp")
+	b.bytes([]byte("iso5"))
+	b.u32(512)
+	for _, brand := range []string{"iso5", "iso6", "mp41"} {
+		b.bytes([]byte(brand))
+	}
+	b.end()
+}
+
+func (mw *Writer) moov(b *box) {
+	b.begin("moov")
+
+	b.beginFull("mvhd", 0, 0)
+	b.u32(0) // creation time
+	b.u32(0) // modification time
+	b.u32(movieTimescale)
+	b.u32(0)          // duration, see the fragments
+	b.u32(0x00010000) // rate
+	b.u16(0x0100)     // volume
+	b.zeros(10)
+	b.matrix()
+	b.zeros(24)
+	b.u32(uint32(len(mw.tracks) + 1))
+	b.end()
+
+	if mw.enc != nil {
+		mw.enc.pssh(b)
+	}
+
+	for _, tw := range mw.tracks {
+		mw.trak(b, tw)
+	}
+
+	b.begin("mvex")
+	for _, tw := range mw.tracks {
+		b.beginFull("trex", 0, 0)
+		b.u32(tw.id)
+		b.u32(1) // sample description
+		b.u32(0)
+		b.u32(0)
+		b.u32(0)
+		b.end()
+	}
+	b.end()
+
+	b.end()
+}
+
+func (mw *Writer) trak(b *box, tw *trackWriter) {
+	video := tw.Codec.IsVideo()
+
+	b.begin("trak")
+
+	// enabled, in movie
+	b.beginFull("tkhd", 0, 3)
+	b.u32(0)
+	b.u32(0)
+	b.u32(tw.id)
+	b.u32(0)
+	b.u32(0) // duration
+	b.zeros(8)
+	b.u16(0) // layer
+	b.u16(0) // alternate group
+	if video {
+		b.u16(0)
+	} else {
+		b.u16(0x0100)
+	}
+	b.u16(0)
+	b.matrix()
+	b.u32(uint32(tw.Width) << 16)
+	b.u32(uint32(tw.Height) << 16)
+	b.end()
+
+	b.begin("mdia")
+	b.beginFull("mdhd", 0, 0)
+	b.u32(0)
+	b.u32(0)
+	b.u32(tw.Timescale)
+	b.u32(0)
+	b.u16(0x55c4) // und
+	b.u16(0)
+	b.end()
+
+	b.beginFull("hdlr", 0, 0)
+	b.u32(0)
+	if video {
+		b.bytes([]byte("vide"))
+	} else {
+		b.bytes([]byte("soun"))
+	}
+	b.zeros(12)
+	if video {
+		b.bytes([]byte("VideoHandler\x00"))
+	} else {
+		b.bytes([]byte("SoundHandler\x00"))
+	}
+	b.end()
+
+	b.begin("minf")
+	if video {
+		b.beginFull("vmhd", 0, 1)
+		b.zeros(8)
+		b.end()
+	} else {
+		b.beginFull("smhd", 0, 0)
+		b.zeros(4)
+		b.end()
+	}
+
+	b.begin("dinf")
+	b.beginFull("dref", 0, 0)
+	b.u32(1)
+	// self contained
+	b.beginFull("url ", 0, 1)
+	b.end()
+	b.end()
+	b.end()
+
+	b.begin("stbl")
+	b.beginFull("stsd", 0, 0)
+	b.u32(1)
+	switch tw.Codec {
+	case deliver.CodecTypeH264:
+		mw.avc1(b, tw)
+	case deliver.CodecTypeOpus:
+		mw.opus(b, tw)
+	}
+	b.end()
+
+	// the samples are in the fragments
+	for _, typ := range []string{"stts", "stsc", "stco"} {
+		b.beginFull(typ, 0, 0)
+		b.u32(0)
+		b.end()
+	}
+	b.beginFull("stsz", 0, 0)
+	b.u32(0)
+	b.u32(0)
+	b.end()
+	b.end()
+
+	b.end()
+	b.end()
+	b.end()
+}
+
+// sampleEntry is the type of the sample entry of format, encv or enca when
+// encrypted.
+func (mw *Writer) sampleEntry(format string, video bool) string {
+	switch {
+	case mw.enc == nil:
+		return format
+	case video:
+		return "encv"
+	default:
+		return "enca"
+	}
+}
+
+func (mw *Writer) visualSampleEntry(b *box, typ string, tw *trackWriter) {
+	b.begin(mw.sampleEntry(typ, true))
+	b.zeros(6)
+	b.u16(1) // data reference
+	b.zeros(16)
+	b.u16(uint16(tw.Width))
+	b.u16(uint16(tw.Height))
+	b.u32(0x00480000) // 72 dpi
+	b.u32(0x00480000)
+	b.u32(0)
+	b.u16(1) // frame count
+	b.zeros(32)
+	b.u16(0x0018) // depth
+	b.u16(0xffff)
+}
+
+func (mw *Writer) avc1(b *box, tw *trackWriter) {
+	mw.visualSampleEntry(b, "avc1", tw)
+
+	b.begin("avcC")
+	b.bytes(avc.DecoderConfig(tw.sps, tw.pps))
+	b.end()
+
+	if mw.enc != nil {
+		mw.enc.sinf(b, "avc1", true)
+	}
+
+	b.end()
+}
+
+func (mw *Writer) audioSampleEntry(b *box, typ string, tw *trackWriter) {
+	b.begin(mw.sampleEntry(typ, false))
+	b.zeros(6)
+	b.u16(1) // data reference
+	b.zeros(8)
+	b.u16(uint16(tw.Channels))
+	b.u16(16) // sample size
+	b.zeros(4)
+	b.u32(tw.Timescale << 16)
+}
+
+func (mw *Writer) opus(b *box, tw *trackWriter) {
+	mw.audioSampleEntry(b, "Opus", tw)
+
+	b.begin("dOps")
+	b.u8(0)
+	b.u8(tw.Channels)
+	b.u16(opusPreSkip)
+	b.u32(48000) // input sample rate
+	b.u16(0)     // output gain
+	b.u8(0)      // mono or stereo
+	b.end()
+
+	if mw.enc != nil {
+		mw.enc.sinf(b, "Opus", false)
+	}
+
+	b.end()
+}
@@ -0,0 +1,137 @@
+package record
+
+import (
+	"io"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/record/mkv"
+	"github.com/pingostack/neon/pkg/record/mp4"
+)
+
+// Format is the container of a recording, the file extension as well.
+type Format string
+
+const (
+	FormatMP4  Format = "mp4"
+	FormatMKV  Format = "mkv"
+	FormatWebM Format = "webm"
+)
+
+// Track is a track of a recorded stream.
+type Track struct {
+	Stream    string
+	Codec     deliver.CodecType
+	Timescale uint32
+	Channels  uint8
+	Width     int
+	Height    int
+}
+
+// Sample is a frame on the timeline of a recording, DTS in the timescale of
+// its track. CTS is the composition offset of reordered video, the
+// presentation timestamp less DTS.
+type Sample struct {
+	DTS      int64
+	CTS      uint32
+	Keyframe bool
+	Data     []byte
+}
+
+// Muxer writes the tracks of a recording into a container.
+type Muxer interface {
+	WriteSample(track int, s Sample) error
+	Close() error
+}
+
+// Supports tells whether format can store codec.
+func Supports(format Format, codec deliver.CodecType) bool {
+	switch format {
+	case FormatMP4:
+		return codec == deliver.CodecTypeH264 || codec == deliver.CodecTypeOpus
+	case FormatMKV:
+		return mkv.CodecID(codec) != ""
+	case FormatWebM:
+		return mkv.IsWebM(codec)
+	}
+
+	return false
+}
+
+// newMuxer starts a container, keyframes holds the first keyframe of every
+// video track. enc encrypts mp4 when not nil.
+func newMuxer(format Format, w io.Writer, tracks []Track, keyframes [][]byte, enc *mp4.Encryption) (Muxer, error) {
+	switch format {
+	case FormatMP4:
+		mt := make([]mp4.Track, len(tracks))
+		for i, t := range tracks {
+			mt[i] = mp4.Track{
+				Codec:     t.Codec,
+				Timescale: t.Timescale,
+				Channels:  t.Channels,
+				Width:     t.Width,
+				Height:    t.Height,
+				Keyframe:  keyframes[i],
+			}
+		}
+
+		var mw *mp4.Writer
+		var err error
+		if enc != nil {
+			mw, err = mp4.NewEncryptedWriter(w, mt, *enc)
+		} else {
+			mw, err = mp4.NewWriter(w, mt)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return &mp4Muxer{mw}, nil
+	case FormatMKV, FormatWebM:
+		mt := make([]mkv.Track, len(tracks))
+		for i, t := range tracks {
+			mt[i] = mkv.Track{
+				Codec:     t.Codec,
+				Timescale: t.Timescale,
+				Channels:  t.Channels,
+				Width:     t.Width,
+				Height:    t.Height,
+				Keyframe:  keyframes[i],
+			}
+		}
+
+		mw, err := mkv.NewWriter(w, mt)
+		if err != nil {
+			return nil, err
+		}
+
+		return &mkvMuxer{mw}, nil
+	}
+
+	return nil, ErrUnsupportedFormat
+}
+
+type mp4Muxer struct {
+	*mp4.Writer
+}
+
+func (m *mp4Muxer) WriteSample(track int, s Sample) error {
+	return m.Writer.WriteSample(track, mp4.Sample{
+		DTS:      s.DTS,
+		CTS:      s.CTS,
+		Keyframe: s.Keyframe,
+		Data:     s.Data,
+	})
+}
+
+type mkvMuxer struct {
+	*mkv.Writer
+}
+
+func (m *mkvMuxer) WriteSample(track int, s Sample) error {
+	return m.Writer.WriteSample(track, mkv.Sample{
+		DTS:      s.DTS,
+		CTS:      s.CTS,
+		Keyframe: s.Keyframe,
+		Data:     s.Data,
+	})
+}
@@ -0,0 +1,419 @@
+package record
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/clock"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/record/av1"
+	"github.com/pingostack/neon/pkg/record/avc"
+	"github.com/pingostack/neon/pkg/record/mkv"
+	"github.com/pingostack/neon/pkg/rtclib"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	playerVideoPayloadType = 96
+	playerAudioPayloadType = 111
+	playerVideoClockRate   = 90000
+	// gap between the last frame of a file and the first one when looping
+	playerLoopGap = 20 * time.Millisecond
+	// scales above which only keyframes are played
+	playerKeyframeScale = 2
+	playerMaxScale      = 32
+)
+
+type playerTrack struct {
+	codec      deliver.CodecType
+	clockRate  uint32
+	packetizer *rtclib.Packetizer
+	sps, pps   []byte
+	// the av1 sequence header
+	sequence []byte
+}
+
+// Player plays a recording as a frame source of rtp packets, in real time.
+// The first video and the first audio track are played, mp4 files are not
+// supported.
+type Player struct {
+	deliver.FrameSource
+	ctx    context.Context
+	path   string
+	loop   bool
+	logger *logrus.Entry
+	tracks map[uint64]*playerTrack
+	clock  clock.Clock
+
+	lock  sync.Mutex
+	scale float64
+	speed float64
+	// the wall clock played the timeline position at
+	anchorWall  time.Time
+	anchorMedia time.Duration
+	position    time.Duration
+	// the span played, until 0 is the end of the file
+	from   Position
+	until  time.Duration
+	seeked chan struct{}
+}
+
+// errSeeked restarts a play at the position seeked to.
+var errSeeked = errors.New("seeked")
+
+func NewPlayer(ctx context.Context, path string, loop bool, logger *logrus.Entry) (*Player, error) {
+	switch Format(strings.TrimPrefix(filepath.Ext(path), ".")) {
+	case FormatMKV, FormatWebM:
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader, err := mkv.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Player{
+		ctx:    ctx,
+		path:   path,
+		loop:   loop,
+		logger: logger.WithField("file", path),
+		tracks: make(map[uint64]*playerTrack),
+		clock:  clock.Default(),
+		scale:  1,
+		speed:  1,
+		seeked: make(chan struct{}, 1),
+	}
+
+	metadata := deliver.Metadata{PacketType: deliver.PacketTypeRtp}
+	for _, t := range reader.Tracks() {
+		if t.Codec.IsVideo() && metadata.Video == nil {
+			track, err := newPlayerTrack(t, playerVideoPayloadType, playerVideoClockRate)
+			if err != nil {
+				p.logger.WithError(err).WithField("codec", t.Codec.String()).Warn("track not played")
+				continue
+			}
+
+			metadata.Video = &deliver.VideoMetadata{
+				Codec:          t.Codec.String(),
+				CodecType:      t.Codec,
+				Width:          t.Width,
+				Height:         t.Height,
+				RtpPayloadType: playerVideoPayloadType,
+				ClockRate:      playerVideoClockRate,
+			}
+			p.tracks[t.Number] = track
+		} else if t.Codec.IsAudio() && metadata.Audio == nil {
+			channels := t.Channels
+			if channels == 0 {
+				channels = 2
+			}
+
+			// opus is always clocked at 48khz over rtp
+			track, err := newPlayerTrack(t, playerAudioPayloadType, 48000)
+			if err != nil {
+				p.logger.WithError(err).WithField("codec", t.Codec.String()).Warn("track not played")
+				continue
+			}
+
+			metadata.Audio = &deliver.AudioMetadata{
+				Codec:          t.Codec.String(),
+				CodecType:      t.Codec,
+				SampleRate:     48000,
+				Channels:       channels,
+				RtpPayloadType: playerAudioPayloadType,
+			}
+			p.tracks[t.Number] = track
+		}
+	}
+
+	if len(p.tracks) == 0 {
+		return nil, ErrNoTracks
+	}
+
+	p.FrameSource = deliver.NewFrameSourceImpl(ctx, metadata)
+
+	return p, nil
+}
+
+func newPlayerTrack(t mkv.TrackInfo, payloadType uint8, clockRate uint32) (*playerTrack, error) {
+	packetizer, err := rtclib.NewPacketizer(t.Codec, payloadType, clockRate)
+	if err != nil {
+		return nil, err
+	}
+
+	track := &playerTrack{
+		codec:      t.Codec,
+		clockRate:  clockRate,
+		packetizer: packetizer,
+	}
+
+	switch t.Codec {
+	case deliver.CodecTypeH264:
+		if track.sps, track.pps, err = avc.ParseDecoderConfig(t.CodecPrivate); err != nil {
+			return nil, err
+		}
+	case deliver.CodecTypeAV1:
+		if track.sequence, err = av1.ParseDecoderConfig(t.CodecPrivate); err != nil {
+			return nil, err
+		}
+	}
+
+	return track, nil
+}
+
+// SetClock sets the clock frames are played on before Run, clock.Default()
+// when nil.
+func (p *Player) SetClock(c clock.Clock) {
+	p.clock = clock.Or(c)
+}
+
+// SetRate changes the playback rate, see the Scale and Speed of RTSP. Scale
+// plays the media faster, above 2 only keyframes, without audio unless 1.
+// Speed plays all frames faster. Timestamps stay on the media timeline,
+// the values applied are returned, reverse playback is not supported.
+func (p *Player) SetRate(scale, speed float64) (float64, float64) {
+	clamp := func(v float64) float64 {
+		if v <= 0 {
+			return 1
+		}
+		if v > playerMaxScale {
+			return playerMaxScale
+		}
+		return v
+	}
+	scale, speed = clamp(scale), clamp(speed)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// the position played so far stays where it is on the wall clock
+	if !p.anchorWall.IsZero() {
+		p.anchorWall, p.anchorMedia = p.clock.Now(), p.position
+	}
+	p.scale, p.speed = scale, speed
+
+	p.logger.WithField("scale", scale).WithField("speed", speed).Info("playback rate changed")
+
+	return scale, speed
+}
+
+// Seek plays span of the file from now on, from the keyframe at or before
+// its start. Timestamps go on where they are. It returns the position
+// resolved on the index of the file.
+func (p *Player) Seek(span Span) (Position, error) {
+	ix, err := LoadIndex(p.path)
+	if err != nil {
+		return Position{}, err
+	}
+
+	pos, err := ix.Resolve(span)
+	if err != nil {
+		return Position{}, err
+	}
+
+	p.lock.Lock()
+	p.from, p.until = pos, 0
+	if pos.EndOffset < ix.Size {
+		p.until = pos.End
+	}
+	p.lock.Unlock()
+
+	select {
+	case p.seeked <- struct{}{}:
+	default:
+	}
+
+	p.logger.WithField("start", pos.Start).WithField("end", pos.End).Info("seeked")
+
+	return pos, nil
+}
+
+// due is the wall clock time the frame at position is played at.
+func (p *Player) due(at time.Duration) time.Time {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.anchorWall.IsZero() {
+		p.anchorWall, p.anchorMedia = p.clock.Now(), at
+	}
+	rate := p.scale * p.speed
+
+	return p.anchorWall.Add(time.Duration(float64(at-p.anchorMedia) / rate))
+}
+
+// skip tells whether the frame is left out at the current scale.
+func (p *Player) skip(track *playerTrack, keyframe bool) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.scale == 1 {
+		return false
+	}
+
+	if track.codec.IsAudio() {
+		return true
+	}
+
+	return p.scale > playerKeyframeScale && !keyframe
+}
+
+func (p *Player) played(at time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if at > p.position {
+		p.position = at
+	}
+}
+
+// Run plays the file until the end, or over and over when looping, and
+// until ctx is done. The source is closed with ctx.
+func (p *Player) Run() error {
+	var offset time.Duration
+
+	// a seek before the start is where the first play begins
+	select {
+	case <-p.seeked:
+	default:
+	}
+
+	for {
+		last, err := p.play(offset)
+		if err == errSeeked {
+			offset += last + playerLoopGap
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		// a file without frames is not looped
+		if !p.loop || last == 0 {
+			return nil
+		}
+
+		offset += last + playerLoopGap
+	}
+}
+
+// play delivers the frames of the span once, offset on the timeline, and
+// returns the timestamp of the last frame relative to the span.
+func (p *Player) play(offset time.Duration) (time.Duration, error) {
+	p.lock.Lock()
+	from, until := p.from, p.until
+	p.lock.Unlock()
+
+	f, err := os.Open(p.path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	reader, err := mkv.NewReader(f)
+	if err != nil {
+		return 0, err
+	}
+
+	if from.StartOffset > 0 {
+		if err := reader.SeekCluster(from.StartOffset); err != nil {
+			return 0, err
+		}
+	}
+
+	tracks := reader.Tracks()
+	timer := p.clock.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	var last time.Duration
+	for {
+		frame, err := reader.ReadFrame()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// files of recordings still being written end anywhere
+			return last, nil
+		} else if err != nil {
+			return last, err
+		}
+
+		track := p.tracks[tracks[frame.Track].Number]
+		if track == nil || frame.Timestamp < from.Start {
+			continue
+		}
+
+		if until > 0 && frame.Timestamp >= until {
+			return last, nil
+		}
+
+		rel := frame.Timestamp - from.Start
+		if rel > last {
+			last = rel
+		}
+
+		if p.skip(track, frame.Keyframe) {
+			continue
+		}
+
+		at := offset + rel
+		if wait := p.clock.Until(p.due(at)); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-p.ctx.Done():
+				return last, p.ctx.Err()
+			case <-p.seeked:
+				return last, errSeeked
+			case <-timer.C:
+			}
+		} else {
+			select {
+			case <-p.ctx.Done():
+				return last, p.ctx.Err()
+			case <-p.seeked:
+				return last, errSeeked
+			default:
+			}
+		}
+
+		p.deliver(track, at, frame)
+		p.played(at)
+	}
+}
+
+func (p *Player) deliver(track *playerTrack, at time.Duration, frame mkv.Frame) {
+	data := frame.Data
+	switch track.codec {
+	case deliver.CodecTypeH264:
+		data = avc.ToAnnexB(data, track.sps, track.pps, frame.Keyframe)
+	case deliver.CodecTypeAV1:
+		// matroska keeps the sequence header in the codec private data only
+		if frame.Keyframe && av1.SequenceHeader(data) == nil {
+			data = append(append([]byte{}, track.sequence...), data...)
+		}
+	}
+
+	raw := deliver.Frame{
+		Codec:      track.codec,
+		PacketType: deliver.PacketTypeRaw,
+		Payload:    data,
+		Length:     len(data),
+		TimeStamp:  uint32(int64(at/time.Microsecond) * int64(track.clockRate) / 1_000_000),
+	}
+	if track.codec.IsVideo() {
+		raw.AdditionalInfo = &deliver.VideoFrameSpecificInfo{IsKeyFrame: frame.Keyframe}
+	}
+
+	for _, f := range track.packetizer.Packetize(raw) {
+		p.FrameSource.DeliverFrame(f, nil)
+	}
+}
@@ -0,0 +1,424 @@
+package record
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/clock"
+	"github.com/pingostack/neon/pkg/codec"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/record/mp4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// the file is started without the tracks that have no keyframe by then
+	readyTimeout = 3 * time.Second
+	// samples buffered while waiting for the keyframes
+	maxPendingSamples = 2048
+	defaultClockRate  = 90000
+)
+
+// Recording describes a finished file.
+type Recording struct {
+	Path     string
+	Start    time.Time
+	Duration time.Duration
+	Tracks   []Track
+}
+
+type track struct {
+	Track
+	index    int
+	ready    bool
+	keyframe []byte
+	started  bool
+	lastTS   uint32
+	ts       int64
+	offset   int64
+	end      int64
+	// dts reorders the frames of codecs with B-frames for their decoding
+	// timestamps
+	dts *deliver.DTSExtractor
+}
+
+// at converts a timestamp of the track to the time since the start.
+func (t *track) at(ts int64) time.Duration {
+	return time.Duration(float64(ts) / float64(t.Timescale) * float64(time.Second))
+}
+
+type pendingSample struct {
+	track  *track
+	sample Sample
+}
+
+// Recorder writes the audio and video of one or more streams into one file.
+// All tracks share the timeline starting at start, a track begins at the
+// wall clock time its first frame arrived and follows its rtp timestamps.
+type Recorder struct {
+	lock      sync.Mutex
+	path      string
+	format    Format
+	start     time.Time
+	logger    *logrus.Entry
+	tracks    []*track
+	written   []*track
+	pending   []pendingSample
+	pendingAt time.Time
+	file      *os.File
+	muxer     Muxer
+	closed    bool
+	encrypt   *mp4.Encryption
+	clock     clock.Clock
+}
+
+func NewRecorder(path string, format Format, start time.Time, logger *logrus.Entry) *Recorder {
+	return &Recorder{
+		path:   path,
+		format: format,
+		start:  start,
+		logger: logger.WithField("file", path),
+		clock:  clock.Default(),
+	}
+}
+
+func (r *Recorder) Path() string {
+	return r.path
+}
+
+// SetClock sets the clock frames arrive on, clock.Default() when nil.
+func (r *Recorder) SetClock(c clock.Clock) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.clock = clock.Or(c)
+}
+
+// Encrypt writes the file with common encryption, mp4 only, before the
+// first frame is written.
+func (r *Recorder) Encrypt(enc mp4.Encryption) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.format != FormatMP4 {
+		return ErrUnsupportedFormat
+	}
+
+	if r.closed {
+		return ErrRecorderClosed
+	}
+
+	if r.muxer != nil {
+		return ErrRecorderStarted
+	}
+
+	r.encrypt = &enc
+	return nil
+}
+
+// AddStream adds the tracks of a stream, before its first frame is written.
+// Codecs the format can not store are left out.
+func (r *Recorder) AddStream(stream string, md *deliver.Metadata) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return ErrRecorderClosed
+	}
+
+	if r.muxer != nil {
+		return ErrRecorderStarted
+	}
+
+	var tracks []Track
+	if md.HasVideo() {
+		clockRate := md.Video.ClockRate
+		if clockRate == 0 {
+			clockRate = defaultClockRate
+		}
+		tracks = append(tracks, Track{
+			Stream:    stream,
+			Codec:     md.Video.CodecType,
+			Timescale: clockRate,
+			Width:     md.Video.Width,
+			Height:    md.Video.Height,
+		})
+	}
+
+	if md.HasAudio() {
+		tracks = append(tracks, Track{
+			Stream:    stream,
+			Codec:     md.Audio.CodecType,
+			Timescale: md.Audio.SampleRate,
+			Channels:  md.Audio.Channels,
+		})
+	}
+
+	for _, t := range tracks {
+		if !Supports(r.format, t.Codec) || t.Timescale == 0 {
+			r.logger.WithFields(logrus.Fields{
+				"stream": stream,
+				"codec":  t.Codec.String(),
+			}).Warn("codec not recorded")
+			continue
+		}
+
+		rt := &track{Track: t, index: -1}
+		if t.Codec == deliver.CodecTypeH264 || t.Codec == deliver.CodecTypeH265 {
+			rt.dts = deliver.NewDTSExtractor(deliver.DefaultReorderDepth)
+		}
+		r.tracks = append(r.tracks, rt)
+	}
+
+	return nil
+}
+
+func (r *Recorder) trackOf(stream string, codec deliver.CodecType) *track {
+	for _, t := range r.tracks {
+		if t.Stream == stream && t.Codec == codec {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// WriteFrame writes a raw frame of stream, the frame is not kept. Frames of
+// tracks not added are ignored. Video that may have B-frames is written a few
+// frames late, once their decoding timestamps are known.
+func (r *Recorder) WriteFrame(stream string, frame deliver.Frame) error {
+	r.lock.Lock()
+	now := r.clock.Now()
+	r.lock.Unlock()
+
+	return r.WriteFrameAt(stream, frame, now)
+}
+
+// WriteFrameAt writes a frame that arrived at, e.g. one buffered before the
+// recording started.
+func (r *Recorder) WriteFrameAt(stream string, frame deliver.Frame, at time.Time) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return ErrRecorderClosed
+	}
+
+	t := r.trackOf(stream, frame.Codec)
+	if t == nil {
+		return nil
+	}
+
+	keyframe := isKeyframe(frame)
+
+	if !t.ready {
+		if !keyframe {
+			return nil
+		}
+		t.ready = true
+		if t.Codec.IsVideo() {
+			t.keyframe = append([]byte(nil), frame.Payload...)
+		}
+		if sps := codec.FindSPS(t.Codec, frame.Payload); t.dts != nil && sps != nil {
+			// the sps tells how deep the encoder reorders
+			if info, err := codec.ParseSPS(t.Codec, sps); err == nil && info.ReorderFrames >= 0 {
+				t.dts = deliver.NewDTSExtractor(info.ReorderFrames)
+			}
+		}
+	}
+
+	frame.Payload = append([]byte(nil), frame.Payload...)
+	if t.dts == nil {
+		return r.writeFrame(t, frame, keyframe, at)
+	}
+
+	for _, f := range t.dts.Push(frame) {
+		if err := r.writeFrame(t, f, isKeyframe(f), at); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isKeyframe(frame deliver.Frame) bool {
+	if info, ok := frame.AdditionalInfo.(*deliver.VideoFrameSpecificInfo); ok {
+		return info.IsKeyFrame
+	}
+
+	return true
+}
+
+func (r *Recorder) writeFrame(t *track, frame deliver.Frame, keyframe bool, now time.Time) error {
+	if !t.started {
+		t.started, t.lastTS = true, frame.TimeStamp
+		t.offset = int64(now.Sub(r.start).Seconds() * float64(t.Timescale))
+		if t.offset < int64(frame.CompositionOffset) {
+			// the first video frames are decoded before they are presented
+			t.offset = int64(frame.CompositionOffset)
+		}
+	} else {
+		t.ts += int64(int32(frame.TimeStamp - t.lastTS))
+		t.lastTS = frame.TimeStamp
+	}
+
+	s := Sample{
+		DTS:      t.offset + t.ts - int64(frame.CompositionOffset),
+		CTS:      frame.CompositionOffset,
+		Keyframe: keyframe,
+		Data:     frame.Payload,
+	}
+	if pts := s.DTS + int64(s.CTS); pts > t.end {
+		t.end = pts
+	}
+
+	if r.muxer != nil {
+		return r.write(t, s)
+	}
+
+	if r.pendingAt.IsZero() {
+		r.pendingAt = now
+	}
+	r.pending = append(r.pending, pendingSample{track: t, sample: s})
+
+	if !r.allReady() && now.Sub(r.pendingAt) < readyTimeout && len(r.pending) < maxPendingSamples {
+		return nil
+	}
+
+	if err := r.open(); err != nil {
+		// the frames that follow are not written either
+		r.closed = true
+		return err
+	}
+
+	return nil
+}
+
+func (r *Recorder) allReady() bool {
+	for _, t := range r.tracks {
+		if !t.ready {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *Recorder) write(t *track, s Sample) error {
+	if t.index < 0 {
+		return nil
+	}
+
+	return r.muxer.WriteSample(t.index, s)
+}
+
+// open starts the file with the tracks ready and writes what is pending.
+func (r *Recorder) open() error {
+	var tracks []Track
+	var keyframes [][]byte
+	for _, t := range r.tracks {
+		if !t.ready {
+			r.logger.WithFields(logrus.Fields{
+				"stream": t.Stream,
+				"codec":  t.Codec.String(),
+			}).Warn("no keyframe in time, track not recorded")
+			continue
+		}
+
+		t.index = len(tracks)
+		tracks = append(tracks, t.Track)
+		keyframes = append(keyframes, t.keyframe)
+		r.written = append(r.written, t)
+	}
+
+	pending := r.pending
+	r.pending = nil
+
+	if len(tracks) == 0 {
+		return ErrNoTracks
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return errors.Wrap(err, "create recording directory")
+	}
+
+	file, err := os.Create(r.path)
+	if err != nil {
+		return errors.Wrap(err, "create recording")
+	}
+
+	muxer, err := newMuxer(r.format, file, tracks, keyframes, r.encrypt)
+	if err != nil {
+		file.Close()
+		os.Remove(r.path)
+		return errors.Wrap(err, "start recording")
+	}
+
+	r.file, r.muxer = file, muxer
+	r.logger.WithField("tracks", len(tracks)).Info("recording started")
+
+	for _, p := range pending {
+		if err := r.write(p.track, p.sample); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close finishes the file, a recorder that got no frame leaves no file.
+func (r *Recorder) Close() (Recording, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	rec := Recording{Path: r.path, Start: r.start}
+	if r.closed {
+		return rec, ErrRecorderClosed
+	}
+	now := r.clock.Now()
+	for _, t := range r.tracks {
+		if t.dts == nil {
+			continue
+		}
+		for _, f := range t.dts.Flush() {
+			if err := r.writeFrame(t, f, isKeyframe(f), now); err != nil {
+				r.closed = true
+				return rec, err
+			}
+		}
+	}
+	r.closed = true
+
+	if r.muxer == nil && len(r.pending) > 0 {
+		if err := r.open(); err != nil {
+			return rec, err
+		}
+	}
+
+	if r.muxer == nil {
+		return rec, ErrNoTracks
+	}
+
+	var begin, end time.Duration
+	for i, t := range r.written {
+		rec.Tracks = append(rec.Tracks, t.Track)
+		from, to := t.at(t.offset), t.at(t.end)
+		if i == 0 || from < begin {
+			begin = from
+		}
+		if to > end {
+			end = to
+		}
+	}
+	rec.Duration = end - begin
+
+	err := r.muxer.Close()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+
+	return rec, err
+}
@@ -0,0 +1,200 @@
+package record
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the furthest Next looks ahead for a window
+const scheduleHorizon = 366 * 24 * time.Hour
+
+// Cron matches the minutes of a crontab line: minute, hour, day of month,
+// month and day of week, Sunday 0 or 7. Every field is *, a value, a range
+// 1-5, a step */15 or 1-30/2, or a list of these, 1,15,20-25. As in cron a
+// time matches either day field when both are restricted.
+type Cron struct {
+	expr   string
+	fields [5]uint64
+	// the day fields are *
+	anyDOM, anyDOW bool
+}
+
+var cronRanges = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+func ParseCron(expr string) (*Cron, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCron, expr)
+	}
+
+	c := &Cron{expr: expr}
+	for i, part := range parts {
+		bits, err := parseCronField(part, cronRanges[i][0], cronRanges[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCron, expr)
+		}
+		c.fields[i] = bits
+	}
+
+	// 7 is Sunday as well
+	if c.fields[4]&(1<<7) != 0 {
+		c.fields[4] |= 1
+	}
+	c.anyDOM, c.anyDOW = parts[2] == "*", parts[4] == "*"
+
+	return c, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		from, to, step := min, max, 1
+
+		rng, stepText, hasStep := strings.Cut(item, "/")
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n < 1 {
+				return 0, ErrInvalidCron
+			}
+			step = n
+		}
+
+		if rng != "*" {
+			lo, hi, isRange := strings.Cut(rng, "-")
+			var err error
+			if from, err = strconv.Atoi(lo); err != nil {
+				return 0, ErrInvalidCron
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(hi); err != nil {
+					return 0, ErrInvalidCron
+				}
+			} else if hasStep {
+				to = max
+			}
+		}
+
+		if from < min || to > max || from > to {
+			return 0, ErrInvalidCron
+		}
+
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func (c *Cron) String() string {
+	return c.expr
+}
+
+// Match tells whether the minute of t is one of c, in the location of t.
+func (c *Cron) Match(t time.Time) bool {
+	has := func(i, v int) bool {
+		return c.fields[i]&(1<<uint(v)) != 0
+	}
+
+	if !has(0, t.Minute()) || !has(1, t.Hour()) || !has(3, int(t.Month())) {
+		return false
+	}
+
+	dom, dow := has(2, t.Day()), has(4, int(t.Weekday()))
+	switch {
+	case c.anyDOM && c.anyDOW:
+		return true
+	case c.anyDOM:
+		return dow
+	case c.anyDOW:
+		return dom
+	}
+
+	return dom || dow
+}
+
+// Schedule opens a window of Duration at every minute of Start, but not on
+// the dates of Except.
+type Schedule struct {
+	Start    *Cron
+	Duration time.Duration
+	// Except are dates, 2006-01-02, windows do not start on.
+	Except   map[string]bool
+	Location *time.Location
+}
+
+// NewSchedule parses start and the dates of except, the times are those of
+// the time zone location, local when empty.
+func NewSchedule(start string, duration time.Duration, except []string, location string) (*Schedule, error) {
+	cron, err := ParseCron(start)
+	if err != nil {
+		return nil, err
+	}
+
+	if duration < time.Minute {
+		return nil, fmt.Errorf("%w: windows shorter than a minute", ErrInvalidSchedule)
+	}
+
+	loc := time.Local
+	if location != "" {
+		if loc, err = time.LoadLocation(location); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+		}
+	}
+
+	s := &Schedule{
+		Start:    cron,
+		Duration: duration,
+		Except:   make(map[string]bool, len(except)),
+		Location: loc,
+	}
+	for _, date := range except {
+		if _, err := time.ParseInLocation("2006-01-02", date, loc); err != nil {
+			return nil, fmt.Errorf("%w: date %s", ErrInvalidSchedule, date)
+		}
+		s.Except[date] = true
+	}
+
+	return s, nil
+}
+
+func (s *Schedule) starts(t time.Time) bool {
+	return s.Start.Match(t) && !s.Except[t.Format("2006-01-02")]
+}
+
+// Active tells whether a window is open at now, and when it closes. Windows
+// overlapping are one.
+func (s *Schedule) Active(now time.Time) (bool, time.Time) {
+	now = now.In(s.Location)
+
+	var until time.Time
+	for t := now.Truncate(time.Minute); now.Sub(t) < s.Duration; t = t.Add(-time.Minute) {
+		if !s.starts(t) {
+			continue
+		}
+
+		if end := t.Add(s.Duration); end.After(until) {
+			until = end
+		}
+	}
+
+	return !until.IsZero(), until
+}
+
+// Next returns the start of the first window after now, zero when there is
+// none within a year.
+func (s *Schedule) Next(now time.Time) time.Time {
+	now = now.In(s.Location)
+
+	t := now.Truncate(time.Minute).Add(time.Minute)
+	for ; t.Sub(now) < scheduleHorizon; t = t.Add(time.Minute) {
+		if s.starts(t) {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,138 @@
+package record
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Span is the part of a recording to play, what an RTSP Range, an HLS
+// TIME-OFFSET and the start and end of the http api come down to. End 0 is
+// the end of the recording.
+type Span struct {
+	Start time.Duration
+	End   time.Duration
+	// FromEnd counts Start back from the end, a negative TIME-OFFSET.
+	FromEnd bool
+}
+
+// ParseNPTRange parses the Range header of an RTSP PLAY, npt=10-, npt=10.5-20
+// or npt=0:01:10-, now is the start of the recording.
+func ParseNPTRange(header string) (Span, error) {
+	header = strings.TrimSpace(header)
+	if !strings.HasPrefix(header, "npt=") {
+		return Span{}, fmt.Errorf("%w: %s", ErrInvalidRange, header)
+	}
+
+	// a time to start at may follow, ;time=...
+	value := strings.TrimPrefix(header, "npt=")
+	if i := strings.Index(value, ";"); i >= 0 {
+		value = value[:i]
+	}
+
+	i := strings.Index(value, "-")
+	if i < 0 {
+		return Span{}, fmt.Errorf("%w: %s", ErrInvalidRange, header)
+	}
+
+	var span Span
+	var err error
+	if from := strings.TrimSpace(value[:i]); from != "" && from != "now" {
+		if span.Start, err = parseNPT(from); err != nil {
+			return Span{}, err
+		}
+	}
+
+	if to := strings.TrimSpace(value[i+1:]); to != "" {
+		if span.End, err = parseNPT(to); err != nil {
+			return Span{}, err
+		}
+	}
+
+	if span.End != 0 && span.End <= span.Start {
+		return Span{}, fmt.Errorf("%w: %s", ErrInvalidRange, header)
+	}
+
+	return span, nil
+}
+
+// parseNPT parses seconds, 12.5, or hours, minutes and seconds, 1:02:03.5.
+func parseNPT(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 1 && len(parts) != 3 {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidRange, s)
+	}
+
+	seconds, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil || seconds < 0 {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidRange, s)
+	}
+
+	if len(parts) == 3 {
+		hours, err1 := strconv.Atoi(parts[0])
+		minutes, err2 := strconv.Atoi(parts[1])
+		if err1 != nil || err2 != nil || hours < 0 || minutes < 0 || minutes > 59 {
+			return 0, fmt.Errorf("%w: %s", ErrInvalidRange, s)
+		}
+		seconds += float64(hours*3600 + minutes*60)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// ParseTimeOffset parses the TIME-OFFSET of an HLS EXT-X-START, negative
+// offsets count from the end.
+func ParseTimeOffset(offset string) (Span, error) {
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(offset), 64)
+	if err != nil {
+		return Span{}, fmt.Errorf("%w: %s", ErrInvalidRange, offset)
+	}
+
+	if seconds < 0 {
+		return Span{Start: time.Duration(-seconds * float64(time.Second)), FromEnd: true}, nil
+	}
+
+	return Span{Start: time.Duration(seconds * float64(time.Second))}, nil
+}
+
+// ParseStartEnd parses the start and end of the http api, seconds or
+// durations such as 1m30s, either may be empty.
+func ParseStartEnd(start, end string) (Span, error) {
+	parse := func(s string) (time.Duration, error) {
+		if s == "" {
+			return 0, nil
+		}
+
+		if seconds, err := strconv.ParseFloat(s, 64); err == nil && seconds >= 0 {
+			return time.Duration(seconds * float64(time.Second)), nil
+		}
+
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return 0, fmt.Errorf("%w: %s", ErrInvalidRange, s)
+		}
+
+		return d, nil
+	}
+
+	var span Span
+	var err error
+	if span.Start, err = parse(start); err != nil {
+		return Span{}, err
+	}
+	if span.End, err = parse(end); err != nil {
+		return Span{}, err
+	}
+
+	if span.End != 0 && span.End <= span.Start {
+		return Span{}, fmt.Errorf("%w: %s-%s", ErrInvalidRange, start, end)
+	}
+
+	return span, nil
+}
+
+// NPTRange formats the Range header of a PLAY response for pos.
+func (pos Position) NPTRange() string {
+	return fmt.Sprintf("npt=%.3f-%.3f", pos.Start.Seconds(), pos.End.Seconds())
+}
@@ -0,0 +1,9 @@
+package registry
+
+import "errors"
+
+var (
+	ErrUnknownBackend = errors.New("unknown registry backend")
+	ErrNotFound       = errors.New("stream not registered")
+	ErrBackend        = errors.New("registry backend error")
+)
@@ -0,0 +1,262 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const etcdRequestTimeout = 3 * time.Second
+
+// etcdBackend uses the json gateway of the etcd v3 api. Keys are attached to
+// one lease that is kept alive by the puts of the announcer.
+type etcdBackend struct {
+	settings  Settings
+	client    *http.Client
+	lock      sync.Mutex
+	token     string
+	lease     int64
+	leaseTTL  time.Duration
+	leaseSeen time.Time
+}
+
+func newEtcdBackend(settings Settings) (Backend, error) {
+	if settings.Addr == "" {
+		settings.Addr = "http://127.0.0.1:2379"
+	}
+
+	if !strings.Contains(settings.Addr, "://") {
+		settings.Addr = "http://" + settings.Addr
+	}
+	settings.Addr = strings.TrimSuffix(settings.Addr, "/")
+
+	return &etcdBackend{
+		settings: settings,
+		client:   &http.Client{Timeout: etcdRequestTimeout},
+	}, nil
+}
+
+type etcdKV struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// prefixEnd is the range end covering all keys with prefix.
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+
+	return "\x00"
+}
+
+func (eb *etcdBackend) Put(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	eb.lock.Lock()
+	defer eb.lock.Unlock()
+
+	lease, err := eb.ensureLease(ctx, ttl)
+	if err != nil {
+		return err
+	}
+
+	err = eb.call(ctx, "/v3/kv/put", map[string]interface{}{
+		"key":   b64(key),
+		"value": base64.StdEncoding.EncodeToString(value),
+		"lease": fmt.Sprint(lease),
+	}, nil)
+	if err != nil {
+		// the lease may have expired meanwhile, a new one is granted next time
+		eb.lease = 0
+	}
+
+	return err
+}
+
+func (eb *etcdBackend) Delete(ctx context.Context, key string) error {
+	eb.lock.Lock()
+	defer eb.lock.Unlock()
+
+	return eb.call(ctx, "/v3/kv/deleterange", map[string]interface{}{
+		"key": b64(key),
+	}, nil)
+}
+
+func (eb *etcdBackend) List(ctx context.Context, prefix string) (map[string][]byte, error) {
+	eb.lock.Lock()
+	defer eb.lock.Unlock()
+
+	var resp struct {
+		KVs []etcdKV `json:"kvs"`
+	}
+
+	err := eb.call(ctx, "/v3/kv/range", map[string]interface{}{
+		"key":       b64(prefix),
+		"range_end": b64(prefixEnd(prefix)),
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string][]byte, len(resp.KVs))
+	for _, kv := range resp.KVs {
+		key, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			continue
+		}
+
+		value, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			continue
+		}
+
+		values[string(key)] = value
+	}
+
+	return values, nil
+}
+
+func (eb *etcdBackend) Close() error {
+	return nil
+}
+
+// ensureLease grants the lease on first use and keeps it alive once half of
+// its ttl passed, must be called with eb.lock held.
+func (eb *etcdBackend) ensureLease(ctx context.Context, ttl time.Duration) (int64, error) {
+	if eb.lease != 0 && ttl == eb.leaseTTL {
+		if time.Since(eb.leaseSeen) < ttl/2 {
+			return eb.lease, nil
+		}
+
+		var resp struct {
+			Result struct {
+				TTL int64 `json:"TTL,string"`
+			} `json:"result"`
+		}
+
+		err := eb.call(ctx, "/v3/lease/keepalive", map[string]interface{}{
+			"ID": fmt.Sprint(eb.lease),
+		}, &resp)
+		if err == nil && resp.Result.TTL > 0 {
+			eb.leaseSeen = time.Now()
+			return eb.lease, nil
+		}
+	}
+
+	var resp struct {
+		ID int64 `json:"ID,string"`
+	}
+
+	seconds := int64(ttl / time.Second)
+	if seconds <= 0 {
+		seconds = 1
+	}
+
+	err := eb.call(ctx, "/v3/lease/grant", map[string]interface{}{
+		"TTL": fmt.Sprint(seconds),
+	}, &resp)
+	if err != nil {
+		return 0, errors.Wrap(err, "grant lease")
+	}
+
+	eb.lease, eb.leaseTTL, eb.leaseSeen = resp.ID, ttl, time.Now()
+
+	return eb.lease, nil
+}
+
+func (eb *etcdBackend) authenticate(ctx context.Context) error {
+	var resp struct {
+		Token string `json:"token"`
+	}
+
+	err := eb.post(ctx, "/v3/auth/authenticate", map[string]interface{}{
+		"name":     eb.settings.Username,
+		"password": eb.settings.Password,
+	}, &resp)
+	if err != nil {
+		return errors.Wrap(err, "etcd authenticate")
+	}
+
+	eb.token = resp.Token
+
+	return nil
+}
+
+// call posts req, authenticating first when credentials are configured and
+// again once the token was rejected.
+func (eb *etcdBackend) call(ctx context.Context, path string, req, resp interface{}) error {
+	if eb.settings.Username != "" && eb.token == "" {
+		if err := eb.authenticate(ctx); err != nil {
+			return err
+		}
+	}
+
+	err := eb.post(ctx, path, req, resp)
+	if errors.Is(err, errEtcdUnauthorized) && eb.settings.Username != "" {
+		if err := eb.authenticate(ctx); err != nil {
+			return err
+		}
+
+		return eb.post(ctx, path, req, resp)
+	}
+
+	return err
+}
+
+var errEtcdUnauthorized = fmt.Errorf("%w: unauthorized", ErrBackend)
+
+func (eb *etcdBackend) post(ctx context.Context, path string, req, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "marshal request")
+	}
+
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, eb.settings.Addr+path, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "new request")
+	}
+
+	hreq.Header.Set("Content-Type", "application/json")
+	if eb.token != "" {
+		hreq.Header.Set("Authorization", eb.token)
+	}
+
+	hresp, err := eb.client.Do(hreq)
+	if err != nil {
+		return errors.Wrap(err, "request etcd")
+	}
+	defer hresp.Body.Close()
+
+	if hresp.StatusCode == http.StatusUnauthorized {
+		return errEtcdUnauthorized
+	}
+
+	if hresp.StatusCode != http.StatusOK {
+		var status struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(hresp.Body).Decode(&status)
+		return fmt.Errorf("%w: %s %d %s", ErrBackend, path, hresp.StatusCode, status.Message)
+	}
+
+	if resp == nil {
+		return nil
+	}
+
+	return errors.Wrap(json.NewDecoder(hresp.Body).Decode(resp), "decode response")
+}
@@ -0,0 +1,269 @@
+package registry
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	redisDialTimeout = 3 * time.Second
+	redisScanCount   = 100
+)
+
+// redisBackend speaks just enough RESP for the registry, commands are sent
+// one at a time over a single connection that is redialed after errors.
+type redisBackend struct {
+	settings Settings
+	lock     sync.Mutex
+	conn     net.Conn
+	r        *bufio.Reader
+}
+
+func newRedisBackend(settings Settings) (Backend, error) {
+	if settings.Addr == "" {
+		settings.Addr = "127.0.0.1:6379"
+	}
+
+	return &redisBackend{settings: settings}, nil
+}
+
+func (rb *redisBackend) Put(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := rb.do(ctx, "SET", key, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+func (rb *redisBackend) Delete(ctx context.Context, key string) error {
+	_, err := rb.do(ctx, "DEL", key)
+	return err
+}
+
+func (rb *redisBackend) List(ctx context.Context, prefix string) (map[string][]byte, error) {
+	var keys []string
+	cursor := "0"
+	for {
+		reply, err := rb.do(ctx, "SCAN", cursor, "MATCH", redisEscape(prefix)+"*", "COUNT", strconv.Itoa(redisScanCount))
+		if err != nil {
+			return nil, err
+		}
+
+		page, ok := reply.([]interface{})
+		if !ok || len(page) != 2 {
+			return nil, fmt.Errorf("%w: unexpected scan reply", ErrBackend)
+		}
+
+		cursor, _ = page[0].(string)
+		found, _ := page[1].([]interface{})
+		for _, k := range found {
+			if key, ok := k.(string); ok {
+				keys = append(keys, key)
+			}
+		}
+
+		if cursor == "0" || cursor == "" {
+			break
+		}
+	}
+
+	values := make(map[string][]byte, len(keys))
+	if len(keys) == 0 {
+		return values, nil
+	}
+
+	reply, err := rb.do(ctx, append([]string{"MGET"}, keys...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// keys expired since the scan come back as nil
+	items, _ := reply.([]interface{})
+	for i, item := range items {
+		if value, ok := item.(string); ok && i < len(keys) {
+			values[keys[i]] = []byte(value)
+		}
+	}
+
+	return values, nil
+}
+
+func (rb *redisBackend) Close() error {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	return rb.reset()
+}
+
+func (rb *redisBackend) reset() error {
+	if rb.conn == nil {
+		return nil
+	}
+
+	err := rb.conn.Close()
+	rb.conn, rb.r = nil, nil
+
+	return err
+}
+
+func (rb *redisBackend) dial(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: redisDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", rb.settings.Addr)
+	if err != nil {
+		return errors.Wrap(err, "dial redis")
+	}
+
+	rb.conn, rb.r = conn, bufio.NewReader(conn)
+
+	if rb.settings.Password != "" {
+		args := []string{"AUTH", rb.settings.Password}
+		if rb.settings.Username != "" {
+			args = []string{"AUTH", rb.settings.Username, rb.settings.Password}
+		}
+
+		if _, err := rb.roundTrip(ctx, args); err != nil {
+			rb.reset()
+			return errors.Wrap(err, "redis auth")
+		}
+	}
+
+	if rb.settings.DB != 0 {
+		if _, err := rb.roundTrip(ctx, []string{"SELECT", strconv.Itoa(rb.settings.DB)}); err != nil {
+			rb.reset()
+			return errors.Wrap(err, "redis select")
+		}
+	}
+
+	return nil
+}
+
+func (rb *redisBackend) do(ctx context.Context, args ...string) (interface{}, error) {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	if rb.conn == nil {
+		if err := rb.dial(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := rb.roundTrip(ctx, args)
+	if err != nil {
+		var replyErr redisError
+		if !errors.As(err, &replyErr) {
+			rb.reset()
+		}
+		return nil, err
+	}
+
+	return reply, nil
+}
+
+func (rb *redisBackend) roundTrip(ctx context.Context, args []string) (interface{}, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(redisDialTimeout)
+	}
+	rb.conn.SetDeadline(deadline)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if _, err := io.WriteString(rb.conn, b.String()); err != nil {
+		return nil, errors.Wrap(err, "write redis command")
+	}
+
+	return readRedisReply(rb.r)
+}
+
+type redisError string
+
+func (e redisError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrBackend, string(e))
+}
+
+func (e redisError) Unwrap() error {
+	return ErrBackend
+}
+
+// readRedisReply returns strings for simple and bulk strings, int64 for
+// integers, []interface{} for arrays and nil for null replies.
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, errors.Wrap(err, "read redis reply")
+	}
+
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("%w: empty reply", ErrBackend)
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid bulk length")
+		}
+
+		if n < 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, errors.Wrap(err, "read bulk string")
+		}
+
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid array length")
+		}
+
+		if n < 0 {
+			return nil, nil
+		}
+
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readRedisReply(r); err != nil {
+				return nil, err
+			}
+		}
+
+		return items, nil
+	default:
+		return nil, fmt.Errorf("%w: unexpected reply %q", ErrBackend, line)
+	}
+}
+
+// redisEscape quotes the glob characters of a SCAN pattern.
+func redisEscape(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,242 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultPrefix = "neon/"
+	defaultTTL    = 15 * time.Second
+)
+
+type Settings struct {
+	Backend    string `json:"backend" mapstructure:"backend"` // redis or etcd
+	Addr       string `json:"addr" mapstructure:"addr"`       // host:port for redis, base url for etcd
+	Username   string `json:"username" mapstructure:"username"`
+	Password   string `json:"password" mapstructure:"password"`
+	DB         int    `json:"db" mapstructure:"db"` // redis database
+	Prefix     string `json:"prefix" mapstructure:"prefix"`
+	TTLSeconds int    `json:"ttlSeconds" mapstructure:"ttlSeconds"`
+}
+
+// Backend is a key value store with expiring keys.
+type Backend interface {
+	Put(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) (map[string][]byte, error)
+	Close() error
+}
+
+type BackendFactory func(settings Settings) (Backend, error)
+
+var (
+	backends     = make(map[string]BackendFactory)
+	backendsLock sync.RWMutex
+)
+
+func RegisterBackend(name string, factory BackendFactory) {
+	backendsLock.Lock()
+	defer backendsLock.Unlock()
+
+	backends[strings.ToLower(name)] = factory
+}
+
+func init() {
+	RegisterBackend("redis", newRedisBackend)
+	RegisterBackend("etcd", newEtcdBackend)
+}
+
+// Entry announces a stream hosted by a node.
+type Entry struct {
+	Node      string    `json:"node"`
+	Namespace string    `json:"namespace"`
+	Stream    string    `json:"stream"`
+	URL       string    `json:"url"`    // pull url of the stream on the node
+	Origin    bool      `json:"origin"` // published on the node, not pulled from another one
+	Viewers   int       `json:"viewers"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Load is reported by every node, peers redirect subscribers to the least
+// loaded node.
+type Load struct {
+	Node      string    `json:"node"`
+	CPU       float64   `json:"cpu"`       // percent of all cores
+	EgressBps uint64    `json:"egressBps"` // bits per second
+	Sessions  int       `json:"sessions"`
+	Overload  bool      `json:"overload"` // over the thresholds of the node itself
+	RTSP      string    `json:"rtsp"`     // base url players are redirected to
+	WHEP      string    `json:"whep"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Registry tells which node hosts which stream. Nodes announce their streams
+// periodically, entries of a node that stopped announcing expire after TTL.
+type Registry struct {
+	backend Backend
+	prefix  string
+	ttl     time.Duration
+}
+
+func New(settings Settings) (*Registry, error) {
+	backendsLock.RLock()
+	factory, ok := backends[strings.ToLower(settings.Backend)]
+	backendsLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, settings.Backend)
+	}
+
+	backend, err := factory(settings)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create %s backend", settings.Backend)
+	}
+
+	r := &Registry{
+		backend: backend,
+		prefix:  settings.Prefix,
+		ttl:     time.Duration(settings.TTLSeconds) * time.Second,
+	}
+
+	if r.prefix == "" {
+		r.prefix = defaultPrefix
+	}
+
+	if r.ttl <= 0 {
+		r.ttl = defaultTTL
+	}
+
+	return r, nil
+}
+
+// TTL is how long an announcement lasts, nodes re-announce well within it.
+func (r *Registry) TTL() time.Duration {
+	return r.ttl
+}
+
+// stream paths may contain slashes, they are escaped so a stream prefix
+// never matches a longer stream path
+func (r *Registry) streamPrefix(namespace, stream string) string {
+	return r.prefix + "streams/" + url.PathEscape(namespace) + "/" + url.PathEscape(stream) + "/"
+}
+
+func (r *Registry) Announce(ctx context.Context, entry Entry) error {
+	entry.UpdatedAt = time.Now()
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "marshal entry")
+	}
+
+	return r.backend.Put(ctx, r.streamPrefix(entry.Namespace, entry.Stream)+url.PathEscape(entry.Node), value, r.ttl)
+}
+
+func (r *Registry) Withdraw(ctx context.Context, node, namespace, stream string) error {
+	return r.backend.Delete(ctx, r.streamPrefix(namespace, stream)+url.PathEscape(node))
+}
+
+// Lookup returns the nodes hosting a stream, origins first.
+func (r *Registry) Lookup(ctx context.Context, namespace, stream string) ([]Entry, error) {
+	entries, err := r.list(ctx, r.streamPrefix(namespace, stream))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: %s/%s", ErrNotFound, namespace, stream)
+	}
+
+	return entries, nil
+}
+
+// List returns the streams of the whole cluster.
+func (r *Registry) List(ctx context.Context) ([]Entry, error) {
+	return r.list(ctx, r.prefix+"streams/")
+}
+
+func (r *Registry) list(ctx context.Context, prefix string) ([]Entry, error) {
+	values, err := r.backend.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(values))
+	for _, value := range values {
+		var entry Entry
+		if err := json.Unmarshal(value, &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	sortEntries(entries)
+
+	return entries, nil
+}
+
+func (r *Registry) ReportLoad(ctx context.Context, load Load) error {
+	load.UpdatedAt = time.Now()
+	value, err := json.Marshal(load)
+	if err != nil {
+		return errors.Wrap(err, "marshal load")
+	}
+
+	return r.backend.Put(ctx, r.prefix+"nodes/"+url.PathEscape(load.Node), value, r.ttl)
+}
+
+// Loads returns the last load reports of all nodes, least loaded first.
+func (r *Registry) Loads(ctx context.Context) ([]Load, error) {
+	values, err := r.backend.List(ctx, r.prefix+"nodes/")
+	if err != nil {
+		return nil, err
+	}
+
+	loads := make([]Load, 0, len(values))
+	for _, value := range values {
+		var load Load
+		if err := json.Unmarshal(value, &load); err != nil {
+			continue
+		}
+		loads = append(loads, load)
+	}
+
+	sort.Slice(loads, func(i, j int) bool {
+		if loads[i].CPU != loads[j].CPU {
+			return loads[i].CPU < loads[j].CPU
+		}
+
+		return loads[i].EgressBps < loads[j].EgressBps
+	})
+
+	return loads, nil
+}
+
+func (r *Registry) Close() error {
+	return r.backend.Close()
+}
+
+func sortEntries(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+
+		if a.Stream != b.Stream {
+			return a.Stream < b.Stream
+		}
+
+		if a.Origin != b.Origin {
+			return a.Origin
+		}
+
+		return a.Node < b.Node
+	})
+}
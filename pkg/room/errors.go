@@ -0,0 +1,12 @@
+package room
+
+import "errors"
+
+var (
+	ErrRoomNotFound        = errors.New("room not found")
+	ErrRoomFull            = errors.New("room full")
+	ErrParticipantNotFound = errors.New("participant not found")
+	ErrAlreadyJoined       = errors.New("participant already joined")
+	ErrPermissionDenied    = errors.New("permission denied")
+	ErrInvalidRole         = errors.New("invalid role")
+)
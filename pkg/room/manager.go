@@ -0,0 +1,96 @@
+package room
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/eventbus"
+	"github.com/pingostack/neon/pkg/eventemitter"
+)
+
+// Manager holds the rooms, a room exists from its first participant joining
+// until the last one left.
+type Manager struct {
+	lock            sync.Mutex
+	rooms           map[string]*Room
+	maxParticipants int
+}
+
+// NewManager limits rooms to maxParticipants, 0 is no limit.
+func NewManager(maxParticipants int) *Manager {
+	return &Manager{
+		rooms:           make(map[string]*Room),
+		maxParticipants: maxParticipants,
+	}
+}
+
+// Join adds participant id to room, creating the room.
+func (m *Manager) Join(name, id string, role Role) (*Room, error) {
+	m.lock.Lock()
+	r, ok := m.rooms[name]
+	if !ok {
+		r = &Room{
+			name:            name,
+			maxParticipants: m.maxParticipants,
+			participants:    make(map[string]*participant),
+			createdAt:       time.Now(),
+			manager:         m,
+		}
+		m.rooms[name] = r
+	}
+
+	// under the manager lock, an emptied room is not removed meanwhile
+	err := r.join(id, role)
+	m.lock.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	eventemitter.Publish(eventbus.Default(), eventbus.TopicRoomJoin, eventbus.RoomEvent{
+		Room:        name,
+		Participant: id,
+		Role:        string(role),
+		Time:        time.Now(),
+	})
+
+	return r, nil
+}
+
+func (m *Manager) Lookup(name string) (*Room, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	r, ok := m.rooms[name]
+	if !ok {
+		return nil, ErrRoomNotFound
+	}
+
+	return r, nil
+}
+
+func (m *Manager) Rooms() []*Room {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	rooms := make([]*Room, 0, len(m.rooms))
+	for _, r := range m.rooms {
+		rooms = append(rooms, r)
+	}
+
+	return rooms
+}
+
+func (m *Manager) remove(r *Room) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	r.lock.Lock()
+	empty := len(r.participants) == 0
+	r.lock.Unlock()
+
+	if empty && m.rooms[r.name] == r {
+		delete(m.rooms, r.name)
+		r.publish(eventbus.TopicRoomClosed, "", "")
+	}
+}
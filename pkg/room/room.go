@@ -0,0 +1,308 @@
+// Package room groups publishers and subscribers of a call. Every participant
+// publishes at most one stream, named after the room and the participant,
+// and subscribes to the streams of the others.
+package room
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/eventbus"
+	"github.com/pingostack/neon/pkg/eventemitter"
+)
+
+type Role string
+
+const (
+	// RoleHost publishes, subscribes and removes other participants
+	RoleHost Role = "host"
+	// RoleSpeaker publishes and subscribes
+	RoleSpeaker Role = "speaker"
+	// RoleViewer only subscribes
+	RoleViewer Role = "viewer"
+)
+
+func ParseRole(s string) (Role, error) {
+	switch r := Role(s); r {
+	case RoleHost, RoleSpeaker, RoleViewer:
+		return r, nil
+	case "":
+		return RoleSpeaker, nil
+	}
+
+	return "", ErrInvalidRole
+}
+
+func (r Role) CanPublish() bool {
+	return r == RoleHost || r == RoleSpeaker
+}
+
+func (r Role) CanKick() bool {
+	return r == RoleHost
+}
+
+// Track is what a participant publishes.
+type Track struct {
+	Stream string `json:"stream"`
+	Audio  bool   `json:"audio"`
+	Video  bool   `json:"video"`
+}
+
+type ParticipantInfo struct {
+	ID       string    `json:"id"`
+	Role     Role      `json:"role"`
+	Tracks   []Track   `json:"tracks"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+type participant struct {
+	id       string
+	role     Role
+	joinedAt time.Time
+	// publisher is the session publishing the tracks of the participant
+	publisher router.Session
+	sessions  []router.Session
+}
+
+func (p *participant) info() ParticipantInfo {
+	info := ParticipantInfo{
+		ID:       p.id,
+		Role:     p.role,
+		Tracks:   []Track{},
+		JoinedAt: p.joinedAt,
+	}
+
+	if p.publisher != nil {
+		params := p.publisher.PeerParams()
+		info.Tracks = append(info.Tracks, Track{
+			Stream: p.publisher.RouterID(),
+			Audio:  params.HasAudio,
+			Video:  params.HasVideo,
+		})
+	}
+
+	return info
+}
+
+type Room struct {
+	name            string
+	maxParticipants int
+	lock            sync.Mutex
+	participants    map[string]*participant
+	createdAt       time.Time
+	manager         *Manager
+}
+
+func (r *Room) Name() string {
+	return r.name
+}
+
+// StreamName is the stream participant publishes.
+func (r *Room) StreamName(participant string) string {
+	return r.name + "." + participant
+}
+
+func (r *Room) Participants() []ParticipantInfo {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	infos := make([]ParticipantInfo, 0, len(r.participants))
+	for _, p := range r.participants {
+		infos = append(infos, p.info())
+	}
+
+	return infos
+}
+
+func (r *Room) Participant(id string) (ParticipantInfo, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	p, ok := r.participants[id]
+	if !ok {
+		return ParticipantInfo{}, ErrParticipantNotFound
+	}
+
+	return p.info(), nil
+}
+
+func (r *Room) join(id string, role Role) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.participants[id]; ok {
+		return ErrAlreadyJoined
+	}
+
+	if r.maxParticipants > 0 && len(r.participants) >= r.maxParticipants {
+		return ErrRoomFull
+	}
+
+	r.participants[id] = &participant{
+		id:       id,
+		role:     role,
+		joinedAt: time.Now(),
+	}
+
+	return nil
+}
+
+// Leave removes a participant and ends its sessions.
+func (r *Room) Leave(id string) error {
+	r.lock.Lock()
+	p, ok := r.participants[id]
+	if ok {
+		delete(r.participants, id)
+	}
+	empty := len(r.participants) == 0
+	r.lock.Unlock()
+
+	if !ok {
+		return ErrParticipantNotFound
+	}
+
+	for _, session := range p.sessions {
+		session.Finalize(nil)
+	}
+
+	r.publish(eventbus.TopicRoomLeave, id, "")
+
+	if empty {
+		r.manager.remove(r)
+	}
+
+	return nil
+}
+
+// Kick removes target on behalf of participant by.
+func (r *Room) Kick(by, target string) error {
+	r.lock.Lock()
+	p, ok := r.participants[by]
+	r.lock.Unlock()
+
+	if !ok {
+		return ErrParticipantNotFound
+	}
+
+	if !p.role.CanKick() {
+		return ErrPermissionDenied
+	}
+
+	return r.Leave(target)
+}
+
+// CanPublish checks participant may publish, before its session is created.
+func (r *Room) CanPublish(id string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	p, ok := r.participants[id]
+	if !ok {
+		return ErrParticipantNotFound
+	}
+
+	if !p.role.CanPublish() {
+		return ErrPermissionDenied
+	}
+
+	return nil
+}
+
+// CanSubscribe checks participant may play the stream of target.
+func (r *Room) CanSubscribe(id, target string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.participants[id]; !ok {
+		return ErrParticipantNotFound
+	}
+
+	if _, ok := r.participants[target]; !ok {
+		return ErrParticipantNotFound
+	}
+
+	return nil
+}
+
+// AddSession ties a joined session to participant, the session ends when the
+// participant leaves. A producer session publishes the tracks of the
+// participant until it ends.
+func (r *Room) AddSession(id string, session router.Session) error {
+	r.lock.Lock()
+	p, ok := r.participants[id]
+	if !ok {
+		r.lock.Unlock()
+		session.Finalize(ErrParticipantNotFound)
+		return ErrParticipantNotFound
+	}
+
+	p.sessions = append(p.sessions, session)
+	producer := session.PeerParams().Producer
+	var previous router.Session
+	if producer {
+		previous, p.publisher = p.publisher, session
+	}
+	r.lock.Unlock()
+
+	if previous != nil {
+		previous.Finalize(nil)
+	}
+
+	if producer {
+		r.publishTrack(eventbus.TopicRoomTrackPublished, id, session)
+	}
+
+	go func() {
+		<-session.Context().Done()
+		r.removeSession(id, session)
+	}()
+
+	return nil
+}
+
+func (r *Room) removeSession(id string, session router.Session) {
+	r.lock.Lock()
+	p, ok := r.participants[id]
+	unpublished := false
+	if ok {
+		for i, s := range p.sessions {
+			if s == session {
+				p.sessions = append(p.sessions[:i], p.sessions[i+1:]...)
+				break
+			}
+		}
+
+		if p.publisher == session {
+			p.publisher, unpublished = nil, true
+		}
+	}
+	r.lock.Unlock()
+
+	if unpublished {
+		r.publishTrack(eventbus.TopicRoomTrackUnpublished, id, session)
+	}
+}
+
+func (r *Room) publish(topic eventemitter.Topic[eventbus.RoomEvent], id, stream string) {
+	eventemitter.Publish(eventbus.Default(), topic, eventbus.RoomEvent{
+		Room:        r.name,
+		Participant: id,
+		Stream:      stream,
+		Time:        time.Now(),
+	})
+}
+
+func (r *Room) publishTrack(topic eventemitter.Topic[eventbus.RoomEvent], id string, session router.Session) {
+	e := eventbus.RoomEvent{
+		Room:        r.name,
+		Participant: id,
+		Stream:      session.RouterID(),
+		Time:        time.Now(),
+	}
+	if ns := session.GetNamespace(); ns != nil {
+		e.Namespace = ns.Name()
+	}
+
+	eventemitter.Publish(eventbus.Default(), topic, e)
+}
@@ -0,0 +1,254 @@
+package rtclib
+
+import (
+	"errors"
+
+	"github.com/pion/rtp/codecs/av1/obu"
+)
+
+// av1 obu types, see section 6.2.2 of the av1 bitstream specification
+const (
+	obuSequenceHeader    = 1
+	obuTemporalDelimiter = 2
+)
+
+// RFC draft av1-rtp-spec aggregation header
+const (
+	av1Z = 0x80
+	av1Y = 0x40
+	av1N = 0x08
+)
+
+var errShortAV1Packet = errors.New("short av1 packet")
+
+// av1Depacketizer passes the payload of every packet with a 2 byte length in
+// front, the obu elements are put together by assembleAV1 once the sample is
+// complete, fragments may span packets.
+type av1Depacketizer struct{}
+
+func (av1Depacketizer) Unmarshal(payload []byte) ([]byte, error) {
+	if len(payload) < 2 {
+		return nil, errShortAV1Packet
+	}
+
+	return append([]byte{byte(len(payload) >> 8), byte(len(payload))}, payload...), nil
+}
+
+func (av1Depacketizer) IsPartitionHead(payload []byte) bool {
+	return len(payload) > 0 && payload[0]&av1Z == 0
+}
+
+func (av1Depacketizer) IsPartitionTail(marker bool, _ []byte) bool {
+	return marker
+}
+
+// assembleAV1 returns the temporal unit of the packets of a sample, obus in
+// the low overhead format, size fields set and temporal delimiters removed.
+func assembleAV1(data []byte) []byte {
+	var out, fragment []byte
+
+	for len(data) >= 2 {
+		size := int(data[0])<<8 | int(data[1])
+		if len(data) < 2+size {
+			break
+		}
+		payload := data[2 : 2+size]
+		data = data[2+size:]
+
+		elements, err := av1Elements(payload)
+		if err != nil {
+			return nil
+		}
+
+		for i, element := range elements {
+			if i == 0 && payload[0]&av1Z != 0 {
+				element = append(fragment, element...)
+				fragment = nil
+			} else if fragment != nil {
+				// the continuation of a fragment was lost
+				fragment = nil
+			}
+
+			if i == len(elements)-1 && payload[0]&av1Y != 0 {
+				fragment = append([]byte{}, element...)
+				continue
+			}
+
+			out = appendOBU(out, element)
+		}
+	}
+
+	return out
+}
+
+// av1Elements splits the obu elements of a packet.
+func av1Elements(payload []byte) ([][]byte, error) {
+	w := int(payload[0]&0x30) >> 4
+	payload = payload[1:]
+
+	var elements [][]byte
+	for i := 1; len(payload) > 0; i++ {
+		size := uint(len(payload))
+		if i != w {
+			n, read, err := obu.ReadLeb128(payload)
+			if err != nil {
+				return nil, err
+			}
+			size, payload = n, payload[read:]
+		}
+
+		if uint(len(payload)) < size {
+			return nil, errShortAV1Packet
+		}
+		elements = append(elements, payload[:size])
+		payload = payload[size:]
+	}
+
+	return elements, nil
+}
+
+// appendOBU appends an obu with its size field set, temporal delimiters are
+// dropped.
+func appendOBU(out, o []byte) []byte {
+	if len(o) == 0 {
+		return out
+	}
+
+	header := 1
+	if o[0]&0x04 != 0 {
+		header++
+	}
+	if len(o) < header || int(o[0]>>3)&0x0f == obuTemporalDelimiter {
+		return out
+	}
+
+	if o[0]&0x02 != 0 {
+		return append(out, o...)
+	}
+
+	out = append(out, o[0]|0x02)
+	out = append(out, o[1:header]...)
+	out = appendLeb128(out, uint64(len(o)-header))
+
+	return append(out, o[header:]...)
+}
+
+func appendLeb128(out []byte, v uint64) []byte {
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func leb128Len(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+
+	return n
+}
+
+// splitOBUs returns the obus of a temporal unit in the low overhead format.
+func splitOBUs(data []byte) [][]byte {
+	var obus [][]byte
+
+	for len(data) > 0 {
+		header := 1
+		if data[0]&0x04 != 0 {
+			header++
+		}
+		if len(data) < header {
+			break
+		}
+
+		size := uint(len(data) - header)
+		if data[0]&0x02 != 0 {
+			n, read, err := obu.ReadLeb128(data[header:])
+			if err != nil || uint(len(data)-header)-read < n {
+				break
+			}
+			size, header = n, header+int(read)
+		}
+
+		obus = append(obus, data[:header+int(size)])
+		data = data[header+int(size):]
+	}
+
+	return obus
+}
+
+// av1Payloader packetizes temporal units in the low overhead format, every
+// obu an element with its length in front. Temporal delimiters are not
+// sent.
+type av1Payloader struct{}
+
+func (av1Payloader) Payload(mtu uint16, payload []byte) [][]byte {
+	var payloads [][]byte
+	var current []byte
+	sequence := false
+
+	flush := func(y bool) {
+		if current == nil {
+			return
+		}
+		if y {
+			current[0] |= av1Y
+		}
+		payloads = append(payloads, current)
+		current = nil
+	}
+
+	for _, o := range splitOBUs(payload) {
+		switch int(o[0]>>3) & 0x0f {
+		case obuTemporalDelimiter:
+			continue
+		case obuSequenceHeader:
+			sequence = true
+		}
+
+		continued := false
+		for len(o) > 0 {
+			if current == nil {
+				current = []byte{0}
+				if continued {
+					current[0] |= av1Z
+				}
+			}
+
+			n := int(mtu) - len(current) - leb128Len(uint64(len(o)))
+			if n <= 0 {
+				if len(current) == 1 {
+					return nil
+				}
+				flush(false)
+				continue
+			}
+			if n > len(o) {
+				n = len(o)
+			}
+
+			current = appendLeb128(current, uint64(n))
+			current = append(current, o[:n]...)
+			o = o[n:]
+
+			if len(o) > 0 {
+				flush(true)
+				continued = true
+			}
+		}
+	}
+	flush(false)
+
+	if len(payloads) > 0 && sequence {
+		// a new coded video sequence starts with the sequence header
+		payloads[0][0] |= av1N
+	}
+
+	return payloads
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/pingostack/neon/pkg/impair"
 	"github.com/pion/webrtc/v4"
 )
 
@@ -247,6 +248,7 @@ type Settings struct {
 	AutoGenerateExternalIP  bool             `json:"autoGenerateExternalIp,omitempty" yaml:"autoGenerateExternalIp,omitempty" mapstructure:"autoGenerateExternalIp,omitempty"`
 	ICEPortRange            PortRange        `json:"icePortRange,omitempty" yaml:"icePortRange,omitempty" mapstructure:"icePortRange,omitempty"`
 	UDPMuxPort              PortRange        `json:"udpMuxPort,omitempty" yaml:"udpMuxPort,omitempty" mapstructure:"udpMuxPort,omitempty"`
+	SharedPorts             bool             `json:"sharedPorts,omitempty" yaml:"sharedPorts,omitempty" mapstructure:"sharedPorts,omitempty"`
 	TCPPort                 int              `json:"tcpPort,omitempty" yaml:"tcpPort,omitempty" mapstructure:"tcpPort,omitempty"`
 	ICEServers              []ICEServer      `json:"iceServers,omitempty" yaml:"iceServers,omitempty" mapstructure:"iceServers,omitempty"`
 	Interfaces              InterfacesConfig `json:"interfaces,omitempty" yaml:"interfaces,omitempty" mapstructure:"interfaces,omitempty"`
@@ -256,12 +258,19 @@ type Settings struct {
 	BatchIO                 BatchIOConfig    `json:"batch_io,omitempty" yaml:"batch_io,omitempty" mapstructure:"batch_io,omitempty"`
 	ForceTCP                bool             `json:"force_tcp,omitempty" yaml:"force_tcp,omitempty" mapstructure:"force_tcp,omitempty"`
 	ICEConfig               ICEConfig        `json:"ice_config,omitempty" yaml:"ice_config,omitempty" mapstructure:"ice_config,omitempty"`
+	DTLS                    DTLSConfig       `json:"dtls,omitempty" yaml:"dtls,omitempty" mapstructure:"dtls,omitempty"`
+	// CodecPreferences order the codecs of the answers, e.g.
+	// video/H264;profile-level-id=42e01f first, see sdpassistor.PreferCodecs.
+	CodecPreferences []string `json:"codecPreferences,omitempty" yaml:"codecPreferences,omitempty" mapstructure:"codecPreferences,omitempty"`
+	// Impairment degrades the udp of ice on purpose, for debugging nack, fec
+	// and bitrate adaptation. The udp mux is not impaired.
+	Impairment impair.Settings `json:"impairment,omitempty" yaml:"impairment,omitempty" mapstructure:"impairment,omitempty"`
 }
 
 func (settings *Settings) Validate() error {
-	if !settings.ICEPortRange.Valid() && !settings.UDPMuxPort.Valid() {
+	if !settings.SharedPorts && !settings.ICEPortRange.Valid() && !settings.UDPMuxPort.Valid() {
 		settings.UDPMuxPort.Validate()
 	}
 
-	return nil
+	return settings.DTLS.Validate()
 }
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pion/dtls/v2"
+	"github.com/pion/dtls/v2/pkg/crypto/elliptic"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	DTLSProfileDefault = "default"
+	DTLSProfileStrict  = "strict"
+	DTLSProfileCompat  = "compat"
+
+	defaultDTLSRetransmissionInterval = 100 * time.Millisecond
+	defaultDTLSHandshakeTimeout       = 30 * time.Second
+)
+
+var srtpProfiles = map[string]dtls.SRTPProtectionProfile{
+	"AES128_CM_HMAC_SHA1_80": dtls.SRTP_AES128_CM_HMAC_SHA1_80,
+	"AES128_CM_HMAC_SHA1_32": dtls.SRTP_AES128_CM_HMAC_SHA1_32,
+	"AEAD_AES_128_GCM":       dtls.SRTP_AEAD_AES_128_GCM,
+	"AEAD_AES_256_GCM":       dtls.SRTP_AEAD_AES_256_GCM,
+}
+
+var ellipticCurves = map[string]elliptic.Curve{
+	"X25519": elliptic.X25519,
+	"P256":   elliptic.P256,
+	"P384":   elliptic.P384,
+}
+
+var extendedMasterSecrets = map[string]dtls.ExtendedMasterSecretType{
+	"request": dtls.RequestExtendedMasterSecret,
+	"require": dtls.RequireExtendedMasterSecret,
+	"disable": dtls.DisableExtendedMasterSecret,
+}
+
+// DTLSConfig hardens the DTLS-SRTP handshake. Profile sets the defaults,
+// every other field overrides it.
+type DTLSConfig struct {
+	Profile                  string   `json:"profile,omitempty" yaml:"profile,omitempty" mapstructure:"profile,omitempty"`
+	SRTPProfiles             []string `json:"srtpProfiles,omitempty" yaml:"srtpProfiles,omitempty" mapstructure:"srtpProfiles,omitempty"`
+	EllipticCurves           []string `json:"ellipticCurves,omitempty" yaml:"ellipticCurves,omitempty" mapstructure:"ellipticCurves,omitempty"`
+	ExtendedMasterSecret     string   `json:"extendedMasterSecret,omitempty" yaml:"extendedMasterSecret,omitempty" mapstructure:"extendedMasterSecret,omitempty"`
+	HandshakeTimeoutSeconds  int      `json:"handshakeTimeoutSeconds,omitempty" yaml:"handshakeTimeoutSeconds,omitempty" mapstructure:"handshakeTimeoutSeconds,omitempty"`
+	RetransmissionIntervalMs int      `json:"retransmissionIntervalMs,omitempty" yaml:"retransmissionIntervalMs,omitempty" mapstructure:"retransmissionIntervalMs,omitempty"`
+	// SkipFingerprintVerification disables checking the remote certificate against the SDP fingerprint.
+	SkipFingerprintVerification bool `json:"skipFingerprintVerification,omitempty" yaml:"skipFingerprintVerification,omitempty" mapstructure:"skipFingerprintVerification,omitempty"`
+	// PinnedFingerprints are sha-256 fingerprints, e.g. "AB:CD:..", the remote certificate must match one of.
+	PinnedFingerprints []string `json:"pinnedFingerprints,omitempty" yaml:"pinnedFingerprints,omitempty" mapstructure:"pinnedFingerprints,omitempty"`
+	// Cert and Key keep the local fingerprint stable across restarts.
+	Cert string `json:"cert,omitempty" yaml:"cert,omitempty" mapstructure:"cert,omitempty"`
+	Key  string `json:"key,omitempty" yaml:"key,omitempty" mapstructure:"key,omitempty"`
+
+	srtpProfiles         []dtls.SRTPProtectionProfile
+	ellipticCurves       []elliptic.Curve
+	extendedMasterSecret dtls.ExtendedMasterSecretType
+	handshakeTimeout     time.Duration
+	retransmission       time.Duration
+}
+
+func (dc *DTLSConfig) Validate() error {
+	switch dc.Profile {
+	case "", DTLSProfileDefault:
+		dc.Profile = DTLSProfileDefault
+		dc.setDefaults([]string{"AEAD_AES_128_GCM", "AES128_CM_HMAC_SHA1_80"}, []string{"X25519", "P384", "P256"}, "request")
+	case DTLSProfileStrict:
+		dc.setDefaults([]string{"AEAD_AES_256_GCM", "AEAD_AES_128_GCM"}, []string{"X25519", "P256"}, "require")
+	case DTLSProfileCompat:
+		dc.setDefaults([]string{"AEAD_AES_128_GCM", "AES128_CM_HMAC_SHA1_80", "AES128_CM_HMAC_SHA1_32"}, []string{"X25519", "P384", "P256"}, "request")
+	default:
+		return fmt.Errorf("unknown dtls profile %s", dc.Profile)
+	}
+
+	dc.srtpProfiles = dc.srtpProfiles[:0]
+	for _, name := range dc.SRTPProfiles {
+		p, ok := srtpProfiles[strings.ToUpper(name)]
+		if !ok {
+			return fmt.Errorf("unknown srtp profile %s", name)
+		}
+		dc.srtpProfiles = append(dc.srtpProfiles, p)
+	}
+
+	dc.ellipticCurves = dc.ellipticCurves[:0]
+	for _, name := range dc.EllipticCurves {
+		c, ok := ellipticCurves[strings.ToUpper(name)]
+		if !ok {
+			return fmt.Errorf("unknown elliptic curve %s", name)
+		}
+		dc.ellipticCurves = append(dc.ellipticCurves, c)
+	}
+
+	ems, ok := extendedMasterSecrets[strings.ToLower(dc.ExtendedMasterSecret)]
+	if !ok {
+		return fmt.Errorf("unknown extended master secret policy %s", dc.ExtendedMasterSecret)
+	}
+	dc.extendedMasterSecret = ems
+
+	dc.handshakeTimeout = defaultDTLSHandshakeTimeout
+	if dc.HandshakeTimeoutSeconds > 0 {
+		dc.handshakeTimeout = time.Duration(dc.HandshakeTimeoutSeconds) * time.Second
+	}
+
+	dc.retransmission = defaultDTLSRetransmissionInterval
+	if dc.RetransmissionIntervalMs > 0 {
+		dc.retransmission = time.Duration(dc.RetransmissionIntervalMs) * time.Millisecond
+	}
+
+	for i, fp := range dc.PinnedFingerprints {
+		dc.PinnedFingerprints[i] = normalizeFingerprint(fp)
+	}
+
+	if (dc.Cert == "") != (dc.Key == "") {
+		return fmt.Errorf("dtls cert and key must be set together")
+	}
+
+	return nil
+}
+
+func (dc *DTLSConfig) setDefaults(srtp, curves []string, ems string) {
+	if len(dc.SRTPProfiles) == 0 {
+		dc.SRTPProfiles = srtp
+	}
+
+	if len(dc.EllipticCurves) == 0 {
+		dc.EllipticCurves = curves
+	}
+
+	if dc.ExtendedMasterSecret == "" {
+		dc.ExtendedMasterSecret = ems
+	}
+}
+
+// Apply sets the handshake options on se, Validate must have succeeded.
+func (dc *DTLSConfig) Apply(se *webrtc.SettingEngine) {
+	se.SetSRTPProtectionProfiles(dc.srtpProfiles...)
+	se.SetDTLSEllipticCurves(dc.ellipticCurves...)
+	se.SetDTLSExtendedMasterSecret(dc.extendedMasterSecret)
+	se.SetDTLSRetransmissionInterval(dc.retransmission)
+	se.DisableCertificateFingerprintVerification(dc.SkipFingerprintVerification)
+
+	timeout := dc.handshakeTimeout
+	se.SetDTLSConnectContextMaker(func() (context.Context, func()) {
+		return context.WithTimeout(context.Background(), timeout)
+	})
+}
+
+// Certificates loads the local certificate, nil lets pion generate one per peer connection.
+func (dc *DTLSConfig) Certificates() ([]webrtc.Certificate, error) {
+	if dc.Cert == "" {
+		return nil, nil
+	}
+
+	pair, err := tls.LoadX509KeyPair(dc.Cert, dc.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return []webrtc.Certificate{webrtc.CertificateFromX509(pair.PrivateKey, leaf)}, nil
+}
+
+// VerifyPinned checks a DER encoded remote certificate against PinnedFingerprints.
+func (dc *DTLSConfig) VerifyPinned(der []byte) bool {
+	if len(dc.PinnedFingerprints) == 0 {
+		return true
+	}
+
+	sum := sha256.Sum256(der)
+	fp := make([]string, len(sum))
+	for i, b := range sum {
+		fp[i] = fmt.Sprintf("%02X", b)
+	}
+
+	actual := strings.Join(fp, ":")
+	for _, pinned := range dc.PinnedFingerprints {
+		if pinned == actual {
+			return true
+		}
+	}
+
+	return false
+}
+
+func normalizeFingerprint(fp string) string {
+	fp = strings.TrimSpace(fp)
+	if i := strings.IndexByte(fp, ' '); i >= 0 {
+		fp = fp[i+1:] // drop the "sha-256 " algorithm prefix
+	}
+
+	return strings.ToUpper(fp)
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"net"
+	"sync"
+
+	"github.com/pingostack/neon/pkg/udp"
+	"github.com/pion/transport/v3"
+	"github.com/pion/transport/v3/stdnet"
+)
+
+// portsNet lets ICE take its host candidate ports from the shared allocator,
+// every other socket goes to the standard network.
+type portsNet struct {
+	*stdnet.Net
+	ports *udp.PortAllocator
+}
+
+func newPortsNet(ports *udp.PortAllocator) (*portsNet, error) {
+	n, err := stdnet.NewNet()
+	if err != nil {
+		return nil, err
+	}
+
+	return &portsNet{Net: n, ports: ports}, nil
+}
+
+func (n *portsNet) ListenUDP(network string, locAddr *net.UDPAddr) (transport.UDPConn, error) {
+	if locAddr != nil && locAddr.Port != 0 {
+		return n.Net.ListenUDP(network, locAddr)
+	}
+
+	var ip net.IP
+	if locAddr != nil {
+		ip = locAddr.IP
+	}
+
+	conn, err := n.ports.Allocate(network, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	return &portsConn{UDPConn: conn, ports: n.ports}, nil
+}
+
+type portsConn struct {
+	*net.UDPConn
+	ports *udp.PortAllocator
+	once  sync.Once
+}
+
+func (c *portsConn) Close() error {
+	err := c.UDPConn.Close()
+	c.once.Do(func() {
+		c.ports.Release(c.LocalAddr().(*net.UDPAddr).Port)
+	})
+
+	return err
+}
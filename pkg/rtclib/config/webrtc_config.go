@@ -10,8 +10,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/pingostack/neon/pkg/impair"
 	"github.com/pingostack/neon/pkg/logger"
+	"github.com/pingostack/neon/pkg/udp"
 	"github.com/pion/ice/v3"
+	"github.com/pion/transport/v3"
+	"github.com/pion/transport/v3/stdnet"
 	"github.com/pion/webrtc/v4"
 	"github.com/sirupsen/logrus"
 )
@@ -23,6 +27,7 @@ type WebRTCConfig struct {
 	TCPMuxListener *net.TCPListener
 	NAT1To1IPs     []string
 	UseMDNS        bool
+	DTLS           *DTLSConfig
 }
 
 func NewWebRTCConfig(settings *Settings) (*WebRTCConfig, error) {
@@ -103,24 +108,50 @@ func NewWebRTCConfig(settings *Settings) (*WebRTCConfig, error) {
 
 	se.SetLite(settings.UseICELite)
 
+	certificates, err := settings.DTLS.Certificates()
+	if err != nil {
+		return nil, err
+	}
+	c.Certificates = certificates
+
 	var udpMux ice.UDPMux
-	var err error
 	networkTypes := make([]webrtc.NetworkType, 0, 4)
 
 	if !settings.ForceTCP {
 		networkTypes = append(networkTypes,
 			webrtc.NetworkTypeUDP4, webrtc.NetworkTypeUDP6,
 		)
-		if settings.ICEPortRange.Valid() {
+		if settings.SharedPorts {
+			ports := udp.DefaultPorts()
+			if ports == nil {
+				return nil, errors.New("sharedPorts is set but no ports range is configured")
+			}
+
+			n, err := newPortsNet(ports)
+			if err != nil {
+				return nil, err
+			}
+			se.SetNet(impairedNet(n, &settings.Impairment))
+		} else if settings.ICEPortRange.Valid() {
 			if err := se.SetEphemeralUDPPortRange(uint16(settings.ICEPortRange.StartPort()), uint16(settings.ICEPortRange.EndPort())); err != nil {
 				return nil, err
 			}
+			if settings.Impairment.Enabled() {
+				n, err := stdnet.NewNet()
+				if err != nil {
+					return nil, err
+				}
+				se.SetNet(impairedNet(n, &settings.Impairment))
+			}
 		} else if settings.UDPMuxPort.Valid() {
 			udpMux, err = getICEUDPMux(settings, &se, ipFilter, ifFilter)
 			if err != nil {
 				return nil, err
 			}
 			se.SetICEUDPMux(udpMux)
+			if settings.Impairment.Enabled() {
+				logger.Warn("impairment is not applied to the udp mux, configure icePortRange or sharedPorts")
+			}
 		}
 	}
 
@@ -163,9 +194,21 @@ func NewWebRTCConfig(settings *Settings) (*WebRTCConfig, error) {
 		TCPMuxListener: tcpListener,
 		NAT1To1IPs:     nat1to1IPs,
 		UseMDNS:        settings.UseMDNS,
+		DTLS:           &settings.DTLS,
 	}, nil
 }
 
+// impairedNet is n with the impairment, n when there is none.
+func impairedNet(n transport.Net, settings *impair.Settings) transport.Net {
+	if !settings.Enabled() {
+		return n
+	}
+
+	logger.Warnf("impairing webrtc udp, send %+v, receive %+v", settings.Send, settings.Receive)
+
+	return impair.NewNet(n, *settings)
+}
+
 func validateNat1to1IPs(ips []string) []string {
 	var validIPs []string
 	natMapping := make(map[string]string)
@@ -234,7 +277,7 @@ func getNAT1to1IPsForConf(settings *Settings, ipFilter func(net.IP) bool) ([]str
 		for i := 0; i < 5; i++ {
 			udpPorts = append(udpPorts, rand.Intn(int(portRangeEnd-portRangeStart))+int(portRangeStart))
 		}
-	} else if settings.UDPMuxPort.Valid() {
+	} else if settings.UDPMuxPort.Valid() && !settings.SharedPorts {
 		udpPorts = append(udpPorts, settings.UDPMuxPort.StartPort())
 	} else {
 		udpPorts = append(udpPorts, 0)
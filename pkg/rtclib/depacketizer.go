@@ -0,0 +1,193 @@
+package rtclib
+
+import (
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/rtclib/rtcerror"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4/pkg/media/samplebuilder"
+)
+
+const (
+	// packets a frame may be late before it is given up
+	maxLatePackets = 128
+)
+
+// Depacketizer assembles the rtp packets of a track into raw frames, h264 as
+// annex b and av1 as obus of the low overhead format.
+type Depacketizer struct {
+	codec     deliver.CodecType
+	clockRate uint32
+	channels  uint8
+	builder   *samplebuilder.SampleBuilder
+}
+
+func NewDepacketizer(codec deliver.CodecType, clockRate uint32, channels uint8) (*Depacketizer, error) {
+	var depacketizer rtp.Depacketizer
+
+	switch codec {
+	case deliver.CodecTypeH264:
+		depacketizer = &codecs.H264Packet{}
+	case deliver.CodecTypeVP8:
+		depacketizer = &codecs.VP8Packet{}
+	case deliver.CodecTypeVP9:
+		depacketizer = &codecs.VP9Packet{}
+	case deliver.CodecTypeAV1:
+		depacketizer = av1Depacketizer{}
+	case deliver.CodecTypeOpus:
+		depacketizer = &codecs.OpusPacket{}
+	case deliver.CodecTypePCMU, deliver.CodecTypePCMA, deliver.CodecTypeG722_16000_1, deliver.CodecTypeG722_16000_2:
+		depacketizer = &samplesDepacketizer{}
+	default:
+		return nil, rtcerror.ErrUnsupportedCodec
+	}
+
+	return &Depacketizer{
+		codec:     codec,
+		clockRate: clockRate,
+		channels:  channels,
+		builder:   samplebuilder.New(maxLatePackets, guardedDepacketizer{depacketizer}, clockRate),
+	}, nil
+}
+
+// Push adds a packet, the packet must not be reused by the caller. It
+// returns the frames the packet completed.
+func (d *Depacketizer) Push(packet *rtp.Packet) []deliver.Frame {
+	d.builder.Push(packet)
+
+	var frames []deliver.Frame
+	for sample := d.builder.Pop(); sample != nil; sample = d.builder.Pop() {
+		if d.codec == deliver.CodecTypeAV1 {
+			if sample.Data = assembleAV1(sample.Data); len(sample.Data) == 0 {
+				continue
+			}
+		}
+
+		frame := deliver.Frame{
+			Codec:      d.codec,
+			PacketType: deliver.PacketTypeRaw,
+			Payload:    sample.Data,
+			Length:     len(sample.Data),
+			TimeStamp:  sample.PacketTimestamp,
+		}
+
+		if d.codec.IsVideo() {
+			frame.AdditionalInfo = &deliver.VideoFrameSpecificInfo{
+				IsKeyFrame: isRawKeyframe(d.codec, sample.Data),
+			}
+		} else {
+			frame.AdditionalInfo = &deliver.AudioFrameSpecificInfo{
+				NbSamples:  uint32(sample.Duration.Seconds() * float64(d.clockRate)),
+				SampleRate: d.clockRate,
+				Channels:   d.channels,
+			}
+		}
+
+		frames = append(frames, frame)
+	}
+
+	return frames
+}
+
+func isRawKeyframe(codec deliver.CodecType, data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+
+	switch codec {
+	case deliver.CodecTypeH264:
+		return annexbHasNALU(data, func(header byte) bool {
+			t := header & 0x1f
+			return t == 5 || t == 7
+		})
+	case deliver.CodecTypeVP8:
+		return data[0]&0x01 == 0
+	case deliver.CodecTypeVP9:
+		return vp9RawKeyframe(data)
+	case deliver.CodecTypeAV1:
+		// encoders send the sequence header with every keyframe
+		for _, o := range splitOBUs(data) {
+			if int(o[0]>>3)&0x0f == obuSequenceHeader {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// vp9RawKeyframe reads the frame type of the uncompressed header.
+func vp9RawKeyframe(data []byte) bool {
+	b := data[0]
+	if b>>6 != 0x02 {
+		return false
+	}
+
+	// profile 3 has a reserved bit before show_existing_frame
+	profile := (b>>5)&0x01 | (b>>3)&0x02
+	bit := 3
+	if profile == 3 {
+		bit = 2
+	}
+	if b>>uint(bit)&0x01 != 0 {
+		return false
+	}
+
+	return b>>uint(bit-1)&0x01 == 0
+}
+
+func annexbHasNALU(data []byte, match func(header byte) bool) bool {
+	for i := 0; i+3 < len(data); i++ {
+		if data[i] != 0 || data[i+1] != 0 {
+			continue
+		}
+
+		if data[i+2] == 1 {
+			if match(data[i+3]) {
+				return true
+			}
+			i += 2
+		} else if data[i+2] == 0 && i+4 < len(data) && data[i+3] == 1 {
+			if match(data[i+4]) {
+				return true
+			}
+			i += 3
+		}
+	}
+
+	return false
+}
+
+// guardedDepacketizer fails the payloads the depacketizer panics on, e.g. a
+// truncated STAP-A of pion's H264Packet, the sample builder drops their
+// frame.
+type guardedDepacketizer struct {
+	rtp.Depacketizer
+}
+
+func (g guardedDepacketizer) Unmarshal(payload []byte) (data []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			data, err = nil, rtcerror.ErrPanics
+		}
+	}()
+
+	return g.Depacketizer.Unmarshal(payload)
+}
+
+// samplesDepacketizer passes the payload of codecs carrying whole samples in
+// every packet, e.g. g711.
+type samplesDepacketizer struct{}
+
+func (samplesDepacketizer) Unmarshal(payload []byte) ([]byte, error) {
+	return payload, nil
+}
+
+func (samplesDepacketizer) IsPartitionHead(_ []byte) bool {
+	return true
+}
+
+func (samplesDepacketizer) IsPartitionTail(_ bool, _ []byte) bool {
+	return true
+}
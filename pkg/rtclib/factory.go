@@ -58,11 +58,12 @@ func NewTransportFactory(settings config.Settings) StreamFactory {
 }
 
 func (f *FactoryImpl) NewRemoteStream(params RemoteStreamParams) (*RemoteStream, error) {
-	em := eventemitter.NewEventEmitter(params.Ctx, defaultEventEmitterLength, params.Logger)
+	em := eventemitter.NewEventEmitter(params.Ctx, defaultEventEmitterLength, params.Logger, eventemitter.WithName("rtc-transport"))
 
 	transport, err := transport.NewTransport(transport.WithWebRTCConfig(f.webrtcConfig),
 		transport.WithConnConfig(&f.settings.ICEConfig),
 		transport.WithAllowedCodecs(params.AllowdCodecs),
+		transport.WithCodecPreferences(f.settings.CodecPreferences),
 		transport.WithLogger(params.Logger),
 		transport.WithContext(params.Ctx),
 		transport.WithEventEmitter(em))
@@ -81,11 +82,12 @@ func (f *FactoryImpl) NewRemoteStream(params RemoteStreamParams) (*RemoteStream,
 }
 
 func (f *FactoryImpl) NewLocalStream(params LocalStreamParams) (*LocalStream, error) {
-	em := eventemitter.NewEventEmitter(params.Ctx, defaultEventEmitterLength, params.Logger)
+	em := eventemitter.NewEventEmitter(params.Ctx, defaultEventEmitterLength, params.Logger, eventemitter.WithName("rtc-transport"))
 
 	transport, err := transport.NewTransport(transport.WithWebRTCConfig(f.webrtcConfig),
 		transport.WithConnConfig(&f.settings.ICEConfig),
 		transport.WithAllowedCodecs(params.AllowdCodecs),
+		transport.WithCodecPreferences(f.settings.CodecPreferences),
 		transport.WithLogger(params.Logger),
 		transport.WithContext(params.Ctx),
 		transport.WithEventEmitter(em))
@@ -0,0 +1,93 @@
+// Package fec implements the redundancy and forward error correction
+// payloads of webrtc video and audio: red of RFC 2198 and ulpfec of RFC 5109.
+package fec
+
+import (
+	"errors"
+)
+
+var ErrInvalidRED = errors.New("invalid red payload")
+
+// REDBlock is a block of a red payload. Redundant blocks repeat an earlier
+// payload, TimestampOffset behind the packet.
+type REDBlock struct {
+	PayloadType     uint8
+	TimestampOffset uint16
+	Payload         []byte
+}
+
+// MarshalRED encodes blocks oldest first, the last block is the primary one
+// and carries no offset or length.
+func MarshalRED(blocks []REDBlock) ([]byte, error) {
+	if len(blocks) == 0 {
+		return nil, ErrInvalidRED
+	}
+
+	size := 1
+	for _, b := range blocks[:len(blocks)-1] {
+		if len(b.Payload) > 0x3ff || b.TimestampOffset > 0x3fff {
+			return nil, ErrInvalidRED
+		}
+		size += 4 + len(b.Payload)
+	}
+	size += len(blocks[len(blocks)-1].Payload)
+
+	buf := make([]byte, 0, size)
+	for _, b := range blocks[:len(blocks)-1] {
+		buf = append(buf,
+			0x80|b.PayloadType&0x7f,
+			byte(b.TimestampOffset>>6),
+			byte(b.TimestampOffset<<2)|byte(len(b.Payload)>>8),
+			byte(len(b.Payload)))
+	}
+
+	primary := blocks[len(blocks)-1]
+	buf = append(buf, primary.PayloadType&0x7f)
+	for _, b := range blocks {
+		buf = append(buf, b.Payload...)
+	}
+
+	return buf, nil
+}
+
+// UnmarshalRED decodes a red payload oldest block first, the payloads alias
+// payload.
+func UnmarshalRED(payload []byte) ([]REDBlock, error) {
+	var blocks []REDBlock
+	var lengths []int
+	offset := 0
+	for {
+		if offset >= len(payload) {
+			return nil, ErrInvalidRED
+		}
+
+		if payload[offset]&0x80 == 0 {
+			blocks = append(blocks, REDBlock{PayloadType: payload[offset] & 0x7f})
+			offset++
+			break
+		}
+
+		if offset+4 > len(payload) {
+			return nil, ErrInvalidRED
+		}
+
+		h := payload[offset : offset+4]
+		blocks = append(blocks, REDBlock{
+			PayloadType:     h[0] & 0x7f,
+			TimestampOffset: uint16(h[1])<<6 | uint16(h[2])>>2,
+		})
+		lengths = append(lengths, int(h[2]&0x03)<<8|int(h[3]))
+		offset += 4
+	}
+
+	for i, n := range lengths {
+		if offset+n > len(payload) {
+			return nil, ErrInvalidRED
+		}
+		blocks[i].Payload = payload[offset : offset+n]
+		offset += n
+	}
+	blocks[len(blocks)-1].Payload = payload[offset:]
+
+	return blocks, nil
+}
@@ -0,0 +1,78 @@
+package fec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestREDRoundTrip(t *testing.T) {
+	tests := map[string][]REDBlock{
+		"primary only": {
+			{PayloadType: 111, Payload: []byte{1, 2, 3}},
+		},
+		"redundant": {
+			{PayloadType: 111, TimestampOffset: 1920, Payload: []byte{1, 2}},
+			{PayloadType: 111, TimestampOffset: 960, Payload: nil},
+			{PayloadType: 111, Payload: []byte{5, 6, 7}},
+		},
+		"largest": {
+			{PayloadType: 127, TimestampOffset: 0x3fff, Payload: bytes.Repeat([]byte{9}, 0x3ff)},
+			{PayloadType: 0, Payload: []byte{}},
+		},
+	}
+
+	for name, blocks := range tests {
+		data, err := MarshalRED(blocks)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		got, err := UnmarshalRED(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(got) != len(blocks) {
+			t.Fatalf("%s: %d blocks, want %d", name, len(got), len(blocks))
+		}
+
+		for i, b := range blocks {
+			if got[i].PayloadType != b.PayloadType || !bytes.Equal(got[i].Payload, b.Payload) {
+				t.Errorf("%s: block %d = %+v, want %+v", name, i, got[i], b)
+			}
+			// the primary block has no offset
+			if i < len(blocks)-1 && got[i].TimestampOffset != b.TimestampOffset {
+				t.Errorf("%s: block %d offset = %d, want %d", name, i, got[i].TimestampOffset, b.TimestampOffset)
+			}
+		}
+	}
+}
+
+func TestMarshalInvalidRED(t *testing.T) {
+	tests := map[string][]REDBlock{
+		"no blocks":      nil,
+		"long block":     {{Payload: make([]byte, 0x400)}, {}},
+		"offset too big": {{TimestampOffset: 0x4000}, {}},
+	}
+
+	for name, blocks := range tests {
+		if _, err := MarshalRED(blocks); err != ErrInvalidRED {
+			t.Errorf("%s: err = %v, want ErrInvalidRED", name, err)
+		}
+	}
+}
+
+func TestUnmarshalInvalidRED(t *testing.T) {
+	tests := map[string][]byte{
+		"empty":              nil,
+		"no primary":         {0x80 | 111, 0, 4, 2},
+		"truncated header":   {0x80 | 111, 0, 4},
+		"block past the end": {0x80 | 111, 0, 4, 9, 111, 1, 2},
+		"only redundant":     {0x80 | 111, 0, 0, 0, 0x80 | 111, 0, 0, 0},
+	}
+
+	for name, data := range tests {
+		if blocks, err := UnmarshalRED(data); err != ErrInvalidRED {
+			t.Errorf("%s: blocks %+v, err %v, want ErrInvalidRED", name, blocks, err)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package fec
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/pion/rtp"
+)
+
+const (
+	rtpHeaderSize = 12
+	// fec header and level 0 header with the short mask
+	fecHeaderSize   = 10
+	levelHeaderSize = 4
+	// MaxGroup is the most media packets a fec packet with a short mask
+	// protects.
+	MaxGroup = 16
+	// recent packets the recoverer keeps
+	mediaWindow = 512
+	fecWindow   = 64
+)
+
+var ErrInvalidFEC = errors.New("invalid ulpfec payload")
+
+// Encoder protects every group of media packets with the xor of them in one
+// ulpfec packet, RFC 5109. Packets are protected as the receiver sees them,
+// a red payload unwrapped.
+type Encoder struct {
+	group   int
+	base    uint16
+	packets [][]byte
+}
+
+// NewEncoder protects groups of group packets, at most MaxGroup.
+func NewEncoder(group int) *Encoder {
+	if group < 1 {
+		group = 1
+	} else if group > MaxGroup {
+		group = MaxGroup
+	}
+
+	return &Encoder{group: group}
+}
+
+// Push adds a media packet, it returns the payload of the fec packet of the
+// group once the group is complete.
+func (e *Encoder) Push(pkt *rtp.Packet) ([]byte, error) {
+	buf, err := marshal(pkt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(e.packets) > 0 && uint16(pkt.SequenceNumber-e.base) >= MaxGroup {
+		// out of reach of the mask, e.g. after padding, the group restarts
+		e.packets = e.packets[:0]
+	}
+
+	if len(e.packets) == 0 {
+		e.base = pkt.SequenceNumber
+	}
+	e.packets = append(e.packets, buf)
+
+	if len(e.packets) < e.group {
+		return nil, nil
+	}
+
+	payload := encode(e.base, e.packets)
+	e.packets = e.packets[:0]
+
+	return payload, nil
+}
+
+// marshal returns the packet as it is on the wire, padding is in the payload
+// of packets built for sending and in PaddingSize of received ones.
+func marshal(pkt *rtp.Packet) ([]byte, error) {
+	buf, err := pkt.Header.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	buf = append(buf, pkt.Payload...)
+	if pkt.PaddingSize > 0 {
+		buf = append(buf, make([]byte, pkt.PaddingSize)...)
+		buf[len(buf)-1] = pkt.PaddingSize
+	}
+
+	return buf, nil
+}
+
+func encode(base uint16, packets [][]byte) []byte {
+	protection := 0
+	for _, p := range packets {
+		if n := len(p) - rtpHeaderSize; n > protection {
+			protection = n
+		}
+	}
+
+	payload := make([]byte, fecHeaderSize+levelHeaderSize+protection)
+	var mask uint16
+	for _, p := range packets {
+		payload[0] ^= p[0]
+		payload[1] ^= p[1]
+		for i := 4; i < 8; i++ {
+			payload[i] ^= p[i]
+		}
+		length := binary.BigEndian.Uint16(payload[8:]) ^ uint16(len(p)-rtpHeaderSize)
+		binary.BigEndian.PutUint16(payload[8:], length)
+
+		for i, b := range p[rtpHeaderSize:] {
+			payload[fecHeaderSize+levelHeaderSize+i] ^= b
+		}
+
+		mask |= 1 << (15 - (binary.BigEndian.Uint16(p[2:]) - base))
+	}
+
+	// E and L are 0, P, X and CC recovered
+	payload[0] &= 0x3f
+	binary.BigEndian.PutUint16(payload[2:], base)
+	binary.BigEndian.PutUint16(payload[10:], uint16(protection))
+	binary.BigEndian.PutUint16(payload[12:], mask)
+
+	return payload
+}
+
+type fecPacket struct {
+	base    uint16
+	mask    uint64
+	bits    int
+	payload []byte
+}
+
+func parseFEC(payload []byte) (*fecPacket, error) {
+	if len(payload) < fecHeaderSize+levelHeaderSize {
+		return nil, ErrInvalidFEC
+	}
+
+	f := &fecPacket{base: binary.BigEndian.Uint16(payload[2:]), payload: payload}
+	maskSize := 2
+	if payload[0]&0x40 != 0 {
+		maskSize = 6
+	}
+
+	if len(payload) < fecHeaderSize+2+maskSize {
+		return nil, ErrInvalidFEC
+	}
+
+	for _, b := range payload[fecHeaderSize+2 : fecHeaderSize+2+maskSize] {
+		f.mask = f.mask<<8 | uint64(b)
+	}
+	f.bits = maskSize * 8
+
+	protection := int(binary.BigEndian.Uint16(payload[fecHeaderSize:]))
+	if len(payload) < fecHeaderSize+2+maskSize+protection {
+		return nil, ErrInvalidFEC
+	}
+	f.payload = payload[:fecHeaderSize+2+maskSize+protection]
+
+	return f, nil
+}
+
+// protects returns the sequence numbers f protects.
+func (f *fecPacket) protects() []uint16 {
+	var seqs []uint16
+	for i := 0; i < f.bits; i++ {
+		if f.mask&(1<<(f.bits-1-i)) != 0 {
+			seqs = append(seqs, f.base+uint16(i))
+		}
+	}
+
+	return seqs
+}
+
+// Recoverer rebuilds a lost media packet from a fec packet and the other
+// packets it protects.
+type Recoverer struct {
+	media map[uint16][]byte
+	order []uint16
+	fec   []*fecPacket
+}
+
+func NewRecoverer() *Recoverer {
+	return &Recoverer{media: make(map[uint16][]byte)}
+}
+
+// AddMedia records a received media packet, unwrapped from red, and returns
+// the packets it made recoverable.
+func (r *Recoverer) AddMedia(pkt *rtp.Packet) []*rtp.Packet {
+	buf, err := marshal(pkt)
+	if err != nil {
+		return nil
+	}
+
+	r.store(pkt.SequenceNumber, buf)
+
+	return r.recover(pkt.SSRC)
+}
+
+// AddFEC records the payload of a received fec packet and returns the packets
+// it recovered, with the ssrc of the stream.
+func (r *Recoverer) AddFEC(ssrc uint32, payload []byte) ([]*rtp.Packet, error) {
+	f, err := parseFEC(append([]byte(nil), payload...))
+	if err != nil {
+		return nil, err
+	}
+
+	r.fec = append(r.fec, f)
+	if len(r.fec) > fecWindow {
+		r.fec = r.fec[len(r.fec)-fecWindow:]
+	}
+
+	return r.recover(ssrc), nil
+}
+
+func (r *Recoverer) store(seq uint16, buf []byte) {
+	if _, found := r.media[seq]; found {
+		return
+	}
+
+	r.media[seq] = buf
+	r.order = append(r.order, seq)
+	if len(r.order) > mediaWindow {
+		delete(r.media, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+// recover applies the fec packets missing one protected packet until none
+// recovers another.
+func (r *Recoverer) recover(ssrc uint32) []*rtp.Packet {
+	var recovered []*rtp.Packet
+	for again := true; again; {
+		again = false
+
+		kept := r.fec[:0]
+		for _, f := range r.fec {
+			missing, count := uint16(0), 0
+			for _, seq := range f.protects() {
+				if _, found := r.media[seq]; !found {
+					missing = seq
+					count++
+				}
+			}
+
+			switch count {
+			case 0:
+				// nothing left to recover
+				continue
+			case 1:
+				if pkt, buf, ok := r.rebuild(f, missing, ssrc); ok {
+					r.store(missing, buf)
+					recovered = append(recovered, pkt)
+					again = true
+					continue
+				}
+			}
+
+			kept = append(kept, f)
+		}
+		r.fec = kept
+	}
+
+	return recovered
+}
+
+func (r *Recoverer) rebuild(f *fecPacket, seq uint16, ssrc uint32) (*rtp.Packet, []byte, bool) {
+	header := f.payload[:fecHeaderSize]
+	levelSize := len(f.payload) - fecHeaderSize - 2 - f.bits/8
+	data := make([]byte, levelSize)
+	copy(data, f.payload[fecHeaderSize+2+f.bits/8:])
+
+	var b0, b1 = header[0], header[1]
+	ts := binary.BigEndian.Uint32(header[4:])
+	length := binary.BigEndian.Uint16(header[8:])
+
+	for _, s := range f.protects() {
+		if s == seq {
+			continue
+		}
+
+		p := r.media[s]
+		b0 ^= p[0]
+		b1 ^= p[1]
+		ts ^= binary.BigEndian.Uint32(p[4:])
+		length ^= uint16(len(p) - rtpHeaderSize)
+		for i, b := range p[rtpHeaderSize:] {
+			if i >= len(data) {
+				break
+			}
+			data[i] ^= b
+		}
+	}
+
+	if int(length) > len(data) {
+		return nil, nil, false
+	}
+
+	buf := make([]byte, rtpHeaderSize+int(length))
+	buf[0] = 0x80 | b0&0x3f
+	buf[1] = b1
+	binary.BigEndian.PutUint16(buf[2:], seq)
+	binary.BigEndian.PutUint32(buf[4:], ts)
+	binary.BigEndian.PutUint32(buf[8:], ssrc)
+	copy(buf[rtpHeaderSize:], data[:length])
+
+	pkt := &rtp.Packet{}
+	if err := pkt.Unmarshal(buf); err != nil {
+		return nil, nil, false
+	}
+
+	return pkt, buf, true
+}
@@ -0,0 +1,166 @@
+package fec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pion/rtp"
+)
+
+func mediaPacket(seq uint16, payload []byte) *rtp.Packet {
+	return &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			Marker:         seq%4 == 3,
+			PayloadType:    96,
+			SequenceNumber: seq,
+			Timestamp:      3000 * uint32(seq/4),
+			SSRC:           1234,
+		},
+		Payload: payload,
+	}
+}
+
+func group(base uint16) []*rtp.Packet {
+	packets := make([]*rtp.Packet, 4)
+	for i := range packets {
+		// payloads of different lengths, the length is protected too
+		packets[i] = mediaPacket(base+uint16(i), bytes.Repeat([]byte{byte(i + 1)}, 10+7*i))
+	}
+	return packets
+}
+
+func encodeGroup(t *testing.T, packets []*rtp.Packet) []byte {
+	t.Helper()
+
+	e := NewEncoder(len(packets))
+	var payload []byte
+	for i, p := range packets {
+		out, err := e.Push(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i < len(packets)-1 && out != nil {
+			t.Fatalf("fec packet after %d of %d packets", i+1, len(packets))
+		}
+		payload = out
+	}
+	if payload == nil {
+		t.Fatal("no fec packet for the group")
+	}
+
+	return payload
+}
+
+func samePacket(t *testing.T, got, want *rtp.Packet) {
+	t.Helper()
+
+	if got.SequenceNumber != want.SequenceNumber || got.Timestamp != want.Timestamp ||
+		got.Marker != want.Marker || got.PayloadType != want.PayloadType || got.SSRC != want.SSRC {
+		t.Errorf("header = %+v, want %+v", got.Header, want.Header)
+	}
+	if !bytes.Equal(got.Payload, want.Payload) {
+		t.Errorf("payload = %x, want %x", got.Payload, want.Payload)
+	}
+}
+
+func TestRecoverLostPacket(t *testing.T) {
+	for lost := 0; lost < 4; lost++ {
+		packets := group(65534) // wraps around
+		payload := encodeGroup(t, packets)
+
+		r := NewRecoverer()
+		for i, p := range packets {
+			if i != lost {
+				if recovered := r.AddMedia(p); len(recovered) > 0 {
+					t.Fatalf("recovered %d packets without fec", len(recovered))
+				}
+			}
+		}
+
+		recovered, err := r.AddFEC(1234, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(recovered) != 1 {
+			t.Fatalf("lost %d: recovered %d packets, want 1", lost, len(recovered))
+		}
+		samePacket(t, recovered[0], packets[lost])
+	}
+}
+
+func TestRecoverFECBeforeMedia(t *testing.T) {
+	packets := group(100)
+	payload := encodeGroup(t, packets)
+
+	r := NewRecoverer()
+	recovered, err := r.AddFEC(1234, payload)
+	if err != nil || len(recovered) != 0 {
+		t.Fatalf("recovered %d packets, err %v, want none", len(recovered), err)
+	}
+
+	r.AddMedia(packets[0])
+	r.AddMedia(packets[1])
+	recovered = r.AddMedia(packets[3])
+	if len(recovered) != 1 {
+		t.Fatalf("recovered %d packets, want 1", len(recovered))
+	}
+	samePacket(t, recovered[0], packets[2])
+}
+
+func TestRecoverTwoLost(t *testing.T) {
+	packets := group(100)
+	payload := encodeGroup(t, packets)
+
+	r := NewRecoverer()
+	r.AddMedia(packets[0])
+	r.AddMedia(packets[3])
+	if recovered, err := r.AddFEC(1234, payload); err != nil || len(recovered) != 0 {
+		t.Fatalf("recovered %d packets of two lost, err %v", len(recovered), err)
+	}
+
+	// the second one arriving late makes the first recoverable
+	recovered := r.AddMedia(packets[1])
+	if len(recovered) != 1 {
+		t.Fatalf("recovered %d packets, want 1", len(recovered))
+	}
+	samePacket(t, recovered[0], packets[2])
+}
+
+func TestAddInvalidFEC(t *testing.T) {
+	payload := encodeGroup(t, group(100))
+
+	tests := map[string][]byte{
+		"empty":       nil,
+		"header only": payload[:fecHeaderSize],
+		"long mask":   append([]byte{0x40}, payload[1:fecHeaderSize+levelHeaderSize]...),
+		"truncated":   payload[:len(payload)-1],
+	}
+
+	for name, data := range tests {
+		r := NewRecoverer()
+		if _, err := r.AddFEC(1234, data); err != ErrInvalidFEC {
+			t.Errorf("%s: err = %v, want ErrInvalidFEC", name, err)
+		}
+	}
+}
+
+// TestRecoverHostileFEC feeds fec packets that don't match the media, none
+// may panic.
+func TestRecoverHostileFEC(t *testing.T) {
+	packets := group(100)
+	valid := encodeGroup(t, packets)
+
+	for i := 0; i < len(valid); i++ {
+		for _, b := range []byte{0x00, 0xff} {
+			payload := append([]byte(nil), valid...)
+			payload[i] = b
+
+			r := NewRecoverer()
+			r.AddMedia(packets[0])
+			r.AddMedia(packets[1])
+			r.AddMedia(packets[3])
+			r.AddFEC(1234, payload)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package rtclib
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/pingostack/neon/pkg/rtclib/fec"
+	"github.com/pingostack/neon/pkg/rtclib/transport"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+// fecTrack sends video wrapped in red and adds an ulpfec packet for every
+// group of packets to the peers that negotiated both, the others get plain
+// media. The fec packets take sequence numbers of the media, which is why
+// the track writes to the peers itself.
+type fecTrack struct {
+	*webrtc.TrackLocalStaticRTP
+	group    int
+	lock     sync.Mutex
+	bindings map[string]*fecBinding
+}
+
+type fecBinding struct {
+	// lock orders the packets of the peer, the encoder and seqOffset
+	// follow them
+	lock    sync.Mutex
+	ssrc    uint32
+	mediaPT uint8
+	redPT   uint8
+	fecPT   uint8
+	writer  webrtc.TrackLocalWriter
+	encoder *fec.Encoder
+	// seqOffset counts the fec packets sent, media follows them
+	seqOffset uint16
+}
+
+func newFECTrack(track *webrtc.TrackLocalStaticRTP, group int) *fecTrack {
+	return &fecTrack{
+		TrackLocalStaticRTP: track,
+		group:               group,
+		bindings:            make(map[string]*fecBinding),
+	}
+}
+
+func (t *fecTrack) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	codec, err := t.TrackLocalStaticRTP.Bind(ctx)
+	if err != nil {
+		return codec, err
+	}
+
+	b := &fecBinding{
+		ssrc:    uint32(ctx.SSRC()),
+		mediaPT: uint8(codec.PayloadType),
+		writer:  ctx.WriteStream(),
+	}
+	for _, c := range ctx.CodecParameters() {
+		switch {
+		case strings.EqualFold(c.MimeType, transport.MimeTypeVideoRed):
+			b.redPT = uint8(c.PayloadType)
+		case strings.EqualFold(c.MimeType, transport.MimeTypeULPFEC):
+			b.fecPT = uint8(c.PayloadType)
+		}
+	}
+
+	if b.redPT != 0 && b.fecPT != 0 {
+		b.encoder = fec.NewEncoder(t.group)
+	}
+
+	t.lock.Lock()
+	t.bindings[ctx.ID()] = b
+	t.lock.Unlock()
+
+	return codec, nil
+}
+
+func (t *fecTrack) Unbind(ctx webrtc.TrackLocalContext) error {
+	t.lock.Lock()
+	delete(t.bindings, ctx.ID())
+	t.lock.Unlock()
+
+	return t.TrackLocalStaticRTP.Unbind(ctx)
+}
+
+// WriteRTP writes p to every peer, as TrackLocalStaticRTP does a peer that
+// fails doesn't keep it from the others.
+func (t *fecTrack) WriteRTP(p *rtp.Packet) error {
+	t.lock.Lock()
+	bindings := make([]*fecBinding, 0, len(t.bindings))
+	for _, b := range t.bindings {
+		bindings = append(bindings, b)
+	}
+	t.lock.Unlock()
+
+	var errs writeErrors
+	for _, b := range bindings {
+		b.lock.Lock()
+		err := b.write(p)
+		b.lock.Unlock()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs.err()
+}
+
+// writeErrors are the errors of the peers a packet failed to reach.
+type writeErrors []error
+
+func (errs writeErrors) err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+func (errs writeErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+func (errs writeErrors) Is(target error) bool {
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b *fecBinding) write(p *rtp.Packet) error {
+	media := *p
+	media.SSRC, media.PayloadType = b.ssrc, b.mediaPT
+	media.SequenceNumber += b.seqOffset
+
+	if b.encoder == nil {
+		_, err := b.writer.WriteRTP(&media.Header, media.Payload)
+		return err
+	}
+
+	padding := p.Padding && len(p.Payload) > 0 && int(p.Payload[len(p.Payload)-1]) == len(p.Payload)
+	if padding {
+		media.PayloadType = b.redPT
+		_, err := b.writer.WriteRTP(&media.Header, media.Payload)
+		return err
+	}
+
+	payload, err := b.encoder.Push(&media)
+	if err != nil {
+		return err
+	}
+
+	red, err := fec.MarshalRED([]fec.REDBlock{{PayloadType: b.mediaPT, Payload: p.Payload}})
+	if err != nil {
+		return err
+	}
+
+	wrapped := media.Header
+	wrapped.PayloadType = b.redPT
+	if _, err := b.writer.WriteRTP(&wrapped, red); err != nil {
+		return err
+	}
+
+	if payload == nil {
+		return nil
+	}
+
+	red, err = fec.MarshalRED([]fec.REDBlock{{PayloadType: b.fecPT, Payload: payload}})
+	if err != nil {
+		return err
+	}
+
+	b.seqOffset++
+	_, err = b.writer.WriteRTP(&rtp.Header{
+		Version:        2,
+		PayloadType:    b.redPT,
+		SequenceNumber: media.SequenceNumber + 1,
+		Timestamp:      media.Timestamp,
+		SSRC:           b.ssrc,
+	}, red)
+
+	return err
+}
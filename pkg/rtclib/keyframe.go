@@ -0,0 +1,95 @@
+package rtclib
+
+import "github.com/pingostack/neon/pkg/deliver"
+
+// IsKeyframe reports whether an RTP payload starts or belongs to a keyframe.
+// For codecs it can not inspect it reports true, so callers waiting on the
+// next keyframe do not stall.
+func IsKeyframe(codec deliver.CodecType, payload []byte) bool {
+	if len(payload) == 0 {
+		return false
+	}
+
+	switch codec {
+	case deliver.CodecTypeH264:
+		return h264Keyframe(payload)
+	case deliver.CodecTypeVP8:
+		return vp8Keyframe(payload)
+	case deliver.CodecTypeVP9:
+		return vp9Keyframe(payload)
+	case deliver.CodecTypeAV1:
+		// N is set on the first packet of a coded video sequence
+		return payload[0]&av1N != 0
+	}
+
+	return true
+}
+
+func h264Keyframe(payload []byte) bool {
+	const (
+		naluIDR   = 5
+		naluSPS   = 7
+		naluSTAPA = 24
+		naluFUA   = 28
+	)
+
+	switch payload[0] & 0x1f {
+	case naluIDR, naluSPS:
+		return true
+	case naluSTAPA:
+		for i := 1; i+2 < len(payload); {
+			size := int(payload[i])<<8 | int(payload[i+1])
+			i += 2
+			if t := payload[i] & 0x1f; t == naluIDR || t == naluSPS {
+				return true
+			}
+			i += size
+		}
+	case naluFUA:
+		if len(payload) > 1 {
+			return payload[1]&0x1f == naluIDR
+		}
+	}
+
+	return false
+}
+
+func vp8Keyframe(payload []byte) bool {
+	// RFC 7741 payload descriptor
+	i := 1
+	if payload[0]&0x80 != 0 {
+		if len(payload) < 2 {
+			return false
+		}
+		x := payload[1]
+		i++
+		if x&0x80 != 0 {
+			if len(payload) <= i {
+				return false
+			}
+			if payload[i]&0x80 != 0 {
+				i++
+			}
+			i++
+		}
+		if x&0x40 != 0 {
+			i++
+		}
+		if x&0x30 != 0 {
+			i++
+		}
+	}
+
+	// only the first packet of a partition carries the frame header
+	if payload[0]&0x10 == 0 || len(payload) <= i {
+		return false
+	}
+
+	return payload[i]&0x01 == 0
+}
+
+func vp9Keyframe(payload []byte) bool {
+	// draft-ietf-payload-vp9 payload descriptor, I|P|L|F|B|E|V|Z: the first
+	// packet of a frame that is not inter picture predicted
+	return payload[0]&0x40 == 0 && payload[0]&0x08 != 0
+}
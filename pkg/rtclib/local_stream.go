@@ -2,6 +2,7 @@ package rtclib
 
 import (
 	"context"
+	"sync"
 
 	"github.com/pingostack/neon/pkg/deliver"
 	"github.com/pingostack/neon/pkg/eventemitter"
@@ -16,13 +17,15 @@ type LocalStream struct {
 	cancel       context.CancelFunc
 	logger       logger.Logger
 	eventemitter eventemitter.EventEmitter
+	lock         sync.Mutex
+	tracks       []*TrackLocl
 }
 
 func NewLocalStream(transport *transport.Transport) (*LocalStream, error) {
 	ls := &LocalStream{
 		Transport:    transport,
 		logger:       transport.Logger(),
-		eventemitter: eventemitter.NewEventEmitter(transport.Context(), defaultEventEmitterLength, transport.Logger()),
+		eventemitter: eventemitter.NewEventEmitter(transport.Context(), defaultEventEmitterLength, transport.Logger(), eventemitter.WithName("rtc-stream")),
 	}
 
 	ls.ctx, ls.cancel = context.WithCancel(transport.Context())
@@ -52,11 +55,67 @@ func (ls *LocalStream) validate() error {
 	return nil
 }
 
-func (ls *LocalStream) AddTrack(codec deliver.CodecType, clockRate uint32, logger logger.Logger) (track *TrackLocl, err error) {
-	return NewTrackLocl(ls.ctx, codec, clockRate, ls.Transport.AddTrack, logger)
+// AddTrack adds a media track of codec, see SetupTracks.
+func (ls *LocalStream) AddTrack(codec deliver.CodecType, clockRate uint32, logger logger.Logger, opts ...TrackOption) (*TrackLocl, error) {
+	handles, err := ls.SetupTracks(logger, TrackDesc{Codec: codec, ClockRate: clockRate, Options: opts})
+	if err != nil {
+		return nil, err
+	}
+
+	return handles[0].Track, nil
+}
+
+func (ls *LocalStream) Tracks() []*TrackLocl {
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+
+	return append([]*TrackLocl{}, ls.tracks...)
+}
+
+// MuteAudio mutes or unmutes the audio tracks, see TrackLocl.Mute.
+func (ls *LocalStream) MuteAudio(mute bool) {
+	ls.mute(mute, deliver.CodecType.IsAudio)
+}
+
+// MuteVideo mutes or unmutes the video tracks, see TrackLocl.Mute.
+func (ls *LocalStream) MuteVideo(mute bool) {
+	ls.mute(mute, deliver.CodecType.IsVideo)
+}
+
+func (ls *LocalStream) mute(mute bool, match func(deliver.CodecType) bool) {
+	for _, track := range ls.Tracks() {
+		if !match(track.Codec()) {
+			continue
+		}
+
+		if mute {
+			track.Mute()
+		} else {
+			track.Unmute()
+		}
+	}
 }
 
 func (ls *LocalStream) Close() {
 	ls.cancel()
 	ls.Transport.Close()
 }
+
+// RemoveTrack stops sending track, the next negotiation tells the remote.
+func (ls *LocalStream) RemoveTrack(track *TrackLocl) error {
+	ls.lock.Lock()
+	for i, t := range ls.tracks {
+		if t == track {
+			ls.tracks = append(ls.tracks[:i], ls.tracks[i+1:]...)
+			break
+		}
+	}
+	ls.lock.Unlock()
+
+	track.cancel()
+	if track.sender == nil {
+		return nil
+	}
+
+	return ls.Transport.RemoveTrack(track.sender)
+}
@@ -0,0 +1,86 @@
+package rtclib
+
+import (
+	"math/rand"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/rtclib/rtcerror"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+)
+
+const (
+	// payloads of packets leave room for srtp and header extensions
+	packetizerMTU = 1200
+)
+
+// Packetizer splits raw frames, h264 as annex b, into the rtp packets of a
+// track, the reverse of Depacketizer.
+type Packetizer struct {
+	codec      deliver.CodecType
+	clockRate  uint32
+	packetizer rtp.Packetizer
+}
+
+func NewPacketizer(codec deliver.CodecType, payloadType uint8, clockRate uint32) (*Packetizer, error) {
+	var payloader rtp.Payloader
+
+	switch codec {
+	case deliver.CodecTypeH264:
+		payloader = &codecs.H264Payloader{}
+	case deliver.CodecTypeVP8:
+		payloader = &codecs.VP8Payloader{EnablePictureID: true}
+	case deliver.CodecTypeVP9:
+		payloader = &codecs.VP9Payloader{}
+	case deliver.CodecTypeAV1:
+		payloader = av1Payloader{}
+	case deliver.CodecTypeOpus:
+		payloader = &codecs.OpusPayloader{}
+	case deliver.CodecTypePCMU, deliver.CodecTypePCMA:
+		payloader = &codecs.G711Payloader{}
+	case deliver.CodecTypeG722_16000_1, deliver.CodecTypeG722_16000_2:
+		payloader = &codecs.G722Payloader{}
+	default:
+		return nil, rtcerror.ErrUnsupportedCodec
+	}
+
+	return &Packetizer{
+		codec:      codec,
+		clockRate:  clockRate,
+		packetizer: rtp.NewPacketizer(packetizerMTU, payloadType, rand.Uint32(), payloader, rtp.NewRandomSequencer(), clockRate),
+	}, nil
+}
+
+// Packetize returns the rtp frames of a raw frame, stamped with the
+// timestamp of the frame.
+func (p *Packetizer) Packetize(frame deliver.Frame) []deliver.Frame {
+	packets := p.packetizer.Packetize(frame.Payload, 0)
+
+	keyframe := false
+	if info, ok := frame.AdditionalInfo.(*deliver.VideoFrameSpecificInfo); ok {
+		keyframe = info.IsKeyFrame
+	}
+
+	frames := make([]deliver.Frame, 0, len(packets))
+	for _, packet := range packets {
+		packet.Timestamp = frame.TimeStamp
+
+		var info deliver.FrameSpecificInfo
+		if p.codec.IsVideo() {
+			info = &deliver.VideoFrameSpecificInfo{IsKeyFrame: keyframe}
+		} else {
+			info = &deliver.AudioFrameSpecificInfo{SampleRate: p.clockRate}
+		}
+
+		frames = append(frames, deliver.Frame{
+			Codec:          p.codec,
+			PacketType:     deliver.PacketTypeRtp,
+			Length:         packet.MarshalSize(),
+			TimeStamp:      packet.Timestamp,
+			AdditionalInfo: info,
+			RawPacket:      packet,
+		})
+	}
+
+	return frames
+}
@@ -0,0 +1,173 @@
+package rtclib
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/pingostack/neon/pkg/rtclib/fec"
+	"github.com/pingostack/neon/pkg/rtclib/transport"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	// MaxREDDistance is the most earlier payloads a red packet repeats.
+	MaxREDDistance = 3
+	// red packets leave out redundancy beyond this size
+	maxREDSize = 1000
+)
+
+// redTrack sends audio in red to the peers that negotiated it, every packet
+// repeats the payloads of the distance packets before it so a player
+// recovers them when they are lost. The others get plain media.
+type redTrack struct {
+	*webrtc.TrackLocalStaticRTP
+	distance int
+	lock     sync.Mutex
+	history  []redEntry
+	bindings map[string]*redBinding
+}
+
+type redEntry struct {
+	seq     uint16
+	ts      uint32
+	payload []byte
+}
+
+type redBinding struct {
+	ssrc    uint32
+	mediaPT uint8
+	redPT   uint8
+	writer  webrtc.TrackLocalWriter
+}
+
+func newREDTrack(track *webrtc.TrackLocalStaticRTP, distance int) *redTrack {
+	if distance > MaxREDDistance {
+		distance = MaxREDDistance
+	}
+
+	return &redTrack{
+		TrackLocalStaticRTP: track,
+		distance:            distance,
+		bindings:            make(map[string]*redBinding),
+	}
+}
+
+func (t *redTrack) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	codec, err := t.TrackLocalStaticRTP.Bind(ctx)
+	if err != nil {
+		return codec, err
+	}
+
+	b := &redBinding{
+		ssrc:    uint32(ctx.SSRC()),
+		mediaPT: uint8(codec.PayloadType),
+		writer:  ctx.WriteStream(),
+	}
+	for _, c := range ctx.CodecParameters() {
+		if strings.EqualFold(c.MimeType, transport.MimeTypeAudioRed) {
+			b.redPT = uint8(c.PayloadType)
+		}
+	}
+
+	t.lock.Lock()
+	t.bindings[ctx.ID()] = b
+	t.lock.Unlock()
+
+	return codec, nil
+}
+
+func (t *redTrack) Unbind(ctx webrtc.TrackLocalContext) error {
+	t.lock.Lock()
+	delete(t.bindings, ctx.ID())
+	t.lock.Unlock()
+
+	return t.TrackLocalStaticRTP.Unbind(ctx)
+}
+
+// WriteRTP writes p to every peer, a peer that fails doesn't keep it from
+// the others.
+func (t *redTrack) WriteRTP(p *rtp.Packet) error {
+	t.lock.Lock()
+	blocks := t.blocks(p)
+	t.remember(p)
+	bindings := make([]*redBinding, 0, len(t.bindings))
+	for _, b := range t.bindings {
+		bindings = append(bindings, b)
+	}
+	t.lock.Unlock()
+
+	var errs writeErrors
+	for _, b := range bindings {
+		if err := b.write(p, blocks); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs.err()
+}
+
+// blocks returns the red blocks of p, the redundant ones of the packets just
+// before it, the primary one last. The player tells the packets of redundant
+// blocks by their position, a gap drops the redundancy.
+func (t *redTrack) blocks(p *rtp.Packet) []fec.REDBlock {
+	var blocks []fec.REDBlock
+	size := 1 + len(p.Payload)
+	for i, e := range t.history {
+		distance := len(t.history) - i
+		offset := p.Timestamp - e.ts
+		if e.seq != p.SequenceNumber-uint16(distance) || offset > 0x3fff ||
+			len(e.payload) > 0x3ff || size+4+len(e.payload) > maxREDSize {
+			blocks, size = blocks[:0], 1+len(p.Payload)
+			continue
+		}
+
+		blocks = append(blocks, fec.REDBlock{TimestampOffset: uint16(offset), Payload: e.payload})
+		size += 4 + len(e.payload)
+	}
+
+	return append(blocks, fec.REDBlock{Payload: p.Payload})
+}
+
+func (t *redTrack) remember(p *rtp.Packet) {
+	if len(p.Payload) == 0 || p.Padding {
+		return
+	}
+
+	if len(t.history) == t.distance {
+		t.history = t.history[1:]
+	}
+
+	t.history = append(t.history, redEntry{
+		seq:     p.SequenceNumber,
+		ts:      p.Timestamp,
+		payload: append([]byte(nil), p.Payload...),
+	})
+}
+
+func (b *redBinding) write(p *rtp.Packet, blocks []fec.REDBlock) error {
+	media := p.Header
+	media.SSRC, media.PayloadType = b.ssrc, b.mediaPT
+
+	if b.redPT == 0 || p.Padding {
+		_, err := b.writer.WriteRTP(&media, p.Payload)
+		return err
+	}
+
+	// the blocks carry the payload type of this peer
+	wrapped := make([]fec.REDBlock, len(blocks))
+	for i, block := range blocks {
+		block.PayloadType = b.mediaPT
+		wrapped[i] = block
+	}
+
+	red, err := fec.MarshalRED(wrapped)
+	if err != nil {
+		return err
+	}
+
+	media.PayloadType = b.redPT
+	_, err = b.writer.WriteRTP(&media, red)
+
+	return err
+}
@@ -2,27 +2,38 @@ package rtclib
 
 import (
 	"context"
+	"io"
+	"sync"
 	"time"
 
+	"github.com/pingostack/neon/pkg/deliver"
 	"github.com/pingostack/neon/pkg/logger"
 	"github.com/pingostack/neon/pkg/rtclib/transport"
 	"github.com/pion/webrtc/v4"
 	"github.com/pkg/errors"
 )
 
+// tracks of the remote side taken before they are gathered
+const maxGatheredTracks = 8
+
 type RemoteStream struct {
 	*transport.Transport
 	ctx     context.Context
 	cancel  context.CancelFunc
 	logger  logger.Logger
 	chTrack chan *TrackRemote
+	lock    sync.Mutex
+	tracks  []*TrackRemote
+	// onTrack and onTrackRemoved follow renegotiations of the remote side
+	onTrack        func(track *TrackRemote, info TrackInfo)
+	onTrackRemoved func(track *TrackRemote)
 }
 
 func NewRemoteStream(transport *transport.Transport) (*RemoteStream, error) {
 	rs := &RemoteStream{
 		Transport: transport,
 		logger:    transport.Logger(),
-		chTrack:   make(chan *TrackRemote, 2),
+		chTrack:   make(chan *TrackRemote, maxGatheredTracks),
 	}
 
 	rs.ctx, rs.cancel = context.WithCancel(transport.Context())
@@ -31,14 +42,124 @@ func NewRemoteStream(transport *transport.Transport) (*RemoteStream, error) {
 		return nil, errors.Wrap(err, "invalid remote stream")
 	}
 
-	rs.Transport.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
-		rs.logger.Infof("got track %s(%s)", track.ID(), track.Kind())
-		rs.chTrack <- NewTrackRemote(rs.ctx, track, receiver, rs.Transport.WriteRTCP, rs.logger)
-	})
+	rs.Transport.OnTrack(rs.handleTrack)
 
 	return rs, nil
 }
 
+func (rs *RemoteStream) handleTrack(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+	rs.logger.Infof("got track %s(%s)", track.ID(), track.Kind())
+	t := NewTrackRemote(rs.ctx, track, receiver, rs.Transport.WriteRTCP, rs.logger)
+
+	rs.lock.Lock()
+	rs.tracks = append(rs.tracks, t)
+	onTrack := rs.onTrack
+	rs.lock.Unlock()
+
+	if onTrack != nil {
+		onTrack(t, t.Info())
+	}
+
+	// nobody gathers the tracks of a renegotiation, never block on them
+	select {
+	case rs.chTrack <- t:
+	default:
+	}
+}
+
+// OnTrack is called with the tracks of the remote side, also those added by
+// a renegotiation.
+func (rs *RemoteStream) OnTrack(f func(track *TrackRemote, info TrackInfo)) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	rs.onTrack = f
+}
+
+// OnTrackRemoved is called with the tracks a renegotiation of the remote side
+// removed.
+func (rs *RemoteStream) OnTrackRemoved(f func(track *TrackRemote)) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	rs.onTrackRemoved = f
+}
+
+func (rs *RemoteStream) Tracks() []*TrackRemote {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	return append([]*TrackRemote{}, rs.tracks...)
+}
+
+// SetRemoteDescription applies an offer or answer, on renegotiations the
+// tracks the remote side no longer sends are removed.
+func (rs *RemoteStream) SetRemoteDescription(sd webrtc.SessionDescription) error {
+	if err := rs.Transport.SetRemoteDescription(sd); err != nil {
+		return err
+	}
+
+	rs.pruneTracks()
+
+	return nil
+}
+
+// pruneTracks drops the tracks whose receiver was stopped, pion replaces the
+// receiver of a transceiver when its track is gone from the remote sdp.
+func (rs *RemoteStream) pruneTracks() {
+	receivers := make(map[*webrtc.RTPReceiver]bool)
+	for _, transceiver := range rs.PeerConnection.GetTransceivers() {
+		if receiver := transceiver.Receiver(); receiver != nil {
+			receivers[receiver] = true
+		}
+	}
+
+	rs.lock.Lock()
+	var removed []*TrackRemote
+	tracks := rs.tracks[:0]
+	for _, track := range rs.tracks {
+		if receivers[track.receiver] {
+			tracks = append(tracks, track)
+		} else {
+			removed = append(removed, track)
+		}
+	}
+	rs.tracks = tracks
+	onTrackRemoved := rs.onTrackRemoved
+	rs.lock.Unlock()
+
+	for _, track := range removed {
+		rs.logger.Infof("track %s(%s) removed", track.ID(), track.Kind())
+		if onTrackRemoved != nil {
+			onTrackRemoved(track)
+		}
+	}
+}
+
+// Depacketize reads track and passes its frames to f until the track ends,
+// a removed track ends with io.EOF.
+func (rs *RemoteStream) Depacketize(track *TrackRemote, f func(frame deliver.Frame)) error {
+	info := track.Info()
+	depacketizer, err := NewDepacketizer(info.Codec, info.ClockRate, uint8(info.Channels))
+	if err != nil {
+		return errors.Wrapf(err, "depacketize %s", info.MimeType)
+	}
+
+	for {
+		packet, err := track.ReadRTP()
+		if err != nil {
+			if errors.Is(err, io.EOF) || rs.ctx.Err() != nil {
+				return io.EOF
+			}
+			return err
+		}
+
+		for _, frame := range depacketizer.Push(packet) {
+			f(frame)
+		}
+	}
+}
+
 func (rs *RemoteStream) validate() error {
 	if rs.Transport == nil {
 		return errors.New("transport not set")
@@ -96,6 +217,32 @@ func (rs *RemoteStream) GatheringTracks(gatherAudioTrack, gatherVideoTrack bool,
 	}
 }
 
+// GatherTracks waits for as many audio and video tracks, a publisher may
+// send more than one audio track, see GatheringTracks.
+func (rs *RemoteStream) GatherTracks(audio, video int, timeout time.Duration) ([]*TrackRemote, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	tracks := make([]*TrackRemote, 0, audio+video)
+	for audio > 0 || video > 0 {
+		select {
+		case <-timer.C:
+			return nil, errors.New("gather tracks timeout")
+		case <-rs.ctx.Done():
+			return nil, errors.New("gather tracks canceled")
+		case track := <-rs.chTrack:
+			tracks = append(tracks, track)
+			if track.IsAudio() {
+				audio--
+			} else if track.IsVideo() {
+				video--
+			}
+		}
+	}
+
+	return tracks, nil
+}
+
 func (rs *RemoteStream) Close() {
 	rs.cancel()
 	rs.Transport.Close()
@@ -0,0 +1,134 @@
+package rtclib
+
+import (
+	"strings"
+
+	"github.com/pingostack/neon/pkg/rtclib/fec"
+	"github.com/pingostack/neon/pkg/rtclib/transport"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+// recent sequence numbers the repair tells recovered packets by
+const repairWindow = 64
+
+// repair unwraps the red payloads of a remote track, recovers lost packets
+// from the redundant blocks of red and from ulpfec packets. It is only used
+// from the read loop.
+type repair struct {
+	resolved  bool
+	redPT     uint8
+	fecPT     uint8
+	mediaPT   uint8
+	recoverer *fec.Recoverer
+	pending   []*rtp.Packet
+	// seen holds seq+1 of recent packets, at seq%repairWindow
+	seen [repairWindow]uint32
+}
+
+func (r *repair) resolve(codecs []webrtc.RTPCodecParameters) {
+	r.resolved = true
+	for _, codec := range codecs {
+		switch {
+		case strings.EqualFold(codec.MimeType, transport.MimeTypeVideoRed),
+			strings.EqualFold(codec.MimeType, transport.MimeTypeAudioRed):
+			r.redPT = uint8(codec.PayloadType)
+		case strings.EqualFold(codec.MimeType, transport.MimeTypeULPFEC):
+			r.fecPT = uint8(codec.PayloadType)
+			r.recoverer = fec.NewRecoverer()
+		}
+	}
+}
+
+// unwrap returns the media packet of packet, false for a fec packet. Packets
+// it recovered are queued.
+func (r *repair) unwrap(packet *rtp.Packet) (*rtp.Packet, bool) {
+	if r.redPT != 0 && packet.PayloadType == r.redPT {
+		if len(packet.Payload) == 0 {
+			// padding, passed on as of the media
+			packet.PayloadType = r.mediaPT
+			return packet, true
+		}
+
+		blocks, err := fec.UnmarshalRED(packet.Payload)
+		if err != nil {
+			return nil, false
+		}
+
+		primary := blocks[len(blocks)-1]
+		if r.fecPT != 0 && primary.PayloadType == r.fecPT {
+			r.addFEC(packet.SSRC, primary.Payload)
+			return nil, false
+		}
+
+		if r.received(packet.SequenceNumber) {
+			// recovered from a later packet already
+			return nil, false
+		}
+		r.redundant(packet, blocks[:len(blocks)-1])
+
+		packet.PayloadType, packet.Payload = primary.PayloadType, primary.Payload
+	} else if r.fecPT != 0 && packet.PayloadType == r.fecPT {
+		r.addFEC(packet.SSRC, packet.Payload)
+		return nil, false
+	}
+
+	r.mediaPT = packet.PayloadType
+	r.mark(packet.SequenceNumber)
+	if r.recoverer != nil && len(packet.Payload) > 0 {
+		r.pending = append(r.pending, r.recoverer.AddMedia(packet)...)
+	}
+
+	return packet, true
+}
+
+// redundant queues the payloads of blocks of packets not received, blocks
+// repeat the packets just before packet, oldest first.
+func (r *repair) redundant(packet *rtp.Packet, blocks []fec.REDBlock) {
+	for i, block := range blocks {
+		seq := packet.SequenceNumber - uint16(len(blocks)-i)
+		if len(block.Payload) == 0 || r.received(seq) {
+			continue
+		}
+		r.mark(seq)
+
+		recovered := &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    block.PayloadType,
+				SequenceNumber: seq,
+				Timestamp:      packet.Timestamp - uint32(block.TimestampOffset),
+				SSRC:           packet.SSRC,
+			},
+			Payload: append([]byte(nil), block.Payload...),
+		}
+		r.pending = append(r.pending, recovered)
+	}
+}
+
+func (r *repair) mark(seq uint16) {
+	r.seen[seq%repairWindow] = uint32(seq) + 1
+}
+
+func (r *repair) received(seq uint16) bool {
+	return r.seen[seq%repairWindow] == uint32(seq)+1
+}
+
+func (r *repair) addFEC(ssrc uint32, payload []byte) {
+	recovered, err := r.recoverer.AddFEC(ssrc, payload)
+	if err == nil {
+		r.pending = append(r.pending, recovered...)
+	}
+}
+
+// next pops a recovered packet.
+func (r *repair) next() *rtp.Packet {
+	if len(r.pending) == 0 {
+		return nil
+	}
+
+	pkt := r.pending[0]
+	r.pending = r.pending[1:]
+
+	return pkt
+}
@@ -0,0 +1,110 @@
+package rtclib
+
+import (
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// restamper keeps sequence numbers and timestamps of an outgoing track
+// continuous when the source behind it changes, e.g. after a reconnect, an
+// unmute or a replaced source. The gap is stamped with the wall clock time it
+// lasted, so the player sees a freeze instead of a jump.
+type restamper struct {
+	clockRate uint32
+	// srcRate is the clock rate of the source, timestamps are scaled when it
+	// differs
+	srcRate   uint32
+	started   bool
+	pending   bool
+	ssrc      uint32
+	seqOffset uint16
+	lastIn    uint32
+	lastSeq   uint16
+	lastTs    uint32
+	lastAt    time.Time
+	// lastMarker is set when the last packet ended a frame
+	lastMarker bool
+}
+
+func newRestamper(clockRate uint32) *restamper {
+	return &restamper{clockRate: clockRate, srcRate: clockRate}
+}
+
+// resync makes the next packet start a new source, even with the same ssrc.
+func (r *restamper) resync(srcRate uint32) {
+	if srcRate != 0 {
+		r.srcRate = srcRate
+	}
+	r.pending = true
+}
+
+// apply returns the packet to send and whether it is the first one of a new
+// source. Packets are shared between destinations, a rewritten packet is a
+// copy.
+func (r *restamper) apply(pkt *rtp.Packet) (*rtp.Packet, bool) {
+	now := time.Now()
+	switched := false
+
+	ts := pkt.Timestamp
+	if !r.started {
+		r.started, r.ssrc = true, pkt.SSRC
+	} else if pkt.SSRC != r.ssrc || r.pending {
+		r.ssrc, r.pending = pkt.SSRC, false
+		r.seqOffset = r.lastSeq + 1 - pkt.SequenceNumber
+		ts = r.lastTs + r.elapsed(now)
+		switched = true
+	} else {
+		ts = r.lastTs + r.scale(pkt.Timestamp-r.lastIn)
+	}
+	r.lastIn = pkt.Timestamp
+
+	out := pkt
+	if r.seqOffset != 0 || ts != pkt.Timestamp {
+		cp := *pkt
+		cp.SequenceNumber += r.seqOffset
+		cp.Timestamp = ts
+		out = &cp
+	}
+
+	r.lastSeq, r.lastTs, r.lastAt = out.SequenceNumber, out.Timestamp, now
+	r.lastMarker = out.Marker
+
+	return out, switched
+}
+
+// next stamps a packet generated for the track, e.g. while it is muted,
+// advancing the timestamp by samples.
+func (r *restamper) next(pkt *rtp.Packet, samples uint32) {
+	r.lastSeq++
+	r.lastTs += samples
+	r.lastAt = time.Now()
+	pkt.SequenceNumber, pkt.Timestamp = r.lastSeq, r.lastTs
+}
+
+// pad stamps a packet inserted between two packets of the source, which
+// shifts the sequence numbers of the source after it.
+func (r *restamper) pad(pkt *rtp.Packet) {
+	r.lastSeq++
+	r.seqOffset++
+	pkt.SequenceNumber, pkt.Timestamp = r.lastSeq, r.lastTs
+}
+
+func (r *restamper) elapsed(now time.Time) uint32 {
+	elapsed := uint32(now.Sub(r.lastAt).Seconds() * float64(r.clockRate))
+	if elapsed == 0 {
+		elapsed = 1
+	}
+
+	return elapsed
+}
+
+// scale converts a timestamp delta of the source, negative deltas of
+// reordered frames included.
+func (r *restamper) scale(delta uint32) uint32 {
+	if r.srcRate == r.clockRate || r.srcRate == 0 {
+		return delta
+	}
+
+	return uint32(int64(int32(delta)) * int64(r.clockRate) / int64(r.srcRate))
+}
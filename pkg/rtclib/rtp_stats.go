@@ -0,0 +1,62 @@
+package rtclib
+
+import (
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// rtpStats tracks sequence gaps and interarrival jitter as described in RFC 3550 A.8.
+// It is only accessed from the track read loop.
+type rtpStats struct {
+	initialized   bool
+	lastSeq       uint16
+	lastTimestamp uint32
+	lastArrival   time.Time
+	jitter        float64
+	clockRate     uint32
+}
+
+func (s *rtpStats) update(pkt *rtp.Packet, clockRate uint32, arrival time.Time) (lost int) {
+	if clockRate == 0 {
+		return 0
+	}
+
+	if !s.initialized {
+		s.initialized = true
+		s.lastSeq = pkt.SequenceNumber
+		s.lastTimestamp = pkt.Timestamp
+		s.lastArrival = arrival
+		s.clockRate = clockRate
+		return 0
+	}
+
+	diff := pkt.SequenceNumber - s.lastSeq
+	if diff == 0 || diff > 0x8000 {
+		// duplicate or reordered packet
+		return 0
+	}
+
+	lost = int(diff) - 1
+
+	d := arrival.Sub(s.lastArrival).Seconds()*float64(clockRate) - float64(int32(pkt.Timestamp-s.lastTimestamp))
+	if d < 0 {
+		d = -d
+	}
+	s.jitter += (d - s.jitter) / 16
+
+	s.lastSeq = pkt.SequenceNumber
+	s.lastTimestamp = pkt.Timestamp
+	s.lastArrival = arrival
+	s.clockRate = clockRate
+
+	return lost
+}
+
+func (s *rtpStats) jitterSeconds() float64 {
+	if s.clockRate == 0 {
+		return 0
+	}
+
+	return s.jitter / float64(s.clockRate)
+}
@@ -0,0 +1,135 @@
+package sdpassistor
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pingostack/neon/pkg/rtclib/rtcerror"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+	"github.com/pkg/errors"
+)
+
+// codecPreference is a mime type and the fmtp parameters a format of it has
+// to have, e.g. video/H264;profile-level-id=42e01f.
+type codecPreference struct {
+	mime   string
+	params map[string]string
+}
+
+func parsePreferences(prefs []string) []codecPreference {
+	ret := make([]codecPreference, 0, len(prefs))
+	for _, pref := range prefs {
+		mime, fmtp, _ := strings.Cut(pref, ";")
+		ret = append(ret, codecPreference{
+			mime:   strings.ToLower(strings.TrimSpace(mime)),
+			params: fmtpParams(fmtp),
+		})
+	}
+
+	return ret
+}
+
+func fmtpParams(fmtp string) map[string]string {
+	params := make(map[string]string)
+	for _, p := range strings.Split(fmtp, ";") {
+		k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+		if k != "" {
+			params[strings.ToLower(k)] = strings.ToLower(v)
+		}
+	}
+
+	return params
+}
+
+func (p codecPreference) match(mime string, params map[string]string) bool {
+	if p.mime != mime {
+		return false
+	}
+
+	for k, v := range p.params {
+		if params[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// PreferCodecsSDP orders the formats of every media of sd by prefs, those
+// matching the first preference first. A preference is a mime type and the
+// fmtp parameters a format has to have, e.g.
+// video/H264;profile-level-id=42e01f. Formats matching none keep their order
+// after the others, retransmissions follow the format they repair.
+func PreferCodecsSDP(sd *sdp.SessionDescription, prefs []string) {
+	if len(prefs) == 0 {
+		return
+	}
+	parsed := parsePreferences(prefs)
+
+	for _, media := range sd.MediaDescriptions {
+		mimes := make(map[string]string)
+		fmtps := make(map[string]string)
+		for _, attr := range media.Attributes {
+			pt, value, ok := strings.Cut(attr.Value, " ")
+			if !ok {
+				continue
+			}
+
+			switch attr.Key {
+			case "rtpmap":
+				name, _, _ := strings.Cut(value, "/")
+				mimes[pt] = strings.ToLower(media.MediaName.Media + "/" + name)
+			case "fmtp":
+				fmtps[pt] = value
+			}
+		}
+
+		rank := func(pt string) int {
+			params := fmtpParams(fmtps[pt])
+			if strings.HasSuffix(mimes[pt], "/rtx") {
+				if apt, ok := params["apt"]; ok && apt != pt {
+					pt, params = apt, fmtpParams(fmtps[apt])
+				}
+			}
+
+			for i, p := range parsed {
+				if p.match(mimes[pt], params) {
+					return i
+				}
+			}
+
+			return len(parsed)
+		}
+
+		formats := media.MediaName.Formats
+		ranks := make(map[string]int, len(formats))
+		for _, pt := range formats {
+			ranks[pt] = rank(pt)
+		}
+		sort.SliceStable(formats, func(i, j int) bool {
+			return ranks[formats[i]] < ranks[formats[j]]
+		})
+	}
+}
+
+// PreferCodecs orders the formats of the media of sd, see PreferCodecsSDP.
+func PreferCodecs(sd webrtc.SessionDescription, prefs []string) (webrtc.SessionDescription, error) {
+	if len(prefs) == 0 {
+		return sd, nil
+	}
+
+	parsedSdp, err := sd.Unmarshal()
+	if err != nil {
+		return sd, errors.Wrap(rtcerror.ErrSdpUnmarshal, err.Error())
+	}
+
+	PreferCodecsSDP(parsedSdp, prefs)
+
+	b, err := parsedSdp.Marshal()
+	if err != nil {
+		return sd, errors.Wrap(err, "failed to marshal sdp")
+	}
+
+	return webrtc.SessionDescription{Type: sd.Type, SDP: string(b)}, nil
+}
@@ -116,6 +116,18 @@ func GeneratePayloadUnit(parsedSdp *sdp.SessionDescription, md *sdp.MediaDescrip
 	return pu, nil
 }
 
+// isRepairEncoding tells retransmission and error correction payloads from
+// the media.
+func isRepairEncoding(name string) bool {
+	for _, repair := range []string{"rtx", "red", "ulpfec", "flexfec-03"} {
+		if strings.EqualFold(name, repair) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func GeneratePayloadUnits(sd *sdp.SessionDescription) (puSlices []*Payload, err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -132,7 +144,7 @@ func GeneratePayloadUnits(sd *sdp.SessionDescription) (puSlices []*Payload, err
 			pt := uint8(0)
 			encodingName := ""
 			pt, encodingName, _, _, err = ParseRtpmap(attr.Value)
-			if strings.EqualFold(encodingName, "rtx") {
+			if isRepairEncoding(encodingName) {
 				continue
 			}
 
@@ -174,7 +186,7 @@ func GetFirstPayloadType(kind string, sd *sdp.SessionDescription) (pt uint8, rtx
 					return 0, 0, err
 				}
 
-				if strings.EqualFold(encodingName, "rtx") {
+				if isRepairEncoding(encodingName) {
 					continue
 				}
 
@@ -0,0 +1,200 @@
+package sdpassistor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingostack/neon/pkg/rtclib/rtcerror"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+	"github.com/pkg/errors"
+)
+
+// the problems of an offer ValidateOffer finds
+const (
+	OfferInvalidSDP         = "invalid-sdp"
+	OfferNotOffer           = "not-offer"
+	OfferNoMedia            = "no-media"
+	OfferMissingICEUfrag    = "missing-ice-ufrag"
+	OfferMissingICEPwd      = "missing-ice-pwd"
+	OfferMissingFingerprint = "missing-fingerprint"
+	OfferMissingMid         = "missing-mid"
+	OfferUnsupportedCodec   = "unsupported-codec"
+	OfferUnsupportedProto   = "unsupported-protocol"
+	OfferBundleMismatch     = "bundle-mismatch"
+)
+
+// OfferError names the problem of an offer, what the remote has to change for
+// it to be answered.
+type OfferError struct {
+	Code string `json:"code"`
+	// Media is the index of the m-line, -1 for the session.
+	Media  int    `json:"media"`
+	Mid    string `json:"mid,omitempty"`
+	Detail string `json:"detail"`
+}
+
+func (e *OfferError) Error() string {
+	if e.Media < 0 {
+		return fmt.Sprintf("invalid offer, %s: %s", e.Code, e.Detail)
+	}
+
+	return fmt.Sprintf("invalid offer, %s in media %d: %s", e.Code, e.Media, e.Detail)
+}
+
+func offerError(code string, media int, md *sdp.MediaDescription, format string, args ...interface{}) *OfferError {
+	e := &OfferError{Code: code, Media: media, Detail: fmt.Sprintf(format, args...)}
+	if md != nil {
+		e.Mid, _ = md.Attribute(sdp.AttrKeyMID)
+	}
+
+	return e
+}
+
+// ValidateOffer checks what an offer needs to be answered, supported tells
+// the mime types of the codecs that can be, e.g. video/VP8. The error is an
+// *OfferError.
+func ValidateOffer(sd webrtc.SessionDescription, supported func(mime string) bool) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Wrapf(rtcerror.ErrPanics, "ValidateOffer panic: %v", r)
+		}
+	}()
+
+	if sd.Type != webrtc.SDPTypeOffer {
+		return offerError(OfferNotOffer, -1, nil, "description is an %s", sd.Type)
+	}
+
+	parsed, err := sd.Unmarshal()
+	if err != nil {
+		return offerError(OfferInvalidSDP, -1, nil, "%v", err)
+	}
+
+	if len(parsed.MediaDescriptions) == 0 {
+		return offerError(OfferNoMedia, -1, nil, "no m-line")
+	}
+
+	bundle := bundledMids(parsed)
+	var credentials string
+	for i, md := range parsed.MediaDescriptions {
+		if _, only := md.Attribute("bundle-only"); md.MediaName.Port.Value == 0 && !only {
+			// rejected
+			continue
+		}
+
+		if err := validateMedia(parsed, i, md, supported); err != nil {
+			return err
+		}
+
+		mid, ok := md.Attribute(sdp.AttrKeyMID)
+		if !ok && bundle != nil {
+			return offerError(OfferMissingMid, i, md, "a=mid is needed to bundle the media")
+		}
+
+		// all media go on one transport, with the ice credentials of the first
+		ufrag, _ := attribute(parsed, md, "ice-ufrag")
+		pwd, _ := attribute(parsed, md, "ice-pwd")
+		switch {
+		case credentials == "":
+			credentials = ufrag + ":" + pwd
+		case credentials == ufrag+":"+pwd:
+		case bundle[mid]:
+			return offerError(OfferBundleMismatch, i, md, "the ice credentials differ from those of the bundled media")
+		default:
+			return offerError(OfferBundleMismatch, i, md,
+				"the media is not in a=group:BUNDLE and has its own ice credentials, all media have to be bundled")
+		}
+	}
+
+	return nil
+}
+
+func validateMedia(parsed *sdp.SessionDescription, i int, md *sdp.MediaDescription, supported func(mime string) bool) error {
+	if _, ok := attribute(parsed, md, "ice-ufrag"); !ok {
+		return offerError(OfferMissingICEUfrag, i, md, "no a=ice-ufrag in the media or the session")
+	}
+
+	if _, ok := attribute(parsed, md, "ice-pwd"); !ok {
+		return offerError(OfferMissingICEPwd, i, md, "no a=ice-pwd in the media or the session")
+	}
+
+	if _, ok := attribute(parsed, md, "fingerprint"); !ok {
+		return offerError(OfferMissingFingerprint, i, md, "no a=fingerprint in the media or the session")
+	}
+
+	protos := strings.Join(md.MediaName.Protos, "/")
+	if md.MediaName.Media == "application" {
+		if !strings.Contains(protos, "DTLS/SCTP") {
+			return offerError(OfferUnsupportedProto, i, md, "%s, data channels need UDP/DTLS/SCTP", protos)
+		}
+		return nil
+	}
+
+	if !strings.Contains(protos, "SAVP") {
+		return offerError(OfferUnsupportedProto, i, md, "%s, media needs UDP/TLS/RTP/SAVPF", protos)
+	}
+
+	if supported == nil {
+		return nil
+	}
+
+	var offered []string
+	for _, attr := range md.Attributes {
+		if attr.Key != "rtpmap" {
+			continue
+		}
+
+		_, name, _, _, err := ParseRtpmap(attr.Value)
+		if err != nil {
+			return offerError(OfferInvalidSDP, i, md, "a=rtpmap:%s, %v", attr.Value, err)
+		}
+
+		switch strings.ToLower(name) {
+		case "rtx", "red", "ulpfec", "flexfec-03", "telephone-event", "cn":
+			// repair and signalling, not what the media is sent in
+			continue
+		}
+
+		if supported(md.MediaName.Media + "/" + name) {
+			return nil
+		}
+		if !strings.Contains(","+strings.Join(offered, ",")+",", ","+name+",") {
+			offered = append(offered, name)
+		}
+	}
+
+	if len(offered) == 0 {
+		// static payload types only
+		return nil
+	}
+
+	return offerError(OfferUnsupportedCodec, i, md, "%s offers %s, none of them is supported",
+		md.MediaName.Media, strings.Join(offered, ", "))
+}
+
+// bundledMids are the mids of the BUNDLE group, nil without one.
+func bundledMids(parsed *sdp.SessionDescription) map[string]bool {
+	for _, attr := range parsed.Attributes {
+		if attr.Key != sdp.AttrKeyGroup || !strings.HasPrefix(attr.Value, "BUNDLE") {
+			continue
+		}
+
+		mids := make(map[string]bool)
+		for _, mid := range strings.Fields(strings.TrimPrefix(attr.Value, "BUNDLE")) {
+			mids[mid] = true
+		}
+		return mids
+	}
+
+	return nil
+}
+
+// attribute is the attribute key of the media, of the session when the media
+// has none.
+func attribute(parsed *sdp.SessionDescription, md *sdp.MediaDescription, key string) (string, bool) {
+	if v, ok := md.Attribute(key); ok {
+		return v, true
+	}
+
+	return parsed.Attribute(key)
+}
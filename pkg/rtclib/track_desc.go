@@ -0,0 +1,132 @@
+package rtclib
+
+import (
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/logger"
+	"github.com/pion/webrtc/v4"
+	"github.com/pkg/errors"
+)
+
+// TrackDesc describes a track of a local stream, a data channel when its
+// codec is data.
+type TrackDesc struct {
+	Codec     deliver.CodecType
+	ClockRate uint32
+	// Direction of the transceiver of a media track. Without one the track is
+	// added like PeerConnection.AddTrack does, to a transceiver the remote
+	// offered when there is one. A recvonly or inactive track sends nothing.
+	Direction webrtc.RTPTransceiverDirection
+	// StreamID and TrackID are the msid of a media track, see WithMSID, the
+	// TrackID of a data channel is its label.
+	StreamID string
+	TrackID  string
+	// Encodings are the rids of the simulcast encodings of a media track, one
+	// without rid when empty.
+	Encodings []string
+	Options   []TrackOption
+}
+
+// TrackHandle is a track SetupTracks added.
+type TrackHandle struct {
+	Desc TrackDesc
+	// Track is the first encoding of a media track, nil for a track sending
+	// nothing and a data channel.
+	Track *TrackLocl
+	// Encodings are the tracks of the encodings by the order of
+	// Desc.Encodings.
+	Encodings []*TrackLocl
+	// Transceiver is that of a media track with a direction.
+	Transceiver *webrtc.RTPTransceiver
+	DataChannel *webrtc.DataChannel
+}
+
+// SetupTracks adds the tracks of descs in their order, the tracks added
+// before one fails stay.
+func (ls *LocalStream) SetupTracks(logger logger.Logger, descs ...TrackDesc) ([]*TrackHandle, error) {
+	handles := make([]*TrackHandle, 0, len(descs))
+	for i, desc := range descs {
+		h, err := ls.setupTrack(logger, desc)
+		if err != nil {
+			return handles, errors.Wrapf(err, "failed to set up track %d", i)
+		}
+		handles = append(handles, h)
+	}
+
+	return handles, nil
+}
+
+func (ls *LocalStream) setupTrack(logger logger.Logger, desc TrackDesc) (*TrackHandle, error) {
+	h := &TrackHandle{Desc: desc}
+	if desc.Codec.IsData() {
+		if desc.TrackID == "" {
+			return nil, errors.New("data channel without label")
+		}
+
+		dc, err := ls.Transport.CreateDataChannel(desc.TrackID, nil)
+		if err != nil {
+			return nil, err
+		}
+		h.DataChannel = dc
+
+		return h, nil
+	}
+
+	switch desc.Direction {
+	case webrtc.RTPTransceiverDirectionRecvonly, webrtc.RTPTransceiverDirectionInactive:
+		kind := webrtc.RTPCodecTypeAudio
+		if desc.Codec.IsVideo() {
+			kind = webrtc.RTPCodecTypeVideo
+		}
+
+		tr, err := ls.Transport.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: desc.Direction})
+		if err != nil {
+			return nil, err
+		}
+		h.Transceiver = tr
+
+		return h, nil
+	}
+
+	rids := desc.Encodings
+	if len(rids) == 0 {
+		rids = []string{""}
+	}
+
+	// the first encoding adds the sender, the others are encodings of it
+	var sender *webrtc.RTPSender
+	addTrack := func(track webrtc.TrackLocal) (*webrtc.RTPSender, error) {
+		if sender != nil {
+			return sender, sender.AddEncoding(track)
+		}
+
+		if desc.Direction == webrtc.RTPTransceiverDirectionUnknown {
+			var err error
+			sender, err = ls.Transport.AddTrack(track)
+			return sender, err
+		}
+
+		tr, err := ls.Transport.AddTransceiverFromTrack(track, webrtc.RTPTransceiverInit{Direction: desc.Direction})
+		if err != nil {
+			return nil, err
+		}
+		h.Transceiver, sender = tr, tr.Sender()
+
+		return sender, nil
+	}
+
+	for _, rid := range rids {
+		opts := append([]TrackOption{WithMSID(desc.StreamID, desc.TrackID), WithRID(rid)}, desc.Options...)
+		track, err := NewTrackLocl(ls.ctx, desc.Codec, desc.ClockRate, addTrack, logger, opts...)
+		if err != nil {
+			return nil, err
+		}
+		h.Encodings = append(h.Encodings, track)
+
+		ls.lock.Lock()
+		ls.tracks = append(ls.tracks, track)
+		ls.lock.Unlock()
+	}
+	h.Track = h.Encodings[0]
+
+	return h, nil
+}
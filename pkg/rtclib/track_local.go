@@ -3,9 +3,14 @@ package rtclib
 import (
 	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pingostack/neon/pkg/deliver"
 	"github.com/pingostack/neon/pkg/logger"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/pingostack/neon/pkg/rtclib/rtcerror"
 	"github.com/pion/interceptor"
 	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v4"
@@ -13,143 +18,148 @@ import (
 
 const (
 	defaultWebrtcStreamID = "pingos"
+	// muted opus tracks send a silent frame every opusFrameDuration, other
+	// muted tracks a padding packet every mutedPaddingInterval
+	opusFrameDuration    = 20 * time.Millisecond
+	mutedPaddingInterval = time.Second
+	paddingSize          = 224
 )
 
+// opusSilence is a 20ms silent opus frame, code 0 and TOC config 31.
+var opusSilence = []byte{0xf8, 0xff, 0xfe}
+
+type localTrack interface {
+	webrtc.TrackLocal
+	WriteRTP(p *rtp.Packet) error
+}
+
 type TrackLocl struct {
-	track  *webrtc.TrackLocalStaticRTP
-	ctx    context.Context
-	cancel context.CancelFunc
-	logger logger.Logger
-	sender *webrtc.RTPSender
+	track        localTrack
+	ctx          context.Context
+	cancel       context.CancelFunc
+	logger       logger.Logger
+	sender       *webrtc.RTPSender
+	bytes        uint64
+	codec        deliver.CodecType
+	clockRate    uint32
+	lock         sync.Mutex
+	stamp        *restamper
+	muted        bool
+	muteCancel   context.CancelFunc
+	waitKeyframe bool
+	onResync     func()
 }
 
 type addTrackFunc func(webrtc.TrackLocal) (*webrtc.RTPSender, error)
 
-func NewTrackLocl(ctx context.Context, codec deliver.CodecType, clockRate uint32, addTrack addTrackFunc, logger logger.Logger) (*TrackLocl, error) {
-	t := &TrackLocl{
-		logger: logger,
+type trackOptions struct {
+	fecGroup    int
+	redDistance int
+	streamID    string
+	trackID     string
+	rid         string
+}
+
+type TrackOption func(*trackOptions)
+
+// WithFEC protects every group of packets of a video track with an ulpfec
+// packet, for players that negotiate red and ulpfec.
+func WithFEC(group int) TrackOption {
+	return func(o *trackOptions) {
+		o.fecGroup = group
 	}
+}
 
-	t.ctx, t.cancel = context.WithCancel(ctx)
+// WithRED repeats the payloads of the distance packets before in every packet
+// of an opus track, for players that negotiate red, at most MaxREDDistance.
+func WithRED(distance int) TrackOption {
+	return func(o *trackOptions) {
+		o.redDistance = distance
+	}
+}
+
+// WithMSID sets the stream and track id of the msid of a track, the default
+// stream and the name of the codec when empty.
+func WithMSID(streamID, trackID string) TrackOption {
+	return func(o *trackOptions) {
+		o.streamID, o.trackID = streamID, trackID
+	}
+}
+
+// WithRID sends a track as the simulcast encoding rid.
+func WithRID(rid string) TrackOption {
+	return func(o *trackOptions) {
+		o.rid = rid
+	}
+}
 
+// trackCapability is the codec of a local track of codec and its default id.
+func trackCapability(codec deliver.CodecType, clockRate uint32) (webrtc.RTPCodecCapability, string, bool) {
 	switch codec {
 	case deliver.CodecTypeAV1:
-		var err error
-		t.track, err = webrtc.NewTrackLocalStaticRTP(
-			webrtc.RTPCodecCapability{
-				MimeType:  webrtc.MimeTypeAV1,
-				ClockRate: 90000,
-			},
-			"av1",
-			defaultWebrtcStreamID,
-		)
-		if err != nil {
-			return nil, err
-		}
-
+		return webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeAV1, ClockRate: 90000}, "av1", true
 	case deliver.CodecTypeVP9:
-		var err error
-		t.track, err = webrtc.NewTrackLocalStaticRTP(
-			webrtc.RTPCodecCapability{
-				MimeType:  webrtc.MimeTypeVP9,
-				ClockRate: clockRate,
-			},
-			"vp9",
-			defaultWebrtcStreamID,
-		)
-		if err != nil {
-			return nil, err
-		}
-
+		return webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP9, ClockRate: clockRate}, "vp9", true
 	case deliver.CodecTypeVP8:
-		var err error
-		t.track, err = webrtc.NewTrackLocalStaticRTP(
-			webrtc.RTPCodecCapability{
-				MimeType:  webrtc.MimeTypeVP8,
-				ClockRate: clockRate,
-			},
-			"vp8",
-			defaultWebrtcStreamID,
-		)
-		if err != nil {
-			return nil, err
-		}
-
+		return webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: clockRate}, "vp8", true
 	case deliver.CodecTypeH264:
-		var err error
-		t.track, err = webrtc.NewTrackLocalStaticRTP(
-			webrtc.RTPCodecCapability{
-				MimeType:  webrtc.MimeTypeH264,
-				ClockRate: clockRate,
-			},
-			"h264",
-			defaultWebrtcStreamID,
-		)
-		if err != nil {
-			return nil, err
-		}
-
+		return webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: clockRate}, "h264", true
 	case deliver.CodecTypeOpus:
-		var err error
-		t.track, err = webrtc.NewTrackLocalStaticRTP(
-			webrtc.RTPCodecCapability{
-				MimeType:  webrtc.MimeTypeOpus,
-				ClockRate: clockRate,
-				Channels:  2,
-			},
-			"opus",
-			defaultWebrtcStreamID,
-		)
-		if err != nil {
-			return nil, err
-		}
-
+		return webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: clockRate, Channels: 2}, "opus", true
 	case deliver.CodecTypeG722_16000_2:
-		var err error
-		t.track, err = webrtc.NewTrackLocalStaticRTP(
-			webrtc.RTPCodecCapability{
-				MimeType:  webrtc.MimeTypeG722,
-				ClockRate: clockRate,
-			},
-			"g722",
-			defaultWebrtcStreamID,
-		)
-		if err != nil {
-			return nil, err
-		}
-
+		return webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeG722, ClockRate: clockRate}, "g722", true
 	case deliver.CodecTypePCMU:
-		var err error
-		t.track, err = webrtc.NewTrackLocalStaticRTP(
-			webrtc.RTPCodecCapability{
-				MimeType:  webrtc.MimeTypePCMU,
-				ClockRate: clockRate,
-			},
-			"g711",
-			defaultWebrtcStreamID,
-		)
-		if err != nil {
-			return nil, err
-		}
-
+		return webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypePCMU, ClockRate: clockRate}, "g711", true
 	case deliver.CodecTypePCMA:
+		return webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypePCMA, ClockRate: clockRate}, "g711", true
+	}
 
-		var err error
-		t.track, err = webrtc.NewTrackLocalStaticRTP(
-			webrtc.RTPCodecCapability{
-				MimeType:  webrtc.MimeTypePCMA,
-				ClockRate: clockRate,
-			},
-			"g711",
-			defaultWebrtcStreamID,
-		)
-		if err != nil {
-			return nil, err
-		}
+	return webrtc.RTPCodecCapability{}, "", false
+}
 
-	default:
+func NewTrackLocl(ctx context.Context, codec deliver.CodecType, clockRate uint32, addTrack addTrackFunc, logger logger.Logger, opts ...TrackOption) (*TrackLocl, error) {
+	options := trackOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	t := &TrackLocl{
+		logger:    logger,
+		codec:     codec,
+		clockRate: clockRate,
+		stamp:     newRestamper(clockRate),
+	}
+
+	t.ctx, t.cancel = context.WithCancel(ctx)
+
+	capability, id, ok := trackCapability(codec, clockRate)
+	if !ok {
 		return nil, fmt.Errorf("unsupported track type: %T", codec)
 	}
+	if options.trackID != "" {
+		id = options.trackID
+	}
+	streamID := defaultWebrtcStreamID
+	if options.streamID != "" {
+		streamID = options.streamID
+	}
+
+	var staticOpts []func(*webrtc.TrackLocalStaticRTP)
+	if options.rid != "" {
+		staticOpts = append(staticOpts, webrtc.WithRTPStreamID(options.rid))
+	}
+
+	static, err := webrtc.NewTrackLocalStaticRTP(capability, id, streamID, staticOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	t.track = static
+	if options.fecGroup > 0 && codec.IsVideo() {
+		t.track = newFECTrack(static, options.fecGroup)
+	} else if options.redDistance > 0 && codec == deliver.CodecTypeOpus {
+		t.track = newREDTrack(static, options.redDistance)
+	}
 
 	sender, err := addTrack(t.track)
 	if err != nil {
@@ -165,6 +175,205 @@ func (t *TrackLocl) ReadRTCP(buf []byte) (n int, a interceptor.Attributes, err e
 	return t.sender.Read(buf)
 }
 
+// WriteRTP sends a packet of the source, sequence numbers and timestamps are
+// rewritten to stay continuous across source changes. Nothing is sent while
+// the track is muted, video resumes on a keyframe after a change.
 func (t *TrackLocl) WriteRTP(pkt *rtp.Packet) error {
+	t.lock.Lock()
+	if t.muted {
+		t.lock.Unlock()
+		return nil
+	}
+
+	pkt, switched := t.stamp.apply(pkt)
+	if switched && t.codec.IsVideo() {
+		t.waitKeyframe = true
+	}
+
+	if t.waitKeyframe {
+		if !IsKeyframe(t.codec, pkt.Payload) {
+			t.lock.Unlock()
+			if switched && t.onResync != nil {
+				t.onResync()
+			}
+			return nil
+		}
+		t.waitKeyframe = false
+	}
+	t.lock.Unlock()
+
+	return t.write(pkt)
+}
+
+func (t *TrackLocl) write(pkt *rtp.Packet) error {
+	size := pkt.MarshalSize()
+	metrics.BytesOut.With(metrics.ProtocolWebRTC).Add(float64(size))
+	atomic.AddUint64(&t.bytes, uint64(size))
 	return t.track.WriteRTP(pkt)
 }
+
+func (t *TrackLocl) Codec() deliver.CodecType {
+	return t.codec
+}
+
+// OnResync is called when video waits for a keyframe of a new source, the
+// caller requests one.
+func (t *TrackLocl) OnResync(f func()) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.onResync = f
+}
+
+// Mute pauses the track without a renegotiation. Muted opus tracks send
+// silence, other tracks padding so the player keeps the stream, video freezes
+// on its last frame.
+func (t *TrackLocl) Mute() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.muted {
+		return
+	}
+
+	t.muted = true
+
+	var ctx context.Context
+	ctx, t.muteCancel = context.WithCancel(t.ctx)
+	go t.fillMuted(ctx)
+}
+
+// Unmute resumes the track, timestamps go on from the time it was muted.
+func (t *TrackLocl) Unmute() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if !t.muted {
+		return
+	}
+
+	t.muted = false
+	t.muteCancel()
+	t.stamp.resync(0)
+}
+
+func (t *TrackLocl) Muted() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.muted
+}
+
+// ReplaceSource switches the track to a new source mid-session, e.g. another
+// camera, without a renegotiation. The codec must be the negotiated one, a
+// source clock rate other than the track's is rescaled.
+func (t *TrackLocl) ReplaceSource(codec deliver.CodecType, clockRate uint32) error {
+	if codec != t.codec {
+		return fmt.Errorf("%w: track is %s, source %s", rtcerror.ErrCodecMismatch, t.codec, codec)
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.stamp.resync(clockRate)
+
+	return nil
+}
+
+func (t *TrackLocl) fillMuted(ctx context.Context) {
+	interval := mutedPaddingInterval
+	if t.codec == deliver.CodecTypeOpus {
+		interval = opusFrameDuration
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		t.lock.Lock()
+		if !t.muted || !t.stamp.started {
+			t.lock.Unlock()
+			continue
+		}
+
+		var pkt *rtp.Packet
+		if t.codec == deliver.CodecTypeOpus {
+			pkt = &rtp.Packet{Payload: opusSilence}
+			t.stamp.next(pkt, uint32(interval.Seconds()*float64(t.clockRate)))
+		} else {
+			pkt = newPaddingPacket()
+			t.stamp.next(pkt, 0)
+		}
+		t.lock.Unlock()
+
+		if err := t.write(pkt); err != nil {
+			t.logger.Debugf("failed to write muted packet: %v", err)
+		}
+	}
+}
+
+// WritePadding sends about size bytes of padding packets, e.g. to probe the
+// bandwidth towards the player. Padding goes between frames only, it returns
+// the bytes sent, none while the track is muted or within a frame.
+func (t *TrackLocl) WritePadding(size int) (int, error) {
+	t.lock.Lock()
+	if t.muted || t.waitKeyframe || !t.stamp.started || !t.stamp.lastMarker {
+		t.lock.Unlock()
+		return 0, nil
+	}
+
+	var pkts []*rtp.Packet
+	for sent := 0; sent < size; sent += paddingSize {
+		pkt := newPaddingPacket()
+		t.stamp.pad(pkt)
+		pkts = append(pkts, pkt)
+	}
+	t.lock.Unlock()
+
+	sent := 0
+	for _, pkt := range pkts {
+		if err := t.write(pkt); err != nil {
+			return sent, err
+		}
+		sent += pkt.MarshalSize()
+	}
+
+	return sent, nil
+}
+
+// newPaddingPacket returns a packet of padding only. The padding is in the
+// payload, the tracks write the header and payload of packets only.
+func newPaddingPacket() *rtp.Packet {
+	payload := make([]byte, paddingSize)
+	payload[paddingSize-1] = paddingSize
+
+	return &rtp.Packet{
+		Header:  rtp.Header{Version: 2, Padding: true},
+		Payload: payload,
+	}
+}
+
+// BytesSent counts the rtp bytes written to the track.
+func (t *TrackLocl) BytesSent() uint64 {
+	return atomic.LoadUint64(&t.bytes)
+}
+
+// ClockRate is the rtp clock rate of the track, the unit of the jitter
+// players report.
+func (t *TrackLocl) ClockRate() uint32 {
+	return t.clockRate
+}
+
+func (t *TrackLocl) SSRC() uint32 {
+	if encodings := t.sender.GetParameters().Encodings; len(encodings) > 0 {
+		return uint32(encodings[0].SSRC)
+	}
+
+	return 0
+}
@@ -2,19 +2,51 @@ package rtclib
 
 import (
 	"context"
+	"math"
+	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/pingostack/neon/pkg/bufpool"
+	"github.com/pingostack/neon/pkg/deliver"
 	"github.com/pingostack/neon/pkg/logger"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/pingostack/neon/pkg/rtclib/transport"
 	"github.com/pion/interceptor"
 	"github.com/pion/rtcp"
 	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v4"
 )
 
+const (
+	rtpReadBufferSize = 1500
+)
+
+// TrackInfo describes the codec and format of a remote track.
+type TrackInfo struct {
+	ID          string
+	StreamID    string
+	Kind        webrtc.RTPCodecType
+	Codec       deliver.CodecType
+	MimeType    string
+	ClockRate   uint32
+	Channels    uint16
+	PayloadType uint8
+	Fmtp        string
+	SSRC        uint32
+}
+
 type TrackRemote struct {
 	ctx      context.Context
 	track    *webrtc.TrackRemote
 	receiver *webrtc.RTPReceiver
 	logger   logger.Logger
+	stats    rtpStats
+	bytes    uint64
+	lost     uint64
+	jitter   uint64 // float64 bits, seconds
+	window   lossWindow
+	repair   repair
 }
 
 func NewTrackRemote(ctx context.Context,
@@ -36,9 +68,116 @@ func (t *TrackRemote) ReadRTCP(buf []byte) (n int, a interceptor.Attributes, err
 	return t.receiver.Read(buf)
 }
 
+// ReadRTP returns the media packets of the track, unwrapped from red, and
+// the packets ulpfec recovered.
 func (t *TrackRemote) ReadRTP() (*rtp.Packet, error) {
-	packet, _, err := t.track.ReadRTP()
-	return packet, err
+	for {
+		if packet := t.repair.next(); packet != nil {
+			return packet, nil
+		}
+
+		packet, _, err := t.track.ReadRTP()
+		if err != nil {
+			return nil, err
+		}
+
+		t.observe(packet)
+
+		if packet, ok := t.unwrap(packet); ok {
+			return packet, nil
+		}
+	}
+}
+
+// ReadRTPBuffer reads into pooled memory, the packet aliases the returned
+// buffer which the caller must Release once the packet is no longer used.
+func (t *TrackRemote) ReadRTPBuffer() (*rtp.Packet, *bufpool.Buffer, error) {
+	for {
+		if packet := t.repair.next(); packet != nil {
+			return copyToBuffer(packet)
+		}
+
+		buf := bufpool.Get(rtpReadBufferSize)
+		n, _, err := t.track.Read(buf.Bytes())
+		if err != nil {
+			buf.Release()
+			return nil, nil, err
+		}
+		buf.SetLen(n)
+
+		packet := &rtp.Packet{}
+		if err := packet.Unmarshal(buf.Bytes()); err != nil {
+			buf.Release()
+			return nil, nil, err
+		}
+
+		t.observe(packet)
+
+		if packet, ok := t.unwrap(packet); ok {
+			return packet, buf, nil
+		}
+		buf.Release()
+	}
+}
+
+func (t *TrackRemote) unwrap(packet *rtp.Packet) (*rtp.Packet, bool) {
+	if !t.repair.resolved {
+		t.repair.resolve(t.receiver.GetParameters().Codecs)
+	}
+
+	return t.repair.unwrap(packet)
+}
+
+func copyToBuffer(packet *rtp.Packet) (*rtp.Packet, *bufpool.Buffer, error) {
+	buf := bufpool.Get(packet.MarshalSize())
+	if _, err := packet.MarshalTo(buf.Bytes()); err != nil {
+		buf.Release()
+		return nil, nil, err
+	}
+
+	copied := &rtp.Packet{}
+	if err := copied.Unmarshal(buf.Bytes()); err != nil {
+		buf.Release()
+		return nil, nil, err
+	}
+
+	return copied, buf, nil
+}
+
+func (t *TrackRemote) observe(packet *rtp.Packet) {
+	kind := t.track.Kind().String()
+	size := packet.MarshalSize()
+	metrics.BytesIn.With(metrics.ProtocolWebRTC).Add(float64(size))
+	atomic.AddUint64(&t.bytes, uint64(size))
+	if lost := t.stats.update(packet, t.track.Codec().ClockRate, time.Now()); lost > 0 {
+		metrics.RTPPacketsLost.With(kind).Add(float64(lost))
+		atomic.AddUint64(&t.lost, uint64(lost))
+	}
+	jitter := t.stats.jitterSeconds()
+	atomic.StoreUint64(&t.jitter, math.Float64bits(jitter))
+	metrics.RTPJitter.With(kind).Observe(jitter)
+	t.window.observe(packet.SequenceNumber)
+}
+
+// BytesReceived counts the rtp bytes read from the track.
+func (t *TrackRemote) BytesReceived() uint64 {
+	return atomic.LoadUint64(&t.bytes)
+}
+
+// PacketsLost counts the packets missing from sequence gaps.
+func (t *TrackRemote) PacketsLost() uint64 {
+	return atomic.LoadUint64(&t.lost)
+}
+
+// Jitter is the interarrival jitter of RFC 3550.
+func (t *TrackRemote) Jitter() time.Duration {
+	return time.Duration(math.Float64frombits(atomic.LoadUint64(&t.jitter)) * float64(time.Second))
+}
+
+// LossReport returns a loss rle block of the packets since the last call, nil
+// if none arrived.
+func (t *TrackRemote) LossReport() *rtcp.LossRLEReportBlock {
+	return t.window.report(uint32(t.track.SSRC()))
 }
 
 func (t *TrackRemote) IsAudio() bool {
@@ -56,3 +195,77 @@ func (t *TrackRemote) SSRC() webrtc.SSRC {
 func (t *TrackRemote) Kind() webrtc.RTPCodecType {
 	return t.track.Kind()
 }
+
+func (t *TrackRemote) ID() string {
+	return t.track.ID()
+}
+
+// Codec converts the negotiated mime type, e.g. video/H264.
+func (t *TrackRemote) Codec() deliver.CodecType {
+	mimeType := t.codec().MimeType
+	if i := strings.IndexByte(mimeType, '/'); i >= 0 {
+		mimeType = mimeType[i+1:]
+	}
+
+	return deliver.ConvCodecType(mimeType)
+}
+
+// codec is the codec of the media, the track reports red once a red
+// packet arrived.
+func (t *TrackRemote) codec() webrtc.RTPCodecParameters {
+	codec := t.track.Codec()
+	if !isRepairCodec(codec.MimeType) {
+		return codec
+	}
+
+	for _, c := range t.receiver.GetParameters().Codecs {
+		if isRepairCodec(c.MimeType) {
+			continue
+		}
+
+		if t.repair.mediaPT == 0 || uint8(c.PayloadType) == t.repair.mediaPT {
+			return c
+		}
+	}
+
+	return codec
+}
+
+func isRepairCodec(mimeType string) bool {
+	for _, repair := range []string{transport.MimeTypeAudioRed, transport.MimeTypeVideoRed, transport.MimeTypeULPFEC} {
+		if strings.EqualFold(mimeType, repair) {
+			return true
+		}
+	}
+
+	return strings.HasSuffix(strings.ToLower(mimeType), "/rtx")
+}
+
+func (t *TrackRemote) Info() TrackInfo {
+	codec := t.codec()
+
+	return TrackInfo{
+		ID:          t.track.ID(),
+		StreamID:    t.track.StreamID(),
+		Kind:        t.track.Kind(),
+		Codec:       t.Codec(),
+		MimeType:    codec.MimeType,
+		ClockRate:   codec.ClockRate,
+		Channels:    codec.Channels,
+		PayloadType: uint8(codec.PayloadType),
+		Fmtp:        codec.SDPFmtpLine,
+		SSRC:        uint32(t.track.SSRC()),
+	}
+}
+
+// HeaderExtensionID is the negotiated id of the header extension uri, 0 if
+// it was not negotiated.
+func (t *TrackRemote) HeaderExtensionID(uri string) uint8 {
+	for _, ext := range t.receiver.GetParameters().HeaderExtensions {
+		if ext.URI == uri {
+			return uint8(ext.ID)
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,163 @@
+package transport
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+// Stats are the counters of a connection, what getStats tells of a
+// browser's.
+type Stats struct {
+	// the selected candidate pair, e.g. udp host 10.0.0.1:5000
+	LocalCandidate  string  `json:"localCandidate,omitempty"`
+	RemoteCandidate string  `json:"remoteCandidate,omitempty"`
+	RTT             float64 `json:"rtt"` // milliseconds, of the stun checks of the pair
+	// bytes on the wire, srtp, rtcp, dtls and stun
+	BytesSent       uint64 `json:"bytesSent"`
+	BytesReceived   uint64 `json:"bytesReceived"`
+	PacketsSent     uint64 `json:"packetsSent"`     // rtp
+	PacketsReceived uint64 `json:"packetsReceived"` // rtp
+	// the rtcp feedback sent to the remote and received from it
+	FeedbackSent     FeedbackStats `json:"feedbackSent"`
+	FeedbackReceived FeedbackStats `json:"feedbackReceived"`
+}
+
+// FeedbackStats count the rtcp feedback of one direction.
+type FeedbackStats struct {
+	NACKs uint64 `json:"nacks"`
+	// NACKedPackets the nacks asked for again
+	NACKedPackets uint64 `json:"nackedPackets"`
+	PLIs          uint64 `json:"plis"`
+	FIRs          uint64 `json:"firs"`
+	// REMB is the last estimated maximum bitrate, bits per second, 0 before
+	// one.
+	REMB uint64 `json:"remb,omitempty"`
+}
+
+type feedbackCounters struct {
+	nacks, nackedPackets, plis, firs, remb atomic.Uint64
+}
+
+func (c *feedbackCounters) count(pkts []rtcp.Packet) {
+	for _, pkt := range pkts {
+		switch p := pkt.(type) {
+		case *rtcp.TransportLayerNack:
+			c.nacks.Add(1)
+			for _, pair := range p.Nacks {
+				c.nackedPackets.Add(uint64(len(pair.PacketList())))
+			}
+		case *rtcp.PictureLossIndication:
+			c.plis.Add(1)
+		case *rtcp.FullIntraRequest:
+			c.firs.Add(1)
+		case *rtcp.ReceiverEstimatedMaximumBitrate:
+			c.remb.Store(uint64(p.Bitrate))
+		}
+	}
+}
+
+func (c *feedbackCounters) stats() FeedbackStats {
+	return FeedbackStats{
+		NACKs:         c.nacks.Load(),
+		NACKedPackets: c.nackedPackets.Load(),
+		PLIs:          c.plis.Load(),
+		FIRs:          c.firs.Load(),
+		REMB:          c.remb.Load(),
+	}
+}
+
+// statsInterceptor counts the rtp packets and the rtcp feedback of a
+// transport.
+type statsInterceptor struct {
+	interceptor.NoOp
+	packetsSent     atomic.Uint64
+	packetsReceived atomic.Uint64
+	sent            feedbackCounters
+	received        feedbackCounters
+}
+
+func (i *statsInterceptor) NewInterceptor(_ string) (interceptor.Interceptor, error) {
+	return i, nil
+}
+
+func (i *statsInterceptor) BindRTCPReader(reader interceptor.RTCPReader) interceptor.RTCPReader {
+	return interceptor.RTCPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		n, a, err := reader.Read(b, a)
+		if err == nil {
+			if pkts, err := rtcp.Unmarshal(b[:n]); err == nil {
+				i.received.count(pkts)
+			}
+		}
+
+		return n, a, err
+	})
+}
+
+func (i *statsInterceptor) BindRTCPWriter(writer interceptor.RTCPWriter) interceptor.RTCPWriter {
+	return interceptor.RTCPWriterFunc(func(pkts []rtcp.Packet, a interceptor.Attributes) (int, error) {
+		i.sent.count(pkts)
+		return writer.Write(pkts, a)
+	})
+}
+
+func (i *statsInterceptor) BindLocalStream(_ *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, a interceptor.Attributes) (int, error) {
+		i.packetsSent.Add(1)
+		return writer.Write(header, payload, a)
+	})
+}
+
+func (i *statsInterceptor) BindRemoteStream(_ *interceptor.StreamInfo, reader interceptor.RTPReader) interceptor.RTPReader {
+	return interceptor.RTPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		n, a, err := reader.Read(b, a)
+		if err == nil {
+			i.packetsReceived.Add(1)
+		}
+
+		return n, a, err
+	})
+}
+
+// GetStats returns the counters of the connection, it shadows the report of
+// the peer connection, pion counts no rtp streams in it.
+func (t *Transport) GetStats() Stats {
+	var stats Stats
+	if t.counters != nil {
+		stats.PacketsSent = t.counters.packetsSent.Load()
+		stats.PacketsReceived = t.counters.packetsReceived.Load()
+		stats.FeedbackSent = t.counters.sent.stats()
+		stats.FeedbackReceived = t.counters.received.stats()
+	}
+
+	if pair, err := t.getSelectedPair(); err == nil && pair != nil {
+		stats.LocalCandidate = candidateString(pair.Local)
+		stats.RemoteCandidate = candidateString(pair.Remote)
+	}
+
+	for _, s := range t.PeerConnection.GetStats() {
+		switch s := s.(type) {
+		case webrtc.TransportStats:
+			stats.BytesSent += s.BytesSent
+			stats.BytesReceived += s.BytesReceived
+		case webrtc.ICECandidatePairStats:
+			if s.Nominated && s.State == webrtc.StatsICECandidatePairStateSucceeded {
+				stats.RTT = s.CurrentRoundTripTime * 1000
+			}
+		}
+	}
+
+	return stats
+}
+
+func candidateString(c *webrtc.ICECandidate) string {
+	if c == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%s %s %s:%d", c.Protocol, c.Typ, c.Address, c.Port)
+}
@@ -0,0 +1,94 @@
+package transport
+
+import (
+	"net"
+	"sync/atomic"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// PacketTap is called with the decrypted rtp and rtcp packets of a transport
+// as they are on the wire, packet is only valid during the call.
+type PacketTap = func(inbound, isRTCP bool, packet []byte)
+
+// tapInterceptor is the first of the chain, it sees the packets other
+// interceptors added, e.g. nack responses and transport-cc extensions.
+type tapInterceptor struct {
+	interceptor.NoOp
+	tap atomic.Value // PacketTap
+}
+
+func (i *tapInterceptor) NewInterceptor(_ string) (interceptor.Interceptor, error) {
+	return i, nil
+}
+
+func (i *tapInterceptor) load() PacketTap {
+	tap, _ := i.tap.Load().(PacketTap)
+	return tap
+}
+
+func (i *tapInterceptor) BindRTCPReader(reader interceptor.RTCPReader) interceptor.RTCPReader {
+	return interceptor.RTCPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		n, a, err := reader.Read(b, a)
+		if tap := i.load(); tap != nil && err == nil {
+			tap(true, true, b[:n])
+		}
+
+		return n, a, err
+	})
+}
+
+func (i *tapInterceptor) BindRTCPWriter(writer interceptor.RTCPWriter) interceptor.RTCPWriter {
+	return interceptor.RTCPWriterFunc(func(pkts []rtcp.Packet, a interceptor.Attributes) (int, error) {
+		if tap := i.load(); tap != nil {
+			if b, err := rtcp.Marshal(pkts); err == nil {
+				tap(false, true, b)
+			}
+		}
+
+		return writer.Write(pkts, a)
+	})
+}
+
+func (i *tapInterceptor) BindLocalStream(_ *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, a interceptor.Attributes) (int, error) {
+		if tap := i.load(); tap != nil {
+			if b, err := header.Marshal(); err == nil {
+				tap(false, false, append(b, payload...))
+			}
+		}
+
+		return writer.Write(header, payload, a)
+	})
+}
+
+func (i *tapInterceptor) BindRemoteStream(_ *interceptor.StreamInfo, reader interceptor.RTPReader) interceptor.RTPReader {
+	return interceptor.RTPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		n, a, err := reader.Read(b, a)
+		if tap := i.load(); tap != nil && err == nil {
+			tap(true, false, b[:n])
+		}
+
+		return n, a, err
+	})
+}
+
+// SetPacketTap calls tap with every rtp and rtcp packet sent and received,
+// nil stops.
+func (t *Transport) SetPacketTap(tap PacketTap) {
+	t.tap.tap.Store(tap)
+}
+
+// SelectedAddrs returns the addresses of the selected candidate pair, nil
+// before ice connected.
+func (t *Transport) SelectedAddrs() (local, remote net.Addr) {
+	pair, err := t.getSelectedPair()
+	if err != nil || pair == nil || pair.Local == nil || pair.Remote == nil {
+		return nil, nil
+	}
+
+	return &net.UDPAddr{IP: net.ParseIP(pair.Local.Address), Port: int(pair.Local.Port)},
+		&net.UDPAddr{IP: net.ParseIP(pair.Remote.Address), Port: int(pair.Remote.Port)}
+}
@@ -44,6 +44,7 @@ type Transport struct {
 	webrtcConfig  *config.WebRTCConfig
 	icc           *config.ICEConfig
 	allowedCodecs []config.CodecConfig
+	codecPrefs    []string
 	logger        logger.Logger
 	eventemitter  eventemitter.EventEmitter
 	ctx           context.Context
@@ -70,16 +71,21 @@ type Transport struct {
 	onFailed                   func(isShort bool)
 	onInitialConnected         func()
 	onICEGathererStateComplete func()
+	onStateChange              func(kind, state string)
 	resetShortConnOnICERestart atomic.Bool
 	pendingRemoteCandidates    []*webrtc.ICECandidateInit
 	localSdpType               webrtc.SDPType
 	localSdpSetted             bool
 	remoteSdpSetted            bool
+	tap                        *tapInterceptor
+	counters                   *statsInterceptor
 }
 
 func NewTransport(opts ...TransportOpt) (*Transport, error) {
 	t := &Transport{
 		localSdpType: webrtc.SDPTypeOffer,
+		tap:          &tapInterceptor{},
+		counters:     &statsInterceptor{},
 	}
 
 	for _, opt := range opts {
@@ -106,6 +112,7 @@ func NewTransport(opts ...TransportOpt) (*Transport, error) {
 
 	t.PeerConnection.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
 		t.logger.Debugf("ICE connection state changed: %s", state.String())
+		t.stateChanged("ice", state.String())
 		switch state {
 		case webrtc.ICEConnectionStateConnected:
 			t.setICEConnectedAt(time.Now())
@@ -132,9 +139,15 @@ func NewTransport(opts ...TransportOpt) (*Transport, error) {
 
 	t.PeerConnection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
 		t.logger.Debugf("Connection state changed: %s", state.String())
+		t.stateChanged("connection", state.String())
 		switch state {
 		case webrtc.PeerConnectionStateConnected:
 			t.clearConnTimer()
+			if err := t.verifyPinnedCertificate(); err != nil {
+				t.logger.Errorf("dtls certificate rejected: %v", err)
+				t.handleConnectionFailed(false)
+				return
+			}
 			first := t.setConnectedAt(time.Now())
 			if first {
 				if t.onInitialConnected != nil {
@@ -173,6 +186,12 @@ func WithAllowedCodecs(allowedCodecs []config.CodecConfig) func(t *Transport) {
 	}
 }
 
+func WithCodecPreferences(prefs []string) func(t *Transport) {
+	return func(t *Transport) {
+		t.codecPrefs = prefs
+	}
+}
+
 func WithLogger(logger logger.Logger) func(t *Transport) {
 	return func(t *Transport) {
 		t.logger = logger
@@ -268,6 +287,23 @@ func (t *Transport) getSelectedPair() (*webrtc.ICECandidatePair, error) {
 	return iceTransport.GetSelectedCandidatePair()
 }
 
+func (t *Transport) verifyPinnedCertificate() error {
+	if t.webrtcConfig == nil || t.webrtcConfig.DTLS == nil || len(t.webrtcConfig.DTLS.PinnedFingerprints) == 0 {
+		return nil
+	}
+
+	sctp := t.PeerConnection.SCTP()
+	if sctp == nil || sctp.Transport() == nil {
+		return rtcerror.ErrNoDTLSTransport
+	}
+
+	if !t.webrtcConfig.DTLS.VerifyPinned(sctp.Transport().GetRemoteCertificate()) {
+		return rtcerror.ErrFingerprintNotPinned
+	}
+
+	return nil
+}
+
 func (t *Transport) isShortConnection(at time.Time) (bool, time.Duration) {
 	t.lock.RLock()
 	defer t.lock.RUnlock()
@@ -541,6 +577,24 @@ func (t *Transport) OnFailed(f func(isShort bool)) {
 	t.onFailed = f
 }
 
+// OnStateChange is called with the ice and the peer connection states, kind
+// being "ice" or "connection".
+func (t *Transport) OnStateChange(f func(kind, state string)) {
+	t.lock.Lock()
+	t.onStateChange = f
+	t.lock.Unlock()
+}
+
+func (t *Transport) stateChanged(kind, state string) {
+	t.lock.RLock()
+	f := t.onStateChange
+	t.lock.RUnlock()
+
+	if f != nil {
+		f(kind, state)
+	}
+}
+
 func (t *Transport) validate() error {
 	if t.ctx == nil {
 		t.ctx, t.cancel = context.WithCancel(context.Background())
@@ -551,7 +605,7 @@ func (t *Transport) validate() error {
 	}
 
 	if t.eventemitter == nil {
-		t.eventemitter = eventemitter.NewEventEmitter(t.ctx, defaultEventEmitterLength, t.logger)
+		t.eventemitter = eventemitter.NewEventEmitter(t.ctx, defaultEventEmitterLength, t.logger, eventemitter.WithName("rtc-transport"))
 	}
 
 	if t.icc == nil {
@@ -564,13 +618,19 @@ func (t *Transport) validate() error {
 		se := t.webrtcConfig.SettingEngine
 		c := t.webrtcConfig.Configuration
 		se.DisableMediaEngineCopy(true)
-		// Change elliptic curve to improve connectivity
-		// https://github.com/pion/dtls/pull/474
-		se.SetDTLSEllipticCurves(elliptic.X25519, elliptic.P384, elliptic.P256)
-		se.SetDTLSRetransmissionInterval(dtlsRetransmissionInterval)
+		if t.webrtcConfig.DTLS != nil {
+			t.webrtcConfig.DTLS.Apply(&se)
+		} else {
+			// Change elliptic curve to improve connectivity
+			// https://github.com/pion/dtls/pull/474
+			se.SetDTLSEllipticCurves(elliptic.X25519, elliptic.P384, elliptic.P256)
+			se.SetDTLSRetransmissionInterval(dtlsRetransmissionInterval)
+		}
 		se.SetICETimeouts(iceDisconnectedTimeout, iceFailedTimeout, iceKeepaliveInterval)
 		se.LoggerFactory = logger.NewPionLoggerFactory(t.logger)
 		i := &interceptor.Registry{}
+		i.Add(t.tap)
+		i.Add(t.counters)
 
 		me := CreateMediaEngine(t.allowedCodecs)
 		if err := webrtc.RegisterDefaultInterceptors(me, i); err != nil {
@@ -602,6 +662,19 @@ func (t *Transport) validate() error {
 func (t *Transport) SetRemoteDescription(sd webrtc.SessionDescription) (err error) {
 	if sd.Type == webrtc.SDPTypeOffer {
 		t.localSdpType = webrtc.SDPTypeAnswer
+
+		if err = sdpassistor.ValidateOffer(sd, func(mime string) bool {
+			return isMimeEnabled(t.allowedCodecs, mime)
+		}); err != nil {
+			return err
+		}
+
+		// the answer lists the codecs in the order of the offer
+		sd, err = sdpassistor.PreferCodecs(sd, t.codecPrefs)
+		if err != nil {
+			err = errors.Wrap(err, "failed to order codecs")
+			return err
+		}
 	}
 
 	sd, err = sdpassistor.FilterCandidates(sd, t.preferTCP.Load())
@@ -731,3 +804,43 @@ func (t *Transport) GatheringCompleteLocalSdp(ctx context.Context) (lsdp webrtc.
 
 	return
 }
+
+// Renegotiate answers a new offer of the remote on an established
+// connection, e.g. one adding or removing tracks. update is called once the
+// offer is set, to add the tracks the answer sends before it is created.
+func (t *Transport) Renegotiate(ctx context.Context, offer webrtc.SessionDescription, update func() error) (lsdp webrtc.SessionDescription, err error) {
+	if !t.localSdpSetted || !t.remoteSdpSetted {
+		err = errors.New("not negotiated yet")
+		return
+	}
+	if offer.Type != webrtc.SDPTypeOffer {
+		err = errors.New("renegotiation needs an offer")
+		return
+	}
+	if state := t.PeerConnection.SignalingState(); state != webrtc.SignalingStateStable {
+		err = errors.Errorf("renegotiation in signaling state %s", state)
+		return
+	}
+
+	if err = t.SetRemoteDescription(offer); err != nil {
+		return
+	}
+
+	if update != nil {
+		if err = update(); err != nil {
+			err = errors.Wrap(err, "failed to update tracks")
+			// the offer is answered anyway to get back to the stable state,
+			// pion rolls back no remote offer
+			if _, aerr := t.CreateAnswer(nil); aerr != nil {
+				t.logger.Warnf("failed to answer rejected offer: %v", aerr)
+			}
+			return
+		}
+	}
+
+	if _, err = t.CreateAnswer(nil); err != nil {
+		return
+	}
+
+	return t.GatheringCompleteLocalSdp(ctx)
+}
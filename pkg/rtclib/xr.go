@@ -0,0 +1,153 @@
+package rtclib
+
+import (
+	"sync"
+
+	"github.com/pion/rtcp"
+)
+
+const (
+	// packets a loss window covers at most, older ones are dropped
+	maxLossWindow = 1 << 14
+	// a chunk holds a run of up to 0x3fff packets or a vector of 15
+	maxRunLength = 0x3fff
+	vectorBits   = 15
+)
+
+// lossWindow records which packets arrived since the last loss rle report,
+// RFC 3611 4.1.
+type lossWindow struct {
+	lock     sync.Mutex
+	started  bool
+	begin    uint16
+	received []bool
+}
+
+func (w *lossWindow) observe(seq uint16) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if !w.started {
+		w.started = true
+		w.begin = seq
+	}
+
+	offset := seq - w.begin
+	if offset >= 0x8000 {
+		// older than the window
+		return
+	}
+
+	if int(offset) >= maxLossWindow {
+		drop := int(offset) - maxLossWindow + 1
+		if drop > len(w.received) {
+			drop = len(w.received)
+		}
+		w.received = w.received[drop:]
+		w.begin += uint16(drop)
+		offset = seq - w.begin
+	}
+
+	for int(offset) >= len(w.received) {
+		w.received = append(w.received, false)
+	}
+	w.received[offset] = true
+}
+
+// report returns the block of the window and starts the next one after it,
+// nil when no packet arrived since the last report.
+func (w *lossWindow) report(ssrc uint32) *rtcp.LossRLEReportBlock {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if len(w.received) == 0 {
+		return nil
+	}
+
+	block := &rtcp.LossRLEReportBlock{
+		SSRC:     ssrc,
+		BeginSeq: w.begin,
+		EndSeq:   w.begin + uint16(len(w.received)),
+		Chunks:   EncodeLossRLE(w.received),
+	}
+
+	w.begin = block.EndSeq
+	w.received = w.received[:0]
+
+	return block
+}
+
+// EncodeLossRLE encodes which packets were received as the chunks of a loss
+// rle block, runs of a vector or longer are run length chunks.
+func EncodeLossRLE(received []bool) []rtcp.Chunk {
+	var chunks []rtcp.Chunk
+	for i := 0; i < len(received); {
+		run := 1
+		for i+run < len(received) && received[i+run] == received[i] && run < maxRunLength {
+			run++
+		}
+
+		if run >= vectorBits || i+run == len(received) && run > 1 {
+			chunk := rtcp.Chunk(run)
+			if received[i] {
+				chunk |= 1 << 14
+			}
+			chunks = append(chunks, chunk)
+			i += run
+			continue
+		}
+
+		chunk := rtcp.Chunk(1 << 15)
+		for bit := 0; bit < vectorBits && i < len(received); bit++ {
+			if received[i] {
+				chunk |= 1 << (vectorBits - 1 - bit)
+			}
+			i++
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	// chunks fill whole 32 bit words
+	if len(chunks)%2 == 1 {
+		chunks = append(chunks, 0)
+	}
+
+	return chunks
+}
+
+// LossRLECounts returns how many packets a loss rle block covers and how many
+// of them were lost.
+func LossRLECounts(block *rtcp.LossRLEReportBlock) (expected, lost int) {
+	expected = int(block.EndSeq - block.BeginSeq)
+	received := 0
+	covered := 0
+	for _, chunk := range block.Chunks {
+		switch {
+		case chunk == 0:
+			continue
+		case chunk&(1<<15) == 0:
+			run := int(chunk & maxRunLength)
+			if chunk&(1<<14) != 0 {
+				received += run
+			}
+			covered += run
+		default:
+			for bit := 0; bit < vectorBits; bit++ {
+				if chunk&(1<<(vectorBits-1-bit)) != 0 {
+					received++
+				}
+			}
+			covered += vectorBits
+		}
+	}
+
+	// the last vector may reach past the end of the block
+	if covered < expected {
+		expected = covered
+	}
+	if received > expected {
+		received = expected
+	}
+
+	return expected, expected - received
+}
@@ -0,0 +1,48 @@
+package stats
+
+import (
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/metrics"
+)
+
+// RegisterMetrics exports the stats of the streams in the namespaces
+// returns to r.
+func RegisterMetrics(r *metrics.Registry, namespaces func() []*router.Namespace) error {
+	gauge := func(name, help string, value func(s Stream) float64) metrics.Collector {
+		return metrics.NewGaugeVecFunc(name, help, func() []metrics.LabeledValue {
+			streams := Streams(namespaces())
+			values := make([]metrics.LabeledValue, 0, len(streams))
+			for _, s := range streams {
+				values = append(values, metrics.LabeledValue{
+					Values: []string{s.Namespace, s.Stream},
+					Value:  value(s),
+				})
+			}
+
+			return values
+		}, "namespace", "stream")
+	}
+
+	collectors := []metrics.Collector{
+		gauge("neon_stream_bitrate_bits", "Ingest bitrate of a stream.",
+			func(s Stream) float64 { return float64(s.Bitrate) }),
+		gauge("neon_stream_fps", "Video frames per second of a stream.",
+			func(s Stream) float64 { return s.FPS }),
+		gauge("neon_stream_keyframe_interval_seconds", "Time between the last two keyframes of a stream.",
+			func(s Stream) float64 { return s.KeyframeInterval }),
+		gauge("neon_stream_viewers", "Number of subscribers of a stream.",
+			func(s Stream) float64 { return float64(s.Viewers) }),
+		gauge("neon_stream_peak_viewers", "Most subscribers a stream had at once.",
+			func(s Stream) float64 { return float64(s.PeakViewers) }),
+		gauge("neon_stream_uptime_seconds", "Time since a stream was created.",
+			func(s Stream) float64 { return float64(s.Uptime) }),
+	}
+
+	for _, c := range collectors {
+		if err := r.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
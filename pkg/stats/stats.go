@@ -0,0 +1,143 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/pingostack/neon/internal/core/router"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/rtclib/transport"
+)
+
+type Stream struct {
+	Namespace        string  `json:"namespace"`
+	Stream           string  `json:"stream"`
+	AudioCodec       string  `json:"audioCodec,omitempty"`
+	VideoCodec       string  `json:"videoCodec,omitempty"`
+	Bitrate          uint64  `json:"bitrate"`
+	FPS              float64 `json:"fps"`
+	KeyframeInterval float64 `json:"keyframeInterval"` // seconds
+	Frames           uint64  `json:"frames"`
+	Bytes            uint64  `json:"bytes"`
+	Viewers          int     `json:"viewers"`
+	// Health scores the publisher, nil before a score.
+	Health      *deliver.Health `json:"health,omitempty"`
+	PeakViewers int             `json:"peakViewers"`
+	Uptime      int64           `json:"uptime"` // seconds
+	CreatedAt   time.Time       `json:"createdAt"`
+}
+
+type Session struct {
+	ID        string `json:"id"`
+	Namespace string `json:"namespace"`
+	Stream    string `json:"stream"`
+	Producer  bool   `json:"producer"`
+	deliver.TransportStats
+	// Connection are the counters of a webrtc connection.
+	Connection *transport.Stats `json:"connection,omitempty"`
+	Uptime     int64            `json:"uptime"` // seconds
+	CreatedAt  time.Time        `json:"createdAt"`
+}
+
+// connectionStats is implemented by the frame sources and destinations of
+// webrtc, by their transport.
+type connectionStats interface {
+	GetStats() transport.Stats
+}
+
+func NewStream(r router.Router) Stream {
+	s := Stream{
+		Stream:      r.ID(),
+		Viewers:     r.SubscriberCount(),
+		PeakViewers: r.PeakSubscriberCount(),
+		Uptime:      int64(time.Since(r.CreatedAt()).Seconds()),
+		CreatedAt:   r.CreatedAt(),
+	}
+
+	if ns := r.Namespace(); ns != nil {
+		s.Namespace = ns.Name()
+	}
+
+	if h, ok := r.Health(); ok {
+		s.Health = &h
+	}
+
+	producer := r.Producer()
+	if producer == nil {
+		return s
+	}
+
+	src := producer.FrameSource()
+	if src == nil {
+		return s
+	}
+
+	if md := src.Metadata(); md != nil {
+		if md.HasAudio() {
+			s.AudioCodec = md.Audio.Codec
+		}
+		if md.HasVideo() {
+			s.VideoCodec = md.Video.Codec
+		}
+	}
+
+	st := src.Stats()
+	s.Bitrate = st.Bitrate
+	s.FPS = st.FPS
+	s.KeyframeInterval = st.KeyframeInterval
+	s.Frames = st.Frames
+	s.Bytes = st.Bytes
+
+	return s
+}
+
+// NewSession reads the transport stats of the frame destination of a
+// subscriber, of the frame source of a producer.
+func NewSession(session router.Session) Session {
+	s := Session{
+		ID:        session.ID(),
+		Stream:    session.RouterID(),
+		Producer:  session.PeerParams().Producer,
+		Uptime:    int64(time.Since(session.CreatedAt()).Seconds()),
+		CreatedAt: session.CreatedAt(),
+	}
+
+	if ns := session.GetNamespace(); ns != nil {
+		s.Namespace = ns.Name()
+	}
+
+	var endpoint interface{} = session.FrameDestination()
+	if s.Producer {
+		endpoint = session.FrameSource()
+	}
+
+	if ts, ok := endpoint.(deliver.EnableTransportStats); ok {
+		s.TransportStats = ts.TransportStats()
+	}
+
+	if cs, ok := endpoint.(connectionStats); ok {
+		c := cs.GetStats()
+		s.Connection = &c
+	}
+
+	return s
+}
+
+func Streams(namespaces []*router.Namespace) []Stream {
+	streams := make([]Stream, 0)
+	for _, ns := range namespaces {
+		for _, r := range ns.Routers() {
+			streams = append(streams, NewStream(r))
+		}
+	}
+
+	return streams
+}
+
+func Sessions(sessions []router.Session) []Session {
+	ret := make([]Session, 0, len(sessions))
+	for _, session := range sessions {
+		ret = append(ret, NewSession(session))
+	}
+
+	return ret
+}
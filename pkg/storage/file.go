@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// fileStorage keeps the keys as files of a dir, tags are not kept.
+type fileStorage struct {
+	dir string
+}
+
+func NewFileStorage(dir string) Storage {
+	return &fileStorage{dir: dir}
+}
+
+func (s *fileStorage) path(key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes a temporary file renamed to the key, the key is never seen
+// half written.
+func (s *fileStorage) Put(ctx context.Context, key string, r io.Reader, _ int64, _ PutOptions) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+func (s *fileStorage) Create(ctx context.Context, key string, opts PutOptions) (Writer, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+
+	return newPipeWriter(func(r io.Reader) error {
+		return s.Put(ctx, key, r, -1, opts)
+	}), nil
+}
+
+func (s *fileStorage) Delete(_ context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
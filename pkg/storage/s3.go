@@ -0,0 +1,434 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// s3 takes parts of 5MiB at least, all but the last
+	minPartSize     = 5 << 20
+	defaultPartSize = 16 << 20
+	defaultRetries  = 3
+	retryBackoff    = 500 * time.Millisecond
+	defaultTimeout  = 5 * time.Minute
+)
+
+// S3Settings of a bucket, Endpoint is the url of the service, aws when
+// empty. PathStyle puts the bucket in the path instead of the host name,
+// for minio and most other services.
+type S3Settings struct {
+	Endpoint  string `json:"endpoint" mapstructure:"endpoint"`
+	Region    string `json:"region" mapstructure:"region"`
+	Bucket    string `json:"bucket" mapstructure:"bucket"`
+	AccessKey string `json:"accessKey" mapstructure:"accessKey"`
+	SecretKey string `json:"secretKey" mapstructure:"secretKey"`
+	PathStyle bool   `json:"pathStyle" mapstructure:"pathStyle"`
+	// Objects larger than PartSizeMB are uploaded in parts of it.
+	PartSizeMB     int    `json:"partSizeMB" mapstructure:"partSizeMB"`
+	Retries        int    `json:"retries" mapstructure:"retries"`
+	StorageClass   string `json:"storageClass" mapstructure:"storageClass"`
+	TimeoutSeconds int    `json:"timeoutSeconds" mapstructure:"timeoutSeconds"`
+}
+
+// s3Storage signs its requests with aws signature version 4.
+type s3Storage struct {
+	settings S3Settings
+	endpoint *url.URL
+	partSize int
+	retries  int
+	client   *http.Client
+}
+
+// s3Error is an error response, retried when the service failed.
+type s3Error struct {
+	Status  int
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	return fmt.Sprintf("s3 %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+func (e *s3Error) temporary() bool {
+	return e.Status >= 500 || e.Status == http.StatusTooManyRequests || e.Code == "RequestTimeout"
+}
+
+func NewS3Storage(settings S3Settings) (Storage, error) {
+	if settings.Bucket == "" {
+		return nil, errors.New("s3 storage without bucket")
+	}
+
+	if settings.Region == "" {
+		settings.Region = "us-east-1"
+	}
+
+	endpoint := settings.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + settings.Region + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, errors.Errorf("invalid s3 endpoint %s", endpoint)
+	}
+
+	s := &s3Storage{
+		settings: settings,
+		endpoint: u,
+		partSize: settings.PartSizeMB << 20,
+		retries:  settings.Retries,
+		client:   &http.Client{Timeout: time.Duration(settings.TimeoutSeconds) * time.Second},
+	}
+	if s.partSize < minPartSize {
+		s.partSize = defaultPartSize
+	}
+	if s.retries <= 0 {
+		s.retries = defaultRetries
+	}
+	if s.client.Timeout <= 0 {
+		s.client.Timeout = defaultTimeout
+	}
+
+	return s, nil
+}
+
+// objectURL is the url of key, the query is added by the caller.
+func (s *s3Storage) objectURL(key string) url.URL {
+	u := *s.endpoint
+	path := strings.TrimSuffix(u.Path, "/")
+	if s.settings.PathStyle {
+		path += "/" + s.settings.Bucket
+	} else {
+		u.Host = s.settings.Bucket + "." + u.Host
+	}
+	u.Path = path + "/" + key
+	u.RawPath = encodePath(u.Path)
+
+	return u
+}
+
+// Put uploads r in a single request when it fits a part, in parts
+// otherwise. Every request is retried on its own, a multipart upload that
+// failed is aborted.
+func (s *s3Storage) Put(ctx context.Context, key string, r io.Reader, _ int64, opts PutOptions) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	first, err := readPart(r, s.partSize)
+	if err != nil {
+		return err
+	}
+
+	if len(first) < s.partSize {
+		_, err := s.do(ctx, http.MethodPut, key, nil, s.objectHeaders(opts), first)
+		return err
+	}
+
+	uploadID, err := s.createMultipart(ctx, key, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := s.uploadParts(ctx, key, uploadID, first, r); err != nil {
+		// the parts uploaded would be billed until the bucket cleans up
+		abortCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		s.do(abortCtx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+
+		return err
+	}
+
+	return nil
+}
+
+func (s *s3Storage) uploadParts(ctx context.Context, key, uploadID string, part []byte, r io.Reader) error {
+	type completedPart struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	var parts []completedPart
+
+	for number := 1; len(part) > 0; number++ {
+		query := url.Values{
+			"partNumber": {strconv.Itoa(number)},
+			"uploadId":   {uploadID},
+		}
+		resp, err := s.do(ctx, http.MethodPut, key, query, nil, part)
+		if err != nil {
+			return errors.Wrapf(err, "upload part %d", number)
+		}
+		parts = append(parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+
+		if len(part) < s.partSize {
+			break
+		}
+		if part, err = readPart(r, s.partSize); err != nil {
+			return err
+		}
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, http.Header{"Content-Type": {"application/xml"}}, body)
+
+	return errors.Wrap(err, "complete multipart upload")
+}
+
+func (s *s3Storage) createMultipart(ctx context.Context, key string, opts PutOptions) (string, error) {
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, s.objectHeaders(opts), nil)
+	if err != nil {
+		return "", errors.Wrap(err, "create multipart upload")
+	}
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(resp.body, &result); err != nil || result.UploadID == "" {
+		return "", errors.New("create multipart upload: no upload id")
+	}
+
+	return result.UploadID, nil
+}
+
+func (s *s3Storage) objectHeaders(opts PutOptions) http.Header {
+	header := http.Header{}
+	if opts.ContentType != "" {
+		header.Set("Content-Type", opts.ContentType)
+	}
+	if len(opts.Tags) > 0 {
+		header.Set("X-Amz-Tagging", encodeTags(opts.Tags))
+	}
+	if s.settings.StorageClass != "" {
+		header.Set("X-Amz-Storage-Class", s.settings.StorageClass)
+	}
+
+	return header
+}
+
+func (s *s3Storage) Create(ctx context.Context, key string, opts PutOptions) (Writer, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+
+	return newPipeWriter(func(r io.Reader) error {
+		return s.Put(ctx, key, r, -1, opts)
+	}), nil
+}
+
+func (s *s3Storage) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	_, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil)
+
+	return err
+}
+
+// readPart reads size bytes of r, less at its end.
+func readPart(r io.Reader, size int) ([]byte, error) {
+	buf := make([]byte, size)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+
+	return buf[:n], err
+}
+
+type s3Response struct {
+	Header http.Header
+	body   []byte
+}
+
+// do sends a signed request, again after a backoff when the service or the
+// network failed.
+func (s *s3Storage) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*s3Response, error) {
+	var err error
+	for attempt := 0; attempt <= s.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(retryBackoff << (attempt - 1)):
+			}
+		}
+
+		var resp *s3Response
+		if resp, err = s.send(ctx, method, key, query, header, body); err == nil {
+			return resp, nil
+		}
+
+		var se *s3Error
+		if ctx.Err() != nil || errors.As(err, &se) && !se.temporary() {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
+
+func (s *s3Storage) send(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*s3Response, error) {
+	u := s.objectURL(key)
+	u.RawQuery = encodeQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.ContentLength = int64(len(body))
+	s.sign(req, body, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// a multipart upload may fail after its 200 OK
+	if resp.StatusCode >= 300 || bytes.Contains(data, []byte("<Error>")) {
+		se := &s3Error{Status: resp.StatusCode}
+		xml.Unmarshal(data, se)
+		if se.Status < 300 {
+			se.Status = http.StatusInternalServerError
+		}
+		if se.Code == "" {
+			se.Code = http.StatusText(resp.StatusCode)
+		}
+		return nil, se
+	}
+
+	return &s3Response{Header: resp.Header, body: data}, nil
+}
+
+// sign adds the authorization of aws signature version 4 to req.
+func (s *s3Storage) sign(req *http.Request, body []byte, now time.Time) {
+	sum := sha256.Sum256(body)
+	payload := hex.EncodeToString(sum[:])
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	// host and the x-amz headers, content-type when set
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lower := strings.ToLower(k)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" {
+			headers[lower] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payload,
+	}, "\n")
+
+	scope := date + "/" + s.settings.Region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.settings.SecretKey), date)
+	key = hmacSHA256(key, s.settings.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.settings.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// encodePath escapes every segment of path as signature version 4 does.
+func encodePath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		parts[i] = uriEncode(part)
+	}
+
+	return strings.Join(parts, "/")
+}
+
+// encodeQuery sorts and escapes query as signature version 4 does.
+func encodeQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			pairs = append(pairs, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode escapes all but the unreserved characters of rfc 3986.
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
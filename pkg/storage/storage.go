@@ -0,0 +1,124 @@
+// Package storage keeps files such as finished recordings under keys, on
+// the local disk or in an s3 compatible object storage.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrUnknownStorage = errors.New("unknown storage")
+	ErrInvalidKey     = errors.New("invalid storage key")
+)
+
+const (
+	TypeFile = "file"
+	TypeS3   = "s3"
+)
+
+// PutOptions describe what is stored, Tags are set on s3 objects for the
+// lifecycle rules of the bucket to match.
+type PutOptions struct {
+	ContentType string
+	Tags        map[string]string
+}
+
+type Storage interface {
+	// Put stores what r has under key, size is -1 when unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) error
+	// Create returns a writer stored under key once closed, nothing is
+	// stored when it is aborted.
+	Create(ctx context.Context, key string, opts PutOptions) (Writer, error)
+	Delete(ctx context.Context, key string) error
+}
+
+type Writer interface {
+	io.WriteCloser
+	Abort(err error)
+}
+
+type Settings struct {
+	// Type is file or s3.
+	Type string     `json:"type" mapstructure:"type"`
+	Dir  string     `json:"dir" mapstructure:"dir"`
+	S3   S3Settings `json:"s3" mapstructure:"s3"`
+}
+
+func New(settings Settings) (Storage, error) {
+	switch settings.Type {
+	case "", TypeFile:
+		return NewFileStorage(settings.Dir), nil
+	case TypeS3:
+		return NewS3Storage(settings.S3)
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownStorage, settings.Type)
+}
+
+// checkKey keeps keys relative and within their root.
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return fmt.Errorf("%w: %s", ErrInvalidKey, key)
+	}
+
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("%w: %s", ErrInvalidKey, key)
+		}
+	}
+
+	return nil
+}
+
+// encodeTags formats tags as the query of x-amz-tagging, sorted.
+func encodeTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	values := make([]string, len(keys))
+	for i, k := range keys {
+		values[i] = uriEncode(k) + "=" + uriEncode(tags[k])
+	}
+
+	return strings.Join(values, "&")
+}
+
+// pipeWriter stores what is written with Put of the storage.
+type pipeWriter struct {
+	*io.PipeWriter
+	done chan error
+}
+
+func newPipeWriter(put func(r io.Reader) error) *pipeWriter {
+	pr, pw := io.Pipe()
+	w := &pipeWriter{PipeWriter: pw, done: make(chan error, 1)}
+
+	go func() {
+		err := put(pr)
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+
+	return w
+}
+
+func (w *pipeWriter) Close() error {
+	w.PipeWriter.Close()
+	return <-w.done
+}
+
+func (w *pipeWriter) Abort(err error) {
+	if err == nil {
+		err = io.ErrClosedPipe
+	}
+	w.PipeWriter.CloseWithError(err)
+	<-w.done
+}
@@ -0,0 +1,25 @@
+package tcp
+
+import "errors"
+
+var (
+	ErrWriterClosed = errors.New("writer closed")
+	ErrQueueFull    = errors.New("write queue full")
+
+	ErrProxyIncomplete = errors.New("incomplete proxy protocol header")
+	ErrProxyInvalid    = errors.New("invalid proxy protocol header")
+	ErrInvalidProxyNet = errors.New("invalid trusted proxy network")
+
+	ErrUnsupportedNetwork   = errors.New("unsupported listen network")
+	ErrEmptyAddress         = errors.New("empty listen address")
+	ErrReusePortUnsupported = errors.New("SO_REUSEPORT is not supported on this platform")
+	ErrInvalidSocketMode    = errors.New("invalid unix socket mode")
+	ErrUnknownSocketOwner   = errors.New("unknown unix socket user or group")
+	ErrChownUnsupported     = errors.New("unix socket ownership is not supported on this platform")
+
+	ErrServerRunning = errors.New("server already running")
+	ErrServerStopped = errors.New("server not running")
+
+	ErrUnsupportedTransport = errors.New("unsupported transport")
+	ErrTLSUnsupported       = errors.New("tls needs the net transport")
+)
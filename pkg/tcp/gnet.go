@@ -0,0 +1,226 @@
+package tcp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/panjf2000/gnet"
+	"github.com/panjf2000/gnet/pkg/logging"
+	"github.com/pingostack/neon/pkg/metrics"
+)
+
+// GnetOptions tunes the event loops and sockets of a gnet server, modules
+// take it from their settings so every listener is configured on its own.
+type GnetOptions struct {
+	// Multicore runs an event loop per cpu, NumEventLoop overrides the count.
+	Multicore    bool `json:"multicore" mapstructure:"multicore"`
+	NumEventLoop int  `json:"numEventLoop" mapstructure:"numEventLoop"`
+	ReuseAddr    bool `json:"reuseAddr" mapstructure:"reuseAddr"`
+	ReusePort    bool `json:"reusePort" mapstructure:"reusePort"`
+	// TCPKeepAliveSeconds sets SO_KEEPALIVE, 0 disables it.
+	TCPKeepAliveSeconds int `json:"tcpKeepAliveSeconds" mapstructure:"tcpKeepAliveSeconds"`
+	// TCPDelay enables Nagle's algorithm, media wants it off.
+	TCPDelay     bool `json:"tcpDelay" mapstructure:"tcpDelay"`
+	LockOSThread bool `json:"lockOSThread" mapstructure:"lockOSThread"`
+	// SocketRecvBuffer and SocketSendBuffer are in bytes, 0 keeps the system
+	// default.
+	SocketRecvBuffer int `json:"socketRecvBuffer" mapstructure:"socketRecvBuffer"`
+	SocketSendBuffer int `json:"socketSendBuffer" mapstructure:"socketSendBuffer"`
+	// ReadBufferCap is the most bytes read from a connection at once, 0
+	// keeps the gnet default.
+	ReadBufferCap int `json:"readBufferCap" mapstructure:"readBufferCap"`
+}
+
+func (o GnetOptions) options() gnet.Options {
+	opt := gnet.Options{
+		Multicore:        o.Multicore,
+		NumEventLoop:     o.NumEventLoop,
+		ReuseAddr:        o.ReuseAddr,
+		ReusePort:        o.ReusePort,
+		TCPKeepAlive:     time.Duration(o.TCPKeepAliveSeconds) * time.Second,
+		TCPNoDelay:       gnet.TCPNoDelay,
+		LockOSThread:     o.LockOSThread,
+		SocketRecvBuffer: o.SocketRecvBuffer,
+		SocketSendBuffer: o.SocketSendBuffer,
+		ReadBufferCap:    o.ReadBufferCap,
+	}
+	if o.TCPDelay {
+		opt.TCPNoDelay = gnet.TCPDelay
+	}
+
+	return opt
+}
+
+type GnetServerOptions struct {
+	GnetOptions
+	// Protocol labels the metrics of the server, e.g. metrics.ProtocolRTSP.
+	Protocol string
+	Logger   logging.Logger
+	Codec    gnet.ICodec
+	// Ticker calls Tick of the handler.
+	Ticker bool
+	// UnixSocket sets the permissions of a unix:// address.
+	UnixSocket UnixSocketOptions
+}
+
+// GnetServer runs a gnet event handler on one address, it can be started
+// again once stopped. Errors of the event loops and of connections closed on
+// a read error are logged and counted by neon_server_errors_total.
+type GnetServer struct {
+	handler gnet.EventHandler
+	addr    string
+	opt     GnetServerOptions
+
+	lock    sync.Mutex
+	running bool
+	done    chan struct{}
+	err     error
+}
+
+func NewGnetServer(handler gnet.EventHandler, addr string, opt GnetServerOptions) *GnetServer {
+	if opt.Logger == nil {
+		opt.Logger = logging.GetDefaultLogger()
+	}
+
+	done := make(chan struct{})
+	close(done)
+
+	return &GnetServer{
+		handler: handler,
+		addr:    addr,
+		opt:     opt,
+		done:    done,
+	}
+}
+
+func (s *GnetServer) Addr() string {
+	return s.addr
+}
+
+// Start returns once the server accepts connections, or with the error it
+// failed with, e.g. the address is in use.
+func (s *GnetServer) Start() error {
+	s.lock.Lock()
+	if s.running {
+		s.lock.Unlock()
+		return ErrServerRunning
+	}
+
+	h := &gnetHandler{EventHandler: s.handler, server: s, ready: make(chan struct{})}
+	done := make(chan struct{})
+	s.running, s.done, s.err = true, done, nil
+	s.lock.Unlock()
+
+	opt := s.opt.options()
+	opt.Logger = &errorLogger{Logger: s.opt.Logger, protocol: s.opt.Protocol}
+	opt.Codec = s.opt.Codec
+	opt.Ticker = s.opt.Ticker
+
+	RemoveStaleSocket(s.addr)
+
+	go func() {
+		err := gnet.Serve(h, s.addr, gnet.WithOptions(opt))
+		if err != nil {
+			s.opt.Logger.Errorf("server on %s failed: %v", s.addr, err)
+			metrics.ServerErrors.With(s.opt.Protocol, "serve").Inc()
+		}
+
+		s.lock.Lock()
+		s.running, s.err = false, err
+		s.lock.Unlock()
+		close(done)
+	}()
+
+	select {
+	case <-h.ready:
+		if err := SetupUnixSocket(s.addr, s.opt.UnixSocket); err != nil {
+			s.opt.Logger.Errorf("server on %s failed: %v", s.addr, err)
+			gnet.Stop(context.Background(), s.addr)
+			<-done
+			return err
+		}
+
+		s.opt.Logger.Infof("server is running on %s", s.addr)
+		return nil
+	case <-done:
+		return s.Err()
+	}
+}
+
+// Stop closes the listener and the connections, it returns once the event
+// loops are done or ctx is.
+func (s *GnetServer) Stop(ctx context.Context) error {
+	s.lock.Lock()
+	running, done := s.running, s.done
+	s.lock.Unlock()
+
+	if !running {
+		return ErrServerStopped
+	}
+
+	if err := gnet.Stop(ctx, s.addr); err != nil {
+		return err
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Done is closed once the server stopped.
+func (s *GnetServer) Done() <-chan struct{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.done
+}
+
+// Err is the error the server stopped with, nil if it was stopped.
+func (s *GnetServer) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.err
+}
+
+func (s *GnetServer) Running() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.running
+}
+
+type gnetHandler struct {
+	gnet.EventHandler
+	server *GnetServer
+	ready  chan struct{}
+}
+
+func (h *gnetHandler) OnInitComplete(gs gnet.Server) gnet.Action {
+	close(h.ready)
+	return h.EventHandler.OnInitComplete(gs)
+}
+
+func (h *gnetHandler) OnClosed(c gnet.Conn, err error) gnet.Action {
+	if err != nil {
+		h.server.opt.Logger.Warnf("connection from %s closed: %v", c.RemoteAddr(), err)
+		metrics.ServerErrors.With(h.server.opt.Protocol, "read").Inc()
+	}
+
+	return h.EventHandler.OnClosed(c, err)
+}
+
+// errorLogger counts what gnet logs as an error, e.g. failed accepts.
+type errorLogger struct {
+	logging.Logger
+	protocol string
+}
+
+func (l *errorLogger) Errorf(format string, args ...interface{}) {
+	metrics.ServerErrors.With(l.protocol, "eventloop").Inc()
+	l.Logger.Errorf(format, args...)
+}
@@ -0,0 +1,168 @@
+package tcp
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/panjf2000/gnet"
+	"github.com/panjf2000/gnet/pkg/mixedbuffer"
+	"github.com/pingostack/neon/pkg/metrics"
+)
+
+// how often a connection with bytes in its outbound buffer is looked at again
+const outboundPollInterval = 10 * time.Millisecond
+
+var mixedbufferType = reflect.TypeOf((*mixedbuffer.Buffer)(nil))
+
+// gnetAdapter runs a Handler as the event handler and codec of a GnetServer,
+// the unconsumed bytes stay in the inbound buffer of the connection.
+type gnetAdapter struct {
+	gnet.EventServer
+	handler Handler
+	opt     TransportOptions
+	// gnet.Conn -> *outbound
+	outbound sync.Map
+}
+
+// outbound follows the bytes a connection buffers because the kernel did not
+// take them, only touched on the event loop of the connection.
+type outbound struct {
+	buffered int
+	polling  bool
+}
+
+// outboundLength is the number of bytes gnet buffers for the connection, the
+// buffer is not exported so it is read from the connection. It is -1 where
+// the connection has none, e.g. on windows. Only call it on the event loop.
+func outboundLength(c gnet.Conn) int {
+	v := reflect.ValueOf(c)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return -1
+	}
+
+	f := v.Elem().FieldByName("outboundBuffer")
+	if !f.IsValid() || f.Type() != mixedbufferType {
+		return -1
+	}
+
+	buf := (*mixedbuffer.Buffer)(f.UnsafePointer())
+	if buf == nil {
+		return 0
+	}
+
+	n := 0
+	for _, b := range buf.Peek(0) {
+		n += len(b)
+	}
+
+	return n
+}
+
+func newGnetTransport(handler Handler, addr string, opt TransportOptions) Transport {
+	a := &gnetAdapter{handler: handler, opt: opt}
+
+	return NewGnetServer(a, addr, GnetServerOptions{
+		GnetOptions: opt.Gnet,
+		Protocol:    opt.Protocol,
+		Logger:      opt.Logger,
+		Codec:       a,
+		Ticker:      opt.Ticker,
+		UnixSocket:  opt.UnixSocket,
+	})
+}
+
+func (a *gnetAdapter) OnShutdown(_ gnet.Server) {
+	a.handler.OnShutdown()
+}
+
+func (a *gnetAdapter) OnOpened(c gnet.Conn) ([]byte, gnet.Action) {
+	if err := a.handler.OnOpen(c); err != nil {
+		return nil, gnet.Close
+	}
+	a.outbound.Store(c, &outbound{})
+
+	return nil, gnet.None
+}
+
+func (a *gnetAdapter) OnClosed(c gnet.Conn, err error) gnet.Action {
+	a.outbound.Delete(c)
+	a.handler.OnClose(c, err)
+	return gnet.None
+}
+
+// AfterWrite follows every write, also one gnet only appended to the
+// outbound buffer. Only the bytes the kernel took are reported as written,
+// the rest once the buffer drained, so the Writer of the handler sees the
+// connection back up.
+func (a *gnetAdapter) AfterWrite(c gnet.Conn, b []byte) {
+	a.drained(c, len(b))
+}
+
+// React is only called by the polls of drained, Decode never returns a
+// frame.
+func (a *gnetAdapter) React(_ []byte, c gnet.Conn) ([]byte, gnet.Action) {
+	if v, ok := a.outbound.Load(c); ok {
+		v.(*outbound).polling = false
+	}
+	a.drained(c, 0)
+
+	return nil, gnet.None
+}
+
+// drained reports what left the outbound buffer since it was last looked at,
+// with written bytes just handed to it, and polls until it is empty. gnet
+// tells nothing when it flushed the buffer on a writable socket.
+func (a *gnetAdapter) drained(c gnet.Conn, written int) {
+	v, ok := a.outbound.Load(c)
+	length := outboundLength(c)
+	if !ok || length < 0 {
+		if written > 0 {
+			a.handler.OnWritten(c, written)
+		}
+		return
+	}
+
+	out := v.(*outbound)
+	n := out.buffered + written - length
+	out.buffered = length
+	if n > 0 {
+		a.handler.OnWritten(c, n)
+	}
+
+	if length > 0 && !out.polling {
+		out.polling = true
+		time.AfterFunc(outboundPollInterval, func() {
+			// a closed connection ignores it
+			_ = c.Wake()
+		})
+	}
+}
+
+func (a *gnetAdapter) Tick() (time.Duration, gnet.Action) {
+	return a.handler.OnTick(), gnet.None
+}
+
+func (a *gnetAdapter) Encode(_ gnet.Conn, buf []byte) ([]byte, error) {
+	return buf, nil
+}
+
+// Decode hands the buffered bytes to the handler, it never returns a frame so
+// React is only called by wakes.
+func (a *gnetAdapter) Decode(c gnet.Conn) ([]byte, error) {
+	n, err := a.handler.OnData(c, c.Read())
+	if n >= c.BufferLength() {
+		c.ResetBuffer()
+	} else if n > 0 {
+		c.ShiftN(n)
+	}
+
+	if err != nil {
+		// gnet drops decode errors, the connection is closed here
+		a.opt.Logger.Warnf("connection from %s: %v", c.RemoteAddr(), err)
+		metrics.ServerErrors.With(a.opt.Protocol, "read").Inc()
+		c.Close()
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,189 @@
+package tcp
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pingostack/neon/pkg/acl"
+	"github.com/pkg/errors"
+)
+
+type ListenOptions struct {
+	// ReusePort sets SO_REUSEPORT so several processes can share a port.
+	ReusePort bool `json:"reusePort" mapstructure:"reusePort"`
+	// ProxyProtocol wraps the listeners with ProxyListener.
+	ProxyProtocol bool `json:"proxyProtocol" mapstructure:"proxyProtocol"`
+	// TrustedProxies are the networks PROXY headers are taken from, e.g.
+	// "10.0.0.0/8", headers aren't taken from anyone when empty.
+	TrustedProxies []string `json:"trustedProxies" mapstructure:"trustedProxies"`
+	// UnixSocket sets the permissions of unix:// listeners.
+	UnixSocket UnixSocketOptions `json:"unixSocket" mapstructure:"unixSocket"`
+}
+
+// UnixSocketOptions sets the permissions and the owner of a socket file, so
+// a co-located process, e.g. a transcoder, may connect. Empty fields keep
+// what the bind created.
+type UnixSocketOptions struct {
+	// Mode is octal, e.g. "0660".
+	Mode string `json:"mode" mapstructure:"mode"`
+	// User and Group are names or ids.
+	User  string `json:"user" mapstructure:"user"`
+	Group string `json:"group" mapstructure:"group"`
+}
+
+// PeerAddr is the address of a peer as acl takes it, acl.LocalPeer for unix
+// sockets.
+func PeerAddr(addr net.Addr) string {
+	if _, ok := addr.(*net.UnixAddr); ok {
+		return acl.LocalPeer
+	}
+
+	return addr.String()
+}
+
+// UnixPath returns the path of a unix:// address, false for other networks.
+func UnixPath(addr string) (string, bool) {
+	network, address, err := ParseAddr(addr)
+	if err != nil || network != "unix" {
+		return "", false
+	}
+
+	return address, true
+}
+
+// staleSocketDialTimeout is how long a socket file is given to answer before
+// it is taken as alive anyway.
+const staleSocketDialTimeout = time.Second
+
+// RemoveStaleSocket removes the socket file a previous run left at a unix://
+// address, the bind would fail on it. A socket still accepting connections,
+// another instance listening, is left to fail the bind.
+func RemoveStaleSocket(addr string) {
+	path, ok := UnixPath(addr)
+	if !ok {
+		return
+	}
+
+	if fi, err := os.Stat(path); err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return
+	}
+
+	conn, err := net.DialTimeout("unix", path, staleSocketDialTimeout)
+	if err == nil {
+		conn.Close()
+		return
+	}
+
+	// nobody listens on the file
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		os.Remove(path)
+	}
+}
+
+// SetupUnixSocket applies opt to the socket file of a unix:// address once it
+// is bound, other addresses are left alone.
+func SetupUnixSocket(addr string, opt UnixSocketOptions) error {
+	path, ok := UnixPath(addr)
+	if !ok || opt == (UnixSocketOptions{}) {
+		return nil
+	}
+
+	if opt.Mode != "" {
+		mode, err := strconv.ParseUint(opt.Mode, 8, 32)
+		if err != nil {
+			return errors.Wrapf(ErrInvalidSocketMode, "mode %q", opt.Mode)
+		}
+
+		if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+			return err
+		}
+	}
+
+	if opt.User != "" || opt.Group != "" {
+		return chownSocket(path, opt.User, opt.Group)
+	}
+
+	return nil
+}
+
+// ParseAddr splits "network://address" into its parts, a bare address means
+// tcp. Supported networks are tcp, tcp4, tcp6 and unix.
+func ParseAddr(addr string) (network, address string, err error) {
+	network, address = "tcp", addr
+	if i := strings.Index(addr, "://"); i >= 0 {
+		network, address = addr[:i], addr[i+3:]
+	}
+
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix":
+	default:
+		return "", "", ErrUnsupportedNetwork
+	}
+
+	if address == "" {
+		return "", "", ErrEmptyAddress
+	}
+
+	return network, address, nil
+}
+
+// Listen binds one listener for each address, on failure the ones already
+// bound are closed.
+func Listen(addrs []string, opt ListenOptions) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		ln, err := ListenOne(addr, opt)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+
+		listeners = append(listeners, ln)
+	}
+
+	return listeners, nil
+}
+
+func ListenOne(addr string, opt ListenOptions) (net.Listener, error) {
+	network, address, err := ParseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var trusted TrustedProxies
+	if opt.ProxyProtocol {
+		if trusted, err = ParseTrustedProxies(opt.TrustedProxies); err != nil {
+			return nil, err
+		}
+	}
+
+	lc := net.ListenConfig{}
+	if network == "unix" {
+		RemoveStaleSocket(addr)
+	} else if opt.ReusePort {
+		lc.Control = reusePortControl
+	}
+
+	ln, err := lc.Listen(context.Background(), network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := SetupUnixSocket(addr, opt.UnixSocket); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	if opt.ProxyProtocol {
+		return NewProxyListener(ln, trusted), nil
+	}
+
+	return ln, nil
+}
@@ -0,0 +1,73 @@
+//go:build !windows
+// +build !windows
+
+package tcp
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	var serr error
+	err := c.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err
+	}
+
+	return serr
+}
+
+func chownSocket(path, owner, group string) error {
+	uid, gid := -1, -1
+	if owner != "" {
+		id, err := lookupID(owner, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return err
+		}
+		uid = id
+	}
+
+	if group != "" {
+		id, err := lookupID(group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return err
+		}
+		gid = id
+	}
+
+	return os.Chown(path, uid, gid)
+}
+
+// lookupID takes a numeric id as is, looks names up.
+func lookupID(name string, lookup func(name string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+
+	s, err := lookup(name)
+	if err != nil {
+		return 0, errors.Wrapf(ErrUnknownSocketOwner, "%s: %v", name, err)
+	}
+
+	return strconv.Atoi(s)
+}
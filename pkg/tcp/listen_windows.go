@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package tcp
+
+import "syscall"
+
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	return ErrReusePortUnsupported
+}
+
+func chownSocket(path, owner, group string) error {
+	return ErrChownUnsupported
+}
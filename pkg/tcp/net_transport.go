@@ -0,0 +1,341 @@
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/metrics"
+)
+
+const (
+	netReadSize = 64 * 1024
+	// accept errors are retried after a growing delay, as net/http does
+	maxAcceptDelay = time.Second
+)
+
+type netTransport struct {
+	handler Handler
+	addr    string
+	opt     TransportOptions
+
+	lock     sync.Mutex
+	running  bool
+	stopping bool
+	ln       net.Listener
+	conns    map[*netConn]struct{}
+	wg       sync.WaitGroup
+	done     chan struct{}
+	err      error
+}
+
+type netConn struct {
+	net.Conn
+	transport *netTransport
+	writeLock sync.Mutex
+	ctxLock   sync.RWMutex
+	ctx       interface{}
+	closeOnce sync.Once
+}
+
+func newNetTransport(handler Handler, addr string, opt TransportOptions) *netTransport {
+	done := make(chan struct{})
+	close(done)
+
+	return &netTransport{
+		handler: handler,
+		addr:    addr,
+		opt:     opt,
+		done:    done,
+	}
+}
+
+func (t *netTransport) Addr() string {
+	return t.addr
+}
+
+func (t *netTransport) Start() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.running {
+		return ErrServerRunning
+	}
+
+	ln, err := ListenOne(t.addr, ListenOptions{
+		ReusePort:  t.opt.Gnet.ReusePort,
+		UnixSocket: t.opt.UnixSocket,
+	})
+	if err != nil {
+		t.opt.Logger.Errorf("server on %s failed: %v", t.addr, err)
+		metrics.ServerErrors.With(t.opt.Protocol, "serve").Inc()
+		return err
+	}
+
+	if t.opt.TLS != nil {
+		ln = tls.NewListener(ln, t.opt.TLS)
+	}
+
+	t.ln, t.running, t.stopping, t.err = ln, true, false, nil
+	t.conns = make(map[*netConn]struct{})
+	t.done = make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		defer cancel()
+		t.accept(ln)
+	}()
+
+	if t.opt.Ticker {
+		go t.tick(ctx)
+	}
+
+	go func(done chan struct{}) {
+		<-ctx.Done()
+		t.wg.Wait()
+
+		t.lock.Lock()
+		t.running = false
+		t.lock.Unlock()
+
+		t.handler.OnShutdown()
+		close(done)
+	}(t.done)
+
+	t.opt.Logger.Infof("server is running on %s", t.addr)
+
+	return nil
+}
+
+func (t *netTransport) Stop(ctx context.Context) error {
+	done, ok := t.shutdown()
+	if !ok {
+		return ErrServerStopped
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shutdown closes the listener and the connections, false if it was
+// already.
+func (t *netTransport) shutdown() (chan struct{}, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if !t.running || t.stopping {
+		return nil, false
+	}
+
+	t.stopping = true
+	t.ln.Close()
+	for c := range t.conns {
+		c.Close()
+	}
+
+	return t.done, true
+}
+
+func (t *netTransport) Done() <-chan struct{} {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.done
+}
+
+func (t *netTransport) Err() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.err
+}
+
+func (t *netTransport) Running() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.running
+}
+
+func (t *netTransport) accept(ln net.Listener) {
+	var delay time.Duration
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			t.lock.Lock()
+			stopping := t.stopping
+			t.lock.Unlock()
+			if stopping {
+				return
+			}
+
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() || isTemporary(err) {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > maxAcceptDelay {
+					delay = maxAcceptDelay
+				}
+				t.opt.Logger.Errorf("accept on %s failed, retrying in %v: %v", t.addr, delay, err)
+				metrics.ServerErrors.With(t.opt.Protocol, "eventloop").Inc()
+				time.Sleep(delay)
+				continue
+			}
+
+			t.opt.Logger.Errorf("accept on %s failed: %v", t.addr, err)
+			metrics.ServerErrors.With(t.opt.Protocol, "serve").Inc()
+			t.lock.Lock()
+			t.err = err
+			t.lock.Unlock()
+			t.shutdown()
+			return
+		}
+		delay = 0
+
+		if tc, ok := c.(*net.TCPConn); ok && t.opt.Gnet.TCPKeepAliveSeconds > 0 {
+			tc.SetKeepAlive(true)
+			tc.SetKeepAlivePeriod(time.Duration(t.opt.Gnet.TCPKeepAliveSeconds) * time.Second)
+		}
+
+		nc := &netConn{Conn: c, transport: t}
+		t.lock.Lock()
+		if t.stopping {
+			t.lock.Unlock()
+			c.Close()
+			return
+		}
+		t.conns[nc] = struct{}{}
+		t.wg.Add(1)
+		t.lock.Unlock()
+
+		go t.serve(nc)
+	}
+}
+
+// serve reads nc until it is closed, the bytes the handler did not consume
+// are given again with the next read.
+func (t *netTransport) serve(nc *netConn) {
+	defer t.wg.Done()
+
+	var err error
+	defer func() {
+		nc.Close()
+
+		t.lock.Lock()
+		delete(t.conns, nc)
+		t.lock.Unlock()
+
+		if err != nil {
+			t.opt.Logger.Warnf("connection from %s closed: %v", nc.RemoteAddr(), err)
+			metrics.ServerErrors.With(t.opt.Protocol, "read").Inc()
+		}
+		t.handler.OnClose(nc, err)
+	}()
+
+	if t.handler.OnOpen(nc) != nil {
+		return
+	}
+
+	buf := make([]byte, 0, netReadSize)
+	for {
+		if len(buf) == cap(buf) {
+			buf = append(buf, make([]byte, netReadSize)...)[:len(buf)]
+		}
+
+		n, rerr := nc.Conn.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+
+		if n > 0 {
+			consumed, herr := t.handler.OnData(nc, buf)
+			if herr != nil {
+				err = herr
+				return
+			}
+
+			if consumed >= len(buf) {
+				buf = buf[:0]
+			} else if consumed > 0 {
+				buf = buf[:copy(buf, buf[consumed:])]
+			}
+		}
+
+		if rerr != nil {
+			if !errors.Is(rerr, io.EOF) && !errors.Is(rerr, net.ErrClosed) {
+				err = rerr
+			}
+			return
+		}
+	}
+}
+
+func (t *netTransport) tick(ctx context.Context) {
+	for {
+		delay := t.handler.OnTick()
+		if delay <= 0 {
+			delay = time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// AsyncWrite blocks until data is written, or the write timeout closed the
+// connection.
+func (c *netConn) AsyncWrite(data []byte) error {
+	c.writeLock.Lock()
+	if timeout := c.transport.opt.WriteTimeout; timeout > 0 {
+		c.Conn.SetWriteDeadline(time.Now().Add(timeout))
+	}
+	_, err := c.Conn.Write(data)
+	c.writeLock.Unlock()
+
+	if err != nil {
+		c.Close()
+		return err
+	}
+
+	c.transport.handler.OnWritten(c, len(data))
+
+	return nil
+}
+
+func (c *netConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		err = c.Conn.Close()
+	})
+
+	return err
+}
+
+func (c *netConn) Context() interface{} {
+	c.ctxLock.RLock()
+	defer c.ctxLock.RUnlock()
+
+	return c.ctx
+}
+
+func (c *netConn) SetContext(ctx interface{}) {
+	c.ctxLock.Lock()
+	c.ctx = ctx
+	c.ctxLock.Unlock()
+}
+
+func isTemporary(err error) bool {
+	te, ok := err.(interface{ Temporary() bool })
+	return ok && te.Temporary()
+}
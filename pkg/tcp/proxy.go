@@ -0,0 +1,299 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	proxyV1MaxLength = 107
+	proxyV2HeaderLen = 16
+
+	defaultProxyHeaderTimeout = 5 * time.Second
+)
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ProxyHeader is the client address a load balancer announced with the
+// HAProxy PROXY protocol. Source is nil for LOCAL/UNKNOWN connections, e.g.
+// health checks, in which case the real peer address is kept.
+type ProxyHeader struct {
+	Version     int
+	Source      net.Addr
+	Destination net.Addr
+}
+
+// ParseProxyHeader parses a v1 or v2 header at the start of buf, it returns
+// ErrProxyIncomplete when more data is needed.
+func ParseProxyHeader(buf []byte) (*ProxyHeader, int, error) {
+	if len(buf) >= len(proxyV2Signature) && bytes.Equal(buf[:len(proxyV2Signature)], proxyV2Signature) {
+		return parseProxyV2(buf)
+	}
+
+	if len(buf) < len(proxyV2Signature) && bytes.HasPrefix(proxyV2Signature, buf) {
+		return nil, 0, ErrProxyIncomplete
+	}
+
+	return parseProxyV1(buf)
+}
+
+func parseProxyV1(buf []byte) (*ProxyHeader, int, error) {
+	const prefix = "PROXY "
+	if len(buf) < len(prefix) {
+		if bytes.HasPrefix([]byte(prefix), buf) {
+			return nil, 0, ErrProxyIncomplete
+		}
+		return nil, 0, ErrProxyInvalid
+	}
+
+	if string(buf[:len(prefix)]) != prefix {
+		return nil, 0, ErrProxyInvalid
+	}
+
+	end := bytes.Index(buf, []byte("\r\n"))
+	if end < 0 {
+		if len(buf) >= proxyV1MaxLength {
+			return nil, 0, ErrProxyInvalid
+		}
+		return nil, 0, ErrProxyIncomplete
+	}
+
+	fields := strings.Fields(string(buf[len(prefix):end]))
+	header := &ProxyHeader{Version: 1}
+	consumed := end + 2
+
+	if len(fields) > 0 && fields[0] == "UNKNOWN" {
+		return header, consumed, nil
+	}
+
+	if len(fields) != 5 || (fields[0] != "TCP4" && fields[0] != "TCP6") {
+		return nil, 0, ErrProxyInvalid
+	}
+
+	src, err := tcpAddr(fields[1], fields[3])
+	if err != nil {
+		return nil, 0, err
+	}
+
+	dst, err := tcpAddr(fields[2], fields[4])
+	if err != nil {
+		return nil, 0, err
+	}
+
+	header.Source, header.Destination = src, dst
+
+	return header, consumed, nil
+}
+
+func tcpAddr(ip, port string) (*net.TCPAddr, error) {
+	addr := net.ParseIP(ip)
+	p, err := strconv.Atoi(port)
+	if addr == nil || err != nil || p < 0 || p > 65535 {
+		return nil, ErrProxyInvalid
+	}
+
+	return &net.TCPAddr{IP: addr, Port: p}, nil
+}
+
+func parseProxyV2(buf []byte) (*ProxyHeader, int, error) {
+	if len(buf) < proxyV2HeaderLen {
+		return nil, 0, ErrProxyIncomplete
+	}
+
+	verCmd, famProto := buf[12], buf[13]
+	length := int(binary.BigEndian.Uint16(buf[14:16]))
+	if verCmd>>4 != 2 {
+		return nil, 0, ErrProxyInvalid
+	}
+
+	consumed := proxyV2HeaderLen + length
+	if len(buf) < consumed {
+		return nil, 0, ErrProxyIncomplete
+	}
+
+	header := &ProxyHeader{Version: 2}
+	payload := buf[proxyV2HeaderLen:consumed]
+
+	// LOCAL command, the connection was opened by the proxy itself
+	if verCmd&0x0f == 0 {
+		return header, consumed, nil
+	}
+
+	switch famProto >> 4 {
+	case 0x1: // AF_INET
+		if len(payload) < 12 {
+			return nil, 0, ErrProxyInvalid
+		}
+		header.Source = &net.TCPAddr{IP: net.IP(append([]byte(nil), payload[0:4]...)), Port: int(binary.BigEndian.Uint16(payload[8:10]))}
+		header.Destination = &net.TCPAddr{IP: net.IP(append([]byte(nil), payload[4:8]...)), Port: int(binary.BigEndian.Uint16(payload[10:12]))}
+	case 0x2: // AF_INET6
+		if len(payload) < 36 {
+			return nil, 0, ErrProxyInvalid
+		}
+		header.Source = &net.TCPAddr{IP: net.IP(append([]byte(nil), payload[0:16]...)), Port: int(binary.BigEndian.Uint16(payload[32:34]))}
+		header.Destination = &net.TCPAddr{IP: net.IP(append([]byte(nil), payload[16:32]...)), Port: int(binary.BigEndian.Uint16(payload[34:36]))}
+	}
+
+	return header, consumed, nil
+}
+
+// TrustedProxies are the networks of the load balancers PROXY headers are
+// taken from. Any other peer could claim any address with one, so it keeps
+// its own.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses CIDRs, e.g. "10.0.0.0/8", or single ips.
+func ParseTrustedProxies(networks []string) (TrustedProxies, error) {
+	trusted := make(TrustedProxies, 0, len(networks))
+	for _, n := range networks {
+		if !strings.Contains(n, "/") {
+			ip := net.ParseIP(n)
+			if ip == nil {
+				return nil, errors.Wrapf(ErrInvalidProxyNet, "%s", n)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			trusted = append(trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(n)
+		if err != nil {
+			return nil, errors.Wrapf(ErrInvalidProxyNet, "%s", n)
+		}
+		trusted = append(trusted, ipNet)
+	}
+
+	return trusted, nil
+}
+
+// Trusts reports whether the PROXY header of the peer at addr is taken,
+// never for unix socket peers which have no ip.
+func (t TrustedProxies) Trusts(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	for _, n := range t {
+		if n.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ProxyListener strips the PROXY header from the connections of trusted
+// proxies and reports the announced client as RemoteAddr, for net/http and
+// other blocking servers. Other connections are passed through as they are.
+type ProxyListener struct {
+	net.Listener
+	HeaderTimeout time.Duration
+	Trusted       TrustedProxies
+}
+
+func NewProxyListener(ln net.Listener, trusted TrustedProxies) *ProxyListener {
+	return &ProxyListener{
+		Listener:      ln,
+		HeaderTimeout: defaultProxyHeaderTimeout,
+		Trusted:       trusted,
+	}
+}
+
+func (l *ProxyListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	if !l.Trusted.Trusts(c.RemoteAddr()) {
+		return c, nil
+	}
+
+	return &proxyConn{Conn: c, timeout: l.HeaderTimeout}, nil
+}
+
+// proxyConn reads the header lazily on first use so a slow proxy does not
+// block Accept for everyone else.
+type proxyConn struct {
+	net.Conn
+	timeout time.Duration
+	once    sync.Once
+	reader  *bufio.Reader
+	remote  net.Addr
+	err     error
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		c.reader = bufio.NewReaderSize(c.Conn, proxyV1MaxLength+proxyV2HeaderLen)
+		if c.timeout > 0 {
+			c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+			defer c.Conn.SetReadDeadline(time.Time{})
+		}
+
+		for n := len("PROXY "); ; {
+			buf, peekErr := c.reader.Peek(n)
+			header, consumed, err := ParseProxyHeader(buf)
+			if err == nil {
+				c.reader.Discard(consumed)
+				if header.Source != nil {
+					c.remote = header.Source
+				}
+				return
+			}
+
+			if err != ErrProxyIncomplete {
+				c.err = err
+				return
+			}
+
+			if peekErr != nil {
+				c.err = peekErr
+				return
+			}
+
+			if n >= c.reader.Size() {
+				// a v2 header with TLVs may exceed the buffer, read the announced length
+				if len(buf) >= proxyV2HeaderLen && bytes.HasPrefix(buf, proxyV2Signature) {
+					total := proxyV2HeaderLen + int(binary.BigEndian.Uint16(buf[14:16]))
+					c.reader = bufio.NewReaderSize(c.reader, total)
+					n = total
+					continue
+				}
+				c.err = ErrProxyInvalid
+				return
+			}
+			n++
+		}
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote != nil {
+		return c.remote
+	}
+
+	return c.Conn.RemoteAddr()
+}
@@ -0,0 +1,109 @@
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/panjf2000/gnet/pkg/logging"
+)
+
+type TransportKind string
+
+const (
+	// TransportGnet runs the connections on gnet event loops, writes are
+	// queued.
+	TransportGnet TransportKind = "gnet"
+	// TransportNet serves a net.Listener with a goroutine per connection,
+	// writes block until the data is written. It serves tls.
+	TransportNet TransportKind = "net"
+)
+
+// Conn is a connection accepted by a Transport, gnet.Conn is one.
+type Conn interface {
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+	// AsyncWrite sends data, OnWritten of the handler follows once it left.
+	// The gnet transport queues it, the net one blocks until it is written.
+	AsyncWrite(data []byte) error
+	// Close may be called from any goroutine, OnClose of the handler
+	// follows.
+	Close() error
+	Context() interface{}
+	SetContext(ctx interface{})
+}
+
+// Handler serves the connections of a Transport. OnData and OnClose of one
+// connection never run concurrently, OnWritten may run with the writer.
+type Handler interface {
+	// OnOpen is called for every accepted connection, an error closes it.
+	OnOpen(c Conn) error
+	// OnData is called with the bytes received and not consumed so far, only
+	// valid during the call, it returns how many it consumed. An error closes
+	// the connection.
+	OnData(c Conn, data []byte) (int, error)
+	// OnWritten is called with the number of bytes that left the connection.
+	OnWritten(c Conn, n int)
+	// OnClose is called for every connection, also those OnOpen rejected,
+	// err is the read error it was closed for.
+	OnClose(c Conn, err error)
+	// OnTick is called while TransportOptions.Ticker is set, again after the
+	// delay it returns.
+	OnTick() time.Duration
+	// OnShutdown is called once the transport stopped.
+	OnShutdown()
+}
+
+// Transport accepts the connections of one listener for a Handler, it can be
+// started again once stopped.
+type Transport interface {
+	Addr() string
+	// Start returns once the transport accepts connections.
+	Start() error
+	// Stop closes the listener and the connections.
+	Stop(ctx context.Context) error
+	// Done is closed once the transport stopped.
+	Done() <-chan struct{}
+	// Err is the error the transport stopped with, nil if it was stopped.
+	Err() error
+	Running() bool
+}
+
+type TransportOptions struct {
+	// Kind selects the implementation, gnet when empty.
+	Kind TransportKind
+	// Gnet tunes the sockets, of the event loops too with the gnet
+	// transport. The net transport takes ReusePort and TCPKeepAliveSeconds.
+	Gnet GnetOptions
+	// TLS serves tls, only the net transport does.
+	TLS *tls.Config
+	// WriteTimeout closes net connections a write blocks for that long, 0
+	// waits forever.
+	WriteTimeout time.Duration
+	// Protocol labels the metrics of the transport, e.g. metrics.ProtocolRTSP.
+	Protocol string
+	Logger   logging.Logger
+	// Ticker calls OnTick of the handler.
+	Ticker bool
+	// UnixSocket sets the permissions of a unix:// address.
+	UnixSocket UnixSocketOptions
+}
+
+func NewTransport(handler Handler, addr string, opt TransportOptions) (Transport, error) {
+	if opt.Logger == nil {
+		opt.Logger = logging.GetDefaultLogger()
+	}
+
+	switch opt.Kind {
+	case "", TransportGnet:
+		if opt.TLS != nil {
+			return nil, ErrTLSUnsupported
+		}
+		return newGnetTransport(handler, addr, opt), nil
+	case TransportNet:
+		return newNetTransport(handler, addr, opt), nil
+	}
+
+	return nil, ErrUnsupportedTransport
+}
@@ -0,0 +1,191 @@
+package tcp
+
+import (
+	"sync"
+
+	"github.com/pingostack/neon/pkg/ratelimit"
+)
+
+type Policy int
+
+const (
+	// PolicyDrop drops media once the queue is full.
+	PolicyDrop Policy = iota
+	// PolicyBlock makes media writers wait for the queue to drain.
+	PolicyBlock
+)
+
+const (
+	defaultMaxQueueBytes = 4 * 1024 * 1024
+)
+
+type WriterOptions struct {
+	// MaxQueueBytes bounds the bytes handed to the connection and not yet written.
+	MaxQueueBytes int `json:"maxQueueBytes" mapstructure:"maxQueueBytes"`
+	// HighWatermark starts dropping non-keyframes, defaults to half of MaxQueueBytes.
+	HighWatermark int    `json:"highWatermark" mapstructure:"highWatermark"`
+	Policy        Policy `json:"policy" mapstructure:"policy"`
+}
+
+// Writer bounds the output of one connection. The sink is asynchronous, e.g.
+// gnet's AsyncWrite, and Done must be called as data leaves the connection's
+// queue so Writer knows its depth.
+type Writer struct {
+	sink     func([]byte) error
+	opt      WriterOptions
+	lock     sync.Mutex
+	drained  *sync.Cond
+	queued   int
+	dropped  uint64
+	skipping bool
+	closed   bool
+	limiter  ratelimit.Group
+}
+
+func NewWriter(sink func([]byte) error, opt WriterOptions) *Writer {
+	if opt.MaxQueueBytes <= 0 {
+		opt.MaxQueueBytes = defaultMaxQueueBytes
+	}
+
+	if opt.HighWatermark <= 0 || opt.HighWatermark > opt.MaxQueueBytes {
+		opt.HighWatermark = opt.MaxQueueBytes / 2
+	}
+
+	w := &Writer{
+		sink: sink,
+		opt:  opt,
+	}
+	w.drained = sync.NewCond(&w.lock)
+
+	return w
+}
+
+// Write queues control data such as RTSP responses, it is never dropped.
+func (w *Writer) Write(data []byte) error {
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		return ErrWriterClosed
+	}
+
+	w.queued += len(data)
+	w.lock.Unlock()
+
+	return w.flush(data)
+}
+
+// SetLimiter sets the egress buckets of the media, e.g. global, stream and
+// session. Frames over the limit are dropped as those above the watermark.
+func (w *Writer) SetLimiter(limiter ratelimit.Group) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.limiter = limiter
+}
+
+// WriteFrame queues media. Above the high watermark or the limiter non-keyframes
+// are dropped and, once a frame was dropped, everything up to the next keyframe
+// is too so the decoder never sees a broken GOP.
+func (w *Writer) WriteFrame(data []byte, keyframe bool) error {
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		return ErrWriterClosed
+	}
+
+	if w.skipping && !keyframe {
+		w.dropped++
+		w.lock.Unlock()
+		return nil
+	}
+
+	if !keyframe && w.queued+len(data) > w.opt.HighWatermark {
+		w.skipping = true
+		w.dropped++
+		w.lock.Unlock()
+		return nil
+	}
+
+	for w.queued+len(data) > w.opt.MaxQueueBytes && w.queued > 0 {
+		if w.opt.Policy != PolicyBlock {
+			w.skipping = true
+			w.dropped++
+			w.lock.Unlock()
+			return ErrQueueFull
+		}
+
+		w.drained.Wait()
+		if w.closed {
+			w.lock.Unlock()
+			return ErrWriterClosed
+		}
+	}
+
+	// charged once the frame is sure to be queued
+	if !w.limiter.Allow(len(data)) {
+		w.skipping = true
+		w.dropped++
+		w.lock.Unlock()
+		return nil
+	}
+
+	w.skipping = false
+	w.queued += len(data)
+	w.lock.Unlock()
+
+	return w.flush(data)
+}
+
+func (w *Writer) flush(data []byte) error {
+	if err := w.sink(data); err != nil {
+		w.Done(len(data))
+		return err
+	}
+
+	return nil
+}
+
+// Done reports n bytes as written.
+func (w *Writer) Done(n int) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.queued -= n
+	if w.queued < 0 {
+		w.queued = 0
+	}
+
+	w.drained.Broadcast()
+}
+
+// Depth is the number of queued bytes.
+func (w *Writer) Depth() int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.queued
+}
+
+// Congested reports whether the queue is above the high watermark, media
+// producers should skip to the next keyframe.
+func (w *Writer) Congested() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.queued > w.opt.HighWatermark
+}
+
+func (w *Writer) Dropped() uint64 {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.dropped
+}
+
+func (w *Writer) Close() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.closed = true
+	w.drained.Broadcast()
+}
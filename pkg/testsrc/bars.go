@@ -0,0 +1,172 @@
+package testsrc
+
+import (
+	"fmt"
+	"image"
+	"time"
+)
+
+type ycbcr struct {
+	y, cb, cr byte
+}
+
+// rgb converts 8 bit rgb to the limited range ycbcr of bt.601.
+func rgb(r, g, b int) ycbcr {
+	y := 16 + (65738*r+129057*g+25064*b)/256/1000
+	cb := 128 + (-37945*r-74494*g+112439*b)/256/1000
+	cr := 128 + (112439*r-94154*g-18285*b)/256/1000
+
+	return ycbcr{byte(y), byte(cb), byte(cr)}
+}
+
+var (
+	// the 75% bars of smpte eg 1-1990, top to bottom
+	barsTop = []ycbcr{
+		rgb(191, 191, 191), rgb(191, 191, 0), rgb(0, 191, 191), rgb(0, 191, 0),
+		rgb(191, 0, 191), rgb(191, 0, 0), rgb(0, 0, 191),
+	}
+	barsMiddle = []ycbcr{
+		rgb(0, 0, 191), rgb(19, 19, 19), rgb(191, 0, 191), rgb(19, 19, 19),
+		rgb(0, 191, 191), rgb(19, 19, 19), rgb(191, 191, 191),
+	}
+	// -I, white, +Q and black, the pluge on the right
+	barsBottom = []ycbcr{
+		rgb(0, 33, 76), rgb(255, 255, 255), rgb(50, 0, 106), rgb(19, 19, 19),
+		rgb(9, 9, 9), rgb(19, 19, 19), rgb(29, 29, 29), rgb(19, 19, 19),
+	}
+	// the bottom row in sevenths of the width, the pluge in thirds of one
+	barsBottomEdges = []float64{5.0 / 4, 5.0 / 2, 15.0 / 4, 5, 5 + 1.0/3, 5 + 2.0/3, 6, 7}
+
+	black = rgb(0, 0, 0)
+	white = rgb(255, 255, 255)
+)
+
+// Bars draws smpte color bars, the timecode of the picture burned in.
+type Bars struct {
+	width, height int
+	fps           int
+	background    *image.YCbCr
+	pic           *image.YCbCr
+}
+
+func NewBars(width, height, fps int) *Bars {
+	b := &Bars{
+		width:      width,
+		height:     height,
+		fps:        fps,
+		background: image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420),
+		pic:        image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420),
+	}
+
+	pixel := func(x, y int) ycbcr {
+		seventh := float64(x) * 7 / float64(width)
+		switch {
+		case y < height*2/3:
+			return barsTop[int(seventh)]
+		case y < height*3/4:
+			return barsMiddle[int(seventh)]
+		}
+
+		for i, edge := range barsBottomEdges {
+			if seventh < edge {
+				return barsBottom[i]
+			}
+		}
+
+		return barsBottom[len(barsBottom)-1]
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := pixel(x, y)
+			b.background.Y[y*b.background.YStride+x] = p.y
+			if x%2 == 0 && y%2 == 0 {
+				o := y/2*b.background.CStride + x/2
+				b.background.Cb[o], b.background.Cr[o] = p.cb, p.cr
+			}
+		}
+	}
+
+	return b
+}
+
+// Picture returns the picture of frame n, shared with the next call.
+func (b *Bars) Picture(n int) *image.YCbCr {
+	copy(b.pic.Y, b.background.Y)
+	copy(b.pic.Cb, b.background.Cb)
+	copy(b.pic.Cr, b.background.Cr)
+
+	b.drawText(Timecode(n, b.fps))
+
+	return b.pic
+}
+
+// Timecode is the hh:mm:ss:ff timecode of frame n at fps.
+func Timecode(n, fps int) string {
+	d := time.Duration(n/fps) * time.Second
+	return fmt.Sprintf("%02d:%02d:%02d:%02d",
+		int(d.Hours())%24, int(d.Minutes())%60, int(d.Seconds())%60, n%fps)
+}
+
+// drawText draws text white on a black box, in the middle of the top bars.
+func (b *Bars) drawText(text string) {
+	scale := b.width / 160
+	if scale < 1 {
+		scale = 1
+	}
+
+	// a glyph is 5x7 with a column and a row of spacing, the box a glyph
+	// wide around the text
+	w, h := (len(text)+2)*6*scale, 9*scale
+	x0, y0 := (b.width-w)/2&^1, (b.height/3-h/2)&^1
+	b.fill(x0, y0, w, h, black)
+
+	for i, c := range text {
+		glyph, ok := font[c]
+		if !ok {
+			continue
+		}
+
+		gx := x0 + (i+1)*6*scale
+		for row, bits := range glyph {
+			for col := 0; col < 5; col++ {
+				if bits&(0x10>>col) != 0 {
+					b.fill(gx+col*scale, y0+(row+1)*scale, scale, scale, white)
+				}
+			}
+		}
+	}
+}
+
+func (b *Bars) fill(x0, y0, w, h int, c ycbcr) {
+	for y := maxInt(y0, 0); y < minInt(y0+h, b.height); y++ {
+		for x := maxInt(x0, 0); x < minInt(x0+w, b.width); x++ {
+			b.pic.Y[y*b.pic.YStride+x] = c.y
+			o := y/2*b.pic.CStride + x/2
+			b.pic.Cb[o], b.pic.Cr[o] = c.cb, c.cr
+		}
+	}
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+// font has the 5x7 glyphs of timecodes, a row a byte.
+var font = map[rune][7]byte{
+	'0': {0x0e, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0e},
+	'1': {0x04, 0x0c, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'2': {0x0e, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1f},
+	'3': {0x1f, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0e},
+	'4': {0x02, 0x06, 0x0a, 0x12, 0x1f, 0x02, 0x02},
+	'5': {0x1f, 0x10, 0x1e, 0x01, 0x01, 0x11, 0x0e},
+	'6': {0x06, 0x08, 0x10, 0x1e, 0x11, 0x11, 0x0e},
+	'7': {0x1f, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8': {0x0e, 0x11, 0x11, 0x0e, 0x11, 0x11, 0x0e},
+	'9': {0x0e, 0x11, 0x11, 0x0f, 0x01, 0x02, 0x0c},
+	':': {0x00, 0x0c, 0x0c, 0x00, 0x0c, 0x0c, 0x00},
+}
@@ -0,0 +1,384 @@
+package testsrc
+
+import (
+	"errors"
+	"image"
+)
+
+const (
+	h264ProfileBaseline = 66
+	// log2 of the range of frame_num
+	h264FrameNumBits = 8
+	// mb_type of I_PCM in I slices, P slices number intra types after 5
+	h264MBTypeIPCM  = 25
+	h264MBTypePIntr = 5
+)
+
+var ErrInvalidSize = errors.New("invalid picture size")
+
+// H264Encoder encodes pictures to h264 without compressing them, for test
+// signals which are mostly still: intra macroblocks are sent as raw
+// samples, I_PCM, and the macroblocks of P pictures that did not change are
+// skipped. A keyframe costs 384 bytes a macroblock, the pictures in between
+// little more than what changed.
+type H264Encoder struct {
+	width, height int
+	mbW, mbH      int
+	fps           int
+	frameNum      int
+	idrID         int
+	last          *image.YCbCr
+}
+
+// NewH264Encoder encodes pictures of width x height, both even, at fps.
+func NewH264Encoder(width, height, fps int) (*H264Encoder, error) {
+	if width <= 0 || height <= 0 || width%2 != 0 || height%2 != 0 {
+		return nil, ErrInvalidSize
+	}
+
+	if fps <= 0 {
+		fps = 25
+	}
+
+	return &H264Encoder{
+		width:  width,
+		height: height,
+		mbW:    (width + 15) / 16,
+		mbH:    (height + 15) / 16,
+		fps:    fps,
+	}, nil
+}
+
+// Encode returns the annex b access unit of pic, a 4:2:0 picture of the size
+// of the encoder. A keyframe carries the sps and pps, the first picture is
+// always one.
+func (e *H264Encoder) Encode(pic *image.YCbCr, keyframe bool) []byte {
+	if e.last == nil {
+		keyframe = true
+	}
+
+	var au []byte
+	if keyframe {
+		e.frameNum = 0
+		au = appendNALU(au, 3, 7, e.sps())
+		au = appendNALU(au, 3, 8, e.pps())
+		au = appendNALU(au, 3, 5, e.slice(pic, true))
+		e.idrID = (e.idrID + 1) % 65536
+	} else {
+		au = appendNALU(au, 2, 1, e.slice(pic, false))
+	}
+	e.frameNum = (e.frameNum + 1) % (1 << h264FrameNumBits)
+
+	if e.last == nil {
+		e.last = image.NewYCbCr(image.Rect(0, 0, e.mbW*16, e.mbH*16), image.YCbCrSubsampleRatio420)
+	}
+	e.store(pic)
+
+	return au
+}
+
+// sps is a constrained baseline sequence cropped to the size of the
+// pictures, with the frame rate and no reordering.
+func (e *H264Encoder) sps() []byte {
+	w := &bitWriter{}
+	w.bits(h264ProfileBaseline, 8)
+	// constraint_set0 and 1, constrained baseline
+	w.bits(0xc0, 8)
+	w.bits(uint32(h264Level(e.mbW*e.mbH, e.fps)), 8)
+	w.ue(0) // seq_parameter_set_id
+	w.ue(h264FrameNumBits - 4)
+	w.ue(2) // pic_order_cnt_type, the order of decoding
+	w.ue(1) // max_num_ref_frames
+	w.bit(0)
+	w.ue(uint32(e.mbW - 1))
+	w.ue(uint32(e.mbH - 1))
+	w.bit(1) // frame_mbs_only_flag
+	w.bit(1) // direct_8x8_inference_flag
+
+	right, bottom := (e.mbW*16-e.width)/2, (e.mbH*16-e.height)/2
+	if right > 0 || bottom > 0 {
+		w.bit(1)
+		w.ue(0)
+		w.ue(uint32(right))
+		w.ue(0)
+		w.ue(uint32(bottom))
+	} else {
+		w.bit(0)
+	}
+
+	// vui with the timing and the restrictions of the stream
+	w.bit(1)
+	w.bit(0) // aspect_ratio_info_present_flag
+	w.bit(0) // overscan_info_present_flag
+	w.bit(0) // video_signal_type_present_flag
+	w.bit(0) // chroma_loc_info_present_flag
+	w.bit(1) // timing_info_present_flag
+	w.bits(1, 32)
+	w.bits(uint32(2*e.fps), 32)
+	w.bit(1) // fixed_frame_rate_flag
+	w.bit(0) // nal_hrd_parameters_present_flag
+	w.bit(0) // vcl_hrd_parameters_present_flag
+	w.bit(0) // pic_struct_present_flag
+	w.bit(1) // bitstream_restriction_flag
+	w.bit(1) // motion_vectors_over_pic_boundaries_flag
+	w.ue(0)  // max_bytes_per_pic_denom
+	w.ue(0)  // max_bits_per_mb_denom
+	w.ue(16) // log2_max_mv_length_horizontal
+	w.ue(16) // log2_max_mv_length_vertical
+	w.ue(0)  // max_num_reorder_frames
+	w.ue(1)  // max_dec_frame_buffering
+	w.trailing()
+
+	return w.buf
+}
+
+func (e *H264Encoder) pps() []byte {
+	w := &bitWriter{}
+	w.ue(0)  // pic_parameter_set_id
+	w.ue(0)  // seq_parameter_set_id
+	w.bit(0) // entropy_coding_mode_flag, cavlc
+	w.bit(0) // bottom_field_pic_order_in_frame_present_flag
+	w.ue(0)  // num_slice_groups_minus1
+	w.ue(0)  // num_ref_idx_l0_default_active_minus1
+	w.ue(0)  // num_ref_idx_l1_default_active_minus1
+	w.bit(0) // weighted_pred_flag
+	w.bits(0, 2)
+	w.se(0)  // pic_init_qp_minus26
+	w.se(0)  // pic_init_qs_minus26
+	w.se(0)  // chroma_qp_index_offset
+	w.bit(1) // deblocking_filter_control_present_flag
+	w.bit(0) // constrained_intra_pred_flag
+	w.bit(0) // redundant_pic_cnt_present_flag
+	w.trailing()
+
+	return w.buf
+}
+
+// slice codes pic as a single slice. Deblocking is off, skipped macroblocks
+// are then the exact copy of the last picture.
+func (e *H264Encoder) slice(pic *image.YCbCr, idr bool) []byte {
+	w := &bitWriter{}
+	w.ue(0) // first_mb_in_slice
+	if idr {
+		w.ue(7) // I, all slices of the picture
+	} else {
+		w.ue(5) // P
+	}
+	w.ue(0) // pic_parameter_set_id
+	w.bits(uint32(e.frameNum), h264FrameNumBits)
+	if idr {
+		w.ue(uint32(e.idrID))
+	} else {
+		w.bit(0) // num_ref_idx_active_override_flag
+		w.bit(0) // ref_pic_list_modification_flag_l0
+	}
+	if idr {
+		w.bit(0) // no_output_of_prior_pics_flag
+		w.bit(0) // long_term_reference_flag
+	} else {
+		w.bit(0) // adaptive_ref_pic_marking_mode_flag
+	}
+	w.se(0) // slice_qp_delta
+	w.ue(1) // disable_deblocking_filter_idc
+
+	skipped := 0
+	for y := 0; y < e.mbH; y++ {
+		for x := 0; x < e.mbW; x++ {
+			if !idr && !e.changed(pic, x, y) {
+				skipped++
+				continue
+			}
+
+			if idr {
+				w.ue(h264MBTypeIPCM)
+			} else {
+				w.ue(uint32(skipped))
+				skipped = 0
+				w.ue(h264MBTypePIntr + h264MBTypeIPCM)
+			}
+			w.align()
+			e.writePCM(w, pic, x, y)
+		}
+	}
+	if skipped > 0 {
+		w.ue(uint32(skipped))
+	}
+	w.trailing()
+
+	return w.buf
+}
+
+// writePCM writes the samples of the macroblock at x, y, the picture edge
+// repeated over the cropped area.
+func (e *H264Encoder) writePCM(w *bitWriter, pic *image.YCbCr, x, y int) {
+	for j := 0; j < 16; j++ {
+		for i := 0; i < 16; i++ {
+			w.buf = append(w.buf, pcmSample(pic.Y[e.lumaOffset(pic, x*16+i, y*16+j)]))
+		}
+	}
+
+	for _, plane := range [][]byte{pic.Cb, pic.Cr} {
+		for j := 0; j < 8; j++ {
+			for i := 0; i < 8; i++ {
+				w.buf = append(w.buf, pcmSample(plane[e.chromaOffset(pic, x*8+i, y*8+j)]))
+			}
+		}
+	}
+}
+
+func (e *H264Encoder) changed(pic *image.YCbCr, x, y int) bool {
+	for j := 0; j < 16; j++ {
+		for i := 0; i < 16; i++ {
+			if pic.Y[e.lumaOffset(pic, x*16+i, y*16+j)] != e.last.Y[(y*16+j)*e.last.YStride+x*16+i] {
+				return true
+			}
+		}
+	}
+
+	for j := 0; j < 8; j++ {
+		for i := 0; i < 8; i++ {
+			o, lo := e.chromaOffset(pic, x*8+i, y*8+j), (y*8+j)*e.last.CStride+x*8+i
+			if pic.Cb[o] != e.last.Cb[lo] || pic.Cr[o] != e.last.Cr[lo] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// store keeps pic to compare the next picture with.
+func (e *H264Encoder) store(pic *image.YCbCr) {
+	for y := 0; y < e.mbH*16; y++ {
+		for x := 0; x < e.mbW*16; x++ {
+			e.last.Y[y*e.last.YStride+x] = pic.Y[e.lumaOffset(pic, x, y)]
+		}
+	}
+
+	for y := 0; y < e.mbH*8; y++ {
+		for x := 0; x < e.mbW*8; x++ {
+			o := e.chromaOffset(pic, x, y)
+			e.last.Cb[y*e.last.CStride+x], e.last.Cr[y*e.last.CStride+x] = pic.Cb[o], pic.Cr[o]
+		}
+	}
+}
+
+func (e *H264Encoder) lumaOffset(pic *image.YCbCr, x, y int) int {
+	return minInt(y, e.height-1)*pic.YStride + minInt(x, e.width-1)
+}
+
+func (e *H264Encoder) chromaOffset(pic *image.YCbCr, x, y int) int {
+	return minInt(y, e.height/2-1)*pic.CStride + minInt(x, e.width/2-1)
+}
+
+// pcmSample keeps samples off 0, which older decoders reject in I_PCM.
+func pcmSample(v byte) byte {
+	if v == 0 {
+		return 1
+	}
+
+	return v
+}
+
+// h264Level is the lowest level of the macroblock rate of the stream.
+func h264Level(mbs, fps int) int {
+	levels := []struct {
+		level, frame, rate int
+	}{
+		{21, 792, 19800}, {30, 1620, 40500}, {31, 3600, 108000}, {32, 5120, 216000},
+		{40, 8192, 245760}, {42, 8704, 522240}, {50, 22080, 589824}, {51, 36864, 983040},
+	}
+
+	for _, l := range levels {
+		if mbs <= l.frame && mbs*fps <= l.rate {
+			return l.level
+		}
+	}
+
+	return 52
+}
+
+// appendNALU appends a nal unit of rbsp with its start code, emulation
+// prevention bytes inserted.
+func appendNALU(au []byte, refIdc, typ byte, rbsp []byte) []byte {
+	au = append(au, 0, 0, 0, 1, refIdc<<5|typ)
+
+	zeros := 0
+	for _, b := range rbsp {
+		if zeros >= 2 && b <= 3 {
+			au = append(au, 3)
+			zeros = 0
+		}
+
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		au = append(au, b)
+	}
+
+	return au
+}
+
+type bitWriter struct {
+	buf []byte
+	// bits used of the last byte, 0 when aligned
+	n int
+}
+
+func (w *bitWriter) bit(b uint32) {
+	if w.n == 0 {
+		w.buf = append(w.buf, 0)
+	}
+
+	if b&1 == 1 {
+		w.buf[len(w.buf)-1] |= 0x80 >> w.n
+	}
+	w.n = (w.n + 1) % 8
+}
+
+func (w *bitWriter) bits(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.bit(v >> i)
+	}
+}
+
+// ue writes an exp-golomb coded number.
+func (w *bitWriter) ue(v uint32) {
+	v++
+	n := 0
+	for x := v; x > 1; x >>= 1 {
+		n++
+	}
+
+	w.bits(0, n)
+	w.bits(v, n+1)
+}
+
+func (w *bitWriter) se(v int32) {
+	if v > 0 {
+		w.ue(uint32(2*v - 1))
+	} else {
+		w.ue(uint32(-2 * v))
+	}
+}
+
+// align pads with zero bits to the next byte.
+func (w *bitWriter) align() {
+	w.n = 0
+}
+
+// trailing writes the rbsp stop bit and aligns.
+func (w *bitWriter) trailing() {
+	w.bit(1)
+	w.align()
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
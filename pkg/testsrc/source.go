@@ -0,0 +1,218 @@
+// Package testsrc generates test signals: smpte color bars with the timecode
+// burned in and a sine tone, encoded without an external encoder.
+package testsrc
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/rtclib"
+	"github.com/pingostack/neon/pkg/transcoder"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	videoPayloadType = 96
+	audioPayloadType = 111
+	videoClockRate   = 90000
+
+	defaultWidth  = 640
+	defaultHeight = 360
+	defaultFPS    = 25
+	defaultToneHz = 1000
+	// the tone at -20 dBFS
+	toneAmplitude = 0.1
+)
+
+type Options struct {
+	Width  int
+	Height int
+	FPS    int
+	// GOP is the number of frames from a keyframe to the next, two seconds
+	// when zero.
+	GOP int
+	// Audio is the codec of the tone, pcmu and pcma always encode, opus when
+	// built with libopus. No audio when zero.
+	Audio  deliver.CodecType
+	ToneHz int
+}
+
+// Source is a frame source of rtp packets playing the test signal in real
+// time, until its context is done.
+type Source struct {
+	deliver.FrameSource
+	opts     Options
+	logger   *logrus.Entry
+	bars     *Bars
+	encoder  *H264Encoder
+	video    *rtclib.Packetizer
+	audio    *rtclib.Packetizer
+	audioEnc transcoder.AudioEncoder
+	codec    transcoder.AudioCodec
+	// keyframe is set when a subscriber asked for one
+	keyframe int32
+}
+
+func NewSource(ctx context.Context, opts Options, logger *logrus.Entry) (*Source, error) {
+	if opts.Width <= 0 || opts.Height <= 0 {
+		opts.Width, opts.Height = defaultWidth, defaultHeight
+	}
+
+	if opts.FPS <= 0 {
+		opts.FPS = defaultFPS
+	}
+
+	if opts.GOP <= 0 {
+		opts.GOP = 2 * opts.FPS
+	}
+
+	if opts.ToneHz <= 0 {
+		opts.ToneHz = defaultToneHz
+	}
+
+	encoder, err := NewH264Encoder(opts.Width, opts.Height, opts.FPS)
+	if err != nil {
+		return nil, err
+	}
+
+	video, err := rtclib.NewPacketizer(deliver.CodecTypeH264, videoPayloadType, videoClockRate)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Source{
+		opts:    opts,
+		logger:  logger,
+		bars:    NewBars(opts.Width, opts.Height, opts.FPS),
+		encoder: encoder,
+		video:   video,
+	}
+
+	metadata := deliver.Metadata{
+		PacketType: deliver.PacketTypeRtp,
+		Video: &deliver.VideoMetadata{
+			Codec:          deliver.CodecTypeH264.String(),
+			CodecType:      deliver.CodecTypeH264,
+			Width:          opts.Width,
+			Height:         opts.Height,
+			FPS:            opts.FPS,
+			RtpPayloadType: videoPayloadType,
+			ClockRate:      videoClockRate,
+		},
+	}
+
+	if opts.Audio != deliver.CodecTypeNone {
+		if s.audioEnc, s.codec, err = transcoder.NewAudioEncoder(opts.Audio); err != nil {
+			return nil, err
+		}
+
+		if s.audio, err = rtclib.NewPacketizer(opts.Audio, audioPayloadType, s.codec.SampleRate); err != nil {
+			return nil, err
+		}
+
+		metadata.Audio = &deliver.AudioMetadata{
+			Codec:          opts.Audio.String(),
+			CodecType:      opts.Audio,
+			SampleRate:     s.codec.SampleRate,
+			Channels:       uint8(s.codec.Channels),
+			RtpPayloadType: audioPayloadType,
+		}
+	}
+
+	s.FrameSource = deliver.NewFrameSourceImpl(ctx, metadata)
+
+	go s.pace(time.Second/time.Duration(opts.FPS), s.writeVideo)
+	if s.audio != nil {
+		frame := time.Duration(s.audioEnc.FrameSize()) * time.Second / time.Duration(s.codec.SampleRate)
+		go s.pace(frame, s.writeAudio)
+	}
+
+	return s, nil
+}
+
+// OnFeedback starts a new gop on keyframe requests.
+func (s *Source) OnFeedback(fb deliver.FeedbackMsg) {
+	if fb.Type != deliver.FeedbackTypeVideo {
+		return
+	}
+
+	switch fb.Cmd {
+	case deliver.FeedbackCmdKeyFrame, deliver.FeedbackCmdPLI, deliver.FeedbackCmdFIR:
+		atomic.StoreInt32(&s.keyframe, 1)
+	}
+}
+
+// pace calls write with the numbers of the frames at their time, frames
+// late are written right away so the stream keeps its rate.
+func (s *Source) pace(period time.Duration, write func(n int)) {
+	start := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for n := 0; ; n++ {
+		select {
+		case <-s.Context().Done():
+			return
+		case <-timer.C:
+		}
+
+		write(n)
+		timer.Reset(time.Until(start.Add(time.Duration(n+1) * period)))
+	}
+}
+
+func (s *Source) writeVideo(n int) {
+	keyframe := n%s.opts.GOP == 0 || atomic.CompareAndSwapInt32(&s.keyframe, 1, 0)
+	au := s.encoder.Encode(s.bars.Picture(n), keyframe)
+
+	s.deliver(s.video, deliver.Frame{
+		Codec:          deliver.CodecTypeH264,
+		PacketType:     deliver.PacketTypeRaw,
+		Payload:        au,
+		Length:         len(au),
+		TimeStamp:      uint32(int64(n) * videoClockRate / int64(s.opts.FPS)),
+		AdditionalInfo: &deliver.VideoFrameSpecificInfo{IsKeyFrame: keyframe},
+	})
+}
+
+func (s *Source) writeAudio(n int) {
+	size := s.audioEnc.FrameSize()
+	payload, err := s.audioEnc.Encode(Tone(n*size, size, s.opts.ToneHz, s.codec.SampleRate, s.codec.Channels))
+	if err != nil {
+		s.logger.WithError(err).Warn("tone not encoded")
+		return
+	}
+
+	s.deliver(s.audio, deliver.Frame{
+		Codec:      s.opts.Audio,
+		PacketType: deliver.PacketTypeRaw,
+		Payload:    payload,
+		Length:     len(payload),
+		TimeStamp:  uint32(n * size),
+	})
+}
+
+func (s *Source) deliver(packetizer *rtclib.Packetizer, frame deliver.Frame) {
+	for _, f := range packetizer.Packetize(frame) {
+		s.FrameSource.DeliverFrame(f, nil)
+	}
+}
+
+// Tone returns count samples of a sine of hz from sample start on,
+// interleaved over channels.
+func Tone(start, count, hz int, rate uint32, channels int) []int16 {
+	pcm := make([]int16, count*channels)
+	for i := 0; i < count; i++ {
+		// the phase of the sample, exact however long the tone plays
+		phase := float64((start+i)%int(rate)*hz%int(rate)) / float64(rate)
+		v := int16(toneAmplitude * math.MaxInt16 * math.Sin(2*math.Pi*phase))
+		for c := 0; c < channels; c++ {
+			pcm[i*channels+c] = v
+		}
+	}
+
+	return pcm
+}
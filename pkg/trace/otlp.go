@@ -0,0 +1,94 @@
+package trace
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/pingostack/neon/pkg/logger"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+var ErrInvalidEndpoint = errors.New("invalid otlp endpoint")
+
+type OTLPOptions struct {
+	// Endpoint is the full OTLP/HTTP traces url, e.g. http://127.0.0.1:4318/v1/traces
+	Endpoint    string
+	Headers     map[string]string
+	ServiceName string
+	// SampleRatio is the fraction of root traces sampled, child spans follow
+	// the decision of their parent.
+	SampleRatio float64
+	// BatchSize, FlushInterval and QueueSize are the batching of the sdk,
+	// its defaults when 0.
+	BatchSize     int
+	FlushInterval time.Duration
+	QueueSize     int
+	Logger        logger.Logger
+}
+
+// SetupOTLP installs a tracer provider exporting spans with OTLP/HTTP as the
+// global one, with the W3C trace context propagator. The provider is shut
+// down to flush the spans left.
+func SetupOTLP(ctx context.Context, opts OTLPOptions) (*sdktrace.TracerProvider, error) {
+	u, err := url.Parse(opts.Endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, errors.Wrapf(ErrInvalidEndpoint, "%s", opts.Endpoint)
+	}
+
+	if opts.ServiceName == "" {
+		opts.ServiceName = "neon"
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = logger.DefaultLogger
+	}
+
+	clientOpts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithHeaders(opts.Headers),
+	}
+	if u.Path != "" {
+		clientOpts = append(clientOpts, otlptracehttp.WithURLPath(u.Path))
+	}
+	if u.Scheme == "http" {
+		clientOpts = append(clientOpts, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(ctx, clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	var batchOpts []sdktrace.BatchSpanProcessorOption
+	if opts.BatchSize > 0 {
+		batchOpts = append(batchOpts, sdktrace.WithMaxExportBatchSize(opts.BatchSize))
+	}
+	if opts.FlushInterval > 0 {
+		batchOpts = append(batchOpts, sdktrace.WithBatchTimeout(opts.FlushInterval))
+	}
+	if opts.QueueSize > 0 {
+		batchOpts = append(batchOpts, sdktrace.WithMaxQueueSize(opts.QueueSize))
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter, batchOpts...),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(opts.ServiceName))),
+	)
+
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		opts.Logger.Errorf("otlp export failed: %v", err)
+	}))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return provider, nil
+}
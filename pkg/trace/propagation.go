@@ -0,0 +1,20 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Inject writes the trace context of ctx into h with the global propagator,
+// the W3C traceparent once SetupOTLP ran.
+func Inject(ctx context.Context, h http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(h))
+}
+
+// Extract returns ctx carrying the remote span context found in h, if any.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(h))
+}
@@ -0,0 +1,34 @@
+// Package trace starts the spans of neon with the opentelemetry api. They go
+// to the global tracer provider, the one SetupOTLP installs or the one of a
+// program embedding neon, and nowhere before one is installed.
+package trace
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/pingostack/neon"
+
+// Start creates a span as a child of the span carried by ctx.
+func Start(ctx context.Context, name string, opts ...oteltrace.SpanStartOption) (context.Context, oteltrace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// RecordError records err on span and marks it failed, nothing when err is
+// nil.
+func RecordError(span oteltrace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,245 @@
+package transcoder
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/rtclib"
+	"github.com/pion/rtp"
+	"github.com/sirupsen/logrus"
+)
+
+// AudioTarget picks the audio a destination gets when it accepts none of
+// the codec of the source, the first candidate audio can be transcoded to.
+func AudioTarget(src *deliver.Metadata, settings deliver.FormatSettings) (deliver.AudioMetadata, bool) {
+	if src == nil || !src.HasAudio() || len(settings.AudioCandidates) == 0 {
+		return deliver.AudioMetadata{}, false
+	}
+
+	for _, c := range settings.AudioCandidates {
+		if c.CodecType == src.Audio.CodecType {
+			return deliver.AudioMetadata{}, false
+		}
+	}
+
+	for _, c := range settings.AudioCandidates {
+		if CanTranscode(src.Audio.CodecType, c.CodecType) {
+			return c, true
+		}
+	}
+
+	return deliver.AudioMetadata{}, false
+}
+
+// AudioTranscoder is a pipe converting the rtp audio of its source to
+// another codec, video and data are passed.
+type AudioTranscoder struct {
+	*deliver.MediaFramePipeImpl
+	out    deliver.AudioMetadata
+	codec  AudioCodec
+	logger *logrus.Entry
+
+	lock         sync.Mutex
+	in           deliver.CodecType
+	depacketizer *rtclib.Depacketizer
+	decoder      AudioDecoder
+	resampler    *resampler
+	encoder      AudioEncoder
+	packetizer   *rtclib.Packetizer
+	inRate       uint32
+	started      bool
+	lastIn       uint32
+	inOffset     int64
+	// pcm waiting for a full frame of the encoder and the output timestamp
+	// of its first sample
+	pending      []int16
+	pendingStart int64
+}
+
+func NewAudioTranscoder(ctx context.Context, settings deliver.FormatSettings, out deliver.AudioMetadata, logger *logrus.Entry) (*AudioTranscoder, error) {
+	codec, ok := lookupAudioCodec(out.CodecType)
+	if !ok {
+		return nil, ErrTranscoderNotSupported
+	}
+
+	out.SampleRate, out.Channels = codec.SampleRate, uint8(codec.Channels)
+	if out.Codec == "" {
+		out.Codec = out.CodecType.String()
+	}
+
+	encoder, err := codec.NewEncoder()
+	if err != nil {
+		return nil, err
+	}
+
+	packetizer, err := rtclib.NewPacketizer(out.CodecType, out.RtpPayloadType, out.SampleRate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AudioTranscoder{
+		MediaFramePipeImpl: deliver.NewMediaFramePipe(ctx, settings).(*deliver.MediaFramePipeImpl),
+		out:                out,
+		codec:              codec,
+		logger:             logger.WithField("transcode", out.CodecType.String()),
+		encoder:            encoder,
+		packetizer:         packetizer,
+	}, nil
+}
+
+func (t *AudioTranscoder) Label() string {
+	return "audio/" + t.out.CodecType.String()
+}
+
+// OnMetaData announces the output codec, the decoder follows the codec of
+// the source.
+func (t *AudioTranscoder) OnMetaData(metadata *deliver.Metadata) {
+	md := *metadata
+	if md.Audio != nil {
+		t.setInput(md.Audio)
+
+		out := t.out
+		md.Audio = &out
+	}
+
+	t.MediaFramePipeImpl.OnMetaData(&md)
+}
+
+func (t *AudioTranscoder) setInput(am *deliver.AudioMetadata) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.in == am.CodecType {
+		return
+	}
+
+	t.in, t.inRate = am.CodecType, am.SampleRate
+	t.depacketizer, t.decoder, t.resampler = nil, nil, nil
+	t.started, t.pending = false, nil
+
+	if am.CodecType == t.out.CodecType {
+		return
+	}
+
+	codec, ok := lookupAudioCodec(am.CodecType)
+	if !ok {
+		t.logger.WithField("codec", am.CodecType.String()).Warn("audio codec not transcoded")
+		return
+	}
+
+	depacketizer, err := rtclib.NewDepacketizer(am.CodecType, am.SampleRate, am.Channels)
+	if err != nil {
+		t.logger.WithError(err).Warn("audio codec not transcoded")
+		return
+	}
+
+	decoder, err := codec.NewDecoder()
+	if err != nil {
+		t.logger.WithError(err).Warn("audio codec not transcoded")
+		return
+	}
+
+	// rtp of the codecs transcoded is clocked at the sample rate
+	if t.inRate == 0 {
+		t.inRate = codec.SampleRate
+	}
+
+	t.depacketizer, t.decoder = depacketizer, decoder
+	t.resampler = newResampler(int(codec.SampleRate), codec.Channels, int(t.codec.SampleRate), t.codec.Channels)
+}
+
+func (t *AudioTranscoder) OnFrame(frame deliver.Frame, attr deliver.Attributes) {
+	if !frame.Codec.IsAudio() || frame.PacketType != deliver.PacketTypeRtp {
+		t.MediaFramePipeImpl.OnFrame(frame, attr)
+		return
+	}
+
+	src, ok := frame.RawPacket.(*rtp.Packet)
+	if !ok {
+		return
+	}
+
+	frames, pass := t.decode(frame.Codec, src)
+	if pass {
+		t.MediaFramePipeImpl.OnFrame(frame, attr)
+		return
+	}
+
+	for _, f := range frames {
+		t.MediaFramePipeImpl.OnFrame(f, attr)
+	}
+}
+
+// decode returns the frames transcoded from those src completed, true when
+// the frame of src is already in the output codec.
+func (t *AudioTranscoder) decode(codec deliver.CodecType, src *rtp.Packet) ([]deliver.Frame, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if codec == t.out.CodecType {
+		return nil, true
+	}
+
+	if t.depacketizer == nil {
+		return nil, false
+	}
+
+	// the depacketizer keeps packets after the frame was released
+	packet := *src
+	packet.Payload = append([]byte(nil), src.Payload...)
+
+	var frames []deliver.Frame
+	for _, raw := range t.depacketizer.Push(&packet) {
+		frames = append(frames, t.transcode(raw)...)
+	}
+
+	return frames, false
+}
+
+// transcode must be called with t.lock held.
+func (t *AudioTranscoder) transcode(raw deliver.Frame) []deliver.Frame {
+	pcm, err := t.decoder.Decode(raw.Payload)
+	if err != nil {
+		t.logger.WithError(err).Debug("audio decode failed")
+		return nil
+	}
+
+	if !t.started {
+		t.started, t.lastIn = true, raw.TimeStamp
+	}
+	t.inOffset += int64(int32(raw.TimeStamp - t.lastIn))
+	t.lastIn = raw.TimeStamp
+
+	at := t.inOffset * int64(t.codec.SampleRate) / int64(t.inRate)
+	pcm = t.resampler.resample(pcm)
+
+	channels := t.codec.Channels
+	frameSize := t.encoder.FrameSize()
+	expected := t.pendingStart + int64(len(t.pending)/channels)
+	if len(t.pending) == 0 || at-expected > int64(frameSize) || expected-at > int64(frameSize) {
+		// a gap or a jump of the source, the timeline restarts
+		t.pending, t.pendingStart = nil, at
+	}
+	t.pending = append(t.pending, pcm...)
+
+	var frames []deliver.Frame
+	for len(t.pending) >= frameSize*channels {
+		payload, err := t.encoder.Encode(t.pending[:frameSize*channels])
+		if err != nil {
+			t.logger.WithError(err).Debug("audio encode failed")
+			return frames
+		}
+
+		frames = append(frames, t.packetizer.Packetize(deliver.Frame{
+			Codec:     t.out.CodecType,
+			Payload:   payload,
+			TimeStamp: uint32(t.pendingStart),
+		})...)
+
+		t.pending = t.pending[frameSize*channels:]
+		t.pendingStart += int64(frameSize)
+	}
+
+	return frames
+}
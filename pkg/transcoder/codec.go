@@ -0,0 +1,94 @@
+package transcoder
+
+import (
+	"sync"
+
+	"github.com/pingostack/neon/pkg/deliver"
+)
+
+// AudioDecoder decodes the payload of a frame into interleaved 16 bit pcm.
+type AudioDecoder interface {
+	Decode(payload []byte) ([]int16, error)
+}
+
+// AudioEncoder encodes one frame of FrameSize samples per channel.
+type AudioEncoder interface {
+	Encode(pcm []int16) ([]byte, error)
+	FrameSize() int
+}
+
+// AudioCodec describes an audio codec the transcoder can decode and encode,
+// pcm is exchanged at SampleRate with Channels.
+type AudioCodec struct {
+	SampleRate  uint32
+	Channels    int
+	PayloadType uint8
+	NewDecoder  func() (AudioDecoder, error)
+	NewEncoder  func() (AudioEncoder, error)
+}
+
+var (
+	audioCodecs     = make(map[deliver.CodecType]AudioCodec)
+	audioCodecsLock sync.RWMutex
+)
+
+// RegisterAudioCodec makes codec available to transcoders, e.g. opus when
+// built with libopus.
+func RegisterAudioCodec(codec deliver.CodecType, c AudioCodec) {
+	audioCodecsLock.Lock()
+	defer audioCodecsLock.Unlock()
+
+	audioCodecs[codec] = c
+}
+
+func lookupAudioCodec(codec deliver.CodecType) (AudioCodec, bool) {
+	audioCodecsLock.RLock()
+	defer audioCodecsLock.RUnlock()
+
+	c, ok := audioCodecs[codec]
+	return c, ok
+}
+
+// CanTranscode tells whether audio of codec in can be transcoded to out.
+func CanTranscode(in, out deliver.CodecType) bool {
+	if in == out {
+		return true
+	}
+
+	_, inOK := lookupAudioCodec(in)
+	_, outOK := lookupAudioCodec(out)
+
+	return inOK && outOK
+}
+
+// NewAudioEncoder returns an encoder of codec with the codec it takes pcm of,
+// e.g. to publish generated audio.
+func NewAudioEncoder(codec deliver.CodecType) (AudioEncoder, AudioCodec, error) {
+	c, ok := lookupAudioCodec(codec)
+	if !ok || c.NewEncoder == nil {
+		return nil, AudioCodec{}, ErrTranscoderNotSupported
+	}
+
+	encoder, err := c.NewEncoder()
+	if err != nil {
+		return nil, AudioCodec{}, err
+	}
+
+	return encoder, c, nil
+}
+
+// NewAudioDecoder returns a decoder of codec with the codec it gives pcm of,
+// e.g. to mix audio.
+func NewAudioDecoder(codec deliver.CodecType) (AudioDecoder, AudioCodec, error) {
+	c, ok := lookupAudioCodec(codec)
+	if !ok || c.NewDecoder == nil {
+		return nil, AudioCodec{}, ErrTranscoderNotSupported
+	}
+
+	decoder, err := c.NewDecoder()
+	if err != nil {
+		return nil, AudioCodec{}, err
+	}
+
+	return decoder, c, nil
+}
@@ -0,0 +1,143 @@
+package transcoder
+
+import "github.com/pingostack/neon/pkg/deliver"
+
+const (
+	g711SampleRate = 8000
+	// 20ms packets
+	g711FrameSize = 160
+
+	ulawBias = 0x84
+	ulawClip = 32635
+)
+
+var (
+	ulawTable [256]int16
+	alawTable [256]int16
+)
+
+func init() {
+	for i := 0; i < 256; i++ {
+		ulawTable[i] = ulawDecode(byte(i))
+		alawTable[i] = alawDecode(byte(i))
+	}
+
+	RegisterAudioCodec(deliver.CodecTypePCMU, AudioCodec{
+		SampleRate:  g711SampleRate,
+		Channels:    1,
+		PayloadType: 0,
+		NewDecoder:  func() (AudioDecoder, error) { return &g711Codec{table: &ulawTable}, nil },
+		NewEncoder:  func() (AudioEncoder, error) { return &g711Codec{encode: ulawEncode}, nil },
+	})
+
+	RegisterAudioCodec(deliver.CodecTypePCMA, AudioCodec{
+		SampleRate:  g711SampleRate,
+		Channels:    1,
+		PayloadType: 8,
+		NewDecoder:  func() (AudioDecoder, error) { return &g711Codec{table: &alawTable}, nil },
+		NewEncoder:  func() (AudioEncoder, error) { return &g711Codec{encode: alawEncode}, nil },
+	})
+}
+
+// g711Codec is the mu-law or a-law codec of ITU-T G.711.
+type g711Codec struct {
+	table  *[256]int16
+	encode func(int16) byte
+}
+
+func (c *g711Codec) Decode(payload []byte) ([]int16, error) {
+	pcm := make([]int16, len(payload))
+	for i, b := range payload {
+		pcm[i] = c.table[b]
+	}
+
+	return pcm, nil
+}
+
+func (c *g711Codec) Encode(pcm []int16) ([]byte, error) {
+	out := make([]byte, len(pcm))
+	for i, s := range pcm {
+		out[i] = c.encode(s)
+	}
+
+	return out, nil
+}
+
+func (c *g711Codec) FrameSize() int {
+	return g711FrameSize
+}
+
+func ulawEncode(sample int16) byte {
+	s := int32(sample)
+	sign := byte(0)
+	if s < 0 {
+		s, sign = -s, 0x80
+	}
+	if s > ulawClip {
+		s = ulawClip
+	}
+	s += ulawBias
+
+	exponent := byte(7)
+	for mask := int32(0x4000); s&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := byte(s>>(exponent+3)) & 0x0f
+
+	return ^(sign | exponent<<4 | mantissa)
+}
+
+func ulawDecode(u byte) int16 {
+	u = ^u
+	t := (int32(u&0x0f)<<3 + ulawBias) << ((u & 0x70) >> 4)
+	if u&0x80 != 0 {
+		return int16(ulawBias - t)
+	}
+
+	return int16(t - ulawBias)
+}
+
+func alawEncode(sample int16) byte {
+	pcm := int32(sample) >> 3
+	mask := byte(0xd5)
+	if pcm < 0 {
+		mask = 0x55
+		pcm = -pcm - 1
+	}
+
+	seg := byte(0)
+	for end := int32(0x1f); seg < 8 && pcm > end; end = end<<1 | 1 {
+		seg++
+	}
+	if seg >= 8 {
+		return 0x7f ^ mask
+	}
+
+	aval := seg << 4
+	if seg < 2 {
+		aval |= byte(pcm>>1) & 0x0f
+	} else {
+		aval |= byte(pcm>>seg) & 0x0f
+	}
+
+	return aval ^ mask
+}
+
+func alawDecode(a byte) int16 {
+	a ^= 0x55
+	t := int32(a&0x0f) << 4
+	switch seg := (a & 0x70) >> 4; seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t = (t + 0x108) << (seg - 1)
+	}
+
+	if a&0x80 != 0 {
+		return int16(t)
+	}
+
+	return int16(-t)
+}
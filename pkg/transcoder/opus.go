@@ -0,0 +1,112 @@
+//go:build opus && cgo
+
+package transcoder
+
+/*
+#cgo pkg-config: opus
+#include <opus.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"github.com/pingostack/neon/pkg/deliver"
+)
+
+const (
+	opusSampleRate = 48000
+	opusChannels   = 2
+	// 20ms frames
+	opusFrameSize = 960
+	// the longest frame of a packet, 120ms
+	opusMaxFrameSize = 5760
+	opusMaxPacket    = 4000
+)
+
+// built with -tags opus, libopus encodes and decodes opus
+func init() {
+	RegisterAudioCodec(deliver.CodecTypeOpus, AudioCodec{
+		SampleRate:  opusSampleRate,
+		Channels:    opusChannels,
+		PayloadType: 111,
+		NewDecoder:  newOpusDecoder,
+		NewEncoder:  newOpusEncoder,
+	})
+}
+
+type opusDecoder struct {
+	dec *C.OpusDecoder
+}
+
+func newOpusDecoder() (AudioDecoder, error) {
+	var err C.int
+	dec := C.opus_decoder_create(opusSampleRate, opusChannels, &err)
+	if err != C.OPUS_OK {
+		return nil, fmt.Errorf("opus decoder: %s", C.GoString(C.opus_strerror(err)))
+	}
+
+	d := &opusDecoder{dec: dec}
+	runtime.SetFinalizer(d, func(d *opusDecoder) {
+		C.opus_decoder_destroy(d.dec)
+	})
+
+	return d, nil
+}
+
+func (d *opusDecoder) Decode(payload []byte) ([]int16, error) {
+	if len(payload) == 0 {
+		return nil, nil
+	}
+
+	pcm := make([]int16, opusMaxFrameSize*opusChannels)
+	n := C.opus_decode(d.dec, (*C.uchar)(unsafe.Pointer(&payload[0])), C.opus_int32(len(payload)),
+		(*C.opus_int16)(unsafe.Pointer(&pcm[0])), opusMaxFrameSize, 0)
+	runtime.KeepAlive(d)
+	if n < 0 {
+		return nil, fmt.Errorf("opus decode: %s", C.GoString(C.opus_strerror(n)))
+	}
+
+	return pcm[:int(n)*opusChannels], nil
+}
+
+type opusEncoder struct {
+	enc *C.OpusEncoder
+}
+
+func newOpusEncoder() (AudioEncoder, error) {
+	var err C.int
+	enc := C.opus_encoder_create(opusSampleRate, opusChannels, C.OPUS_APPLICATION_VOIP, &err)
+	if err != C.OPUS_OK {
+		return nil, fmt.Errorf("opus encoder: %s", C.GoString(C.opus_strerror(err)))
+	}
+
+	e := &opusEncoder{enc: enc}
+	runtime.SetFinalizer(e, func(e *opusEncoder) {
+		C.opus_encoder_destroy(e.enc)
+	})
+
+	return e, nil
+}
+
+func (e *opusEncoder) Encode(pcm []int16) ([]byte, error) {
+	if len(pcm) < opusFrameSize*opusChannels {
+		return nil, fmt.Errorf("opus encode: short frame of %d samples", len(pcm))
+	}
+
+	out := make([]byte, opusMaxPacket)
+	n := C.opus_encode(e.enc, (*C.opus_int16)(unsafe.Pointer(&pcm[0])), opusFrameSize,
+		(*C.uchar)(unsafe.Pointer(&out[0])), C.opus_int32(len(out)))
+	runtime.KeepAlive(e)
+	if n < 0 {
+		return nil, fmt.Errorf("opus encode: %s", C.GoString(C.opus_strerror(n)))
+	}
+
+	return out[:n], nil
+}
+
+func (e *opusEncoder) FrameSize() int {
+	return opusFrameSize
+}
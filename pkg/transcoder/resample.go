@@ -0,0 +1,115 @@
+package transcoder
+
+// resampler converts interleaved pcm between sample rates and channel
+// counts. Upsampling interpolates linearly, downsampling averages the input
+// samples of every output sample, good enough for voice.
+type resampler struct {
+	inRate, outRate int
+	inChannels      int
+	outChannels     int
+	// position of the next output sample on the input timeline, in units of
+	// 1/outRate input samples
+	pos  int64
+	last []int32
+	sum  []int32
+	n    int32
+}
+
+// Resampler converts interleaved pcm between sample rates and channel
+// counts, see resampler.
+type Resampler interface {
+	Resample(pcm []int16) []int16
+}
+
+func NewResampler(inRate, inChannels, outRate, outChannels int) Resampler {
+	return newResampler(inRate, inChannels, outRate, outChannels)
+}
+
+func newResampler(inRate, inChannels, outRate, outChannels int) *resampler {
+	return &resampler{
+		inRate:      inRate,
+		outRate:     outRate,
+		inChannels:  inChannels,
+		outChannels: outChannels,
+		last:        make([]int32, outChannels),
+		sum:         make([]int32, outChannels),
+	}
+}
+
+// remix returns one frame of the input converted to the output channels.
+func (r *resampler) remix(frame []int16, out []int32) {
+	switch {
+	case r.inChannels == r.outChannels:
+		for c := range out {
+			out[c] = int32(frame[c])
+		}
+	case r.outChannels == 1:
+		var sum int32
+		for _, s := range frame {
+			sum += int32(s)
+		}
+		out[0] = sum / int32(len(frame))
+	default:
+		for c := range out {
+			out[c] = int32(frame[c%len(frame)])
+		}
+	}
+}
+
+func (r *resampler) Resample(pcm []int16) []int16 {
+	return r.resample(pcm)
+}
+
+func (r *resampler) resample(pcm []int16) []int16 {
+	frames := len(pcm) / r.inChannels
+	cur := make([]int32, r.outChannels)
+
+	if r.inRate == r.outRate {
+		out := make([]int16, 0, frames*r.outChannels)
+		for i := 0; i < frames; i++ {
+			r.remix(pcm[i*r.inChannels:(i+1)*r.inChannels], cur)
+			for _, s := range cur {
+				out = append(out, int16(s))
+			}
+		}
+		return out
+	}
+
+	out := make([]int16, 0, frames*r.outRate/r.inRate*r.outChannels+r.outChannels)
+	in, outRate := int64(r.inRate), int64(r.outRate)
+
+	for i := 0; i < frames; i++ {
+		r.remix(pcm[i*r.inChannels:(i+1)*r.inChannels], cur)
+
+		if r.outRate < r.inRate {
+			for c := range cur {
+				r.sum[c] += cur[c]
+			}
+			r.n++
+
+			// one output sample every inRate/outRate input samples
+			r.pos += outRate
+			if r.pos >= in {
+				r.pos -= in
+				for c := range r.sum {
+					out = append(out, int16(r.sum[c]/r.n))
+					r.sum[c] = 0
+				}
+				r.n = 0
+			}
+			continue
+		}
+
+		// output samples between the last input sample and this one
+		for ; r.pos < outRate; r.pos += in {
+			for c := range cur {
+				v := r.last[c] + int32(int64(cur[c]-r.last[c])*r.pos/outRate)
+				out = append(out, int16(v))
+			}
+		}
+		r.pos -= outRate
+		copy(r.last, cur)
+	}
+
+	return out
+}
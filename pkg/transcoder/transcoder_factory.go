@@ -4,11 +4,17 @@ import (
 	"context"
 
 	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/sirupsen/logrus"
 )
 
 func NewTranscoder(ctx context.Context, inCodec, outCodec deliver.CodecType) (Transcoder, error) {
 	if inCodec == outCodec {
 		return NewNoopTranscoder(ctx, inCodec), nil
+	} else if inCodec.IsAudio() && CanTranscode(inCodec, outCodec) {
+		codec, _ := lookupAudioCodec(outCodec)
+		return NewAudioTranscoder(ctx, deliver.FormatSettings{PacketType: deliver.PacketTypeRtp},
+			deliver.AudioMetadata{CodecType: outCodec, RtpPayloadType: codec.PayloadType},
+			logrus.WithField("module", "transcoder"))
 	} else {
 		return nil, ErrTranscoderNotSupported
 	}
@@ -0,0 +1,85 @@
+package udp
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"golang.org/x/net/ipv4"
+)
+
+// batchReader reads with recvmmsg where the platform supports it, ipv4
+// falls back to one datagram per call elsewhere.
+type batchReader struct {
+	s       *Server
+	conn    *net.UDPConn
+	pc      *ipv4.PacketConn
+	msgs    []ipv4.Message
+	done    chan struct{}
+	onclose sync.Once
+}
+
+func newBatchReader(s *Server) (*batchReader, error) {
+	lc := net.ListenConfig{}
+	if s.opt.ReuseAddr || s.opt.ReusePort {
+		lc.Control = reuseControl(s.opt.ReuseAddr, s.opt.ReusePort)
+	}
+
+	pc, err := lc.ListenPacket(context.Background(), "udp", s.addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := pc.(*net.UDPConn)
+
+	if s.opt.SocketRecvBuffer > 0 {
+		conn.SetReadBuffer(s.opt.SocketRecvBuffer)
+	}
+
+	if s.opt.SocketSendBuffer > 0 {
+		conn.SetWriteBuffer(s.opt.SocketSendBuffer)
+	}
+
+	b := &batchReader{
+		s:    s,
+		conn: conn,
+		pc:   ipv4.NewPacketConn(conn),
+		msgs: make([]ipv4.Message, s.opt.BatchSize),
+		done: make(chan struct{}),
+	}
+
+	for i := range b.msgs {
+		b.msgs[i].Buffers = [][]byte{make([]byte, s.opt.MaxPacketSize)}
+	}
+
+	return b, nil
+}
+
+func (b *batchReader) run() error {
+	for {
+		n, err := b.pc.ReadBatch(b.msgs, 0)
+		if err != nil {
+			select {
+			case <-b.done:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		for _, msg := range b.msgs[:n] {
+			addr, ok := msg.Addr.(*net.UDPAddr)
+			if !ok {
+				continue
+			}
+
+			b.s.dispatch(addr, msg.Buffers[0][:msg.N])
+		}
+	}
+}
+
+func (b *batchReader) close() {
+	b.onclose.Do(func() {
+		close(b.done)
+		b.conn.Close()
+	})
+}
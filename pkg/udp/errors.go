@@ -0,0 +1,14 @@
+package udp
+
+import "errors"
+
+var (
+	ErrSessionClosed = errors.New("udp session closed")
+	ErrNilHandler    = errors.New("udp handler is nil")
+	ErrNotRunning    = errors.New("udp server is not running")
+
+	ErrReusePortUnsupported = errors.New("SO_REUSEPORT is not supported on this platform")
+
+	ErrInvalidPortRange = errors.New("invalid udp port range")
+	ErrPortsExhausted   = errors.New("udp port range exhausted")
+)
@@ -0,0 +1,57 @@
+package udp
+
+import (
+	"time"
+
+	"github.com/pingostack/neon/pkg/acl"
+	"github.com/pingostack/neon/pkg/logger"
+)
+
+// IHandler receives the packets of a UDP server demultiplexed per remote
+// address, the same way a connection handler would on TCP.
+type IHandler interface {
+	// OnSession is called for the first packet of a new remote, returning
+	// false drops the packet and forgets the remote.
+	OnSession(s *Session) bool
+	// OnPacket data is only valid during the call.
+	OnPacket(s *Session, data []byte)
+	OnSessionClosed(s *Session)
+}
+
+type Options struct {
+
+	// ReuseAddr indicates whether to set up the SO_REUSEADDR socket option.
+	ReuseAddr bool
+
+	// ReusePort indicates whether to set up the SO_REUSEPORT socket option.
+	ReusePort bool
+
+	// SocketRecvBuffer sets the maximum socket receive buffer in bytes.
+	SocketRecvBuffer int
+
+	// SocketSendBuffer sets the maximum socket send buffer in bytes.
+	SocketSendBuffer int
+
+	// NumEventLoop is the number of gnet event loops.
+	NumEventLoop int
+
+	// Multicore enables/disables the multi-core execution.
+	Multicore bool
+
+	// IdleTimeout closes sessions that have not received a packet for that long.
+	IdleTimeout time.Duration
+
+	// BatchSize > 1 reads with recvmmsg instead of gnet, up to BatchSize
+	// datagrams per syscall.
+	BatchSize int
+
+	// MaxPacketSize is the read buffer size per datagram.
+	MaxPacketSize int
+
+	// ACL filters new remotes, nil accepts everything. A remote is counted
+	// as one connection while its session lasts.
+	ACL *acl.ACL
+
+	// Logger is the logger for the server.
+	Logger logger.Logger
+}
@@ -0,0 +1,192 @@
+package udp
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+type PortSettings struct {
+	Name    string `json:"name" mapstructure:"name"`
+	MinPort int    `json:"minPort" mapstructure:"minPort"`
+	MaxPort int    `json:"maxPort" mapstructure:"maxPort"`
+}
+
+// PortAllocator hands out media ports from one range shared by all protocols.
+// A port is bound before it is handed out, ports taken by other processes are
+// detected that way and skipped.
+type PortAllocator struct {
+	name    string
+	min     int
+	max     int
+	next    int
+	used    map[int]struct{}
+	lock    sync.Mutex
+	logger  *logrus.Entry
+	inUse   *metrics.Gauge
+	failure *metrics.Counter
+}
+
+func NewPortAllocator(settings PortSettings) (*PortAllocator, error) {
+	if settings.MinPort <= 0 || settings.MaxPort > 65535 || settings.MinPort > settings.MaxPort {
+		return nil, fmt.Errorf("%w: %d-%d", ErrInvalidPortRange, settings.MinPort, settings.MaxPort)
+	}
+
+	if settings.Name == "" {
+		settings.Name = "default"
+	}
+
+	return &PortAllocator{
+		name:    settings.Name,
+		min:     settings.MinPort,
+		max:     settings.MaxPort,
+		next:    settings.MinPort,
+		used:    make(map[int]struct{}),
+		logger:  logrus.WithField("obj", "port-allocator").WithField("pool", settings.Name),
+		inUse:   metrics.UDPPortsInUse.With(settings.Name),
+		failure: metrics.UDPPortsExhausted.With(settings.Name),
+	}, nil
+}
+
+// Allocate binds a free port of the range on ip.
+func (pa *PortAllocator) Allocate(network string, ip net.IP) (*net.UDPConn, error) {
+	pa.lock.Lock()
+	defer pa.lock.Unlock()
+
+	for i := 0; i <= pa.max-pa.min; i++ {
+		port := pa.advance(1)
+		if _, ok := pa.used[port]; ok {
+			continue
+		}
+
+		conn, err := net.ListenUDP(network, &net.UDPAddr{IP: ip, Port: port})
+		if err != nil {
+			pa.logger.WithError(err).WithField("port", port).Debug("port in use outside the allocator")
+			continue
+		}
+
+		pa.take(port)
+
+		return conn, nil
+	}
+
+	return nil, pa.exhausted()
+}
+
+// AllocatePair binds an even RTP port and the following RTCP port.
+func (pa *PortAllocator) AllocatePair(network string, ip net.IP) (rtpConn, rtcpConn *net.UDPConn, err error) {
+	pa.lock.Lock()
+	defer pa.lock.Unlock()
+
+	if pa.next%2 != 0 {
+		pa.advance(1)
+	}
+
+	for i := 0; i <= (pa.max-pa.min)/2; i++ {
+		port := pa.advance(2)
+		if port%2 != 0 || port+1 > pa.max {
+			continue
+		}
+
+		if _, ok := pa.used[port]; ok {
+			continue
+		}
+
+		if _, ok := pa.used[port+1]; ok {
+			continue
+		}
+
+		rtpConn, err = net.ListenUDP(network, &net.UDPAddr{IP: ip, Port: port})
+		if err != nil {
+			continue
+		}
+
+		rtcpConn, err = net.ListenUDP(network, &net.UDPAddr{IP: ip, Port: port + 1})
+		if err != nil {
+			rtpConn.Close()
+			continue
+		}
+
+		pa.take(port)
+		pa.take(port + 1)
+
+		return rtpConn, rtcpConn, nil
+	}
+
+	return nil, nil, pa.exhausted()
+}
+
+// Release returns ports to the range, the caller closes the sockets.
+func (pa *PortAllocator) Release(ports ...int) {
+	pa.lock.Lock()
+	defer pa.lock.Unlock()
+
+	for _, port := range ports {
+		if _, ok := pa.used[port]; !ok {
+			continue
+		}
+
+		delete(pa.used, port)
+		pa.inUse.Dec()
+	}
+}
+
+func (pa *PortAllocator) InUse() int {
+	pa.lock.Lock()
+	defer pa.lock.Unlock()
+
+	return len(pa.used)
+}
+
+func (pa *PortAllocator) Capacity() int {
+	return pa.max - pa.min + 1
+}
+
+func (pa *PortAllocator) Range() (min, max int) {
+	return pa.min, pa.max
+}
+
+func (pa *PortAllocator) advance(step int) int {
+	port := pa.next
+	pa.next += step
+	if pa.next > pa.max {
+		pa.next = pa.min + (pa.next-pa.min)%step
+	}
+
+	return port
+}
+
+func (pa *PortAllocator) take(port int) {
+	pa.used[port] = struct{}{}
+	pa.inUse.Inc()
+}
+
+func (pa *PortAllocator) exhausted() error {
+	pa.failure.Inc()
+	pa.logger.WithField("inUse", len(pa.used)).Error("udp port range exhausted")
+
+	return fmt.Errorf("%w: %s %d-%d, %d in use", ErrPortsExhausted, pa.name, pa.min, pa.max, len(pa.used))
+}
+
+var (
+	defaultPorts     *PortAllocator
+	defaultPortsLock sync.RWMutex
+)
+
+func SetDefaultPorts(pa *PortAllocator) {
+	defaultPortsLock.Lock()
+	defer defaultPortsLock.Unlock()
+
+	defaultPorts = pa
+}
+
+// DefaultPorts is the allocator configured by the ports module, nil if none.
+func DefaultPorts() *PortAllocator {
+	defaultPortsLock.RLock()
+	defer defaultPortsLock.RUnlock()
+
+	return defaultPorts
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+package udp
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// reuseControl sets SO_REUSEADDR and SO_REUSEPORT on the socket of the batch
+// reader, as gnet does on its own.
+func reuseControl(reuseAddr, reusePort bool) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var serr error
+		err := c.Control(func(fd uintptr) {
+			if reuseAddr {
+				serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1)
+			}
+			if serr == nil && reusePort {
+				serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		return serr
+	}
+}
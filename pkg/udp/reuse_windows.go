@@ -0,0 +1,24 @@
+//go:build windows
+// +build windows
+
+package udp
+
+import "syscall"
+
+func reuseControl(reuseAddr, reusePort bool) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		if reusePort {
+			return ErrReusePortUnsupported
+		}
+
+		var serr error
+		err := c.Control(func(fd uintptr) {
+			serr = syscall.SetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+		})
+		if err != nil {
+			return err
+		}
+
+		return serr
+	}
+}
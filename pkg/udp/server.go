@@ -0,0 +1,276 @@
+package udp
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/panjf2000/gnet"
+	"github.com/pingostack/neon/pkg/logger"
+)
+
+const (
+	defaultMaxPacketSize = 1500
+	sweepInterval        = time.Second
+)
+
+// Server is a UDP listener that demultiplexes datagrams into sessions, one per
+// remote address, so RTP/RTCP, RTSP over UDP and SRT do not each need raw
+// socket code.
+type Server struct {
+	gnet.EventServer
+	handler  IHandler
+	opt      Options
+	addr     string
+	lock     sync.RWMutex
+	sessions map[string]*Session
+	conn     net.PacketConn
+	running  int32
+	batch    *batchReader
+}
+
+func NewServer(handler IHandler, addr string, opt Options) (*Server, error) {
+	if handler == nil {
+		return nil, ErrNilHandler
+	}
+
+	if opt.Logger == nil {
+		opt.Logger = logger.DefaultLogger
+	}
+
+	if opt.MaxPacketSize <= 0 {
+		opt.MaxPacketSize = defaultMaxPacketSize
+	}
+
+	return &Server{
+		handler:  handler,
+		opt:      opt,
+		addr:     addr,
+		sessions: make(map[string]*Session),
+	}, nil
+}
+
+// Run blocks until the server is shut down.
+func (s *Server) Run() error {
+	if s.opt.BatchSize > 1 {
+		return s.runBatch()
+	}
+
+	opt := gnet.Options{
+		ReusePort:        s.opt.ReusePort,
+		ReuseAddr:        s.opt.ReuseAddr,
+		SocketRecvBuffer: s.opt.SocketRecvBuffer,
+		SocketSendBuffer: s.opt.SocketSendBuffer,
+		Multicore:        s.opt.Multicore,
+		NumEventLoop:     s.opt.NumEventLoop,
+		Ticker:           s.opt.IdleTimeout > 0,
+	}
+
+	s.opt.Logger.Infof("udp server is running on %s", s.addr)
+
+	return gnet.Serve(s, "udp://"+s.addr, gnet.WithOptions(opt))
+}
+
+func (s *Server) runBatch() error {
+	b, err := newBatchReader(s)
+	if err != nil {
+		return err
+	}
+
+	s.batch = b
+	s.conn = b.conn
+	atomic.StoreInt32(&s.running, 1)
+
+	if s.opt.IdleTimeout > 0 {
+		go s.sweepLoop(b.done)
+	}
+
+	s.opt.Logger.Infof("udp server is running on %s, batch size %d", s.addr, s.opt.BatchSize)
+
+	return b.run()
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	if atomic.LoadInt32(&s.running) == 0 {
+		return ErrNotRunning
+	}
+
+	if s.batch != nil {
+		s.batch.close()
+	} else if err := gnet.Stop(ctx, "udp://"+s.addr); err != nil {
+		return err
+	}
+
+	s.closeAll()
+
+	return nil
+}
+
+func (s *Server) OnInitComplete(gs gnet.Server) (action gnet.Action) {
+	// sessions write through a dup of the listener, gnet's UDP conn is only valid inside React
+	fd, err := gs.DupFd()
+	if err != nil {
+		s.opt.Logger.Errorf("udp dup fd failed: %v", err)
+		return gnet.Shutdown
+	}
+
+	f := os.NewFile(uintptr(fd), "udp-listener")
+	defer f.Close()
+
+	s.conn, err = net.FilePacketConn(f)
+	if err != nil {
+		s.opt.Logger.Errorf("udp file conn failed: %v", err)
+		return gnet.Shutdown
+	}
+
+	atomic.StoreInt32(&s.running, 1)
+
+	return
+}
+
+func (s *Server) OnShutdown(gs gnet.Server) {
+	s.closeAll()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+func (s *Server) React(packet []byte, c gnet.Conn) (out []byte, action gnet.Action) {
+	addr, ok := c.RemoteAddr().(*net.UDPAddr)
+	if !ok {
+		return
+	}
+
+	// gnet recycles the address and the packet buffer after React returns
+	s.dispatch(copyAddr(addr), packet)
+
+	return
+}
+
+func (s *Server) Tick() (delay time.Duration, action gnet.Action) {
+	s.sweep(time.Now())
+	return sweepInterval, gnet.None
+}
+
+func (s *Server) dispatch(addr *net.UDPAddr, packet []byte) {
+	key := addr.String()
+	now := time.Now()
+
+	s.lock.RLock()
+	session, found := s.sessions[key]
+	s.lock.RUnlock()
+
+	if !found {
+		release, err := s.opt.ACL.Acquire(key)
+		if err != nil {
+			s.opt.Logger.Debugf("udp remote %s refused: %v", key, err)
+			return
+		}
+
+		session = newSession(addr, key, s.conn)
+		session.release = release
+		if !s.handler.OnSession(session) {
+			release()
+			return
+		}
+
+		// the event loops read the same remote concurrently, the first
+		// session stored is kept
+		s.lock.Lock()
+		winner, found := s.sessions[key]
+		if !found {
+			s.sessions[key] = session
+		}
+		s.lock.Unlock()
+
+		if found {
+			s.closeSession(session)
+			session = winner
+		}
+	}
+
+	session.touch(now)
+	s.handler.OnPacket(session, packet)
+}
+
+// CloseSession forgets a remote, the next datagram from it opens a new session.
+func (s *Server) CloseSession(session *Session) {
+	s.lock.Lock()
+	if s.sessions[session.key] == session {
+		delete(s.sessions, session.key)
+	}
+	s.lock.Unlock()
+
+	s.closeSession(session)
+}
+
+func (s *Server) closeSession(session *Session) {
+	if atomic.CompareAndSwapInt32(&session.closed, 0, 1) {
+		session.release()
+		s.handler.OnSessionClosed(session)
+	}
+}
+
+func (s *Server) SessionCount() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return len(s.sessions)
+}
+
+func (s *Server) sweepLoop(done <-chan struct{}) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			s.sweep(now)
+		}
+	}
+}
+
+func (s *Server) sweep(now time.Time) {
+	if s.opt.IdleTimeout <= 0 {
+		return
+	}
+
+	var idle []*Session
+	s.lock.RLock()
+	for _, session := range s.sessions {
+		if session.idle(now) > s.opt.IdleTimeout {
+			idle = append(idle, session)
+		}
+	}
+	s.lock.RUnlock()
+
+	for _, session := range idle {
+		s.opt.Logger.Debugf("udp session %s idle, closing", session.key)
+		s.CloseSession(session)
+	}
+}
+
+func (s *Server) closeAll() {
+	s.lock.RLock()
+	sessions := make([]*Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.lock.RUnlock()
+
+	for _, session := range sessions {
+		s.CloseSession(session)
+	}
+}
+
+func copyAddr(addr *net.UDPAddr) *net.UDPAddr {
+	ip := make(net.IP, len(addr.IP))
+	copy(ip, addr.IP)
+
+	return &net.UDPAddr{IP: ip, Port: addr.Port, Zone: addr.Zone}
+}
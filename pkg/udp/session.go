@@ -0,0 +1,75 @@
+package udp
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Session struct {
+	remote     *net.UDPAddr
+	key        string
+	conn       net.PacketConn
+	lastActive int64
+	lock       sync.RWMutex
+	ctx        interface{}
+	closed     int32
+	// gives the connection of the remote back to the acl
+	release func()
+}
+
+func newSession(remote *net.UDPAddr, key string, conn net.PacketConn) *Session {
+	return &Session{
+		remote:     remote,
+		key:        key,
+		conn:       conn,
+		lastActive: time.Now().UnixNano(),
+		release:    func() {},
+	}
+}
+
+func (s *Session) RemoteAddr() net.Addr {
+	return s.remote
+}
+
+func (s *Session) LocalAddr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+func (s *Session) Context() interface{} {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.ctx
+}
+
+func (s *Session) SetContext(ctx interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.ctx = ctx
+}
+
+// Write sends a datagram to the remote, it is safe for concurrent use.
+func (s *Session) Write(data []byte) error {
+	if s.Closed() {
+		return ErrSessionClosed
+	}
+
+	_, err := s.conn.WriteTo(data, s.remote)
+
+	return err
+}
+
+func (s *Session) Closed() bool {
+	return atomic.LoadInt32(&s.closed) == 1
+}
+
+func (s *Session) touch(now time.Time) {
+	atomic.StoreInt64(&s.lastActive, now.UnixNano())
+}
+
+func (s *Session) idle(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&s.lastActive)))
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"path"
+	"strings"
+)
+
+// MatchStreamPath matches a stream path against a path.Match pattern, a
+// trailing "/**" matches any sub path and "**" matches everything.
+func MatchStreamPath(pattern, streamPath string) bool {
+	pattern = strings.Trim(pattern, "/")
+	streamPath = strings.Trim(streamPath, "/")
+
+	if pattern == "**" || pattern == "*" && !strings.Contains(streamPath, "/") {
+		return true
+	}
+
+	if strings.HasSuffix(pattern, "/**") {
+		prefix := strings.TrimSuffix(pattern, "/**")
+		if ok, _ := path.Match(prefix, streamPath); ok {
+			return true
+		}
+
+		parts := strings.Split(streamPath, "/")
+		for i := 1; i < len(parts); i++ {
+			if ok, _ := path.Match(prefix, strings.Join(parts[:i], "/")); ok {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	ok, _ := path.Match(pattern, streamPath)
+	return ok
+}
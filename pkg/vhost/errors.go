@@ -0,0 +1,10 @@
+package vhost
+
+import "errors"
+
+var (
+	ErrInvalidTenant  = errors.New("invalid tenant")
+	ErrUnknownTenant  = errors.New("unknown tenant")
+	ErrTenantMismatch = errors.New("tenant of the credentials does not match the host")
+	ErrQuotaExceeded  = errors.New("quota exceeded")
+)
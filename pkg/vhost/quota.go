@@ -0,0 +1,178 @@
+package vhost
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Counter string
+
+const (
+	CounterStreams Counter = "streams"
+	CounterViewers Counter = "viewers"
+	CounterEgress  Counter = "egress"
+)
+
+// QuotaLimit is the limit of a counter, 0 leaves it unlimited. Reaching Soft
+// emits a warning, new sessions are rejected once the counter reached Hard.
+type QuotaLimit struct {
+	Soft uint64 `json:"soft" mapstructure:"soft"`
+	Hard uint64 `json:"hard" mapstructure:"hard"`
+}
+
+type QuotaSettings struct {
+	// Streams counts the publishers of the tenant.
+	Streams QuotaLimit `json:"streams" mapstructure:"streams"`
+	// Viewers counts the subscribers of the tenant.
+	Viewers QuotaLimit `json:"viewers" mapstructure:"viewers"`
+	// Egress counts the bytes sent to subscribers in the calendar month.
+	Egress QuotaLimit `json:"egress" mapstructure:"egress"`
+}
+
+// Warning tells a counter of a tenant reached its soft limit.
+type Warning struct {
+	Tenant  string
+	Counter Counter
+	Value   uint64
+	Limit   QuotaLimit
+}
+
+type Usage struct {
+	Streams uint64 `json:"streams"`
+	Viewers uint64 `json:"viewers"`
+	Egress  uint64 `json:"egress"`
+	// Period is the month of Egress, e.g. "2024-05".
+	Period string `json:"period"`
+}
+
+// usage holds the counters of a tenant, it survives a reload of the
+// settings of a tenant keeping its name.
+type usage struct {
+	streams uint64
+	viewers uint64
+	egress  uint64
+	period  int32
+
+	lock   sync.Mutex
+	warned map[Counter]bool
+}
+
+func newUsage() *usage {
+	return &usage{
+		period: period(time.Now()),
+		warned: make(map[Counter]bool),
+	}
+}
+
+func period(t time.Time) int32 {
+	return int32(t.Year()*12 + int(t.Month()) - 1)
+}
+
+// rollover restarts the egress of a new month.
+func (u *usage) rollover() {
+	p := period(time.Now())
+	if atomic.LoadInt32(&u.period) == p {
+		return
+	}
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.period != p {
+		atomic.StoreUint64(&u.egress, 0)
+		atomic.StoreInt32(&u.period, p)
+		u.warned[CounterEgress] = false
+	}
+}
+
+// Acquire counts a new publisher or subscriber of the tenant, the returned
+// function releases it. It fails with ErrQuotaExceeded once a hard limit was
+// reached.
+func (t *Tenant) Acquire(producer bool) (func(), error) {
+	if t == nil {
+		return func() {}, nil
+	}
+
+	counter, value, limit := CounterViewers, &t.usage.viewers, t.Quota.Viewers
+	if producer {
+		counter, value, limit = CounterStreams, &t.usage.streams, t.Quota.Streams
+	} else {
+		t.usage.rollover()
+		if egress := atomic.LoadUint64(&t.usage.egress); t.Quota.Egress.Hard > 0 && egress >= t.Quota.Egress.Hard {
+			return nil, fmt.Errorf("%w: %s of %s", ErrQuotaExceeded, CounterEgress, t.Name)
+		}
+	}
+
+	for {
+		n := atomic.LoadUint64(value)
+		if limit.Hard > 0 && n >= limit.Hard {
+			return nil, fmt.Errorf("%w: %s of %s", ErrQuotaExceeded, counter, t.Name)
+		}
+
+		if atomic.CompareAndSwapUint64(value, n, n+1) {
+			t.check(counter, n+1, limit)
+			break
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.check(counter, atomic.AddUint64(value, ^uint64(0)), limit)
+		})
+	}, nil
+}
+
+// AddEgress charges n bytes sent to a subscriber of the tenant.
+func (t *Tenant) AddEgress(n uint64) {
+	if t == nil || n == 0 {
+		return
+	}
+
+	t.usage.rollover()
+	egress := atomic.AddUint64(&t.usage.egress, n)
+	if limit := t.Quota.Egress; limit.Soft > 0 && egress >= limit.Soft && egress-n < limit.Soft {
+		t.check(CounterEgress, egress, limit)
+	}
+}
+
+func (t *Tenant) Usage() Usage {
+	if t == nil {
+		return Usage{}
+	}
+
+	t.usage.rollover()
+	p := atomic.LoadInt32(&t.usage.period)
+
+	return Usage{
+		Streams: atomic.LoadUint64(&t.usage.streams),
+		Viewers: atomic.LoadUint64(&t.usage.viewers),
+		Egress:  atomic.LoadUint64(&t.usage.egress),
+		Period:  fmt.Sprintf("%04d-%02d", p/12, p%12+1),
+	}
+}
+
+// check warns once when the counter reaches the soft limit, again once it
+// dropped below it and reached it anew.
+func (t *Tenant) check(counter Counter, value uint64, limit QuotaLimit) {
+	if limit.Soft == 0 {
+		return
+	}
+
+	t.usage.lock.Lock()
+	reached := value >= limit.Soft
+	warn := reached && !t.usage.warned[counter]
+	t.usage.warned[counter] = reached
+	t.usage.lock.Unlock()
+
+	if warn && t.onWarning != nil {
+		t.onWarning(Warning{
+			Tenant:  t.Name,
+			Counter: counter,
+			Value:   value,
+			Limit:   limit,
+		})
+	}
+}
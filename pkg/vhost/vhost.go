@@ -0,0 +1,235 @@
+// Package vhost scopes streams, auth, limits and recording by tenant. A
+// tenant is a namespace of the core, clients are assigned to it by the host
+// they connect to, the first segment of the stream path or the tenant their
+// credentials name.
+package vhost
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/pkg/ratelimit"
+)
+
+const defaultBurst = 500 * time.Millisecond
+
+type LimitSettings struct {
+	// Bitrate caps the egress of all sessions of the tenant, bps.
+	Bitrate uint64 `json:"bitrate" mapstructure:"bitrate"`
+	// SessionBitrate caps the egress of each session of the tenant.
+	SessionBitrate uint64 `json:"sessionBitrate" mapstructure:"sessionBitrate"`
+}
+
+type RecordSettings struct {
+	// Streams of the tenant recorded while published, stream path patterns
+	// within the tenant. The streams of the record module apply when empty.
+	Streams []string `json:"streams" mapstructure:"streams"`
+	// Disable turns recording off for the tenant.
+	Disable bool `json:"disable" mapstructure:"disable"`
+}
+
+type TenantSettings struct {
+	Name string `json:"name" mapstructure:"name"`
+	// Hosts are the hostnames of the tenant, "*.example.com" matches any
+	// subdomain.
+	Hosts []string `json:"hosts" mapstructure:"hosts"`
+	// Providers are the auth providers allowed for the tenant, names of
+	// providers of the auth module. All when empty.
+	Providers []string       `json:"providers" mapstructure:"providers"`
+	Limits    LimitSettings  `json:"limits" mapstructure:"limits"`
+	Quota     QuotaSettings  `json:"quota" mapstructure:"quota"`
+	Record    RecordSettings `json:"record" mapstructure:"record"`
+}
+
+type Settings struct {
+	Enable bool `json:"enable" mapstructure:"enable"`
+	// Prefix takes the tenant of a client whose host names none from the
+	// first segment of the stream path, acme/live/cam is live/cam of acme.
+	Prefix  bool             `json:"prefix" mapstructure:"prefix"`
+	Tenants []TenantSettings `json:"tenants" mapstructure:"tenants"`
+}
+
+// Tenant is a configured tenant, its egress bucket is shared by all of its
+// sessions.
+type Tenant struct {
+	TenantSettings
+	egress    *ratelimit.TokenBucket
+	usage     *usage
+	onWarning func(Warning)
+}
+
+// Limiter returns the limiter of a new session of the tenant, nil when the
+// tenant has no limits.
+func (t *Tenant) Limiter() ratelimit.Group {
+	if t == nil {
+		return nil
+	}
+
+	var g ratelimit.Group
+	if t.egress != nil {
+		g = append(g, t.egress)
+	}
+
+	if t.Limits.SessionBitrate > 0 {
+		g = append(g, ratelimit.NewTokenBucket(t.Limits.SessionBitrate, defaultBurst))
+	}
+
+	return g
+}
+
+type Manager struct {
+	settings Settings
+	tenants  map[string]*Tenant
+	ordered  []*Tenant
+}
+
+func NewManager(settings Settings) (*Manager, error) {
+	m := &Manager{
+		settings: settings,
+		tenants:  make(map[string]*Tenant, len(settings.Tenants)),
+	}
+
+	for _, ts := range settings.Tenants {
+		if ts.Name == "" || strings.ContainsAny(ts.Name, "/ ") {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTenant, ts.Name)
+		}
+
+		if _, found := m.tenants[ts.Name]; found {
+			return nil, fmt.Errorf("%w: %q configured twice", ErrInvalidTenant, ts.Name)
+		}
+
+		t := &Tenant{TenantSettings: ts, usage: newUsage()}
+		for i, h := range t.Hosts {
+			t.Hosts[i] = strings.ToLower(h)
+		}
+		if ts.Limits.Bitrate > 0 {
+			t.egress = ratelimit.NewTokenBucket(ts.Limits.Bitrate, defaultBurst)
+		}
+
+		m.tenants[ts.Name] = t
+		m.ordered = append(m.ordered, t)
+	}
+
+	return m, nil
+}
+
+// Adopt takes over the quota counters of the tenants of prev, the manager of
+// the settings before a reload, the sessions counted keep being released.
+func (m *Manager) Adopt(prev *Manager) {
+	if m == nil || prev == nil {
+		return
+	}
+
+	for name, t := range m.tenants {
+		if pt, found := prev.tenants[name]; found {
+			t.usage = pt.usage
+		}
+	}
+}
+
+// OnWarning sets the function called when a counter of a tenant reaches its
+// soft limit.
+func (m *Manager) OnWarning(f func(Warning)) {
+	for _, t := range m.ordered {
+		t.onWarning = f
+	}
+}
+
+func (m *Manager) Enabled() bool {
+	return m != nil && m.settings.Enable
+}
+
+func (m *Manager) Tenant(name string) (*Tenant, bool) {
+	if !m.Enabled() {
+		return nil, false
+	}
+
+	t, found := m.tenants[name]
+	return t, found
+}
+
+func (m *Manager) Tenants() []*Tenant {
+	if !m.Enabled() {
+		return nil
+	}
+
+	return m.ordered
+}
+
+// Resolve returns the tenant of a client connecting to host for path, and
+// the path within the tenant. claim is the tenant the credentials of the
+// client name, if any, it must agree with the host. A nil tenant leaves the
+// client to the namespaces of the core.
+func (m *Manager) Resolve(host, path, claim string) (*Tenant, string, error) {
+	if !m.Enabled() {
+		return nil, path, nil
+	}
+
+	t := m.byHost(host)
+	if t == nil && m.settings.Prefix {
+		if i := strings.IndexByte(path, '/'); i > 0 {
+			if pt, found := m.tenants[path[:i]]; found {
+				t, path = pt, path[i+1:]
+			}
+		}
+	}
+
+	if claim == "" {
+		return t, path, nil
+	}
+
+	if t != nil && t.Name != claim {
+		return nil, path, ErrTenantMismatch
+	}
+
+	ct, found := m.tenants[claim]
+	if !found {
+		return nil, path, fmt.Errorf("%w: %q", ErrUnknownTenant, claim)
+	}
+
+	return ct, path, nil
+}
+
+func (m *Manager) byHost(host string) *Tenant {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	if host == "" {
+		return nil
+	}
+
+	for _, t := range m.ordered {
+		for _, h := range t.Hosts {
+			if h == host || (strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:])) {
+				return t
+			}
+		}
+	}
+
+	return nil
+}
+
+var (
+	defaultManager *Manager
+	defaultLock    sync.RWMutex
+)
+
+func SetDefault(m *Manager) {
+	defaultLock.Lock()
+	defer defaultLock.Unlock()
+
+	defaultManager = m
+}
+
+// Default returns the manager of the vhost module, nil without one, which
+// leaves every client without a tenant.
+func Default() *Manager {
+	defaultLock.RLock()
+	defer defaultLock.RUnlock()
+
+	return defaultManager
+}
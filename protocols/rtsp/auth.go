@@ -0,0 +1,51 @@
+package rtsp
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+func streamPath(rawURL string) string {
+	var u Url
+	if err := u.Parse(rawURL); err != nil {
+		return ""
+	}
+
+	return strings.Trim(u.Path, "/")
+}
+
+func streamHost(rawURL string) string {
+	var u Url
+	if err := u.Parse(rawURL); err != nil {
+		return ""
+	}
+
+	return u.Host
+}
+
+func queryToken(rawURL string) string {
+	return queryArgs(rawURL)["token"]
+}
+
+func queryArgs(rawURL string) map[string]string {
+	var u Url
+	if err := u.Parse(rawURL); err != nil {
+		return map[string]string{}
+	}
+
+	return u.GetArgs()
+}
+
+func parseBasic(header string) (username, password string, ok bool) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(header[6:]))
+	if err != nil {
+		return "", "", false
+	}
+
+	i := strings.Index(string(b), ":")
+	if i < 0 {
+		return "", "", false
+	}
+
+	return string(b[:i]), string(b[i+1:]), true
+}
@@ -0,0 +1,127 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/pion/sdp/v3"
+)
+
+// RequireBackchannel is the feature tag of the ONVIF audio backchannel, a
+// client requiring it sends audio to the server on the sendonly media of
+// the description, e.g. to talk through the speaker of a camera.
+const RequireBackchannel = "www.onvif.org/ver20/backchannel"
+
+// BackchannelControl is the control url of the media servers append to the
+// description of clients requiring the backchannel.
+const BackchannelControl = "backchannel"
+
+// BackchannelFormat is an audio format accepted on the backchannel.
+type BackchannelFormat struct {
+	PayloadType uint8
+	// Codec is the encoding name, e.g. PCMU.
+	Codec     string
+	ClockRate uint32
+	Channels  int
+}
+
+// IBackchannelListener is implemented by session listeners that accept the
+// backchannel.
+type IBackchannelListener interface {
+	// OnBackchannel returns the formats accepted from the client, an error
+	// refuses the backchannel.
+	OnBackchannel(serv *Serv) ([]BackchannelFormat, error)
+	// OnBackchannelPacket receives the rtp sent by the client.
+	OnBackchannelPacket(serv *Serv, packet []byte)
+}
+
+// requireTags are the feature tags of the Require header of a request.
+func requireTags(req *Request) []string {
+	tags := make([]string, 0)
+	for _, tag := range strings.Split(req.GetLine("require"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// appendBackchannel adds the backchannel media to the description desc,
+// ONVIF marks it sendonly from the view of the client.
+func appendBackchannel(desc string, formats []BackchannelFormat) (string, error) {
+	var sd sdp.SessionDescription
+	if err := sd.Unmarshal([]byte(desc)); err != nil {
+		return "", err
+	}
+
+	md := &sdp.MediaDescription{
+		MediaName: sdp.MediaName{
+			Media:  "audio",
+			Protos: []string{"RTP", "AVP"},
+		},
+	}
+
+	for _, f := range formats {
+		rtpmap := fmt.Sprintf("%d %s/%d", f.PayloadType, f.Codec, f.ClockRate)
+		if f.Channels > 1 {
+			rtpmap += fmt.Sprintf("/%d", f.Channels)
+		}
+
+		md.MediaName.Formats = append(md.MediaName.Formats, fmt.Sprint(f.PayloadType))
+		md.WithValueAttribute("rtpmap", rtpmap)
+	}
+
+	md.WithValueAttribute("control", BackchannelControl)
+	md.WithPropertyAttribute(sdp.AttrKeySendOnly)
+	sd.MediaDescriptions = append(sd.MediaDescriptions, md)
+
+	out, err := sd.Marshal()
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+// BackchannelMedia finds the media of a description the client sends audio
+// on, what a server requiring the backchannel described as sendonly.
+func BackchannelMedia(sd *sdp.SessionDescription) (*sdp.MediaDescription, bool) {
+	for _, md := range sd.MediaDescriptions {
+		if md.MediaName.Media != "audio" {
+			continue
+		}
+
+		if _, ok := md.Attribute(sdp.AttrKeySendOnly); ok {
+			return md, true
+		}
+	}
+
+	return nil, false
+}
+
+// ParseInterleaved splits the first interleaved frame, $ channel length
+// data, off buf. n is 0 while the frame is incomplete.
+func ParseInterleaved(buf []byte) (channel int, data []byte, n int) {
+	if len(buf) < 4 || buf[0] != '$' {
+		return 0, nil, 0
+	}
+
+	length := int(binary.BigEndian.Uint16(buf[2:4]))
+	if len(buf) < 4+length {
+		return 0, nil, 0
+	}
+
+	return int(buf[1]), buf[4 : 4+length], 4 + length
+}
+
+// MarshalInterleaved frames data for channel of a tcp transport.
+func MarshalInterleaved(channel int, data []byte) []byte {
+	out := make([]byte, 4+len(data))
+	out[0], out[1] = '$', byte(channel)
+	binary.BigEndian.PutUint16(out[2:4], uint16(len(data)))
+	copy(out[4:], data)
+
+	return out
+}
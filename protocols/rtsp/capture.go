@@ -0,0 +1,71 @@
+package rtsp
+
+import (
+	"strings"
+
+	"github.com/pingostack/neon/pkg/capture"
+)
+
+// CaptureMessages records the requests and responses of the sessions a
+// capture runs for, see package capture. target names the stream and session
+// of a request, nil takes the path of the first url of the session and its
+// rtsp session.
+func CaptureMessages(target func(serv *Serv, req *Request) capture.Target) Middleware {
+	if target == nil {
+		target = urlTarget
+	}
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(serv *Serv, req *Request) error {
+			t := target(serv, req)
+			if !capture.Enabled(t) {
+				return next(serv, req)
+			}
+
+			capture.Record(t, capture.KindRTSP, "request", map[string]interface{}{
+				"remote":  serv.RemoteAddr(),
+				"message": req.String(),
+			})
+			var status Status
+			serv.OnResponse(req, func(resp IResponse) {
+				status = resp.Status()
+				capture.Record(t, capture.KindRTSP, "response", map[string]interface{}{
+					"remote":  serv.RemoteAddr(),
+					"message": resp.String(),
+				})
+			})
+
+			before := serv.State()
+			err := next(serv, req)
+			if err != nil {
+				capture.Record(t, capture.KindRTSP, "request failed", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+
+			// the state changes once the handler returned
+			if state, ok := serv.nextState(req, status); ok && err == nil && state != before {
+				capture.Record(t, capture.KindState, "rtsp state", map[string]interface{}{
+					"from": before.String(),
+					"to":   state.String(),
+				})
+			}
+
+			return err
+		}
+	}
+}
+
+func urlTarget(serv *Serv, req *Request) capture.Target {
+	raw := serv.url
+	if raw == "" {
+		raw = req.Url()
+	}
+
+	u := &Url{}
+	if err := u.Parse(raw); err != nil {
+		return capture.Target{Session: req.Session()}
+	}
+
+	return capture.Target{Stream: strings.Trim(u.Path, "/"), Session: req.Session()}
+}
@@ -2,6 +2,7 @@ package rtsp
 
 import (
 	"strconv"
+	"strings"
 
 	goPool "github.com/panjf2000/gnet/pkg/pool/goroutine"
 	"github.com/sirupsen/logrus"
@@ -13,6 +14,10 @@ type Client struct {
 	pool        *goPool.Pool
 	Url         string
 	Write       WriteHandler
+	// Require is sent with DESCRIBE, SETUP and PLAY, e.g. RequireBackchannel.
+	Require []string
+	// Limits bound the responses of the server, the zero value is unlimited.
+	Limits Limits
 }
 
 func NewClient(write WriteHandler) *Client {
@@ -47,7 +52,7 @@ func (c *Client) Feed(buf []byte) (int, error) {
 	var err error
 	var endOffset int
 	if buf[0] != '$' {
-		_, endOffset, err = UnmarshalResponse(buf)
+		_, endOffset, err = UnmarshalResponseWithLimits(buf, c.Limits)
 		if err != nil {
 			return endOffset, err
 		}
@@ -73,18 +78,36 @@ func (c *Client) nextCSeq() string {
 }
 
 func (c *Client) NewRequest(method string) *Request {
+	url := c.Url
+	if url == "" {
+		url = "*"
+	}
+
 	req := &Request{
 		method:  method,
-		url:     "*",
+		url:     url,
 		version: "RTSP/1.0",
 		lines: HeaderLines{
-			"CSeq": c.nextCSeq(),
+			{"CSeq", c.nextCSeq()},
 		},
 	}
 
+	switch strings.ToUpper(method) {
+	case "DESCRIBE", "SETUP", "PLAY":
+		if len(c.Require) > 0 {
+			req.SetLine("Require", strings.Join(c.Require, ", "))
+		}
+	}
+
 	return req
 }
 
+// WriteBackchannel sends an rtp packet of the backchannel on the interleaved
+// channel its SETUP negotiated.
+func (c *Client) WriteBackchannel(channel int, packet []byte) error {
+	return c.Write(MarshalInterleaved(channel, packet))
+}
+
 func (c *Client) NewOptionsRequest() *OptionsRequest {
 	req := c.NewRequest("OPTIONS").Option()
 	return req
@@ -5,6 +5,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/pingostack/neon/pkg/tcp"
 	"github.com/pingostack/neon/protocols/rtsp"
 	"github.com/sirupsen/logrus"
 )
@@ -59,6 +60,15 @@ func (ts *TestServer) OnStream(serv *rtsp.Serv) error {
 	return nil
 }
 
+func (ts *TestServer) OnBackchannel(serv *rtsp.Serv) ([]rtsp.BackchannelFormat, error) {
+	fmt.Println("backchannel")
+	return []rtsp.BackchannelFormat{{PayloadType: 0, Codec: "PCMU", ClockRate: 8000}}, nil
+}
+
+func (ts *TestServer) OnBackchannelPacket(serv *rtsp.Serv, packet []byte) {
+	fmt.Println("backchannel packet", len(packet))
+}
+
 func (ts *TestServer) NewOrGet() rtsp.IServSession {
 	return &TestSession{
 		ServSession: rtsp.NewServSession(ts),
@@ -66,6 +76,30 @@ func (ts *TestServer) NewOrGet() rtsp.IServSession {
 	}
 }
 
+// logRequests logs every request with the time its handler took, and names
+// the server in the responses.
+func logRequests(log *logrus.Logger) rtsp.Middleware {
+	return func(next rtsp.HandlerFunc) rtsp.HandlerFunc {
+		return func(serv *rtsp.Serv, req *rtsp.Request) error {
+			serv.OnResponse(req, func(resp rtsp.IResponse) {
+				resp.SetLine("server", "neon-example")
+			})
+
+			start := time.Now()
+			err := next(serv, req)
+			log.WithFields(logrus.Fields{
+				"method":   req.MethodStr(),
+				"url":      req.Url(),
+				"elapsed":  time.Since(start),
+				"remote":   serv.RemoteAddr(),
+				"hasError": err != nil,
+			}).Info("rtsp request")
+
+			return err
+		}
+	}
+}
+
 func main() {
 	log := logrus.New()
 	ts := &TestServer{
@@ -74,16 +108,25 @@ func main() {
 	log.SetLevel(logrus.DebugLevel)
 	log.SetOutput(os.Stdout)
 	s, err := rtsp.NewServer(ts, ts, ":8554", rtsp.Options{
-		ReusePort:        true,
-		ReuseAddr:        true,
-		TCPKeepAlive:     10 * time.Second,
-		TCPNoDelay:       true,
-		LockOSThread:     true,
-		SocketRecvBuffer: 1024 * 1024,
-		SocketSendBuffer: 1024 * 1024,
+		GnetOptions: tcp.GnetOptions{
+			ReusePort:           true,
+			ReuseAddr:           true,
+			TCPKeepAliveSeconds: 10,
+			LockOSThread:        true,
+			SocketRecvBuffer:    1024 * 1024,
+			SocketSendBuffer:    1024 * 1024,
+			Multicore:           true,
+		},
 		Logger:           log,
-		Multicore:        true,
-		NumEventLoop:     0,
+		IdleTimeout:      60 * time.Second,
+		HandshakeTimeout: 10 * time.Second,
+		ReadTimeout:      5 * time.Second,
+		Middlewares: []rtsp.Middleware{
+			logRequests(log),
+			rtsp.CaptureMessages(nil),
+			rtsp.DumpMessages(nil),
+			rtsp.RejectMethods(rtsp.AnnounceMethod, rtsp.RecordMethod),
+		},
 	})
 	if err != nil {
 		panic(err)
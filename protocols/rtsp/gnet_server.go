@@ -3,21 +3,43 @@ package rtsp
 import (
 	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/panjf2000/gnet"
+	"github.com/pingostack/neon/pkg/clock"
+	"github.com/pingostack/neon/pkg/metrics"
+	"github.com/pingostack/neon/pkg/tcp"
+	"github.com/pingostack/neon/pkg/trace"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const (
+	timeoutCheckInterval = time.Second
 )
 
 type servConn struct {
 	*Serv
-	c gnet.Conn
+	c       tcp.Conn
+	release func()
+	writer  *tcp.Writer
+	// unix nanos, 0 means unset
+	openedAt     int64
+	lastRead     int64
+	pendingSince int64
+	proxyPending bool
 }
 
 type Server struct {
-	gnet.EventServer
 	eventListener IServerEventListener
 	provider      ISessionProvider
 	opt           Options
 	addr          string
+	conns         sync.Map
+	lock          sync.RWMutex
+	use           []Middleware
+	transport     tcp.Transport
 }
 
 func NewServer(eventListener IServerEventListener, provider ISessionProvider, addr string, opt Options) (*Server, error) {
@@ -32,102 +54,299 @@ func NewServer(eventListener IServerEventListener, provider ISessionProvider, ad
 		return nil, fmt.Errorf("logger is nil")
 	}
 
+	if opt.Limits == (Limits{}) {
+		s.opt.Limits = DefaultLimits
+	}
+	s.opt.Clock = clock.Or(opt.Clock)
+
+	transport, err := tcp.NewTransport(s, addr, tcp.TransportOptions{
+		Kind:         opt.Transport,
+		Gnet:         opt.GnetOptions,
+		TLS:          opt.TLSConfig,
+		WriteTimeout: opt.WriteTimeout,
+		Protocol:     metrics.ProtocolRTSP,
+		Logger:       opt.Logger,
+		Ticker:       opt.IdleTimeout > 0 || opt.HandshakeTimeout > 0 || opt.ReadTimeout > 0,
+		UnixSocket:   opt.UnixSocket,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.transport = transport
+
 	return s, nil
 }
 
+// Use adds middlewares after those of the options, connections opened from
+// then on run them.
+func (s *Server) Use(middlewares ...Middleware) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.use = append(s.use, middlewares...)
+}
+
+func (s *Server) middlewares() []Middleware {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return append(append([]Middleware(nil), s.opt.Middlewares...), s.use...)
+}
+
+// Run blocks until the server is shut down.
 func (s *Server) Run() error {
-	opt := gnet.Options{
-		ReusePort:        s.opt.ReusePort,
-		ReuseAddr:        s.opt.ReuseAddr,
-		TCPKeepAlive:     s.opt.TCPKeepAlive,
-		SocketRecvBuffer: s.opt.SocketRecvBuffer,
-		SocketSendBuffer: s.opt.SocketSendBuffer,
-		Logger:           s.opt.Logger,
-		Multicore:        s.opt.Multicore,
-		NumEventLoop:     s.opt.NumEventLoop,
-		Codec:            s,
-	}
-
-	s.opt.Logger.Infof("server is running on %s", s.addr)
-	err := gnet.Serve(s, s.addr, gnet.WithOptions(opt))
-	if err != nil {
+	if err := s.Start(); err != nil {
 		return err
 	}
 
-	return nil
+	<-s.transport.Done()
+
+	return s.transport.Err()
+}
+
+// Start returns once the server listens, see Run.
+func (s *Server) Start() error {
+	return s.transport.Start()
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
-	return gnet.Stop(ctx, s.addr)
+	return s.transport.Stop(ctx)
 }
 
-func (s *Server) OnInitComplete(gs gnet.Server) (action gnet.Action) {
-	return
+// Running tells whether the server listens, it may be started again once
+// shut down.
+func (s *Server) Running() bool {
+	return s.transport.Running()
 }
 
-func (s *Server) OnShutdown(gs gnet.Server) {
+func (s *Server) OnShutdown() {
 	if s.eventListener != nil {
 		s.eventListener.OnShutdown(s)
 	}
 }
 
-func (s *Server) OnOpened(c gnet.Conn) (out []byte, action gnet.Action) {
+func (s *Server) OnOpen(c tcp.Conn) error {
+	// behind a load balancer the ACL can only run once the PROXY header names
+	// the client, only trusted proxies may name one
+	proxied := s.opt.ProxyProtocol && s.opt.TrustedProxies.Trusts(c.RemoteAddr())
+	release := func() {}
+	if !proxied {
+		var err error
+		release, err = s.opt.ACL.Acquire(tcp.PeerAddr(c.RemoteAddr()))
+		if err != nil {
+			s.opt.Logger.Warnf("connection from %s rejected: %v", c.RemoteAddr(), err)
+			return err
+		}
+	}
+
+	ctx, span := trace.Start(context.Background(), "rtsp.accept",
+		oteltrace.WithSpanKind(oteltrace.SpanKindServer),
+		oteltrace.WithAttributes(attribute.String("net.peer", tcp.PeerAddr(c.RemoteAddr()))))
+	defer span.End()
+
+	writer := tcp.NewWriter(func(data []byte) error {
+		metrics.BytesOut.With(metrics.ProtocolRTSP).Add(float64(len(data)))
+		return c.AsyncWrite(data)
+	}, s.opt.WriteQueue)
+
 	session := s.provider.NewOrGet()
 	sc := &servConn{
 		Serv: NewServ(session, ServOptions{
-			Logger:      session.Logger(),
-			IdleTimeout: s.opt.IdleTimeout,
-			Write: func(data []byte) error {
-				return c.AsyncWrite(data)
-			},
+			Logger:           session.Logger(),
+			IdleTimeout:      s.opt.IdleTimeout,
+			Context:          ctx,
+			RemoteAddr:       tcp.PeerAddr(c.RemoteAddr()),
+			Authenticator:    s.opt.Authenticator,
+			Realm:            s.opt.Realm,
+			Write:            writer.Write,
+			Writer:           writer,
+			Redirect:         s.opt.Redirect,
+			Middlewares:      s.middlewares(),
+			Limits:           s.opt.Limits,
+			CodecPreferences: s.opt.CodecPreferences,
 		}),
-		c: c,
+		c:            c,
+		release:      release,
+		writer:       writer,
+		openedAt:     s.opt.Clock.Now().UnixNano(),
+		lastRead:     s.opt.Clock.Now().UnixNano(),
+		proxyPending: proxied,
 	}
 
+	s.conns.Store(c, sc)
 	session.AddParams(s, sc)
 	c.SetContext(session)
 
-	return
+	metrics.Connections.With(metrics.ProtocolRTSP).Inc()
+	metrics.ActiveConnections.With(metrics.ProtocolRTSP).Inc()
+
+	return nil
 }
 
-func (s *Server) OnClosed(c gnet.Conn, err error) (action gnet.Action) {
+func (s *Server) OnClose(c tcp.Conn, err error) {
+	if c.Context() == nil {
+		// rejected in OnOpen
+		return
+	}
+
+	metrics.ActiveConnections.With(metrics.ProtocolRTSP).Dec()
+	s.conns.Delete(c)
+	if sc, err := s.getServConn(c); err == nil {
+		sc.release()
+		sc.writer.Close()
+	}
+
 	if s.eventListener != nil {
 		ss, err := s.getServSession(c)
 		if err == nil {
 			s.eventListener.OnDisconnect(ss)
 		}
 	}
-
-	return
 }
 
-func (s *Server) Encode(c gnet.Conn, buf []byte) ([]byte, error) {
-	return buf, nil
+func (s *Server) OnWritten(c tcp.Conn, n int) {
+	if v, ok := s.conns.Load(c); ok {
+		v.(*servConn).writer.Done(n)
+	}
 }
 
-func (s *Server) Decode(c gnet.Conn) ([]byte, error) {
+func (s *Server) OnData(c tcp.Conn, data []byte) (int, error) {
 	sc, err := s.getServConn(c)
 	if err != nil {
 		s.opt.Logger.Errorf("getServSession error: %v", err)
-		return nil, err
+		return 0, err
 	}
 
-	offset, err := sc.Serv.Feed(c.Read())
-	if offset > 0 && offset < c.BufferLength() {
-		c.ShiftN(offset)
-	} else if offset >= c.BufferLength() {
-		c.ResetBuffer()
+	now := s.opt.Clock.Now().UnixNano()
+	atomic.StoreInt64(&sc.lastRead, now)
+
+	consumed := 0
+	if sc.proxyPending {
+		n, err := s.acceptProxyHeader(sc, data)
+		if err != nil || sc.proxyPending {
+			return n, err
+		}
+		consumed, data = n, data[n:]
+	}
+
+	offset, err := sc.Serv.Feed(data)
+	if offset > 0 {
+		metrics.BytesIn.With(metrics.ProtocolRTSP).Add(float64(offset))
+	}
+	if offset > len(data) {
+		offset = len(data)
+	}
+
+	if offset == len(data) {
+		atomic.StoreInt64(&sc.pendingSince, 0)
+	} else if offset > 0 || atomic.LoadInt64(&sc.pendingSince) == 0 {
+		atomic.StoreInt64(&sc.pendingSince, now)
 	}
 
 	if err != nil {
 		s.opt.Logger.Errorf("serv feed error: %v", err)
-		return nil, err
+		return consumed + offset, err
+	}
+
+	return consumed + offset, nil
+}
+
+// acceptProxyHeader returns the length of the PROXY header at the start of
+// data, sc.proxyPending stays set while it is incomplete.
+func (s *Server) acceptProxyHeader(sc *servConn, data []byte) (int, error) {
+	header, consumed, err := tcp.ParseProxyHeader(data)
+	if err == tcp.ErrProxyIncomplete {
+		return 0, nil
+	} else if err != nil {
+		s.opt.Logger.Warnf("connection from %s: %v", sc.c.RemoteAddr(), err)
+		return 0, err
+	}
+
+	sc.proxyPending = false
+
+	remoteAddr := tcp.PeerAddr(sc.c.RemoteAddr())
+	if header.Source != nil {
+		remoteAddr = header.Source.String()
+		sc.Serv.SetRemoteAddr(remoteAddr)
+	}
+
+	release, err := s.opt.ACL.Acquire(remoteAddr)
+	if err != nil {
+		s.opt.Logger.Warnf("connection from %s rejected: %v", remoteAddr, err)
+		return consumed, err
+	}
+	sc.release = release
+
+	return consumed, nil
+}
+
+// Redirect sends the players of this server to the location redirect
+// returns for their url, e.g. before the server shuts down. It returns how
+// many were redirected.
+func (s *Server) Redirect(redirect Redirector) int {
+	count := 0
+	s.conns.Range(func(key, value interface{}) bool {
+		sc := value.(*servConn)
+		if state := sc.State(); state != PlayState && state != PauseState {
+			return true
+		}
+
+		location, ok := redirect(sc.url)
+		if !ok {
+			return true
+		}
+
+		if err := sc.Serv.Redirect(location); err != nil {
+			s.opt.Logger.Warnf("failed to redirect %s: %v", sc.c.RemoteAddr(), err)
+			return true
+		}
+
+		count++
+
+		return true
+	})
+
+	return count
+}
+
+func (s *Server) OnTick() time.Duration {
+	now := s.opt.Clock.Now()
+
+	s.conns.Range(func(key, value interface{}) bool {
+		sc := value.(*servConn)
+		if reason := s.expired(sc, now); reason != "" {
+			s.opt.Logger.Warnf("closing connection from %s: %s", sc.c.RemoteAddr(), reason)
+			s.conns.Delete(key)
+			sc.c.Close()
+		}
+
+		return true
+	})
+
+	return timeoutCheckInterval
+}
+
+func (s *Server) expired(sc *servConn, now time.Time) string {
+	since := func(unixNano int64) time.Duration {
+		return now.Sub(time.Unix(0, unixNano))
+	}
+
+	if s.opt.HandshakeTimeout > 0 && !sc.Established() && since(sc.openedAt) > s.opt.HandshakeTimeout {
+		return "handshake timeout"
+	}
+
+	if pending := atomic.LoadInt64(&sc.pendingSince); s.opt.ReadTimeout > 0 && pending != 0 && since(pending) > s.opt.ReadTimeout {
+		return "read timeout"
+	}
+
+	if s.opt.IdleTimeout > 0 && since(atomic.LoadInt64(&sc.lastRead)) > s.opt.IdleTimeout {
+		return "idle timeout"
 	}
 
-	return nil, nil
+	return ""
 }
 
-func (s *Server) getServConn(c gnet.Conn) (*servConn, error) {
+func (s *Server) getServConn(c tcp.Conn) (*servConn, error) {
 	session, err := s.getServSession(c)
 	if err != nil {
 		s.opt.Logger.Errorf("getServSession error: %v", err)
@@ -143,7 +362,7 @@ func (s *Server) getServConn(c gnet.Conn) (*servConn, error) {
 	return conn.(*servConn), nil
 }
 
-func (s *Server) getServSession(c gnet.Conn) (IServSession, error) {
+func (s *Server) getServSession(c tcp.Conn) (IServSession, error) {
 	cctx := c.Context()
 	if cctx == nil {
 		s.opt.Logger.Errorf("connection context is nil")
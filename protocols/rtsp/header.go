@@ -0,0 +1,218 @@
+package rtsp
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HeaderLine is a header as it was sent or set, the key in its casing.
+type HeaderLine struct {
+	Key   string
+	Value string
+}
+
+// HeaderLines are the headers of a message in order. Keys compare case
+// insensitively and may repeat, Get returns the first value.
+type HeaderLines []HeaderLine
+
+// headers that must not repeat with different values, a message carrying two
+// could be read differently by a proxy in front of the server.
+var singleHeaders = []string{"content-length", "cseq", "session"}
+
+// the casing of the headers of rfc 2326 and 7826, some clients only match
+// these
+var canonicalKeys = map[string]string{}
+
+func init() {
+	for _, key := range []string{
+		"Accept", "Accept-Encoding", "Accept-Language", "Accept-Ranges",
+		"Allow", "Authorization", "Bandwidth", "Blocksize", "Cache-Control",
+		"Conference", "Connection", "Content-Base", "Content-Encoding",
+		"Content-Language", "Content-Length", "Content-Location",
+		"Content-Type", "CSeq", "Date", "Expires", "From", "If-Modified-Since",
+		"Last-Modified", "Location", "Media-Properties", "Proxy-Authenticate",
+		"Proxy-Require", "Proxy-Supported", "Public", "Range", "Referer",
+		"Require", "Retry-After", "RTP-Info", "Scale", "Seek-Style", "Server",
+		"Session", "Speed", "Supported", "Timestamp", "Transport",
+		"Unsupported", "User-Agent", "Vary", "Via", "WWW-Authenticate",
+	} {
+		canonicalKeys[strings.ToLower(key)] = key
+	}
+}
+
+// CanonicalKey returns key in the casing of the rtsp rfcs, unknown keys as
+// they are.
+func CanonicalKey(key string) string {
+	if canonical, ok := canonicalKeys[strings.ToLower(key)]; ok {
+		return canonical
+	}
+
+	return key
+}
+
+func (lines HeaderLines) Get(key string) string {
+	for _, line := range lines {
+		if strings.EqualFold(line.Key, key) {
+			return line.Value
+		}
+	}
+
+	return ""
+}
+
+// Values returns the values of key in order.
+func (lines HeaderLines) Values(key string) []string {
+	var values []string
+	for _, line := range lines {
+		if strings.EqualFold(line.Key, key) {
+			values = append(values, line.Value)
+		}
+	}
+
+	return values
+}
+
+func (lines HeaderLines) Has(key string) bool {
+	for _, line := range lines {
+		if strings.EqualFold(line.Key, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Set replaces the values of key, the header keeps its position.
+func (lines *HeaderLines) Set(key, value string) {
+	for i, line := range *lines {
+		if strings.EqualFold(line.Key, key) {
+			(*lines)[i] = HeaderLine{Key: key, Value: value}
+			lines.del(key, i+1)
+			return
+		}
+	}
+
+	lines.Add(key, value)
+}
+
+func (lines *HeaderLines) Add(key, value string) {
+	*lines = append(*lines, HeaderLine{Key: key, Value: value})
+}
+
+func (lines *HeaderLines) Del(key string) {
+	lines.del(key, 0)
+}
+
+// del removes key from the lines from index from on.
+func (lines *HeaderLines) del(key string, from int) {
+	kept := (*lines)[:from]
+	for _, line := range (*lines)[from:] {
+		if !strings.EqualFold(line.Key, key) {
+			kept = append(kept, line)
+		}
+	}
+
+	*lines = kept
+}
+
+func (lines HeaderLines) String() string {
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(line.Key)
+		b.WriteString(": ")
+		b.WriteString(line.Value)
+		b.WriteString("\r\n")
+	}
+
+	return b.String()
+}
+
+// Canonical returns the lines as messages are written: CSeq first, Session
+// right after it, the others in order, the keys of the rfcs in their casing.
+func (lines HeaderLines) Canonical() HeaderLines {
+	canonical := make(HeaderLines, 0, len(lines))
+	for _, key := range []string{"CSeq", "Session"} {
+		for _, value := range lines.Values(key) {
+			canonical.Add(key, value)
+		}
+	}
+
+	for _, line := range lines {
+		if strings.EqualFold(line.Key, "cseq") || strings.EqualFold(line.Key, "session") {
+			continue
+		}
+
+		canonical.Add(CanonicalKey(line.Key), line.Value)
+	}
+
+	return canonical
+}
+
+// parseHeaderLines parses the header lines following the request or status
+// line. Continuation lines starting with a space or tab fold into the header
+// before them, bare CR or LF line endings are rejected.
+func parseHeaderLines(raw [][]byte, limits Limits) (HeaderLines, int, error) {
+	lines := make(HeaderLines, 0, len(raw))
+	for _, line := range raw {
+		if len(line) == 0 {
+			continue
+		}
+
+		if bytes.ContainsAny(line, "\r\n") {
+			return nil, 0, fmt.Errorf("%w: bare line ending in header %q", ErrMalformed, line)
+		}
+
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(lines) == 0 {
+				return nil, 0, fmt.Errorf("%w: continuation of no header %q", ErrMalformed, line)
+			}
+
+			last := &lines[len(lines)-1]
+			last.Value = strings.TrimSpace(last.Value + " " + strings.TrimSpace(string(line)))
+			continue
+		}
+
+		if err := limits.checkLine(line); err != nil {
+			return nil, 0, err
+		}
+
+		idx := bytes.IndexByte(line, ':')
+		lines.Add(string(line[:idx]), strings.TrimSpace(string(line[idx+1:])))
+	}
+
+	for _, key := range singleHeaders {
+		values := lines.Values(key)
+		for i := 1; i < len(values); i++ {
+			if values[i] != values[0] || limits.Strict {
+				return nil, 0, fmt.Errorf("%w: repeated %s", ErrMalformed, key)
+			}
+		}
+	}
+
+	contentLength := 0
+	if values := lines.Values("content-length"); len(values) > 0 {
+		var err error
+		if contentLength, err = parseContentLength(values[0]); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return lines, contentLength, nil
+}
+
+// parseContentLength takes digits only, Atoi would take signs.
+func parseContentLength(value string) (int, error) {
+	if value == "" || len(value) > 10 {
+		return 0, fmt.Errorf("%w: content length %q", ErrMalformed, value)
+	}
+
+	for i := 0; i < len(value); i++ {
+		if value[i] < '0' || value[i] > '9' {
+			return 0, fmt.Errorf("%w: content length %q", ErrMalformed, value)
+		}
+	}
+
+	return strconv.Atoi(value)
+}
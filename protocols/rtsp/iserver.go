@@ -1,7 +1,13 @@
 package rtsp
 
 import (
+	"crypto/tls"
 	"time"
+
+	"github.com/pingostack/neon/pkg/acl"
+	"github.com/pingostack/neon/pkg/auth"
+	"github.com/pingostack/neon/pkg/clock"
+	"github.com/pingostack/neon/pkg/tcp"
 )
 
 type IServerEventListener interface {
@@ -15,37 +21,71 @@ type ISessionProvider interface {
 }
 
 type Options struct {
+	// Transport selects how connections are served, gnet event loops when
+	// empty, tcp.TransportNet for blocking writes and tls.
+	Transport tcp.TransportKind
 
-	// ReuseAddr indicates whether to set up the SO_REUSEADDR socket option.
-	ReuseAddr bool
+	// Gnet tunes the event loops and the sockets of the listener.
+	tcp.GnetOptions
 
-	// ReusePort indicates whether to set up the SO_REUSEPORT socket option.
-	ReusePort bool
+	// UnixSocket sets the permissions of a unix:// listen address, e.g. for
+	// a transcoder pushing from the same host.
+	UnixSocket tcp.UnixSocketOptions
 
-	// TCPKeepAlive sets up a duration for (SO_KEEPALIVE) socket option.
-	TCPKeepAlive time.Duration
+	// TLSConfig serves rtsps, it needs tcp.TransportNet.
+	TLSConfig *tls.Config
 
-	// TCPNoDelay enables/disables the TCP_NODELAY socket option.
-	TCPNoDelay bool
+	// WriteTimeout closes connections a write blocks for that long with
+	// tcp.TransportNet, 0 waits forever.
+	WriteTimeout time.Duration
 
-	// LockOSThread enables/disables the runtime.LockOSThread() call.
-	LockOSThread bool
+	// Logger is the logger for the server.
+	Logger Logger
 
-	// SocketRecvBuffer sets the maximum socket receive buffer in bytes.
-	SocketRecvBuffer int
+	// IdleTimeout is the maximum duration for the connection to be idle, i.e.
+	// receive nothing, 0 disables it.
+	IdleTimeout time.Duration
 
-	// SocketSendBuffer sets the maximum socket send buffer in bytes.
-	SocketSendBuffer int
+	// HandshakeTimeout closes connections that have not reached PLAY or RECORD
+	// within that time, 0 disables it.
+	HandshakeTimeout time.Duration
 
-	// Logger is the logger for the server.
-	Logger Logger
+	// ReadTimeout is the maximum duration a partially received request may
+	// stay incomplete, 0 disables it.
+	ReadTimeout time.Duration
 
-	// NumEventLoop is the number of event loops.
-	NumEventLoop int
+	// Authenticator validates play and publish requests, nil disables authentication.
+	Authenticator auth.Authenticator
 
-	// Multicore enables/disables the multi-core execution.
-	Multicore bool
+	// Realm is the digest authentication realm.
+	Realm string
 
-	// IdleTimeout is the maximum duration for the connection to be idle.
-	IdleTimeout time.Duration
+	// ACL filters accepted connections, nil accepts everything.
+	ACL *acl.ACL
+
+	// ProxyProtocol expects a HAProxy PROXY v1/v2 header on every connection
+	// of TrustedProxies, other peers are taken as they are.
+	ProxyProtocol  bool
+	TrustedProxies tcp.TrustedProxies
+
+	// WriteQueue bounds the output queued per connection.
+	WriteQueue tcp.WriterOptions
+
+	// Redirect sends players to another server on DESCRIBE, e.g. while
+	// this one is overloaded, nil serves everything here.
+	Redirect Redirector
+
+	// Middlewares run around the method handlers of every connection, see
+	// Middleware.
+	Middlewares []Middleware
+
+	// Limits bound what clients may send, the zero value uses DefaultLimits.
+	Limits Limits
+
+	// CodecPreferences order the formats of the media of DESCRIBE, e.g.
+	// video/H264;profile-level-id=42e01f first, see sdpassistor.PreferCodecs.
+	CodecPreferences []string
+
+	// Clock times the connections out, clock.Default() when nil.
+	Clock clock.Clock
 }
@@ -0,0 +1,141 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrHeaderTooLarge      = errors.New("rtsp header too large")
+	ErrTooManyHeaders      = errors.New("too many rtsp headers")
+	ErrContentTooLarge     = errors.New("rtsp content too large")
+	ErrSDPTooLarge         = errors.New("sdp too large")
+	ErrInterleavedTooLarge = errors.New("interleaved frame too large")
+	ErrMalformed           = errors.New("malformed rtsp message")
+)
+
+// Limits bound the input the parsers accept, so a peer can't make them buffer
+// or allocate without end. Zero fields are unlimited.
+type Limits struct {
+	// MaxHeaderSize bounds the request or status line with the headers.
+	MaxHeaderSize    int
+	MaxHeaderCount   int
+	MaxContentLength int
+	// MaxSDPSize bounds application/sdp bodies, e.g. of ANNOUNCE.
+	MaxSDPSize int
+	// MaxInterleavedSize bounds the data of an interleaved frame, its format
+	// allows at most 65535 bytes.
+	MaxInterleavedSize int
+	// Strict rejects what the parsers otherwise tolerate: control
+	// characters, a repeated Content-Length, versions other than RTSP/1.0
+	// and 2.0 and status codes that are not numbers. Header lines without a
+	// colon or with space before it are always rejected, they would hide a
+	// Content-Length.
+	Strict bool
+}
+
+// DefaultLimits are the limits of servers that configure none.
+var DefaultLimits = Limits{
+	MaxHeaderSize:    16 << 10,
+	MaxHeaderCount:   64,
+	MaxContentLength: 1 << 20,
+	MaxSDPSize:       64 << 10,
+}
+
+// checkIncomplete is called while buf holds no complete header yet.
+func (l Limits) checkIncomplete(buf []byte) error {
+	if l.MaxHeaderSize > 0 && len(buf) > l.MaxHeaderSize {
+		return fmt.Errorf("%w: more than %d bytes", ErrHeaderTooLarge, l.MaxHeaderSize)
+	}
+
+	return nil
+}
+
+func (l Limits) checkHeader(size, count int) error {
+	if l.MaxHeaderSize > 0 && size > l.MaxHeaderSize {
+		return fmt.Errorf("%w: %d bytes", ErrHeaderTooLarge, size)
+	}
+
+	if l.MaxHeaderCount > 0 && count > l.MaxHeaderCount {
+		return fmt.Errorf("%w: %d", ErrTooManyHeaders, count)
+	}
+
+	return nil
+}
+
+// checkLine checks a header line, control characters only in strict mode.
+func (l Limits) checkLine(line []byte) error {
+	key, _, ok := strings.Cut(string(line), ":")
+	if !ok || key == "" || strings.ContainsAny(key, " \t") {
+		return fmt.Errorf("%w: invalid header %q", ErrMalformed, line)
+	}
+
+	if !l.Strict {
+		return nil
+	}
+
+	for _, c := range line {
+		if c < ' ' && c != '\t' || c == 0x7f {
+			return fmt.Errorf("%w: control character in header %q", ErrMalformed, line)
+		}
+	}
+
+	return nil
+}
+
+func (l Limits) checkVersion(version string) error {
+	if !l.Strict {
+		return nil
+	}
+
+	switch strings.ToLower(version) {
+	case "rtsp/1.0", "rtsp/2.0":
+		return nil
+	}
+
+	return fmt.Errorf("%w: version %q", ErrMalformed, version)
+}
+
+// checkContent runs once the headers are parsed, before the body is waited
+// for.
+func (l Limits) checkContent(length int, contentType string) error {
+	if l.MaxContentLength > 0 && length > l.MaxContentLength {
+		return fmt.Errorf("%w: %d bytes", ErrContentTooLarge, length)
+	}
+
+	if l.MaxSDPSize > 0 && length > l.MaxSDPSize && strings.HasPrefix(strings.ToLower(contentType), "application/sdp") {
+		return fmt.Errorf("%w: %d bytes", ErrSDPTooLarge, length)
+	}
+
+	return nil
+}
+
+// checkInterleaved checks the frame at the start of buf as soon as its header
+// is in.
+func (l Limits) checkInterleaved(buf []byte) error {
+	if l.MaxInterleavedSize <= 0 || len(buf) < 4 {
+		return nil
+	}
+
+	if length := int(binary.BigEndian.Uint16(buf[2:4])); length > l.MaxInterleavedSize {
+		return fmt.Errorf("%w: %d bytes", ErrInterleavedTooLarge, length)
+	}
+
+	return nil
+}
+
+// limitStatus is the status a server answers a message with that broke its
+// limits.
+func limitStatus(err error) (Status, bool) {
+	switch {
+	case errors.Is(err, ErrContentTooLarge), errors.Is(err, ErrSDPTooLarge):
+		return StatusRequestEntityTooLarge, true
+	case errors.Is(err, ErrHeaderTooLarge), errors.Is(err, ErrTooManyHeaders), errors.Is(err, ErrMalformed):
+		// rtsp has no status for oversized headers
+		return StatusBadRequest, true
+	}
+
+	return 0, false
+}
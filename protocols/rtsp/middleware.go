@@ -0,0 +1,94 @@
+package rtsp
+
+// HandlerFunc processes a request of a session, the method handlers of Serv
+// write their response.
+type HandlerFunc func(serv *Serv, req *Request) error
+
+// Middleware wraps the method handlers of a server, as http middleware does.
+// It acts before them by reading or rewriting req before calling next, after
+// them once next returned. Not calling next rejects the request, the
+// middleware writes the response then, e.g. with WriteResponseStatus.
+// Responses are rewritten with Serv.OnResponse.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Chain returns h wrapped by middlewares, the first one runs first.
+func Chain(h HandlerFunc, middlewares ...Middleware) HandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+
+	return h
+}
+
+// RejectMethods answers the methods with 405 Method Not Allowed.
+func RejectMethods(methods ...MethodEnum) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(serv *Serv, req *Request) error {
+			for _, m := range methods {
+				if req.Method() == m {
+					return serv.WriteResponseStatus(req.CSeq(), StatusMethodNotAllowed)
+				}
+			}
+
+			return next(serv, req)
+		}
+	}
+}
+
+// dispatch calls the handler of the method of req.
+func dispatch(serv *Serv, req *Request) error {
+	switch req.Method() {
+	case OptionsMethod:
+		return serv.OptionsProcess(req)
+	case DescribeMethod:
+		return serv.DescribeProcess(req)
+	case AnnounceMethod:
+		return serv.AnnounceProcess(req)
+	case SetupMethod:
+		return serv.SetupProcess(req)
+	case PlayMethod:
+		return serv.PlayProcess(req)
+	case PauseMethod:
+		return serv.PauseProcess(req)
+	case TeardownMethod:
+		return serv.TeardownProcess(req)
+	case GetParameterMethod:
+		return serv.GetParameterProcess(req)
+	case SetParameterMethod:
+		return serv.SetParameterProcess(req)
+	case RecordMethod:
+		return serv.RecordProcess(req)
+	}
+
+	return serv.WriteResponseStatus(req.CSeq(), StatusMethodNotAllowed)
+}
+
+// OnResponse calls f with the response to req before it is written, to
+// rewrite its header lines.
+func (serv *Serv) OnResponse(req *Request, f func(resp IResponse)) {
+	serv.hooksLock.Lock()
+	defer serv.hooksLock.Unlock()
+
+	if serv.hooks == nil {
+		serv.hooks = make(map[int][]func(IResponse))
+	}
+	serv.hooks[req.CSeq()] = append(serv.hooks[req.CSeq()], f)
+}
+
+func (serv *Serv) runResponseHooks(resp IResponse) {
+	serv.hooksLock.Lock()
+	hooks := serv.hooks[resp.CSeq()]
+	delete(serv.hooks, resp.CSeq())
+	serv.hooksLock.Unlock()
+
+	for _, f := range hooks {
+		f(resp)
+	}
+}
+
+func (serv *Serv) dropResponseHooks(req *Request) {
+	serv.hooksLock.Lock()
+	defer serv.hooksLock.Unlock()
+
+	delete(serv.hooks, req.CSeq())
+}
@@ -0,0 +1,48 @@
+package rtsp
+
+import (
+	"net"
+
+	"github.com/pingostack/neon/pkg/pcap"
+)
+
+// DumpMessages writes the requests and responses of the sessions a pcap dump
+// runs for to it, see package pcap. session names the session of a request,
+// nil takes its rtsp session.
+func DumpMessages(session func(serv *Serv, req *Request) string) Middleware {
+	if session == nil {
+		session = func(_ *Serv, req *Request) string {
+			return req.Session()
+		}
+	}
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(serv *Serv, req *Request) error {
+			id := session(serv, req)
+			if id == "" {
+				return next(serv, req)
+			}
+
+			dumps := pcap.Lookup(id)
+			if len(dumps) == 0 {
+				return next(serv, req)
+			}
+
+			remote, _ := net.ResolveTCPAddr("tcp", serv.RemoteAddr())
+			for _, d := range dumps {
+				if remote != nil {
+					d.SetAddrs(nil, remote)
+				}
+				d.WriteRTSP(true, []byte(req.String()))
+			}
+
+			serv.OnResponse(req, func(resp IResponse) {
+				for _, d := range dumps {
+					d.WriteRTSP(false, []byte(resp.String()))
+				}
+			})
+
+			return next(serv, req)
+		}
+	}
+}
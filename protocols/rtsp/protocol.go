@@ -2,7 +2,6 @@ package rtsp
 
 type RtspRole int
 type State int
-type HeaderLines map[string]string
 type WriteHandler func(date []byte) error
 
 type IRtspListener interface {
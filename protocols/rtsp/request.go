@@ -36,6 +36,7 @@ type IRequest interface {
 	Url() string
 	MethodStr() string
 	GetLine(key string) string
+	GetLines(key string) []string
 	SetLine(key, value string)
 	String() string
 	CSeq() int
@@ -46,24 +47,32 @@ type IRequest interface {
 }
 
 func UnmarshalRequest(buf []byte) (*Request, int, error) {
+	return UnmarshalRequestWithLimits(buf, Limits{})
+}
+
+// UnmarshalRequestWithLimits is UnmarshalRequest failing as soon as buf
+// breaks limits, also while the request is incomplete.
+func UnmarshalRequestWithLimits(buf []byte, limits Limits) (*Request, int, error) {
 	headerEndOffset := bytes.Index(buf, []byte("\r\n\r\n"))
 	if headerEndOffset == -1 {
-		return nil, 0, nil
+		return nil, 0, limits.checkIncomplete(buf)
 	}
 
 	endOffset := headerEndOffset + 4
 
 	contentLength := 0
 
-	req := &Request{
-		lines: make(HeaderLines),
-	}
+	req := &Request{}
 
 	lines := bytes.Split(buf[:headerEndOffset], []byte("\r\n"))
 	if len(lines) < 2 {
 		return nil, endOffset, errors.New("read lines error, invalid packet")
 	}
 
+	if err := limits.checkHeader(endOffset, len(lines)-1); err != nil {
+		return nil, endOffset, err
+	}
+
 	// parse first line
 	methodLine := lines[0]
 	methodLineParts := bytes.Split(methodLine, []byte(" "))
@@ -72,32 +81,22 @@ func UnmarshalRequest(buf []byte) (*Request, int, error) {
 	}
 
 	req.method = strings.ToLower(string(methodLineParts[0]))
-	req.url = strings.ToLower(string(methodLineParts[1]))
+	req.url = string(methodLineParts[1])
 	req.version = strings.ToLower(string(methodLineParts[2]))
 
+	if err := limits.checkVersion(req.version); err != nil {
+		return nil, endOffset, err
+	}
+
 	// parse other lines
-	for _, line := range lines[1:] {
-		if len(line) == 0 {
-			continue
-		}
-
-		idx := bytes.Index(line, []byte(":"))
-		if idx == -1 {
-			continue
-		}
-
-		key := strings.ToLower(string(line[:idx]))
-		value := string(line[idx+1:])
-		value = strings.TrimSpace(value)
-		req.lines[key] = value
-
-		if key == "content-length" {
-			var err error
-			contentLength, err = strconv.Atoi(value)
-			if err != nil {
-				return nil, endOffset, err
-			}
-		}
+	var err error
+	req.lines, contentLength, err = parseHeaderLines(lines[1:], limits)
+	if err != nil {
+		return nil, endOffset, err
+	}
+
+	if err := limits.checkContent(contentLength, req.lines.Get("content-type")); err != nil {
+		return nil, endOffset, err
 	}
 
 	if contentLength > len(buf[endOffset:]) {
@@ -114,14 +113,6 @@ func UnmarshalRequest(buf []byte) (*Request, int, error) {
 	return req, endOffset, nil
 }
 
-func (lines HeaderLines) String() string {
-	s := ""
-	for k, v := range lines {
-		s += k + ": " + v + "\r\n"
-	}
-	return s
-}
-
 func (req *Request) Method() MethodEnum {
 	switch req.method {
 	case "options":
@@ -153,21 +144,36 @@ func (req *Request) Url() string {
 	return req.url
 }
 
+// SetUrl sets the url of a request, e.g. the control url of a track.
+func (req *Request) SetUrl(url string) {
+	req.url = url
+}
+
 func (req *Request) MethodStr() string {
 	return req.method
 }
 
 func (req *Request) GetLine(key string) string {
-	return req.lines[key]
+	return req.lines.Get(key)
+}
+
+// Lines returns the headers as received or set.
+func (req *Request) Lines() HeaderLines {
+	return req.lines
+}
+
+// GetLines returns every value of key, in the order of the request.
+func (req *Request) GetLines(key string) []string {
+	return req.lines.Values(key)
 }
 
 func (req *Request) SetLine(key, value string) {
-	req.lines[key] = value
+	req.lines.Set(key, value)
 }
 
 func (req *Request) String() string {
 	ret := req.method + " " + req.url + " " + req.version + "\r\n" +
-		req.lines.String() +
+		req.lines.Canonical().String() +
 		"\r\n"
 
 	if len(req.content) > 0 {
@@ -178,7 +184,7 @@ func (req *Request) String() string {
 }
 
 func (req *Request) CSeq() int {
-	cseqLine := req.lines["cseq"]
+	cseqLine := req.lines.Get("cseq")
 	if cseqLine == "" {
 		return -1
 	}
@@ -192,16 +198,16 @@ func (req *Request) CSeq() int {
 }
 
 func (req *Request) Session() string {
-	return req.lines["session"]
+	return req.lines.Get("session")
 }
 
 func (req *Request) ContentType() string {
-	return req.lines["content-type"]
+	return req.lines.Get("content-type")
 }
 
 func (req *Request) SetContent(content string) {
 	req.content = []byte(content)
-	req.lines["Content-Length"] = strconv.Itoa(len(content))
+	req.lines.Set("Content-Length", strconv.Itoa(len(content)))
 }
 
 func (req *Request) GetContent() []byte {
@@ -326,6 +332,35 @@ func (req *PlayRequest) Range() string {
 	return req.GetLine("range")
 }
 
+// Scale is the rate the media is played at, 1 when absent.
+func (req *PlayRequest) Scale() (float64, bool) {
+	return parseRate(req.GetLine("scale"))
+}
+
+// Speed is the rate the media is delivered at, 1 when absent. Of a range,
+// as sent by RTSP 2.0 clients, the lower bound is taken.
+func (req *PlayRequest) Speed() (float64, bool) {
+	speed := req.GetLine("speed")
+	if i := strings.Index(speed, "-"); i > 0 {
+		speed = speed[:i]
+	}
+
+	return parseRate(speed)
+}
+
+func parseRate(s string) (float64, bool) {
+	if s = strings.TrimSpace(s); s == "" {
+		return 1, false
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v == 0 {
+		return 1, false
+	}
+
+	return v, true
+}
+
 // PauseRequest is a RTSP PAUSE request
 type PauseRequest struct {
 	IRequest
@@ -0,0 +1,65 @@
+package rtsp
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUnmarshalRequestHeaders(t *testing.T) {
+	const start = "ANNOUNCE rtsp://localhost/live/cam RTSP/1.0\r\nCSeq: 2\r\n"
+
+	tests := []struct {
+		name    string
+		header  string
+		body    string
+		content string
+		strict  bool
+		fail    bool
+	}{
+		{name: "content length", header: "Content-Length: 5\r\n", body: "v=0\r\n", content: "v=0\r\n"},
+		{name: "no content", header: "", body: "", content: ""},
+		{name: "folded header", header: "Session: 1234\r\n ;timeout=60\r\n"},
+		{name: "space before colon", header: "Content-Length : 5\r\n", body: "v=0\r\n", fail: true},
+		{name: "tab before colon", header: "Content-Length\t: 5\r\n", body: "v=0\r\n", fail: true},
+		{name: "no colon", header: "Content-Length 5\r\n", body: "v=0\r\n", fail: true},
+		{name: "empty key", header: ": 5\r\n", fail: true},
+		{name: "signed length", header: "Content-Length: +5\r\n", body: "v=0\r\n", fail: true},
+		{name: "negative length", header: "Content-Length: -1\r\n", fail: true},
+		{name: "empty length", header: "Content-Length:\r\n", fail: true},
+		{name: "length with garbage", header: "Content-Length: 5x\r\n", body: "v=0\r\n", fail: true},
+		{name: "conflicting lengths", header: "Content-Length: 5\r\nContent-Length: 0\r\n", body: "v=0\r\n", fail: true},
+		{name: "repeated length", header: "Content-Length: 5\r\nContent-Length: 5\r\n", body: "v=0\r\n", content: "v=0\r\n"},
+		{name: "repeated length strict", header: "Content-Length: 5\r\nContent-Length: 5\r\n", body: "v=0\r\n", strict: true, fail: true},
+		{name: "control character strict", header: "User-Agent: a\x01b\r\n", strict: true, fail: true},
+		{name: "bare line ending", header: "User-Agent: a\nContent-Length: 5\r\n", body: "v=0\r\n", fail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits := DefaultLimits
+			limits.Strict = tt.strict
+
+			buf := []byte(start + tt.header + "\r\n" + tt.body)
+			req, n, err := UnmarshalRequestWithLimits(buf, limits)
+			if tt.fail {
+				if err == nil {
+					t.Fatalf("parsed %d bytes, want an error", n)
+				}
+				if !errors.Is(err, ErrMalformed) {
+					t.Fatalf("err = %v, want ErrMalformed", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(buf) {
+				t.Errorf("consumed %d bytes, want %d", n, len(buf))
+			}
+			if string(req.content) != tt.content {
+				t.Errorf("content = %q, want %q", req.content, tt.content)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package rtsp
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
@@ -11,6 +12,7 @@ import (
 type IResponse interface {
 	String() string
 	CSeq() int
+	Status() Status
 	Session() string
 	//	Transport() (*Transport, error)
 	ContentLength() int
@@ -20,6 +22,7 @@ type IResponse interface {
 	Content() []byte
 	SetContent(content string)
 	Line(key string) string
+	GetLines(key string) []string
 	SetLine(key, value string)
 	Option() *OptionsResponse
 }
@@ -38,10 +41,10 @@ func NewResponse(cseq int, status Status) *Response {
 		status:    status,
 		statusStr: status.String(),
 		lines: HeaderLines{
-			"CSeq":           strconv.Itoa(cseq),
-			"Date":           time.Now().Format(time.RFC1123),
-			"Content-Length": strconv.Itoa(0),
-			"Server":         "Neon-RTSP",
+			{"CSeq", strconv.Itoa(cseq)},
+			{"Date", time.Now().Format(time.RFC1123)},
+			{"Content-Length", strconv.Itoa(0)},
+			{"Server", "Neon-RTSP"},
 		},
 	}
 
@@ -49,15 +52,24 @@ func NewResponse(cseq int, status Status) *Response {
 }
 
 func (resp *Response) String() string {
-	resp.lines["Content-Length"] = strconv.Itoa(len(resp.content))
+	resp.lines.Set("Content-Length", strconv.Itoa(len(resp.content)))
 	return resp.version + " " + strconv.Itoa(int(resp.status)) + " " + resp.status.String() + "\r\n" +
-		resp.lines.String() + "\r\n" +
+		resp.lines.Canonical().String() + "\r\n" +
 		string(resp.content)
 }
 
 func UnmarshalResponse(buf []byte) (*Response, int, error) {
+	return UnmarshalResponseWithLimits(buf, Limits{})
+}
+
+// UnmarshalResponseWithLimits is UnmarshalResponse failing as soon as buf
+// breaks limits, also while the response is incomplete.
+func UnmarshalResponseWithLimits(buf []byte, limits Limits) (*Response, int, error) {
 	headerEndOffset := bytes.Index(buf, []byte("\r\n\r\n"))
 	if headerEndOffset == -1 {
+		if err := limits.checkIncomplete(buf); err != nil {
+			return nil, -1, err
+		}
 		return nil, -1, errors.New("incomplete packet")
 	}
 
@@ -65,49 +77,52 @@ func UnmarshalResponse(buf []byte) (*Response, int, error) {
 
 	contentLength := 0
 
-	resp := &Response{
-		lines: make(HeaderLines),
-	}
+	resp := &Response{}
 
 	lines := bytes.Split(buf[:headerEndOffset], []byte("\r\n"))
 	if len(lines) < 2 {
 		return nil, endOffset, errors.New("invalid packet")
 	}
 
+	if err := limits.checkHeader(endOffset, len(lines)-1); err != nil {
+		return nil, endOffset, err
+	}
+
 	// parse first line
 	statusLine := lines[0]
-	statusLineParts := bytes.Split(statusLine, []byte(" "))
+	statusLineParts := bytes.SplitN(statusLine, []byte(" "), 3)
 	if len(statusLineParts) != 3 {
 		return nil, endOffset, errors.New("invalid packet")
 	}
 
 	resp.version = strings.ToLower(string(statusLineParts[0]))
-	status, _ := strconv.Atoi(string(statusLineParts[1]))
+	if err := limits.checkVersion(resp.version); err != nil {
+		return nil, endOffset, err
+	}
+
+	status, err := strconv.Atoi(string(statusLineParts[1]))
+	if err != nil && limits.Strict {
+		return nil, endOffset, fmt.Errorf("%w: status %q", ErrMalformed, statusLineParts[1])
+	}
 	resp.status = Status(status)
 	resp.statusStr = string(statusLineParts[2])
 
 	// parse other lines
-	for _, line := range lines {
-		if len(line) == 0 {
-			continue
-		}
+	resp.lines, contentLength, err = parseHeaderLines(lines[1:], limits)
+	if err != nil {
+		return nil, endOffset, err
+	}
 
-		idx := bytes.Index(line, []byte(":"))
-		if idx == -1 {
-			continue
-		}
+	if err := limits.checkContent(contentLength, resp.lines.Get("content-type")); err != nil {
+		return nil, endOffset, err
+	}
 
-		key := strings.ToLower(string(line[:idx]))
-		value := string(line[idx+1:])
-		resp.lines[key] = value
+	if contentLength < 0 {
+		contentLength = 0
+	}
 
-		if key == "content-length" {
-			var err error
-			contentLength, err = strconv.Atoi(value)
-			if err != nil {
-				return nil, headerEndOffset + 4, err
-			}
-		}
+	if len(buf) < endOffset+contentLength {
+		return nil, -1, errors.New("incomplete packet")
 	}
 
 	resp.content = buf[headerEndOffset+4 : headerEndOffset+4+contentLength]
@@ -117,8 +132,12 @@ func UnmarshalResponse(buf []byte) (*Response, int, error) {
 	return resp, endOffset, nil
 }
 
+func (resp *Response) Status() Status {
+	return resp.status
+}
+
 func (resp *Response) CSeq() int {
-	cseqLine := resp.lines["cseq"]
+	cseqLine := resp.lines.Get("cseq")
 	if cseqLine == "" {
 		return -1
 	}
@@ -132,27 +151,37 @@ func (resp *Response) CSeq() int {
 }
 
 func (resp *Response) Line(key string) string {
-	return resp.lines[key]
+	return resp.lines.Get(key)
+}
+
+// Lines returns the headers as received or set.
+func (resp *Response) Lines() HeaderLines {
+	return resp.lines
+}
+
+// GetLines returns every value of key, in the order of the response.
+func (resp *Response) GetLines(key string) []string {
+	return resp.lines.Values(key)
 }
 
 func (resp *Response) SetLine(key, value string) {
-	resp.lines[key] = value
+	resp.lines.Set(key, value)
 }
 
 func (resp *Response) Session() string {
-	return resp.lines["session"]
+	return resp.lines.Get("session")
 }
 
 func (resp *Response) Expires() string {
-	return resp.lines["expires"]
+	return resp.lines.Get("expires")
 }
 
 func (resp *Response) LastModified() string {
-	return resp.lines["last-modified"]
+	return resp.lines.Get("last-modified")
 }
 
 func (resp *Response) Server() string {
-	return resp.lines["server"]
+	return resp.lines.Get("server")
 }
 
 func (resp *Response) Content() []byte {
@@ -160,7 +189,7 @@ func (resp *Response) Content() []byte {
 }
 
 func (resp *Response) SetContent(content string) {
-	resp.lines["Content-Length"] = strconv.Itoa(len(content))
+	resp.lines.Set("Content-Length", strconv.Itoa(len(content)))
 	resp.content = []byte(content)
 }
 
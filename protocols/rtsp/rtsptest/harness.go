@@ -0,0 +1,268 @@
+package rtsptest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingostack/neon/protocols/rtsp"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultTimeout = time.Second
+
+// DefaultDescription is the stream of the recordings, h264 and aac.
+const DefaultDescription = "v=0\r\n" +
+	"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+	"s=neon\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"t=0 0\r\n" +
+	"a=control:*\r\n" +
+	"m=video 0 RTP/AVP 96\r\n" +
+	"a=rtpmap:96 H264/90000\r\n" +
+	"a=fmtp:96 packetization-mode=1;profile-level-id=42e01f;sprop-parameter-sets=Z0LgH9oBQBbpUgAAAwACAAADAGQeMGVA,aM4yyA==\r\n" +
+	"a=control:trackID=0\r\n" +
+	"m=audio 0 RTP/AVP 97\r\n" +
+	"a=rtpmap:97 MPEG4-GENERIC/48000/2\r\n" +
+	"a=fmtp:97 streamtype=5;profile-level-id=1;mode=AAC-hbr;sizelength=13;indexlength=3;indexdeltalength=3;config=1190\r\n" +
+	"a=control:trackID=1\r\n"
+
+// Server answers transcripts with a connection of the rtsp server fed in
+// process.
+type Server struct {
+	// Options of the connections, Write is set by the server.
+	Options rtsp.ServOptions
+	// Description answers DESCRIBE when Listener is nil, DefaultDescription
+	// when empty.
+	Description string
+	// Listener handles the events of the sessions.
+	Listener rtsp.IServSessionEventListener
+	// Timeout is how long a response is waited for, a second when 0.
+	Timeout time.Duration
+}
+
+// describer answers DESCRIBE with a description, the rest is accepted.
+type describer struct {
+	desc string
+}
+
+func (d *describer) OnDescribe(serv *rtsp.Serv) error {
+	serv.SetDescribe(d.desc)
+	return nil
+}
+
+func (d *describer) OnAnnounce(serv *rtsp.Serv) error { return nil }
+func (d *describer) OnPause(serv *rtsp.Serv) error    { return nil }
+func (d *describer) OnResume(serv *rtsp.Serv) error   { return nil }
+func (d *describer) OnStream(serv *rtsp.Serv) error   { return nil }
+
+type session struct {
+	*rtsp.ServSession
+	logger rtsp.Logger
+}
+
+func (s *session) Logger() rtsp.Logger {
+	return s.logger
+}
+
+// conn collects the responses of a connection by cseq.
+type conn struct {
+	lock      sync.Mutex
+	buf       []byte
+	responses map[int]*rtsp.Response
+	notify    chan struct{}
+	err       error
+}
+
+func (c *conn) write(data []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.buf = append(c.buf, data...)
+	for len(c.buf) > 0 {
+		if c.buf[0] == '$' {
+			// interleaved media
+			_, _, n := rtsp.ParseInterleaved(c.buf)
+			if n == 0 {
+				break
+			}
+			c.buf = c.buf[n:]
+			continue
+		}
+
+		resp, n, err := rtsp.UnmarshalResponse(c.buf)
+		if n < 0 {
+			break
+		}
+		if err != nil {
+			c.err = err
+			c.buf = nil
+			break
+		}
+		c.buf = c.buf[n:]
+		c.responses[resp.CSeq()] = resp
+	}
+
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+func (c *conn) wait(cseq int, timeout time.Duration) (*rtsp.Response, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		c.lock.Lock()
+		resp, ok := c.responses[cseq]
+		err := c.err
+		c.lock.Unlock()
+
+		switch {
+		case ok:
+			return resp, nil
+		case err != nil:
+			return nil, err
+		}
+
+		select {
+		case <-c.notify:
+		case <-deadline.C:
+			return nil, fmt.Errorf("no response in %s", timeout)
+		}
+	}
+}
+
+// Run sends the requests of t to a new connection, the error names the
+// first response that is not what the client expects.
+func (s *Server) Run(t *Transcript) error {
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	listener := s.Listener
+	if listener == nil {
+		desc := s.Description
+		if desc == "" {
+			desc = DefaultDescription
+		}
+		listener = &describer{desc: desc}
+	}
+
+	log := s.Options.Logger
+	if log == nil {
+		l := logrus.New()
+		l.SetOutput(io.Discard)
+		log = l
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := &conn{
+		responses: make(map[int]*rtsp.Response),
+		notify:    make(chan struct{}, 1),
+	}
+	opts := s.Options
+	opts.Write = c.write
+	opts.Logger = log
+	if opts.Context == nil {
+		opts.Context = ctx
+	}
+	if opts.RemoteAddr == "" {
+		opts.RemoteAddr = "127.0.0.1:50000"
+	}
+	serv := rtsp.NewServ(&session{ServSession: rtsp.NewServSession(listener), logger: log}, opts)
+
+	for _, e := range t.Exchanges {
+		for buf := e.Request; len(buf) > 0; {
+			n, err := serv.Feed(buf)
+			if err != nil {
+				return fmt.Errorf("%s:%d: request refused: %v", t.Name, e.Line, err)
+			}
+			if n <= 0 {
+				return fmt.Errorf("%s:%d: incomplete request", t.Name, e.Line)
+			}
+			buf = buf[n:]
+		}
+
+		if e.Expect == nil {
+			continue
+		}
+
+		resp, err := c.wait(e.CSeq, timeout)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", t.Name, e.Line, err)
+		}
+
+		if err := e.Expect.check(resp); err != nil {
+			return fmt.Errorf("%s:%d: %v, got\n%s", t.Name, e.Line, err, resp.String())
+		}
+	}
+
+	return nil
+}
+
+// RunAll runs every transcript, the error lists those that failed.
+func (s *Server) RunAll(ts []*Transcript) error {
+	var failures []string
+	for _, t := range ts {
+		if err := s.Run(t); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d transcripts failed:\n%s", len(failures), len(ts), strings.Join(failures, "\n"))
+	}
+
+	return nil
+}
+
+func (e *Expectation) check(resp *rtsp.Response) error {
+	status := fmt.Sprintf("RTSP/1.0 %d %s", resp.Status(), resp.Status())
+	if !match(e.Status, status) {
+		return fmt.Errorf("status %q, expected %q", status, e.Status)
+	}
+
+	for _, h := range e.Headers {
+		values := resp.GetLines(h[0])
+		if len(values) == 0 {
+			return fmt.Errorf("no %s", h[0])
+		}
+
+		found := false
+		for _, v := range values {
+			if match(h[1], v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s %q, expected %q", h[0], strings.Join(values, ", "), h[1])
+		}
+	}
+
+	content := strings.Split(strings.ReplaceAll(string(resp.Content()), "\r\n", "\n"), "\n")
+	for _, want := range e.Content {
+		found := false
+		for _, line := range content {
+			if match(want, line) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("no content line %q", want)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,25 @@
+package rtsptest
+
+import (
+	"testing"
+)
+
+func TestTranscripts(t *testing.T) {
+	transcripts, err := Transcripts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(transcripts) == 0 {
+		t.Fatal("no transcripts")
+	}
+
+	for _, tr := range transcripts {
+		tr := tr
+		t.Run(tr.Name, func(t *testing.T) {
+			if err := (&Server{}).Run(tr); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
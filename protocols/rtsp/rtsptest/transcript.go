@@ -0,0 +1,228 @@
+// Package rtsptest runs the rtsp server against transcripts of what real
+// clients sent, asserting the responses they need.
+//
+// A transcript is the requests of a client, each line prefixed with C:, and
+// after a request the response it expects, each line prefixed with S:.
+// Lines starting with # are comments, # client: names the client.
+//
+//	# client: ffmpeg 6.1
+//	C: OPTIONS rtsp://127.0.0.1:8554/live/cam RTSP/1.0
+//	C: CSeq: 1
+//	C:
+//	S: RTSP/1.0 200 OK
+//	S: Public: *DESCRIBE*
+//
+// The expected response is a status line and headers, every header has to
+// be sent with the value, * matching anything. After an empty S: line come
+// lines the content has to hold. The responses are matched by CSeq, a
+// request without an expected response is not waited for, like clients
+// send TEARDOWN and keepalives. Content-Length of requests is set to their
+// content.
+//
+// A test of the server runs the recordings:
+//
+//	ts, err := rtsptest.Transcripts()
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	if err := (&rtsptest.Server{}).RunAll(ts); err != nil {
+//		t.Fatal(err)
+//	}
+package rtsptest
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//go:embed transcripts/*.rtsp
+var transcripts embed.FS
+
+// Transcript is the requests of a client and the responses it expects.
+type Transcript struct {
+	Name      string
+	Client    string
+	Exchanges []Exchange
+}
+
+// Exchange is a request, Expect is nil when no response is waited for.
+type Exchange struct {
+	// Line is where the request starts in the transcript.
+	Line    int
+	CSeq    int
+	Request []byte
+	Expect  *Expectation
+}
+
+// Expectation is what a response has to hold.
+type Expectation struct {
+	Status  string
+	Headers [][2]string
+	Content []string
+}
+
+// Parse reads the transcript of r.
+func Parse(name string, r io.Reader) (*Transcript, error) {
+	t := &Transcript{Name: name}
+
+	var request, response []string
+	var start int
+	flush := func() error {
+		if len(request) == 0 {
+			if len(response) > 0 {
+				return fmt.Errorf("%s:%d: response without request", name, start)
+			}
+			return nil
+		}
+
+		e, err := newExchange(request, response)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", name, start, err)
+		}
+		e.Line = start
+		t.Exchanges = append(t.Exchanges, *e)
+		request, response = nil, nil
+
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case strings.HasPrefix(line, "#"):
+			if strings.HasPrefix(line, "# client:") {
+				t.Client = strings.TrimSpace(strings.TrimPrefix(line, "# client:"))
+			}
+		case strings.HasPrefix(line, "C:"):
+			if len(response) > 0 {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+			if len(request) == 0 {
+				start = n
+			}
+			request = append(request, strings.TrimPrefix(strings.TrimPrefix(line, "C:"), " "))
+		case strings.HasPrefix(line, "S:"):
+			response = append(response, strings.TrimPrefix(strings.TrimPrefix(line, "S:"), " "))
+		case strings.TrimSpace(line) == "":
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%s:%d: line without C: or S:", name, n)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func newExchange(request, response []string) (*Exchange, error) {
+	header, content := request, []string(nil)
+	for i, line := range request {
+		if line == "" {
+			header, content = request[:i], request[i+1:]
+			break
+		}
+	}
+
+	e := &Exchange{CSeq: -1}
+	var buf bytes.Buffer
+	body := strings.Join(content, "\r\n")
+	if body != "" {
+		body += "\r\n"
+	}
+
+	for i, line := range header {
+		key, value, _ := strings.Cut(line, ":")
+		switch {
+		case i == 0:
+		case strings.EqualFold(key, "content-length"):
+			continue
+		case strings.EqualFold(key, "cseq"):
+			cseq, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid cseq %q", value)
+			}
+			e.CSeq = cseq
+		}
+		buf.WriteString(line + "\r\n")
+	}
+
+	if e.CSeq < 0 {
+		return nil, fmt.Errorf("request without cseq")
+	}
+
+	if body != "" {
+		buf.WriteString("Content-Length: " + strconv.Itoa(len(body)) + "\r\n")
+	}
+	buf.WriteString("\r\n" + body)
+	e.Request = buf.Bytes()
+
+	if len(response) == 0 {
+		return e, nil
+	}
+
+	e.Expect = &Expectation{Status: response[0]}
+	for i, line := range response[1:] {
+		if line == "" {
+			e.Expect.Content = response[i+2:]
+			break
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid header %q", line)
+		}
+		e.Expect.Headers = append(e.Expect.Headers, [2]string{strings.TrimSpace(key), strings.TrimSpace(value)})
+	}
+
+	return e, nil
+}
+
+// Transcripts are those recorded from ffmpeg, VLC, live555 and GStreamer.
+func Transcripts() ([]*Transcript, error) {
+	entries, err := transcripts.ReadDir("transcripts")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*Transcript, 0, len(entries))
+	for _, entry := range entries {
+		f, err := transcripts.Open(path.Join("transcripts", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		t, err := Parse(strings.TrimSuffix(entry.Name(), ".rtsp"), f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, t)
+	}
+
+	return ret, nil
+}
+
+// match tells whether value is pattern, * matching anything.
+func match(pattern, value string) bool {
+	expr := strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	ok, _ := regexp.MatchString("(?s)^"+expr+"$", value)
+	return ok
+}
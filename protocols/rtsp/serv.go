@@ -1,10 +1,23 @@
 package rtsp
 
 import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	goPool "github.com/panjf2000/gnet/pkg/pool/goroutine"
+	"github.com/pingostack/neon/pkg/auth"
+	"github.com/pingostack/neon/pkg/ratelimit"
+	"github.com/pingostack/neon/pkg/rtclib/sdpassistor"
+	"github.com/pingostack/neon/pkg/tcp"
+	"github.com/pingostack/neon/pkg/trace"
 	"github.com/pion/sdp/v3"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -15,44 +28,174 @@ const (
 	PlayState
 	PauseState
 	TeardownState
+	RecordState
 )
 
+var stateNames = [...]string{"empty", "options", "describe", "setup", "play", "pause", "teardown", "record"}
+
+func (s State) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return "unknown"
+	}
+
+	return stateNames[s]
+}
+
+const (
+	defaultDescribeTimeout = 10 * time.Second
+)
+
+var methodStates = map[MethodEnum]State{
+	OptionsMethod:  OptionsState,
+	DescribeMethod: DescribeState,
+	SetupMethod:    SetupState,
+	PlayMethod:     PlayState,
+	PauseMethod:    PauseState,
+	TeardownMethod: TeardownState,
+	RecordMethod:   RecordState,
+}
+
 type ServOptions struct {
 	IdleTimeout time.Duration `json:"idleTimeout,omitempty" p:"idleTimeout"` // idle timeout
 	Logger      Logger
 	Write       WriteHandler
+	Context     context.Context
+	RemoteAddr  string
+	// Authenticator is consulted on DESCRIBE and PLAY (play), ANNOUNCE and
+	// RECORD (publish) and SETUP, nil disables auth.
+	Authenticator auth.Authenticator
+	Realm         string
+	// Writer, if set, carries media with backpressure, see WriteFrame.
+	Writer *tcp.Writer
+	// Redirect, if set, may send DESCRIBE requests to another server.
+	Redirect Redirector
+	// Middlewares run around the method handlers, see Middleware.
+	Middlewares []Middleware
+	// Limits bound what clients may send, the zero value is unlimited.
+	Limits Limits
+	// CodecPreferences order the formats of the media of DESCRIBE.
+	CodecPreferences []string
+}
+
+// Redirector returns where a DESCRIBE of url is answered instead, false
+// serves it here.
+type Redirector func(url string) (location string, ok bool)
+
+// authKey is an action authenticated for a stream.
+type authKey struct {
+	action auth.Action
+	path   string
 }
 
 type Serv struct {
 	ss          IServSession
-	state       State
+	state       int32
 	cseqCounter int
 	pool        *goPool.Pool
 	descChan    chan string
 	url         string
 	options     ServOptions
 	desc        []byte
+	nonce       string
+	authLock    sync.Mutex
+	authorized  map[authKey]bool
+	// the stream of DESCRIBE or ANNOUNCE, SETUP, PLAY and RECORD are
+	// authenticated for it
+	path        string
+	publish     bool
+	backchannel bool
+	// interleaved rtp channel of the backchannel, -1 until it is set up
+	backchannelChannel int32
+	handler            HandlerFunc
+	hooksLock          sync.Mutex
+	// hooks of the responses, by cseq
+	hooks map[int][]func(IResponse)
 }
 
 func NewServ(ss IServSession, options ServOptions) *Serv {
 
 	return &Serv{
 		ss:          ss,
-		state:       EmptyState,
+		state:       int32(EmptyState),
 		cseqCounter: 0,
 		pool:        goPool.Default(),
 		descChan:    make(chan string, 1),
 		url:         "",
 		options:     options,
+		nonce:       auth.NewNonce(),
+		authorized:  make(map[authKey]bool),
+
+		backchannelChannel: -1,
+		handler:            Chain(dispatch, options.Middlewares...),
 	}
 }
 
 func (serv *Serv) State() State {
-	return serv.state
+	return State(atomic.LoadInt32(&serv.state))
+}
+
+// Established reports whether the client got as far as PLAY or RECORD.
+func (serv *Serv) Established() bool {
+	switch serv.State() {
+	case PlayState, PauseState, RecordState:
+		return true
+	}
+
+	return false
+}
+
+// Ready reports whether the client set up the media, PLAY and RECORD are
+// valid from then on.
+func (serv *Serv) Ready() bool {
+	switch serv.State() {
+	case SetupState, PlayState, PauseState, RecordState:
+		return true
+	}
+
+	return false
 }
 
+// nextState is the state req moves the session to once answered with
+// status, false when it stays. Requests without a response have status 0.
+func (serv *Serv) nextState(req *Request, status Status) (State, bool) {
+	if status != 0 && (status < 200 || status >= 300) {
+		return serv.State(), false
+	}
+
+	state, ok := methodStates[req.Method()]
+	// keepalives such as OPTIONS must not move an established session back
+	if !ok || (state < PlayState && serv.Established()) {
+		return serv.State(), false
+	}
+
+	return state, true
+}
+
+func (serv *Serv) setState(state State) {
+	atomic.StoreInt32(&serv.state, int32(state))
+}
+
+// decodeRtpRtcp consumes an interleaved frame, rtp of the backchannel goes to
+// the listener, the rest, e.g. receiver reports, is dropped.
 func (serv *Serv) decodeRtpRtcp(buf []byte) (int, error) {
-	return 0, nil
+	if err := serv.options.Limits.checkInterleaved(buf); err != nil {
+		return 0, err
+	}
+
+	channel, data, n := ParseInterleaved(buf)
+	if n == 0 {
+		return 0, nil
+	}
+
+	if int32(channel) != atomic.LoadInt32(&serv.backchannelChannel) {
+		return n, nil
+	}
+
+	if l, ok := serv.ss.GetEventListener().(IBackchannelListener); ok {
+		l.OnBackchannelPacket(serv, data)
+	}
+
+	return n, nil
 }
 
 func (serv *Serv) Feed(buf []byte) (int, error) {
@@ -65,11 +208,22 @@ func (serv *Serv) Feed(buf []byte) (int, error) {
 	var endOffset int
 	if buf[0] != '$' {
 		var req *Request
-		req, endOffset, err = UnmarshalRequest(buf)
-		if err != nil || endOffset == 0 {
+		req, endOffset, err = UnmarshalRequestWithLimits(buf, serv.options.Limits)
+		if err != nil {
+			serv.reject(err)
 			return endOffset, err
 		}
 
+		if endOffset == 0 {
+			return 0, nil
+		}
+
+		// answers to requests of the server, e.g. REDIRECT
+		if strings.HasPrefix(req.method, "rtsp/") {
+			serv.Logger().Debugf("rtsp response: %s", req.String())
+			return endOffset, nil
+		}
+
 		err := serv.handleRequest(req)
 		if err != nil {
 			return endOffset, err
@@ -86,6 +240,15 @@ func (serv *Serv) Feed(buf []byte) (int, error) {
 	return endOffset, nil
 }
 
+// reject answers a request that broke the limits, the connection is closed
+// after.
+func (serv *Serv) reject(err error) {
+	if status, ok := limitStatus(err); ok {
+		serv.Logger().Warnf("rtsp request from %s rejected: %v", serv.options.RemoteAddr, err)
+		serv.WriteResponseStatus(0, status)
+	}
+}
+
 func (serv *Serv) SetDescribe(desc string) {
 	serv.descChan <- desc
 }
@@ -106,38 +269,37 @@ func (serv *Serv) handleRequest(req *Request) error {
 
 		serv.Logger().Debugf("rtsp request: %s", req.String())
 
+		_, span := trace.Start(serv.options.Context, "rtsp."+strings.ToUpper(req.MethodStr()),
+			oteltrace.WithSpanKind(oteltrace.SpanKindServer),
+			oteltrace.WithAttributes(attribute.String("rtsp.url", req.Url()), attribute.Int("rtsp.cseq", req.CSeq())))
+
 		if serv.url == "" {
 			serv.url = req.Url()
 		}
 
-		var err error
-		switch req.Method() {
-		case OptionsMethod:
-			err = serv.OptionsProcess(req)
-		case DescribeMethod:
-			err = serv.DescribeProcess(req)
-		case AnnounceMethod:
-			err = serv.AnnounceProcess(req)
-		case SetupMethod:
-			err = serv.SetupProcess(req)
-		case PlayMethod:
-			err = serv.PlayProcess(req)
-		case PauseMethod:
-			err = serv.PauseProcess(req)
-		case TeardownMethod:
-			err = serv.TeardownProcess(req)
-		case GetParameterMethod:
-			err = serv.GetParameterProcess(req)
-		case SetParameterMethod:
-			err = serv.SetParameterProcess(req)
-		default:
-			err = serv.WriteResponseStatus(req.CSeq(), StatusMethodNotAllowed)
-		}
+		responded := false
+		serv.OnResponse(req, func(resp IResponse) {
+			responded = true
+			// before the client has the response and sends the next request
+			if state, ok := serv.nextState(req, resp.Status()); ok {
+				serv.setState(state)
+			}
+		})
+
+		err := serv.handler(serv, req)
+		serv.dropResponseHooks(req)
+
+		trace.RecordError(span, err)
+		span.End()
 
 		if err != nil {
 			serv.Logger().Errorf("rtsp request error: %s", err.Error())
 			return
 		}
+
+		if state, ok := serv.nextState(req, 0); ok && !responded {
+			serv.setState(state)
+		}
 	})
 	return nil
 }
@@ -152,6 +314,7 @@ func (serv *Serv) OptionsProcess(req *Request) error {
 		"TEARDOWN",
 		"PLAY",
 		"PAUSE",
+		"RECORD",
 		"GET_PARAMETER",
 		"SET_PARAMETER",
 	})
@@ -160,6 +323,23 @@ func (serv *Serv) OptionsProcess(req *Request) error {
 }
 
 func (serv *Serv) DescribeProcess(req *Request) error {
+	if ok, err := serv.authenticate(req, auth.ActionPlay, serv.target(req, false)); !ok {
+		return err
+	}
+
+	if ok, err := serv.checkRequire(req); !ok {
+		return err
+	}
+
+	if serv.options.Redirect != nil {
+		if location, ok := serv.options.Redirect(req.Url()); ok {
+			serv.Logger().Infof("rtsp describe redirected to %s", location)
+			resp := NewResponse(req.CSeq(), StatusMovedTemporarily)
+			resp.SetLine("location", location)
+			return serv.WriteResponse(resp)
+		}
+	}
+
 	if serv.ss.GetEventListener() != nil {
 		if err := serv.ss.GetEventListener().OnDescribe(serv); err != nil {
 			serv.Logger().Errorf("rtsp describe error: %s", err.Error())
@@ -169,6 +349,20 @@ func (serv *Serv) DescribeProcess(req *Request) error {
 
 	select {
 	case desc := <-serv.descChan:
+		if serv.backchannel {
+			var err error
+			if desc, err = serv.describeBackchannel(desc); err != nil {
+				serv.Logger().Warnf("rtsp backchannel refused: %v", err)
+				return serv.writeUnsupported(req.CSeq(), RequireBackchannel)
+			}
+		}
+
+		if ordered, err := preferCodecs(desc, serv.options.CodecPreferences); err != nil {
+			serv.Logger().Warnf("rtsp describe codecs not ordered: %v", err)
+		} else {
+			desc = ordered
+		}
+
 		serv.Logger().Debugf("rtsp describe get desc: %s", desc)
 		resp := NewResponse(req.CSeq(), StatusOK).Describe()
 		resp.SetContentType("application/sdp")
@@ -176,13 +370,25 @@ func (serv *Serv) DescribeProcess(req *Request) error {
 		resp.SetContent(desc)
 		return serv.WriteResponse(resp)
 
-	case <-time.After(serv.options.IdleTimeout * time.Second):
+	case <-time.After(serv.describeTimeout()):
 		serv.Logger().Debugf("rtsp describe timeout")
 		return serv.WriteResponseStatus(req.CSeq(), StatusNotFound)
 	}
 }
 
+func (serv *Serv) describeTimeout() time.Duration {
+	if serv.options.IdleTimeout > 0 {
+		return serv.options.IdleTimeout
+	}
+
+	return defaultDescribeTimeout
+}
+
 func (serv *Serv) AnnounceProcess(req *Request) error {
+	if ok, err := serv.authenticate(req, auth.ActionPublish, serv.target(req, true)); !ok {
+		return err
+	}
+
 	contentType := req.Announce().ContentType()
 	if contentType != "application/sdp" {
 		return serv.WriteResponseStatus(req.CSeq(), StatusUnsupportedMediaType)
@@ -208,6 +414,18 @@ func (serv *Serv) AnnounceProcess(req *Request) error {
 
 func (serv *Serv) SetupProcess(req *Request) error {
 	serv.Logger().Debugf("rtsp setup")
+	action, path := auth.ActionPlay, serv.sessionPath(req)
+	if serv.publishing() {
+		action = auth.ActionPublish
+	}
+	if ok, err := serv.authenticate(req, action, path); !ok {
+		return err
+	}
+
+	if ok, err := serv.checkRequire(req); !ok {
+		return err
+	}
+
 	trans, err := req.Setup().Transport()
 	if err != nil {
 		serv.Logger().Errorf("rtsp setup error: %s", err)
@@ -216,11 +434,157 @@ func (serv *Serv) SetupProcess(req *Request) error {
 
 	serv.Logger().Debugf("rtsp setup transport: %v", *trans)
 
+	if serv.backchannel && strings.HasSuffix(strings.TrimSuffix(req.Url(), "/"), "/"+BackchannelControl) {
+		// the server has no udp receiver, talk-down audio comes interleaved
+		if trans.ty != TransportTypeTcp {
+			return serv.WriteResponseStatus(req.CSeq(), StatusUnsupportedTransport)
+		}
+
+		atomic.StoreInt32(&serv.backchannelChannel, int32(trans.RtpInterleaved()))
+	}
+
 	return serv.WriteResponse(NewSetupResponse(req.CSeq(), StatusOK, trans))
 }
 
+// checkRequire answers 551 to requests requiring features other than the
+// backchannel, or the backchannel when the listener takes no audio.
+func (serv *Serv) checkRequire(req *Request) (bool, error) {
+	_, canBackchannel := serv.ss.GetEventListener().(IBackchannelListener)
+
+	for _, tag := range requireTags(req) {
+		if tag != RequireBackchannel || !canBackchannel {
+			return false, serv.writeUnsupported(req.CSeq(), tag)
+		}
+
+		serv.backchannel = true
+	}
+
+	return true, nil
+}
+
+func (serv *Serv) describeBackchannel(desc string) (string, error) {
+	formats, err := serv.ss.GetEventListener().(IBackchannelListener).OnBackchannel(serv)
+	if err != nil {
+		return "", err
+	}
+
+	if len(formats) == 0 {
+		return "", fmt.Errorf("no backchannel formats")
+	}
+
+	return appendBackchannel(desc, formats)
+}
+
+// preferCodecs orders the formats of the media of the description desc by
+// prefs.
+func preferCodecs(desc string, prefs []string) (string, error) {
+	if len(prefs) == 0 {
+		return desc, nil
+	}
+
+	var sd sdp.SessionDescription
+	if err := sd.Unmarshal([]byte(desc)); err != nil {
+		return desc, err
+	}
+
+	sdpassistor.PreferCodecsSDP(&sd, prefs)
+
+	out, err := sd.Marshal()
+	if err != nil {
+		return desc, err
+	}
+
+	return string(out), nil
+}
+
+func (serv *Serv) writeUnsupported(cseq int, tag string) error {
+	resp := NewResponse(cseq, StatusOptionNotSupported)
+	resp.SetLine("Unsupported", tag)
+
+	return serv.WriteResponse(resp)
+}
+
+// Backchannel reports whether the client required the backchannel.
+func (serv *Serv) Backchannel() bool {
+	return serv.backchannel
+}
+
+// IRateListener is implemented by session listeners of streams that can be
+// played at another rate, e.g. recordings.
+type IRateListener interface {
+	// OnRate applies the Scale and Speed of a PLAY and returns the values
+	// applied.
+	OnRate(serv *Serv, scale, speed float64) (float64, float64)
+}
+
+// ISeekListener is implemented by session listeners of streams that can
+// start elsewhere, e.g. recordings.
+type ISeekListener interface {
+	// OnRange moves the stream to the Range of a PLAY and returns the range
+	// played, e.g. from the keyframe before its start.
+	OnRange(serv *Serv, rangeHeader string) (string, error)
+}
+
 func (serv *Serv) PlayProcess(req *Request) error {
-	return nil
+	if !serv.Ready() {
+		return serv.WriteResponseStatus(req.CSeq(), StatusMethodNotValid)
+	}
+
+	path := serv.sessionPath(req)
+	if ok, err := serv.authenticate(req, auth.ActionPlay, path); !ok {
+		return err
+	}
+
+	if serv.options.Writer != nil {
+		serv.options.Writer.SetLimiter(ratelimit.Default().ForSession(path))
+	}
+
+	play := req.Play()
+	scale, hasScale := play.Scale()
+	speed, hasSpeed := play.Speed()
+
+	resp := NewResponse(req.CSeq(), StatusOK)
+	if hasScale || hasSpeed {
+		// streams that can't change the rate play at 1, the client is told so
+		applied, appliedSpeed := 1.0, 1.0
+		if l, ok := serv.ss.GetEventListener().(IRateListener); ok {
+			applied, appliedSpeed = l.OnRate(serv, scale, speed)
+		}
+
+		if hasScale {
+			resp.SetLine("Scale", strconv.FormatFloat(applied, 'f', -1, 64))
+		}
+		if hasSpeed {
+			resp.SetLine("Speed", strconv.FormatFloat(appliedSpeed, 'f', -1, 64))
+		}
+	}
+
+	if r := play.Range(); r != "" {
+		if l, ok := serv.ss.GetEventListener().(ISeekListener); ok {
+			played, err := l.OnRange(serv, r)
+			if err != nil {
+				serv.Logger().Warnf("rtsp play range %s: %v", r, err)
+				return serv.WriteResponseStatus(req.CSeq(), StatusInvalidRange)
+			}
+			r = played
+		}
+
+		resp.SetLine("Range", r)
+	}
+
+	return serv.WriteResponse(resp)
+}
+
+func (serv *Serv) RecordProcess(req *Request) error {
+	if !serv.Ready() {
+		return serv.WriteResponseStatus(req.CSeq(), StatusMethodNotValid)
+	}
+
+	if ok, err := serv.authenticate(req, auth.ActionPublish, serv.sessionPath(req)); !ok {
+		return err
+	}
+
+	return serv.WriteResponseStatus(req.CSeq(), StatusOK)
 }
 
 func (serv *Serv) PauseProcess(req *Request) error {
@@ -239,7 +603,130 @@ func (serv *Serv) SetParameterProcess(req *Request) error {
 	return nil
 }
 
+// target makes the stream of req that of the session, DESCRIBE plays it
+// and ANNOUNCE publishes it.
+func (serv *Serv) target(req *Request, publish bool) string {
+	serv.authLock.Lock()
+	defer serv.authLock.Unlock()
+
+	serv.path, serv.publish = streamPath(req.Url()), publish
+
+	return serv.path
+}
+
+// sessionPath is the stream of the session, that of req when nothing was
+// described or announced.
+func (serv *Serv) sessionPath(req *Request) string {
+	serv.authLock.Lock()
+	defer serv.authLock.Unlock()
+
+	if serv.path != "" {
+		return serv.path
+	}
+
+	return streamPath(req.Url())
+}
+
+func (serv *Serv) publishing() bool {
+	serv.authLock.Lock()
+	defer serv.authLock.Unlock()
+
+	return serv.publish
+}
+
+// authenticate answers 401 with a digest challenge when the request carries no
+// valid credentials for action on the stream path, the caller should stop
+// processing when it returns false.
+func (serv *Serv) authenticate(req *Request, action auth.Action, path string) (bool, error) {
+	if serv.options.Authenticator == nil {
+		return true, nil
+	}
+
+	key := authKey{action: action, path: path}
+	serv.authLock.Lock()
+	authorized := serv.authorized[key]
+	serv.authLock.Unlock()
+	if authorized {
+		return true, nil
+	}
+
+	realm := serv.options.Realm
+	if realm == "" {
+		realm = "neon"
+	}
+
+	areq := &auth.Request{
+		Protocol:   auth.ProtocolRTSP,
+		Action:     action,
+		Path:       path,
+		Host:       streamHost(req.Url()),
+		RemoteAddr: serv.options.RemoteAddr,
+		Args:       queryArgs(req.Url()),
+	}
+
+	header := req.GetLine("authorization")
+	switch {
+	case len(header) > 6 && strings.EqualFold(header[:6], "basic "):
+		if username, password, ok := parseBasic(header); ok {
+			areq.Username, areq.Password = username, password
+		}
+
+	case header != "":
+		digest, err := auth.ParseDigest(header, req.MethodStr())
+		// the digest of another url is replayed
+		if err == nil && digest.Nonce == serv.nonce && digest.Realm == realm && digest.MatchURI(req.Url()) {
+			areq.Digest = digest
+		}
+	}
+
+	if areq.Username == "" && areq.Digest == nil {
+		areq.Token = queryToken(req.Url())
+	}
+
+	if areq.Username != "" || areq.Digest != nil || areq.Token != "" || areq.Args[auth.SignedArgSign] != "" {
+		_, err := serv.options.Authenticator.Authenticate(serv.options.Context, areq)
+		if err == nil {
+			serv.authLock.Lock()
+			serv.authorized[key] = true
+			serv.authLock.Unlock()
+			return true, nil
+		}
+
+		serv.Logger().Warnf("rtsp %s authentication failed: %v", action, err)
+		if err == auth.ErrForbidden {
+			return false, serv.WriteResponseStatus(req.CSeq(), StatusForbidden)
+		}
+	}
+
+	resp := NewResponse(req.CSeq(), StatusUnauthorized)
+	resp.SetLine("WWW-Authenticate", auth.DigestChallenge(realm, serv.nonce))
+
+	return false, serv.WriteResponse(resp)
+}
+
+// Redirect asks the client to continue the session at location, players
+// tear down and reconnect there.
+func (serv *Serv) Redirect(location string) error {
+	serv.cseqCounter++
+
+	req := &Request{
+		method:  "REDIRECT",
+		url:     serv.url,
+		version: "RTSP/1.0",
+		lines: HeaderLines{
+			{"CSeq", strconv.Itoa(serv.cseqCounter)},
+			{"Location", location},
+		},
+	}
+
+	serv.Logger().Infof("rtsp session redirected to %s", location)
+
+	return serv.options.Write([]byte(req.String()))
+}
+
 func (serv *Serv) WriteResponse(resp IResponse) error {
+	serv.runResponseHooks(resp)
+
 	return serv.options.Write([]byte(resp.String()))
 }
 
@@ -247,6 +734,31 @@ func (serv *Serv) WriteResponseStatus(cseq int, status Status) error {
 	return serv.WriteResponse(NewResponse(cseq, status))
 }
 
+// WriteFrame writes interleaved media, frames are dropped up to the next
+// keyframe while the connection is congested.
+func (serv *Serv) WriteFrame(data []byte, keyframe bool) error {
+	if serv.options.Writer == nil {
+		return serv.options.Write(data)
+	}
+
+	return serv.options.Writer.WriteFrame(data, keyframe)
+}
+
+// Congested reports whether the client reads slower than media is produced.
+func (serv *Serv) Congested() bool {
+	return serv.options.Writer != nil && serv.options.Writer.Congested()
+}
+
+// SetRemoteAddr replaces the peer address, e.g. with the one a PROXY header announced.
+func (serv *Serv) SetRemoteAddr(addr string) {
+	serv.options.RemoteAddr = addr
+}
+
+// RemoteAddr is the client address used for authentication and logging.
+func (serv *Serv) RemoteAddr() string {
+	return serv.options.RemoteAddr
+}
+
 func (serv *Serv) GetDescription() []byte {
 	return serv.desc
 }
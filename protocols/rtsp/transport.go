@@ -95,13 +95,16 @@ func (t *Transport) SetSSRC(s int32) {
 	t.ssrc = int64(s)
 }
 
-func (t *Transport) String() string {
-	s := "Transport: "
+// SetMode sets the mode of the transport, e.g. record to publish.
+func (t *Transport) SetMode(mode string) {
+	t.mode = mode
+}
 
-	s += t.profile.String()
+func (t *Transport) String() string {
+	s := strings.ToUpper(t.profile.String())
 
 	if t.ty == TransportTypeTcp {
-		s += "TCP;"
+		s += "/TCP;unicast;"
 
 		s += "interleaved="
 		for i, v := range t.interleaveds {
@@ -111,13 +114,12 @@ func (t *Transport) String() string {
 			}
 		}
 	} else {
-		s += "UDP;"
 		if t.unicast {
-			s += "unicast;"
+			s += ";unicast"
 		}
 
 		if len(t.clientPorts) > 0 {
-			s += "client_port="
+			s += ";client_port="
 			for i, v := range t.clientPorts {
 				s += strconv.Itoa(v)
 				if i < len(t.clientPorts)-1 {
@@ -127,7 +129,7 @@ func (t *Transport) String() string {
 		}
 
 		if len(t.serverPorts) > 0 {
-			s += "server_port="
+			s += ";server_port="
 			for i, v := range t.serverPorts {
 				s += strconv.Itoa(v)
 				if i < len(t.serverPorts)-1 {
@@ -141,6 +143,10 @@ func (t *Transport) String() string {
 		s += fmt.Sprintf(";ssrc=%x", t.ssrc)
 	}
 
+	if t.mode != "" {
+		s += ";mode=" + t.mode
+	}
+
 	return s
 }
 
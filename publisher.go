@@ -0,0 +1,172 @@
+package neon
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/pingostack/neon/pkg/codec"
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/rtclib"
+)
+
+const (
+	publisherVideoPayloadType = 96
+	publisherAudioPayloadType = 111
+	publisherVideoClockRate   = 90000
+	publisherAudioSampleRate  = 48000
+)
+
+var ErrNoTrack = errors.New("publisher has no such track")
+
+type PublisherOptions struct {
+	// Video is the codec of the video track, none when zero.
+	Video  deliver.CodecType
+	Width  int
+	Height int
+	// Audio is the codec of the audio track, none when zero.
+	Audio deliver.CodecType
+	// SampleRate of audio, 48000 when zero as opus always is over rtp.
+	SampleRate uint32
+	// Channels of audio, 2 when zero.
+	Channels uint8
+}
+
+// Publisher is a stream published from Go code: encoded frames written to it
+// are packetized to rtp and delivered to the subscribers of the stream like
+// those of any other publisher. A track is written from one goroutine at a
+// time.
+type Publisher struct {
+	deliver.FrameSource
+	session Session
+	video   *rtclib.Packetizer
+	audio   *rtclib.Packetizer
+	vcodec  deliver.CodecType
+	rate    uint32
+}
+
+// NewPublisher publishes a stream with the tracks of opts, until ctx is done
+// or Close is called.
+func (h *Hub) NewPublisher(ctx context.Context, params StreamParams, opts PublisherOptions) (*Publisher, error) {
+	p := &Publisher{
+		vcodec: opts.Video,
+		rate:   opts.SampleRate,
+	}
+
+	metadata := deliver.Metadata{PacketType: deliver.PacketTypeRtp}
+	if opts.Video != deliver.CodecTypeNone {
+		packetizer, err := rtclib.NewPacketizer(opts.Video, publisherVideoPayloadType, publisherVideoClockRate)
+		if err != nil {
+			return nil, err
+		}
+
+		p.video = packetizer
+		metadata.Video = &deliver.VideoMetadata{
+			Codec:          opts.Video.String(),
+			CodecType:      opts.Video,
+			Width:          opts.Width,
+			Height:         opts.Height,
+			RtpPayloadType: publisherVideoPayloadType,
+			ClockRate:      publisherVideoClockRate,
+		}
+	}
+
+	if opts.Audio != deliver.CodecTypeNone {
+		if p.rate == 0 {
+			p.rate = publisherAudioSampleRate
+		}
+
+		channels := opts.Channels
+		if channels == 0 {
+			channels = 2
+		}
+
+		packetizer, err := rtclib.NewPacketizer(opts.Audio, publisherAudioPayloadType, p.rate)
+		if err != nil {
+			return nil, err
+		}
+
+		p.audio = packetizer
+		metadata.Audio = &deliver.AudioMetadata{
+			Codec:          opts.Audio.String(),
+			CodecType:      opts.Audio,
+			SampleRate:     p.rate,
+			Channels:       channels,
+			RtpPayloadType: publisherAudioPayloadType,
+		}
+	}
+
+	if p.video == nil && p.audio == nil {
+		return nil, ErrNoTrack
+	}
+
+	p.FrameSource = deliver.NewFrameSourceImpl(ctx, metadata)
+
+	params.HasAudio, params.HasVideo = p.audio != nil, p.video != nil
+	session, err := h.Publish(ctx, params, p.FrameSource)
+	if err != nil {
+		p.FrameSource.Close()
+		return nil, err
+	}
+	p.session = session
+
+	return p, nil
+}
+
+func (p *Publisher) Session() Session {
+	return p.session
+}
+
+// WriteVideo publishes an access unit presented at pts, h264 as annex b with
+// the sps and pps in front of keyframes. Access units are written in decoding
+// order, the pts of B-frames go back.
+func (p *Publisher) WriteVideo(au []byte, pts time.Duration) error {
+	if p.video == nil {
+		return ErrNoTrack
+	}
+
+	keyframe := false
+	switch p.vcodec {
+	case deliver.CodecTypeH264, deliver.CodecTypeH265:
+		keyframe = codec.IsKeyframe(p.vcodec, au)
+	}
+
+	return p.write(p.video, deliver.Frame{
+		Codec:          p.vcodec,
+		PacketType:     deliver.PacketTypeRaw,
+		Payload:        au,
+		Length:         len(au),
+		TimeStamp:      clockTicks(pts, publisherVideoClockRate),
+		AdditionalInfo: &deliver.VideoFrameSpecificInfo{IsKeyFrame: keyframe},
+	})
+}
+
+// WriteAudio publishes an audio frame, e.g. an opus packet, presented at pts.
+func (p *Publisher) WriteAudio(data []byte, pts time.Duration) error {
+	if p.audio == nil {
+		return ErrNoTrack
+	}
+
+	return p.write(p.audio, deliver.Frame{
+		Codec:      p.FrameSource.Metadata().Audio.CodecType,
+		PacketType: deliver.PacketTypeRaw,
+		Payload:    data,
+		Length:     len(data),
+		TimeStamp:  clockTicks(pts, p.rate),
+	})
+}
+
+func (p *Publisher) write(packetizer *rtclib.Packetizer, frame deliver.Frame) error {
+	for _, f := range packetizer.Packetize(frame) {
+		if err := p.FrameSource.DeliverFrame(f, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// clockTicks converts d to an rtp timestamp of the clock of rate.
+func clockTicks(d time.Duration, rate uint32) uint32 {
+	return uint32(int64(d/time.Second)*int64(rate) + int64(d%time.Second)*int64(rate)/int64(time.Second))
+}
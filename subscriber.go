@@ -0,0 +1,122 @@
+package neon
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pingostack/neon/pkg/deliver"
+	"github.com/pingostack/neon/pkg/record"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultSubscriberBuffer = 64
+
+type SubscriberOptions struct {
+	// OnFrame is called with every frame, from the goroutine delivering the
+	// stream, which it holds up. Frames go to Frames when nil.
+	OnFrame func(frame deliver.Frame)
+	// OnMetadata is called when the stream starts and when its codecs change,
+	// before the frames of the new codecs.
+	OnMetadata func(md *deliver.Metadata)
+	// Buffer is the capacity of Frames, 64 when zero. Frames are dropped
+	// while it is full.
+	Buffer int
+}
+
+// Subscriber receives the frames of a stream in Go code, assembled from rtp
+// whatever the protocol of the publisher: video access units, h264 as annex
+// b, and audio frames, stamped with their rtp timestamp.
+type Subscriber struct {
+	dest    *record.FrameDestination
+	session Session
+	lock    sync.Mutex
+	frames  chan deliver.Frame
+	closed  bool
+}
+
+// NewSubscriber subscribes to a stream, until ctx is done or Close is
+// called. The stream may have no publisher yet.
+func (h *Hub) NewSubscriber(ctx context.Context, params StreamParams, opts SubscriberOptions) (*Subscriber, error) {
+	s := &Subscriber{
+		dest: record.NewFrameDestination(ctx, logrus.WithField("stream", params.Stream)),
+	}
+
+	if opts.OnMetadata != nil {
+		s.dest.OnMetadataChange(opts.OnMetadata)
+	}
+
+	if opts.OnFrame != nil {
+		s.dest.OnRawFrame(opts.OnFrame)
+	} else {
+		if opts.Buffer <= 0 {
+			opts.Buffer = defaultSubscriberBuffer
+		}
+		s.frames = make(chan deliver.Frame, opts.Buffer)
+		s.dest.OnRawFrame(s.push)
+
+		go func() {
+			<-s.dest.Context().Done()
+
+			s.lock.Lock()
+			defer s.lock.Unlock()
+
+			s.closed = true
+			close(s.frames)
+		}()
+	}
+
+	params.HasAudio, params.HasVideo = true, true
+	session, err := h.Subscribe(ctx, params, s.dest)
+	if err != nil {
+		s.dest.Close()
+		return nil, err
+	}
+	s.session = session
+
+	return s, nil
+}
+
+// push hands frame to Frames, a copy of it when the payload is pooled.
+func (s *Subscriber) push(frame deliver.Frame) {
+	if frame.Buffer != nil {
+		frame.Payload = append([]byte(nil), frame.Payload...)
+		frame.RawPacket, frame.Buffer = nil, nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.frames <- frame:
+	default:
+	}
+}
+
+// Frames returns the frames of the stream when no OnFrame was given, the
+// channel is closed when the subscriber ends.
+func (s *Subscriber) Frames() <-chan deliver.Frame {
+	return s.frames
+}
+
+// RequestKeyframe asks the publisher for a keyframe, e.g. after falling
+// behind.
+func (s *Subscriber) RequestKeyframe() {
+	s.dest.RequestKeyframe()
+}
+
+func (s *Subscriber) Session() Session {
+	return s.session
+}
+
+// Done is closed when the subscriber ends.
+func (s *Subscriber) Done() <-chan struct{} {
+	return s.dest.Context().Done()
+}
+
+func (s *Subscriber) Close() {
+	s.dest.Close()
+}